@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fullSection loads one part of the composed album view for GET /albums/:id/full from the
+// server's integrations. A nil result with a nil error renders the section as null.
+type fullSection func(ctx context.Context, srv *Server, a Album) (any, error)
+
+// fullSections are the sections fanned out to by GET /albums/:id/full, keyed by response name.
+// Sub-resources and enrichment providers register their section here.
+var fullSections = map[string]fullSection{
+	"spotify": spotifySection,
+	"tracks":  tracksSection,
+	"reviews": reviewsSection,
+}
+
+// errReviewsUnavailable is returned by the reviews section, as there is no reviews service yet.
+var errReviewsUnavailable = errors.New("reviews are unavailable: no reviews service is configured")
+
+// fullSectionTimeout bounds how long a single section may take before it is reported as failed.
+var fullSectionTimeout = 2 * time.Second
+
+// sectionWarning reports a part of a fan-out response that could not be produced: its name and
+// why. The rest of the response is still returned.
+type sectionWarning struct {
+	Section string `json:"section"`
+	Error   string `json:"error"`
+}
+
+// errSectionPanicked is wrapped by the error isolate returns for a function that panicked.
+var errSectionPanicked = errors.New("section panicked")
+
+// isolate calls fn and returns its error, turning a panic into an error wrapping
+// errSectionPanicked, so one failing part of a fan-out response cannot fail the others or, in a
+// goroutine, crash the server. The panic and its stack are logged.
+func isolate(name string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("section %s panicked: %v\n%s", name, r, debug.Stack())
+			err = fmt.Errorf("%w: %v", errSectionPanicked, r)
+		}
+	}()
+	return fn()
+}
+
+// getAlbumFull handles GET /albums/:id/full requests.
+// Loads every registered section concurrently and composes them with the album into a single
+// response with HTTP 200 status. A section that fails, panics, or is too slow is rendered as null
+// and reported under "warnings" (and, by name, under "errors") instead of failing the request.
+// Returns HTTP 404 if the album is not found.
+func (srv *Server) getAlbumFull(c *gin.Context) {
+	album, err := srv.store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		sections = make(map[string]any, len(fullSections))
+		errs     = make(map[string]string)
+	)
+	for name, load := range fullSections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := withDeadline(c.Request.Context(), time.Now().Add(fullSectionTimeout))
+			defer cancel()
+
+			result, err := srv.loadSection(ctx, name, load, album)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				sections[name] = nil
+				errs[name] = err.Error()
+				return
+			}
+			sections[name] = result
+		}()
+	}
+	wg.Wait()
+
+	response := gin.H{"album": transformAlbum(c, album), "sections": sections}
+	if len(errs) > 0 {
+		warnings := make([]sectionWarning, 0, len(errs))
+		for _, name := range slices.Sorted(maps.Keys(errs)) {
+			warnings = append(warnings, sectionWarning{Section: name, Error: errs[name]})
+		}
+		response["errors"] = errs
+		response["warnings"] = warnings
+	}
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+// loadSection runs load, the section with the given name, giving up when ctx expires even if the
+// section ignores its context. A panic in load is returned as an error (see isolate).
+func (srv *Server) loadSection(ctx context.Context, name string, load fullSection, a Album) (any, error) {
+	type result struct {
+		value any
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var value any
+		err := isolate(name, func() (err error) {
+			value, err = load(ctx, srv, a)
+			return err
+		})
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// tracksSection returns the album's tracks, ordered by number, as GET /albums/:id/tracks does.
+func tracksSection(ctx context.Context, srv *Server, a Album) (any, error) {
+	if a.Tracks == nil {
+		return []Track{}, nil
+	}
+	return a.Tracks, nil
+}
+
+// reviewsSection stands in for the album's reviews until there is a reviews service to fetch them
+// from, reporting them as unavailable so clients can tell them from an album without reviews.
+func reviewsSection(ctx context.Context, srv *Server, a Album) (any, error) {
+	return nil, errReviewsUnavailable
+}
+
+// spotifySection returns the album's Spotify link, searching Spotify if the album is not linked yet.
+// Returns null if the album has no Spotify match or the integration is not configured.
+func spotifySection(ctx context.Context, srv *Server, a Album) (any, error) {
+	if a.SpotifyID != "" {
+		return gin.H{"id": a.SpotifyID, "url": a.SpotifyURL}, nil
+	}
+	if srv.spotify == nil {
+		return nil, nil
+	}
+	match, err := srv.spotify.searchAlbum(ctx, a.Title, a.Artist)
+	if errors.Is(err, errSpotifyNoMatch) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"id": match.ID, "url": match.URL}, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestGetAlbumFull tests the GET /albums/:id/full endpoint.
+// Verifies that sections, the album's tracks among them, are composed with the album (HTTP 200),
+// that a failing or slow section, and the reviews section, are reported under "errors" without
+// failing the request, and that a non-existent ID returns HTTP 404.
+func TestGetAlbumFull(t *testing.T) {
+	srv := newTestServer(t)
+	useMockSpotify(t, srv)
+
+	fullSections["broken"] = func(context.Context, *Server, Album) (any, error) {
+		return nil, errors.New("backend unavailable")
+	}
+	fullSections["slow"] = func(context.Context, *Server, Album) (any, error) {
+		time.Sleep(time.Second)
+		return "late", nil
+	}
+	fullSectionTimeout = 50 * time.Millisecond
+	t.Cleanup(func() {
+		delete(fullSections, "broken")
+		delete(fullSections, "slow")
+		fullSectionTimeout = 2 * time.Second
+	})
+
+	w := srv.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440001/full", "")
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var body struct {
+		Album    Album                      `json:"album"`
+		Sections map[string]json.RawMessage `json:"sections"`
+		Errors   map[string]string          `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Album.Title != "Blue Train" {
+		t.Errorf("Expected 'Blue Train', got '%s'", body.Album.Title)
+	}
+	if string(body.Sections["spotify"]) == "null" {
+		t.Error("Spotify section should be populated")
+	}
+	if string(body.Sections["tracks"]) != "[]" {
+		t.Errorf("Expected the album's tracks, got %s", body.Sections["tracks"])
+	}
+	if body.Errors["broken"] == "" || body.Errors["slow"] == "" || body.Errors["reviews"] != errReviewsUnavailable.Error() {
+		t.Errorf("Expected errors for broken, slow, and reviews sections, got %v", body.Errors)
+	}
+
+	w = srv.do("GET", "/albums/not-found/full", "")
+	if w.Code != 404 {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
+
+// TestGetAlbumFullPanickingSection tests that a section that panics is reported under "warnings"
+// while the other sections are still returned.
+func TestGetAlbumFullPanickingSection(t *testing.T) {
+	srv := newTestServer(t)
+	useMockSpotify(t, srv)
+	fullSections["panicky"] = func(context.Context, *Server, Album) (any, error) {
+		panic("nil map")
+	}
+	t.Cleanup(func() { delete(fullSections, "panicky") })
+
+	w := srv.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440001/full", "")
+
+	var body struct {
+		Sections map[string]json.RawMessage `json:"sections"`
+		Warnings []sectionWarning           `json:"warnings"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != 200 || string(body.Sections["spotify"]) == "null" {
+		t.Fatalf("Expected the other sections to be returned, got %d: %s", w.Code, w.Body)
+	}
+	// Warnings are ordered by section, so the reviews section's comes second.
+	if len(body.Warnings) != 2 || body.Warnings[0].Section != "panicky" || body.Warnings[0].Error != "section panicked: nil map" {
+		t.Errorf("Expected a warning for the panicking section, got %+v", body.Warnings)
+	}
+}
+
+// panickyStore is a memory store whose Get panics for one album ID.
+type panickyStore struct {
+	*memoryStore
+	id string
+}
+
+// Get panics for s.id and otherwise gets the album from the memory store.
+func (s panickyStore) Get(ctx context.Context, id string) (Album, error) {
+	if id == s.id {
+		panic("corrupt record")
+	}
+	return s.memoryStore.Get(ctx, id)
+}
+
+// TestCompareAlbumsPartial tests GET /albums/compare when one album cannot be loaded.
+// Verifies that the other album is returned with a warning for the failed side, and that the
+// request fails when neither album can be loaded.
+func TestCompareAlbumsPartial(t *testing.T) {
+	store := panickyStore{memoryStore: newMemoryStore(seedAlbums()), id: "550e8400-e29b-41d4-a716-446655440002"}
+	srv := newTestServerWith(t, store)
+
+	w := srv.do("GET", "/albums/compare?ids="+"550e8400-e29b-41d4-a716-446655440001,550e8400-e29b-41d4-a716-446655440002", "")
+	var body struct {
+		Left        map[string]any   `json:"left"`
+		Right       map[string]any   `json:"right"`
+		Differences []fieldDiff      `json:"differences"`
+		Warnings    []sectionWarning `json:"warnings"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != 200 || body.Left["title"] != "Blue Train" || body.Right != nil || body.Differences != nil {
+		t.Errorf("Expected only the left album, got %d: %s", w.Code, w.Body)
+	}
+	if len(body.Warnings) != 1 || body.Warnings[0].Section != "right" {
+		t.Errorf("Expected a warning for the right album, got %+v", body.Warnings)
+	}
+
+	if w := srv.do("GET", "/albums/compare?ids="+"550e8400-e29b-41d4-a716-446655440002,550e8400-e29b-41d4-a716-446655440002", ""); w.Code != 500 {
+		t.Errorf("Expected 500 when neither album loads, got %d", w.Code)
+	}
+	if w := srv.do("GET", "/albums/compare?ids="+"550e8400-e29b-41d4-a716-446655440002,missing", ""); w.Code != 404 {
+		t.Errorf("Expected 404 when an album does not exist, got %d", w.Code)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache write policies, selected by CACHE_WRITE_POLICY.
+const (
+	// writeThrough writes every change to the store, then caches the result.
+	writeThrough = "write-through"
+	// writeBack caches updates and writes them to the store in the background (see cachedStore.flush).
+	writeBack = "write-back"
+	// writeAround writes every change to the store and drops the cached album, so it is cached
+	// again by the next read.
+	writeAround = "write-around"
+)
+
+// cachedStore is an AlbumStore that keeps the albums read or written by ID in memory, per tenant,
+// and answers Get from them. How writes reach the cache and the store is set by policy, so the
+// consistency and latency of the policies can be compared under load:
+//
+//   - write-through and write-around write to the store before returning, and cache the result or
+//     drop the album from the cache respectively.
+//   - write-back applies updates to the cached album and returns; they reach the store when the
+//     cache is flushed, every CACHE_FLUSH_INTERVAL and on shutdown, so updates made since the last
+//     flush are lost if the server crashes, and several updates to an album are written once.
+//     Creates, deletes, and updates that change the UPC are written through, so the store still
+//     checks them for conflicts, and reads the cache cannot answer, such as listings, flush first so
+//     they never see older albums than Get.
+//
+// Albums changed by other servers sharing the store are not noticed until they are written
+// through this server.
+type cachedStore struct {
+	AlbumStore
+	policy string
+
+	// flushMu serializes writing cached updates to the store, so an older copy of an album is never
+	// written after a newer one.
+	flushMu sync.Mutex
+
+	mu sync.Mutex
+	// albums holds the cached albums, keyed by tenant and ID (see albumKey).
+	albums map[string]*cacheEntry
+
+	hits, misses, flushed, flushErrors atomic.Int64
+}
+
+// cacheEntry is a cached album, the tenant it belongs to, and, under write-back, whether it has
+// updates not yet written to the store. version counts its updates, so a flush can tell whether
+// the album changed while it was being written.
+type cacheEntry struct {
+	tenant  string
+	album   Album
+	dirty   bool
+	version int
+}
+
+// cacheStats is the album cache section of GET /metrics/summary.
+type cacheStats struct {
+	Policy      string `json:"policy"`
+	Albums      int    `json:"albums"`
+	Dirty       int    `json:"dirty"`
+	Hits        int64  `json:"hits"`
+	Misses      int64  `json:"misses"`
+	Flushed     int64  `json:"flushed"`
+	FlushErrors int64  `json:"flush_errors"`
+}
+
+// newCachedStore wraps s with the album cache configured by cfg.
+// Returns nil if CACHE_WRITE_POLICY is not set, which disables the cache, or an error if it is not
+// one of the write policies.
+func newCachedStore(s AlbumStore, cfg Config) (*cachedStore, error) {
+	switch cfg.CacheWritePolicy {
+	case "":
+		return nil, nil
+	case writeThrough, writeBack, writeAround:
+		return &cachedStore{AlbumStore: s, policy: cfg.CacheWritePolicy, albums: map[string]*cacheEntry{}}, nil
+	default:
+		return nil, fmt.Errorf("%q is not %s, %s, or %s", cfg.CacheWritePolicy, writeThrough, writeBack, writeAround)
+	}
+}
+
+// cached returns the cached copy of the album with the given ID.
+func (s *cachedStore) cached(ctx context.Context, id string) (Album, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.albums[albumKey(ctx, id)]
+	if !ok {
+		return Album{}, false
+	}
+	return entry.album, true
+}
+
+// remember caches a as it is in the store. An album with updates not yet flushed is left as is,
+// since a is older than them.
+func (s *cachedStore) remember(ctx context.Context, a Album) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := albumKey(ctx, a.ID)
+	if entry, ok := s.albums[key]; ok && entry.dirty {
+		return
+	}
+	s.albums[key] = &cacheEntry{tenant: tenantFrom(ctx), album: a}
+}
+
+// forget drops the cached album with the given ID, along with any updates not yet flushed.
+func (s *cachedStore) forget(ctx context.Context, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.albums, albumKey(ctx, id))
+}
+
+// written records a as written through to the store: it is cached, replacing any unflushed
+// updates, or, under write-around, dropped from the cache.
+func (s *cachedStore) written(ctx context.Context, a Album) {
+	if s.policy == writeAround {
+		s.forget(ctx, a.ID)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.albums[albumKey(ctx, a.ID)] = &cacheEntry{tenant: tenantFrom(ctx), album: a}
+}
+
+// flush writes every cached update to the store. An album deleted from the store in the meantime
+// is dropped from the cache; an album that fails to be written stays cached and is retried at the
+// next flush. Returns the errors of the albums that failed.
+func (s *cachedStore) flush(ctx context.Context) error {
+	if s.policy != writeBack {
+		return nil
+	}
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	type pending struct {
+		key     string
+		tenant  string
+		album   Album
+		version int
+	}
+	var dirty []pending
+	s.mu.Lock()
+	for key, entry := range s.albums {
+		if entry.dirty {
+			dirty = append(dirty, pending{key, entry.tenant, entry.album, entry.version})
+		}
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, p := range dirty {
+		_, err := s.AlbumStore.Update(withTenant(ctx, p.tenant), p.album.ID, func(a *Album) error {
+			*a = p.album
+			return nil
+		})
+		if err != nil && !errors.Is(err, errAlbumNotFound) {
+			s.flushErrors.Add(1)
+			errs = append(errs, fmt.Errorf("album %s: %w", p.album.ID, err))
+			continue
+		}
+		s.flushed.Add(1)
+		s.mu.Lock()
+		if entry, ok := s.albums[p.key]; ok && entry.version == p.version {
+			if err != nil {
+				delete(s.albums, p.key)
+			} else {
+				entry.dirty = false
+			}
+		}
+		s.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// runCacheFlush flushes s every interval until ctx is done. Failures are logged and retried at the
+// next interval.
+func runCacheFlush(ctx context.Context, s *cachedStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.flush(ctx); err != nil {
+			log.Printf("cache flush: %v", err)
+		}
+	}
+}
+
+// stats returns the cache's counters and how many albums it holds.
+func (s *cachedStore) stats() cacheStats {
+	st := cacheStats{
+		Policy:      s.policy,
+		Hits:        s.hits.Load(),
+		Misses:      s.misses.Load(),
+		Flushed:     s.flushed.Load(),
+		FlushErrors: s.flushErrors.Load(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.Albums = len(s.albums)
+	for _, entry := range s.albums {
+		if entry.dirty {
+			st.Dirty++
+		}
+	}
+	return st
+}
+
+// Get returns the album with the given ID from the cache, or reads it from the store and caches it.
+func (s *cachedStore) Get(ctx context.Context, id string) (Album, error) {
+	if a, ok := s.cached(ctx, id); ok {
+		s.hits.Add(1)
+		return a, nil
+	}
+	s.misses.Add(1)
+	a, err := s.AlbumStore.Get(ctx, id)
+	if err == nil {
+		s.remember(ctx, a)
+	}
+	return a, err
+}
+
+// List flushes cached updates and returns every album from the store.
+func (s *cachedStore) List(ctx context.Context) ([]Album, error) {
+	if err := s.flush(ctx); err != nil {
+		return nil, err
+	}
+	return s.AlbumStore.List(ctx)
+}
+
+// Query flushes cached updates and returns the albums selected by f, filtering in the store if it
+// supports that.
+func (s *cachedStore) Query(ctx context.Context, f albumFilter) ([]Album, error) {
+	if err := s.flush(ctx); err != nil {
+		return nil, err
+	}
+	return listAlbums(ctx, s.AlbumStore, f)
+}
+
+// Each flushes cached updates and calls fn with every album, streaming them from the store if it
+// supports that.
+func (s *cachedStore) Each(ctx context.Context, fn func(Album) error) error {
+	if err := s.flush(ctx); err != nil {
+		return err
+	}
+	return eachAlbum(ctx, s.AlbumStore, fn)
+}
+
+// GetByUPC flushes cached updates and returns the album with the given barcode, using the store's
+// index if it has one.
+func (s *cachedStore) GetByUPC(ctx context.Context, code string) (Album, error) {
+	if err := s.flush(ctx); err != nil {
+		return Album{}, err
+	}
+	return findAlbumByUPC(ctx, s.AlbumStore, code)
+}
+
+// Stats flushes cached updates and returns the statistics of every album, computed by the store if
+// it supports that.
+func (s *cachedStore) Stats(ctx context.Context) (albumStats, error) {
+	if err := s.flush(ctx); err != nil {
+		return albumStats{}, err
+	}
+	return catalogStats(ctx, s.AlbumStore)
+}
+
+// Create stores a new album and, unless the policy is write-around, caches it.
+func (s *cachedStore) Create(ctx context.Context, a Album) (Album, error) {
+	created, err := s.AlbumStore.Create(ctx, a)
+	if err == nil {
+		s.written(ctx, created)
+	}
+	return created, err
+}
+
+// CreateUnique creates an album unless one with the same title and artist exists, atomically if
+// the store supports that, and, unless the policy is write-around, caches it.
+func (s *cachedStore) CreateUnique(ctx context.Context, a Album) (Album, error) {
+	if err := s.flush(ctx); err != nil {
+		return Album{}, err
+	}
+	created, err := createUnique(ctx, s.AlbumStore, a)
+	if err == nil {
+		s.written(ctx, created)
+	}
+	return created, err
+}
+
+// Update applies mutate to the album with the given ID. Under write-back, the change is made to the
+// cached album and written to the store at the next flush, unless it changes the UPC.
+func (s *cachedStore) Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, false)
+}
+
+// UpdateUnique updates the album like Update unless it would get the title and artist of another
+// album, atomically if the store supports that. Under write-back, a change to the title or artist
+// is written through, so that the store checks it.
+func (s *cachedStore) UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, true)
+}
+
+// update applies mutate to the album with the given ID, through updateUnique if unique is set.
+func (s *cachedStore) update(ctx context.Context, id string, mutate func(*Album) error, unique bool) (Album, error) {
+	write := s.AlbumStore.Update
+	if unique {
+		write = func(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+			return updateUnique(ctx, s.AlbumStore, id, mutate)
+		}
+	}
+	if s.policy != writeBack {
+		updated, err := write(ctx, id, mutate)
+		if err == nil {
+			s.written(ctx, updated)
+		} else if errors.Is(err, errAlbumNotFound) {
+			s.forget(ctx, id)
+		}
+		return updated, err
+	}
+
+	if _, err := s.Get(ctx, id); err != nil {
+		return Album{}, err
+	}
+	s.mu.Lock()
+	entry, ok := s.albums[albumKey(ctx, id)]
+	if !ok {
+		// Deleted since it was read.
+		s.mu.Unlock()
+		return Album{}, errAlbumNotFound
+	}
+	updated := entry.album
+	if err := mutate(&updated); err != nil {
+		s.mu.Unlock()
+		return Album{}, err
+	}
+	if normalizeUPC(updated.UPC) == normalizeUPC(entry.album.UPC) &&
+		(!unique || albumNameKey(updated.Title, updated.Artist) == albumNameKey(entry.album.Title, entry.album.Artist)) {
+		entry.album, entry.dirty = updated, true
+		entry.version++
+		s.mu.Unlock()
+		return updated, nil
+	}
+	s.mu.Unlock()
+
+	// The store checks the new UPC, or title and artist, for conflicts, so the album is written
+	// through, replacing any updates not yet flushed.
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	written, err := write(ctx, id, func(a *Album) error {
+		*a = updated
+		return nil
+	})
+	if err == nil {
+		s.written(ctx, written)
+	}
+	return written, err
+}
+
+// Delete removes the album with the given ID, dropping it and any unflushed updates from the cache.
+func (s *cachedStore) Delete(ctx context.Context, id string) (Album, error) {
+	a, err := s.AlbumStore.Delete(ctx, id)
+	if err == nil || errors.Is(err, errAlbumNotFound) {
+		s.forget(ctx, id)
+	}
+	return a, err
+}
+
+// UpdateWhere flushes cached updates and changes the albums selected by f, atomically if the store
+// supports that, caching the results unless the policy is write-around.
+func (s *cachedStore) UpdateWhere(ctx context.Context, f albumFilter, mutate func(*Album) bool) ([]Album, error) {
+	if err := s.flush(ctx); err != nil {
+		return nil, err
+	}
+	changed, err := updateWhere(ctx, s.AlbumStore, f, mutate)
+	for _, a := range changed {
+		s.written(ctx, a)
+	}
+	return changed, err
+}
+
+// DeleteWhere flushes cached updates and removes the albums selected by f, atomically if the store
+// supports that, dropping them from the cache.
+func (s *cachedStore) DeleteWhere(ctx context.Context, f albumFilter) ([]Album, error) {
+	if err := s.flush(ctx); err != nil {
+		return nil, err
+	}
+	deleted, err := deleteWhere(ctx, s.AlbumStore, f)
+	for _, a := range deleted {
+		s.forget(ctx, a.ID)
+	}
+	return deleted, err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+)
+
+// countingStore is a memory store that counts the reads and updates that reach it.
+type countingStore struct {
+	*memoryStore
+	gets, updates atomic.Int64
+}
+
+func (s *countingStore) Get(ctx context.Context, id string) (Album, error) {
+	s.gets.Add(1)
+	return s.memoryStore.Get(ctx, id)
+}
+
+func (s *countingStore) Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	s.updates.Add(1)
+	return s.memoryStore.Update(ctx, id, mutate)
+}
+
+// TestCachedStore tests the AlbumStore contract under each cache write policy.
+func TestCachedStore(t *testing.T) {
+	for _, policy := range []string{writeThrough, writeBack, writeAround} {
+		t.Run(policy, func(t *testing.T) {
+			s, err := newCachedStore(newMemoryStore(nil), Config{CacheWritePolicy: policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			testAlbumStore(t, s)
+		})
+	}
+	if _, err := newCachedStore(newMemoryStore(nil), Config{CacheWritePolicy: "write-sideways"}); err == nil {
+		t.Error("Expected an error for an unknown write policy")
+	}
+}
+
+// TestCacheWritePolicies tests when reads and updates reach the store under each write policy.
+// Verifies that cached albums are read once, that write-through and write-around write every update
+// and write-around drops the album from the cache, and that write-back writes repeated updates once,
+// when flushed or before a listing.
+func TestCacheWritePolicies(t *testing.T) {
+	ctx := context.Background()
+	const id = "550e8400-e29b-41d4-a716-446655440002"
+	for _, tc := range []struct {
+		policy                 string
+		updates, getsAfterward int64
+	}{
+		{writeThrough, 3, 1},
+		{writeBack, 0, 1},
+		{writeAround, 3, 2},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			backend := &countingStore{memoryStore: newMemoryStore(seedAlbums())}
+			s, _ := newCachedStore(backend, Config{CacheWritePolicy: tc.policy})
+			s.Get(ctx, id)
+			s.Get(ctx, id)
+			if n := backend.gets.Load(); n != 1 {
+				t.Errorf("Expected 1 read from the store, got %d", n)
+			}
+			for _, price := range []float64{1, 2, 3} {
+				if _, err := s.Update(ctx, id, func(a *Album) error { a.Price = price; return nil }); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := backend.updates.Load(); n != tc.updates {
+				t.Errorf("Expected %d updates written to the store, got %d", tc.updates, n)
+			}
+			if a, _ := s.Get(ctx, id); a.Price != 3 {
+				t.Errorf("Expected the updated price from the cache, got %v", a.Price)
+			}
+			if n := backend.gets.Load(); n != tc.getsAfterward {
+				t.Errorf("Expected %d reads from the store, got %d", tc.getsAfterward, n)
+			}
+			if tc.policy != writeBack {
+				return
+			}
+
+			if a, _ := backend.Get(ctx, id); a.Price != 17.99 {
+				t.Errorf("Expected the store to be unchanged before a flush, got price %v", a.Price)
+			}
+			if st := s.stats(); st.Dirty != 1 {
+				t.Errorf("Expected 1 dirty album, got %+v", st)
+			}
+			all, _ := s.List(ctx)
+			if backend.updates.Load() != 1 || all[1].Price != 3 {
+				t.Errorf("Expected the listing to flush the updates in one write, got %d writes and %+v", backend.updates.Load(), all[1])
+			}
+			if err := s.flush(ctx); err != nil || backend.updates.Load() != 1 {
+				t.Errorf("Expected nothing left to flush, got %d writes, %v", backend.updates.Load(), err)
+			}
+
+			s.Update(ctx, id, func(a *Album) error { a.Price = 4; return nil })
+			s.Delete(ctx, id)
+			if err := s.flush(ctx); err != nil || s.stats().Albums != 0 {
+				t.Errorf("Expected a deleted album's updates to be dropped, got %+v, %v", s.stats(), err)
+			}
+		})
+	}
+}
+
+// TestAlbumCacheMetrics tests the cache's counters in /metrics/summary and rejecting an unknown
+// CACHE_WRITE_POLICY.
+func TestAlbumCacheMetrics(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.CacheWritePolicy = writeBack })
+	const album = "/albums/550e8400-e29b-41d4-a716-446655440001"
+	srv.do("GET", album, "")
+	srv.do("PATCH", album, `{"price": 9.99}`, "If-Match", "*")
+	srv.do("GET", album, "")
+
+	var summary struct {
+		AlbumCache cacheStats `json:"album_cache"`
+	}
+	json.Unmarshal(srv.do("GET", "/metrics/summary", "").Body.Bytes(), &summary)
+	if st := summary.AlbumCache; st.Policy != writeBack || st.Dirty != 1 || st.Hits == 0 || st.Misses == 0 {
+		t.Errorf("Expected an unflushed update and cache hits and misses, got %+v", st)
+	}
+
+	if _, err := newServer(newMemoryStore(nil), Config{CacheWritePolicy: "lazy"}); err == nil {
+		t.Error("Expected an error for an unknown CACHE_WRITE_POLICY")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	runtimemetrics "runtime/metrics"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// allocSampler attributes heap allocations to routes by reading the runtime's cumulative
+// allocation counters before and after every Nth request. The counters are process-wide and
+// updated a span at a time, so individual samples are noisy; averaged over many samples they show
+// which routes allocate the most. Sampled requests are serialized so they don't count each other's
+// allocations, which also makes the numbers most trustworthy under light concurrent load.
+type allocSampler struct {
+	every uint64
+	seen  atomic.Uint64
+
+	mu     sync.Mutex // held for the duration of a sampled request
+	routes sync.Map   // "METHOD /path" -> *routeAllocs
+}
+
+// routeAllocs accumulates allocation samples for one route.
+type routeAllocs struct {
+	samples atomic.Int64
+	bytes   atomic.Uint64
+	objects atomic.Uint64
+}
+
+// routeAllocSummary is one row of the /debug/allocs report.
+type routeAllocSummary struct {
+	Method            string  `json:"method"`
+	Path              string  `json:"path"`
+	Samples           int64   `json:"samples"`
+	BytesPerRequest   float64 `json:"bytes_per_request"`
+	ObjectsPerRequest float64 `json:"objects_per_request"`
+}
+
+// newAllocSampler creates a sampler that measures one in every requests.
+// Returns nil if every is not positive.
+func newAllocSampler(every int) *allocSampler {
+	if every <= 0 {
+		return nil
+	}
+	return &allocSampler{every: uint64(every)}
+}
+
+// readAllocs returns the cumulative bytes and objects allocated on the heap.
+func readAllocs() (bytes, objects uint64) {
+	samples := []runtimemetrics.Sample{
+		{Name: "/gc/heap/allocs:bytes"},
+		{Name: "/gc/heap/allocs:objects"},
+	}
+	runtimemetrics.Read(samples)
+	return samples[0].Value.Uint64(), samples[1].Value.Uint64()
+}
+
+// allocMiddleware records the allocations made while handling sampled requests.
+func allocMiddleware(s *allocSampler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.seen.Add(1)%s.every != 0 {
+			c.Next()
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		bytesBefore, objectsBefore := readAllocs()
+		c.Next()
+		bytesAfter, objectsAfter := readAllocs()
+
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		value, _ := s.routes.LoadOrStore(c.Request.Method+" "+path, &routeAllocs{})
+		route := value.(*routeAllocs)
+		route.samples.Add(1)
+		route.bytes.Add(bytesAfter - bytesBefore)
+		route.objects.Add(objectsAfter - objectsBefore)
+	}
+}
+
+// top returns up to limit routes ordered by bytes allocated per request, highest first.
+func (s *allocSampler) top(limit int) []routeAllocSummary {
+	rows := []routeAllocSummary{}
+	s.routes.Range(func(key, value any) bool {
+		method, path, _ := strings.Cut(key.(string), " ")
+		route := value.(*routeAllocs)
+		samples := route.samples.Load()
+		rows = append(rows, routeAllocSummary{
+			Method:            method,
+			Path:              path,
+			Samples:           samples,
+			BytesPerRequest:   float64(route.bytes.Load()) / float64(samples),
+			ObjectsPerRequest: float64(route.objects.Load()) / float64(samples),
+		})
+		return true
+	})
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].BytesPerRequest > rows[j].BytesPerRequest
+	})
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// getAllocs handles GET /debug/allocs requests.
+// Returns the top allocating routes (default 10, set with ?limit=) as JSON with HTTP 200 status.
+// Returns 404 Not Found if allocation sampling is disabled, or 400 Bad Request for an invalid limit.
+func (srv *Server) getAllocs(c *gin.Context) {
+	if srv.allocs == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Allocation sampling is disabled; set ALLOC_SAMPLE_EVERY to enable it"})
+		return
+	}
+
+	limit := 10
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = n
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"sample_every": srv.allocs.every,
+		"routes":       srv.allocs.top(limit),
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAllocSampling tests the allocation sampler and the GET /debug/allocs endpoint.
+// Verifies that only every Nth request is sampled and that routes are ranked by bytes allocated per request.
+func TestAllocSampling(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.AllocSampleEvery = 2 })
+	srv.router.GET("/small", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	srv.router.GET("/large", func(c *gin.Context) {
+		buf := make([]byte, 1<<20)
+		c.String(http.StatusOK, "%d", len(buf))
+	})
+
+	for i := 0; i < 10; i++ {
+		for _, path := range []string{"/small", "/large"} {
+			srv.do("GET", path, "")
+		}
+	}
+
+	w := srv.do("GET", "/debug/allocs", "")
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var body struct {
+		Routes []routeAllocSummary `json:"routes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	var samples int64
+	for _, r := range body.Routes {
+		samples += r.Samples
+	}
+	if samples != 10 {
+		t.Errorf("Expected 10 sampled requests, got %d", samples)
+	}
+	if len(body.Routes) == 0 || body.Routes[0].Path != "/large" {
+		t.Fatalf("Expected /large to be the top allocating route, got %+v", body.Routes)
+	}
+	if body.Routes[0].BytesPerRequest < 1<<20 {
+		t.Errorf("Expected at least 1 MiB per request for /large, got %.0f", body.Routes[0].BytesPerRequest)
+	}
+}
+
+// TestAllocSamplingDisabled tests GET /debug/allocs when sampling is not enabled.
+// Verifies that the endpoint returns 404.
+func TestAllocSamplingDisabled(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.AllocSampleEvery = 0 })
+
+	w := srv.do("GET", "/debug/allocs", "")
+	if w.Code != 404 {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// albumStates are the values of the state parameter accepted by album listings, each selecting
+// the albums it matches. Listings default to "active".
+var albumStates = map[string]func(a Album) bool{
+	"active":   func(a Album) bool { return a.ArchivedAt.IsZero() },
+	"archived": func(a Album) bool { return !a.ArchivedAt.IsZero() },
+	"all":      func(Album) bool { return true },
+}
+
+// parseState returns the filter selected by the state query parameter.
+// Returns an error message if the state is not one of albumStates.
+func parseState(c *gin.Context) (func(Album) bool, string) {
+	match, ok := albumStates[c.DefaultQuery("state", "active")]
+	if !ok {
+		return nil, "state must be active, archived, or all"
+	}
+	return match, ""
+}
+
+// filterAlbums returns the albums in all for which match returns true.
+func filterAlbums(all []Album, match func(Album) bool) []Album {
+	out := all[:0:0]
+	for _, a := range all {
+		if match(a) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// archiveAlbum handles POST /albums/:id/archive requests.
+// Archives the album, hiding it from default listings while keeping it retrievable by ID and
+// with ?state=archived. Archiving an archived album keeps its original archived_at time.
+// Returns the album as JSON with HTTP 200 status, or HTTP 404 if the album is not found.
+func (srv *Server) archiveAlbum(c *gin.Context) {
+	srv.setArchived(c, true)
+}
+
+// unarchiveAlbum handles POST /albums/:id/unarchive requests.
+// Returns the album to default listings. Returns the album as JSON with HTTP 200 status,
+// or HTTP 404 if the album is not found.
+func (srv *Server) unarchiveAlbum(c *gin.Context) {
+	srv.setArchived(c, false)
+}
+
+// setArchived archives or unarchives the album named in the request and writes the response.
+func (srv *Server) setArchived(c *gin.Context, archived bool) {
+	var previous Album
+	updated, err := srv.updateAlbum(c.Request.Context(), c.Param("id"), func(a *Album) error {
+		previous = *a
+		switch {
+		case archived && a.ArchivedAt.IsZero():
+			a.ArchivedAt = time.Now().UTC()
+		case !archived:
+			a.ArchivedAt = time.Time{}
+		}
+		return nil
+	})
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	srv.publishAlbumEvent(c.Request.Context(), eventAlbumUpdated, updated, &previous)
+	renderAlbum(c, http.StatusOK, updated)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// TestArchiveWorkflow tests archiving and unarchiving an album.
+// Verifies that archived albums leave the default listing but stay retrievable by ID and with
+// ?state=archived, and that unarchiving restores them.
+func TestArchiveWorkflow(t *testing.T) {
+	srv := newTestServer(t)
+	const id = "550e8400-e29b-41d4-a716-446655440002"
+
+	count := func(path string) int {
+		var list []Album
+		json.Unmarshal(srv.do("GET", path, "").Body.Bytes(), &list)
+		return len(list)
+	}
+
+	w := srv.do("POST", "/albums/"+id+"/archive", "")
+	var archived Album
+	json.Unmarshal(w.Body.Bytes(), &archived)
+	if w.Code != 200 || archived.ArchivedAt.IsZero() {
+		t.Fatalf("Expected 200 with archived_at set, got %d: %s", w.Code, w.Body)
+	}
+	if n := count("/albums"); n != 2 {
+		t.Errorf("Expected 2 active albums, got %d", n)
+	}
+	if n := count("/albums?state=archived"); n != 1 {
+		t.Errorf("Expected 1 archived album, got %d", n)
+	}
+	if n := count("/albums?state=all"); n != 3 {
+		t.Errorf("Expected 3 albums in all states, got %d", n)
+	}
+	if w := srv.do("GET", "/albums/"+id, ""); w.Code != 200 {
+		t.Errorf("Expected archived album to be retrievable by ID, got %d", w.Code)
+	}
+
+	// Archiving again keeps the original time.
+	var again Album
+	json.Unmarshal(srv.do("POST", "/albums/"+id+"/archive", "").Body.Bytes(), &again)
+	if !again.ArchivedAt.Equal(archived.ArchivedAt) {
+		t.Errorf("Expected archived_at %v to be kept, got %v", archived.ArchivedAt, again.ArchivedAt)
+	}
+
+	if w := srv.do("POST", "/albums/"+id+"/unarchive", ""); w.Code != 200 {
+		t.Errorf("Expected 200, got %d", w.Code)
+	}
+	if n := count("/albums"); n != 3 {
+		t.Errorf("Expected 3 active albums after unarchiving, got %d", n)
+	}
+}
+
+// TestArchiveInvalidRequests tests error responses for archiving and state filters.
+// Verifies HTTP 404 for unknown albums and HTTP 400 for an unknown state.
+func TestArchiveInvalidRequests(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := srv.do("POST", "/albums/missing/archive", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+
+	w = srv.do("GET", "/albums?state=deleted", "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
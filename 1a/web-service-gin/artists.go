@@ -0,0 +1,572 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var (
+	// errArtistNotFound is returned when no artist has the requested ID.
+	errArtistNotFound = errors.New("artist not found")
+	// errArtistHasAlbums is returned when deleting an artist that albums still reference.
+	errArtistHasAlbums = errors.New("artist has albums")
+	// errArtistsUnsupported is returned when the backend store cannot store artists.
+	errArtistsUnsupported = errors.New("the storage backend does not store artists")
+)
+
+// artistExistsError is returned when creating or renaming an artist to the name of another
+// artist, which is ID.
+type artistExistsError struct{ ID string }
+
+func (e artistExistsError) Error() string { return "an artist with this name already exists: " + e.ID }
+
+// artistNamespace is the UUID namespace artist IDs are derived from (see artistIDFor).
+var artistNamespace = uuid.MustParse("9b1d3c5e-7a2f-4e8b-b6d4-1f0e2c3a4b5d")
+
+// Artist is an artist albums are credited to. Albums reference it by ArtistID and carry its name
+// as Artist; renaming the artist renames it on its albums.
+type Artist struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
+
+// artistStore is implemented by backend stores that keep artists next to their albums, so
+// artists outlive restarts and are shared by every server using the backend. Renaming and
+// deleting an artist are atomic with the albums they change or check.
+type artistStore interface {
+	// ListArtists returns every artist, in no particular order.
+	ListArtists(ctx context.Context) ([]Artist, error)
+	// GetArtist returns the artist with the given ID, or errArtistNotFound.
+	GetArtist(ctx context.Context, id string) (Artist, error)
+	// ArtistNamed returns the artist with the given name, ignoring case (see artistKey), or
+	// errArtistNotFound.
+	ArtistNamed(ctx context.Context, name string) (Artist, error)
+	// CreateArtist stores a new artist. Returns an artistExistsError if an artist has its name,
+	// or its ID.
+	CreateArtist(ctx context.Context, artist Artist) error
+	// RenameArtist renames the artist with the given ID to name and applies rename to every album
+	// credited to it (see albumArtistID), deleted ones included, in one transaction. Returns the
+	// renamed artist and the albums it changed. Returns errArtistNotFound or, if another artist
+	// has the name, an artistExistsError.
+	RenameArtist(ctx context.Context, id, name string, rename func(*Album)) (Artist, []albumChange, error)
+	// DeleteArtist removes the artist with the given ID, in one transaction with checking that no
+	// album, deleted ones included, is credited to it. Returns errArtistNotFound or
+	// errArtistHasAlbums.
+	DeleteArtist(ctx context.Context, id string) (Artist, error)
+}
+
+// albumChange is an album changed by a store, as it is now and as it was before.
+type albumChange struct {
+	Album
+	Previous Album
+}
+
+// artistKey returns the key artist names are compared by: trimmed and lowercased.
+func artistKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// artistIDFor returns the ID an artist named name is given: derived from the name, so albums
+// stored before artists existed, which have no artist_id, are credited to the same artist on
+// every start.
+func artistIDFor(name string) string {
+	return uuid.NewSHA1(artistNamespace, []byte(artistKey(name))).String()
+}
+
+// albumArtistID returns the ID of the artist album a is credited to.
+func albumArtistID(a Album) string {
+	if a.ArtistID != "" || a.Artist == "" {
+		return a.ArtistID
+	}
+	return artistIDFor(a.Artist)
+}
+
+// renamedArtist returns artist renamed to name at now.
+func renamedArtist(artist Artist, name string, now time.Time) Artist {
+	artist.Name, artist.UpdatedAt = strings.TrimSpace(name), now
+	return artist
+}
+
+// artistTable holds artists in memory, indexed by ID and by name (see artistKey), for the memory
+// store, which guards it.
+type artistTable struct {
+	byID   map[string]Artist
+	byName map[string]string
+}
+
+// newArtistTable creates an empty artist table.
+func newArtistTable() *artistTable {
+	return &artistTable{byID: map[string]Artist{}, byName: map[string]string{}}
+}
+
+// all returns every artist.
+func (t *artistTable) all() []Artist {
+	artists := make([]Artist, 0, len(t.byID))
+	for _, artist := range t.byID {
+		artists = append(artists, artist)
+	}
+	return artists
+}
+
+// get returns the artist with the given ID, or errArtistNotFound.
+func (t *artistTable) get(id string) (Artist, error) {
+	artist, ok := t.byID[id]
+	if !ok {
+		return Artist{}, errArtistNotFound
+	}
+	return artist, nil
+}
+
+// named returns the artist with the given name, ignoring case, or errArtistNotFound.
+func (t *artistTable) named(name string) (Artist, error) {
+	return t.get(t.byName[artistKey(name)])
+}
+
+// checkName returns an artistExistsError if an artist other than the one with the given ID has
+// name.
+func (t *artistTable) checkName(id, name string) error {
+	if other, ok := t.byName[artistKey(name)]; ok && other != id {
+		return artistExistsError{other}
+	}
+	return nil
+}
+
+// put stores artist, replacing the artist with its ID.
+func (t *artistTable) put(artist Artist) {
+	t.remove(artist.ID)
+	t.byID[artist.ID] = artist
+	t.byName[artistKey(artist.Name)] = artist.ID
+}
+
+// remove removes the artist with the given ID, if there is one.
+func (t *artistTable) remove(id string) {
+	if artist, ok := t.byID[id]; ok {
+		delete(t.byID, id)
+		if t.byName[artistKey(artist.Name)] == id {
+			delete(t.byName, artistKey(artist.Name))
+		}
+	}
+}
+
+// artistRegistry finds the artists of each request's tenant: those of the backend store serving
+// it (see tenantRouter), which keeps them with its albums (see artistStore), so tenants sharing
+// the default store share its artists, as they share its albums. The first time a backend's
+// artists are needed, artists are stored for its albums credited to an artist it does not hold,
+// such as albums stored before artists existed.
+type artistRegistry struct {
+	// store is the server's store without soft deletes hiding deleted albums.
+	store AlbumStore
+	// backend is the backend store, or the tenantRouter in front of the backend stores.
+	backend AlbumStore
+
+	mu sync.Mutex
+	// loaded holds the tenants whose backend's artists have been loaded, defaultTenantName for the
+	// default store.
+	loaded map[string]bool
+}
+
+// newArtistRegistry creates an artist registry for backend, loading artists from the albums in
+// store, whose backend store is backend.
+func newArtistRegistry(store, backend AlbumStore) *artistRegistry {
+	return &artistRegistry{store: store, backend: backend, loaded: map[string]bool{}}
+}
+
+// book returns the artists of the request's tenant, storing artists for its albums on first use.
+// The albums are read without holding the registry's lock, so a slow first load does not hold up
+// the requests of other tenants.
+func (r *artistRegistry) book(ctx context.Context) (artistStore, error) {
+	tenant, backend := defaultTenantName, r.backend
+	if router, ok := r.backend.(*tenantRouter); ok {
+		backend = router.storeFor(ctx)
+		if _, ok := router.tenants[tenantFrom(ctx)]; ok {
+			tenant = tenantFrom(ctx)
+		}
+	}
+	artists, ok := backend.(artistStore)
+	if !ok {
+		return nil, errArtistsUnsupported
+	}
+	r.mu.Lock()
+	loaded := r.loaded[tenant]
+	r.mu.Unlock()
+	if loaded {
+		return artists, nil
+	}
+	if err := storeAlbumArtists(ctx, artists, r.store); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.loaded[tenant] = true
+	r.mu.Unlock()
+	return artists, nil
+}
+
+// storeAlbumArtists stores in artists every artist the albums in store, deleted ones included,
+// are credited to that it does not hold yet, named and dated as the first of its albums. Artists
+// stored by another server in the meantime are kept.
+func storeAlbumArtists(ctx context.Context, artists artistStore, store AlbumStore) error {
+	known, err := artists.ListArtists(ctx)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool, len(known))
+	for _, artist := range known {
+		have[artist.ID] = true
+	}
+	var missing []Artist
+	err = eachAlbum(ctx, store, func(a Album) error {
+		if id := albumArtistID(a); id != "" && !have[id] {
+			have[id] = true
+			missing = append(missing, Artist{ID: id, Name: strings.TrimSpace(a.Artist), CreatedAt: a.CreatedAt, UpdatedAt: a.CreatedAt})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Stored once the albums are read, as the store may be locked while it lists them.
+	for _, artist := range missing {
+		var exists artistExistsError
+		if err := artists.CreateArtist(ctx, artist); err != nil && !errors.As(err, &exists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// newArtist returns a new artist named name, not yet stored in artists. Its ID is derived from
+// its name (see artistIDFor), unless an artist first named name, renamed since, has that ID.
+func newArtist(ctx context.Context, artists artistStore, name string) (Artist, error) {
+	id := artistIDFor(name)
+	if _, err := artists.GetArtist(ctx, id); err == nil {
+		id = uuid.New().String()
+	} else if !errors.Is(err, errArtistNotFound) {
+		return Artist{}, err
+	}
+	now := time.Now().UTC()
+	return Artist{ID: id, Name: strings.TrimSpace(name), CreatedAt: now, UpdatedAt: now}, nil
+}
+
+// linkArtist credits album a to an artist. An artist_id must name an existing artist, whose name
+// becomes the album's artist; otherwise the album is credited to the artist with its artist name,
+// ignoring case, or, if there is none and create is set, to a new artist, which is returned to be
+// stored once the album is (see storeArtist). Without an artist_id or a valid artist name, a is
+// left unchanged for validation to reject. Returns a validationError if the artist_id names no
+// artist.
+//
+// Albums are left unchanged if the backend store does not store artists.
+//
+// Updates call linkArtist from their store mutation, so the tenant's artists must already be
+// loaded there (see preloadArtists), and the store must not be written to until the update is
+// done.
+func (srv *Server) linkArtist(ctx context.Context, a *Album, create bool) (*Artist, error) {
+	artists, err := srv.artists.book(ctx)
+	if errors.Is(err, errArtistsUnsupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.ArtistID != "" {
+		artist, err := artists.GetArtist(ctx, a.ArtistID)
+		if errors.Is(err, errArtistNotFound) {
+			return nil, validationError("artist_id names no artist")
+		}
+		if err != nil {
+			return nil, err
+		}
+		a.Artist = artist.Name
+		return nil, nil
+	}
+	if validateArtist(a.Artist, true) != "" {
+		return nil, nil
+	}
+	artist, err := artists.ArtistNamed(ctx, a.Artist)
+	var created *Artist
+	if errors.Is(err, errArtistNotFound) {
+		if !create {
+			return nil, nil
+		}
+		if artist, err = newArtist(ctx, artists, a.Artist); err == nil {
+			created = &artist
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.ArtistID, a.Artist = artist.ID, artist.Name
+	return created, nil
+}
+
+// preloadArtists loads the artists of the request's tenant (see artistRegistry.book) before a
+// store update credits an album to its artist, as loading them reads the store's albums.
+func (srv *Server) preloadArtists(ctx context.Context) error {
+	if _, err := srv.artists.book(ctx); err != nil && !errors.Is(err, errArtistsUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// relinkArtist credits album a, changed from previous by an update, to its artist as linkArtist
+// does: by its new artist_id if that changed, and otherwise by its new artist name if that changed.
+func (srv *Server) relinkArtist(ctx context.Context, a *Album, previous Album, create bool) (*Artist, error) {
+	if a.Artist != previous.Artist && a.ArtistID == previous.ArtistID {
+		a.ArtistID = ""
+	}
+	return srv.linkArtist(ctx, a, create)
+}
+
+// storeArtist stores artist, the new artist linkArtist credited an album to, now that the album
+// is stored; it does nothing if artist is nil. An artist stored with the same ID in the meantime,
+// for another album with its name, is kept. Failures are logged, as the album is stored already;
+// its artist is then stored when a server next loads the tenant's artists (see
+// artistRegistry.book).
+func (srv *Server) storeArtist(ctx context.Context, artist *Artist) {
+	if artist == nil {
+		return
+	}
+	artists, err := srv.artists.book(ctx)
+	if err == nil {
+		err = artists.CreateArtist(ctx, *artist)
+	}
+	var exists artistExistsError
+	if errors.As(err, &exists) && exists.ID == artist.ID {
+		return
+	}
+	if err != nil {
+		log.Printf("store artist %s (%s): %v", artist.ID, artist.Name, err)
+	}
+}
+
+// albumsChanged brings the server's album caches up to date with albums the backend store
+// changed directly, such as an artist's albums it renamed.
+func (srv *Server) albumsChanged(ctx context.Context, changes []albumChange) {
+	for _, change := range changes {
+		if srv.cache != nil {
+			srv.cache.written(ctx, change.Album)
+		}
+		if srv.staleReads != nil {
+			srv.staleReads.remember(ctx, change.Album)
+		}
+	}
+}
+
+// artistAlbums returns the albums credited to the artist with the given ID, deleted ones included.
+func (srv *Server) artistAlbums(ctx context.Context, id string) ([]Album, error) {
+	var albums []Album
+	err := eachAlbum(ctx, srv.softDeletes.AlbumStore, func(a Album) error {
+		if albumArtistID(a) == id {
+			albums = append(albums, a)
+		}
+		return nil
+	})
+	return albums, err
+}
+
+// parseArtistIDFilter returns a filter keeping the albums credited to the artist named by
+// ?artist_id=, or nil if it is not given.
+func parseArtistIDFilter(c *gin.Context) func(Album) bool {
+	id := c.Query("artist_id")
+	if id == "" {
+		return nil
+	}
+	return func(a Album) bool { return albumArtistID(a) == id }
+}
+
+// artistRequest is the JSON body of POST /artists and PUT and PATCH /artists/:id.
+type artistRequest struct {
+	Name string `json:"name"`
+}
+
+// bindArtistRequest reads an artistRequest from the request body and validates its name as an
+// album artist. Responds with HTTP 400 and returns false if it is invalid.
+func bindArtistRequest(c *gin.Context) (artistRequest, bool) {
+	var req artistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid JSON",
+			"details": err.Error(),
+		})
+		return artistRequest{}, false
+	}
+	if errMsg := validateArtist(req.Name, true); errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return artistRequest{}, false
+	}
+	return req, true
+}
+
+// respondArtistError writes the response for an error returned by the artist registry, or by
+// the store while loading or changing an artist's albums (see respondStoreError).
+func respondArtistError(c *gin.Context, err error) {
+	var exists artistExistsError
+	switch {
+	case errors.Is(err, errArtistNotFound):
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "artist not found"})
+	case errors.As(err, &exists):
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "An artist with this name already exists", "id": exists.ID})
+	case errors.Is(err, errArtistHasAlbums):
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "The artist still has albums; delete or reassign them first"})
+	case errors.Is(err, errArtistsUnsupported):
+		c.IndentedJSON(http.StatusNotImplemented, gin.H{"error": "Artists are not available with this storage backend"})
+	default:
+		respondStoreError(c, err)
+	}
+}
+
+// getArtists handles GET /artists requests.
+// Returns every artist as a JSON array ordered by name with HTTP 200 status.
+func (srv *Server) getArtists(c *gin.Context) {
+	ctx := c.Request.Context()
+	artists, err := srv.artists.book(ctx)
+	var all []Artist
+	if err == nil {
+		all, err = artists.ListArtists(ctx)
+	}
+	if err != nil {
+		respondArtistError(c, err)
+		return
+	}
+	slices.SortFunc(all, func(x, y Artist) int {
+		return strings.Compare(artistKey(x.Name), artistKey(y.Name))
+	})
+	c.IndentedJSON(http.StatusOK, all)
+}
+
+// postArtist handles POST /artists requests.
+// Creates the artist in the JSON body ({"name": "..."}) and returns it with HTTP 201 status.
+// Returns HTTP 400 if the name is invalid, or HTTP 409 if an artist has the name, ignoring case,
+// with that artist's ID.
+func (srv *Server) postArtist(c *gin.Context) {
+	req, ok := bindArtistRequest(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	artists, err := srv.artists.book(ctx)
+	var artist Artist
+	if err == nil {
+		artist, err = newArtist(ctx, artists, req.Name)
+	}
+	if err == nil {
+		err = artists.CreateArtist(ctx, artist)
+	}
+	if err != nil {
+		respondArtistError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, artist)
+}
+
+// getArtist handles GET /artists/:id requests.
+// Returns the artist as JSON with HTTP 200 status, or HTTP 404 if it is not found.
+func (srv *Server) getArtist(c *gin.Context) {
+	ctx := c.Request.Context()
+	artists, err := srv.artists.book(ctx)
+	var artist Artist
+	if err == nil {
+		artist, err = artists.GetArtist(ctx, c.Param("id"))
+	}
+	if err != nil {
+		respondArtistError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, artist)
+}
+
+// renameArtist handles PUT and PATCH /artists/:id requests.
+// Renames the artist to the name in the JSON body ({"name": "..."}) and, atomically with it, on
+// every album credited to it, deleted ones included. Returns the artist as JSON with HTTP 200 status.
+// Returns HTTP 400 if the name is invalid, HTTP 404 if the artist is not found, or HTTP 409 if
+// another artist has the name, with that artist's ID.
+func (srv *Server) renameArtist(c *gin.Context) {
+	req, ok := bindArtistRequest(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	artists, err := srv.artists.book(ctx)
+	// The backend store renames the albums, so updates the album cache holds back are written
+	// first.
+	if err == nil && srv.cache != nil {
+		err = srv.cache.flush(ctx)
+	}
+	if err != nil {
+		respondArtistError(c, err)
+		return
+	}
+	id, now := c.Param("id"), time.Now().UTC()
+	artist, renamed, err := artists.RenameArtist(ctx, id, req.Name, func(a *Album) {
+		a.ArtistID, a.Artist = id, strings.TrimSpace(req.Name)
+		stampUpdated(a, now)
+	})
+	if err != nil {
+		respondArtistError(c, err)
+		return
+	}
+	srv.albumsChanged(ctx, renamed)
+	for _, change := range renamed {
+		// Deleted albums are renamed too, so they are credited to the artist when restored.
+		if change.DeletedAt.IsZero() {
+			srv.publishAlbumEvent(ctx, eventAlbumUpdated, change.Album, &change.Previous)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, artist)
+}
+
+// deleteArtist handles DELETE /artists/:id requests.
+// Deletes the artist and returns it as JSON with HTTP 200 status. Returns HTTP 404 if the artist
+// is not found, or HTTP 409 if albums, deleted ones awaiting restore included, are credited to it;
+// the check is atomic with the delete.
+func (srv *Server) deleteArtist(c *gin.Context) {
+	ctx := c.Request.Context()
+	artists, err := srv.artists.book(ctx)
+	var artist Artist
+	if err == nil {
+		artist, err = artists.DeleteArtist(ctx, c.Param("id"))
+	}
+	if err != nil {
+		respondArtistError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, artist)
+}
+
+// getArtistAlbums handles GET /artists/:id/albums requests.
+// Returns the artist's albums, filtered by ?state= as for GET /albums, as a JSON array with HTTP
+// 200 status, rendered as GET /albums renders them. Returns HTTP 400 if state is invalid, or
+// HTTP 404 if the artist is not found.
+func (srv *Server) getArtistAlbums(c *gin.Context) {
+	match, errMsg := parseState(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	ctx := c.Request.Context()
+	artists, err := srv.artists.book(ctx)
+	id := c.Param("id")
+	if err == nil {
+		_, err = artists.GetArtist(ctx, id)
+	}
+	var albums []Album
+	if err == nil {
+		albums, err = srv.artistAlbums(ctx, id)
+	}
+	if err != nil {
+		respondArtistError(c, err)
+		return
+	}
+	albums = filterAlbums(albums, func(a Album) bool { return a.DeletedAt.IsZero() })
+	renderAlbums(c, http.StatusOK, filterAlbums(albums, match))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestArtists tests the artist endpoints and crediting albums to artists.
+// Verifies that artists are loaded from existing albums, that albums are credited to an artist by
+// artist_id or by name, creating it if needed, that a failed update creates no artist, that
+// renaming an artist renames its albums, that artists with albums cannot be deleted, and that
+// tenants sharing the default store share its artists.
+func TestArtists(t *testing.T) {
+	srv := newTestServer(t)
+	const coltraneAlbum = "/albums/550e8400-e29b-41d4-a716-446655440001"
+	coltrane := artistIDFor("John Coltrane")
+
+	var artists []Artist
+	json.Unmarshal(srv.do("GET", "/artists", "").Body.Bytes(), &artists)
+	if len(artists) != 3 || artists[0].Name != "Gerry Mulligan" || artists[1].ID != coltrane {
+		t.Fatalf("Expected the seed albums' artists by name, got %+v", artists)
+	}
+
+	var a Album
+	w := srv.do("POST", "/albums", `{"title": "Giant Steps", "artist": "john coltrane", "price": 19.99}`)
+	json.Unmarshal(w.Body.Bytes(), &a)
+	if w.Code != 201 || a.ArtistID != coltrane || a.Artist != "John Coltrane" {
+		t.Errorf("Expected the album credited to John Coltrane, got %d: %s", w.Code, w.Body)
+	}
+
+	var miles Artist
+	json.Unmarshal(srv.do("POST", "/artists", `{"name": "Miles Davis"}`).Body.Bytes(), &miles)
+	if w := srv.do("POST", "/artists", `{"name": "MILES DAVIS"}`); w.Code != 409 || !strings.Contains(w.Body.String(), miles.ID) {
+		t.Errorf("Expected 409 with the existing artist's ID, got %d: %s", w.Code, w.Body)
+	}
+	var kind Album
+	json.Unmarshal(srv.do("POST", "/albums", `{"title": "Kind of Blue", "artist_id": "`+miles.ID+`", "price": 49.99}`).Body.Bytes(), &kind)
+	if kind.Artist != "Miles Davis" || kind.ArtistID != miles.ID {
+		t.Errorf("Expected the album to take the artist's name, got %+v", kind)
+	}
+	for method, path := range map[string]string{"POST": "/albums", "PATCH": coltraneAlbum} {
+		if w := srv.do(method, path, `{"title": "Unknown", "artist_id": "no-such-artist", "price": 1}`, "If-Match", "*"); w.Code != 400 {
+			t.Errorf("%s %s: expected 400 for an unknown artist_id, got %d", method, path, w.Code)
+		}
+	}
+
+	var albums []Album
+	json.Unmarshal(srv.do("GET", "/artists/"+coltrane+"/albums", "").Body.Bytes(), &albums)
+	if len(albums) != 2 || albums[1].Title != "Giant Steps" {
+		t.Errorf("Expected both John Coltrane albums, got %+v", albums)
+	}
+	json.Unmarshal(srv.do("GET", "/albums?artist_id="+coltrane, "").Body.Bytes(), &albums)
+	if len(albums) != 2 {
+		t.Errorf("Expected ?artist_id= to keep both John Coltrane albums, got %d", len(albums))
+	}
+
+	if w := srv.do("PUT", "/artists/"+coltrane, `{"name": "Gerry Mulligan"}`); w.Code != 409 {
+		t.Errorf("Expected 409 renaming to another artist's name, got %d", w.Code)
+	}
+	if w := srv.do("PATCH", "/artists/"+coltrane, `{"name": "John William Coltrane"}`); w.Code != 200 {
+		t.Fatalf("Expected 200 renaming the artist, got %d: %s", w.Code, w.Body)
+	}
+	var renamed Album
+	json.Unmarshal(srv.do("GET", coltraneAlbum, "").Body.Bytes(), &renamed)
+	if renamed.Artist != "John William Coltrane" || renamed.ArtistID != coltrane {
+		t.Errorf("Expected the rename on the artist's albums, got %+v", renamed)
+	}
+
+	srv.do("PATCH", coltraneAlbum, `{"artist": "Alice Coltrane"}`, "If-Match", "*")
+	json.Unmarshal(srv.do("GET", coltraneAlbum, "").Body.Bytes(), &renamed)
+	if renamed.ArtistID != artistIDFor("Alice Coltrane") {
+		t.Errorf("Expected a new artist for a new artist name, got %+v", renamed)
+	}
+	patch := httptest.NewRequest("PATCH", coltraneAlbum, strings.NewReader(`[{"op": "replace", "path": "/artist_id", "value": "`+coltrane+`"}]`))
+	patch.Header.Set("Content-Type", jsonPatchContentType)
+	patch.Header.Set("If-Match", "*")
+	w = httptest.NewRecorder()
+	srv.router.ServeHTTP(w, patch)
+	json.Unmarshal(w.Body.Bytes(), &renamed)
+	if w.Code != 200 || renamed.Artist != "John William Coltrane" {
+		t.Errorf("Expected a JSON Patch of artist_id to credit the album back, got %d: %s", w.Code, w.Body)
+	}
+
+	for _, tc := range []struct{ method, path, body string }{
+		{"PATCH", "/albums/no-such-album", `{"artist": "Ornette Coleman"}`},
+		{"PATCH", coltraneAlbum, `{"artist": "Ornette Coleman", "price": 1.234}`},
+		{"PUT", "/albums/no-such-album", `{"title": "Free Jazz", "artist": "Ornette Coleman", "price": 9.99}`},
+	} {
+		if w := srv.do(tc.method, tc.path, tc.body, "If-Match", "*"); w.Code != 404 && w.Code != 400 {
+			t.Errorf("%s %s: expected the update to fail, got %d", tc.method, tc.path, w.Code)
+		}
+	}
+	put := httptest.NewRequest("PUT", coltraneAlbum, strings.NewReader(`{"title": "Free Jazz", "artist": "Ornette Coleman", "price": 9.99}`))
+	put.Header.Set("Content-Type", "application/json")
+	put.Header.Set("If-Match", `"stale"`)
+	w = httptest.NewRecorder()
+	srv.router.ServeHTTP(w, put)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for a stale If-Match, got %d", w.Code)
+	}
+	if w := srv.do("GET", "/artists/"+artistIDFor("Ornette Coleman"), ""); w.Code != 404 {
+		t.Errorf("Expected failed updates to create no artist, got %d", w.Code)
+	}
+
+	srv.do("DELETE", "/albums/"+kind.ID, "", "If-Match", "*")
+	if w := srv.do("DELETE", "/artists/"+miles.ID, ""); w.Code != 409 {
+		t.Errorf("Expected 409 deleting an artist with a deleted album awaiting restore, got %d", w.Code)
+	}
+	srv.do("DELETE", "/albums/"+kind.ID+"?permanent=true", "", "If-Match", "*")
+	if w := srv.do("DELETE", "/artists/"+miles.ID, ""); w.Code != 200 {
+		t.Errorf("Expected 200 deleting an artist without albums, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("GET", "/artists/"+miles.ID, ""); w.Code != 404 {
+		t.Errorf("Expected 404 for a deleted artist, got %d", w.Code)
+	}
+
+	json.Unmarshal(srv.do("GET", "/artists", "", tenantHeader, "acme").Body.Bytes(), &artists)
+	if len(artists) != 4 || artists[0].Name != "Alice Coltrane" {
+		t.Errorf("Expected a tenant without its own store to share the default artists, got %+v", artists)
+	}
+}
+
+// TestArtistsPersist tests that artists are kept by the backend store.
+// Verifies that artists created and renamed through the API are there after a restart with the
+// write-ahead log, with snapshots, and with SQLite, including one without albums, which cannot be
+// loaded from the albums, and that an album was renamed with its artist.
+func TestArtistsPersist(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name      string
+		configure func(*Config)
+		restart   func(AlbumStore) error
+	}{
+		{"wal", func(cfg *Config) { cfg.WALPath = filepath.Join(dir, "albums.wal") }, nil},
+		{"snapshot", func(cfg *Config) { cfg.SnapshotPath = filepath.Join(dir, "albums.json") }, func(s AlbumStore) error {
+			return saveSnapshot(filepath.Join(dir, "albums.json"), s.(*memoryStore))
+		}},
+		{"sqlite", func(cfg *Config) {
+			cfg.Storage, cfg.SQLitePath = "sqlite", filepath.Join(dir, "albums.db")
+		}, func(s AlbumStore) error { return s.(*sqliteStore).db.Close() }},
+	} {
+		open := func() (*Server, AlbumStore) {
+			cfg := loadConfig()
+			tc.configure(&cfg)
+			store, err := newAlbumStore(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return newTestServerWith(t, store, tc.configure), store
+		}
+
+		srv, store := open()
+		var artist Artist
+		json.Unmarshal(srv.do("POST", "/artists", `{"name": "Ornette Coleman"}`).Body.Bytes(), &artist)
+		var dolphy Artist
+		json.Unmarshal(srv.do("POST", "/artists", `{"name": "Eric Dolphy"}`).Body.Bytes(), &dolphy)
+		var album Album
+		json.Unmarshal(srv.do("POST", "/albums", `{"title": "Free Jazz", "artist_id": "`+artist.ID+`", "price": 9.99}`).Body.Bytes(), &album)
+		if w := srv.do("PUT", "/artists/"+artist.ID, `{"name": "The Ornette Coleman Double Quartet"}`); w.Code != http.StatusOK {
+			t.Fatalf("%s: expected the artist to be renamed, got %d: %s", tc.name, w.Code, w.Body)
+		}
+		if tc.restart != nil {
+			if err := tc.restart(store); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		srv, _ = open()
+		var got Artist
+		json.Unmarshal(srv.do("GET", "/artists/"+artist.ID, "").Body.Bytes(), &got)
+		if got.Name != "The Ornette Coleman Double Quartet" {
+			t.Errorf("%s: expected the renamed artist after a restart, got %+v", tc.name, got)
+		}
+		if w := srv.do("GET", "/artists/"+dolphy.ID, ""); w.Code != http.StatusOK {
+			t.Errorf("%s: expected the artist without albums after a restart, got %d", tc.name, w.Code)
+		}
+		var restored Album
+		json.Unmarshal(srv.do("GET", "/albums/"+album.ID, "").Body.Bytes(), &restored)
+		if restored.Artist != got.Name || restored.ArtistID != artist.ID {
+			t.Errorf("%s: expected the album to be renamed with its artist, got %+v", tc.name, restored)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// backupIDFormat formats the time a full backup is taken as its ID, which names its file and ties
+// the incremental backups that follow it to it. IDs sort in the order the backups were taken.
+const backupIDFormat = "20060102T150405.000000000Z"
+
+// fullBackup is the JSON document of a full backup, full-<id>.json: every album of the default
+// store, deleted ones included, as a snapshot that SNAPSHOT_PATH can load, with the number of the
+// last change feed event it includes.
+type fullBackup struct {
+	albumSnapshot
+	ID  string `json:"id"`
+	Seq int64  `json:"seq"`
+}
+
+// incrementalBackup is the JSON document of an incremental backup, incr-<base>-<to_seq>.json: the
+// change feed events numbered from FromSeq to ToSeq for the default store, applied in order on top
+// of the full backup Base and the incremental backups before it.
+type incrementalBackup struct {
+	Version int            `json:"version"`
+	Base    string         `json:"base"`
+	FromSeq int64          `json:"from_seq"`
+	ToSeq   int64          `json:"to_seq"`
+	SavedAt time.Time      `json:"saved_at"`
+	Changes []backupChange `json:"changes"`
+}
+
+// backupChange is one change feed event in an incremental backup: the album after it, or the
+// removed album for deletions. A deleted album without deleted_at was deleted permanently.
+type backupChange struct {
+	Seq   int64     `json:"seq"`
+	Type  string    `json:"type"`
+	At    time.Time `json:"at"`
+	Album Album     `json:"album"`
+}
+
+// backupScheduler writes backups of the default store to BACKUP_DIR: a full backup when it starts
+// and every BACKUP_FULL_INTERVAL, and in between an incremental backup every BACKUP_INTERVAL with
+// the changes since the last backup, taken from the change feed. cmd/restoretool restores them to
+// any point in time they cover.
+type backupScheduler struct {
+	dir          string
+	interval     time.Duration
+	fullInterval time.Duration
+	store        AlbumStore
+	// changes is nil when the change feed is disabled, which makes every backup a full one.
+	changes *changeFeed
+
+	mu sync.Mutex
+	// base is the ID of the last full backup, or "" before the first; seq is the number of the last
+	// event backed up, and fullAt when the last full backup was taken.
+	base   string
+	seq    int64
+	fullAt time.Time
+}
+
+// newBackupScheduler creates the backup scheduler configured by cfg for store, the store behind
+// soft deletes, following changes. Returns nil if BACKUP_DIR is unset, which disables backups.
+func newBackupScheduler(cfg Config, store AlbumStore, changes *changeFeed) *backupScheduler {
+	if cfg.BackupDir == "" {
+		return nil
+	}
+	return &backupScheduler{
+		dir:          cfg.BackupDir,
+		interval:     cfg.BackupInterval,
+		fullInterval: cfg.BackupFullInterval,
+		store:        store,
+		changes:      changes,
+	}
+}
+
+// run takes a full backup, then a backup every interval until ctx is done. Failures are logged and
+// retried at the next interval.
+func (b *backupScheduler) run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		if path, err := b.backup(ctx, time.Now()); err != nil {
+			log.Printf("backup %s: %v", b.dir, err)
+		} else if path != "" {
+			log.Printf("Saved backup %s", path)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backup takes the backup due at now and returns the path of the file written, or "" if nothing
+// changed since the last backup. It is a full backup if there has been none yet, the last full one
+// is BACKUP_FULL_INTERVAL old, or the change feed no longer has every event since the last backup;
+// otherwise it is an incremental one.
+func (b *backupScheduler) backup(ctx context.Context, now time.Time) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.base == "" || b.changes == nil || now.Sub(b.fullAt) >= b.fullInterval {
+		return b.full(ctx, now)
+	}
+	records, last, _, gap := b.changes.since(b.seq, "")
+	if gap {
+		return b.full(ctx, now)
+	}
+	if len(records) == 0 {
+		return "", nil
+	}
+	incr := incrementalBackup{Version: snapshotVersion, Base: b.base, FromSeq: b.seq + 1, ToSeq: last, SavedAt: now.UTC()}
+	for _, r := range records {
+		incr.Changes = append(incr.Changes, backupChange{Seq: r.seq, Type: r.evt.Type, At: r.evt.At.UTC(), Album: r.evt.Album})
+	}
+	path := filepath.Join(b.dir, fmt.Sprintf("incr-%s-%012d.json", b.base, last))
+	if err := writeBackup(path, incr); err != nil {
+		return "", err
+	}
+	b.seq = last
+	return path, nil
+}
+
+// full writes a full backup taken at now and starts a new chain of incremental backups from it.
+// The caller must hold b.mu.
+func (b *backupScheduler) full(ctx context.Context, now time.Time) (string, error) {
+	// Events recorded while the albums are listed may be in the backup already; replaying them
+	// from the next incremental backup leaves the albums as they are.
+	var seq int64
+	if b.changes != nil {
+		seq = b.changes.last()
+	}
+	albums, err := b.store.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	now = now.UTC()
+	id := now.Format(backupIDFormat)
+	path := filepath.Join(b.dir, "full-"+id+".json")
+	backup := fullBackup{
+		albumSnapshot: albumSnapshot{Version: snapshotVersion, SavedAt: now, Albums: albums},
+		ID:            id,
+		Seq:           seq,
+	}
+	if err := writeBackup(path, backup); err != nil {
+		return "", err
+	}
+	b.base, b.seq, b.fullAt = id, seq, now
+	return path, nil
+}
+
+// writeBackup writes v as JSON to path, creating its directory if needed, without ever leaving a
+// partly written file behind.
+func writeBackup(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBackups tests scheduled backups.
+// Verifies that the first backup is a full one of every album, that later ones only hold the changes
+// since, that nothing is written when nothing changed, and that a full backup is taken again once
+// BACKUP_FULL_INTERVAL has passed or the change feed has dropped events not yet backed up.
+func TestBackups(t *testing.T) {
+	dir := t.TempDir()
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.BackupDir = dir
+		cfg.BackupFullInterval = time.Hour
+		cfg.ChangeFeedSize = 3
+	})
+	do := func(method, path, body string) {
+		srv.do(method, path, body, "If-Match", "*")
+	}
+	start := time.Now()
+
+	path, err := srv.backups.backup(t.Context(), start)
+	var full fullBackup
+	readBackup(t, path, &full)
+	if err != nil || !strings.HasPrefix(filepath.Base(path), "full-") || len(full.Albums) != 3 || full.Seq != 0 {
+		t.Fatalf("Expected a full backup of the seed albums, got %s %+v: %v", path, full, err)
+	}
+	if loaded, err := loadSnapshot(path); err != nil || len(loaded.Albums) != 3 {
+		t.Errorf("Expected the full backup to load as a snapshot, got %d albums: %v", len(loaded.Albums), err)
+	}
+
+	do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440002", `{"price": 9.99}`)
+	do("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440003?permanent=true", "")
+	path, err = srv.backups.backup(t.Context(), start.Add(time.Minute))
+	var incr incrementalBackup
+	readBackup(t, path, &incr)
+	if err != nil || incr.Base != full.ID || incr.FromSeq != 1 || incr.ToSeq != 2 || len(incr.Changes) != 2 ||
+		incr.Changes[0].Album.Price != 9.99 || incr.Changes[1].Type != eventAlbumDeleted {
+		t.Fatalf("Expected an incremental backup of both changes, got %s %+v: %v", path, incr, err)
+	}
+	if path, err := srv.backups.backup(t.Context(), start.Add(2*time.Minute)); path != "" || err != nil {
+		t.Errorf("Expected no backup without changes, got %q: %v", path, err)
+	}
+
+	for _, price := range []string{"1", "2", "3", "4"} {
+		do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440002", `{"price": `+price+`}`)
+	}
+	if path, _ := srv.backups.backup(t.Context(), start.Add(3*time.Minute)); !strings.HasPrefix(filepath.Base(path), "full-") {
+		t.Errorf("Expected a full backup after the change feed dropped events, got %s", path)
+	}
+	do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440002", `{"price": 5}`)
+	if path, _ := srv.backups.backup(t.Context(), start.Add(2*time.Hour)); !strings.HasPrefix(filepath.Base(path), "full-") {
+		t.Errorf("Expected a full backup after BACKUP_FULL_INTERVAL, got %s", path)
+	}
+}
+
+// readBackup decodes the backup at path into v, failing the test if it cannot be read.
+func readBackup(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected a backup at %q: %v", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("Expected %s to be JSON: %v", path, err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchOperations is the most operations one POST /batch request may carry.
+const maxBatchOperations = 100
+
+// batchOperation is one request of a POST /batch body. IfMatch, if set, is sent as its If-Match
+// header in place of the batch request's, so each album update can name its own version.
+type batchOperation struct {
+	Method  string          `json:"method"`
+	Path    string          `json:"path"`
+	Body    json.RawMessage `json:"body,omitempty"`
+	IfMatch string          `json:"if_match,omitempty"`
+}
+
+// batchResult is the outcome of one batch operation: its HTTP status and JSON response body.
+type batchResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// validate returns an error message if op is not a request POST /batch can run.
+func (op batchOperation) validate() string {
+	switch op.Method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return fmt.Sprintf("unsupported method %q", op.Method)
+	}
+	u, err := url.Parse(op.Path)
+	if err != nil || !strings.HasPrefix(op.Path, "/") || u.Host != "" {
+		return fmt.Sprintf("path %q must be an absolute path on this server", op.Path)
+	}
+	if unversionedPath(u.Path) == "/batch" {
+		return "batches cannot be nested"
+	}
+	return ""
+}
+
+// dryRunnable reports whether op can be checked without side effects: it is a GET, or an album
+// create, update, replacement, or delete, or a bulk delete, which honor X-Dry-Run.
+func (op batchOperation) dryRunnable() bool {
+	u, _ := url.Parse(op.Path)
+	path := unversionedPath(u.Path)
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case op.Method == http.MethodGet:
+		return true
+	case op.Method == http.MethodPost:
+		return path == "/albums"
+	case op.Method == http.MethodDelete && path == "/albums":
+		return true
+	case op.Method == http.MethodPatch, op.Method == http.MethodPut, op.Method == http.MethodDelete:
+		return len(segments) == 2 && segments[0] == "albums"
+	}
+	return false
+}
+
+// serveOperation runs op through the router as if it were sent with the headers of the batch
+// request, with op's If-Match if it has one, plus the X-Dry-Run header if dryRun is set, and
+// returns its result.
+func (srv *Server) serveOperation(c *gin.Context, op batchOperation, dryRun bool) batchResult {
+	req, err := http.NewRequestWithContext(c.Request.Context(), op.Method, op.Path, bytes.NewReader(op.Body))
+	if err != nil {
+		return batchResult{Status: http.StatusBadRequest}
+	}
+	req.Header = c.Request.Header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Del(dryRunHeader)
+	if op.IfMatch != "" {
+		req.Header.Set("If-Match", op.IfMatch)
+	}
+	if dryRun {
+		req.Header.Set(dryRunHeader, "true")
+	}
+	req.RemoteAddr = c.Request.RemoteAddr
+
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	result := batchResult{Status: w.Code}
+	if json.Valid(w.Body.Bytes()) {
+		result.Body = w.Body.Bytes()
+	}
+	return result
+}
+
+// postBatch handles POST /batch requests.
+// Runs the operations in the JSON body ({"atomic": false, "operations": [{"method": "PATCH",
+// "path": "/albums/1", "body": {...}, "if_match": "\"3\""}, ...]}) one after another, each with
+// the headers of the batch request, and returns {"results": [{"status": 200, "body": {...}}, ...]} with HTTP 200
+// status. A failed operation does not stop the ones after it.
+// With "atomic": true every operation is first run as a dry run, and none is run for real unless
+// all of them succeed. The response then also has "committed", which is false if the batch was
+// rejected, in which case the results are those of the dry runs.
+// Atomic batches may only contain GETs and album creates, updates, and deletes.
+// Returns HTTP 400 if the body is invalid, has no or more than 100 operations, or an operation is invalid.
+func (srv *Server) postBatch(c *gin.Context) {
+	var body struct {
+		Atomic     bool             `json:"atomic"`
+		Operations []batchOperation `json:"operations"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid JSON",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(body.Operations) == 0 || len(body.Operations) > maxBatchOperations {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("operations must list 1 to %d operations", maxBatchOperations)})
+		return
+	}
+	for i, op := range body.Operations {
+		if errMsg := op.validate(); errMsg != "" {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("operation %d: %s", i, errMsg)})
+			return
+		}
+		if body.Atomic && !op.dryRunnable() {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("operation %d: %s %s cannot be part of an atomic batch", i, op.Method, op.Path)})
+			return
+		}
+	}
+
+	results := make([]batchResult, len(body.Operations))
+	if body.Atomic {
+		ok := true
+		for i, op := range body.Operations {
+			results[i] = srv.serveOperation(c, op, true)
+			ok = ok && results[i].Status < 300
+		}
+		if !ok {
+			c.IndentedJSON(http.StatusOK, gin.H{"committed": false, "results": results})
+			return
+		}
+	}
+	for i, op := range body.Operations {
+		reportProgress(c.Request.Context(), i, len(body.Operations))
+		results[i] = srv.serveOperation(c, op, false)
+	}
+	reportProgress(c.Request.Context(), len(body.Operations), len(body.Operations))
+	if body.Atomic {
+		c.IndentedJSON(http.StatusOK, gin.H{"committed": true, "results": results})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// batchResponse is the body of a POST /batch response.
+type batchResponse struct {
+	Committed *bool         `json:"committed"`
+	Results   []batchResult `json:"results"`
+}
+
+// postBatchBody sends body to POST /batch and decodes the response.
+func postBatchBody(t *testing.T, srv *Server, body string) (int, batchResponse) {
+	t.Helper()
+	w := srv.do("POST", "/batch", body)
+	var resp batchResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+// TestBatch tests running several operations with POST /batch.
+// Verifies that operations run in order with their own statuses, that a failure does not stop the
+// operations after it, and that each album update needs its own if_match.
+func TestBatch(t *testing.T) {
+	srv := newTestServer(t)
+	code, resp := postBatchBody(t, srv, `{"operations": [
+		{"method": "POST", "path": "/albums", "body": {"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}},
+		{"method": "PATCH", "path": "/albums/missing", "body": {"price": 9.99}, "if_match": "*"},
+		{"method": "DELETE", "path": "/albums/550e8400-e29b-41d4-a716-446655440002", "if_match": "\"0\""},
+		{"method": "GET", "path": "/albums?artist=davis"},
+		{"method": "DELETE", "path": "/albums/550e8400-e29b-41d4-a716-446655440001"}
+	]}`)
+	if code != 200 || len(resp.Results) != 5 || resp.Committed != nil {
+		t.Fatalf("Expected 200 with 5 results, got %d: %+v", code, resp)
+	}
+	for i, want := range []int{201, 404, 200, 200, 428} {
+		if resp.Results[i].Status != want {
+			t.Errorf("Operation %d: expected %d, got %d", i, want, resp.Results[i].Status)
+		}
+	}
+	var listed []Album
+	json.Unmarshal(resp.Results[3].Body, &listed)
+	if len(listed) != 1 || listed[0].Title != "Kind of Blue" {
+		t.Errorf("Expected the GET to see the created album, got %s", resp.Results[3].Body)
+	}
+}
+
+// TestBatchAtomic tests that an atomic batch runs only if every operation would succeed.
+func TestBatchAtomic(t *testing.T) {
+	srv := newTestServer(t)
+	_, resp := postBatchBody(t, srv, `{"atomic": true, "operations": [
+		{"method": "DELETE", "path": "/albums/550e8400-e29b-41d4-a716-446655440001", "if_match": "*"},
+		{"method": "PATCH", "path": "/albums/550e8400-e29b-41d4-a716-446655440002", "body": {"upc": "123"}, "if_match": "*"}
+	]}`)
+	if resp.Committed == nil || *resp.Committed || resp.Results[1].Status != 400 {
+		t.Errorf("Expected the batch to be rejected, got %+v", resp)
+	}
+	if all, _ := srv.store.List(t.Context()); len(all) != 3 {
+		t.Errorf("Expected no album to be deleted, got %d albums", len(all))
+	}
+
+	_, resp = postBatchBody(t, srv, `{"atomic": true, "operations": [
+		{"method": "DELETE", "path": "/albums/550e8400-e29b-41d4-a716-446655440001", "if_match": "*"},
+		{"method": "PATCH", "path": "/albums/550e8400-e29b-41d4-a716-446655440002", "body": {"price": 9.99}, "if_match": "*"}
+	]}`)
+	if resp.Committed == nil || !*resp.Committed {
+		t.Errorf("Expected the batch to be committed, got %+v", resp)
+	}
+	if a, _ := srv.store.Get(t.Context(), "550e8400-e29b-41d4-a716-446655440002"); a.Price != 9.99 {
+		t.Errorf("Expected the price to be updated, got %v", a.Price)
+	}
+}
+
+// TestBatchInvalid tests that invalid batches are rejected with HTTP 400 without running anything.
+func TestBatchInvalid(t *testing.T) {
+	srv := newTestServer(t)
+	for _, body := range []string{
+		`{"operations": []}`,
+		`{"operations": [{"method": "TRACE", "path": "/albums"}]}`,
+		`{"operations": [{"method": "GET", "path": "http://example.com/albums"}]}`,
+		`{"operations": [{"method": "POST", "path": "/batch", "body": {}}]}`,
+		`{"atomic": true, "operations": [{"method": "POST", "path": "/albums/550e8400-e29b-41d4-a716-446655440001/archive"}]}`,
+	} {
+		if code, _ := postBatchBody(t, srv, body); code != 400 {
+			t.Errorf("%s: expected 400, got %d", body, code)
+		}
+	}
+	if a, _ := srv.store.Get(t.Context(), "550e8400-e29b-41d4-a716-446655440001"); !a.ArchivedAt.IsZero() {
+		t.Error("Expected the album not to be archived")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkAlbums is the most albums one POST /albums/batch request may create.
+const maxBulkAlbums = 1000
+
+// bulkResult is the outcome for one album of POST /albums/batch: its position in the request,
+// its status, and the new album's ID or why it was not created.
+type bulkResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Warnings are the validation warnings for a created album, including price adjustments (see
+	// checkWarnings and pricingRules).
+	Warnings []validationWarning `json:"warnings,omitempty"`
+}
+
+// postAlbumsBatch handles POST /albums/batch requests.
+// Creates each album in the JSON array body as POST /albums would, independently of the others,
+// and returns {"created": n, "failed": n, "results": [{"index": 0, "status": 201, "id": "..."},
+// {"index": 1, "status": 400, "error": "..."}, ...]} in request order, with the validation
+// warnings of each album created. The status is HTTP 201 if
+// every album was created, or HTTP 207 if some were not. ?allow_duplicate=true works as for POST /albums.
+// Returns HTTP 400 if the body is not a JSON array of 1 to 1000 albums.
+func (srv *Server) postAlbumsBatch(c *gin.Context) {
+	allowDuplicate, errMsg := parseAllowDuplicate(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	var albums []Album
+	if err := c.ShouldBindJSON(&albums); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid JSON",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(albums) == 0 || len(albums) > maxBulkAlbums {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Body must list 1 to %d albums", maxBulkAlbums)})
+		return
+	}
+
+	ctx := c.Request.Context()
+	results := make([]bulkResult, len(albums))
+	failed := 0
+	for i, a := range albums {
+		reportProgress(ctx, i, len(albums))
+		results[i] = bulkResult{Index: i}
+		if _, err := srv.linkArtist(ctx, &a, false); err != nil {
+			results[i].Status, results[i].Error = createFailure(err)
+			failed++
+			continue
+		}
+		if err := validateAlbum(&a, srv.cfg.Genres); err != nil {
+			results[i].Status, results[i].Error = createFailure(err)
+			failed++
+			continue
+		}
+		adjusted, err := srv.applyPricing(&a, nil)
+		if err != nil {
+			results[i].Status, results[i].Error = createFailure(err)
+			failed++
+			continue
+		}
+		prepareNewAlbum(&a)
+		created, warnings, err := srv.createAlbum(ctx, a, allowDuplicate)
+		if err != nil {
+			results[i].Status, results[i].Error = createFailure(err)
+			failed++
+			continue
+		}
+		results[i].Status, results[i].ID, results[i].Warnings = http.StatusCreated, created.ID, append(adjusted, warnings...)
+		srv.publishAlbumEvent(ctx, eventAlbumCreated, created, nil)
+	}
+	reportProgress(ctx, len(albums), len(albums))
+
+	status := http.StatusCreated
+	if failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.IndentedJSON(status, gin.H{"created": len(albums) - failed, "failed": failed, "results": results})
+}
+
+// createFailure returns the status and error message reported for one album of a bulk request
+// that the store failed to create with err, matching what respondStoreError would send.
+func createFailure(err error) (int, string) {
+	var invalid validationError
+	var fields fieldErrors
+	var duplicate duplicateAlbumError
+	switch {
+	case errors.As(err, &invalid):
+		return http.StatusBadRequest, string(invalid)
+	case errors.As(err, &fields):
+		return http.StatusBadRequest, fields.Error()
+	case errors.Is(err, errUPCConflict):
+		return http.StatusConflict, "An album with this UPC already exists"
+	case errors.As(err, &duplicate):
+		return http.StatusConflict, "An album with this title and artist already exists: " + duplicate.ID
+	case errors.Is(err, errTenantQuotaExceeded):
+		return http.StatusTooManyRequests, "Tenant album quota exceeded"
+	case errors.Is(err, errCollectionFull):
+		return http.StatusInsufficientStorage, "Album collection is full"
+	}
+	return http.StatusInternalServerError, "Storage error: " + err.Error()
+}
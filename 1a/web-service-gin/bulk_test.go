@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestPostAlbumsBatch tests creating several albums with POST /albums/batch.
+// Verifies per-album results in request order, HTTP 201 when all succeed, HTTP 207 when some
+// fail, and that the failures do not stop the other albums.
+func TestPostAlbumsBatch(t *testing.T) {
+	srv := newTestServer(t)
+	post := func(body string) (int, []bulkResult) {
+		w := srv.do("POST", "/albums/batch", body)
+		var resp struct {
+			Results []bulkResult `json:"results"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Results
+	}
+
+	code, results := post(`[
+		{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99, "upc": "074646593622"},
+		{"title": "Giant Steps", "artist": "John Coltrane", "price": 24.99}
+	]`)
+	if code != 201 || len(results) != 2 || results[0].ID == "" || results[1].ID == "" {
+		t.Fatalf("Expected 201 with two IDs, got %d: %+v", code, results)
+	}
+
+	code, results = post(`[
+		{"title": "Mingus Ah Um", "artist": "Charles Mingus", "price": 29.99},
+		{"title": "", "artist": "Nobody", "price": 9.99},
+		{"title": "Duplicate", "artist": "Someone", "price": 9.99, "upc": "074646593622"}
+	]`)
+	var statuses []string
+	for _, r := range results {
+		statuses = append(statuses, fmt.Sprint(r.Index, ":", r.Status))
+	}
+	if code != 207 || strings.Join(statuses, ",") != "0:201,1:400,2:409" {
+		t.Errorf("Expected 207 with 201, 400, 409, got %d: %v", code, statuses)
+	}
+	if all, _ := srv.store.List(t.Context()); len(all) != 6 {
+		t.Errorf("Expected 6 albums, got %d", len(all))
+	}
+
+	for _, body := range []string{`[]`, `{"title": "Not a list"}`} {
+		if code, _ := post(body); code != 400 {
+			t.Errorf("%s: expected 400, got %d", body, code)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// swrCache caches values fetched from external providers with stale-while-revalidate semantics.
+// Entries younger than freshFor are served directly. Entries older than that, but within a further
+// staleFor window, are served immediately while a single background refresh runs; a failed refresh
+// keeps the old value. A provider outage therefore only surfaces as an error once the cached data
+// is too old to use, or for keys that were never fetched.
+// At most maxEntries keys are cached; storing another evicts the least recently used one.
+type swrCache[V any] struct {
+	freshFor   time.Duration
+	staleFor   time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// recent holds the *swrEntry of every key, most recently used first.
+	recent *list.List
+}
+
+// swrEntry is a single cached value and the time it was fetched.
+type swrEntry[V any] struct {
+	key        string
+	value      V
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+// newSWRCache creates an empty cache with the given fresh and stale windows, holding at most
+// maxEntries keys.
+func newSWRCache[V any](freshFor, staleFor time.Duration, maxEntries int) *swrCache[V] {
+	return &swrCache[V]{
+		freshFor:   freshFor,
+		staleFor:   staleFor,
+		maxEntries: max(1, maxEntries),
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+// get returns the cached value for key, calling fetch when the entry is missing or needs revalidation.
+// Stale entries trigger a background refresh and are returned without waiting for it.
+func (c *swrCache[V]) get(ctx context.Context, key string, fetch func(context.Context) (V, error)) (V, error) {
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.recent.MoveToFront(elem)
+		entry := elem.Value.(*swrEntry[V])
+		age := c.now().Sub(entry.fetchedAt)
+		if age < c.freshFor {
+			c.mu.Unlock()
+			return entry.value, nil
+		}
+		if age < c.freshFor+c.staleFor {
+			if !entry.refreshing {
+				entry.refreshing = true
+				go c.refresh(key, fetch)
+			}
+			value := entry.value
+			c.mu.Unlock()
+			return value, nil
+		}
+	}
+	c.mu.Unlock()
+
+	value, err := fetch(ctx)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	c.store(key, value)
+	return value, nil
+}
+
+// refresh re-fetches key in the background, keeping the stale value if the provider fails.
+func (c *swrCache[V]) refresh(key string, fetch func(context.Context) (V, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	value, err := fetch(ctx)
+	if err != nil {
+		c.mu.Lock()
+		if elem, ok := c.entries[key]; ok {
+			elem.Value.(*swrEntry[V]).refreshing = false
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.store(key, value)
+}
+
+// store saves value as the fresh entry for key, evicting the least recently used entries if the
+// cache is then over maxEntries.
+func (c *swrCache[V]) store(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &swrEntry[V]{key: key, value: value, fetchedAt: c.now()}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.recent.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.recent.PushFront(entry)
+	for c.recent.Len() > c.maxEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*swrEntry[V]).key)
+	}
+}
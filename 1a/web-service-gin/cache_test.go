@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSWRCache tests the stale-while-revalidate cache.
+// Verifies that fresh entries skip the fetch, stale entries are served while refreshing in the
+// background, and fetch errors fall back to stale data only within the stale window.
+func TestSWRCache(t *testing.T) {
+	now := time.Now()
+	cache := newSWRCache[string](time.Minute, time.Hour, 2)
+	cache.now = func() time.Time { return now }
+
+	var calls atomic.Int32
+	var fail atomic.Bool
+	fetch := func(context.Context) (string, error) {
+		n := calls.Add(1)
+		if fail.Load() {
+			return "", errors.New("provider down")
+		}
+		return map[int32]string{1: "v1", 2: "v2"}[n], nil
+	}
+
+	if v, err := cache.get(context.Background(), "k", fetch); err != nil || v != "v1" {
+		t.Fatalf("Expected 'v1', got '%s' (%v)", v, err)
+	}
+
+	// Fresh entry is served without fetching
+	cache.get(context.Background(), "k", fetch)
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 fetch, got %d", calls.Load())
+	}
+
+	// Stale entry is served immediately and refreshed in the background
+	now = now.Add(2 * time.Minute)
+	if v, _ := cache.get(context.Background(), "k", fetch); v != "v1" {
+		t.Errorf("Expected stale 'v1', got '%s'", v)
+	}
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if v, _ := cache.get(context.Background(), "k", fetch); v != "v2" {
+		t.Errorf("Expected refreshed 'v2', got '%s'", v)
+	}
+
+	// Provider outage beyond the stale window returns the error
+	fail.Store(true)
+	now = now.Add(2 * time.Hour)
+	if _, err := cache.get(context.Background(), "k", fetch); err == nil {
+		t.Error("Expected error once the entry is too old to serve")
+	}
+}
+
+// TestSWRCacheEviction tests that the cache holds at most its maximum number of keys, evicting the
+// least recently used one first.
+func TestSWRCacheEviction(t *testing.T) {
+	cache := newSWRCache[string](time.Minute, time.Hour, 2)
+	var calls atomic.Int32
+	fetch := func(context.Context) (string, error) {
+		calls.Add(1)
+		return "v", nil
+	}
+
+	for _, key := range []string{"a", "b", "a", "c"} {
+		cache.get(context.Background(), key, fetch)
+	}
+	if len(cache.entries) != 2 || calls.Load() != 3 {
+		t.Fatalf("Expected 2 cached keys after 3 fetches, got %d after %d", len(cache.entries), calls.Load())
+	}
+	cache.get(context.Background(), "a", fetch)
+	if calls.Load() != 3 {
+		t.Errorf("Expected the recently used key to stay cached, got %d fetches", calls.Load())
+	}
+	cache.get(context.Background(), "b", fetch)
+	if calls.Load() != 4 {
+		t.Errorf("Expected the least recently used key to be evicted, got %d fetches", calls.Load())
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// changeFeed keeps the most recent album events, numbered in the order they happened, so clients
+// can follow the changes to the catalog (see streamChanges) and pick up where they left off after
+// reconnecting, as long as the events they missed are still kept.
+type changeFeed struct {
+	size int
+
+	mu sync.Mutex
+	// records is a ring buffer of the last size events. Until it is full, events are appended in
+	// order; after that, each event overwrites the oldest one, at start.
+	records []changeRecord
+	start   int
+	// seq is the number of the last event recorded.
+	seq int64
+	// changed is closed and replaced whenever an event is recorded, waking the clients waiting for one.
+	changed chan struct{}
+}
+
+// changeRecord is an event in the change feed and its number.
+type changeRecord struct {
+	seq int64
+	evt albumEvent
+}
+
+// changeMessage is one event of the change feed as sent to clients. Created albums are sent in
+// full. Updates carry, in changes, the fields that changed with their new values (null for a field
+// that was removed), as an RFC 7396 JSON Merge Patch of the album, unless the client asked for
+// full albums. Deletions only name the album unless the client asked for full albums.
+type changeMessage struct {
+	Seq     int64          `json:"seq"`
+	Type    string         `json:"type"`
+	ID      string         `json:"id"`
+	At      time.Time      `json:"at"`
+	Album   any            `json:"album,omitempty"`
+	Changes map[string]any `json:"changes,omitempty"`
+}
+
+// newChangeFeed creates a change feed keeping the last size events.
+// Returns nil if size is not positive, which disables the feed.
+func newChangeFeed(size int) *changeFeed {
+	if size <= 0 {
+		return nil
+	}
+	return &changeFeed{size: size, records: make([]changeRecord, 0, size), changed: make(chan struct{})}
+}
+
+// handle records evt, overwriting the oldest event if the feed is full, and wakes the waiting
+// clients.
+func (f *changeFeed) handle(evt albumEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	if len(f.records) < f.size {
+		f.records = append(f.records, changeRecord{f.seq, evt})
+	} else {
+		f.records[f.start] = changeRecord{f.seq, evt}
+		f.start = (f.start + 1) % f.size
+	}
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// since returns the tenant's events numbered after seq, the number of the last event recorded, and a
+// channel closed when the next event is recorded. If events after seq have been dropped, or seq is
+// ahead of the feed, as it is after a restart, no events are returned and gap is set.
+func (f *changeFeed) since(seq int64, tenant string) (records []changeRecord, last int64, changed <-chan struct{}, gap bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Events are numbered consecutively, so the oldest event kept locates the others.
+	oldest := f.seq - int64(len(f.records)) + 1
+	if seq > f.seq || oldest > seq+1 {
+		return nil, f.seq, f.changed, true
+	}
+	for i := seq + 1 - oldest; i < int64(len(f.records)); i++ {
+		if r := f.records[(f.start+int(i))%len(f.records)]; r.evt.Tenant == tenant {
+			records = append(records, r)
+		}
+	}
+	return records, f.seq, f.changed, false
+}
+
+// last returns the number of the last event recorded.
+func (f *changeFeed) last() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq
+}
+
+// changesSince returns the tenant's events after seq as changeFeed.since does, but also reports
+// a gap, counted as a resync, if seq is more than STREAM_MAX_LAG events behind: such a client
+// catches up faster by listing the albums again than by replaying every event.
+func (srv *Server) changesSince(seq int64, tenant string) (records []changeRecord, last int64, changed <-chan struct{}, gap bool) {
+	records, last, changed, gap = srv.changes.since(seq, tenant)
+	if !gap && srv.cfg.StreamMaxLag > 0 && last-seq > int64(srv.cfg.StreamMaxLag) {
+		records, gap = nil, true
+	}
+	if gap {
+		srv.streams.resyncs.Add(1)
+	}
+	return records, last, changed, gap
+}
+
+// parseChangeQuery returns the number of the last event the client has seen, from ?since= or the
+// Last-Event-ID header, or the last event recorded if neither is given, and whether it asked for
+// full albums with ?full=true. Returns an error message if either is invalid.
+func parseChangeQuery(c *gin.Context, feed *changeFeed) (since int64, full bool, errMsg string) {
+	since = feed.last()
+	for _, value := range []string{c.Query("since"), c.GetHeader("Last-Event-ID")} {
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return 0, false, "since must be a non-negative event number"
+		}
+		since = n
+		break
+	}
+	if value := c.Query("full"); value != "" {
+		var err error
+		if full, err = strconv.ParseBool(value); err != nil {
+			return 0, false, "full must be true or false"
+		}
+	}
+	return since, full, ""
+}
+
+// changeMessageFor returns the message for r, rendering albums as for this request, with the
+// changes of an update instead of the album unless full is set.
+func changeMessageFor(c *gin.Context, r changeRecord, full bool) (changeMessage, error) {
+	msg := changeMessage{Seq: r.seq, Type: r.evt.Type, ID: r.evt.Album.ID, At: r.evt.At}
+	switch {
+	case full || r.evt.Type == eventAlbumCreated:
+		msg.Album = pipelineAlbum(c, r.evt.Album)
+	case r.evt.Type == eventAlbumUpdated && r.evt.Previous != nil:
+		previous, err := albumFields(c, *r.evt.Previous)
+		if err != nil {
+			return changeMessage{}, err
+		}
+		current, err := albumFields(c, r.evt.Album)
+		if err != nil {
+			return changeMessage{}, err
+		}
+		msg.Changes = mergePatch(previous, current)
+	}
+	return msg, nil
+}
+
+// mergePatch returns the RFC 7396 JSON Merge Patch turning the JSON object from into to: the
+// fields of to that are new or differ, and null for the fields to does not have.
+func mergePatch(from, to map[string]any) map[string]any {
+	patch := map[string]any{}
+	for name, value := range to {
+		if old, ok := from[name]; !ok || !reflect.DeepEqual(old, value) {
+			patch[name] = value
+		}
+	}
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			patch[name] = nil
+		}
+	}
+	return patch
+}
+
+// streamChanges handles GET /albums/changes requests.
+// Streams a server-sent event for every album created, updated, or deleted in the request's tenant,
+// with the event number as its ID and the type ("album.created", ...) as its name, until the client
+// disconnects. Updates carry only the changed fields, unless ?full=true asks for full albums.
+// Events after ?since= or the Last-Event-ID header are sent first, so a client can resume; if some
+// of them are no longer kept, or the client falls more than STREAM_MAX_LAG events behind, a "reset"
+// event is sent instead, after which the client should list the albums again. A heartbeat comment
+// is sent every STREAM_HEARTBEAT_INTERVAL, and the client is listed by GET /admin/subscribers while
+// connected. Returns HTTP 400 if since or full is invalid, or HTTP 404 if the feed is disabled.
+func (srv *Server) streamChanges(c *gin.Context) {
+	if srv.changes == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Change feed is disabled; set CHANGE_FEED_SIZE to enable it"})
+		return
+	}
+	since, full, errMsg := parseChangeQuery(c, srv.changes)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	client := srv.streams.connect(c, streamChanges)
+	defer srv.streams.disconnect(client)
+	client.position.Store(since)
+	heartbeats, stop := srv.heartbeatTicker()
+	defer stop()
+	ctx := c.Request.Context()
+	tenant := tenantFrom(ctx)
+	c.Stream(func(w io.Writer) bool {
+		records, last, changed, gap := srv.changesSince(since, tenant)
+		if gap {
+			client.resyncs.Add(1)
+			fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {\"seq\": %d}\n\n", last, last)
+		}
+		for _, r := range records {
+			msg, err := changeMessageFor(c, r, full)
+			if err != nil {
+				return false
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return false
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", r.seq, r.evt.Type, data)
+		}
+		since = last
+		c.Writer.Flush()
+		client.sentEvents(len(records))
+		client.position.Store(last)
+		select {
+		case <-changed:
+			return true
+		case <-heartbeats:
+			client.heartbeat(c, w)
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
+
+// Long-poll timeouts of GET /albums/changes/poll.
+const (
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 2 * time.Minute
+)
+
+// pollChanges handles GET /albums/changes/poll requests, for clients that cannot use the
+// server-sent events of GET /albums/changes.
+// Returns the tenant's changes after ?since= (as in the event stream, with ?full=true for full
+// albums) as {"changes": [...], "last": n} with HTTP 200 status, where last is the since to poll
+// with next. If there are none yet, waits until one happens or ?timeout= (default 30s, at most 2m)
+// elapses, and returns an empty list on timeout. If changes after since are no longer kept, or
+// since is more than STREAM_MAX_LAG events behind, returns at once with "reset": true, after which the client should list the albums again.
+// Returns HTTP 400 if since, full, or timeout is invalid, or HTTP 404 if the feed is disabled.
+func (srv *Server) pollChanges(c *gin.Context) {
+	if srv.changes == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Change feed is disabled; set CHANGE_FEED_SIZE to enable it"})
+		return
+	}
+	since, full, errMsg := parseChangeQuery(c, srv.changes)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	timeout := defaultPollTimeout
+	if value := c.Query("timeout"); value != "" {
+		var err error
+		if timeout, err = time.ParseDuration(value); err != nil || timeout < 0 || timeout > maxPollTimeout {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "timeout must be a duration of at most 2m, e.g. 30s"})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	tenant := tenantFrom(ctx)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		records, last, changed, gap := srv.changesSince(since, tenant)
+		if gap {
+			c.IndentedJSON(http.StatusOK, gin.H{"changes": []changeMessage{}, "last": last, "reset": true})
+			return
+		}
+		if len(records) > 0 {
+			messages := make([]changeMessage, 0, len(records))
+			for _, r := range records {
+				msg, err := changeMessageFor(c, r, full)
+				if err != nil {
+					c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to render change", "details": err.Error()})
+					return
+				}
+				messages = append(messages, msg)
+			}
+			c.IndentedJSON(http.StatusOK, gin.H{"changes": messages, "last": last})
+			return
+		}
+		// Only other tenants' albums changed; keep waiting from the latest event.
+		since = last
+		select {
+		case <-changed:
+		case <-timer.C:
+			c.IndentedJSON(http.StatusOK, gin.H{"changes": []changeMessage{}, "last": since})
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
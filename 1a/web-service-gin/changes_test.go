@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// readChanges opens the change feed at path on server and returns its first n events, each as its
+// name and data.
+func readChanges(t *testing.T, server *httptest.Server, path string, n int) [][2]string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+path, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET %s: expected 200, got %d", path, resp.StatusCode)
+	}
+
+	var events [][2]string
+	var event string
+	lines := bufio.NewScanner(resp.Body)
+	for len(events) < n && lines.Scan() {
+		if v, ok := strings.CutPrefix(lines.Text(), "event: "); ok {
+			event = v
+		}
+		if v, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+			events = append(events, [2]string{event, v})
+		}
+	}
+	return events
+}
+
+// TestChangeFeedRing tests that the change feed keeps the last CHANGE_FEED_SIZE events once its
+// ring buffer wraps around, replaying them in order and resetting clients that missed older ones.
+func TestChangeFeedRing(t *testing.T) {
+	f := newChangeFeed(3)
+	for range 5 {
+		f.handle(albumEvent{Type: eventAlbumUpdated})
+	}
+	f.handle(albumEvent{Type: eventAlbumUpdated, Tenant: "acme"})
+	if _, _, _, gap := f.since(2, ""); !gap {
+		t.Error("Expected a gap for a client that missed an overwritten event")
+	}
+	for seq, want := range map[int64][]int64{3: {4, 5}, 4: {5}, 5: nil, 6: nil} {
+		records, last, _, gap := f.since(seq, "")
+		var got []int64
+		for _, r := range records {
+			got = append(got, r.seq)
+		}
+		if gap || last != 6 || !slices.Equal(got, want) {
+			t.Errorf("since(%d): expected events %v up to 6, got %v up to %d (gap %t)", seq, want, got, last, gap)
+		}
+	}
+}
+
+// TestChangeFeed tests streaming album changes from GET /albums/changes.
+// Verifies that missed events are replayed from ?since=, that updates carry only the changed
+// fields unless ?full=true is given, and that a client that missed dropped events gets a reset.
+func TestChangeFeed(t *testing.T) {
+	srv := newTestServer(t)
+	server := httptest.NewServer(srv.router)
+	defer server.Close()
+	do := func(method, path, body string) {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	const id = "550e8400-e29b-41d4-a716-446655440002"
+	do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}`)
+	do("PATCH", "/albums/"+id, `{"price": 19.99}`)
+	do("DELETE", "/albums/"+id, "")
+
+	events := readChanges(t, server, "/albums/changes?since=0", 3)
+	var messages []changeMessage
+	for _, e := range events {
+		var msg changeMessage
+		json.Unmarshal([]byte(e[1]), &msg)
+		messages = append(messages, msg)
+	}
+	if len(messages) != 3 || events[0][0] != eventAlbumCreated || events[1][0] != eventAlbumUpdated || events[2][0] != eventAlbumDeleted {
+		t.Fatalf("Expected created, updated, and deleted events, got %v", events)
+	}
+	if messages[0].Seq != 1 || messages[0].Album == nil {
+		t.Errorf("Expected the created album in full, got %s", events[0][1])
+	}
+	if update := messages[1]; update.ID != id || update.Album != nil || update.Changes["price"] != 19.99 || update.Changes["title"] != nil || len(update.Changes) != 3 {
+		t.Errorf("Expected only the price, updated_at, and version to be sent, got %s", events[1][1])
+	}
+	if messages[2].ID != id || messages[2].Album != nil {
+		t.Errorf("Expected the deletion to only name the album, got %s", events[2][1])
+	}
+
+	full := readChanges(t, server, "/albums/changes?since=1&full=true", 1)
+	var update changeMessage
+	json.Unmarshal([]byte(full[0][1]), &update)
+	if update.Seq != 2 || update.Changes != nil || !strings.Contains(full[0][1], `"title":"Jeru"`) {
+		t.Errorf("Expected the full updated album with ?full=true, got %s", full[0][1])
+	}
+
+	for _, path := range []string{"/albums/changes?since=-1", "/albums/changes?full=maybe"} {
+		w := srv.do("GET", path, "")
+		if w.Code != 400 {
+			t.Errorf("GET %s: expected 400, got %d", path, w.Code)
+		}
+	}
+
+	small := newTestServer(t, func(cfg *Config) { cfg.ChangeFeedSize = 1 })
+	smallServer := httptest.NewServer(small.router)
+	defer smallServer.Close()
+	for _, price := range []string{"1", "2"} {
+		req, _ := http.NewRequest("PATCH", smallServer.URL+"/albums/"+id, strings.NewReader(`{"price": `+price+`}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		resp, _ := http.DefaultClient.Do(req)
+		resp.Body.Close()
+	}
+	if events := readChanges(t, smallServer, "/albums/changes?since=0", 1); events[0][0] != "reset" {
+		t.Errorf("Expected a reset after dropped events, got %v", events)
+	}
+}
+
+// TestPollChanges tests long polling GET /albums/changes/poll.
+// Verifies that changes already made are returned at once, that a poll waits for the next change
+// in its tenant and returns it, that it times out with no changes, and that invalid parameters are
+// rejected.
+func TestPollChanges(t *testing.T) {
+	srv := newTestServer(t)
+	type pollResponse struct {
+		Changes []changeMessage
+		Last    int64
+		Reset   bool
+	}
+	poll := func(path, tenant string) pollResponse {
+		w := srv.do("GET", path, "", tenantHeader, tenant)
+		if w.Code != 200 {
+			t.Fatalf("GET %s: expected 200, got %d: %s", path, w.Code, w.Body)
+		}
+		var resp pollResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440002", `{"price": 19.99}`, "If-Match", "*")
+	if resp := poll("/albums/changes/poll?since=0", ""); len(resp.Changes) != 1 || resp.Last != 1 || resp.Changes[0].Changes["price"] != 19.99 {
+		t.Errorf("Expected the update at once, got %+v", resp)
+	}
+	if resp := poll("/albums/changes/poll?timeout=10ms", ""); len(resp.Changes) != 0 || resp.Last != 1 || resp.Reset {
+		t.Errorf("Expected no changes after the timeout, got %+v", resp)
+	}
+
+	done := make(chan pollResponse)
+	go func() { done <- poll("/albums/changes/poll?since=1&timeout=5s", "") }()
+	srv.do("POST", "/albums", `{"title": "Elsewhere", "artist": "Other Tenant", "price": 9.99}`, tenantHeader, "acme")
+	srv.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}`)
+	if resp := <-done; len(resp.Changes) != 1 || resp.Changes[0].Type != eventAlbumCreated || resp.Last != 3 {
+		t.Errorf("Expected only the tenant's new album, got %+v", resp)
+	}
+	if resp := poll("/albums/changes/poll?since=9", ""); !resp.Reset || resp.Last != 3 {
+		t.Errorf("Expected a reset for events the feed does not have, got %+v", resp)
+	}
+
+	for _, path := range []string{"/albums/changes/poll?timeout=forever", "/albums/changes/poll?timeout=1h", "/albums/changes/poll?since=x"} {
+		if w := srv.do("GET", path, ""); w.Code != 400 {
+			t.Errorf("GET %s: expected 400, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+	"time"
+)
+
+// connConfig is one HTTP connection setting compared by the connreuse mode.
+type connConfig struct {
+	KeepAlive      bool `json:"keep_alive"`
+	MaxIdlePerHost int  `json:"max_idle_conns_per_host"`
+}
+
+// connResult is the outcome of a load run with one connection setting.
+type connResult struct {
+	connConfig
+	Throughput   float64 `json:"throughput_per_second"`
+	MeanMS       float64 `json:"mean_latency_ms"`
+	P99MS        float64 `json:"p99_latency_ms"`
+	ErrorPercent float64 `json:"error_percentage"`
+}
+
+// newClient creates an HTTP client for the load test. With keepAlive false every request opens a
+// new TCP connection; otherwise up to maxIdlePerHost idle connections are kept for reuse.
+func newClient(timeout time.Duration, keepAlive bool, maxIdlePerHost int) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DisableKeepAlives:   !keepAlive,
+			MaxIdleConns:        maxIdlePerHost,
+			MaxIdleConnsPerHost: maxIdlePerHost,
+		},
+	}
+}
+
+// runConnComparison runs the same load once without keep-alive and once with keep-alive for each
+// MaxIdleConnsPerHost value in idleSizes, using a fresh client each time so no connections carry over.
+func runConnComparison(baseURL string, timeout time.Duration, threads, requests int, idleSizes []int) []connResult {
+	configs := []connConfig{{KeepAlive: false}}
+	for _, n := range idleSizes {
+		configs = append(configs, connConfig{KeepAlive: true, MaxIdlePerHost: n})
+	}
+
+	var rows []connResult
+	for _, cfg := range configs {
+		client := newClient(timeout, cfg.KeepAlive, cfg.MaxIdlePerHost)
+		r := &runner{baseURL: baseURL, client: client}
+		results, wall := r.run(threads, requests)
+		client.CloseIdleConnections()
+
+		s := summarize(results, wall, threads)
+		rows = append(rows, connResult{
+			connConfig:   cfg,
+			Throughput:   s.Throughput,
+			MeanMS:       s.Latency.Mean,
+			P99MS:        s.Latency.P99,
+			ErrorPercent: s.ErrorPercent,
+		})
+	}
+	return rows
+}
+
+// printConnComparison writes the comparison as an aligned table.
+func printConnComparison(w io.Writer, rows []connResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "keep-alive\tmax idle/host\treq/s\tmean ms\tp99 ms\terrors %\t")
+	for _, r := range rows {
+		idle := "-"
+		if r.KeepAlive {
+			idle = fmt.Sprint(r.MaxIdlePerHost)
+		}
+		fmt.Fprintf(tw, "%t\t%s\t%.1f\t%.3f\t%.3f\t%.2f\t\n",
+			r.KeepAlive, idle, r.Throughput, r.MeanMS, r.P99MS, r.ErrorPercent)
+	}
+	tw.Flush()
+}
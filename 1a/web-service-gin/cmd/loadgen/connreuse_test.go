@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRunConnComparison tests the connection reuse comparison mode.
+// Verifies that one row is produced per configuration and that disabling keep-alive opens a new
+// connection per request while keep-alive reuses them.
+func TestRunConnComparison(t *testing.T) {
+	var mu sync.Mutex
+	conns := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conns[r.RemoteAddr] = true
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "a"}`))
+	}))
+	defer server.Close()
+
+	rows := runConnComparison(server.URL, time.Second, 2, 20, nil)
+	if len(rows) != 1 || rows[0].KeepAlive {
+		t.Fatalf("Expected a single keep-alive=false row, got %+v", rows)
+	}
+	if len(conns) != 20 {
+		t.Errorf("Expected 20 connections without keep-alive, got %d", len(conns))
+	}
+
+	conns = map[string]bool{}
+	rows = runConnComparison(server.URL, time.Second, 2, 20, []int{2})
+	if len(rows) != 2 || rows[1].MaxIdlePerHost != 2 {
+		t.Fatalf("Expected a keep-alive row with 2 idle connections, got %+v", rows)
+	}
+	if len(conns) > 22 {
+		t.Errorf("Expected connections to be reused, got %d", len(conns))
+	}
+}
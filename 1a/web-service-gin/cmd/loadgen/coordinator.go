@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// workerPlan tells a registered worker what to run and when to start.
+type workerPlan struct {
+	WorkerID  int    `json:"worker_id"`
+	TargetURL string `json:"target_url"`
+	Requests  int    `json:"requests"`
+	StartInMS int64  `json:"start_in_ms"`
+}
+
+// wireResult is a result as sent from a worker to the coordinator.
+type wireResult struct {
+	StartMS   int64   `json:"start_ms"`
+	Type      string  `json:"type"`
+	LatencyMS float64 `json:"latency_ms"`
+	Code      int     `json:"code"`
+}
+
+// workerReport is the set of results a worker uploads when it finishes.
+type workerReport struct {
+	WorkerID    int          `json:"worker_id"`
+	Threads     int          `json:"threads"`
+	WallSeconds float64      `json:"wall_seconds"`
+	Results     []wireResult `json:"results"`
+}
+
+// coordinator lets loadgen instances on different machines run one load test together.
+// Workers register, wait until the expected number have joined, receive an equal share of the
+// total requests and a common start time, and upload their results, which are merged into one report.
+// Start times are sent as a delay relative to the plan response, so worker clocks need not be synchronized.
+type coordinator struct {
+	targetURL  string
+	expected   int
+	requests   int
+	startDelay time.Duration
+
+	mu      sync.Mutex
+	workers []string
+	startAt time.Time
+	reports map[int]workerReport
+	done    chan struct{}
+}
+
+// newCoordinator creates a coordinator that waits for expected workers to share requests requests.
+func newCoordinator(targetURL string, expected, requests int, startDelay time.Duration) *coordinator {
+	return &coordinator{
+		targetURL:  targetURL,
+		expected:   expected,
+		requests:   requests,
+		startDelay: startDelay,
+		reports:    make(map[int]workerReport),
+		done:       make(chan struct{}),
+	}
+}
+
+// handler returns the coordinator's HTTP API:
+// POST /register joins a worker, GET /plan?worker=ID returns its plan (425 until all workers have joined),
+// and POST /results accepts a worker's report.
+func (c *coordinator) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /register", c.register)
+	mux.HandleFunc("GET /plan", c.plan)
+	mux.HandleFunc("POST /results", c.results)
+	return mux
+}
+
+// register assigns the next worker ID. Once the expected number of workers has joined, the start time is fixed.
+func (c *coordinator) register(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.workers) >= c.expected {
+		http.Error(w, "all workers already registered", http.StatusConflict)
+		return
+	}
+	c.workers = append(c.workers, r.URL.Query().Get("name"))
+	id := len(c.workers) - 1
+	if len(c.workers) == c.expected {
+		c.startAt = time.Now().Add(c.startDelay)
+	}
+	json.NewEncoder(w).Encode(map[string]int{"worker_id": id})
+}
+
+// plan returns the worker's request quota and start delay, or 425 Too Early while workers are still joining.
+func (c *coordinator) plan(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("worker"))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil || id < 0 || id >= len(c.workers) {
+		http.Error(w, "unknown worker", http.StatusNotFound)
+		return
+	}
+	if c.startAt.IsZero() {
+		w.WriteHeader(http.StatusTooEarly)
+		return
+	}
+
+	quota := c.requests / c.expected
+	if id < c.requests%c.expected {
+		quota++
+	}
+	json.NewEncoder(w).Encode(workerPlan{
+		WorkerID:  id,
+		TargetURL: c.targetURL,
+		Requests:  quota,
+		StartInMS: max(0, time.Until(c.startAt).Milliseconds()),
+	})
+}
+
+// results stores a worker's report and signals completion once every worker has reported.
+func (c *coordinator) results(w http.ResponseWriter, r *http.Request) {
+	var report workerReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, dup := c.reports[report.WorkerID]; dup {
+		http.Error(w, "results already received", http.StatusConflict)
+		return
+	}
+	c.reports[report.WorkerID] = report
+	if len(c.reports) == c.expected {
+		close(c.done)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// wait blocks until every worker has reported, then returns the merged results and the total
+// number of threads across workers. The wall time is the longest worker wall time, since all
+// workers started together.
+func (c *coordinator) wait() ([]result, time.Duration, int) {
+	<-c.done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var merged []result
+	var wall float64
+	var threads int
+	for _, report := range c.reports {
+		wall = max(wall, report.WallSeconds)
+		threads += report.Threads
+		for _, wr := range report.Results {
+			merged = append(merged, result{
+				Start:   time.UnixMilli(wr.StartMS),
+				Type:    wr.Type,
+				Latency: time.Duration(wr.LatencyMS * float64(time.Millisecond)),
+				Code:    wr.Code,
+			})
+		}
+	}
+	return merged, time.Duration(wall * float64(time.Second)), threads
+}
+
+// runWorker registers with the coordinator, waits for the plan, runs its share of the load with
+// threads goroutines at the agreed start time, and uploads the results.
+func runWorker(coordinatorURL, name string, threads int, client *http.Client) error {
+	resp, err := client.Post(coordinatorURL+"/register?name="+name, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	var reg struct {
+		WorkerID int `json:"worker_id"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&reg)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("register: %w", err)
+	}
+
+	var plan workerPlan
+	for {
+		resp, err := client.Get(fmt.Sprintf("%s/plan?worker=%d", coordinatorURL, reg.WorkerID))
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooEarly {
+			resp.Body.Close()
+			time.Sleep(200 * time.Millisecond)
+			continue
+		}
+		err = json.NewDecoder(resp.Body).Decode(&plan)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("plan: %w", err)
+		}
+		break
+	}
+
+	time.Sleep(time.Duration(plan.StartInMS) * time.Millisecond)
+	r := &runner{baseURL: plan.TargetURL, client: client}
+	results, wall := r.run(threads, plan.Requests)
+
+	report := workerReport{WorkerID: reg.WorkerID, Threads: threads, WallSeconds: wall.Seconds()}
+	for _, res := range results {
+		report.Results = append(report.Results, wireResult{
+			StartMS:   res.Start.UnixMilli(),
+			Type:      res.Type,
+			LatencyMS: ms(res.Latency),
+			Code:      res.Code,
+		})
+	}
+	body, _ := json.Marshal(report)
+	resp, err = client.Post(coordinatorURL+"/results", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("upload results: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCoordinator tests distributed load generation with two workers.
+// Verifies that the requests are split between the workers and the merged report contains all results.
+func TestCoordinator(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "a"}`))
+	}))
+	defer target.Close()
+
+	coord := newCoordinator(target.URL, 2, 101, 10*time.Millisecond)
+	server := httptest.NewServer(coord.handler())
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := runWorker(server.URL, name, 2, server.Client()); err != nil {
+				t.Errorf("worker %s: %v", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	results, wall, threads := coord.wait()
+	if len(results) != 101 {
+		t.Errorf("Expected 101 merged results, got %d", len(results))
+	}
+	if threads != 4 {
+		t.Errorf("Expected 4 threads across workers, got %d", threads)
+	}
+	if wall <= 0 {
+		t.Error("Wall time should be positive")
+	}
+	if len(coord.reports[0].Results)+len(coord.reports[1].Results) != 101 {
+		t.Error("Each worker should report its own share")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// littlesStep compares predicted and observed throughput at one thread count.
+type littlesStep struct {
+	Threads             int     `json:"threads"`
+	PredictedThroughput float64 `json:"predicted_throughput"`
+	ObservedThroughput  float64 `json:"observed_throughput"`
+	ObservedLatencyMS   float64 `json:"observed_mean_latency_ms"`
+	Ratio               float64 `json:"observed_to_predicted"`
+}
+
+// littlesReport is the result of a Little's Law validation run.
+type littlesReport struct {
+	BaselineLatencyMS float64       `json:"baseline_mean_latency_ms"`
+	Steps             []littlesStep `json:"steps"`
+}
+
+// runLittles measures the mean response time W with a single thread, then for each thread count N
+// predicts the maximum throughput as N / W (Little's Law, L = λW, with L = N outstanding requests)
+// and compares it with the throughput observed when actually running N threads.
+// Observed throughput falling below the prediction shows where the server starts queueing.
+func runLittles(r *runner, probeRequests, requests int, steps []int) littlesReport {
+	probe, wall := r.run(1, probeRequests)
+	baseline := summarize(probe, wall, 1)
+	report := littlesReport{BaselineLatencyMS: baseline.Latency.Mean}
+
+	for _, n := range steps {
+		results, wall := r.run(n, requests)
+		s := summarize(results, wall, n)
+
+		step := littlesStep{
+			Threads:            n,
+			ObservedThroughput: s.Throughput,
+			ObservedLatencyMS:  s.Latency.Mean,
+		}
+		if baseline.Latency.Mean > 0 {
+			step.PredictedThroughput = float64(n) / (baseline.Latency.Mean / 1000)
+			step.Ratio = step.ObservedThroughput / step.PredictedThroughput
+		}
+		report.Steps = append(report.Steps, step)
+	}
+	return report
+}
+
+// printLittles writes the report as an aligned table.
+func printLittles(w io.Writer, report littlesReport) {
+	fmt.Fprintf(w, "Baseline mean response time (1 thread): %.3f ms\n", report.BaselineLatencyMS)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "threads\tpredicted req/s\tobserved req/s\tobserved/predicted\tmean latency ms\t")
+	for _, s := range report.Steps {
+		fmt.Fprintf(tw, "%d\t%.1f\t%.1f\t%.2f\t%.3f\t\n",
+			s.Threads, s.PredictedThroughput, s.ObservedThroughput, s.Ratio, s.ObservedLatencyMS)
+	}
+	tw.Flush()
+}
+
+// parseInts parses a comma-separated list of positive integers such as "1,2,4,8".
+func parseInts(list string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid value %q: must be a positive integer", field)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
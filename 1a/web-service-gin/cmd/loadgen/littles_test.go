@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRunLittles tests the Little's Law validation mode against a server with a fixed service time.
+// Verifies that the predicted throughput is N / W and observed throughput tracks it while the server
+// can serve requests in parallel.
+func TestRunLittles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "a"}`))
+	}))
+	defer server.Close()
+
+	r := &runner{baseURL: server.URL, client: server.Client()}
+	report := runLittles(r, 10, 40, []int{1, 4})
+
+	if report.BaselineLatencyMS < 5 {
+		t.Errorf("Expected baseline latency of at least 5 ms, got %f", report.BaselineLatencyMS)
+	}
+	if len(report.Steps) != 2 {
+		t.Fatalf("Expected 2 steps, got %d", len(report.Steps))
+	}
+	step := report.Steps[1]
+	expected := 4 / (report.BaselineLatencyMS / 1000)
+	if step.PredictedThroughput != expected {
+		t.Errorf("Expected predicted throughput %f, got %f", expected, step.PredictedThroughput)
+	}
+	if step.Ratio < 0.5 {
+		t.Errorf("Expected observed throughput close to prediction, got ratio %f", step.Ratio)
+	}
+}
@@ -0,0 +1,190 @@
+// Command loadgen is a load generator for the album API.
+// It runs concurrent client goroutines against the server and records the start time,
+// request type, latency, and response code of every request. Results are written as a CSV
+// for the course plotting scripts, with a JSON summary of throughput and error percentage.
+//
+// With -mode littles it instead validates Little's Law: it measures the mean response time
+// with one thread, predicts the throughput of each thread count in -steps, and reports the
+// predicted and observed throughput side by side.
+//
+// With -mode connreuse it runs the same load with HTTP keep-alive disabled and then enabled
+// with each MaxIdleConnsPerHost value in -idle-sizes, and prints a latency/throughput table.
+//
+// With -scenario, clients follow a workload definition (operation mix, Zipfian or uniform
+// album selection, think time) instead of alternating creates and reads; see scenario.
+//
+// With -warmup, requests are only recorded once latency has reached a steady state; the
+// excluded warm-up period is noted in the summary.
+//
+// With -mode sweep it runs for -duration at each thread count in -sweep-steps and writes a
+// throughput-vs-threads curve to -sweep-csv.
+//
+// For distributed runs, start one instance with -mode coordinator and one -mode worker instance
+// per machine. The coordinator splits -requests among -workers, starts them together, and merges
+// their results into the usual CSV and summary.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+)
+
+// main parses flags, runs the selected mode, and writes the reports.
+func main() {
+	mode := flag.String("mode", "run", "run: single load test; littles: Little's Law validation; connreuse: keep-alive comparison; sweep: thread-count sweep; coordinator/worker: distributed run")
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the album API")
+	threads := flag.Int("threads", 10, "number of concurrent client goroutines")
+	requests := flag.Int("requests", 1000, "total number of requests to send")
+	csvPath := flag.String("csv", "results.csv", "path of the per-request results CSV (empty to skip)")
+	summaryPath := flag.String("summary", "summary.json", "path of the summary JSON (empty to skip)")
+	timeout := flag.Duration("timeout", 10*time.Second, "per-request timeout")
+	probeRequests := flag.Int("probe-requests", 500, "littles mode: requests sent with one thread to measure response time")
+	stepList := flag.String("steps", "1,2,4,8,16,32,64", "littles mode: comma-separated thread counts to test")
+	keepAlive := flag.Bool("keepalive", true, "reuse connections with HTTP keep-alive")
+	maxIdle := flag.Int("max-idle-per-host", 0, "maximum idle connections kept per host (default: -threads)")
+	idleList := flag.String("idle-sizes", "1,2,8,32", "connreuse mode: comma-separated MaxIdleConnsPerHost values to compare")
+	listen := flag.String("listen", ":9090", "coordinator mode: address to accept workers on")
+	workers := flag.Int("workers", 2, "coordinator mode: number of workers to wait for")
+	startDelay := flag.Duration("start-delay", 3*time.Second, "coordinator mode: delay between the last registration and the synchronized start")
+	coordinatorURL := flag.String("coordinator", "http://localhost:9090", "worker mode: coordinator URL")
+	sweepList := flag.String("sweep-steps", "8,16,32,64,128,256,512", "sweep mode: comma-separated thread counts")
+	duration := flag.Duration("duration", 30*time.Second, "sweep mode: how long to run each thread count")
+	sweepCSV := flag.String("sweep-csv", "sweep.csv", "sweep mode: path of the throughput-vs-threads CSV")
+	warmup := flag.Bool("warmup", false, "exclude requests until latency reaches a steady state")
+	warmupWindow := flag.Int("warmup-window", 100, "warm-up: latency samples per window")
+	warmupCV := flag.Float64("warmup-cv", 0.1, "warm-up: maximum coefficient of variation of the last window means")
+	warmupMax := flag.Duration("warmup-max", time.Minute, "warm-up: start recording after this long even if not steady")
+	scenarioPath := flag.String("scenario", "", "path of a workload scenario JSON file (operation mix, ID distribution, think time)")
+	flag.Parse()
+
+	steps, err := parseInts(*stepList)
+	if err != nil {
+		log.Fatalf("Invalid -steps: %v", err)
+	}
+	sweepSteps, err := parseInts(*sweepList)
+	if err != nil {
+		log.Fatalf("Invalid -sweep-steps: %v", err)
+	}
+
+	// Size the idle pool for the largest thread count any mode will use.
+	poolSize := *threads
+	for _, n := range slices.Concat(steps, sweepSteps) {
+		poolSize = max(poolSize, n)
+	}
+
+	if *maxIdle > 0 {
+		poolSize = *maxIdle
+	}
+	r := &runner{baseURL: *baseURL, client: newClient(*timeout, *keepAlive, poolSize)}
+	if *warmup {
+		r.steady = newSteadyDetector(*warmupWindow, *warmupCV, *warmupMax)
+	}
+	if *scenarioPath != "" {
+		sc, err := loadScenario(*scenarioPath)
+		if err != nil {
+			log.Fatalf("Invalid scenario: %v", err)
+		}
+		r.scenario = sc
+		if err := r.seedPool(); err != nil {
+			log.Fatalf("Failed to load existing albums: %v", err)
+		}
+		log.Printf("Using scenario %q with mix %v and %s ID selection", sc.Name, sc.Mix, sc.IDDistribution)
+	}
+
+	if *mode == "littles" {
+		log.Printf("Validating Little's Law against %s with thread counts %v", *baseURL, steps)
+		report := runLittles(r, *probeRequests, *requests, steps)
+		printLittles(os.Stdout, report)
+		if *summaryPath != "" {
+			if err := writeSummaryJSON(*summaryPath, report); err != nil {
+				log.Fatalf("Failed to write summary: %v", err)
+			}
+		}
+		return
+	}
+
+	if *mode == "sweep" {
+		log.Printf("Sweeping thread counts %v against %s, %v each", sweepSteps, *baseURL, *duration)
+		points := runSweep(r, sweepSteps, *duration)
+		printSweep(os.Stdout, points)
+		if err := writeSweepCSV(*sweepCSV, points); err != nil {
+			log.Fatalf("Failed to write sweep CSV: %v", err)
+		}
+		if *summaryPath != "" {
+			if err := writeSummaryJSON(*summaryPath, points); err != nil {
+				log.Fatalf("Failed to write summary: %v", err)
+			}
+		}
+		return
+	}
+
+	if *mode == "connreuse" {
+		idleSizes, err := parseInts(*idleList)
+		if err != nil {
+			log.Fatalf("Invalid -idle-sizes: %v", err)
+		}
+		log.Printf("Comparing connection reuse against %s with %d threads", *baseURL, *threads)
+		rows := runConnComparison(*baseURL, *timeout, *threads, *requests, idleSizes)
+		printConnComparison(os.Stdout, rows)
+		if *summaryPath != "" {
+			if err := writeSummaryJSON(*summaryPath, rows); err != nil {
+				log.Fatalf("Failed to write summary: %v", err)
+			}
+		}
+		return
+	}
+
+	var (
+		results []result
+		wall    time.Duration
+	)
+	switch *mode {
+	case "worker":
+		name, _ := os.Hostname()
+		log.Printf("Registering with coordinator %s", *coordinatorURL)
+		if err := runWorker(*coordinatorURL, name, *threads, r.client); err != nil {
+			log.Fatalf("Worker failed: %v", err)
+		}
+		log.Println("Results uploaded to coordinator")
+		return
+	case "coordinator":
+		coord := newCoordinator(*baseURL, *workers, *requests, *startDelay)
+		server := &http.Server{Addr: *listen, Handler: coord.handler()}
+		go func() {
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatalf("Coordinator failed: %v", err)
+			}
+		}()
+		log.Printf("Coordinator listening on %s, waiting for %d workers", *listen, *workers)
+		results, wall, *threads = coord.wait()
+		server.Close()
+	default:
+		log.Printf("Sending %d requests to %s with %d threads", *requests, *baseURL, *threads)
+		results, wall = r.run(*threads, *requests)
+	}
+	s := summarize(results, wall, *threads)
+	if r.steady != nil {
+		s.Warmup = r.steady.info()
+		log.Printf("Excluded %d warm-up requests (%.1fs)", s.Warmup.Requests, s.Warmup.Seconds)
+	}
+
+	if *csvPath != "" {
+		if err := writeResultsCSV(*csvPath, results); err != nil {
+			log.Fatalf("Failed to write results CSV: %v", err)
+		}
+		log.Printf("Wrote %d results to %s", len(results), *csvPath)
+	}
+	if *summaryPath != "" {
+		if err := writeSummaryJSON(*summaryPath, s); err != nil {
+			log.Fatalf("Failed to write summary: %v", err)
+		}
+		log.Printf("Wrote summary to %s", *summaryPath)
+	}
+
+	log.Printf("Throughput: %.1f req/s, errors: %.2f%%, mean latency: %.2f ms, p99: %.2f ms",
+		s.Throughput, s.ErrorPercent, s.Latency.Mean, s.Latency.P99)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// latencyStats summarizes request latencies in milliseconds.
+type latencyStats struct {
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	P99    float64 `json:"p99"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// summary is the JSON report written alongside the results CSV.
+type summary struct {
+	Threads      int          `json:"threads"`
+	Requests     int          `json:"total_requests"`
+	Successful   int          `json:"successful_requests"`
+	Failed       int          `json:"failed_requests"`
+	WallSeconds  float64      `json:"wall_time_seconds"`
+	Throughput   float64      `json:"throughput_per_second"`
+	ErrorPercent float64      `json:"error_percentage"`
+	Latency      latencyStats `json:"latency_ms"`
+	Warmup       *warmupInfo  `json:"warmup,omitempty"`
+}
+
+// summarize computes throughput, error percentage, and latency statistics for a run.
+// A request is successful if it received a response with a status below 400.
+func summarize(results []result, wall time.Duration, threads int) summary {
+	s := summary{Threads: threads, Requests: len(results), WallSeconds: wall.Seconds()}
+	if len(results) == 0 {
+		return s
+	}
+
+	latencies := make([]float64, len(results))
+	var total float64
+	for i, r := range results {
+		if r.Code != 0 && r.Code < 400 {
+			s.Successful++
+		}
+		latencies[i] = ms(r.Latency)
+		total += latencies[i]
+	}
+	s.Failed = s.Requests - s.Successful
+	s.ErrorPercent = float64(s.Failed) * 100 / float64(s.Requests)
+	if wall > 0 {
+		s.Throughput = float64(s.Requests) / wall.Seconds()
+	}
+
+	sort.Float64s(latencies)
+	s.Latency = latencyStats{
+		Mean:   total / float64(len(latencies)),
+		Median: percentile(latencies, 50),
+		P99:    percentile(latencies, 99),
+		Min:    latencies[0],
+		Max:    latencies[len(latencies)-1],
+	}
+	return s
+}
+
+// percentile returns the p-th percentile of sorted values using the nearest-rank method.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	return sorted[max(0, min(rank, len(sorted)-1))]
+}
+
+// ms converts a duration to fractional milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// writeResultsCSV writes one row per request with the columns
+// start_time (Unix milliseconds), request_type, latency (milliseconds), and response_code.
+// Rows are ordered by start time.
+func writeResultsCSV(path string, results []result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sorted := append([]result(nil), results...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"start_time", "request_type", "latency", "response_code"})
+	for _, r := range sorted {
+		w.Write([]string{
+			strconv.FormatInt(r.Start.UnixMilli(), 10),
+			r.Type,
+			strconv.FormatFloat(ms(r.Latency), 'f', 3, 64),
+			strconv.Itoa(r.Code),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeSummaryJSON writes s as indented JSON to path.
+func writeSummaryJSON(path string, s any) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSummarize tests the run summary.
+// Verifies throughput, error percentage, and latency percentiles for a known set of results.
+func TestSummarize(t *testing.T) {
+	var results []result
+	for i := 1; i <= 100; i++ {
+		code := 201
+		if i%10 == 0 {
+			code = 500
+		}
+		results = append(results, result{Type: "POST", Latency: time.Duration(i) * time.Millisecond, Code: code})
+	}
+
+	s := summarize(results, 2*time.Second, 4)
+
+	if s.Throughput != 50 {
+		t.Errorf("Expected throughput 50, got %f", s.Throughput)
+	}
+	if s.ErrorPercent != 10 {
+		t.Errorf("Expected 10%% errors, got %f", s.ErrorPercent)
+	}
+	if s.Latency.Median != 50 || s.Latency.P99 != 99 || s.Latency.Max != 100 {
+		t.Errorf("Unexpected latency stats: %+v", s.Latency)
+	}
+}
+
+// TestWriteResultsCSV tests the results CSV format.
+// Verifies the header and that rows are written in start-time order.
+func TestWriteResultsCSV(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	results := []result{
+		{Start: now.Add(time.Second), Type: "GET", Latency: 2 * time.Millisecond, Code: 200},
+		{Start: now, Type: "POST", Latency: 5 * time.Millisecond, Code: 201},
+	}
+
+	path := filepath.Join(t.TempDir(), "results.csv")
+	if err := writeResultsCSV(path, results); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+
+	expected := "start_time,request_type,latency,response_code\n" +
+		"1700000000000,POST,5.000,201\n" +
+		"1700000001000,GET,2.000,200\n"
+	if string(data) != expected {
+		t.Errorf("Unexpected CSV:\n%s", data)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// result is the outcome of a single request. Code is 0 if the request failed before a response arrived.
+type result struct {
+	Start   time.Time
+	Type    string
+	Latency time.Duration
+	Code    int
+}
+
+// runner sends requests to the album API.
+// Without a scenario, each client alternates between creating an album and fetching it.
+// With a scenario, clients follow its operation mix, ID distribution, and think time,
+// targeting albums from a pool shared by all clients.
+//
+// With a steady-state detector, requests made during warm-up are not recorded and do not count
+// toward the requested total; the wall time is measured from the moment the run became steady.
+type runner struct {
+	baseURL  string
+	client   *http.Client
+	scenario *scenario
+	pool     idPool
+	steady   *steadyDetector
+}
+
+// seedPool adds the IDs of all existing albums to the shared pool, so a scenario's reads and
+// updates have targets before its first create completes.
+func (r *runner) seedPool() error {
+	resp, err := r.client.Get(r.baseURL + "/albums")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("list albums: %s", resp.Status)
+	}
+	var albums []struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&albums); err != nil {
+		return err
+	}
+	for _, a := range albums {
+		r.pool.add(a.ID)
+	}
+	return nil
+}
+
+// run sends requests requests split across threads goroutines.
+// Returns every result and the wall-clock duration of the run.
+func (r *runner) run(threads, requests int) ([]result, time.Duration) {
+	return r.execute(threads, func(t int) int {
+		n := requests / threads
+		if t < requests%threads {
+			n++
+		}
+		return n
+	}, time.Time{})
+}
+
+// runFor sends requests from threads goroutines until duration has elapsed.
+// Returns every result and the wall-clock duration of the run.
+func (r *runner) runFor(threads int, duration time.Duration) ([]result, time.Duration) {
+	return r.execute(threads, func(int) int { return math.MaxInt }, time.Now().Add(duration))
+}
+
+// execute runs threads goroutines; goroutine t records quota(t) results or stops at deadline, if set.
+func (r *runner) execute(threads int, quota func(t int) int, deadline time.Time) ([]result, time.Duration) {
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		all []result
+	)
+	more := func(recorded, n int) bool {
+		return recorded < n && (deadline.IsZero() || time.Now().Before(deadline))
+	}
+
+	start := time.Now()
+	for t := 0; t < threads; t++ {
+		n := quota(t)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var local []result
+			if r.scenario != nil {
+				rng := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+				for i := 0; more(len(local), n); i++ {
+					if i > 0 {
+						time.Sleep(r.scenario.think(rng))
+					}
+					local = r.record(local, r.scenarioRequest(rng))
+				}
+			} else {
+				var lastID string
+				for i := 0; more(len(local), n); i++ {
+					var res result
+					if lastID == "" || i%2 == 0 {
+						res, lastID = r.post(lastID)
+					} else {
+						res = r.get(lastID)
+					}
+					local = r.record(local, res)
+				}
+			}
+			mu.Lock()
+			all = append(all, local...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if r.steady != nil {
+		if since := r.steady.steadySince(); !since.IsZero() {
+			start = since
+		}
+	}
+	return all, time.Since(start)
+}
+
+// record appends res to local unless the run is still warming up.
+func (r *runner) record(local []result, res result) []result {
+	if r.steady != nil && !r.steady.observe(res.Latency) {
+		return local
+	}
+	return append(local, res)
+}
+
+// scenarioRequest sends one request chosen by the scenario. Operations that need an existing album
+// fall back to creating one while the pool is empty.
+func (r *runner) scenarioRequest(rng *rand.Rand) result {
+	op := r.scenario.pickOp(rng)
+	id := r.pool.pick(r.scenario, rng)
+	if id == "" {
+		op = "POST"
+	}
+
+	switch op {
+	case "GET":
+		return r.get(id)
+	case "PATCH":
+		return r.patch(id, rng)
+	case "DELETE":
+		res := r.delete(id)
+		if res.Code == http.StatusOK || res.Code == http.StatusNotFound {
+			r.pool.remove(id)
+		}
+		return res
+	default:
+		res, newID := r.post("")
+		if newID != "" {
+			r.pool.add(newID)
+		}
+		return res
+	}
+}
+
+// post creates an album. Returns the result and the new album's ID, or fallbackID if creation failed.
+// Every album has the same title and artist, so the server is told to allow duplicates.
+func (r *runner) post(fallbackID string) (result, string) {
+	body, _ := json.Marshal(map[string]any{"title": "Load Test Album", "artist": "Loadgen", "price": 9.99})
+	req, _ := http.NewRequest(http.MethodPost, r.baseURL+"/albums?allow_duplicate=true", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	res, respBody := r.do("POST", req)
+	var created struct {
+		ID string `json:"id"`
+	}
+	if res.Code == http.StatusCreated && json.Unmarshal(respBody, &created) == nil && created.ID != "" {
+		return res, created.ID
+	}
+	return res, fallbackID
+}
+
+// get fetches the album with the given ID.
+func (r *runner) get(id string) result {
+	req, _ := http.NewRequest(http.MethodGet, r.baseURL+"/albums/"+id, nil)
+	res, _ := r.do("GET", req)
+	return res
+}
+
+// do sends req and measures its latency, including reading the full response body.
+func (r *runner) do(kind string, req *http.Request) (result, []byte) {
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return result{Start: start, Type: kind, Latency: time.Since(start)}, nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return result{Start: start, Type: kind, Latency: time.Since(start), Code: resp.StatusCode}, body
+}
+
+// patch updates the price of the album with the given ID. The runner does not track album
+// versions, so it sends If-Match: *, which the server requires but which matches any version.
+func (r *runner) patch(id string, rng *rand.Rand) result {
+	body, _ := json.Marshal(map[string]any{"price": float64(100+rng.IntN(9900)) / 100})
+	req, _ := http.NewRequest(http.MethodPatch, r.baseURL+"/albums/"+id, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", "*")
+	res, _ := r.do("PATCH", req)
+	return res
+}
+
+// delete deletes the album with the given ID, whatever its version (see patch).
+func (r *runner) delete(id string) result {
+	req, _ := http.NewRequest(http.MethodDelete, r.baseURL+"/albums/"+id, nil)
+	req.Header.Set("If-Match", "*")
+	res, _ := r.do("DELETE", req)
+	return res
+}
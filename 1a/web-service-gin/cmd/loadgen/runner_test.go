@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestRunScenario tests a scenario-driven run against a fake album API.
+// Verifies that the requested number of requests is sent, existing albums are used as targets,
+// and the operation mix is followed.
+func TestRunScenario(t *testing.T) {
+	var created atomic.Int32
+	var mu sync.Mutex
+	methods := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods[r.Method]++
+		mu.Unlock()
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/albums":
+			w.Write([]byte(`[{"id": "seed-1"}, {"id": "seed-2"}]`))
+		case r.Method == "POST":
+			created.Add(1)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": "new"}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	s := &scenario{Mix: map[string]int{"GET": 3, "PATCH": 1}}
+	if err := s.init(); err != nil {
+		t.Fatal(err)
+	}
+	r := &runner{baseURL: server.URL, client: server.Client(), scenario: s}
+	if err := r.seedPool(); err != nil {
+		t.Fatal(err)
+	}
+
+	results, _ := r.run(4, 400)
+	if len(results) != 400 {
+		t.Errorf("Expected 400 results, got %d", len(results))
+	}
+	if created.Load() != 0 {
+		t.Errorf("Expected no creates with a seeded pool, got %d", created.Load())
+	}
+	if methods["PATCH"] < 50 || methods["PATCH"] > 150 {
+		t.Errorf("Expected about 100 PATCH requests, got %d", methods["PATCH"])
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// steadyWindows is how many consecutive window means must agree before the run counts as steady.
+const steadyWindows = 3
+
+// warmupInfo annotates a report with the warm-up period that was excluded from its measurements.
+type warmupInfo struct {
+	Seconds  float64 `json:"duration_seconds"`
+	Requests int     `json:"requests_excluded"`
+	TimedOut bool    `json:"timed_out"`
+}
+
+// steadyDetector decides when a run has warmed up (connection pools filled, caches and the
+// Go runtime settled). Latencies are grouped into windows of window samples; once the means of
+// the last steadyWindows windows have a coefficient of variation at or below threshold, the run
+// is steady and later requests are recorded. If that never happens within maxWarmup, recording
+// starts anyway and the report says the warm-up timed out.
+type steadyDetector struct {
+	window    int
+	threshold float64
+	maxWarmup time.Duration
+
+	mu       sync.Mutex
+	start    time.Time
+	samples  []float64
+	means    []float64
+	steadyAt time.Time
+	excluded int
+	timedOut bool
+}
+
+// newSteadyDetector creates a detector with the given window size, variation threshold, and warm-up cap.
+func newSteadyDetector(window int, threshold float64, maxWarmup time.Duration) *steadyDetector {
+	return &steadyDetector{window: window, threshold: threshold, maxWarmup: maxWarmup}
+}
+
+// observe records a warm-up latency sample and reports whether the run is steady, i.e. whether
+// the request that produced it should be recorded.
+func (d *steadyDetector) observe(latency time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.steadyAt.IsZero() {
+		return true
+	}
+	now := time.Now()
+	if d.start.IsZero() {
+		d.start = now
+	}
+	d.excluded++
+
+	if d.maxWarmup > 0 && now.Sub(d.start) >= d.maxWarmup {
+		d.steadyAt, d.timedOut = now, true
+		return false
+	}
+
+	d.samples = append(d.samples, ms(latency))
+	if len(d.samples) < d.window {
+		return false
+	}
+	d.means = append(d.means, mean(d.samples))
+	d.samples = d.samples[:0]
+	if len(d.means) > steadyWindows {
+		d.means = d.means[1:]
+	}
+	if len(d.means) == steadyWindows && coefficientOfVariation(d.means) <= d.threshold {
+		d.steadyAt = now
+	}
+	return false
+}
+
+// steadySince returns when the run became steady, or the zero time if it has not yet.
+func (d *steadyDetector) steadySince() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.steadyAt
+}
+
+// info returns the warm-up annotation for the report.
+func (d *steadyDetector) info() *warmupInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	end := d.steadyAt
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return &warmupInfo{Seconds: end.Sub(d.start).Seconds(), Requests: d.excluded, TimedOut: d.timedOut}
+}
+
+// mean returns the arithmetic mean of values.
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// coefficientOfVariation returns the standard deviation of values divided by their mean.
+func coefficientOfVariation(values []float64) float64 {
+	m := mean(values)
+	if m == 0 {
+		return 0
+	}
+	var sq float64
+	for _, v := range values {
+		sq += (v - m) * (v - m)
+	}
+	return math.Sqrt(sq/float64(len(values))) / m
+}
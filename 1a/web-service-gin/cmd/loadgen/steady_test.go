@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSteadyDetector tests warm-up detection.
+// Verifies that samples are excluded while latency is still falling and the run becomes steady
+// once consecutive window means agree.
+func TestSteadyDetector(t *testing.T) {
+	d := newSteadyDetector(10, 0.05, time.Minute)
+
+	// Latency halves every window during warm-up
+	for _, latency := range []time.Duration{80, 40, 20} {
+		for i := 0; i < 10; i++ {
+			if d.observe(latency * time.Millisecond) {
+				t.Fatal("Should not be steady during warm-up")
+			}
+		}
+	}
+	for i := 0; i < 30; i++ {
+		d.observe(5 * time.Millisecond)
+	}
+	if !d.observe(5 * time.Millisecond) {
+		t.Fatal("Should be steady after three stable windows")
+	}
+
+	info := d.info()
+	if info.Requests != 60 || info.TimedOut {
+		t.Errorf("Expected 60 excluded requests without timeout, got %+v", info)
+	}
+}
+
+// TestSteadyDetectorTimeout tests the warm-up cap.
+// Verifies that recording starts once the maximum warm-up duration has elapsed, and the report says so.
+func TestSteadyDetectorTimeout(t *testing.T) {
+	d := newSteadyDetector(10, 0.01, time.Millisecond)
+	d.observe(time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	d.observe(time.Millisecond)
+
+	if !d.observe(time.Millisecond) {
+		t.Error("Should record once the warm-up cap is reached")
+	}
+	if !d.info().TimedOut {
+		t.Error("Warm-up should be reported as timed out")
+	}
+}
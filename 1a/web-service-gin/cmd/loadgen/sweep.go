@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// sweepPoint is the measured performance at one client thread count.
+type sweepPoint struct {
+	Threads      int     `json:"threads"`
+	Requests     int     `json:"requests"`
+	Throughput   float64 `json:"throughput_per_second"`
+	MeanMS       float64 `json:"mean_latency_ms"`
+	P99MS        float64 `json:"p99_latency_ms"`
+	ErrorPercent float64 `json:"error_percentage"`
+}
+
+// runSweep runs the load for duration at each thread count in steps, producing the points of a
+// throughput-vs-threads curve.
+func runSweep(r *runner, steps []int, duration time.Duration) []sweepPoint {
+	var points []sweepPoint
+	for _, n := range steps {
+		results, wall := r.runFor(n, duration)
+		s := summarize(results, wall, n)
+		points = append(points, sweepPoint{
+			Threads:      n,
+			Requests:     s.Requests,
+			Throughput:   s.Throughput,
+			MeanMS:       s.Latency.Mean,
+			P99MS:        s.Latency.P99,
+			ErrorPercent: s.ErrorPercent,
+		})
+	}
+	return points
+}
+
+// printSweep writes the sweep as an aligned table.
+func printSweep(w io.Writer, points []sweepPoint) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "threads\trequests\treq/s\tmean ms\tp99 ms\terrors %\t")
+	for _, p := range points {
+		fmt.Fprintf(tw, "%d\t%d\t%.1f\t%.3f\t%.3f\t%.2f\t\n",
+			p.Threads, p.Requests, p.Throughput, p.MeanMS, p.P99MS, p.ErrorPercent)
+	}
+	tw.Flush()
+}
+
+// writeSweepCSV writes the curve with the columns threads, throughput, mean_latency_ms,
+// p99_latency_ms, and error_percentage, ready for plotting.
+func writeSweepCSV(path string, points []sweepPoint) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"threads", "throughput", "mean_latency_ms", "p99_latency_ms", "error_percentage"})
+	for _, p := range points {
+		w.Write([]string{
+			strconv.Itoa(p.Threads),
+			strconv.FormatFloat(p.Throughput, 'f', 2, 64),
+			strconv.FormatFloat(p.MeanMS, 'f', 3, 64),
+			strconv.FormatFloat(p.P99MS, 'f', 3, 64),
+			strconv.FormatFloat(p.ErrorPercent, 'f', 2, 64),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunSweep tests the thread-count sweep.
+// Verifies that each step runs for the fixed duration, produces one point per thread count,
+// and that the curve is written as CSV.
+func TestRunSweep(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "a"}`))
+	}))
+	defer server.Close()
+
+	r := &runner{baseURL: server.URL, client: server.Client()}
+	start := time.Now()
+	points := runSweep(r, []int{1, 4}, 50*time.Millisecond)
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected about 100ms for two 50ms steps, took %v", elapsed)
+	}
+	if len(points) != 2 || points[1].Threads != 4 {
+		t.Fatalf("Expected points for 1 and 4 threads, got %+v", points)
+	}
+	if points[1].Throughput <= points[0].Throughput {
+		t.Errorf("Expected more throughput with 4 threads, got %+v", points)
+	}
+
+	path := filepath.Join(t.TempDir(), "sweep.csv")
+	if err := writeSweepCSV(path, points); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 3 {
+		t.Errorf("Expected header and 2 rows, got %d lines", len(lines))
+	}
+}
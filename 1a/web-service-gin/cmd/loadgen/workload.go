@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// scenario defines the access pattern of a load test: which operations to send in what ratio,
+// how target albums are chosen, and how long each client pauses between requests.
+//
+// Example scenario file:
+//
+//	{
+//	  "name": "read-heavy",
+//	  "mix": {"GET": 80, "POST": 15, "PATCH": 5},
+//	  "id_distribution": "zipf",
+//	  "zipf_s": 1.2,
+//	  "think_time": {"distribution": "exponential", "mean_ms": 20}
+//	}
+type scenario struct {
+	Name           string         `json:"name"`
+	Mix            map[string]int `json:"mix"`
+	IDDistribution string         `json:"id_distribution"`
+	ZipfS          float64        `json:"zipf_s"`
+	ThinkTime      thinkTime      `json:"think_time"`
+
+	ops     []string
+	weights []int
+	total   int
+}
+
+// thinkTime is the pause between consecutive requests of one client.
+// Distribution is "none", "constant" (MeanMS), "uniform" (0..MaxMS), or "exponential" (mean MeanMS).
+type thinkTime struct {
+	Distribution string  `json:"distribution"`
+	MeanMS       float64 `json:"mean_ms"`
+	MaxMS        float64 `json:"max_ms"`
+}
+
+// scenarioOps are the operations a scenario mix may contain.
+var scenarioOps = map[string]bool{"GET": true, "POST": true, "PATCH": true, "DELETE": true}
+
+// loadScenario reads and validates a scenario file.
+func loadScenario(path string) (*scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s scenario
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := s.init(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// init validates the scenario and prepares the operation weights.
+func (s *scenario) init() error {
+	for op, weight := range s.Mix {
+		if !scenarioOps[op] {
+			return fmt.Errorf("unknown operation %q in mix", op)
+		}
+		if weight < 0 {
+			return fmt.Errorf("negative weight for %s", op)
+		}
+		if weight > 0 {
+			s.ops = append(s.ops, op)
+		}
+	}
+	sort.Strings(s.ops)
+	for _, op := range s.ops {
+		s.weights = append(s.weights, s.Mix[op])
+		s.total += s.Mix[op]
+	}
+	if s.total == 0 {
+		return fmt.Errorf("mix must contain at least one operation with a positive weight")
+	}
+
+	switch s.IDDistribution {
+	case "":
+		s.IDDistribution = "uniform"
+	case "uniform":
+	case "zipf":
+		if s.ZipfS == 0 {
+			s.ZipfS = 1.1
+		}
+		if s.ZipfS <= 1 {
+			return fmt.Errorf("zipf_s must be greater than 1")
+		}
+	default:
+		return fmt.Errorf("unknown id_distribution %q", s.IDDistribution)
+	}
+
+	switch s.ThinkTime.Distribution {
+	case "", "none", "constant", "uniform", "exponential":
+	default:
+		return fmt.Errorf("unknown think_time distribution %q", s.ThinkTime.Distribution)
+	}
+	return nil
+}
+
+// pickOp chooses the next operation according to the mix weights.
+func (s *scenario) pickOp(rng *rand.Rand) string {
+	n := rng.IntN(s.total)
+	for i, w := range s.weights {
+		if n < w {
+			return s.ops[i]
+		}
+		n -= w
+	}
+	return s.ops[len(s.ops)-1]
+}
+
+// pickIndex chooses an index into a pool of size n. With the zipf distribution, low indexes
+// (the oldest albums) are the hot keys.
+func (s *scenario) pickIndex(rng *rand.Rand, n int) int {
+	if s.IDDistribution == "zipf" && n > 1 {
+		return int(rand.NewZipf(rng, s.ZipfS, 1, uint64(n-1)).Uint64())
+	}
+	return rng.IntN(n)
+}
+
+// think returns how long to pause before the next request.
+func (s *scenario) think(rng *rand.Rand) time.Duration {
+	var msec float64
+	switch s.ThinkTime.Distribution {
+	case "constant":
+		msec = s.ThinkTime.MeanMS
+	case "uniform":
+		msec = rng.Float64() * s.ThinkTime.MaxMS
+	case "exponential":
+		msec = rng.ExpFloat64() * s.ThinkTime.MeanMS
+	}
+	return time.Duration(msec * float64(time.Millisecond))
+}
+
+// idPool is the set of album IDs known to exist, shared by all client goroutines.
+type idPool struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+// add records a newly created album ID.
+func (p *idPool) add(id string) {
+	p.mu.Lock()
+	p.ids = append(p.ids, id)
+	p.mu.Unlock()
+}
+
+// pick returns an ID chosen by s, or "" if the pool is empty.
+func (p *idPool) pick(s *scenario, rng *rand.Rand) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.ids) == 0 {
+		return ""
+	}
+	return p.ids[s.pickIndex(rng, len(p.ids))]
+}
+
+// remove drops a deleted album ID from the pool.
+func (p *idPool) remove(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, existing := range p.ids {
+		if existing == id {
+			p.ids = append(p.ids[:i], p.ids[i+1:]...)
+			return
+		}
+	}
+}
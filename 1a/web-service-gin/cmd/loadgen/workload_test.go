@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadScenario tests scenario parsing and validation.
+// Verifies that a valid file loads with defaults applied and unknown operations are rejected.
+func TestLoadScenario(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	os.WriteFile(valid, []byte(`{"mix": {"GET": 80, "POST": 20}, "id_distribution": "zipf"}`), 0o644)
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(invalid, []byte(`{"mix": {"PUT": 1}}`), 0o644)
+
+	s, err := loadScenario(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ZipfS != 1.1 {
+		t.Errorf("Expected default zipf_s 1.1, got %f", s.ZipfS)
+	}
+
+	if _, err := loadScenario(invalid); err == nil {
+		t.Error("Expected error for unknown operation")
+	}
+}
+
+// TestScenarioSampling tests operation mix and ID distribution sampling.
+// Verifies that operations follow the configured ratios and that Zipfian selection
+// concentrates requests on the hottest IDs far more than uniform selection.
+func TestScenarioSampling(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	s := &scenario{Mix: map[string]int{"GET": 80, "POST": 15, "PATCH": 5}, IDDistribution: "zipf"}
+	if err := s.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		counts[s.pickOp(rng)]++
+	}
+	if counts["GET"] < 7700 || counts["GET"] > 8300 {
+		t.Errorf("Expected about 8000 GETs, got %d", counts["GET"])
+	}
+
+	uniform := &scenario{Mix: map[string]int{"GET": 1}}
+	uniform.init()
+	hot := func(s *scenario) int {
+		n := 0
+		for i := 0; i < 10000; i++ {
+			if s.pickIndex(rng, 1000) == 0 {
+				n++
+			}
+		}
+		return n
+	}
+	if zipf, flat := hot(s), hot(uniform); zipf < 10*flat {
+		t.Errorf("Expected zipf to favor index 0 far more than uniform, got %d vs %d", zipf, flat)
+	}
+}
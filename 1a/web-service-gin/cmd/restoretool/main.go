@@ -0,0 +1,39 @@
+// Command restoretool restores the album API's backups to a point in time.
+// It reads the full and incremental backups the server writes to BACKUP_DIR, starts from the last
+// full backup taken at or before -at, replays the changes of the incremental backups that follow it
+// up to -at, and writes the albums as a snapshot file. Start the server with SNAPSHOT_PATH set to
+// that file to load them.
+//
+//	go run ./cmd/restoretool -dir backups -at 2024-01-02T15:04:05Z -out albums.json
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+)
+
+// main parses flags, restores the backups, and writes the snapshot.
+func main() {
+	dir := flag.String("dir", "backups", "directory the server writes backups to (BACKUP_DIR)")
+	at := flag.String("at", "", "RFC 3339 time to restore to (default: the latest state backed up)")
+	out := flag.String("out", "albums.json", "path of the snapshot file to write")
+	flag.Parse()
+
+	target := time.Now().UTC()
+	if *at != "" {
+		var err error
+		if target, err = time.Parse(time.RFC3339, *at); err != nil {
+			log.Fatalf("Invalid -at: %v", err)
+		}
+	}
+	snap, report, err := restore(*dir, target)
+	if err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+	if err := writeSnapshot(*out, snap); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+	log.Printf("Restored %d albums as of %s from full backup %s and %d incremental backups (%d changes) to %s",
+		len(snap.Albums), target.Format(time.RFC3339), report.Base, report.Incrementals, report.Changes, *out)
+}
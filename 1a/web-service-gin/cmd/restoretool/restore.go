@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// backupIDFormat is the format of full backup IDs, the time each was taken, as the server writes
+// them.
+const backupIDFormat = "20060102T150405.000000000Z"
+
+// snapshotVersion is the snapshot format version the server reads.
+const snapshotVersion = 1
+
+// snapshot is a snapshot file the server can load with SNAPSHOT_PATH. Albums are kept as the JSON
+// the server wrote, so every field survives the restore unchanged.
+type snapshot struct {
+	Version int               `json:"version"`
+	SavedAt time.Time         `json:"saved_at"`
+	Albums  []json.RawMessage `json:"albums"`
+}
+
+// fullBackup is a full-<id>.json backup: a snapshot with its ID and the number of the last change
+// feed event it includes.
+type fullBackup struct {
+	snapshot
+	ID  string `json:"id"`
+	Seq int64  `json:"seq"`
+}
+
+// incrementalBackup is an incr-<base>-<to_seq>.json backup: the change feed events from FromSeq to
+// ToSeq that follow the full backup Base.
+type incrementalBackup struct {
+	Base    string   `json:"base"`
+	FromSeq int64    `json:"from_seq"`
+	ToSeq   int64    `json:"to_seq"`
+	Changes []change `json:"changes"`
+}
+
+// change is one change feed event: the album after it, or the removed album for deletions.
+type change struct {
+	Seq   int64           `json:"seq"`
+	Type  string          `json:"type"`
+	At    time.Time       `json:"at"`
+	Album json.RawMessage `json:"album"`
+}
+
+// albumKey is the part of an album the restore needs: its ID, and whether it is soft deleted.
+type albumKey struct {
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// restoreReport describes a restore: the full backup it started from, and how many incremental
+// backups and changes it replayed.
+type restoreReport struct {
+	Base         string
+	Incrementals int
+	Changes      int
+}
+
+// restore returns the albums as they were at the time at, from the backups in dir: the last full
+// backup taken at or before at, with the changes made up to at replayed from the incremental
+// backups that follow it. Returns an error if there is no such full backup, or an incremental
+// backup is unreadable or missing from the chain.
+func restore(dir string, at time.Time) (snapshot, restoreReport, error) {
+	base, err := findFullBackup(dir, at)
+	if err != nil {
+		return snapshot{}, restoreReport{}, err
+	}
+	var full fullBackup
+	if err := readJSON(filepath.Join(dir, "full-"+base+".json"), &full); err != nil {
+		return snapshot{}, restoreReport{}, err
+	}
+	report := restoreReport{Base: base}
+
+	albums := full.Albums
+	index := map[string]int{}
+	for i, raw := range albums {
+		var key albumKey
+		if err := json.Unmarshal(raw, &key); err != nil {
+			return snapshot{}, report, fmt.Errorf("full backup %s: %w", base, err)
+		}
+		index[key.ID] = i
+	}
+	removed := map[string]bool{}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "incr-"+base+"-*.json"))
+	if err != nil {
+		return snapshot{}, report, err
+	}
+	slices.Sort(paths)
+	next := full.Seq + 1
+	for _, path := range paths {
+		var incr incrementalBackup
+		if err := readJSON(path, &incr); err != nil {
+			return snapshot{}, report, err
+		}
+		if incr.Base != base || incr.FromSeq != next {
+			return snapshot{}, report, fmt.Errorf("%s: expected changes from %d of full backup %s, got %d of %s; an incremental backup is missing",
+				path, next, base, incr.FromSeq, incr.Base)
+		}
+		next = incr.ToSeq + 1
+		report.Incrementals++
+		for _, c := range incr.Changes {
+			// Events are numbered in the order they were recorded, which can differ slightly from
+			// the order of their times, so every change is checked rather than stopping at the first
+			// one after at.
+			if c.At.After(at) {
+				continue
+			}
+			var key albumKey
+			if err := json.Unmarshal(c.Album, &key); err != nil {
+				return snapshot{}, report, fmt.Errorf("%s: change %d: %w", path, c.Seq, err)
+			}
+			report.Changes++
+			if c.Type == "album.deleted" && key.DeletedAt.IsZero() {
+				removed[key.ID] = true
+				continue
+			}
+			delete(removed, key.ID)
+			if i, ok := index[key.ID]; ok {
+				albums[i] = c.Album
+			} else {
+				index[key.ID] = len(albums)
+				albums = append(albums, c.Album)
+			}
+		}
+	}
+
+	albums = slices.DeleteFunc(albums, func(raw json.RawMessage) bool {
+		var key albumKey
+		json.Unmarshal(raw, &key)
+		return removed[key.ID]
+	})
+	return snapshot{Version: snapshotVersion, SavedAt: at.UTC(), Albums: albums}, report, nil
+}
+
+// findFullBackup returns the ID of the last full backup in dir taken at or before at.
+func findFullBackup(dir string, at time.Time) (string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "full-*.json"))
+	if err != nil {
+		return "", err
+	}
+	var best string
+	for _, path := range paths {
+		id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "full-"), ".json")
+		taken, err := time.Parse(backupIDFormat, id)
+		if err != nil || taken.After(at) {
+			continue
+		}
+		best = max(best, id)
+	}
+	if best == "" {
+		return "", fmt.Errorf("no full backup in %s taken at or before %s", dir, at.Format(time.RFC3339))
+	}
+	return best, nil
+}
+
+// readJSON decodes the JSON file at path into v.
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeSnapshot writes snap as JSON to path.
+func writeSnapshot(path string, snap snapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
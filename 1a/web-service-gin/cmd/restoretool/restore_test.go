@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRestore tests restoring backups to a point in time.
+// Verifies that the last full backup before the time is used, that the changes made up to the time
+// are replayed, with permanently deleted albums removed and soft deleted ones kept, and that a
+// missing incremental backup or full backup is reported.
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return t0.Add(time.Duration(minutes) * time.Minute) }
+	write := func(name string, v any) {
+		data, _ := json.Marshal(v)
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	album := func(id string, price float64, deleted bool) json.RawMessage {
+		a := map[string]any{"id": id, "title": "Album " + id, "price": price}
+		if deleted {
+			a["deleted_at"] = t0
+		}
+		data, _ := json.Marshal(a)
+		return data
+	}
+	base := t0.Format(backupIDFormat)
+	write("full-"+base+".json", fullBackup{
+		snapshot: snapshot{Version: 1, SavedAt: t0, Albums: []json.RawMessage{album("a", 1, false), album("b", 2, false)}},
+		ID:       base,
+		Seq:      4,
+	})
+	write(fmt.Sprintf("incr-%s-%012d.json", base, 6), incrementalBackup{Base: base, FromSeq: 5, ToSeq: 6, Changes: []change{
+		{Seq: 5, Type: "album.updated", At: at(10), Album: album("a", 10, false)},
+		{Seq: 6, Type: "album.created", At: at(20), Album: album("c", 3, false)},
+	}})
+	write(fmt.Sprintf("incr-%s-%012d.json", base, 8), incrementalBackup{Base: base, FromSeq: 7, ToSeq: 8, Changes: []change{
+		{Seq: 7, Type: "album.deleted", At: at(30), Album: album("b", 2, false)},
+		{Seq: 8, Type: "album.deleted", At: at(40), Album: album("c", 3, true)},
+	}})
+
+	for _, tc := range []struct {
+		minutes int
+		want    []string
+	}{
+		{5, []string{`"id":"a","price":1,`, `"id":"b"`}},
+		{15, []string{`"id":"a","price":10,`, `"id":"b"`}},
+		{35, []string{`"id":"a","price":10,`, `"id":"c"`}},
+		{45, []string{`"id":"a","price":10,`, `"deleted_at"`}},
+	} {
+		snap, report, err := restore(dir, at(tc.minutes))
+		if err != nil {
+			t.Fatalf("Expected a restore to %d minutes, got %v", tc.minutes, err)
+		}
+		data, _ := json.Marshal(snap.Albums)
+		for _, want := range tc.want {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("Expected the restore to %d minutes to contain %s, got %s", tc.minutes, want, data)
+			}
+		}
+		if report.Base != base || report.Incrementals != 2 {
+			t.Errorf("Expected both incremental backups of %s replayed, got %+v", base, report)
+		}
+	}
+	if snap, _, _ := restore(dir, at(35)); len(snap.Albums) != 2 {
+		t.Errorf("Expected the permanently deleted album removed, got %d albums", len(snap.Albums))
+	}
+
+	if _, _, err := restore(dir, at(-1)); err == nil {
+		t.Error("Expected an error without a full backup before the time")
+	}
+	os.Remove(filepath.Join(dir, fmt.Sprintf("incr-%s-%012d.json", base, 6)))
+	if _, _, err := restore(dir, at(45)); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Expected an error for a missing incremental backup, got %v", err)
+	}
+}
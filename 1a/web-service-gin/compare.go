@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fieldDiff is one field that differs between the two albums of GET /albums/compare.
+// A side is null when that album does not have the field.
+type fieldDiff struct {
+	Field string `json:"field"`
+	Left  any    `json:"left"`
+	Right any    `json:"right"`
+}
+
+// albumFields returns the JSON object of a as rendered for this request, without its links.
+func albumFields(c *gin.Context, a Album) (map[string]any, error) {
+	data, err := json.Marshal(pipelineAlbum(c, a))
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// diffAlbums compares the JSON fields of left and right, other than their IDs, and returns the
+// fields that differ and those that are equal, each sorted by name.
+func diffAlbums(left, right map[string]any) (diffs []fieldDiff, same []string) {
+	diffs, same = []fieldDiff{}, []string{}
+	names := slices.Collect(maps.Keys(left))
+	for name := range right {
+		if _, ok := left[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if name == "id" {
+			continue
+		}
+		if reflect.DeepEqual(left[name], right[name]) {
+			same = append(same, name)
+			continue
+		}
+		diffs = append(diffs, fieldDiff{Field: name, Left: left[name], Right: right[name]})
+	}
+	return diffs, same
+}
+
+// compareAlbums handles GET /albums/compare?ids=a,b requests.
+// Returns both albums and a field-by-field comparison, listing every field whose value differs
+// (with the left and right values) and every field that is the same, as JSON with HTTP 200 status.
+// The albums are loaded concurrently. If one of them fails to load or render for another reason
+// than not existing, the other is still returned, with the failed side and the comparison null and
+// the failure under "warnings".
+// Returns HTTP 400 if ids does not name exactly two albums, HTTP 404 if either is not found, or
+// the store's error if neither album could be loaded.
+func (srv *Server) compareAlbums(c *gin.Context) {
+	ids := strings.Split(c.Query("ids"), ",")
+	if len(ids) != 2 || strings.TrimSpace(ids[0]) == "" || strings.TrimSpace(ids[1]) == "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "ids must name two albums, e.g. ids=a,b"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	sides := []string{"left", "right"}
+	fields := make([]map[string]any, len(ids))
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Go(func() {
+			errs[i] = isolate(sides[i], func() error {
+				a, err := srv.store.Get(ctx, strings.TrimSpace(id))
+				if err != nil {
+					return err
+				}
+				fields[i], err = albumFields(c, a)
+				return err
+			})
+		})
+	}
+	wg.Wait()
+
+	var warnings []sectionWarning
+	for i, err := range errs {
+		if errors.Is(err, errAlbumNotFound) {
+			respondStoreError(c, err)
+			return
+		}
+		if err != nil {
+			warnings = append(warnings, sectionWarning{Section: sides[i], Error: err.Error()})
+		}
+	}
+	switch len(warnings) {
+	case 0:
+		diffs, same := diffAlbums(fields[0], fields[1])
+		c.IndentedJSON(http.StatusOK, gin.H{
+			"left":        fields[0],
+			"right":       fields[1],
+			"differences": diffs,
+			"same":        same,
+		})
+	case len(ids):
+		respondStoreError(c, errs[0])
+	default:
+		c.IndentedJSON(http.StatusOK, gin.H{
+			"left":        fields[0],
+			"right":       fields[1],
+			"differences": nil,
+			"same":        nil,
+			"warnings":    warnings,
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestCompareAlbums tests the GET /albums/compare endpoint.
+// Verifies that differing and equal fields are reported in order, and that a missing album
+// returns HTTP 404 and a malformed ids parameter HTTP 400.
+func TestCompareAlbums(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := srv.do("GET", "/albums/compare?ids=550e8400-e29b-41d4-a716-446655440001,550e8400-e29b-41d4-a716-446655440002", "")
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Left        map[string]any `json:"left"`
+		Differences []fieldDiff    `json:"differences"`
+		Same        []string       `json:"same"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Left["title"] != "Blue Train" {
+		t.Errorf("Expected Blue Train on the left, got %v", body.Left)
+	}
+	var fields []string
+	for _, d := range body.Differences {
+		fields = append(fields, d.Field)
+	}
+	if len(fields) != 3 || fields[0] != "artist" || fields[1] != "price" || fields[2] != "title" {
+		t.Errorf("Expected artist, price, and title to differ, got %v", fields)
+	}
+	if body.Differences[1].Left != 56.99 || body.Differences[1].Right != 17.99 {
+		t.Errorf("Expected prices 56.99 and 17.99, got %+v", body.Differences[1])
+	}
+	if len(body.Same) != 2 || body.Same[0] != "created_at" || body.Same[1] != "updated_at" {
+		t.Errorf("Expected only created_at and updated_at to match, got %v", body.Same)
+	}
+
+	if w := srv.do("GET", "/albums/compare?ids=550e8400-e29b-41d4-a716-446655440001,missing", ""); w.Code != 404 {
+		t.Errorf("Expected 404 for a missing album, got %d", w.Code)
+	}
+	for _, query := range []string{"", "?ids=550e8400-e29b-41d4-a716-446655440001", "?ids=a,b,c", "?ids=a,"} {
+		if w := srv.do("GET", "/albums/compare"+query, ""); w.Code != 400 {
+			t.Errorf("Expected 400 for %q, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSpotifyTokenURL = "https://accounts.spotify.com/api/token"
+	defaultSpotifyAPIURL   = "https://api.spotify.com"
+)
+
+// Config holds the server settings that can be changed without recompiling.
+// Values are read from environment variables at startup by loadConfig.
+type Config struct {
+	// Storage selects the album store backend (see storageBackends).
+	Storage string
+	// DatabaseURL is the connection string for SQL storage backends.
+	DatabaseURL string
+	// DBMaxOpenConns, DBMaxIdleConns, and DBConnMaxLifetime configure the SQL connection pool.
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	// DynamoTable, DynamoRegion, and DynamoEndpoint configure the DynamoDB backend. An empty region
+	// falls back to the AWS SDK defaults (AWS_REGION); the endpoint is only set for DynamoDB Local.
+	DynamoTable    string
+	DynamoRegion   string
+	DynamoEndpoint string
+	// RedisURL and RedisKeyPrefix configure the Redis backend; all keys start with RedisKeyPrefix.
+	RedisURL       string
+	RedisKeyPrefix string
+	// SQLitePath is the database file used by the SQLite backend. It is created on first run.
+	SQLitePath string
+	// SnapshotPath is the JSON file the memory store is loaded from at startup and saved to every
+	// SnapshotInterval and on shutdown. Snapshots are disabled when unset.
+	SnapshotPath     string
+	SnapshotInterval time.Duration
+	// WALPath enables the memory store's write-ahead log at that file. WALSync flushes every record
+	// to disk before the change is applied, and the log is compacted once it holds WALCompactAfter records.
+	WALPath         string
+	WALSync         bool
+	WALCompactAfter int
+	// TenantStorageConfig is the path of a JSON file mapping tenant IDs to dedicated storage backends.
+	// Every tenant uses the Storage backend when unset.
+	TenantStorageConfig string
+	// MongoURI and MongoDatabase configure the MongoDB backend.
+	MongoURI      string
+	MongoDatabase string
+	// SpotifyClientID and SpotifyClientSecret are the OAuth client credentials
+	// used for the Spotify client credentials flow. Linking is disabled when unset.
+	SpotifyClientID     string
+	SpotifyClientSecret string
+	// SpotifyTokenURL and SpotifyAPIURL allow pointing the integration at a mock server.
+	SpotifyTokenURL string
+	SpotifyAPIURL   string
+	// EnrichmentFreshFor and EnrichmentStaleFor control the stale-while-revalidate cache in front of
+	// enrichment providers: responses are reused for EnrichmentFreshFor, then served stale while
+	// revalidating for up to EnrichmentStaleFor longer. At most EnrichmentCacheSize responses are
+	// kept, the least recently used evicted first.
+	EnrichmentFreshFor  time.Duration
+	EnrichmentStaleFor  time.Duration
+	EnrichmentCacheSize int
+	// OutboundTimeout, OutboundMaxRetries, OutboundBreakerThreshold, and OutboundBreakerCooldown
+	// configure the shared client used for calls to third-party services.
+	OutboundTimeout          time.Duration
+	OutboundMaxRetries       int
+	OutboundBreakerThreshold int
+	OutboundBreakerCooldown  time.Duration
+	// JournalSize is the number of mutating requests kept in the request journal. 0 disables it.
+	JournalSize int
+	// AllocSampleEvery enables per-route allocation sampling for one in every AllocSampleEvery requests. 0 disables it.
+	AllocSampleEvery int
+	// NotificationsConfig is the path of the notification rules and sinks file. Notifications are disabled when unset.
+	NotificationsConfig string
+	// APIKeys are the bearer tokens that authenticate requests, e.g. to see prices hidden from anonymous clients.
+	APIKeys []string
+	// RenderPipelines configures the album transformers applied per route group (see parseRenderPipelines).
+	RenderPipelines string
+	// PageLimitDefault is the page size of GET /albums when no limit is given, and PageLimitMax the
+	// largest limit a client may request.
+	PageLimitDefault int
+	PageLimitMax     int
+	// DedupWindow is how long the response to a POST is replayed to byte-identical POSTs from the
+	// same client instead of running them again. 0 disables deduplication.
+	DedupWindow time.Duration
+	// MaxAlbums caps the number of albums stored, and MaxAlbumsPerTenant the number in each tenant
+	// store. 0 disables a limit.
+	MaxAlbums          int
+	MaxAlbumsPerTenant int
+	// MemoryWatchdogLimit enables the memory store's watchdog: every MemoryWatchdogInterval, if the
+	// heap exceeds this many bytes, the coldest albums are evicted to the file at SpillPath and read
+	// back when requested. 0 disables it.
+	MemoryWatchdogLimit    int
+	MemoryWatchdogInterval time.Duration
+	SpillPath              string
+	// JobWorkers is how many background jobs run at once, MaxQueuedJobs how many may wait for a
+	// worker, and JobRetention how long a finished job and its result are kept.
+	JobWorkers    int
+	MaxQueuedJobs int
+	JobRetention  time.Duration
+	// GroupCommitMaxLatency enables group commit on the postgres and sqlite stores and the synced
+	// write-ahead log: concurrent writes wait up to this long to share one transaction or fsync, of
+	// at most GroupCommitMaxBatch writes. 0 commits every write on its own.
+	GroupCommitMaxLatency time.Duration
+	GroupCommitMaxBatch   int
+	// ReadOnly rejects every request that could change data (see readOnlyMiddleware), pointing
+	// clients to PrimaryURL, the base URL of the server that takes writes, if set.
+	ReadOnly   bool
+	PrimaryURL string
+	// PublicBaseURL is the scheme and host _links in responses start with, for servers behind a
+	// proxy that rewrites them. Links use those of each request when unset.
+	PublicBaseURL string
+	// StaleReadMaxAge enables answering GET requests from the albums last read, up to this old,
+	// when the store fails (see staleReadStore). StaleReadTimeout, if set, also treats reads that
+	// take longer as failed.
+	StaleReadMaxAge  time.Duration
+	StaleReadTimeout time.Duration
+	// CacheWritePolicy enables the album cache with that write policy: write-through, write-back,
+	// or write-around (see cachedStore). Under write-back, updates are written to the store every
+	// CacheFlushInterval.
+	CacheWritePolicy   string
+	CacheFlushInterval time.Duration
+	// Genres is the allowlist of album genres; genres are matched ignoring case and stored as spelled here.
+	Genres []string
+	// ChangeFeedSize is the number of album events kept for clients of the change feed to catch up
+	// on (see changeFeed). 0 disables the feed.
+	ChangeFeedSize int
+	// StreamHeartbeatInterval is how often event streams send a heartbeat comment; 0 disables them.
+	// StreamMaxLag is how many change feed events a client may fall behind before it is told to
+	// resync (see changesSince); 0 lets clients replay as many events as the feed keeps.
+	StreamHeartbeatInterval time.Duration
+	StreamMaxLag            int
+	// CoverStorage is where album cover images are kept: "disk", in CoverDir, or "s3", in
+	// CoverS3Bucket under CoverS3Prefix. Empty disables cover uploads. Covers may be at most
+	// CoverMaxBytes. An empty CoverS3Region falls back to the AWS SDK defaults; CoverS3Endpoint is
+	// only set for S3-compatible services such as MinIO.
+	CoverStorage    string
+	CoverDir        string
+	CoverMaxBytes   int64
+	CoverS3Bucket   string
+	CoverS3Prefix   string
+	CoverS3Region   string
+	CoverS3Endpoint string
+	// LockTTL is how long an album edit lock lasts unless the request asks otherwise, and
+	// LockMaxTTL the longest it may ask for.
+	LockTTL    time.Duration
+	LockMaxTTL time.Duration
+	// CurrencyRates is a static table of exchange rates against USD, "EUR=0.92,GBP=0.79", for
+	// converting prices with ?currency=. CurrencyRatesURL, if set, is an exchange rate API to fetch
+	// them from instead, cached for CurrencyRatesCache. Conversion is disabled if neither is set.
+	CurrencyRates      string
+	CurrencyRatesURL   string
+	CurrencyRatesCache time.Duration
+	// WarnPriceAbove is the price above which albums get a price_high validation warning; 0
+	// disables it. ValidationStrict lists the warning codes treated as validation errors, or "all".
+	WarnPriceAbove   float64
+	ValidationStrict []string
+	// RequireIfMatch makes PUT, PATCH, and DELETE /albums/:id require an If-Match header. It is
+	// on unless REQUIRE_IF_MATCH is false.
+	RequireIfMatch bool
+	// PricingRules are the semicolon-separated rules that adjust or reject album prices (see pricingRules).
+	PricingRules string
+	// HistorySize is the number of revisions kept per album for GET /albums/:id/history; 0 disables the history.
+	HistorySize int
+	// BackupDir is the directory backups of the default store are written to (see backupScheduler).
+	// Backups are disabled when unset. An incremental backup is taken every BackupInterval, and a
+	// full one every BackupFullInterval.
+	BackupDir          string
+	BackupInterval     time.Duration
+	BackupFullInterval time.Duration
+	// SnapshotURL is a snapshot the memory store is loaded from at startup, when there is no
+	// snapshot at SnapshotPath: s3://bucket/key, gs://bucket/key, or a prefix ending in a slash to
+	// load the latest snapshot under it (see fetchRemoteSnapshot). SnapshotURLEndpoint is only set
+	// for other S3-compatible services, such as MinIO. The download is abandoned after WarmupTimeout.
+	SnapshotURL         string
+	SnapshotURLEndpoint string
+	WarmupTimeout       time.Duration
+}
+
+// loadConfig builds a Config from environment variables, applying defaults for unset values.
+func loadConfig() Config {
+	return Config{
+		Storage:             envOr("STORAGE", "memory"),
+		DatabaseURL:         os.Getenv("DATABASE_URL"),
+		DBMaxOpenConns:      envInt("DB_MAX_OPEN_CONNS", 10),
+		DBMaxIdleConns:      envInt("DB_MAX_IDLE_CONNS", 5),
+		DBConnMaxLifetime:   envDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+		DynamoTable:         envOr("DYNAMODB_TABLE", "albums"),
+		DynamoRegion:        os.Getenv("DYNAMODB_REGION"),
+		DynamoEndpoint:      os.Getenv("DYNAMODB_ENDPOINT"),
+		RedisURL:            envOr("REDIS_URL", "redis://localhost:6379/0"),
+		RedisKeyPrefix:      envOr("REDIS_KEY_PREFIX", "albums"),
+		SQLitePath:          envOr("SQLITE_PATH", "albums.db"),
+		SnapshotPath:        os.Getenv("SNAPSHOT_PATH"),
+		SnapshotInterval:    envDuration("SNAPSHOT_INTERVAL", time.Minute),
+		WALPath:             os.Getenv("WAL_PATH"),
+		WALSync:             envBool("WAL_SYNC", true),
+		WALCompactAfter:     envInt("WAL_COMPACT_AFTER", 10000),
+		TenantStorageConfig: os.Getenv("TENANT_STORAGE_CONFIG"),
+		MongoURI:            envOr("MONGODB_URI", "mongodb://localhost:27017"),
+		MongoDatabase:       envOr("MONGODB_DATABASE", "albums"),
+
+		SpotifyClientID:     os.Getenv("SPOTIFY_CLIENT_ID"),
+		SpotifyClientSecret: os.Getenv("SPOTIFY_CLIENT_SECRET"),
+		SpotifyTokenURL:     envOr("SPOTIFY_TOKEN_URL", defaultSpotifyTokenURL),
+		SpotifyAPIURL:       envOr("SPOTIFY_API_URL", defaultSpotifyAPIURL),
+		EnrichmentFreshFor:  envDuration("ENRICHMENT_CACHE_FRESH", time.Hour),
+		EnrichmentStaleFor:  envDuration("ENRICHMENT_CACHE_STALE", 24*time.Hour),
+		EnrichmentCacheSize: envInt("ENRICHMENT_CACHE_SIZE", 10000),
+
+		OutboundTimeout:          envDuration("OUTBOUND_TIMEOUT", 10*time.Second),
+		OutboundMaxRetries:       envInt("OUTBOUND_MAX_RETRIES", 3),
+		OutboundBreakerThreshold: envInt("OUTBOUND_BREAKER_THRESHOLD", 5),
+		OutboundBreakerCooldown:  envDuration("OUTBOUND_BREAKER_COOLDOWN", 30*time.Second),
+
+		JournalSize:      envInt("JOURNAL_SIZE", 0),
+		AllocSampleEvery: envInt("ALLOC_SAMPLE_EVERY", 0),
+
+		NotificationsConfig: os.Getenv("NOTIFICATIONS_CONFIG"),
+
+		APIKeys:         envList("API_KEYS"),
+		RenderPipelines: os.Getenv("RENDER_PIPELINES"),
+
+		PageLimitDefault: envInt("PAGE_LIMIT_DEFAULT", 100),
+		PageLimitMax:     envInt("PAGE_LIMIT_MAX", 1000),
+
+		DedupWindow: envDuration("DEDUP_WINDOW", 0),
+
+		MaxAlbums:          envInt("MAX_ALBUMS", 0),
+		MaxAlbumsPerTenant: envInt("MAX_ALBUMS_PER_TENANT", 0),
+
+		MemoryWatchdogLimit:    envInt("MEMORY_WATCHDOG_LIMIT", 0),
+		MemoryWatchdogInterval: envDuration("MEMORY_WATCHDOG_INTERVAL", 10*time.Second),
+		SpillPath:              envOr("SPILL_PATH", "albums.spill"),
+
+		JobWorkers:    envInt("JOB_WORKERS", 2),
+		MaxQueuedJobs: envInt("MAX_QUEUED_JOBS", 100),
+		JobRetention:  envDuration("JOB_RETENTION", time.Hour),
+
+		GroupCommitMaxLatency: envDuration("GROUP_COMMIT_MAX_LATENCY", 0),
+		GroupCommitMaxBatch:   envInt("GROUP_COMMIT_MAX_BATCH", 100),
+
+		ReadOnly:   envBool("READ_ONLY", false),
+		PrimaryURL: strings.TrimSuffix(os.Getenv("PRIMARY_URL"), "/"),
+
+		PublicBaseURL: strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/"),
+
+		StaleReadMaxAge:  envDuration("STALE_READ_MAX_AGE", 0),
+		StaleReadTimeout: envDuration("STALE_READ_TIMEOUT", 0),
+
+		Genres: envListOr("GENRES", defaultGenres),
+
+		CacheWritePolicy:   os.Getenv("CACHE_WRITE_POLICY"),
+		CacheFlushInterval: envDuration("CACHE_FLUSH_INTERVAL", time.Second),
+
+		ChangeFeedSize:          envInt("CHANGE_FEED_SIZE", 1000),
+		StreamHeartbeatInterval: envDuration("STREAM_HEARTBEAT_INTERVAL", 15*time.Second),
+		StreamMaxLag:            envInt("STREAM_MAX_LAG", 500),
+		CoverStorage:            os.Getenv("COVER_STORAGE"),
+		CoverDir:                envOr("COVER_DIR", "covers"),
+		CoverMaxBytes:           int64(envInt("COVER_MAX_BYTES", 5<<20)),
+		CoverS3Bucket:           os.Getenv("COVER_S3_BUCKET"),
+		CoverS3Prefix:           envOr("COVER_S3_PREFIX", "covers/"),
+		CoverS3Region:           os.Getenv("COVER_S3_REGION"),
+		CoverS3Endpoint:         os.Getenv("COVER_S3_ENDPOINT"),
+		LockTTL:                 envDuration("LOCK_TTL", 5*time.Minute),
+		LockMaxTTL:              envDuration("LOCK_MAX_TTL", time.Hour),
+		CurrencyRates:           os.Getenv("CURRENCY_RATES"),
+		CurrencyRatesURL:        os.Getenv("CURRENCY_RATES_URL"),
+		CurrencyRatesCache:      envDuration("CURRENCY_RATES_CACHE", time.Hour),
+		WarnPriceAbove:          envFloat("VALIDATION_WARN_PRICE_ABOVE", 200),
+		ValidationStrict:        envList("VALIDATION_STRICT"),
+		RequireIfMatch:          envBool("REQUIRE_IF_MATCH", true),
+		PricingRules:            os.Getenv("PRICING_RULES"),
+		HistorySize:             envInt("ALBUM_HISTORY_SIZE", 100),
+		BackupDir:               os.Getenv("BACKUP_DIR"),
+		BackupInterval:          envDuration("BACKUP_INTERVAL", 15*time.Minute),
+		BackupFullInterval:      envDuration("BACKUP_FULL_INTERVAL", 24*time.Hour),
+		SnapshotURL:             os.Getenv("SNAPSHOT_URL"),
+		SnapshotURLEndpoint:     os.Getenv("SNAPSHOT_URL_ENDPOINT"),
+		WarmupTimeout:           envDuration("WARMUP_TIMEOUT", 5*time.Minute),
+	}
+}
+
+// envOr returns the value of the environment variable key, or fallback if it is unset or empty.
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// envBool parses the environment variable key as a boolean (e.g. "true", "0"), returning fallback if it is unset or invalid.
+func envBool(key string, fallback bool) bool {
+	if b, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return b
+	}
+	return fallback
+}
+
+// envListOr returns envList(key), or fallback if it has no items.
+func envListOr(key string, fallback []string) []string {
+	if items := envList(key); len(items) > 0 {
+		return items
+	}
+	return fallback
+}
+
+// envList splits the comma-separated environment variable key into its non-empty, trimmed items.
+func envList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// envDuration parses the environment variable key as a time.Duration (e.g. "30s"),
+// returning fallback if it is unset or invalid.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return fallback
+}
+
+// envInt parses the environment variable key as an integer, returning fallback if it is unset or invalid.
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return n
+	}
+	return fallback
+}
+
+// envFloat parses the environment variable key as a number (e.g. "199.99"), returning fallback if it is unset or invalid.
+func envFloat(key string, fallback float64) float64 {
+	if f, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return f
+	}
+	return fallback
+}
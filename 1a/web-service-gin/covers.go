@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gin-gonic/gin"
+)
+
+// coverFormField is the multipart form field PUT /albums/:id/cover reads the image from.
+const coverFormField = "image"
+
+// coverTypes are the image types accepted as album covers, detected from the image's content.
+var coverTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// coverCacheMaxAge is how long clients and proxies may cache a cover without revalidating it.
+// Replacing a cover changes the album's image_url, so cached covers are never shown stale.
+const coverCacheMaxAge = 7 * 24 * time.Hour
+
+// errCoverNotFound is returned by a coverStore when it holds no cover for an album.
+var errCoverNotFound = errors.New("cover not found")
+
+// cover is an album cover image as kept by a coverStore.
+type cover struct {
+	Data        []byte
+	ContentType string
+	ModTime     time.Time
+}
+
+// coverStore keeps album cover images, keyed by album ID.
+type coverStore interface {
+	// Put stores the cover of the album with the given ID, replacing any it had.
+	Put(ctx context.Context, id string, c cover) error
+	// Get returns the cover of the album with the given ID, or errCoverNotFound.
+	Get(ctx context.Context, id string) (cover, error)
+	// Delete removes the cover of the album with the given ID, if it has one.
+	Delete(ctx context.Context, id string) error
+}
+
+// newCoverStore returns the cover store selected by COVER_STORAGE, or nil if it is empty, which
+// disables cover uploads.
+func newCoverStore(cfg Config) (coverStore, error) {
+	switch cfg.CoverStorage {
+	case "":
+		return nil, nil
+	case "disk":
+		return &diskCoverStore{dir: cfg.CoverDir}, nil
+	case "s3":
+		return newS3CoverStore(cfg)
+	}
+	return nil, fmt.Errorf("unknown cover storage %q (want disk or s3)", cfg.CoverStorage)
+}
+
+// diskCoverStore keeps covers as files in a directory, named after the album ID. The content type
+// is detected from the file when it is read.
+type diskCoverStore struct {
+	dir string
+}
+
+// path returns the file holding the cover of the album with the given ID.
+func (s *diskCoverStore) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id))
+}
+
+// Put writes the cover to a temporary file and renames it into place, so readers never see a
+// partly written cover.
+func (s *diskCoverStore) Put(ctx context.Context, id string, c cover) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".cover-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(c.Data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(id))
+}
+
+// Get reads the cover file.
+func (s *diskCoverStore) Get(ctx context.Context, id string) (cover, error) {
+	f, err := os.Open(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return cover{}, errCoverNotFound
+	}
+	if err != nil {
+		return cover{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return cover{}, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return cover{}, err
+	}
+	return cover{Data: data, ContentType: http.DetectContentType(data), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the cover file.
+func (s *diskCoverStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// s3CoverStore keeps covers as objects in an S3 bucket, under a key prefix.
+type s3CoverStore struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// newS3CoverStore creates a cover store for COVER_S3_BUCKET. An empty COVER_S3_REGION falls back
+// to the AWS SDK defaults; COVER_S3_ENDPOINT is only set for S3-compatible services such as MinIO,
+// which are addressed path-style.
+func newS3CoverStore(cfg Config) (*s3CoverStore, error) {
+	if cfg.CoverS3Bucket == "" {
+		return nil, errors.New("COVER_S3_BUCKET is required for s3 cover storage")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.CoverS3Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.CoverS3Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.CoverS3Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.CoverS3Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &s3CoverStore{client: client, bucket: cfg.CoverS3Bucket, prefix: cfg.CoverS3Prefix}, nil
+}
+
+// Put uploads the cover object.
+func (s *s3CoverStore) Put(ctx context.Context, id string, c cover) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.prefix + id),
+		Body:        bytes.NewReader(c.Data),
+		ContentType: aws.String(c.ContentType),
+	})
+	return err
+}
+
+// Get downloads the cover object.
+func (s *s3CoverStore) Get(ctx context.Context, id string) (cover, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.prefix + id)})
+	var noKey *s3types.NoSuchKey
+	if errors.As(err, &noKey) {
+		return cover{}, errCoverNotFound
+	}
+	if err != nil {
+		return cover{}, err
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return cover{}, err
+	}
+	c := cover{Data: data, ContentType: aws.ToString(out.ContentType)}
+	if c.ContentType == "" {
+		c.ContentType = http.DetectContentType(data)
+	}
+	if out.LastModified != nil {
+		c.ModTime = *out.LastModified
+	}
+	return c, nil
+}
+
+// Delete deletes the cover object. Deleting an object that does not exist succeeds.
+func (s *s3CoverStore) Delete(ctx context.Context, id string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.prefix + id)})
+	return err
+}
+
+// coverETag returns the entity tag of a cover: a hash of its content.
+func coverETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// coverImageURL returns the image_url stored on an album whose cover has the given entity tag:
+// the path of GET /albums/:id/cover, without a version prefix (see absoluteImageURL), with the tag
+// in the query so that a new cover gets a new URL.
+func coverImageURL(id, etag string) string {
+	return "/albums/" + id + "/cover?v=" + etag[:12]
+}
+
+// absoluteImageURL returns a with its image_url made absolute for the request being answered, as
+// links are (see linkBase).
+func absoluteImageURL(c *gin.Context, a Album) Album {
+	if strings.HasPrefix(a.ImageURL, "/") {
+		a.ImageURL = linkBase(c) + a.ImageURL
+	}
+	return a
+}
+
+// putAlbumCover handles PUT /albums/:id/cover requests.
+// Stores the JPEG, PNG, GIF, or WebP image in the "image" field of the multipart/form-data body as
+// the album's cover, replacing any it had, and sets the album's image_url to where it is served.
+// The type is detected from the image's content. Returns the updated album as JSON with HTTP 200
+// status. Returns HTTP 400 if the body has no image, HTTP 404 if the album is not found or cover
+// storage is disabled, HTTP 413 if the image is larger than COVER_MAX_BYTES, or HTTP 415 if it is
+// not one of the accepted types.
+func (srv *Server) putAlbumCover(c *gin.Context) {
+	if srv.covers == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Cover storage is disabled; set COVER_STORAGE to enable it"})
+		return
+	}
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	if _, err := srv.store.Get(ctx, id); err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	// Leave room for the multipart framing around the image.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, srv.cfg.CoverMaxBytes+64<<10)
+	file, header, err := c.Request.FormFile(coverFormField)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Cover image must be at most %d bytes", srv.cfg.CoverMaxBytes)})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": `Body must be multipart/form-data with the image in the "image" field`, "details": err.Error()})
+		return
+	}
+	defer file.Close()
+	if header.Size > srv.cfg.CoverMaxBytes {
+		c.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Cover image must be at most %d bytes", srv.cfg.CoverMaxBytes)})
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Failed to read the image", "details": err.Error()})
+		return
+	}
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(coverTypes, contentType) {
+		c.IndentedJSON(http.StatusUnsupportedMediaType, gin.H{"error": "Cover image must be a JPEG, PNG, GIF, or WebP image"})
+		return
+	}
+
+	if err := srv.covers.Put(ctx, id, cover{Data: data, ContentType: contentType}); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to store the cover", "details": err.Error()})
+		return
+	}
+	var previous Album
+	updated, err := srv.updateAlbum(ctx, id, func(a *Album) error {
+		previous = *a
+		a.ImageURL = coverImageURL(id, coverETag(data))
+		return nil
+	})
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	srv.publishAlbumEvent(ctx, eventAlbumUpdated, updated, &previous)
+	renderAlbum(c, http.StatusOK, updated)
+}
+
+// getAlbumCover handles GET /albums/:id/cover requests.
+// Serves the album's cover image with its content type. Responses carry an ETag and Last-Modified
+// header and may be cached for a week, as a new cover gets a new image_url; conditional requests
+// are answered with HTTP 304 when the cover is unchanged. Returns HTTP 404 if the album is not
+// found or has no cover.
+func (srv *Server) getAlbumCover(c *gin.Context) {
+	ctx := c.Request.Context()
+	a, err := srv.store.Get(ctx, c.Param("id"))
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	if srv.covers == nil || a.ImageURL == "" {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "cover not found"})
+		return
+	}
+	img, err := srv.covers.Get(ctx, a.ID)
+	if errors.Is(err, errCoverNotFound) {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "cover not found"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the cover", "details": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", img.ContentType)
+	c.Header("ETag", `"`+coverETag(img.Data)+`"`)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(coverCacheMaxAge.Seconds())))
+	http.ServeContent(c.Writer, c.Request, "", img.ModTime, bytes.NewReader(img.Data))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakePNG returns data after the PNG signature, which is enough for content type detection.
+func fakePNG(data string) []byte {
+	return []byte("\x89PNG\r\n\x1a\n" + data)
+}
+
+// testCoverStore tests the coverStore contract against s.
+func testCoverStore(t *testing.T, s coverStore) {
+	ctx := context.Background()
+	const id = "550e8400-e29b-41d4-a716-446655440001"
+	if _, err := s.Get(ctx, id); !errors.Is(err, errCoverNotFound) {
+		t.Errorf("Expected errCoverNotFound before a cover is stored, got %v", err)
+	}
+	for _, data := range [][]byte{fakePNG("first"), fakePNG("second")} {
+		if err := s.Put(ctx, id, cover{Data: data, ContentType: "image/png"}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Get(ctx, id)
+		if err != nil || !bytes.Equal(got.Data, data) || got.ContentType != "image/png" {
+			t.Errorf("Expected the stored PNG, got %q (%s), %v", got.Data, got.ContentType, err)
+		}
+	}
+	for range 2 {
+		if err := s.Delete(ctx, id); err != nil {
+			t.Errorf("Expected deleting a cover to succeed, even twice, got %v", err)
+		}
+	}
+	if _, err := s.Get(ctx, id); !errors.Is(err, errCoverNotFound) {
+		t.Errorf("Expected errCoverNotFound after deleting the cover, got %v", err)
+	}
+}
+
+// TestDiskCoverStore tests the disk cover store in a temporary directory.
+func TestDiskCoverStore(t *testing.T) {
+	testCoverStore(t, &diskCoverStore{dir: t.TempDir() + "/covers"})
+}
+
+// TestS3CoverStore tests the S3 cover store against an S3-compatible service such as MinIO.
+// It is skipped unless COVER_S3_TEST_ENDPOINT and COVER_S3_TEST_BUCKET are set.
+func TestS3CoverStore(t *testing.T) {
+	endpoint, bucket := os.Getenv("COVER_S3_TEST_ENDPOINT"), os.Getenv("COVER_S3_TEST_BUCKET")
+	if endpoint == "" || bucket == "" {
+		t.Skip("COVER_S3_TEST_ENDPOINT and COVER_S3_TEST_BUCKET not set")
+	}
+	s, err := newS3CoverStore(Config{CoverS3Endpoint: endpoint, CoverS3Bucket: bucket, CoverS3Prefix: "test-covers/", CoverS3Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCoverStore(t, s)
+}
+
+// TestAlbumCover tests uploading and serving album covers.
+// Verifies that an uploaded image sets the album's image_url, that the cover is served with its
+// type and caching headers and revalidated with HTTP 304, and that missing, oversized, and
+// non-image uploads are rejected.
+func TestAlbumCover(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.CoverStorage = "disk"
+		cfg.CoverDir = t.TempDir()
+		cfg.CoverMaxBytes = 1024
+	})
+	upload := func(path, field string, data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile(field, "cover.png")
+		part.Write(data)
+		form.Close()
+		return srv.do("PUT", path, body.String(), "Content-Type", form.FormDataContentType(), "Host", "example.com")
+	}
+	const id = "550e8400-e29b-41d4-a716-446655440001"
+	image := fakePNG("cover art")
+
+	w := upload("/v1/albums/"+id+"/cover", "image", image)
+	var a Album
+	json.Unmarshal(w.Body.Bytes(), &a)
+	if w.Code != 200 || !strings.HasPrefix(a.ImageURL, "http://example.com/v1/albums/"+id+"/cover?v=") {
+		t.Fatalf("Expected the album with its image_url, got %d: %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest("GET", a.ImageURL, nil))
+	if w.Code != 200 || !bytes.Equal(w.Body.Bytes(), image) || w.Header().Get("Content-Type") != "image/png" || !strings.Contains(w.Header().Get("Cache-Control"), "max-age") {
+		t.Fatalf("Expected the cover with caching headers, got %d %v", w.Code, w.Header())
+	}
+	w = srv.do("GET", "/albums/"+id+"/cover", "", "If-None-Match", w.Header().Get("ETag"))
+	if w.Code != 304 {
+		t.Errorf("Expected 304 for an unchanged cover, got %d", w.Code)
+	}
+
+	for _, tc := range []struct {
+		path, field string
+		data        []byte
+		want        int
+	}{
+		{"/albums/" + id + "/cover", "file", image, 400},
+		{"/albums/" + id + "/cover", "image", fakePNG(strings.Repeat("x", 2048)), 413},
+		{"/albums/" + id + "/cover", "image", []byte("not an image"), 415},
+		{"/albums/550e8400-e29b-41d4-a716-446655440099/cover", "image", image, 404},
+	} {
+		if w := upload(tc.path, tc.field, tc.data); w.Code != tc.want {
+			t.Errorf("PUT %s with %d bytes in %q: expected %d, got %d", tc.path, len(tc.data), tc.field, tc.want, w.Code)
+		}
+	}
+	w = httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest("GET", "/albums/550e8400-e29b-41d4-a716-446655440002/cover", nil))
+	if w.Code != 404 {
+		t.Errorf("Expected 404 for an album without a cover, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	newTestServer(t).router.ServeHTTP(w, httptest.NewRequest("PUT", "/albums/"+id+"/cover", nil))
+	if w.Code != 404 {
+		t.Errorf("Expected 404 with cover storage disabled, got %d", w.Code)
+	}
+}
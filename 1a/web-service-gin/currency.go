@@ -0,0 +1,209 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// baseCurrency is the currency of albums without a currency, and the one exchange rates are
+// quoted against.
+const baseCurrency = "USD"
+
+// currencyRatesStaleFor is how long exchange rates fetched from CURRENCY_RATES_URL are still served,
+// while they are refreshed in the background, once they are older than CURRENCY_RATES_CACHE.
+const currencyRatesStaleFor = 24 * time.Hour
+
+// currencySymbols are the symbols price_display uses; other currencies are shown by their code.
+var currencySymbols = map[string]string{"USD": "$", "EUR": "€", "GBP": "£", "JPY": "¥"}
+
+// exchangeRates are the units of each currency one baseCurrency buys, baseCurrency included.
+type exchangeRates map[string]float64
+
+// convert returns amount in currency from as an amount in currency to, rounded to cents, and
+// false if either currency has no rate.
+func (r exchangeRates) convert(amount float64, from, to string) (float64, bool) {
+	fromRate, toRate := r[from], r[to]
+	if fromRate <= 0 || toRate <= 0 {
+		return 0, false
+	}
+	return math.Round(amount/fromRate*toRate*100) / 100, true
+}
+
+// rateProvider supplies exchange rates for converting album prices. Implementations must be safe for
+// concurrent use.
+type rateProvider interface {
+	// Rates returns the current exchange rates.
+	Rates(ctx context.Context) (exchangeRates, error)
+}
+
+// staticRates is a rateProvider with a fixed table, from CURRENCY_RATES.
+type staticRates exchangeRates
+
+// Rates returns the table.
+func (s staticRates) Rates(context.Context) (exchangeRates, error) {
+	return exchangeRates(s), nil
+}
+
+// remoteRates is a rateProvider fetching rates as JSON from an exchange rate API, e.g.
+// {"base": "USD", "rates": {"EUR": 0.92, ...}}, caching them for CURRENCY_RATES_CACHE.
+// Rates quoted against another base are converted to baseCurrency.
+type remoteRates struct {
+	url    string
+	client *outboundClient
+	// cache holds the rates under url, its only key.
+	cache *swrCache[exchangeRates]
+}
+
+// Rates returns the cached rates, fetching them if they are missing or too old.
+func (r *remoteRates) Rates(ctx context.Context) (exchangeRates, error) {
+	return r.cache.get(ctx, r.url, r.fetch)
+}
+
+// fetch requests the rates from the API.
+func (r *remoteRates) fetch(ctx context.Context) (exchangeRates, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange rate API returned %s", resp.Status)
+	}
+	var body struct {
+		Base     string             `json:"base"`
+		BaseCode string             `json:"base_code"`
+		Rates    map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode exchange rates: %w", err)
+	}
+
+	base := strings.ToUpper(cmp.Or(body.Base, body.BaseCode, baseCurrency))
+	rates := exchangeRates{base: 1}
+	for code, rate := range body.Rates {
+		rates[strings.ToUpper(code)] = rate
+	}
+	perBase := rates[baseCurrency]
+	if perBase <= 0 {
+		return nil, fmt.Errorf("exchange rates have no rate for %s", baseCurrency)
+	}
+	for code, rate := range rates {
+		rates[code] = rate / perBase
+	}
+	return rates, nil
+}
+
+// newRateProvider returns the rate provider configured by cfg: the API at CURRENCY_RATES_URL if set,
+// otherwise the CURRENCY_RATES table. Returns nil if neither is set, which disables conversion, or
+// an error if the table is malformed.
+func newRateProvider(cfg Config, outbound *outboundRegistry) (rateProvider, error) {
+	if cfg.CurrencyRatesURL != "" {
+		return &remoteRates{
+			url:    cfg.CurrencyRatesURL,
+			client: outbound.newClient("currency-rates", cfg),
+			cache:  newSWRCache[exchangeRates](cfg.CurrencyRatesCache, currencyRatesStaleFor, 1),
+		}, nil
+	}
+	if cfg.CurrencyRates == "" {
+		return nil, nil
+	}
+	rates := staticRates{baseCurrency: 1}
+	for entry := range strings.SplitSeq(cfg.CurrencyRates, ",") {
+		code, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !ok || err != nil || rate <= 0 || validateCurrency(code) != "" {
+			return nil, fmt.Errorf("malformed rate %q, expected CODE=rate, e.g. EUR=0.92", entry)
+		}
+		rates[code] = rate
+	}
+	return rates, nil
+}
+
+// validateCurrency validates an ISO 4217 currency code: three letters, in either case.
+// Returns an empty string if validation passes, otherwise returns an error message.
+func validateCurrency(code string) string {
+	if len(code) != 3 || strings.IndexFunc(code, func(r rune) bool {
+		return (r < 'A' || r > 'Z') && (r < 'a' || r > 'z')
+	}) >= 0 {
+		return "Currency must be a three-letter ISO 4217 code, e.g. EUR"
+	}
+	return ""
+}
+
+// albumCurrency returns the currency of a's price.
+func albumCurrency(a Album) string {
+	return cmp.Or(a.Currency, baseCurrency)
+}
+
+// priceConversion is the ?currency= of a request: the currency to show prices in and the rates to
+// convert them with.
+type priceConversion struct {
+	currency string
+	rates    exchangeRates
+}
+
+// priceConversionKey is the gin context key holding the request's priceConversion.
+type priceConversionKey struct{}
+
+// currencyMiddleware reads ?currency= and, if set, makes albums rendered for the request show their
+// prices converted to that currency (see convertPrice). Returns HTTP 400 if the currency is invalid
+// or has no exchange rate, or if conversion is not configured, or HTTP 502 if the rates cannot be
+// fetched.
+func (srv *Server) currencyMiddleware(c *gin.Context) {
+	currency := strings.ToUpper(c.Query("currency"))
+	if currency == "" {
+		c.Next()
+		return
+	}
+	if errMsg := validateCurrency(currency); errMsg != "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	if srv.rates == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "currency conversion is not configured"})
+		return
+	}
+	rates, err := srv.rates.Rates(c.Request.Context())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": "Exchange rates unavailable", "details": err.Error()})
+		return
+	}
+	if _, ok := rates[currency]; !ok {
+		codes := slices.Sorted(maps.Keys(rates))
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "currency must be one of: " + strings.Join(codes, ", ")})
+		return
+	}
+	c.Set(priceConversionKey{}, priceConversion{currency: currency, rates: rates})
+	c.Next()
+}
+
+// convertPrice returns a with its price converted to the currency the request asked for with
+// ?currency=, if any. Albums in a currency without an exchange rate are returned unchanged, still
+// showing their own currency.
+func convertPrice(c *gin.Context, a Album) Album {
+	value, ok := c.Get(priceConversionKey{})
+	if !ok {
+		return a
+	}
+	conv := value.(priceConversion)
+	if price, ok := conv.rates.convert(a.Price, albumCurrency(a), conv.currency); ok {
+		a.Price, a.Currency = price, conv.currency
+	}
+	return a
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestCurrencyConversion tests showing prices in another currency with ?currency=.
+// Verifies that prices are converted from each album's currency using the CURRENCY_RATES table,
+// that price_display uses the currency's symbol, that album currencies are validated and
+// normalized, and that unknown currencies are rejected.
+func TestCurrencyConversion(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.CurrencyRates = "EUR=2, GBP=4"
+		cfg.RenderPipelines = "/albums=price_display"
+	})
+
+	var a map[string]any
+	json.Unmarshal(srv.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440001?currency=eur", "").Body.Bytes(), &a)
+	if a["price"] != 113.98 || a["currency"] != "EUR" || a["price_display"] != "€113.98" {
+		t.Errorf("Expected the price in euros, got %v", a)
+	}
+
+	var created Album
+	w := srv.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 10, "currency": "gbp"}`)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != 201 || created.Currency != "GBP" {
+		t.Fatalf("Expected the album priced in GBP, got %d: %s", w.Code, w.Body)
+	}
+	var albums []Album
+	json.Unmarshal(srv.do("GET", "/albums?currency=EUR&artist=Miles", "").Body.Bytes(), &albums)
+	if len(albums) != 1 || albums[0].Price != 5 || albums[0].Currency != "EUR" {
+		t.Errorf("Expected 10 GBP converted to 5 EUR, got %+v", albums)
+	}
+	json.Unmarshal(srv.do("GET", "/albums/"+created.ID+"?currency=USD", "").Body.Bytes(), &a)
+	if a["price"] != 2.5 || a["price_display"] != "$2.50" {
+		t.Errorf("Expected 10 GBP converted to 2.50 USD, got %v", a)
+	}
+
+	for path, want := range map[string]string{
+		"/albums?currency=CHF":      "one of: EUR, GBP, USD",
+		"/albums?currency=euro":     "three-letter",
+		"/albums/upc/0?currency=XY": "three-letter",
+	} {
+		if w := srv.do("GET", path, ""); w.Code != 400 || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("GET %s: expected 400 mentioning %q, got %d: %s", path, want, w.Code, w.Body)
+		}
+	}
+	if w := srv.do("PATCH", "/albums/"+created.ID, `{"currency": "pounds"}`, "If-Match", "*"); w.Code != 400 {
+		t.Errorf("Expected 400 for an invalid album currency, got %d", w.Code)
+	}
+
+	if w := srv.do("GET", "/albums?currency=EUR", ""); w.Code != 200 {
+		t.Errorf("Expected 200 converting the list, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	newTestServer(t).router.ServeHTTP(w, httptest.NewRequest("GET", "/albums?currency=EUR", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected 400 with conversion not configured, got %d", w.Code)
+	}
+}
+
+// TestRemoteRates tests fetching exchange rates from CURRENCY_RATES_URL.
+// Verifies that rates quoted against another base are rebased on USD, that they are cached, and
+// that an unavailable API returns 502.
+func TestRemoteRates(t *testing.T) {
+	var fetches atomic.Int64
+	var fail atomic.Bool
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if fail.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"base": "EUR", "rates": {"USD": 2, "GBP": 8}}`))
+	}))
+	defer api.Close()
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.CurrencyRatesURL = api.URL
+		cfg.OutboundMaxRetries = 0
+	})
+
+	for _, tc := range []struct {
+		currency string
+		price    float64
+	}{{"EUR", 8.995}, {"GBP", 71.96}} {
+		var a Album
+		json.Unmarshal(srv.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440002?currency="+tc.currency, "").Body.Bytes(), &a)
+		if a.Currency != tc.currency || a.Price < tc.price-0.01 || a.Price > tc.price+0.01 {
+			t.Errorf("Expected 17.99 USD in %s to be about %v, got %v %s", tc.currency, tc.price, a.Price, a.Currency)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("Expected the rates to be fetched once and cached, got %d fetches", fetches.Load())
+	}
+
+	fail.Store(true)
+	srv = newTestServer(t, func(cfg *Config) {
+		cfg.CurrencyRatesURL = api.URL
+		cfg.OutboundMaxRetries = 0
+	})
+	if w := srv.do("GET", "/albums?currency=EUR", ""); w.Code != 502 {
+		t.Errorf("Expected 502 with the rate API down, got %d", w.Code)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dedupHeader is set to "true" on responses replayed from an earlier identical request.
+const dedupHeader = "X-Deduplicated"
+
+// dedupCache remembers the responses to recent POST requests, so that a byte-identical POST from
+// the same client within the window gets the original response instead of running again.
+type dedupCache struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*dedupEntry
+	lastSweep time.Time
+}
+
+// dedupEntry is the response to one POST. done is closed once the response is recorded, so
+// duplicates that arrive while the original is still running wait for it.
+type dedupEntry struct {
+	done   chan struct{}
+	at     time.Time
+	status int
+	header http.Header
+	body   []byte
+}
+
+// newDedupCache creates a cache that deduplicates requests within window.
+// Returns nil if window is not positive, which disables deduplication.
+func newDedupCache(window time.Duration) *dedupCache {
+	if window <= 0 {
+		return nil
+	}
+	return &dedupCache{window: window, now: time.Now, entries: make(map[string]*dedupEntry)}
+}
+
+// claim returns the live entry for key and false, or registers a new one and returns it and true,
+// in which case the caller must run the request and call finish. Expired entries are swept at
+// most once per window.
+func (d *dedupCache) claim(key string) (*dedupEntry, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	if now.Sub(d.lastSweep) > d.window {
+		for k, e := range d.entries {
+			if d.expired(e, now) {
+				delete(d.entries, k)
+			}
+		}
+		d.lastSweep = now
+	}
+
+	if e, ok := d.entries[key]; ok && !d.expired(e, now) {
+		return e, false
+	}
+	e := &dedupEntry{done: make(chan struct{}), at: now}
+	d.entries[key] = e
+	return e, true
+}
+
+// expired reports whether e was recorded more than a window before now. Entries still running
+// never expire. The caller must hold d.mu.
+func (d *dedupCache) expired(e *dedupEntry, now time.Time) bool {
+	select {
+	case <-e.done:
+		return now.Sub(e.at) > d.window
+	default:
+		return false
+	}
+}
+
+// finish records the response for the entry claimed under key and releases waiting duplicates.
+// Server errors are not remembered, so a retry after one runs again.
+func (d *dedupCache) finish(key string, e *dedupEntry, status int, header http.Header, body []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if status >= http.StatusInternalServerError {
+		delete(d.entries, key)
+	} else {
+		e.status, e.header, e.body = status, header, body
+	}
+	close(e.done)
+}
+
+// dedupKey identifies a request by its client (tenant, actor or IP, and credentials), URL, body,
+// and whether it is a dry run, so a dry run is never answered for the real request or vice versa.
+func dedupKey(c *gin.Context, body []byte) string {
+	h := sha256.New()
+	for _, part := range []string{tenantFrom(c.Request.Context()), identityFrom(c.Request.Context()).Actor, c.GetHeader("Authorization"), c.GetHeader(dryRunHeader), c.Request.URL.RequestURI()} {
+		io.WriteString(h, part)
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// capturingWriter copies everything written to the response into body.
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// dedupMiddleware answers a POST whose client, URL, and body match one seen within d's window
+// with the original response, marked with the X-Deduplicated header, instead of handling it again.
+// This protects against clients that blindly retry requests that actually succeeded. Requests
+// replayed for background jobs are not deduplicated, as they would match the request that queued them.
+func dedupMiddleware(d *dedupCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPost || c.Request.Body == nil || inJob(c.Request.Context()) {
+			c.Next()
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		key := dedupKey(c, body)
+		e, first := d.claim(key)
+		if !first {
+			select {
+			case <-e.done:
+			case <-c.Request.Context().Done():
+				c.AbortWithStatus(http.StatusServiceUnavailable)
+				return
+			}
+			if e.status == 0 {
+				// The original failed and was forgotten, so this request runs on its own.
+				c.Next()
+				return
+			}
+			for name, values := range e.header {
+				c.Writer.Header()[name] = values
+			}
+			c.Writer.Header().Set(dedupHeader, "true")
+			c.Writer.WriteHeader(e.status)
+			c.Writer.Write(e.body)
+			c.Abort()
+			return
+		}
+
+		w := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			// A panicking handler is answered with HTTP 500 by the recovery middleware.
+			if p := recover(); p != nil {
+				d.finish(key, e, http.StatusInternalServerError, nil, nil)
+				panic(p)
+			}
+		}()
+		c.Next()
+		d.finish(key, e, w.Status(), w.Header().Clone(), w.body.Bytes())
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDedupMiddleware tests that identical POSTs from the same client within DEDUP_WINDOW get the
+// original response. Verifies that a different body or client, or a POST after the window, runs again.
+func TestDedupMiddleware(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.DedupWindow = time.Minute })
+	now := time.Now()
+	srv.dedup.now = func() time.Time { return now }
+	count := func() int {
+		all, _ := srv.store.List(t.Context())
+		return len(all)
+	}
+
+	body := `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}`
+	first := srv.do("POST", "/albums?allow_duplicate=true", body, "X-Actor", "alice")
+	retry := srv.do("POST", "/albums?allow_duplicate=true", body, "X-Actor", "alice")
+	if retry.Code != 201 || retry.Body.String() != first.Body.String() || retry.Header().Get(dedupHeader) != "true" {
+		t.Errorf("Expected the retry to replay the original response, got %d: %s", retry.Code, retry.Body)
+	}
+	if n := count(); n != 4 {
+		t.Errorf("Expected one album to be created, got %d albums", n)
+	}
+
+	srv.do("POST", "/albums?allow_duplicate=true", body, "X-Actor", "bob")
+	srv.do("POST", "/albums?allow_duplicate=true", `{"title": "Giant Steps", "artist": "John Coltrane", "price": 24.99}`, "X-Actor", "alice")
+	if n := count(); n != 6 {
+		t.Errorf("Expected other clients and bodies to run, got %d albums", n)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if w := srv.do("POST", "/albums?allow_duplicate=true", body, "X-Actor", "alice"); w.Header().Get(dedupHeader) != "" {
+		t.Error("Expected a POST after the window to run again")
+	}
+	if n := count(); n != 7 {
+		t.Errorf("Expected 7 albums, got %d", n)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dryRunHeader can be sent instead of ?dry_run=true to ask for a dry run, and is set to "true" on
+// every dry-run response.
+const dryRunHeader = "X-Dry-Run"
+
+// parseDryRun reports whether the request asks for a dry run with ?dry_run=true or an X-Dry-Run:
+// true header. Returns an error message if either is not a boolean.
+func parseDryRun(c *gin.Context) (bool, string) {
+	for _, value := range []string{c.Query("dry_run"), c.GetHeader(dryRunHeader)} {
+		if value == "" {
+			continue
+		}
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, "dry_run must be true or false"
+		}
+		if dryRun {
+			c.Header(dryRunHeader, "true")
+			return true, ""
+		}
+	}
+	return false, ""
+}
+
+// checkUPCConflict returns errUPCConflict if an album other than a already has a's UPC, the check
+// the store would make when saving a.
+func checkUPCConflict(ctx context.Context, s AlbumStore, a Album) error {
+	if a.UPC == "" {
+		return nil
+	}
+	other, err := findAlbumByUPC(ctx, s, a.UPC)
+	switch {
+	case errors.Is(err, errAlbumNotFound):
+		return nil
+	case err != nil:
+		return err
+	case other.ID != a.ID:
+		return errUPCConflict
+	}
+	return nil
+}
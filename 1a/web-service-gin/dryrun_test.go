@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestDryRun tests that ?dry_run=true and the X-Dry-Run header validate mutations and return the
+// response a real request would get, without changing the store.
+func TestDryRun(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := srv.do("POST", "/albums?dry_run=true", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}`)
+	var created Album
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != 201 || created.Title != "Kind of Blue" || w.Header().Get(dryRunHeader) != "true" {
+		t.Errorf("Expected a dry-run 201, got %d: %s", w.Code, w.Body)
+	}
+
+	w = srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", `{"price": 9.99}`, dryRunHeader, "true", "If-Match", "*")
+	var patched Album
+	json.Unmarshal(w.Body.Bytes(), &patched)
+	if w.Code != 200 || patched.Price != 9.99 {
+		t.Errorf("Expected a dry-run 200 with the new price, got %d: %s", w.Code, w.Body)
+	}
+
+	if w = srv.do("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440002?dry_run=true", "", "If-Match", "*"); w.Code != 200 {
+		t.Errorf("Expected a dry-run 200 for DELETE, got %d", w.Code)
+	}
+
+	all, _ := srv.store.List(t.Context())
+	if len(all) != 3 {
+		t.Errorf("Expected 3 albums after dry runs, got %d", len(all))
+	}
+	if a, _ := srv.store.Get(t.Context(), "550e8400-e29b-41d4-a716-446655440001"); a.Price != 56.99 {
+		t.Errorf("Expected the price to be unchanged, got %v", a.Price)
+	}
+}
+
+// TestDryRunErrors tests that dry runs report the errors a real request would.
+func TestDryRunErrors(t *testing.T) {
+	srv := newTestServer(t)
+	srv.store.Update(t.Context(), "550e8400-e29b-41d4-a716-446655440001", func(a *Album) error {
+		a.UPC = "036000291452"
+		return nil
+	})
+
+	for _, tc := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/albums?dry_run=true", `{"title": "", "artist": "Miles Davis", "price": 49.99}`, 400},
+		{"POST", "/albums?dry_run=true", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99, "upc": "036000291452"}`, 409},
+		{"PATCH", "/albums/550e8400-e29b-41d4-a716-446655440002?dry_run=true", `{"upc": "036000291452"}`, 409},
+		{"PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001?dry_run=true", `{"upc": "036000291452"}`, 200},
+		{"PATCH", "/albums/missing?dry_run=true", `{"price": 9.99}`, 404},
+		{"DELETE", "/albums/missing?dry_run=true", "", 404},
+		{"DELETE", "/albums/550e8400-e29b-41d4-a716-446655440001?dry_run=maybe", "", 400},
+	} {
+		w := srv.do(tc.method, tc.path, tc.body, "If-Match", "*")
+		if w.Code != tc.want {
+			t.Errorf("%s %s %s: expected %d, got %d: %s", tc.method, tc.path, tc.body, tc.want, w.Code, w.Body)
+		}
+	}
+	if all, _ := srv.store.List(t.Context()); len(all) != 3 {
+		t.Errorf("Expected 3 albums after dry runs, got %d", len(all))
+	}
+}
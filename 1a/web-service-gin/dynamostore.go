@@ -0,0 +1,871 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Item kinds stored in the DynamoDB table.
+const (
+	dynamoKindAlbum      = "album"
+	dynamoKindUPC        = "upc"
+	dynamoKindAlbumName  = "album_name"
+	dynamoKindArtist     = "artist"
+	dynamoKindArtistName = "artist_name"
+)
+
+// dynamoNamesIndexedID is the ID of the item recording that the albums stored before album name
+// markers existed have been added to them (see indexAlbumNames).
+const dynamoNamesIndexedID = "album-names-indexed"
+
+// dynamoMaxAttempts is how many times an update or delete is retried when a concurrent write
+// changes the album between reading and writing it.
+const dynamoMaxAttempts = 5
+
+// dynamoMaxTransactItems is the most items DynamoDB accepts in one transaction.
+const dynamoMaxTransactItems = 100
+
+// errDynamoConflict is returned when an album keeps changing underneath an update.
+var errDynamoConflict = errors.New("album was modified concurrently; try again")
+
+// dynamoStore keeps albums in a DynamoDB table whose partition key is the string attribute "id".
+// Album attributes use the JSON field names. Each album also carries a "version" counter that
+// updates are conditioned on, so concurrent writers never overwrite each other's changes.
+// Barcodes are kept unique with marker items ("upc#<normalized code>") written in the same
+// transaction as the album, and marker items ("album-name#<name key>", see albumNameKey) list the
+// IDs of the albums with each title and artist, so that a create or update can require its title
+// and artist to be unlisted. Artists are items too ("artist#<id>"), with their names kept unique
+// by marker items ("artist-name#<name key>") in the same way.
+type dynamoStore struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// dynamoItem is the stored form of an album: its attributes plus bookkeeping fields.
+type dynamoItem struct {
+	Album
+	Kind      string `json:"kind"`
+	Version   int64  `json:"version"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// dynamoArtist is the stored form of an artist, with a version counter like albums'.
+type dynamoArtist struct {
+	Key     string `json:"id"`
+	Kind    string `json:"kind"`
+	Artist  Artist `json:"artist"`
+	Version int64  `json:"version"`
+}
+
+// newDynamoStore creates a DynamoDB store using the default AWS credential chain.
+// cfg.DynamoRegion and cfg.DynamoEndpoint override the region and endpoint, e.g. for DynamoDB Local.
+func newDynamoStore(cfg Config) (AlbumStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.DynamoRegion != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.DynamoRegion))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	client := dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		if cfg.DynamoEndpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.DynamoEndpoint)
+		}
+	})
+
+	if _, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(cfg.DynamoTable)}); err != nil {
+		return nil, fmt.Errorf("describe table %s: %w", cfg.DynamoTable, err)
+	}
+	s := &dynamoStore{client: client, table: cfg.DynamoTable}
+	if err := s.indexAlbumNames(ctx); err != nil {
+		return nil, fmt.Errorf("index album names: %w", err)
+	}
+	return s, nil
+}
+
+// marshalDynamo encodes v using its JSON field names.
+func marshalDynamo(v any) (map[string]types.AttributeValue, error) {
+	return attributevalue.MarshalMapWithOptions(v, func(o *attributevalue.EncoderOptions) { o.TagKey = "json" })
+}
+
+// unmarshalDynamo decodes an item using JSON field names.
+func unmarshalDynamo(item map[string]types.AttributeValue, v any) error {
+	return attributevalue.UnmarshalMapWithOptions(item, v, func(o *attributevalue.DecoderOptions) { o.TagKey = "json" })
+}
+
+// dynamoKey returns the primary key for id.
+func dynamoKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}}
+}
+
+// upcMarkerID returns the ID of the marker item reserving code.
+func upcMarkerID(code string) string {
+	return "upc#" + normalizeUPC(code)
+}
+
+// get reads the album item with the given ID using a strongly consistent read.
+func (s *dynamoStore) get(ctx context.Context, id string) (dynamoItem, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            dynamoKey(id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return dynamoItem{}, err
+	}
+	var item dynamoItem
+	if out.Item == nil {
+		return item, errAlbumNotFound
+	}
+	if err := unmarshalDynamo(out.Item, &item); err != nil {
+		return item, err
+	}
+	if item.Kind != dynamoKindAlbum {
+		return item, errAlbumNotFound
+	}
+	return item, nil
+}
+
+// List scans the table for albums and returns them in creation order.
+func (s *dynamoStore) List(ctx context.Context) ([]Album, error) {
+	return s.scan(ctx, albumFilter{})
+}
+
+// Query scans the table for the albums selected by f and returns them in creation order. Price
+// bounds are applied by the scan's filter expression. DynamoDB cannot compare strings ignoring
+// case, so the artist is matched here.
+func (s *dynamoStore) Query(ctx context.Context, f albumFilter) ([]Album, error) {
+	all, err := s.scan(ctx, f)
+	if err != nil || f.Artist == "" {
+		return all, err
+	}
+	return filterAlbums(all, f.matches), nil
+}
+
+// scan reads every album item within f's price bounds and returns the albums in creation order.
+func (s *dynamoStore) scan(ctx context.Context, f albumFilter) ([]Album, error) {
+	items, err := s.scanItems(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]Album, len(items))
+	for i, item := range items {
+		all[i] = item.Album
+	}
+	return all, nil
+}
+
+// scanItems reads every album item within f's price bounds, in creation order.
+func (s *dynamoStore) scanItems(ctx context.Context, f albumFilter) ([]dynamoItem, error) {
+	filter := "#kind = :album"
+	names := map[string]string{"#kind": "kind"}
+	values := map[string]types.AttributeValue{":album": &types.AttributeValueMemberS{Value: dynamoKindAlbum}}
+	if f.MinPrice != nil {
+		filter += " AND #price >= :min_price"
+		names["#price"] = "price"
+		values[":min_price"] = &types.AttributeValueMemberN{Value: strconv.FormatFloat(*f.MinPrice, 'f', -1, 64)}
+	}
+	if f.MaxPrice != nil {
+		filter += " AND #price <= :max_price"
+		names["#price"] = "price"
+		values[":max_price"] = &types.AttributeValueMemberN{Value: strconv.FormatFloat(*f.MaxPrice, 'f', -1, 64)}
+	}
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:                 aws.String(s.table),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+
+	var items []dynamoItem
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range page.Items {
+			var item dynamoItem
+			if err := unmarshalDynamo(raw, &item); err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].CreatedAt < items[j].CreatedAt })
+	return items, nil
+}
+
+// Get returns the album with the given ID.
+func (s *dynamoStore) Get(ctx context.Context, id string) (Album, error) {
+	item, err := s.get(ctx, id)
+	return item.Album, err
+}
+
+// GetByUPC follows the barcode's marker item to its album.
+func (s *dynamoStore) GetByUPC(ctx context.Context, code string) (Album, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            dynamoKey(upcMarkerID(code)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return Album{}, err
+	}
+	albumID, ok := out.Item["album_id"].(*types.AttributeValueMemberS)
+	if !ok {
+		return Album{}, errAlbumNotFound
+	}
+	return s.Get(ctx, albumID.Value)
+}
+
+// putUPCMarker returns a transaction item reserving code for albumID. It fails if another album holds it.
+func (s *dynamoStore) putUPCMarker(code, albumID string) types.TransactWriteItem {
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"id":       &types.AttributeValueMemberS{Value: upcMarkerID(code)},
+			"kind":     &types.AttributeValueMemberS{Value: dynamoKindUPC},
+			"album_id": &types.AttributeValueMemberS{Value: albumID},
+		},
+		ConditionExpression:       aws.String("attribute_not_exists(id) OR album_id = :album_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":album_id": &types.AttributeValueMemberS{Value: albumID}},
+	}}
+}
+
+// deleteUPCMarker returns a transaction item releasing code.
+func (s *dynamoStore) deleteUPCMarker(code string) types.TransactWriteItem {
+	return types.TransactWriteItem{Delete: &types.Delete{
+		TableName: aws.String(s.table),
+		Key:       dynamoKey(upcMarkerID(code)),
+	}}
+}
+
+// albumNameMarkerID returns the ID of the marker item listing the albums whose title and artist
+// have the name key key.
+func albumNameMarkerID(key string) string {
+	return "album-name#" + key
+}
+
+// addAlbumNames returns a transaction item adding ids to the name marker of key. If unique is set,
+// it fails if the marker lists any album.
+func (s *dynamoStore) addAlbumNames(key string, ids []string, unique bool) types.TransactWriteItem {
+	update := &types.Update{
+		TableName:                aws.String(s.table),
+		Key:                      dynamoKey(albumNameMarkerID(key)),
+		UpdateExpression:         aws.String("SET #kind = :kind ADD album_ids :ids"),
+		ExpressionAttributeNames: map[string]string{"#kind": "kind"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":kind": &types.AttributeValueMemberS{Value: dynamoKindAlbumName},
+			":ids":  &types.AttributeValueMemberSS{Value: ids},
+		},
+	}
+	if unique {
+		update.ConditionExpression = aws.String("attribute_not_exists(album_ids)")
+	}
+	return types.TransactWriteItem{Update: update}
+}
+
+// removeAlbumNames returns a transaction item removing ids from the name marker of key. DynamoDB
+// drops the album_ids attribute once it is empty.
+func (s *dynamoStore) removeAlbumNames(key string, ids []string) types.TransactWriteItem {
+	return types.TransactWriteItem{Update: &types.Update{
+		TableName:                 aws.String(s.table),
+		Key:                       dynamoKey(albumNameMarkerID(key)),
+		UpdateExpression:          aws.String("DELETE album_ids :ids"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":ids": &types.AttributeValueMemberSS{Value: ids}},
+	}}
+}
+
+// duplicateOf returns a duplicateAlbumError naming an album other than a listed in the name
+// marker of a, or nil if it lists none.
+func (s *dynamoStore) duplicateOf(ctx context.Context, a Album) error {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            dynamoKey(albumNameMarkerID(albumNameKey(a.Title, a.Artist))),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return err
+	}
+	listed, _ := out.Item["album_ids"].(*types.AttributeValueMemberSS)
+	if listed == nil {
+		return nil
+	}
+	others := slices.DeleteFunc(slices.Clone(listed.Value), func(id string) bool { return id == a.ID })
+	if len(others) == 0 {
+		return nil
+	}
+	return duplicateAlbumError{ID: slices.Min(others)}
+}
+
+// indexAlbumNames adds the albums stored before name markers existed to them, once. Each album is
+// added in a transaction conditioned on its version, so one deleted or changed in the meantime,
+// which a write has already moved to the right marker, is skipped.
+func (s *dynamoStore) indexAlbumNames(ctx context.Context) error {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            dynamoKey(dynamoNamesIndexedID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || out.Item != nil {
+		return err
+	}
+	items, err := s.scanItems(ctx, albumFilter{})
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		_, err := s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: []types.TransactWriteItem{
+			{ConditionCheck: &types.ConditionCheck{
+				TableName:                aws.String(s.table),
+				Key:                      dynamoKey(item.ID),
+				ConditionExpression:      aws.String("#version = :version"),
+				ExpressionAttributeNames: map[string]string{"#version": "version"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(item.Version, 10)},
+				},
+			}},
+			s.addAlbumNames(albumNameKey(item.Title, item.Artist), []string{item.ID}, false),
+		}})
+		if err != nil && conditionFailedAt(err) < 0 {
+			return err
+		}
+	}
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: dynamoNamesIndexedID}},
+	})
+	return err
+}
+
+// transactError classifies a failed transaction: errUPCConflict if the condition on the UPC
+// marker at upcIndex failed, errDynamoConflict if the album's own condition failed.
+func transactError(err error, upcIndex int) error {
+	switch i := conditionFailedAt(err); {
+	case i < 0:
+		return err
+	case i == upcIndex:
+		return errUPCConflict
+	default:
+		return errDynamoConflict
+	}
+}
+
+// conditionFailedAt returns the index of the first item whose condition failed in the canceled
+// transaction err reports, or -1 if err reports none.
+func conditionFailedAt(err error) int {
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		return -1
+	}
+	for i, reason := range canceled.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			return i
+		}
+	}
+	return -1
+}
+
+// Create writes a new album, adds it to its name marker, and, if it has a barcode, writes its UPC
+// marker in one transaction.
+func (s *dynamoStore) Create(ctx context.Context, a Album) (Album, error) {
+	return s.create(ctx, a, false)
+}
+
+// CreateUnique creates the album like Create, on the condition that its name marker lists no album.
+func (s *dynamoStore) CreateUnique(ctx context.Context, a Album) (Album, error) {
+	return s.create(ctx, a, true)
+}
+
+// create writes a new album, requiring its name marker to be empty if unique is set. If the
+// albums the marker listed are gone by the time it is read, the create is retried.
+func (s *dynamoStore) create(ctx context.Context, a Album, unique bool) (Album, error) {
+	item, err := marshalDynamo(dynamoItem{Album: a, Kind: dynamoKindAlbum, Version: 1, CreatedAt: time.Now().UnixNano()})
+	if err != nil {
+		return Album{}, err
+	}
+	const nameIndex = 1
+	writes := []types.TransactWriteItem{
+		{Put: &types.Put{
+			TableName:           aws.String(s.table),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		}},
+		s.addAlbumNames(albumNameKey(a.Title, a.Artist), []string{a.ID}, unique),
+	}
+	upcIndex := -1
+	if a.UPC != "" {
+		upcIndex = len(writes)
+		writes = append(writes, s.putUPCMarker(a.UPC, a.ID))
+	}
+
+	for attempt := 0; attempt < dynamoMaxAttempts; attempt++ {
+		_, err := s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+		if conditionFailedAt(err) != nameIndex {
+			if err != nil {
+				return Album{}, transactError(err, upcIndex)
+			}
+			return a, nil
+		}
+		if err := s.duplicateOf(ctx, a); err != nil {
+			return Album{}, err
+		}
+	}
+	return Album{}, errDynamoConflict
+}
+
+// Update reads the album, applies mutate, and writes it back on the condition that its version
+// has not changed, moving the UPC and name markers in the same transaction. The read-modify-write
+// is retried if another writer got there first.
+func (s *dynamoStore) Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, false)
+}
+
+// UpdateUnique updates the album like Update, on the condition that, if mutate changes its title or
+// artist, the new name marker lists no album.
+func (s *dynamoStore) UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, true)
+}
+
+// update applies mutate to the album, requiring its new name marker to be empty if unique is set
+// and the name changed.
+func (s *dynamoStore) update(ctx context.Context, id string, mutate func(*Album) error, unique bool) (Album, error) {
+	for attempt := 0; attempt < dynamoMaxAttempts; attempt++ {
+		current, err := s.get(ctx, id)
+		if err != nil {
+			return Album{}, err
+		}
+		updated := current
+		if err := mutate(&updated.Album); err != nil {
+			return Album{}, err
+		}
+		updated.ID = id
+		updated.Version = current.Version + 1
+
+		item, err := marshalDynamo(updated)
+		if err != nil {
+			return Album{}, err
+		}
+		writes := []types.TransactWriteItem{{Put: &types.Put{
+			TableName:                aws.String(s.table),
+			Item:                     item,
+			ConditionExpression:      aws.String("#version = :version"),
+			ExpressionAttributeNames: map[string]string{"#version": "version"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(current.Version, 10)},
+			},
+		}}}
+		nameIndex := -1
+		if oldKey, newKey := albumNameKey(current.Title, current.Artist), albumNameKey(updated.Title, updated.Artist); oldKey != newKey {
+			nameIndex = len(writes)
+			writes = append(writes, s.addAlbumNames(newKey, []string{id}, unique), s.removeAlbumNames(oldKey, []string{id}))
+		}
+		upcIndex := -1
+		if oldUPC, newUPC := current.UPC, updated.UPC; oldUPC == "" || newUPC == "" || normalizeUPC(oldUPC) != normalizeUPC(newUPC) {
+			if newUPC != "" {
+				upcIndex = len(writes)
+				writes = append(writes, s.putUPCMarker(newUPC, id))
+			}
+			if oldUPC != "" {
+				writes = append(writes, s.deleteUPCMarker(oldUPC))
+			}
+		}
+
+		_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+		if err == nil {
+			return updated.Album, nil
+		}
+		if nameIndex >= 0 && conditionFailedAt(err) == nameIndex {
+			if err := s.duplicateOf(ctx, updated.Album); err != nil {
+				return Album{}, err
+			}
+			continue
+		}
+		if err = transactError(err, upcIndex); !errors.Is(err, errDynamoConflict) {
+			return Album{}, err
+		}
+	}
+	return Album{}, errDynamoConflict
+}
+
+// Delete removes the album, its UPC marker, and its name marker entry, conditioned on the album
+// not changing in between.
+func (s *dynamoStore) Delete(ctx context.Context, id string) (Album, error) {
+	for attempt := 0; attempt < dynamoMaxAttempts; attempt++ {
+		current, err := s.get(ctx, id)
+		if err != nil {
+			return Album{}, err
+		}
+		writes := []types.TransactWriteItem{{Delete: &types.Delete{
+			TableName:                aws.String(s.table),
+			Key:                      dynamoKey(id),
+			ConditionExpression:      aws.String("#version = :version"),
+			ExpressionAttributeNames: map[string]string{"#version": "version"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(current.Version, 10)},
+			},
+		}}}
+		writes = append(writes, s.removeAlbumNames(albumNameKey(current.Title, current.Artist), []string{id}))
+		if current.UPC != "" {
+			writes = append(writes, s.deleteUPCMarker(current.UPC))
+		}
+
+		_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+		if err == nil {
+			return current.Album, nil
+		}
+		if err = transactError(err, -1); !errors.Is(err, errDynamoConflict) {
+			return Album{}, err
+		}
+	}
+	return Album{}, errDynamoConflict
+}
+
+// artistItemID returns the ID of the item holding artist id.
+func artistItemID(id string) string {
+	return "artist#" + id
+}
+
+// artistNameMarkerID returns the ID of the marker item reserving an artist name.
+func artistNameMarkerID(name string) string {
+	return "artist-name#" + artistKey(name)
+}
+
+// getArtist reads the artist item with the given ID using a strongly consistent read.
+func (s *dynamoStore) getArtist(ctx context.Context, id string) (dynamoArtist, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            dynamoKey(artistItemID(id)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return dynamoArtist{}, err
+	}
+	var item dynamoArtist
+	if out.Item == nil {
+		return item, errArtistNotFound
+	}
+	if err := unmarshalDynamo(out.Item, &item); err != nil {
+		return item, err
+	}
+	if item.Kind != dynamoKindArtist {
+		return item, errArtistNotFound
+	}
+	return item, nil
+}
+
+// artistNameOwner returns the ID of the artist holding name's marker, or "" if none does.
+func (s *dynamoStore) artistNameOwner(ctx context.Context, name string) (string, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            dynamoKey(artistNameMarkerID(name)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	artistID, _ := out.Item["artist_id"].(*types.AttributeValueMemberS)
+	if artistID == nil {
+		return "", nil
+	}
+	return artistID.Value, nil
+}
+
+// ListArtists scans the table for artists.
+func (s *dynamoStore) ListArtists(ctx context.Context) ([]Artist, error) {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:                 aws.String(s.table),
+		FilterExpression:          aws.String("#kind = :artist"),
+		ExpressionAttributeNames:  map[string]string{"#kind": "kind"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":artist": &types.AttributeValueMemberS{Value: dynamoKindArtist}},
+	})
+	artists := []Artist{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range page.Items {
+			var item dynamoArtist
+			if err := unmarshalDynamo(raw, &item); err != nil {
+				return nil, err
+			}
+			artists = append(artists, item.Artist)
+		}
+	}
+	return artists, nil
+}
+
+// GetArtist returns the artist with the given ID.
+func (s *dynamoStore) GetArtist(ctx context.Context, id string) (Artist, error) {
+	item, err := s.getArtist(ctx, id)
+	return item.Artist, err
+}
+
+// ArtistNamed follows the name's marker item to its artist.
+func (s *dynamoStore) ArtistNamed(ctx context.Context, name string) (Artist, error) {
+	id, err := s.artistNameOwner(ctx, name)
+	if err != nil {
+		return Artist{}, err
+	}
+	if id == "" {
+		return Artist{}, errArtistNotFound
+	}
+	return s.GetArtist(ctx, id)
+}
+
+// putArtistNameMarker returns a transaction item reserving name for artistID. It fails if another
+// artist holds it.
+func (s *dynamoStore) putArtistNameMarker(name, artistID string) types.TransactWriteItem {
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"id":        &types.AttributeValueMemberS{Value: artistNameMarkerID(name)},
+			"kind":      &types.AttributeValueMemberS{Value: dynamoKindArtistName},
+			"artist_id": &types.AttributeValueMemberS{Value: artistID},
+		},
+		ConditionExpression:       aws.String("attribute_not_exists(id) OR artist_id = :artist_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":artist_id": &types.AttributeValueMemberS{Value: artistID}},
+	}}
+}
+
+// artistExists returns the artistExistsError for artist, which a transaction could not write as
+// its name or ID was taken: naming the artist holding its name, or else artist itself.
+func (s *dynamoStore) artistExists(ctx context.Context, artist Artist) error {
+	owner, err := s.artistNameOwner(ctx, artist.Name)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != artist.ID {
+		return artistExistsError{owner}
+	}
+	return artistExistsError{artist.ID}
+}
+
+// CreateArtist writes a new artist item and its name marker in one transaction.
+func (s *dynamoStore) CreateArtist(ctx context.Context, artist Artist) error {
+	item, err := marshalDynamo(dynamoArtist{Key: artistItemID(artist.ID), Kind: dynamoKindArtist, Artist: artist, Version: 1})
+	if err != nil {
+		return err
+	}
+	marker := s.putArtistNameMarker(artist.Name, artist.ID)
+	marker.Put.ConditionExpression = aws.String("attribute_not_exists(id)")
+	marker.Put.ExpressionAttributeValues = nil
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: []types.TransactWriteItem{
+		{Put: &types.Put{TableName: aws.String(s.table), Item: item, ConditionExpression: aws.String("attribute_not_exists(id)")}},
+		marker,
+	}})
+	if conditionFailedAt(err) >= 0 {
+		return s.artistExists(ctx, artist)
+	}
+	return err
+}
+
+// putVersioned returns a transaction item writing item on the condition that the stored item's
+// version is still version.
+func (s *dynamoStore) putVersioned(item map[string]types.AttributeValue, version int64) types.TransactWriteItem {
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName:                aws.String(s.table),
+		Item:                     item,
+		ConditionExpression:      aws.String("#version = :version"),
+		ExpressionAttributeNames: map[string]string{"#version": "version"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+		},
+	}}
+}
+
+// dynamoNameMoves collects the albums a transaction moves between name markers, by name key, so
+// that each marker is written once, as a transaction may not write an item twice.
+type dynamoNameMoves struct {
+	added, removed map[string][]string
+}
+
+// cost returns how many more markers moving an album from the name key from to to writes, or -1 if
+// it would both add to and remove from one marker.
+func (m dynamoNameMoves) cost(from, to string) int {
+	if from == to {
+		return 0
+	}
+	_, addedFrom := m.added[from]
+	_, removedTo := m.removed[to]
+	if addedFrom || removedTo {
+		return -1
+	}
+	n := 0
+	if _, ok := m.removed[from]; !ok {
+		n++
+	}
+	if _, ok := m.added[to]; !ok {
+		n++
+	}
+	return n
+}
+
+// move records moving album id from the name key from to to.
+func (m dynamoNameMoves) move(id, from, to string) {
+	if from != to {
+		m.removed[from] = append(m.removed[from], id)
+		m.added[to] = append(m.added[to], id)
+	}
+}
+
+// len returns the number of markers the moves write.
+func (m dynamoNameMoves) len() int {
+	return len(m.added) + len(m.removed)
+}
+
+// RenameArtist writes the renamed artist, moves its name marker, and writes its renamed albums,
+// moving them between album name markers, in one transaction, each conditioned on its version,
+// retrying if another writer got there first.
+// A transaction holds at most dynamoMaxTransactItems items, so the albums that do not fit are
+// renamed one at a time once it commits; if that fails partway, renaming the artist again, even
+// to the same name, renames them.
+func (s *dynamoStore) RenameArtist(ctx context.Context, id, name string, rename func(*Album)) (Artist, []albumChange, error) {
+	for attempt := 0; attempt < dynamoMaxAttempts; attempt++ {
+		current, err := s.getArtist(ctx, id)
+		if err != nil {
+			return Artist{}, nil, err
+		}
+		renamed := current
+		renamed.Artist = renamedArtist(current.Artist, name, time.Now().UTC())
+		renamed.Version = current.Version + 1
+		if owner, err := s.artistNameOwner(ctx, name); err != nil || (owner != "" && owner != id) {
+			if err == nil {
+				err = artistExistsError{owner}
+			}
+			return Artist{}, nil, err
+		}
+		items, err := s.scanItems(ctx, albumFilter{})
+		if err != nil {
+			return Artist{}, nil, err
+		}
+
+		item, err := marshalDynamo(renamed)
+		if err != nil {
+			return Artist{}, nil, err
+		}
+		writes := []types.TransactWriteItem{s.putVersioned(item, current.Version)}
+		nameIndex := -1
+		if artistKey(current.Artist.Name) != artistKey(name) {
+			nameIndex = len(writes)
+			writes = append(writes, s.putArtistNameMarker(name, id), types.TransactWriteItem{Delete: &types.Delete{
+				TableName: aws.String(s.table),
+				Key:       dynamoKey(artistNameMarkerID(current.Artist.Name)),
+			}})
+		}
+		var changes, later []albumChange
+		moves := dynamoNameMoves{added: map[string][]string{}, removed: map[string][]string{}}
+		for _, item := range items {
+			if albumArtistID(item.Album) != id {
+				continue
+			}
+			updated := item
+			rename(&updated.Album)
+			updated.ID = item.ID
+			updated.Version = item.Version + 1
+			change := albumChange{Album: updated.Album, Previous: item.Album}
+			from, to := albumNameKey(item.Title, item.Artist), albumNameKey(updated.Title, updated.Artist)
+			cost := moves.cost(from, to)
+			if cost < 0 || len(writes)+moves.len()+cost+1 > dynamoMaxTransactItems {
+				later = append(later, change)
+				continue
+			}
+			encoded, err := marshalDynamo(updated)
+			if err != nil {
+				return Artist{}, nil, err
+			}
+			writes = append(writes, s.putVersioned(encoded, item.Version))
+			moves.move(item.ID, from, to)
+			changes = append(changes, change)
+		}
+		for key, ids := range moves.added {
+			writes = append(writes, s.addAlbumNames(key, ids, false))
+		}
+		for key, ids := range moves.removed {
+			writes = append(writes, s.removeAlbumNames(key, ids))
+		}
+
+		_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: writes})
+		if i := conditionFailedAt(err); i >= 0 && i == nameIndex {
+			return Artist{}, nil, s.artistExists(ctx, renamed.Artist)
+		} else if i >= 0 {
+			continue
+		}
+		if err != nil {
+			return Artist{}, nil, err
+		}
+		for _, change := range later {
+			updated, err := s.Update(ctx, change.ID, func(a *Album) error {
+				if albumArtistID(*a) == id {
+					rename(a)
+				}
+				return nil
+			})
+			if errors.Is(err, errAlbumNotFound) {
+				continue
+			}
+			if err != nil {
+				return renamed.Artist, changes, err
+			}
+			changes = append(changes, albumChange{Album: updated, Previous: change.Previous})
+		}
+		return renamed.Artist, changes, nil
+	}
+	return Artist{}, nil, errDynamoConflict
+}
+
+// DeleteArtist deletes the artist item and its name marker in one transaction, conditioned on the
+// artist not changing after the albums were checked.
+func (s *dynamoStore) DeleteArtist(ctx context.Context, id string) (Artist, error) {
+	for attempt := 0; attempt < dynamoMaxAttempts; attempt++ {
+		current, err := s.getArtist(ctx, id)
+		if err != nil {
+			return Artist{}, err
+		}
+		albums, err := s.scan(ctx, albumFilter{})
+		if err != nil {
+			return Artist{}, err
+		}
+		if slices.ContainsFunc(albums, func(a Album) bool { return albumArtistID(a) == id }) {
+			return Artist{}, errArtistHasAlbums
+		}
+
+		_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: []types.TransactWriteItem{
+			{Delete: &types.Delete{
+				TableName:                aws.String(s.table),
+				Key:                      dynamoKey(artistItemID(id)),
+				ConditionExpression:      aws.String("#version = :version"),
+				ExpressionAttributeNames: map[string]string{"#version": "version"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(current.Version, 10)},
+				},
+			}},
+			{Delete: &types.Delete{TableName: aws.String(s.table), Key: dynamoKey(artistNameMarkerID(current.Artist.Name))}},
+		}})
+		if conditionFailedAt(err) >= 0 {
+			continue
+		}
+		if err != nil {
+			return Artist{}, err
+		}
+		return current.Artist, nil
+	}
+	return Artist{}, errDynamoConflict
+}
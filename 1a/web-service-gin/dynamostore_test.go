@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TestDynamoItemEncoding tests the DynamoDB item encoding.
+// Verifies that album fields are flattened under their JSON names alongside the bookkeeping
+// attributes, that empty optional fields are omitted, and that the item decodes back.
+func TestDynamoItemEncoding(t *testing.T) {
+	in := dynamoItem{
+		Album:   Album{ID: "a", Title: "Blue Train", Artist: "John Coltrane", Price: 56.99},
+		Kind:    dynamoKindAlbum,
+		Version: 3,
+	}
+	item, err := marshalDynamo(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"id", "title", "artist", "price", "kind", "version"} {
+		if _, ok := item[name]; !ok {
+			t.Errorf("Expected attribute %q, got %v", name, item)
+		}
+	}
+	if _, ok := item["upc"]; ok {
+		t.Error("Expected empty upc to be omitted")
+	}
+
+	var out dynamoItem
+	if err := unmarshalDynamo(item, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Expected %+v, got %+v", in, out)
+	}
+}
+
+// TestDynamoNameMoves tests grouping the album name marker writes of a transaction.
+// Verifies that albums moving between the same names share their markers, that a move keeping its
+// name writes none, and that a move that would add to a marker another removes from is refused.
+func TestDynamoNameMoves(t *testing.T) {
+	moves := dynamoNameMoves{added: map[string][]string{}, removed: map[string][]string{}}
+	if cost := moves.cost("old", "new"); cost != 2 {
+		t.Errorf("Expected the first move to write 2 markers, got %d", cost)
+	}
+	moves.move("a", "old", "new")
+	if cost := moves.cost("old", "new"); cost != 0 {
+		t.Errorf("Expected a second move between the same names to share their markers, got %d", cost)
+	}
+	moves.move("b", "old", "new")
+	if cost := moves.cost("same", "same"); cost != 0 {
+		t.Errorf("Expected a move keeping its name to write no markers, got %d", cost)
+	}
+	if cost := moves.cost("new", "other"); cost != -1 {
+		t.Errorf("Expected a move out of a marker being added to to be refused, got %d", cost)
+	}
+	if moves.len() != 2 || !reflect.DeepEqual(moves.added["new"], []string{"a", "b"}) {
+		t.Errorf("Expected one marker each way listing both albums, got %+v", moves)
+	}
+}
+
+// TestDynamoStore tests the DynamoDB AlbumStore against DynamoDB Local, using a temporary table.
+// It is skipped unless DYNAMODB_TEST_ENDPOINT is set (e.g. http://localhost:8000).
+func TestDynamoStore(t *testing.T) {
+	endpoint := os.Getenv("DYNAMODB_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_TEST_ENDPOINT not set")
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	cfg := loadConfig()
+	cfg.DynamoEndpoint = endpoint
+	cfg.DynamoRegion = "us-west-2"
+	cfg.DynamoTable = fmt.Sprintf("albums-test-%d", time.Now().UnixNano())
+
+	client := dynamodb.New(dynamodb.Options{
+		Region:       cfg.DynamoRegion,
+		BaseEndpoint: aws.String(endpoint),
+		Credentials:  aws.AnonymousCredentials{},
+	})
+	ctx := context.Background()
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String(cfg.DynamoTable),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(cfg.DynamoTable)})
+
+	s, err := newDynamoStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAlbumStore(t, s)
+	testUniqueAlbumNames(t, s)
+	testArtistStore(t, s)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Album event types published by the handlers.
+const (
+	eventAlbumCreated = "album.created"
+	eventAlbumUpdated = "album.updated"
+	eventAlbumDeleted = "album.deleted"
+)
+
+// albumEvent describes a change to an album.
+type albumEvent struct {
+	Type string
+	// Album is the album after the change, or the removed album for deletions.
+	Album Album
+	// Previous is the album before the change. It is only set for updates.
+	Previous *Album
+	// Tenant is the tenant whose album changed, or "" for the default backend.
+	Tenant string
+	// Actor and RequestID identify the request that made the change; both are "" for changes made
+	// in the background.
+	Actor     string
+	RequestID string
+	At        time.Time
+}
+
+// publishAlbumEvent delivers an event of the given type, for the tenant and request in ctx, to every
+// subscriber of srv. Subscribers run on the request goroutine, so they must return quickly and hand
+// any slow work off to another goroutine.
+func (srv *Server) publishAlbumEvent(ctx context.Context, eventType string, album Album, previous *Album) {
+	if len(srv.subscribers) == 0 {
+		return
+	}
+	evt := albumEvent{
+		Type:      eventType,
+		Album:     album,
+		Previous:  previous,
+		Tenant:    tenantFrom(ctx),
+		Actor:     identityFrom(ctx).Actor,
+		RequestID: requestIDFrom(ctx),
+		At:        time.Now(),
+	}
+	for _, subscriber := range srv.subscribers {
+		subscriber(evt)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestExportAlbums tests GET /albums/export.
+// Verifies that both formats contain every album with a download file name, that CSV starts with
+// the header row, and that an unknown format returns HTTP 400.
+func TestExportAlbums(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := srv.do("GET", "/albums/export?format="+"ndjson", "")
+	if w.Code != 200 || w.Header().Get("Content-Type") != "application/x-ndjson" ||
+		!strings.HasSuffix(w.Header().Get("Content-Disposition"), `.ndjson"`) {
+		t.Fatalf("Unexpected NDJSON response %d: %v", w.Code, w.Header())
+	}
+	var titles []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var a Album
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			t.Fatalf("Invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		titles = append(titles, a.Title)
+	}
+	if len(titles) != 3 || titles[0] != "Blue Train" {
+		t.Errorf("Expected the three albums in order, got %v", titles)
+	}
+
+	w = srv.do("GET", "/albums/export?format="+"csv", "")
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != 200 || len(records) != 4 || strings.Join(records[0], ",") != strings.Join(exportColumns, ",") {
+		t.Fatalf("Unexpected CSV export %d: %v", w.Code, records)
+	}
+	if got := records[2]; got[1] != "Jeru" || got[2] != "Gerry Mulligan" || got[3] != "17.99" {
+		t.Errorf("Unexpected CSV row %v", got)
+	}
+
+	if w := srv.do("GET", "/albums/export?format="+"xml", ""); w.Code != 400 {
+		t.Errorf("Expected 400 for an unknown format, got %d", w.Code)
+	}
+}
+
+// TestCSVRecord tests that tags and metadata are flattened into single CSV cells.
+func TestCSVRecord(t *testing.T) {
+	record, err := csvRecord(Album{ID: "1", Title: "Kind of Blue", Tags: []string{"jazz", "modal"}, Metadata: map[string]string{"label": "Columbia"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record[5] != "jazz;modal" || record[6] != `{"label":"Columbia"}` || record[4] != "" {
+		t.Errorf("Unexpected record %q", record)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Entry counts for GET /albums/feed.atom.
+const (
+	defaultFeedEntries = 20
+	maxFeedEntries     = 100
+)
+
+// atomFeed is an Atom (RFC 4287) feed document.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomLink is an Atom link element.
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// atomEntry is one album in the feed.
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Author  atomAuthor `xml:"author"`
+	Links   []atomLink `xml:"link"`
+	Summary string     `xml:"summary"`
+}
+
+// atomAuthor is an Atom person construct.
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// requestBaseURL returns the scheme and host the client used to reach the server, e.g. "http://localhost:8080".
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// atomTime formats t as an Atom date.
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// getAlbumFeed handles GET /albums/feed.atom requests.
+// Returns the most recently added active albums, newest first, as an Atom feed with HTTP 200 status.
+// Each entry's updated time is the album's updated_at; the feed's is the latest change to the collection.
+// The optional limit parameter sets the number of entries (default 20, at most 100).
+// Returns HTTP 304 if nothing changed since If-Modified-Since, or HTTP 400 if limit is invalid.
+func (srv *Server) getAlbumFeed(c *gin.Context) {
+	limit := defaultFeedEntries
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxFeedEntries {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be an integer between 1 and %d", maxFeedEntries)})
+			return
+		}
+		limit = n
+	}
+
+	all, err := srv.store.List(c.Request.Context())
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	modified := srv.collectionModified(all)
+	if notModified(c, modified) {
+		return
+	}
+
+	base := requestBaseURL(c)
+	feed := atomFeed{
+		ID:      base + "/albums",
+		Title:   "Recently added albums",
+		Updated: atomTime(modified),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + c.Request.URL.RequestURI()},
+			{Rel: "alternate", Type: "application/json", Href: base + requestAPIPrefix(c) + "/albums"},
+		},
+	}
+	all = filterAlbums(all, albumStates["active"])
+	// List returns albums in insertion order, so the newest are at the end.
+	for i := len(all) - 1; i >= 0 && len(feed.Entries) < limit; i-- {
+		a := all[i]
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      "urn:uuid:" + a.ID,
+			Title:   a.Title,
+			Updated: atomTime(a.UpdatedAt),
+			Author:  atomAuthor{Name: a.Artist},
+			Links:   []atomLink{{Rel: "alternate", Type: "application/json", Href: base + requestAPIPrefix(c) + "/albums/" + a.ID}},
+			Summary: fmt.Sprintf("%s by %s, $%.2f", a.Title, a.Artist, a.Price),
+		})
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to render feed"})
+		return
+	}
+	c.Data(http.StatusOK, "application/atom+xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestAlbumFeed tests the GET /albums/feed.atom endpoint.
+// Verifies the content type, that entries are newest first and limited, and that links use the request host.
+func TestAlbumFeed(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := srv.do("GET", "/albums/feed.atom?limit=2", "", "Host", "albums.example.com")
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+		t.Errorf("Expected an Atom content type, got %q", ct)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Entries) != 2 || feed.Entries[0].Title != "Sarah Vaughan and Clifford Brown" || feed.Entries[1].Title != "Jeru" {
+		t.Errorf("Expected the 2 newest albums, newest first, got %+v", feed.Entries)
+	}
+	if href := feed.Entries[1].Links[0].Href; href != "http://albums.example.com/albums/550e8400-e29b-41d4-a716-446655440002" {
+		t.Errorf("Expected an absolute album link, got %q", href)
+	}
+	if feed.Updated == "" || feed.Entries[0].Updated == "" {
+		t.Errorf("Expected updated timestamps, got %+v", feed)
+	}
+	if w.Header().Get("Last-Modified") == "" {
+		t.Error("Expected a Last-Modified header")
+	}
+
+	for _, limit := range []string{"0", "101", "ten"} {
+		w := srv.do("GET", "/albums/feed.atom?limit="+limit, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: expected 400, got %d", limit, w.Code)
+		}
+	}
+}
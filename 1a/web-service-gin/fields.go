@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fieldsKey is the gin context key holding the album fields selected with ?fields=.
+type fieldsKey struct{}
+
+// linksField is the name ?fields= selects an album's _links section by.
+const linksField = "_links"
+
+// fieldsMiddleware reads the fields query parameter, a comma-separated list of album fields in the
+// given API version (or _links), and makes albums in the response include only those.
+// Returns HTTP 400 if a field is unknown or the list is empty.
+func fieldsMiddleware(version int) gin.HandlerFunc {
+	known := append(albumFieldNames(version), linksField)
+	return func(c *gin.Context) {
+		raw, ok := c.GetQuery("fields")
+		if !ok {
+			c.Next()
+			return
+		}
+		var fields []string
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || slices.Contains(fields, name) {
+				continue
+			}
+			if !slices.Contains(known, name) {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("fields: unknown album field %q; fields are %s", name, strings.Join(known, ", "))})
+				c.Abort()
+				return
+			}
+			fields = append(fields, name)
+		}
+		if len(fields) == 0 {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "fields must list at least one album field"})
+			c.Abort()
+			return
+		}
+		c.Set(fieldsKey{}, fields)
+		c.Next()
+	}
+}
+
+// selectedFields returns the album fields selected with ?fields=, or nil if none were.
+func selectedFields(c *gin.Context) []string {
+	fields, _ := c.Get(fieldsKey{})
+	selected, _ := fields.([]string)
+	return selected
+}
+
+// selectFields removes every field but those selected with ?fields= from album, the JSON object
+// of an album. Does nothing if no fields were selected.
+func selectFields(c *gin.Context, album map[string]any) {
+	fields := selectedFields(c)
+	if fields == nil {
+		return
+	}
+	for name := range album {
+		if !slices.Contains(fields, name) {
+			delete(album, name)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+)
+
+// TestSparseFieldsets tests GET /albums?fields=.
+// Verifies that listed albums and single albums only have the selected fields, that _links can be
+// selected, that render pipelines still apply, and that unknown fields are rejected with 400.
+func TestSparseFieldsets(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.RenderPipelines = "/albums=price_display" })
+
+	var albums []map[string]any
+	w := srv.do("GET", "/albums?fields=id,title", "")
+	json.Unmarshal(w.Body.Bytes(), &albums)
+	if w.Code != 200 || len(albums) != 3 {
+		t.Fatalf("Expected 3 albums, got %d: %s", w.Code, w.Body)
+	}
+	for _, a := range albums {
+		if keys := slices.Sorted(maps.Keys(a)); !slices.Equal(keys, []string{"id", "title"}) {
+			t.Errorf("Expected only id and title, got %v", keys)
+		}
+	}
+
+	var album map[string]any
+	json.Unmarshal(srv.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440001?fields=price,_links", "").Body.Bytes(), &album)
+	if keys := slices.Sorted(maps.Keys(album)); !slices.Equal(keys, []string{"_links", "price"}) || album["price"] != 56.99 {
+		t.Errorf("Expected only price and _links, got %v", album)
+	}
+
+	var page struct {
+		Albums []map[string]any `json:"albums"`
+	}
+	json.Unmarshal(srv.do("GET", "/albums?page_size=1&fields=artist", "").Body.Bytes(), &page)
+	if len(page.Albums) != 1 || len(page.Albums[0]) != 1 || page.Albums[0]["artist"] != "John Coltrane" {
+		t.Errorf("Expected a page of artists only, got %v", page.Albums)
+	}
+
+	for _, query := range []string{"fields=id,price_display", "fields=nope", "fields=,"} {
+		if w := srv.do("GET", "/albums?"+query, ""); w.Code != 400 {
+			t.Errorf("Expected 400 for %s, got %d", query, w.Code)
+		}
+	}
+}
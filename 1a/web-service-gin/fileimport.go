@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// importRow is one album read from an uploaded file: the line it starts on, and the album or why
+// it could not be read.
+type importRow struct {
+	Line  int
+	Album Album
+	Err   string
+}
+
+// importRowError reports a row of an uploaded file that was not imported.
+type importRowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// albumFileParser reads the albums in an uploaded file. Problems with single rows are reported in
+// the rows; an error means the file as a whole cannot be read.
+type albumFileParser func(data []byte) ([]importRow, error)
+
+// albumFileFormats are the file formats accepted by multipart POST /albums/import, keyed by the
+// format parameter or the file's extension.
+var albumFileFormats = map[string]albumFileParser{
+	"csv":  parseAlbumCSV,
+	"json": parseAlbumJSON,
+}
+
+// requiredCSVColumns must appear in the header row of an imported CSV file.
+var requiredCSVColumns = []string{"title", "artist", "price"}
+
+// parseAlbumCSV reads a CSV file whose header row names the album fields in its columns, as
+// written by GET /albums/export?format=csv. title, artist, and price are required; currency, upc, genre,
+// year, quantity, tags (separated by semicolons), and metadata (a JSON object) are optional, and other columns are ignored.
+func parseAlbumCSV(data []byte) ([]importRow, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header row: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range requiredCSVColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("header row has no %s column", name)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, importRow{Line: parseErr.StartLine, Err: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		row := importRow{Line: line}
+		if len(record) != len(header) {
+			row.Err = fmt.Sprintf("expected %d fields, got %d", len(header), len(record))
+		} else {
+			row.Album, row.Err = csvAlbum(record, columns)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// csvAlbum builds an album from a CSV record whose columns are located by columns.
+// Returns an error message if price, year, quantity, or metadata cannot be parsed.
+func csvAlbum(record []string, columns map[string]int) (Album, string) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	a := Album{Title: field("title"), Artist: field("artist"), ArtistID: field("artist_id"), Currency: field("currency"), UPC: field("upc"), Genre: field("genre")}
+	price, err := strconv.ParseFloat(field("price"), 64)
+	if err != nil {
+		return Album{}, "price must be a number"
+	}
+	a.Price = price
+	if year := field("year"); year != "" {
+		if a.Year, err = strconv.Atoi(year); err != nil {
+			return Album{}, "year must be a whole number"
+		}
+	}
+	if quantity := field("quantity"); quantity != "" {
+		n, err := strconv.Atoi(quantity)
+		if err != nil {
+			return Album{}, "quantity must be a whole number"
+		}
+		a.Quantity = &n
+	}
+	if tags := field("tags"); tags != "" {
+		a.Tags = strings.Split(tags, ";")
+	}
+	if metadata := field("metadata"); metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &a.Metadata); err != nil {
+			return Album{}, "metadata must be a JSON object of strings"
+		}
+	}
+	return a, ""
+}
+
+// parseAlbumJSON reads a JSON array of albums in the request format of POST /albums.
+// Elements that are not albums are reported as rows; a file that is not a JSON array is an error.
+func parseAlbumJSON(data []byte) ([]importRow, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, errors.New("file must contain a JSON array of albums")
+	}
+	var rows []importRow
+	for dec.More() {
+		start := int(dec.InputOffset())
+		for start < len(data) && strings.ContainsRune(" \t\r\n,", rune(data[start])) {
+			start++
+		}
+		row := importRow{Line: 1 + bytes.Count(data[:start], []byte("\n"))}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("line %d: %w", row.Line, err)
+		}
+		if err := json.Unmarshal(raw, &row.Album); err != nil {
+			row.Err = "Invalid album: " + err.Error()
+		}
+		rows = append(rows, row)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// importAlbumFile handles multipart POST /albums/import requests, whose "file" part is a CSV file
+// or a JSON array of albums (see parseAlbumCSV and parseAlbumJSON). The format is taken from the
+// format parameter, or else the file name's extension.
+// Each row is validated and created like a POST /albums body, independently of the others, and
+// the response is {"imported": n, "rejected": n, "errors": [{"line": 3, "error": "..."}]} with
+// HTTP 200 status, listing why each rejected row was not created.
+// Returns HTTP 400 if there is no file part, the format is unknown, or the file cannot be read as a
+// whole, e.g. a CSV file without a header row. ?allow_duplicate=true works as for POST /albums.
+func (srv *Server) importAlbumFile(c *gin.Context) {
+	allowDuplicate, errMsg := parseAllowDuplicate(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Upload the albums as the multipart field \"file\"", "details": err.Error()})
+		return
+	}
+	format := c.Query("format")
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	}
+	parse, ok := albumFileFormats[format]
+	if !ok {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+	f, err := header.Open()
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid file", "details": err.Error()})
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid file", "details": err.Error()})
+		return
+	}
+	rows, err := parse(data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid file", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	rejected := []importRowError{}
+	for i, row := range rows {
+		reportProgress(ctx, i, len(rows))
+		if row.Err == "" {
+			if _, err := srv.linkArtist(ctx, &row.Album, false); err != nil {
+				_, row.Err = createFailure(err)
+			}
+		}
+		if row.Err == "" {
+			if err := validateAlbum(&row.Album, srv.cfg.Genres); err != nil {
+				_, row.Err = createFailure(err)
+			}
+		}
+		if row.Err == "" {
+			if _, err := srv.applyPricing(&row.Album, nil); err != nil {
+				_, row.Err = createFailure(err)
+			}
+		}
+		if row.Err != "" {
+			rejected = append(rejected, importRowError{row.Line, row.Err})
+			continue
+		}
+		prepareNewAlbum(&row.Album)
+		created, _, err := srv.createAlbum(ctx, row.Album, allowDuplicate)
+		if err != nil {
+			_, errMsg := createFailure(err)
+			rejected = append(rejected, importRowError{row.Line, errMsg})
+			continue
+		}
+		srv.publishAlbumEvent(ctx, eventAlbumCreated, created, nil)
+	}
+	reportProgress(ctx, len(rows), len(rows))
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"imported": len(rows) - len(rejected),
+		"rejected": len(rejected),
+		"errors":   rejected,
+	})
+}
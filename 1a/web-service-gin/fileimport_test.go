@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fileImportResult is the response body of a multipart POST /albums/import.
+type fileImportResult struct {
+	Imported int              `json:"imported"`
+	Rejected int              `json:"rejected"`
+	Errors   []importRowError `json:"errors"`
+}
+
+// uploadImport sends content as the file part, named filename, of a multipart POST /albums/import.
+func uploadImport(t *testing.T, srv *Server, filename, content string) (*httptest.ResponseRecorder, fileImportResult) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	mw.Close()
+	w := srv.do("POST", "/albums/import", body.String(), "Content-Type", mw.FormDataContentType())
+	var result fileImportResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	return w, result
+}
+
+// TestImportCSVFile tests importing a CSV upload.
+// Verifies that valid rows are created with their tags and metadata, and that invalid rows, UPC
+// conflicts, and rows with the wrong number of fields are rejected with their line numbers.
+func TestImportCSVFile(t *testing.T) {
+	srv := newTestServer(t)
+	csvFile := `title,artist,price,upc,tags,metadata
+Kind of Blue,Miles Davis,29.99,074646593622,jazz;modal,"{""label"": ""Columbia""}"
+,Nobody,9.99,,,
+Duplicate,Someone,9.99,074646593622,,
+"Time Out",Dave Brubeck,not-a-price,,,
+Too,Short
+"A Love Supreme",John Coltrane,19.99,,,
+`
+	w, result := uploadImport(t, srv, "albums.csv", csvFile)
+	if w.Code != http.StatusOK || result.Imported != 2 || result.Rejected != 4 {
+		t.Fatalf("Expected 2 imported and 4 rejected, got %d: %s", w.Code, w.Body)
+	}
+	var lines []int
+	for _, e := range result.Errors {
+		lines = append(lines, e.Line)
+	}
+	if len(lines) != 4 || lines[0] != 3 || lines[1] != 4 || lines[2] != 5 || lines[3] != 6 {
+		t.Errorf("Expected errors on lines 3 to 6, got %+v", result.Errors)
+	}
+	if result.Errors[1].Error != "An album with this UPC already exists" {
+		t.Errorf("Expected a UPC conflict on line 4, got %q", result.Errors[1].Error)
+	}
+
+	a, err := findAlbumByUPC(t.Context(), srv.store, "074646593622")
+	if err != nil || len(a.Tags) != 2 || a.Metadata["label"] != "Columbia" {
+		t.Errorf("Expected the imported album with tags and metadata, got %+v, %v", a, err)
+	}
+}
+
+// TestImportJSONFile tests importing a JSON upload.
+// Verifies that rejected elements are reported with the line they start on, and that a file that
+// is not a JSON array, or an unknown format, returns HTTP 400.
+func TestImportJSONFile(t *testing.T) {
+	srv := newTestServer(t)
+	jsonFile := `[
+  {"title": "Giant Steps", "artist": "John Coltrane", "price": 24.99},
+  {"title": "Mingus Ah Um", "artist": "Charles Mingus", "price": "cheap"},
+  {
+    "title": "Moanin'", "artist": "", "price": 14.99
+  }
+]`
+	w, result := uploadImport(t, srv, "albums.json", jsonFile)
+	if w.Code != http.StatusOK || result.Imported != 1 || result.Rejected != 2 ||
+		result.Errors[0].Line != 3 || result.Errors[1].Line != 4 {
+		t.Fatalf("Expected 1 imported and errors on lines 3 and 4, got %d: %s", w.Code, w.Body)
+	}
+
+	if w, _ := uploadImport(t, srv, "albums.json", `{"title": "Not an array"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a non-array file, got %d", w.Code)
+	}
+	if w, _ := uploadImport(t, srv, "albums.txt", `title,artist,price`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", w.Code)
+	}
+}
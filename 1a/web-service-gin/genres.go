@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultGenres is the genre allowlist used when GENRES is not set.
+var defaultGenres = []string{
+	"Blues", "Classical", "Country", "Electronic", "Folk", "Hip-Hop", "Jazz", "Latin",
+	"Metal", "Pop", "R&B", "Reggae", "Rock", "Soul", "Soundtrack", "World",
+}
+
+// lookupGenre returns the spelling in the allowlist genres of genre, matched ignoring case and
+// surrounding space, and whether it is allowed.
+func lookupGenre(genre string, genres []string) (string, bool) {
+	genre = strings.TrimSpace(genre)
+	for _, allowed := range genres {
+		if strings.EqualFold(genre, allowed) {
+			return allowed, true
+		}
+	}
+	return "", false
+}
+
+// parseGenreYearFilter returns a filter for the genre and year query parameters, or nil if
+// neither is given. Genres match ignoring case. Returns an error message if the genre is not in
+// the allowlist genres or the year is not a whole number.
+func parseGenreYearFilter(c *gin.Context, genres []string) (func(Album) bool, string) {
+	rawGenre, rawYear := c.Query("genre"), c.Query("year")
+	if rawGenre == "" && rawYear == "" {
+		return nil, ""
+	}
+	var genre string
+	if rawGenre != "" {
+		var ok bool
+		if genre, ok = lookupGenre(rawGenre, genres); !ok {
+			return nil, validateGenre(rawGenre, genres)
+		}
+	}
+	var year int
+	if rawYear != "" {
+		var err error
+		if year, err = strconv.Atoi(rawYear); err != nil {
+			return nil, "year must be a whole number"
+		}
+	}
+	return func(a Album) bool {
+		return (genre == "" || a.Genre == genre) && (year == 0 || a.Year == year)
+	}, ""
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGenreAndYear tests setting, validating, and filtering by album genre and release year.
+// Verifies that genres are matched against the allowlist ignoring case and stored as spelled
+// there, that years outside 1900 to the current year are rejected on POST, PATCH, and PUT, and that
+// GET /albums filters by both.
+func TestGenreAndYear(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.Genres = []string{"Jazz", "Cool Jazz"} })
+	list := func(path string) []string {
+		var albums []Album
+		json.Unmarshal(srv.do("GET", path, "").Body.Bytes(), &albums)
+		var titles []string
+		for _, a := range albums {
+			titles = append(titles, a.Title)
+		}
+		return titles
+	}
+	nextYear := time.Now().Year() + 1
+
+	w := srv.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99, "genre": " JAZZ ", "year": 1959}`)
+	var created Album
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != 201 || created.Genre != "Jazz" || created.Year != 1959 {
+		t.Fatalf("Expected the album with genre Jazz and year 1959, got %d: %s", w.Code, w.Body)
+	}
+	for _, body := range []string{
+		`{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99, "genre": "Polka"}`,
+		`{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99, "year": 1899}`,
+		fmt.Sprintf(`{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99, "year": %d}`, nextYear),
+	} {
+		if w := srv.do("POST", "/albums?allow_duplicate=true", body); w.Code != 400 {
+			t.Errorf("POST %s: expected 400, got %d", body, w.Code)
+		}
+	}
+
+	const jeru = "/albums/550e8400-e29b-41d4-a716-446655440002"
+	w = srv.do("PATCH", jeru, `{"genre": "cool jazz", "year": 1962}`, "If-Match", "*")
+	var patched Album
+	json.Unmarshal(w.Body.Bytes(), &patched)
+	if w.Code != 200 || patched.Genre != "Cool Jazz" || patched.Year != 1962 {
+		t.Errorf("Expected PATCH to set the genre and year, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("PATCH", jeru, `{"genre": "Polka"}`, "If-Match", "*"); w.Code != 400 {
+		t.Errorf("Expected 400 patching an unknown genre, got %d", w.Code)
+	}
+	if w := srv.do("PATCH", jeru, fmt.Sprintf(`{"year": %d}`, nextYear), "If-Match", "*"); w.Code != 400 {
+		t.Errorf("Expected 400 patching a future year, got %d", w.Code)
+	}
+	if w := srv.do("PUT", jeru, `{"title": "Jeru", "artist": "Gerry Mulligan", "price": 17.99, "genre": "Rock"}`, "If-Match", "*"); w.Code != 400 {
+		t.Errorf("Expected 400 replacing with an unknown genre, got %d", w.Code)
+	}
+
+	for path, want := range map[string]string{
+		"/albums?genre=jazz":                "Kind of Blue",
+		"/albums?genre=Cool%20Jazz":         "Jeru",
+		"/albums?year=1962":                 "Jeru",
+		"/albums?genre=jazz&year=1962":      "",
+		"/albums?genre=cool+jazz&year=1962": "Jeru",
+	} {
+		if got := strings.Join(list(path), ","); got != want {
+			t.Errorf("GET %s: expected %q, got %q", path, want, got)
+		}
+	}
+	for _, path := range []string{"/albums?genre=polka", "/albums?year=1960s"} {
+		if w := srv.do("GET", path, ""); w.Code != 400 {
+			t.Errorf("GET %s: expected 400, got %d", path, w.Code)
+		}
+	}
+
+	w = srv.do("PUT", jeru, `{"title": "Jeru", "artist": "Gerry Mulligan", "price": 17.99}`, "If-Match", "*")
+	var replaced Album
+	json.Unmarshal(w.Body.Bytes(), &replaced)
+	if w.Code != 200 || replaced.Genre != "" || replaced.Year != 0 {
+		t.Errorf("Expected PUT without a genre and year to remove them, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestGroupCommitterBatches tests that concurrent writes share commits.
+// Verifies that every write gets its own error back, and that batches do not exceed the maximum size.
+func TestGroupCommitterBatches(t *testing.T) {
+	cfg := Config{GroupCommitMaxLatency: 20 * time.Millisecond, GroupCommitMaxBatch: 8}
+	var mu sync.Mutex
+	var sizes []int
+	g := newGroupCommitter(cfg, func(items []int) []error {
+		mu.Lock()
+		sizes = append(sizes, len(items))
+		mu.Unlock()
+		errs := make([]error, len(items))
+		for i, n := range items {
+			if n%2 == 1 {
+				errs[i] = fmt.Errorf("odd %d", n)
+			}
+		}
+		return errs
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Go(func() { errs[i] = g.do(i) })
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if (i%2 == 1) != (err != nil) {
+			t.Errorf("write %d: unexpected error %v", i, err)
+		}
+	}
+	if len(sizes) >= 20 {
+		t.Errorf("Expected writes to share commits, got batches %v", sizes)
+	}
+	for _, n := range sizes {
+		if n > 8 {
+			t.Errorf("Expected batches of at most 8 writes, got %v", sizes)
+		}
+	}
+	if stats := g.stats(); stats["writes"] != int64(20) {
+		t.Errorf("Expected 20 writes in the stats, got %v", stats)
+	}
+	if newGroupCommitter(Config{}, func([]int) []error { return nil }) != nil {
+		t.Error("Expected group commit to be disabled without a max latency")
+	}
+}
+
+// TestSQLiteStoreGroupCommit tests the SQLite store with group commit enabled.
+// Verifies that a UPC conflict fails only its own create in a shared transaction, and that the
+// other creates and a delete are committed.
+func TestSQLiteStoreGroupCommit(t *testing.T) {
+	ctx := context.Background()
+	cfg := loadConfig()
+	cfg.SQLitePath = filepath.Join(t.TempDir(), "albums.db")
+	cfg.GroupCommitMaxLatency = 20 * time.Millisecond
+	s, err := newSQLiteStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.(*sqliteStore).db.Close()
+	testAlbumStore(t, s)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Go(func() {
+			a := Album{ID: fmt.Sprintf("group-%d", i), Title: "Grouped", Artist: "Various", Price: 9.99}
+			if i < 2 {
+				a.UPC = "0-42-00000000-5"
+			}
+			_, errs[i] = s.Create(ctx, a)
+		})
+	}
+	wg.Wait()
+	conflicts := 0
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, errUPCConflict):
+			conflicts++
+		case err != nil:
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if conflicts != 1 {
+		t.Errorf("Expected 1 UPC conflict, got %d", conflicts)
+	}
+	if _, err := s.Delete(ctx, "group-5"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Delete(ctx, "group-5"); !errors.Is(err, errAlbumNotFound) {
+		t.Errorf("Expected errAlbumNotFound deleting twice, got %v", err)
+	}
+	if group := s.(*sqliteStore).group.stats(); group["commits"].(int64) >= group["writes"].(int64) {
+		t.Errorf("Expected writes to share commits, got %v", group)
+	}
+}
+
+// TestWALGroupCommit tests that changes synced by group commit are replayed after a restart.
+func TestWALGroupCommit(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "albums.wal")
+	cfg := loadConfig()
+	cfg.WALPath = path
+	cfg.WALSync = true
+	cfg.GroupCommitMaxLatency = 20 * time.Millisecond
+	s, err := openWALStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Go(func() {
+			if _, err := s.Create(ctx, Album{ID: fmt.Sprintf("group-%d", i), Title: "Grouped", Artist: "Various", Price: 9.99}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	if group := s.wal.group.stats(); group["commits"].(int64) >= 10 {
+		t.Errorf("Expected creates to share syncs, got %v", group)
+	}
+	s.wal.file.Close()
+
+	restored := openTestWALStore(t, path, 0)
+	if all, _ := restored.List(ctx); len(all) != 13 {
+		t.Errorf("Expected 13 albums after replay, got %d", len(all))
+	}
+}
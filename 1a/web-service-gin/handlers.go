@@ -1,34 +1,282 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 // getAlbums handles GET /albums requests.
-// Returns all albums in the collection as a JSON array with HTTP 200 status.
-func getAlbums(c *gin.Context) {
-	c.IndentedJSON(http.StatusOK, albums)
+// Returns the active albums in the collection as a JSON array with HTTP 200 status; ?state=archived
+// returns archived albums instead, and ?state=all both. ?tag= (repeatable) keeps only albums with
+// every given tag, and ?metadata[key]=value only albums with that metadata value (or, with an empty
+// value, that key). ?genre= and ?year= keep albums of that genre and release year, and ?artist_id=
+// those credited to that artist. ?artist= keeps albums whose artist contains it, ignoring case, and ?min_price=
+// and ?max_price= bound the price; these are applied by the store. Without them, returns HTTP 304
+// if nothing was created, changed, or deleted since If-Modified-Since. Albums are listed in the
+// order they were added unless ?sort=price|title|artist (with ?order=asc|desc) is given; albums
+// that sort equal keep that order.
+// Returns one page of at most limit albums (default 100, at most 1000) starting at offset, with
+// the number of matching albums in the X-Total-Count header. When limit or offset is given or the
+// albums span several pages, the Link header links to the first, previous, next, and last pages.
+// With page_size and/or page_token, the albums are instead returned as {"albums": [...],
+// "next_page_token": "...", "_links": {...}}; passing next_page_token back as page_token continues
+// after the last album returned, even if albums were added or deleted meanwhile, until it is empty.
+// Every album has a _links section (see linksFor). Deleted albums are left out unless
+// ?include_deleted=true.
+// Returns HTTP 400 if limit, offset, page_size, page_token, state, min_price, max_price, sort,
+// order, or include_deleted is invalid. With ?ids=, returns those albums instead (see getAlbumsByIDs).
+func (srv *Server) getAlbums(c *gin.Context) {
+	if ids, ok := c.GetQuery("ids"); ok {
+		srv.getAlbumsByIDs(c, ids)
+		return
+	}
+	store, errMsg := srv.readStore(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	offset, limit, explicit, errMsg := parsePage(c, srv.cfg.PageLimitDefault, srv.cfg.PageLimitMax)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	token, size, cursor, errMsg := parseCursor(c, srv.cfg.PageLimitDefault, srv.cfg.PageLimitMax)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	match, errMsg := parseState(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	filter, errMsg := parseAlbumFilter(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	compare, errMsg := parseSort(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	inTime, errMsg := parseTimeFilter(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	inGenreYear, errMsg := parseGenreYearFilter(c, srv.cfg.Genres)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	all, err := listAlbums(c.Request.Context(), store, filter)
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	// An album changed so that it no longer matches the store filter would not show up in the
+	// filtered albums' timestamps, so only unfiltered listings can be answered with HTTP 304.
+	if filter.isZero() && notModified(c, srv.collectionModified(all)) {
+		return
+	}
+	all = filterAlbums(all, match)
+	if hasTags := parseTagFilter(c); hasTags != nil {
+		all = filterAlbums(all, hasTags)
+	}
+	if hasMetadata := parseMetadataFilter(c); hasMetadata != nil {
+		all = filterAlbums(all, hasMetadata)
+	}
+	if inTime != nil {
+		all = filterAlbums(all, inTime)
+	}
+	if inGenreYear != nil {
+		all = filterAlbums(all, inGenreYear)
+	}
+	if byArtist := parseArtistIDFilter(c); byArtist != nil {
+		all = filterAlbums(all, byArtist)
+	}
+	if compare != nil {
+		slices.SortStableFunc(all, compare)
+	}
+	c.Header(totalCountHeader, strconv.Itoa(len(all)))
+	if cursor {
+		page, next := cursorPage(all, token, size)
+		c.IndentedJSON(http.StatusOK, gin.H{"albums": transformAlbums(c, page), "next_page_token": next, "_links": collectionLinks(c, next)})
+		return
+	}
+	if explicit || len(all) > limit {
+		setPageLinks(c, offset, limit, len(all))
+	}
+	renderAlbums(c, http.StatusOK, pageOf(all, offset, limit))
+}
+
+// getAlbumsByIDs handles GET /albums?ids=id1,id2,... requests.
+// Returns {"albums": [...], "not_found": [...], "_links": {...}} with HTTP 200 status: the albums with the given
+// IDs in the order requested, whatever their state, and the IDs that matched no album. Repeated
+// IDs are returned once, and the other GET /albums parameters but include_deleted are ignored.
+// Returns HTTP 400 if ids lists no IDs or more than 100.
+func (srv *Server) getAlbumsByIDs(c *gin.Context, list string) {
+	var ids []string
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 || len(ids) > maxLookupIDs {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ids must list 1 to %d album IDs", maxLookupIDs)})
+		return
+	}
+	store, errMsg := srv.readStore(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	ctx := c.Request.Context()
+	found, notFound := []Album{}, []string{}
+	for _, id := range ids {
+		a, err := store.Get(ctx, id)
+		switch {
+		case errors.Is(err, errAlbumNotFound):
+			notFound = append(notFound, id)
+		case err != nil:
+			respondStoreError(c, err)
+			return
+		default:
+			found = append(found, a)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"albums": transformAlbums(c, found), "not_found": notFound, "_links": collectionLinks(c, "")})
+}
+
+// parseAlbumFilter returns the store filter selected by the artist, min_price, and max_price
+// query parameters. Returns an error message if a price is not a non-negative number or
+// min_price is greater than max_price.
+func parseAlbumFilter(c *gin.Context) (albumFilter, string) {
+	f := albumFilter{Artist: strings.TrimSpace(c.Query("artist"))}
+	for _, bound := range []struct {
+		name string
+		dst  **float64
+	}{{"min_price", &f.MinPrice}, {"max_price", &f.MaxPrice}} {
+		raw := c.Query(bound.name)
+		if raw == "" {
+			continue
+		}
+		price, err := strconv.ParseFloat(raw, 64)
+		if err != nil || price < 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+			return albumFilter{}, bound.name + " must be a non-negative number"
+		}
+		*bound.dst = &price
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		return albumFilter{}, "min_price must not be greater than max_price"
+	}
+	return f, ""
 }
 
 // healthCheck handles GET / requests.
-// Returns the server health status as JSON with HTTP 200 status.
+// Returns the server health status, and whether it is read-only, as JSON with HTTP 200 status.
 // Used for monitoring and load balancer health checks.
-func healthCheck(c *gin.Context) {
+func (srv *Server) healthCheck(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, gin.H{
-		"status":  "healthy",
-		"service": "album-api",
-		"version": "1.0.0",
+		"status":    "healthy",
+		"service":   "album-api",
+		"version":   "1.0.0",
+		"read_only": srv.cfg.ReadOnly,
 	})
 }
 
+// maxLookupIDs is the most album IDs one GET /albums?ids= request may name.
+const maxLookupIDs = 100
+
+// validationError is returned from an AlbumStore.Update mutation when the request is invalid.
+type validationError string
+
+func (e validationError) Error() string { return string(e) }
+
+// respondStoreError writes the response for an error returned by the album store:
+// HTTP 404 for a missing album, HTTP 409 for a UPC conflict or a failed JSON Patch test,
+// HTTP 400 for a validation error (listing every invalid field for fieldErrors), HTTP 429 when
+// the tenant's album quota is used up, HTTP 507 when the collection is full, and HTTP 500 for
+// anything else.
+func respondStoreError(c *gin.Context, err error) {
+	var invalid validationError
+	var fields fieldErrors
+	var duplicate duplicateAlbumError
+	var insufficient insufficientStockError
+	var mismatch versionMismatchError
+	switch {
+	case errors.Is(err, errAlbumNotFound):
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album not found"})
+	case errors.Is(err, errUPCConflict):
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "An album with this UPC already exists"})
+	case errors.As(err, &duplicate):
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "An album with this title and artist already exists", "id": duplicate.ID})
+	case errors.Is(err, errTrackNotFound):
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "track not found"})
+	case errors.Is(err, errTrackExists):
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "The album already has a track with this number"})
+	case errors.Is(err, errPatchTestFailed):
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "JSON Patch test operation failed"})
+	case errors.As(err, &mismatch):
+		c.Header("ETag", albumETag(Album{Version: mismatch.Current}))
+		c.IndentedJSON(http.StatusPreconditionFailed, gin.H{"error": "The album has changed since it was read", "version": mismatch.Current})
+	case errors.As(err, &insufficient):
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "Not enough copies in stock", "available": insufficient.Available})
+	case errors.As(err, &invalid):
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": string(invalid)})
+	case errors.As(err, &fields):
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fields.Error(), "errors": fields})
+	case errors.Is(err, errTenantQuotaExceeded):
+		c.IndentedJSON(http.StatusTooManyRequests, gin.H{"error": "Tenant album quota exceeded"})
+	case errors.Is(err, errCollectionFull):
+		c.IndentedJSON(http.StatusInsufficientStorage, gin.H{"error": "Album collection is full"})
+	default:
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error":   "Storage error",
+			"details": err.Error(),
+		})
+	}
+}
+
 // postAlbums handles POST /albums requests.
-// Creates a new album with an auto-generated UUID. Validates all required fields.
+// Creates a new album with an auto-generated UUID. Validates all required fields and the optional
+// UPC, tags, and metadata. The album is credited to the artist named by artist_id, or else to the
+// artist with its artist name, which is created if there is none (see linkArtist). The pricing
+// rules may adjust the price, reported in the album's warnings, or reject the album with HTTP 400
+// (see pricingRules). Unusual values are reported in the album's warnings, or rejected with HTTP
+// 400 if VALIDATION_STRICT makes them errors (see checkWarnings).
 // Returns the created album as JSON with HTTP 201 status on success,
-// or HTTP 400 with error details if validation fails.
-func postAlbums(c *gin.Context) {
+// HTTP 400 with error details if validation fails, HTTP 409 if the UPC is already in use or an
+// album with the same title and artist exists (with that album's ID), or HTTP 429 or 507 if an
+// album limit would be exceeded (see respondStoreError). ?allow_duplicate=true skips the title
+// and artist check.
+// With ?dry_run=true the album is validated and checked for conflicts but not stored, and the
+// response is the one a real request would get.
+func (srv *Server) postAlbums(c *gin.Context) {
+	dryRun, errMsg := parseDryRun(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	allowDuplicate, errMsg := parseAllowDuplicate(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
 	var newAlbum Album
 
 	if err := c.ShouldBindJSON(&newAlbum); err != nil {
@@ -39,103 +287,604 @@ func postAlbums(c *gin.Context) {
 		return
 	}
 
-	if errMsg := validateTitle(newAlbum.Title, true); errMsg != "" {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+	if _, err := srv.linkArtist(c.Request.Context(), &newAlbum, false); err != nil {
+		respondStoreError(c, err)
 		return
 	}
-	if errMsg := validateArtist(newAlbum.Artist, true); errMsg != "" {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+	if err := validateAlbum(&newAlbum, srv.cfg.Genres); err != nil {
+		respondStoreError(c, err)
 		return
 	}
-	if errMsg := validatePrice(newAlbum.Price, true); errMsg != "" {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+	adjusted, err := srv.applyPricing(&newAlbum, nil)
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	prepareNewAlbum(&newAlbum)
+	if dryRun {
+		warnings, err := srv.checkWarnings(newAlbum, nil)
+		if err == nil {
+			err = checkUPCConflict(c.Request.Context(), srv.store, newAlbum)
+		}
+		if err == nil && srv.limits != nil {
+			err = srv.limits.check(c.Request.Context())
+		}
+		if err == nil && !allowDuplicate {
+			err = checkDuplicate(c.Request.Context(), srv.store, newAlbum)
+		}
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+		setWarnings(c, append(adjusted, warnings...))
+		renderAlbum(c, http.StatusCreated, newAlbum)
+		return
+	}
+	created, warnings, err := srv.createAlbum(c.Request.Context(), newAlbum, allowDuplicate)
+	if err != nil {
+		respondStoreError(c, err)
 		return
 	}
+	setWarnings(c, append(adjusted, warnings...))
+	srv.publishAlbumEvent(c.Request.Context(), eventAlbumCreated, created, nil)
+	renderAlbum(c, http.StatusCreated, created)
+}
+
+// parseAllowDuplicate reports whether the request allows creating albums with the title and
+// artist of an existing album with ?allow_duplicate=true. Returns an error message if the
+// parameter is not a boolean.
+func parseAllowDuplicate(c *gin.Context) (bool, string) {
+	value := c.Query("allow_duplicate")
+	if value == "" {
+		return false, ""
+	}
+	allow, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, "allow_duplicate must be true or false"
+	}
+	return allow, ""
+}
 
-	newAlbum.ID = uuid.New().String()
-	albums = append(albums, newAlbum)
-	c.IndentedJSON(http.StatusCreated, newAlbum)
+// createAlbum stores the new album a, credited to its artist (created if needed, see linkArtist),
+// rejecting it with a duplicateAlbumError if an album with the same title and artist exists, unless
+// allowDuplicate is set, or with a validationError if it has a warning VALIDATION_STRICT makes an
+// error. Returns the created album with its validation warnings (see checkWarnings).
+func (srv *Server) createAlbum(ctx context.Context, a Album, allowDuplicate bool) (Album, []validationWarning, error) {
+	warnings, err := srv.checkWarnings(a, nil)
+	if err != nil {
+		return Album{}, nil, err
+	}
+	artist, err := srv.linkArtist(ctx, &a, true)
+	if err != nil {
+		return Album{}, nil, err
+	}
+	if allowDuplicate {
+		a, err = srv.store.Create(ctx, a)
+	} else {
+		a, err = createUnique(ctx, srv.store, a)
+	}
+	if err != nil {
+		return Album{}, nil, err
+	}
+	srv.storeArtist(ctx, artist)
+	return a, warnings, nil
+}
+
+// prepareNewAlbum gives a client-supplied album a new ID and resets the fields the server
+// manages, ready to be created.
+func prepareNewAlbum(a *Album) {
+	a.ID = uuid.New().String()
+	a.SpotifyID = ""
+	a.SpotifyURL = ""
+	a.ImageURL = ""
+	a.Tracks = nil
+	a.TrackCount = 0
+	a.ArchivedAt = time.Time{}
+	a.DeletedAt = time.Time{}
+	a.CreatedAt = time.Now().UTC()
+	a.UpdatedAt = a.CreatedAt
+	a.Version = 1
 }
 
 // getAlbumByID handles GET /albums/:id requests.
-// Returns the album with the specified ID as JSON with HTTP 200 status.
-// Returns HTTP 404 if the album is not found.
-func getAlbumByID(c *gin.Context) {
-	id := c.Param("id")
-
-	for _, a := range albums {
-		if a.ID == id {
-			c.IndentedJSON(http.StatusOK, a)
+// Returns the album with the specified ID as JSON with HTTP 200 status, even if it is deleted
+// with ?include_deleted=true, with its version as its ETag. Returns HTTP 304 if it still has an
+// ETag listed in If-None-Match or, without If-None-Match, has not changed since If-Modified-Since,
+// or HTTP 404 if the album is not found. With ?as_of= the album is returned as it was at that time
+// instead (see getAlbumAsOf).
+func (srv *Server) getAlbumByID(c *gin.Context) {
+	if c.Query("as_of") != "" {
+		srv.getAlbumAsOf(c)
+		return
+	}
+	store, errMsg := srv.readStore(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	a, err := store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	c.Header("ETag", albumETag(a))
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if etagListMatches(match, albumETag(a), true) {
+			c.Status(http.StatusNotModified)
 			return
 		}
+	} else if notModified(c, a.UpdatedAt) {
+		return
+	}
+	renderAlbum(c, http.StatusOK, a)
+}
+
+// getAlbumByUPC handles GET /albums/upc/:code requests.
+// Returns the album with the specified UPC-A, EAN-13, or EAN-8 barcode as JSON with HTTP 200 status.
+// A UPC-A code also matches the same barcode stored in EAN-13 form, and vice versa.
+// Returns HTTP 400 if the code is not a valid barcode, or HTTP 404 if no album has it.
+func (srv *Server) getAlbumByUPC(c *gin.Context) {
+	code := c.Param("code")
+	if errMsg := validateUPC(code); errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
 	}
 
-	c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album not found"})
+	a, err := findAlbumByUPC(c.Request.Context(), srv.store, code)
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	renderAlbum(c, http.StatusOK, a)
 }
 
 // deleteAlbumByID handles DELETE /albums/:id requests.
-// Deletes the album with the specified ID and returns the deleted album as JSON with HTTP 200 status.
-// Returns HTTP 404 if the album is not found.
-func deleteAlbumByID(c *gin.Context) {
-	id := c.Param("id")
-
-	for i, a := range albums {
-		if a.ID == id {
-			albums = append(albums[:i], albums[i+1:]...)
-			c.IndentedJSON(http.StatusOK, a)
+// Marks the album with the specified ID deleted, hiding it until it is restored (see
+// softDeleteStore), and returns the deleted album as JSON with HTTP 200 status. With
+// ?permanent=true the album, deleted or not, is removed for good instead.
+// Returns HTTP 400 if permanent or dry_run is not a boolean, HTTP 404 if the album is not found,
+// HTTP 412 if it does not match If-Match, or HTTP 428 without one (see versionCheckFor). A
+// permanent delete checks If-Match before deleting rather than atomically, as stores have no
+// conditional delete.
+// With ?dry_run=true the album is returned but not deleted.
+func (srv *Server) deleteAlbumByID(c *gin.Context) {
+	dryRun, errMsg := parseDryRun(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	permanent, err := strconv.ParseBool(c.DefaultQuery("permanent", "false"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "permanent must be true or false"})
+		return
+	}
+	check, ok := srv.versionCheckFor(c)
+	if !ok {
+		return
+	}
+	store := srv.store
+	if permanent {
+		store = srv.softDeletes.AlbumStore
+	}
+	ctx, id := c.Request.Context(), c.Param("id")
+	if dryRun || (permanent && check != nil) {
+		a, err := store.Get(ctx, id)
+		if err == nil && check != nil {
+			err = check(a)
+		}
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+		if dryRun {
+			renderAlbum(c, http.StatusOK, a)
+			return
+		}
+	}
+
+	var a Album
+	if permanent {
+		a, err = store.Delete(ctx, id)
+	} else {
+		a, err = srv.softDeletes.deleteChecked(ctx, id, check)
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	if a.DeletedAt.IsZero() || !permanent {
+		srv.recordDeletion()
+		srv.publishAlbumEvent(c.Request.Context(), eventAlbumDeleted, a, nil)
+	}
+	if permanent && a.ImageURL != "" && srv.covers != nil {
+		if err := srv.covers.Delete(c.Request.Context(), a.ID); err != nil {
+			log.Printf("album %s: delete cover: %v", a.ID, err)
+		}
+	}
+	renderAlbum(c, http.StatusOK, a)
+}
+
+// deleteAlbums handles DELETE /albums requests.
+// Deletes every album selected by the artist, min_price, and max_price filters, as DELETE
+// /albums/:id would each one, in one atomic store operation, and returns the number deleted as
+// JSON with HTTP 200 status. The request must carry ?confirm=true and at least one filter, so the
+// whole collection cannot be deleted by accident. With ?permanent=true the albums, deleted or not,
+// are removed for good. Returns HTTP 400 if confirm is missing, no filter is given, or a parameter
+// is invalid. With ?dry_run=true the albums are counted but not deleted.
+func (srv *Server) deleteAlbums(c *gin.Context) {
+	dryRun, errMsg := parseDryRun(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	if confirm, _ := strconv.ParseBool(c.Query("confirm")); !confirm {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "confirm=true is required to delete albums in bulk"})
+		return
+	}
+	permanent, err := strconv.ParseBool(c.DefaultQuery("permanent", "false"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "permanent must be true or false"})
+		return
+	}
+	f, errMsg := parseAlbumFilter(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	if f.isZero() {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "at least one of artist, min_price, or max_price is required"})
+		return
+	}
+	ctx := c.Request.Context()
+	if dryRun {
+		store := srv.store
+		if permanent {
+			store = srv.softDeletes.AlbumStore
+		}
+		matching, err := listAlbums(ctx, store, f)
+		if err != nil {
+			respondStoreError(c, err)
 			return
 		}
+		c.IndentedJSON(http.StatusOK, gin.H{"deleted": len(matching)})
+		return
 	}
 
-	c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album not found"})
+	var deleted []Album
+	if permanent {
+		deleted, err = deleteWhere(ctx, srv.softDeletes.AlbumStore, f)
+	} else {
+		deleted, err = srv.softDeletes.DeleteWhere(ctx, f)
+	}
+	for _, a := range deleted {
+		if a.DeletedAt.IsZero() || !permanent {
+			srv.recordDeletion()
+			srv.publishAlbumEvent(ctx, eventAlbumDeleted, a, nil)
+		}
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"deleted": len(deleted)})
 }
 
 // patchAlbumByID handles PATCH /albums/:id requests.
 // Updates an album by its ID, allowing partial updates. Only provided fields are updated.
-// Validates each provided field before updating. Returns the updated album as JSON with HTTP 200 status.
-// Returns HTTP 400 if validation fails, or HTTP 404 if the album is not found.
-func patchAlbumByID(c *gin.Context) {
-	id := c.Param("id")
-
-	for i, a := range albums {
-		if a.ID == id {
-			var update Album
-			if err := c.ShouldBindJSON(&update); err != nil {
-				c.IndentedJSON(http.StatusBadRequest, gin.H{
-					"error":   "Invalid JSON",
-					"details": err.Error(),
-				})
-				return
+// Validates every provided field before updating (see validateAlbumUpdate); an invalid field
+// leaves the album unchanged.
+// Provided tags replace the album's tags, and an empty list removes them. Provided metadata keys
+// are merged into the album's metadata, and a key with an empty value is removed. A provided
+// artist_id or artist credits the album to that artist as for POST /albums.
+// Returns the updated album as JSON with HTTP 200 status.
+// Returns HTTP 400 if validation fails, HTTP 404 if the album is not found,
+// or HTTP 409 if the new UPC belongs to another album or another album has the new title and
+// artist (with that album's ID, as for POST /albums). With ?dry_run=true the update is validated
+// and checked for conflicts, and the album is returned as it would be, but nothing is stored.
+// With Content-Type application/json-patch+json the body is an RFC 6902 JSON Patch applied to the
+// album's JSON, which can also clear optional fields; the result must be a valid album, and
+// HTTP 409 is returned if a test operation fails.
+func (srv *Server) patchAlbumByID(c *gin.Context) {
+	dryRun, errMsg := parseDryRun(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	if c.ContentType() == jsonPatchContentType {
+		ops, errMsg := parseJSONPatch(c)
+		if errMsg != "" {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+		// The patched album is credited to its artist inside the store update, which must not load
+		// the tenant's artists from the store.
+		if err := srv.preloadArtists(c.Request.Context()); err != nil {
+			respondStoreError(c, err)
+			return
+		}
+		srv.respondUpdate(c, dryRun, func(a *Album) (*Artist, error) {
+			previous := *a
+			if err := patchAlbum(a, ops, srv.cfg.Genres); err != nil {
+				return nil, err
 			}
+			return srv.relinkArtist(c.Request.Context(), a, previous, !dryRun)
+		})
+		return
+	}
+	var update Album
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid JSON",
+			"details": err.Error(),
+		})
+		return
+	}
+	// The album is credited to its artist inside the store update, once the update is valid, so a
+	// failed update creates no artist.
+	if err := srv.preloadArtists(c.Request.Context()); err != nil {
+		respondStoreError(c, err)
+		return
+	}
 
-			if update.Title != "" {
-				if errMsg := validateTitle(update.Title, false); errMsg != "" {
-					c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
-					return
-				}
-				albums[i].Title = update.Title
+	apply := func(a *Album) (*Artist, error) {
+		if err := validateAlbumUpdate(&update, srv.cfg.Genres); err != nil {
+			return nil, err
+		}
+		var artist *Artist
+		if update.ArtistID != "" || update.Artist != "" {
+			var err error
+			if artist, err = srv.linkArtist(c.Request.Context(), &update, !dryRun); err != nil {
+				return nil, err
 			}
-
-			if update.Artist != "" {
-				if errMsg := validateArtist(update.Artist, false); errMsg != "" {
-					c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
-					return
-				}
-				albums[i].Artist = update.Artist
+		}
+		if update.Title != "" {
+			a.Title = update.Title
+		}
+		if update.Artist != "" {
+			a.Artist, a.ArtistID = update.Artist, update.ArtistID
+		}
+		if update.Price != 0 {
+			a.Price = update.Price
+		}
+		if update.Currency != "" {
+			a.Currency = update.Currency
+		}
+		if update.UPC != "" {
+			a.UPC = update.UPC
+		}
+		if update.Genre != "" {
+			a.Genre = update.Genre
+		}
+		if update.Year != 0 {
+			a.Year = update.Year
+		}
+		if update.Quantity != nil {
+			a.Quantity = update.Quantity
+		}
+		if update.Tags != nil {
+			a.Tags = update.Tags
+		}
+		if update.Metadata != nil {
+			metadata, errMsg := mergeMetadata(a.Metadata, update.Metadata)
+			if errMsg != "" {
+				return nil, validationError(errMsg)
 			}
+			a.Metadata = metadata
+		}
+		return artist, nil
+	}
 
-			if update.Price > 0 {
-				if errMsg := validatePrice(update.Price, false); errMsg != "" {
-					c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
-					return
-				}
-				albums[i].Price = update.Price
-			}
+	srv.respondUpdate(c, dryRun, apply)
+}
+
+// putAlbumByID handles PUT /albums/:id requests.
+// Replaces the album with the one in the JSON body. Title, artist, and price are required and
+// validated as for POST /albums, and the album is credited to its artist likewise; UPC, genre,
+// currency, year, quantity, tags, and metadata are replaced, and removed if omitted.
+// The album keeps the ID from the path (an ID in the body is ignored), its Spotify link, its
+// tracks, and its archived state. Returns the replaced album as JSON with HTTP 200 status.
+// Returns HTTP 400 if validation fails, HTTP 404 if the album is not found,
+// or HTTP 409 if the UPC belongs to another album or, as for PATCH, another album has the new
+// title and artist. Supports ?dry_run=true like PATCH.
+func (srv *Server) putAlbumByID(c *gin.Context) {
+	dryRun, errMsg := parseDryRun(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	var replacement Album
+	if err := c.ShouldBindJSON(&replacement); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid JSON",
+			"details": err.Error(),
+		})
+		return
+	}
+	ctx := c.Request.Context()
+	if _, err := srv.linkArtist(ctx, &replacement, false); err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	if err := validateAlbum(&replacement, srv.cfg.Genres); err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	// As for PATCH, a new artist is only created once the album is found and may be replaced.
+	if err := srv.preloadArtists(ctx); err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	apply := func(a *Album) (*Artist, error) {
+		artist, err := srv.linkArtist(ctx, &replacement, !dryRun)
+		if err != nil {
+			return nil, err
+		}
+		a.Title = replacement.Title
+		a.Artist = replacement.Artist
+		a.ArtistID = replacement.ArtistID
+		a.Price = replacement.Price
+		a.Currency = replacement.Currency
+		a.UPC = replacement.UPC
+		a.Genre = replacement.Genre
+		a.Year = replacement.Year
+		a.Quantity = replacement.Quantity
+		a.Tags = replacement.Tags
+		a.Metadata = replacement.Metadata
+		return artist, nil
+	}
+
+	srv.respondUpdate(c, dryRun, apply)
+}
 
-			c.IndentedJSON(http.StatusOK, albums[i])
+// respondUpdate applies change to the album named in the request, publishes the update, and
+// responds with the updated album, with any validation warnings the change introduced, its ETag,
+// and HTTP 200 status. The album must match the request's If-Match when change runs (see
+// versionCheckFor), so a write based on an outdated copy fails with HTTP 412 instead of
+// overwriting a concurrent one. The
+// pricing rules run on the changed album, and may adjust its price or reject the change. A change
+// to the title or artist fails with a duplicateAlbumError, and HTTP 409, if another album has
+// them (see updateUnique).
+// change returns the new artist it credited the album to, if any, which is stored once the album
+// is (see storeArtist). If dryRun is set, change runs on a copy and the UPC is checked for
+// conflicts, but nothing is stored or published.
+func (srv *Server) respondUpdate(c *gin.Context, dryRun bool, change func(a *Album) (*Artist, error)) {
+	ctx := c.Request.Context()
+	check, ok := srv.versionCheckFor(c)
+	if !ok {
+		return
+	}
+	var (
+		warnings []validationWarning
+		artist   *Artist
+	)
+	apply := func(a *Album) error {
+		if check != nil {
+			if err := check(*a); err != nil {
+				return err
+			}
+		}
+		before := *a
+		var err error
+		if artist, err = change(a); err != nil {
+			return err
+		}
+		adjusted, err := srv.applyPricing(a, &before)
+		if err != nil {
+			return err
+		}
+		warnings, err = srv.checkWarnings(*a, &before)
+		warnings = append(adjusted, warnings...)
+		return err
+	}
+	if dryRun {
+		a, err := srv.store.Get(ctx, c.Param("id"))
+		key := albumNameKey(a.Title, a.Artist)
+		if err == nil {
+			err = apply(&a)
+		}
+		if err == nil {
+			err = checkUPCConflict(ctx, srv.store, a)
+		}
+		if err == nil && albumNameKey(a.Title, a.Artist) != key {
+			err = checkDuplicate(ctx, srv.store, a)
+		}
+		if err != nil {
+			respondStoreError(c, err)
 			return
 		}
+		stampUpdated(&a, time.Now().UTC())
+		setWarnings(c, warnings)
+		c.Header("ETag", albumETag(a))
+		renderAlbum(c, http.StatusOK, a)
+		return
 	}
 
-	c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album not found"})
+	var previous Album
+	updated, err := srv.updateAlbumUnique(ctx, c.Param("id"), func(a *Album) error {
+		previous = *a
+		return apply(a)
+	})
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	srv.storeArtist(ctx, artist)
+	srv.publishAlbumEvent(ctx, eventAlbumUpdated, updated, &previous)
+	setWarnings(c, warnings)
+	c.Header("ETag", albumETag(updated))
+	renderAlbum(c, http.StatusOK, updated)
+}
+
+// linkSpotify handles POST /albums/:id/link/spotify requests.
+// Searches Spotify for the album by title and artist and stores the matching Spotify ID and URL.
+// Returns the updated album as JSON with HTTP 200 status. Returns HTTP 404 if the album or a
+// Spotify match is not found, HTTP 502 if the Spotify API fails, or HTTP 503 if Spotify is not configured.
+func (srv *Server) linkSpotify(c *gin.Context) {
+	if srv.spotify == nil {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"error": "Spotify integration is not configured"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	a, err := srv.store.Get(ctx, c.Param("id"))
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	match, err := srv.spotify.searchAlbum(ctx, a.Title, a.Artist)
+	if errors.Is(err, errSpotifyNoMatch) {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "no matching Spotify album"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusBadGateway, gin.H{
+			"error":   "Spotify lookup failed",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// The album may have been deleted while the search was in flight, in which case Update returns errAlbumNotFound.
+	linked, err := srv.updateAlbum(ctx, a.ID, func(a *Album) error {
+		a.SpotifyID = match.ID
+		a.SpotifyURL = match.URL
+		return nil
+	})
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	srv.publishAlbumEvent(ctx, eventAlbumUpdated, linked, &a)
+	renderAlbum(c, http.StatusOK, linked)
+}
+
+// startSpotifyBackfill handles POST /admin/spotify/backfill requests.
+// Starts a background job that links every album without a Spotify ID and returns HTTP 202.
+// Returns HTTP 409 if a backfill is already running, or HTTP 503 if Spotify is not configured.
+func (srv *Server) startSpotifyBackfill(c *gin.Context) {
+	if srv.spotify == nil {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"error": "Spotify integration is not configured"})
+		return
+	}
+	if !srv.backfill.start(srv) {
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "Backfill already running"})
+		return
+	}
+	c.IndentedJSON(http.StatusAccepted, srv.backfill.status())
+}
+
+// getSpotifyBackfill handles GET /admin/spotify/backfill requests.
+// Returns the progress of the current or most recent backfill job with HTTP 200 status.
+func (srv *Server) getSpotifyBackfill(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, srv.backfill.status())
+}
+
+// getOutboundMetrics handles GET /metrics/outbound requests.
+// Returns request, retry, and failure counters plus circuit breaker state for every outbound client.
+func (srv *Server) getOutboundMetrics(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, srv.outbound.stats())
 }
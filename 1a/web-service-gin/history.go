@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errHistoryUnavailable is returned for the state of an album at a time before its oldest revision
+// kept.
+var errHistoryUnavailable = errors.New("album history does not reach back that far")
+
+// albumHistory keeps the revisions of every album changed since the server started: a snapshot of
+// the album after each event, with who made the change and when, up to size revisions per album.
+// Revisions are never changed once recorded; when an album has too many, the oldest are dropped.
+type albumHistory struct {
+	size int
+
+	mu sync.Mutex
+	// albums maps lockKey(tenant, id) to the album's revisions, oldest first.
+	albums map[string][]albumRevision
+}
+
+// albumRevision is one change to an album.
+type albumRevision struct {
+	// Number counts the album's revisions from 1, including any dropped since.
+	Number    int
+	Type      string
+	Actor     string
+	RequestID string
+	At        time.Time
+	// Album is the album after the change, or the removed album for deletions. Previous is the
+	// album before it, or nil for creations and for the first revision of an album deleted
+	// without an earlier one.
+	Album    Album
+	Previous *Album
+}
+
+// revisionSummary is a revision as listed by GET /albums/:id/history, with the fields the change
+// made differ, and their values before and after it.
+type revisionSummary struct {
+	Revision  int            `json:"revision"`
+	Type      string         `json:"type"`
+	Actor     string         `json:"actor,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+	At        time.Time      `json:"at"`
+	Changes   []revisionDiff `json:"changes,omitempty"`
+}
+
+// revisionDiff is one field changed by a revision. A side is null when the album did not have the
+// field.
+type revisionDiff struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// newAlbumHistory creates a history keeping the last size revisions of each album.
+// Returns nil if size is not positive, which disables it.
+func newAlbumHistory(size int) *albumHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &albumHistory{size: size, albums: map[string][]albumRevision{}}
+}
+
+// handle records evt as the next revision of its album. Deletions, which carry no previous album,
+// are compared with the album's last revision.
+func (h *albumHistory) handle(evt albumEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := lockKey(evt.Tenant, evt.Album.ID)
+	revisions := h.albums[key]
+	r := albumRevision{
+		Number:    1,
+		Type:      evt.Type,
+		Actor:     evt.Actor,
+		RequestID: evt.RequestID,
+		At:        evt.At.UTC(),
+		Album:     evt.Album,
+		Previous:  evt.Previous,
+	}
+	if n := len(revisions); n > 0 {
+		last := revisions[n-1]
+		r.Number = last.Number + 1
+		if r.Previous == nil && r.Type != eventAlbumCreated {
+			r.Previous = &last.Album
+		}
+	}
+	if len(revisions) == h.size {
+		revisions = revisions[1:]
+	}
+	h.albums[key] = append(revisions, r)
+}
+
+// revisions returns the tenant's revisions of the album id, oldest first.
+func (h *albumHistory) revisions(tenant, id string) []albumRevision {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.albums[lockKey(tenant, id)]
+}
+
+// revision returns the tenant's revision number of the album id and true, or false if there is no
+// such revision or it has been dropped.
+func (h *albumHistory) revision(tenant, id string, number int) (albumRevision, bool) {
+	revisions := h.revisions(tenant, id)
+	if len(revisions) == 0 {
+		return albumRevision{}, false
+	}
+	i := number - revisions[0].Number
+	if i < 0 || i >= len(revisions) {
+		return albumRevision{}, false
+	}
+	return revisions[i], true
+}
+
+// summarize returns r as listed for this request, with the fields it changed rendered as albums
+// are.
+func summarize(c *gin.Context, r albumRevision) (revisionSummary, error) {
+	s := revisionSummary{Revision: r.Number, Type: r.Type, Actor: r.Actor, RequestID: r.RequestID, At: r.At}
+	if r.Previous == nil {
+		return s, nil
+	}
+	before, err := albumFields(c, *r.Previous)
+	if err != nil {
+		return s, err
+	}
+	after, err := albumFields(c, r.Album)
+	if err != nil {
+		return s, err
+	}
+	diffs, _ := diffAlbums(before, after)
+	for _, d := range diffs {
+		s.Changes = append(s.Changes, revisionDiff{Field: d.Field, From: d.Left, To: d.Right})
+	}
+	return s, nil
+}
+
+// getAlbumHistory handles GET /albums/:id/history requests.
+// Returns the revisions of the album kept since the server started, oldest first, each with its
+// type, who made it (the request's X-Actor, or else its client IP), when, and the fields it changed
+// with their values before and after, as JSON with HTTP 200 status. Deleted albums keep their
+// history.
+// Returns HTTP 404 if the album has no revisions, or if the history is disabled.
+func (srv *Server) getAlbumHistory(c *gin.Context) {
+	if srv.history == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album history is disabled"})
+		return
+	}
+	id := c.Param("id")
+	revisions := srv.history.revisions(tenantFrom(c.Request.Context()), id)
+	if len(revisions) == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album has no history"})
+		return
+	}
+	summaries := make([]revisionSummary, len(revisions))
+	for i, r := range revisions {
+		var err error
+		if summaries[i], err = summarize(c, r); err != nil {
+			respondStoreError(c, err)
+			return
+		}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"id": id, "count": len(summaries), "revisions": summaries})
+}
+
+// getAlbumRevision handles GET /albums/:id/history/:revision requests.
+// Returns the revision as listed by GET /albums/:id/history, with the album as it was after it, as
+// JSON with HTTP 200 status.
+// Returns HTTP 400 if the revision is not a positive number, or HTTP 404 if the album has no such
+// revision, it has been dropped, or the history is disabled.
+func (srv *Server) getAlbumRevision(c *gin.Context) {
+	number, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || number < 1 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "revision must be a positive number"})
+		return
+	}
+	if srv.history == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album history is disabled"})
+		return
+	}
+	r, ok := srv.history.revision(tenantFrom(c.Request.Context()), c.Param("id"), number)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "revision not found"})
+		return
+	}
+	summary, err := summarize(c, r)
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"revision": summary, "album": pipelineAlbum(c, r.Album)})
+}
+
+// albumAsOf returns the tenant's album id as it was at the time at, deleted or not: the album after
+// its last revision made by then, or, if there is none, the album before its first revision kept,
+// or its current state if it has none. Returns errAlbumNotFound if the album did not exist at that
+// time or had been permanently deleted, or errHistoryUnavailable if it has changed since then and
+// the revisions back to that time are not kept.
+func (srv *Server) albumAsOf(ctx context.Context, id string, at time.Time) (Album, error) {
+	var revisions []albumRevision
+	if srv.history != nil {
+		revisions = srv.history.revisions(tenantFrom(ctx), id)
+	}
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if r := revisions[i]; !r.At.After(at) {
+			if r.Type == eventAlbumDeleted && r.Album.DeletedAt.IsZero() {
+				return Album{}, errAlbumNotFound
+			}
+			return r.Album, nil
+		}
+	}
+
+	var state Album
+	switch {
+	case len(revisions) > 0 && revisions[0].Type == eventAlbumCreated:
+		return Album{}, errAlbumNotFound
+	case len(revisions) > 0 && revisions[0].Previous == nil:
+		return Album{}, errHistoryUnavailable
+	case len(revisions) > 0:
+		state = *revisions[0].Previous
+	default:
+		var err error
+		if state, err = srv.softDeletes.AlbumStore.Get(ctx, id); err != nil {
+			return Album{}, err
+		}
+	}
+	// Every change stamps updated_at, so an album has been as it is since then.
+	switch {
+	case !state.CreatedAt.IsZero() && state.CreatedAt.After(at):
+		return Album{}, errAlbumNotFound
+	case state.UpdatedAt.After(at):
+		return Album{}, errHistoryUnavailable
+	}
+	return state, nil
+}
+
+// getAlbumAsOf responds to GET /albums/:id?as_of=<time> with the album as it was at that RFC 3339
+// time (see albumAsOf), as JSON with HTTP 200 status. An album deleted at that time is only
+// returned with ?include_deleted=true.
+// Returns HTTP 400 if the time or include_deleted is invalid, or HTTP 404 if the album did not
+// exist or was deleted at that time, or its history does not reach back that far.
+func (srv *Server) getAlbumAsOf(c *gin.Context) {
+	at, err := time.Parse(time.RFC3339, c.Query("as_of"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "as_of must be an RFC 3339 time, e.g. 2024-01-02T15:04:05Z"})
+		return
+	}
+	includeDeleted, err := strconv.ParseBool(c.DefaultQuery("include_deleted", "false"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "include_deleted must be true or false"})
+		return
+	}
+	a, err := srv.albumAsOf(c.Request.Context(), c.Param("id"), at)
+	if errors.Is(err, errHistoryUnavailable) {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album history does not reach back to as_of"})
+		return
+	}
+	if err == nil && !a.DeletedAt.IsZero() && !includeDeleted {
+		err = errAlbumNotFound
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	renderAlbum(c, http.StatusOK, a)
+}
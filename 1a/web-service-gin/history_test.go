@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAlbumHistory tests the album revision history.
+// Verifies that every change to an album is recorded with who made it and the fields it changed,
+// that prior revisions can be fetched, that deleted albums keep their history, and that only the
+// last ALBUM_HISTORY_SIZE revisions are kept.
+func TestAlbumHistory(t *testing.T) {
+	var history struct {
+		Count     int
+		Revisions []revisionSummary
+	}
+	srv := newTestServer(t)
+
+	var created Album
+	json.Unmarshal(srv.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 9.99}`, actorHeader, "alice").Body.Bytes(), &created)
+	srv.do("PATCH", "/albums/"+created.ID, `{"price": 12.99}`, actorHeader, "bob", "If-Match", "*")
+	srv.do("DELETE", "/albums/"+created.ID, "", actorHeader, "carol", "If-Match", "*")
+
+	w := srv.do("GET", "/albums/"+created.ID+"/history", "", actorHeader, "")
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if w.Code != 200 || history.Count != 3 {
+		t.Fatalf("Expected three revisions, got %d: %s", w.Code, w.Body)
+	}
+	for i, want := range []struct{ typ, actor string }{{eventAlbumCreated, "alice"}, {eventAlbumUpdated, "bob"}, {eventAlbumDeleted, "carol"}} {
+		if r := history.Revisions[i]; r.Revision != i+1 || r.Type != want.typ || r.Actor != want.actor || r.RequestID == "" {
+			t.Errorf("Expected revision %d to be %s by %s, got %+v", i+1, want.typ, want.actor, r)
+		}
+	}
+	if changes := history.Revisions[1].Changes; len(changes) == 0 || changes[0] != (revisionDiff{Field: "price", From: 9.99, To: 12.99}) {
+		t.Errorf("Expected the update's price change, got %+v", changes)
+	}
+	if changes := history.Revisions[2].Changes; len(changes) == 0 || changes[0].Field != "deleted_at" {
+		t.Errorf("Expected the deletion compared with the previous revision, got %+v", changes)
+	}
+
+	w = srv.do("GET", "/albums/"+created.ID+"/history/1", "", actorHeader, "")
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"price": 9.99`) || strings.Contains(w.Body.String(), "12.99") {
+		t.Errorf("Expected the album as first created, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("GET", "/albums/"+created.ID+"/history/4", "", actorHeader, ""); w.Code != 404 {
+		t.Errorf("Expected 404 for a revision not yet made, got %d", w.Code)
+	}
+	if w := srv.do("GET", "/albums/"+created.ID+"/history/0", "", actorHeader, ""); w.Code != 400 {
+		t.Errorf("Expected 400 for an invalid revision, got %d", w.Code)
+	}
+	if w := srv.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440002/history", "", actorHeader, ""); w.Code != 404 {
+		t.Errorf("Expected 404 for an album without changes, got %d", w.Code)
+	}
+
+	small := newTestServer(t, func(cfg *Config) { cfg.HistorySize = 2 })
+	for _, price := range []string{"1", "2", "3"} {
+		small.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440002", `{"price": `+price+`}`, actorHeader, "", "If-Match", "*")
+	}
+	json.Unmarshal(small.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440002/history", "", actorHeader, "").Body.Bytes(), &history)
+	if history.Count != 2 || history.Revisions[0].Revision != 2 || history.Revisions[1].Revision != 3 {
+		t.Errorf("Expected the last two revisions kept, got %+v", history)
+	}
+	if w := small.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440002/history/1", "", actorHeader, ""); w.Code != 404 {
+		t.Errorf("Expected 404 for a dropped revision, got %d", w.Code)
+	}
+
+	disabled := newTestServer(t, func(cfg *Config) { cfg.HistorySize = 0 })
+	if w := disabled.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440002/history", "", actorHeader, ""); w.Code != 404 {
+		t.Errorf("Expected 404 with the history disabled, got %d", w.Code)
+	}
+}
+
+// TestAlbumAsOf tests reading albums as they were at a given time with ?as_of=.
+// Verifies that the state at each point of an album's history is returned, that albums are not
+// found before they were created or after they were deleted, unless deleted ones are included, and
+// that times before the oldest revision kept are only answered if the album has not changed since.
+func TestAlbumAsOf(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.HistorySize = 2 })
+	now := func() string {
+		at := time.Now().UTC().Format(time.RFC3339Nano)
+		time.Sleep(time.Millisecond)
+		return at
+	}
+	get := func(id, at, query string) *httptest.ResponseRecorder {
+		return srv.do("GET", "/albums/"+id+"?as_of="+at+query, "")
+	}
+
+	beforeCreate := now()
+	var created Album
+	json.Unmarshal(srv.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 9.99}`).Body.Bytes(), &created)
+	afterCreate := now()
+	srv.do("PATCH", "/albums/"+created.ID, `{"price": 12.99}`, "If-Match", "*")
+	afterUpdate := now()
+	srv.do("DELETE", "/albums/"+created.ID, "", "If-Match", "*")
+	afterDelete := now()
+
+	if w := get(created.ID, beforeCreate, ""); w.Code != 404 {
+		t.Errorf("Expected 404 before the album was created, got %d", w.Code)
+	}
+	if w := get(created.ID, afterCreate, ""); w.Code != 200 || !strings.Contains(w.Body.String(), `"price": 9.99`) {
+		t.Errorf("Expected the album as created, got %d: %s", w.Code, w.Body)
+	}
+	if w := get(created.ID, afterUpdate, ""); w.Code != 200 || !strings.Contains(w.Body.String(), `"price": 12.99`) {
+		t.Errorf("Expected the album as updated, got %d: %s", w.Code, w.Body)
+	}
+	if w := get(created.ID, afterDelete, ""); w.Code != 404 {
+		t.Errorf("Expected 404 after the album was deleted, got %d", w.Code)
+	}
+	if w := get(created.ID, afterDelete, "&include_deleted=true"); w.Code != 200 || !strings.Contains(w.Body.String(), "deleted_at") {
+		t.Errorf("Expected the deleted album included, got %d: %s", w.Code, w.Body)
+	}
+	if w := get(created.ID, "yesterday", ""); w.Code != 400 {
+		t.Errorf("Expected 400 for an invalid time, got %d", w.Code)
+	}
+
+	const jeru = "550e8400-e29b-41d4-a716-446655440002"
+	if w := get(jeru, beforeCreate, ""); w.Code != 200 || !strings.Contains(w.Body.String(), `"price": 17.99`) {
+		t.Errorf("Expected an unchanged album as it is, got %d: %s", w.Code, w.Body)
+	}
+	srv.do("PATCH", "/albums/"+jeru, `{"price": 1}`, "If-Match", "*")
+	afterFirst := now()
+	for _, price := range []string{"2", "3"} {
+		srv.do("PATCH", "/albums/"+jeru, `{"price": `+price+`}`, "If-Match", "*")
+	}
+	if w := get(jeru, afterFirst, ""); w.Code != 200 || !strings.Contains(w.Body.String(), `"price": 1,`) {
+		t.Errorf("Expected the album before its oldest revision kept, got %d: %s", w.Code, w.Body)
+	}
+	if w := get(jeru, beforeCreate, ""); w.Code != 404 || !strings.Contains(w.Body.String(), "does not reach back") {
+		t.Errorf("Expected 404 before the history kept, got %d: %s", w.Code, w.Body)
+	}
+}
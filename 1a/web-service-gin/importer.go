@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// importRecord is one album found in an imported file, before validation.
+type importRecord struct {
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+}
+
+// importParser extracts the albums referenced by an uploaded file.
+type importParser func(r io.Reader) ([]importRecord, error)
+
+// importFormats are the file formats accepted by POST /albums/import, keyed by the format parameter.
+var importFormats = map[string]importParser{
+	"m3u":  parseM3U,
+	"xspf": parseXSPF,
+}
+
+// maxImportBytes bounds the size of an uploaded import file.
+const maxImportBytes = 5 << 20
+
+// defaultImportPrice is the price given to imported albums when the request does not set one,
+// since playlists carry no prices.
+const defaultImportPrice = 9.99
+
+// importSkip reports an album from the file that was not created, and why.
+type importSkip struct {
+	importRecord
+	Reason string `json:"reason"`
+}
+
+// parseM3U reads an (extended) M3U playlist. Each entry's album comes from the #EXTALB directive,
+// or else the entry's parent directory; its artist from #EXTART, the "Artist - Title" form of
+// #EXTINF, or else the directory above the album. Entries whose album cannot be determined are ignored.
+func parseM3U(r io.Reader) ([]importRecord, error) {
+	var (
+		records            []importRecord
+		album, albumArtist string
+		trackArtist        string
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTALB:"):
+			album = strings.TrimSpace(strings.TrimPrefix(line, "#EXTALB:"))
+		case strings.HasPrefix(line, "#EXTART:"):
+			albumArtist = strings.TrimSpace(strings.TrimPrefix(line, "#EXTART:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			// #EXTINF:<seconds>,<artist> - <title>
+			if _, info, ok := strings.Cut(line, ","); ok {
+				if artist, _, ok := strings.Cut(info, " - "); ok {
+					trackArtist = strings.TrimSpace(artist)
+				}
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			dir := path.Dir(strings.ReplaceAll(line, `\`, "/"))
+			rec := importRecord{Title: album, Artist: albumArtist}
+			if rec.Title == "" && dir != "." && dir != "/" {
+				rec.Title = path.Base(dir)
+			}
+			if rec.Artist == "" {
+				rec.Artist = trackArtist
+			}
+			if parent := path.Dir(dir); rec.Artist == "" && parent != "." && parent != "/" {
+				rec.Artist = path.Base(parent)
+			}
+			trackArtist = ""
+			if rec.Title != "" {
+				records = append(records, rec)
+			}
+		}
+	}
+	return records, scanner.Err()
+}
+
+// xspfPlaylist is the part of an XSPF document read by parseXSPF.
+type xspfPlaylist struct {
+	Tracks []struct {
+		Creator string `xml:"creator"`
+		Album   string `xml:"album"`
+	} `xml:"trackList>track"`
+}
+
+// parseXSPF reads an XSPF playlist, taking each track's album and creator. Tracks without an album are ignored.
+func parseXSPF(r io.Reader) ([]importRecord, error) {
+	var playlist xspfPlaylist
+	if err := xml.NewDecoder(r).Decode(&playlist); err != nil {
+		return nil, err
+	}
+	var records []importRecord
+	for _, t := range playlist.Tracks {
+		if title := strings.TrimSpace(t.Album); title != "" {
+			records = append(records, importRecord{Title: title, Artist: strings.TrimSpace(t.Creator)})
+		}
+	}
+	return records, nil
+}
+
+// importAlbums handles POST /albums/import?format=m3u|xspf requests.
+// Parses the playlist in the request body and creates one album per distinct album it references,
+// skipping albums that are repeated in the playlist or already exist with the same title and artist.
+// Imported albums get the price from the optional price parameter (default 9.99).
+// Returns the created albums and the skipped entries with reasons, with HTTP 200 status.
+// Returns HTTP 400 if the format, price, or playlist is invalid.
+// Multipart requests upload a CSV or JSON file of complete albums instead (see importAlbumFile).
+func (srv *Server) importAlbums(c *gin.Context) {
+	if c.ContentType() == "multipart/form-data" {
+		srv.importAlbumFile(c)
+		return
+	}
+	parse, ok := importFormats[c.Query("format")]
+	if !ok {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "format must be m3u or xspf"})
+		return
+	}
+	price := defaultImportPrice
+	if raw := c.Query("price"); raw != "" {
+		p, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "price must be a number"})
+			return
+		}
+		if errMsg := validatePrice(p, true); errMsg != "" {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+		price = p
+	}
+
+	records, err := parse(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid playlist",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	existing, err := srv.store.List(ctx)
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	seen := make(map[string]bool, len(existing)+len(records))
+	for _, a := range existing {
+		seen[albumNameKey(a.Title, a.Artist)] = true
+	}
+
+	created := []Album{}
+	skipped := []importSkip{}
+	for i, rec := range records {
+		reportProgress(ctx, i, len(records))
+		key := albumNameKey(rec.Title, rec.Artist)
+		if seen[key] {
+			skipped = append(skipped, importSkip{rec, "duplicate"})
+			continue
+		}
+		if errMsg := validateTitle(rec.Title, true); errMsg != "" {
+			skipped = append(skipped, importSkip{rec, errMsg})
+			continue
+		}
+		if errMsg := validateArtist(rec.Artist, true); errMsg != "" {
+			skipped = append(skipped, importSkip{rec, errMsg})
+			continue
+		}
+		seen[key] = true
+
+		now := time.Now().UTC()
+		a := Album{
+			ID:        uuid.New().String(),
+			Title:     rec.Title,
+			Artist:    rec.Artist,
+			Price:     price,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Version:   1,
+		}
+		artist, err := srv.linkArtist(ctx, &a, true)
+		if err == nil {
+			a, err = srv.store.Create(ctx, a)
+		}
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+		srv.storeArtist(ctx, artist)
+		srv.publishAlbumEvent(ctx, eventAlbumCreated, a, nil)
+		created = append(created, a)
+	}
+	reportProgress(ctx, len(records), len(records))
+
+	c.IndentedJSON(http.StatusOK, gin.H{"created": transformAlbums(c, created), "skipped": skipped})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// importResult is the response body of POST /albums/import.
+type importResult struct {
+	Created []Album      `json:"created"`
+	Skipped []importSkip `json:"skipped"`
+}
+
+// postImport sends body to srv's POST /albums/import with the given query string.
+func postImport(t *testing.T, srv *Server, query, body string) (*httptest.ResponseRecorder, importResult) {
+	t.Helper()
+	w := srv.do("POST", "/albums/import?"+query, body)
+	var result importResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	return w, result
+}
+
+// TestParseM3U tests reading albums from extended and plain M3U playlists.
+// Verifies that #EXTALB/#EXTART, #EXTINF artists, and directory names are used in that order.
+func TestParseM3U(t *testing.T) {
+	playlist := `#EXTM3U
+#EXTALB:Kind of Blue
+#EXTART:Miles Davis
+#EXTINF:545,Miles Davis - So What
+music/Miles Davis/Kind of Blue/01 So What.mp3
+
+#EXTALB:
+#EXTART:
+#EXTINF:401,Thelonious Monk - Blue Monk
+Monk's Dream/03 Blue Monk.flac
+Dave Brubeck Quartet\Time Out\01 Blue Rondo.mp3
+loose-track.mp3
+`
+	records, err := parseM3U(strings.NewReader(playlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []importRecord{
+		{Title: "Kind of Blue", Artist: "Miles Davis"},
+		{Title: "Monk's Dream", Artist: "Thelonious Monk"},
+		{Title: "Time Out", Artist: "Dave Brubeck Quartet"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, records)
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Errorf("Entry %d: expected %v, got %v", i, want[i], records[i])
+		}
+	}
+}
+
+// TestImportXSPF tests importing an XSPF playlist.
+// Verifies that one album is created per distinct album, and that repeats within the playlist,
+// albums already in the store, and invalid entries are skipped with a reason.
+func TestImportXSPF(t *testing.T) {
+	srv := newTestServer(t)
+	playlist := `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <trackList>
+    <track><title>So What</title><creator>Miles Davis</creator><album>Kind of Blue</album></track>
+    <track><title>Freddie Freeloader</title><creator>miles davis</creator><album>KIND OF BLUE</album></track>
+    <track><title>Blue Train</title><creator>John Coltrane</creator><album>Blue Train</album></track>
+    <track><title>Untitled</title><creator>X</creator><album>Nameless</album></track>
+    <track><title>Single</title><creator>Someone</creator></track>
+  </trackList>
+</playlist>`
+
+	w, result := postImport(t, srv, "format=xspf&price=12.50", playlist)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if len(result.Created) != 1 || result.Created[0].Title != "Kind of Blue" || result.Created[0].Price != 12.5 {
+		t.Errorf("Expected Kind of Blue to be created at 12.50, got %+v", result.Created)
+	}
+	reasons := map[string]string{}
+	for _, s := range result.Skipped {
+		reasons[s.Title] = s.Reason
+	}
+	if reasons["KIND OF BLUE"] != "duplicate" || reasons["Blue Train"] != "duplicate" || reasons["Nameless"] == "" {
+		t.Errorf("Expected repeats, existing albums, and invalid entries to be skipped, got %+v", result.Skipped)
+	}
+
+	if a, err := srv.store.Get(t.Context(), result.Created[0].ID); err != nil || a.Artist != "Miles Davis" {
+		t.Errorf("Expected the imported album in the store, got %+v, %v", a, err)
+	}
+}
+
+// TestImportInvalidRequests tests that bad formats, prices, and playlists return 400.
+func TestImportInvalidRequests(t *testing.T) {
+	srv := newTestServer(t)
+	for _, tc := range []struct{ query, body string }{
+		{"format=pls", "[playlist]"},
+		{"", "#EXTM3U"},
+		{"format=m3u&price=free", "#EXTM3U"},
+		{"format=m3u&price=0", "#EXTM3U"},
+		{"format=xspf", "<playlist><trackList>"},
+	} {
+		if w, _ := postImport(t, srv, tc.query, tc.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", tc.query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// integrityIssue describes one discrepancy found by an integrity check.
+type integrityIssue struct {
+	Check    string `json:"check"`
+	AlbumID  string `json:"album_id,omitempty"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired"`
+}
+
+// integrityCheck verifies one invariant of the memory store's data. When repair is true the check
+// fixes what it safely can and marks those issues as repaired. Checks run with the store locked.
+type integrityCheck struct {
+	name string
+	run  func(s *memoryStore, repair bool) []integrityIssue
+}
+
+// integrityChecks are run in order by POST /admin/integrity.
+// Checks that repair data run before checks that only read it.
+var integrityChecks = []integrityCheck{
+	{"album_keys", checkAlbumKeys},
+	{"unique_upcs", checkUniqueUPCs},
+	{"upc_index", checkUPCIndex},
+}
+
+// checkAlbumKeys reports albums stored under a key other than their own ID, which makes them
+// unreachable by ID. Repair moves each one to its ID, or drops it if another album already has that ID.
+func checkAlbumKeys(s *memoryStore, repair bool) []integrityIssue {
+	var issues []integrityIssue
+	for _, key := range slices.Sorted(maps.Keys(s.albums)) {
+		e := s.albums[key]
+		if e.ID == key {
+			continue
+		}
+		_, taken := s.albums[e.ID]
+		detail := fmt.Sprintf("album %q is stored under key %q", e.Title, key)
+		if taken {
+			detail += " and duplicates another album's ID"
+		}
+		issues = append(issues, integrityIssue{
+			Check:    "album_keys",
+			AlbumID:  e.ID,
+			Detail:   detail,
+			Repaired: repair,
+		})
+		if repair {
+			delete(s.albums, key)
+			if !taken {
+				s.albums[e.ID] = e
+			}
+		}
+	}
+	return issues
+}
+
+// checkUniqueUPCs reports albums whose barcode is already used by another album.
+// These are never repaired automatically because either album could hold the correct code.
+func checkUniqueUPCs(s *memoryStore, _ bool) []integrityIssue {
+	var issues []integrityIssue
+	owners := make(map[string]string)
+	for _, a := range s.ordered() {
+		if a.UPC == "" {
+			continue
+		}
+		code := normalizeUPC(a.UPC)
+		if owner, ok := owners[code]; ok {
+			issues = append(issues, integrityIssue{
+				Check:   "unique_upcs",
+				AlbumID: a.ID,
+				Detail:  fmt.Sprintf("UPC %s is also used by album %s", a.UPC, owner),
+			})
+			continue
+		}
+		owners[code] = a.ID
+	}
+	return issues
+}
+
+// checkUPCIndex verifies that the UPC index has exactly one correct entry per album with a barcode.
+// Orphaned entries (pointing at a missing album or a stale code) are removed on repair, and
+// missing or misdirected entries are re-pointed at the album that holds the code.
+func checkUPCIndex(s *memoryStore, repair bool) []integrityIssue {
+	var issues []integrityIssue
+
+	expected := make(map[string]string)
+	for _, a := range s.ordered() {
+		if a.UPC == "" {
+			continue
+		}
+		if _, dup := expected[normalizeUPC(a.UPC)]; !dup {
+			expected[normalizeUPC(a.UPC)] = a.ID
+		}
+	}
+
+	for code, id := range s.upcIndex {
+		if _, ok := expected[code]; ok {
+			continue
+		}
+		issues = append(issues, integrityIssue{
+			Check:    "upc_index",
+			AlbumID:  id,
+			Detail:   fmt.Sprintf("orphaned index entry for UPC %s", code),
+			Repaired: repair,
+		})
+		if repair {
+			delete(s.upcIndex, code)
+		}
+	}
+
+	for code, id := range expected {
+		indexed, ok := s.upcIndex[code]
+		if ok && indexed == id {
+			continue
+		}
+		detail := fmt.Sprintf("UPC %s is not indexed", code)
+		if ok {
+			detail = fmt.Sprintf("UPC %s is indexed to album %s", code, indexed)
+		}
+		issues = append(issues, integrityIssue{
+			Check:    "upc_index",
+			AlbumID:  id,
+			Detail:   detail,
+			Repaired: repair,
+		})
+		if repair {
+			s.upcIndex[code] = id
+		}
+	}
+	return issues
+}
+
+// runIntegrityCheck handles POST /admin/integrity requests.
+// Runs every integrity check and returns the discrepancies found as JSON with HTTP 200 status.
+// With ?repair=true, discrepancies that can be fixed safely are repaired and marked as such.
+// Returns HTTP 501 if the configured store is not the memory store, whose index the checks verify.
+func (srv *Server) runIntegrityCheck(c *gin.Context) {
+	s, ok := srv.memoryStore()
+	if !ok {
+		c.IndentedJSON(http.StatusNotImplemented, gin.H{"error": "Integrity checks are only available for the memory store"})
+		return
+	}
+	repair := c.Query("repair") == "true"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issues := []integrityIssue{}
+	checks := make([]string, 0, len(integrityChecks))
+	for _, check := range integrityChecks {
+		issues = append(issues, check.run(s, repair)...)
+		checks = append(checks, check.name)
+	}
+
+	repaired := 0
+	for _, issue := range issues {
+		if issue.Repaired {
+			repaired++
+		}
+	}
+	if repaired > 0 {
+		s.listing.Store(nil)
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"checked_at": time.Now().Format(time.RFC3339),
+		"checks":     checks,
+		"albums":     len(s.albums),
+		"issues":     issues,
+		"repaired":   repaired,
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestIntegrityCheck tests the POST /admin/integrity endpoint.
+// Verifies that albums stored under the wrong key and UPC index discrepancies are reported, repaired with ?repair=true,
+// and that a second run finds no issues.
+func TestIntegrityCheck(t *testing.T) {
+	srv := newTestServer(t)
+
+	s, _ := srv.memoryStore()
+	blueTrain := s.albums["550e8400-e29b-41d4-a716-446655440001"]
+	blueTrain.UPC = "074646593622"
+	s.albums[blueTrain.ID] = blueTrain
+	s.albums["stale-key"] = s.albums["550e8400-e29b-41d4-a716-446655440002"]
+	s.upcIndex["4006381333931"] = "550e8400-e29b-41d4-a716-446655440002"
+
+	type report struct {
+		Albums   int              `json:"albums"`
+		Issues   []integrityIssue `json:"issues"`
+		Repaired int              `json:"repaired"`
+	}
+	run := func(path string) report {
+		w := srv.do("POST", path, "")
+		if w.Code != 200 {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		var r report
+		if err := json.Unmarshal(w.Body.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	// Duplicate under the wrong key, orphaned UPC entry, and missing UPC entry
+	if r := run("/admin/integrity"); len(r.Issues) != 3 || r.Repaired != 0 {
+		t.Errorf("Expected 3 unrepaired issues, got %+v", r)
+	}
+
+	if r := run("/admin/integrity?repair=true"); r.Repaired != 3 || r.Albums != 3 {
+		t.Errorf("Expected 3 repaired issues and 3 albums, got %+v", r)
+	}
+
+	if r := run("/admin/integrity"); len(r.Issues) != 0 {
+		t.Errorf("Expected no issues after repair, got %+v", r.Issues)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPurchaseQuantity is the most copies of an album one purchase may take.
+const maxPurchaseQuantity = 100
+
+// insufficientStockError is returned when a purchase asks for more copies of an album than are in
+// stock. Available is how many there are.
+type insufficientStockError struct {
+	Available int
+}
+
+func (e insufficientStockError) Error() string {
+	return fmt.Sprintf("only %d in stock", e.Available)
+}
+
+// validateQuantity validates an optional stock quantity, which must not be negative.
+// Returns an empty string if validation passes, otherwise returns an error message.
+func validateQuantity(quantity int) string {
+	if quantity < 0 {
+		return "Quantity must not be negative"
+	}
+	return ""
+}
+
+// purchaseAlbum handles POST /albums/:id/purchase requests.
+// Takes the quantity in the optional JSON body (default 1, at most 100) from the album's stock.
+// The stock is checked and decremented in a single store update, so concurrent purchases never
+// sell more copies than there are, however they interleave. Returns the album with its remaining
+// quantity as JSON with HTTP 200 status.
+// Returns HTTP 400 if the body is invalid, HTTP 404 if the album is not found, or HTTP 409 with
+// the quantity available if there are too few copies in stock; albums without a quantity have none.
+func (srv *Server) purchaseAlbum(c *gin.Context) {
+	req := struct {
+		Quantity int `json:"quantity"`
+	}{Quantity: 1}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON", "details": err.Error()})
+			return
+		}
+	}
+	if req.Quantity < 1 || req.Quantity > maxPurchaseQuantity {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("quantity must be between 1 and %d", maxPurchaseQuantity)})
+		return
+	}
+
+	var previous Album
+	updated, err := srv.updateAlbum(c.Request.Context(), c.Param("id"), func(a *Album) error {
+		previous = *a
+		var available int
+		if a.Quantity != nil {
+			available = *a.Quantity
+		}
+		if available < req.Quantity {
+			return insufficientStockError{Available: available}
+		}
+		remaining := available - req.Quantity
+		a.Quantity = &remaining
+		return nil
+	})
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	srv.publishAlbumEvent(c.Request.Context(), eventAlbumUpdated, updated, &previous)
+	renderAlbum(c, http.StatusOK, updated)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestPurchaseAlbum tests taking copies of an album from stock.
+// Verifies that a purchase decrements the quantity, that buying more than is in stock returns 409
+// with the quantity available, and that the quantity is validated.
+func TestPurchaseAlbum(t *testing.T) {
+	srv := newTestServer(t)
+	const album = "/albums/550e8400-e29b-41d4-a716-446655440001"
+
+	if w := srv.do("POST", album+"/purchase", ""); w.Code != 409 || !strings.Contains(w.Body.String(), `"available": 0`) {
+		t.Errorf("Expected 409 buying an album without stock, got %d: %s", w.Code, w.Body)
+	}
+	srv.do("PATCH", album, `{"quantity": 3}`, "If-Match", "*")
+	var a Album
+	w := srv.do("POST", album+"/purchase", `{"quantity": 2}`)
+	json.Unmarshal(w.Body.Bytes(), &a)
+	if w.Code != 200 || a.Quantity == nil || *a.Quantity != 1 {
+		t.Errorf("Expected 1 copy left, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("POST", album+"/purchase", `{"quantity": 2}`); w.Code != 409 || !strings.Contains(w.Body.String(), `"available": 1`) {
+		t.Errorf("Expected 409 buying more copies than are left, got %d: %s", w.Code, w.Body)
+	}
+
+	for _, tc := range [][3]string{
+		{"POST", album + "/purchase", `{"quantity": 0}`},
+		{"POST", album + "/purchase", `{"quantity": 101}`},
+		{"PATCH", album, `{"quantity": -1}`},
+	} {
+		if w := srv.do(tc[0], tc[1], tc[2], "If-Match", "*"); w.Code != 400 {
+			t.Errorf("%s %s %s: expected 400, got %d", tc[0], tc[1], tc[2], w.Code)
+		}
+	}
+	if w := srv.do("POST", "/albums/550e8400-e29b-41d4-a716-446655440099/purchase", ""); w.Code != 404 {
+		t.Errorf("Expected 404 for a missing album, got %d", w.Code)
+	}
+}
+
+// TestConcurrentPurchases tests that concurrent purchases never sell more copies than are in stock,
+// with and without the write-back cache in front of the store.
+func TestConcurrentPurchases(t *testing.T) {
+	for _, policy := range []string{"", "write-back"} {
+		srv := newTestServer(t, func(cfg *Config) { cfg.CacheWritePolicy = policy })
+		const album = "/albums/550e8400-e29b-41d4-a716-446655440002"
+		req := httptest.NewRequest("PATCH", album, strings.NewReader(`{"quantity": 50}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		srv.router.ServeHTTP(httptest.NewRecorder(), req)
+
+		var sold, soldOut atomic.Int64
+		var wg sync.WaitGroup
+		for range 200 {
+			wg.Go(func() {
+				w := httptest.NewRecorder()
+				srv.router.ServeHTTP(w, httptest.NewRequest("POST", album+"/purchase", nil))
+				switch w.Code {
+				case 200:
+					sold.Add(1)
+				case 409:
+					soldOut.Add(1)
+				}
+			})
+		}
+		wg.Wait()
+
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, httptest.NewRequest("GET", album, nil))
+		var a Album
+		json.Unmarshal(w.Body.Bytes(), &a)
+		if sold.Load() != 50 || soldOut.Load() != 150 || a.Quantity == nil || *a.Quantity != 0 {
+			t.Errorf("Policy %q: expected 50 sold, 150 sold out, and none left, got %d, %d, and %v", policy, sold.Load(), soldOut.Load(), a.Quantity)
+		}
+	}
+}
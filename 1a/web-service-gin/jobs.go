@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Job statuses, in the order a job goes through them. A job fails if its request panics or
+// returns an error status.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// errJobQueueFull is returned by jobRunner.submit when MAX_QUEUED_JOBS jobs are already waiting.
+var errJobQueueFull = errors.New("too many jobs are waiting to run")
+
+// jobProgress counts the items a job has finished out of its total, which is 0 until known.
+type jobProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total,omitempty"`
+}
+
+// job is a bulk request run in the background. Its fields are guarded by the runner's mu.
+type job struct {
+	ID         string      `json:"id"`
+	Request    string      `json:"request"`
+	Status     string      `json:"status"`
+	Progress   jobProgress `json:"progress"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  time.Time   `json:"started_at,omitzero"`
+	FinishedAt time.Time   `json:"finished_at,omitzero"`
+	// Result is the URL of the job's response once it has finished, and ResultStatus its status.
+	Result       string `json:"result,omitempty"`
+	ResultStatus int    `json:"result_status,omitempty"`
+	Error        string `json:"error,omitempty"`
+
+	tenant string
+	// prefix is the API version prefix of the job's request, which its URLs are under.
+	prefix string
+	runner *jobRunner
+	// response is the recorded response of the job's request, spooled to a temporary file.
+	response *jobRecorder
+}
+
+// jobKey is the context key holding the job a request runs for.
+type jobKey struct{}
+
+// jobRunner runs jobs in the background, at most workers at a time, and keeps finished jobs and
+// their responses for the retention period.
+type jobRunner struct {
+	workers   chan struct{}
+	maxQueued int
+	retention time.Duration
+	now       func() time.Time
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	queued int
+}
+
+// newJobRunner creates a runner configured by cfg.JobWorkers, cfg.MaxQueuedJobs, and cfg.JobRetention.
+func newJobRunner(cfg Config) *jobRunner {
+	return &jobRunner{
+		workers:   make(chan struct{}, max(1, cfg.JobWorkers)),
+		maxQueued: cfg.MaxQueuedJobs,
+		retention: cfg.JobRetention,
+		now:       time.Now,
+		jobs:      make(map[string]*job),
+	}
+}
+
+// submit queues j and runs run for it once a worker is free. Returns errJobQueueFull if too
+// many jobs are already waiting. Jobs finished longer than the retention period ago are dropped.
+func (r *jobRunner) submit(j *job, run func()) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, old := range r.jobs {
+		if !old.FinishedAt.IsZero() && r.now().Sub(old.FinishedAt) > r.retention {
+			old.response.discard()
+			delete(r.jobs, id)
+		}
+	}
+	if r.queued >= r.maxQueued {
+		return errJobQueueFull
+	}
+	r.queued++
+	r.jobs[j.ID] = j
+
+	go func() {
+		r.workers <- struct{}{}
+		defer func() { <-r.workers }()
+		r.mu.Lock()
+		r.queued--
+		j.Status, j.StartedAt = jobRunning, r.now().UTC()
+		r.mu.Unlock()
+		run()
+	}()
+	return nil
+}
+
+// get returns a copy of the job with the given ID if it belongs to tenant.
+func (r *jobRunner) get(id, tenant string) (job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok || j.tenant != tenant {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// finish records the outcome of j: its recorded response, or the error that stopped it.
+func (r *jobRunner) finish(j *job, response *jobRecorder, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j.FinishedAt, j.response = r.now().UTC(), response
+	switch {
+	case err != nil:
+		j.Status, j.Error = jobFailed, err.Error()
+		return
+	case response.status >= http.StatusBadRequest:
+		j.Status = jobFailed
+	default:
+		j.Status = jobSucceeded
+	}
+	j.Result, j.ResultStatus = j.prefix+"/jobs/"+j.ID+"/result", response.status
+}
+
+// reportProgress records that done of total items of the job running the request in ctx are
+// finished; total is 0 if it is not known. Does nothing for requests that are not jobs.
+func reportProgress(ctx context.Context, done, total int) {
+	j, ok := ctx.Value(jobKey{}).(*job)
+	if !ok {
+		return
+	}
+	j.runner.mu.Lock()
+	defer j.runner.mu.Unlock()
+	j.Progress = jobProgress{Done: done, Total: total}
+}
+
+// inJob reports whether the request in ctx runs for a job.
+func inJob(ctx context.Context) bool {
+	return ctx.Value(jobKey{}) != nil
+}
+
+// jobRecorder is the http.ResponseWriter a job's request writes to. The body is spooled to a
+// temporary file, so large results such as exports are not held in memory; file is closed once
+// the request has been served.
+type jobRecorder struct {
+	header http.Header
+	status int
+	file   *os.File
+}
+
+func (w *jobRecorder) Header() http.Header { return w.header }
+
+func (w *jobRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *jobRecorder) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.file.Write(b)
+}
+
+// Flush does nothing; the response is only read once the job has finished.
+func (w *jobRecorder) Flush() {}
+
+// discard deletes the spooled response. It is safe to call on a nil recorder.
+func (w *jobRecorder) discard() {
+	if w == nil {
+		return
+	}
+	os.Remove(w.file.Name())
+}
+
+// wantsAsync reports whether the request asks to run as a job with ?async=true or a
+// "Prefer: respond-async" header.
+func wantsAsync(c *gin.Context) bool {
+	if async, _ := strconv.ParseBool(c.Query("async")); async {
+		return true
+	}
+	for _, pref := range strings.Split(c.GetHeader("Prefer"), ",") {
+		if strings.TrimSpace(pref) == "respond-async" {
+			return true
+		}
+	}
+	return false
+}
+
+// asyncMiddleware lets clients run the bulk endpoint it is installed on as a job: a request asking
+// for that (see wantsAsync) is answered at once with HTTP 202, the job as JSON, and its URL in the
+// Location header, and is replayed through the router in the background, without the async
+// preference and with the original headers. Returns HTTP 503 if too many jobs are waiting.
+func (srv *Server) asyncMiddleware(c *gin.Context) {
+	if !wantsAsync(c) || inJob(c.Request.Context()) {
+		c.Next()
+		return
+	}
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		body, err = io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes))
+		if err != nil {
+			c.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large", "details": err.Error()})
+			c.Abort()
+			return
+		}
+	}
+
+	u := *c.Request.URL
+	query := u.Query()
+	query.Del("async")
+	u.RawQuery = query.Encode()
+	j := &job{
+		ID:        uuid.New().String(),
+		Request:   c.Request.Method + " " + c.FullPath(),
+		Status:    jobQueued,
+		CreatedAt: srv.jobs.now().UTC(),
+		tenant:    tenantFrom(c.Request.Context()),
+		prefix:    requestAPIPrefix(c),
+		runner:    srv.jobs,
+	}
+	ctx := context.WithValue(context.Background(), jobKey{}, j)
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+	req.Header = c.Request.Header.Clone()
+	req.Header.Del("Prefer")
+	req.RemoteAddr = c.Request.RemoteAddr
+
+	err = srv.jobs.submit(j, func() { srv.runJob(j, req) })
+	if err != nil {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"error": "Too many jobs are waiting to run; try again later"})
+		c.Abort()
+		return
+	}
+	queued, _ := srv.jobs.get(j.ID, j.tenant)
+	c.Header("Location", j.prefix+"/jobs/"+j.ID)
+	c.Header("Preference-Applied", "respond-async")
+	c.IndentedJSON(http.StatusAccepted, queued)
+	c.Abort()
+}
+
+// runJob serves req, the request of j, through the router and records its response.
+func (srv *Server) runJob(j *job, req *http.Request) {
+	file, err := os.CreateTemp("", "album-job-*")
+	if err != nil {
+		srv.jobs.finish(j, nil, err)
+		return
+	}
+	w := &jobRecorder{header: make(http.Header), file: file}
+	defer func() {
+		file.Close()
+		if p := recover(); p != nil {
+			log.Printf("job %s panicked: %v", j.ID, p)
+			w.discard()
+			srv.jobs.finish(j, nil, errors.New("internal error"))
+		}
+	}()
+	srv.router.ServeHTTP(w, req)
+	if err := file.Sync(); err != nil {
+		w.discard()
+		srv.jobs.finish(j, nil, err)
+		return
+	}
+	srv.jobs.finish(j, w, nil)
+}
+
+// getJob handles GET /jobs/:id requests.
+// Returns the job's status, progress, and timestamps, and once it has finished the URL and status
+// of its result, as JSON with HTTP 200 status.
+// Returns HTTP 404 if there is no such job for the tenant, or it expired.
+func (srv *Server) getJob(c *gin.Context) {
+	j, ok := srv.jobs.get(c.Param("id"), tenantFrom(c.Request.Context()))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "job not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, j)
+}
+
+// getJobResult handles GET /jobs/:id/result requests.
+// Returns the response the job's request produced, with its status, content type, and
+// Content-Disposition header.
+// Returns HTTP 404 if there is no such job for the tenant or it has no result, or HTTP 409 if the
+// job has not finished yet.
+func (srv *Server) getJobResult(c *gin.Context) {
+	j, ok := srv.jobs.get(c.Param("id"), tenantFrom(c.Request.Context()))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "job not found"})
+		return
+	}
+	if j.FinishedAt.IsZero() {
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "Job has not finished yet", "status": j.Status})
+		return
+	}
+	if j.response == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "job has no result", "error": j.Error})
+		return
+	}
+	f, err := os.Open(j.response.file.Name())
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "job result expired"})
+		return
+	}
+	defer f.Close()
+	for _, name := range []string{"Content-Type", "Content-Disposition"} {
+		if value := j.response.header.Get(name); value != "" {
+			c.Header(name, value)
+		}
+	}
+	c.Status(j.response.status)
+	io.Copy(c.Writer, f)
+}
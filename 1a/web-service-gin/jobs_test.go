@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForJob polls GET /jobs/:id until the job has finished and returns it.
+func waitForJob(t *testing.T, srv *Server, location string) job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := srv.do("GET", location, "")
+		if w.Code != 200 {
+			t.Fatalf("GET %s: expected 200, got %d: %s", location, w.Code, w.Body.String())
+		}
+		var j job
+		json.Unmarshal(w.Body.Bytes(), &j)
+		if !j.FinishedAt.IsZero() {
+			return j
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job %s did not finish: %+v", location, j)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestAsyncBulkJob tests running POST /albums/batch as a background job with ?async=true.
+// Verifies the HTTP 202 response and Location header, the job's progress and result once it has
+// finished, and that other tenants cannot see the job.
+func TestAsyncBulkJob(t *testing.T) {
+	srv := newTestServer(t)
+	body := `[
+		{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99},
+		{"title": "", "artist": "Nobody", "price": 9.99}
+	]`
+	w := srv.do("POST", "/albums/batch?async=true", body)
+	location := w.Header().Get("Location")
+	if w.Code != 202 || !strings.HasPrefix(location, "/jobs/") {
+		t.Fatalf("Expected 202 with a job location, got %d %q: %s", w.Code, location, w.Body.String())
+	}
+
+	j := waitForJob(t, srv, location)
+	if j.Status != jobSucceeded || j.ResultStatus != 207 || j.Progress != (jobProgress{Done: 2, Total: 2}) || j.Request != "POST /albums/batch" {
+		t.Fatalf("Expected a succeeded job with a 207 result and 2/2 progress, got %+v", j)
+	}
+	w = srv.do("GET", j.Result, "")
+	var result struct {
+		Created int `json:"created"`
+		Failed  int `json:"failed"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != 207 || result.Created != 1 || result.Failed != 1 {
+		t.Errorf("Expected the 207 bulk response, got %d: %s", w.Code, w.Body.String())
+	}
+	if all, _ := srv.store.List(t.Context()); len(all) != 4 {
+		t.Errorf("Expected 4 albums, got %d", len(all))
+	}
+
+	w = srv.do("GET", location, "", tenantHeader, "other")
+	if w.Code != 404 {
+		t.Errorf("Expected 404 for another tenant's job, got %d", w.Code)
+	}
+}
+
+// TestAsyncExportJob tests running GET /albums/export as a job requested with a Prefer header.
+// Verifies the job's result carries the export's content type and body.
+func TestAsyncExportJob(t *testing.T) {
+	srv := newTestServer(t)
+	w := srv.do("GET", "/albums/export?format=ndjson", "", "Prefer", "respond-async")
+	if w.Code != 202 || w.Header().Get("Preference-Applied") != "respond-async" {
+		t.Fatalf("Expected 202 with Preference-Applied, got %d: %s", w.Code, w.Body.String())
+	}
+
+	j := waitForJob(t, srv, w.Header().Get("Location"))
+	w = srv.do("GET", j.Result, "")
+	if w.Code != 200 || w.Header().Get("Content-Type") != "application/x-ndjson" || strings.Count(w.Body.String(), "\n") != 3 {
+		t.Errorf("Expected 3 NDJSON albums, got %d %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
+
+// TestJobRunnerQueueFull tests that jobs are refused once MAX_QUEUED_JOBS are waiting for a worker.
+func TestJobRunnerQueueFull(t *testing.T) {
+	r := newJobRunner(Config{JobWorkers: 1, MaxQueuedJobs: 1, JobRetention: time.Hour})
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	r.submit(&job{ID: "running"}, func() {
+		close(started)
+		<-release
+	})
+	<-started
+	if err := r.submit(&job{ID: "queued"}, func() {}); err != nil {
+		t.Fatalf("Expected the second job to queue, got %v", err)
+	}
+	if err := r.submit(&job{ID: "refused"}, func() {}); err != errJobQueueFull {
+		t.Errorf("Expected errJobQueueFull, got %v", err)
+	}
+	if _, ok := r.get("refused", ""); ok {
+		t.Error("Expected the refused job not to be kept")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// journalEntry records one mutating request and its outcome.
+type journalEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	BodyHash   string    `json:"body_sha256,omitempty"`
+	Actor      string    `json:"actor"`
+	Status     int       `json:"status"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// requestJournal is a fixed-size ring buffer of the most recent mutating requests.
+// Once full, each new entry overwrites the oldest one.
+type requestJournal struct {
+	mu      sync.Mutex
+	entries []journalEntry
+	next    int
+	full    bool
+}
+
+// newRequestJournal creates a journal holding up to size entries.
+// Returns nil if size is not positive, which disables journaling.
+func newRequestJournal(size int) *requestJournal {
+	if size <= 0 {
+		return nil
+	}
+	return &requestJournal{entries: make([]journalEntry, size)}
+}
+
+// record appends e, overwriting the oldest entry if the journal is full.
+func (j *requestJournal) record(e journalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries[j.next] = e
+	j.next = (j.next + 1) % len(j.entries)
+	if j.next == 0 {
+		j.full = true
+	}
+}
+
+// recent returns up to limit entries accepted by keep, newest first.
+func (j *requestJournal) recent(limit int, keep func(journalEntry) bool) []journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	count := j.next
+	if j.full {
+		count = len(j.entries)
+	}
+	result := []journalEntry{}
+	for i := 1; i <= count && len(result) < limit; i++ {
+		e := j.entries[(j.next-i+len(j.entries))%len(j.entries)]
+		if keep(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// journalMiddleware records every POST, PUT, PATCH, and DELETE request in j.
+// The body is hashed rather than stored so the journal stays small and never holds payload data.
+// The request ID and actor are taken from the request scope (see requestScopeMiddleware).
+func journalMiddleware(j *requestJournal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			c.Next()
+			return
+		}
+
+		var bodyHash string
+		if c.Request.Body != nil {
+			body, err := io.ReadAll(c.Request.Body)
+			if err == nil && len(body) > 0 {
+				sum := sha256.Sum256(body)
+				bodyHash = hex.EncodeToString(sum[:])
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		ctx := c.Request.Context()
+		start := time.Now()
+		c.Next()
+
+		j.record(journalEntry{
+			Time:       start,
+			RequestID:  requestIDFrom(ctx),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.RequestURI(),
+			BodyHash:   bodyHash,
+			Actor:      identityFrom(ctx).Actor,
+			Status:     c.Writer.Status(),
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		})
+	}
+}
+
+// getJournal handles GET /admin/journal requests.
+// Returns the most recent journal entries, newest first, as JSON with HTTP 200 status.
+// Supports optional filters: limit (default 100), method, actor, and status (e.g. 404, or 4xx for a class).
+// Returns HTTP 404 if journaling is disabled, or HTTP 400 if limit is invalid.
+func (srv *Server) getJournal(c *gin.Context) {
+	if srv.journal == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Request journal is disabled; set JOURNAL_SIZE to enable it"})
+		return
+	}
+
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = n
+	}
+
+	method, actor, status := c.Query("method"), c.Query("actor"), c.Query("status")
+	entries := srv.journal.recent(limit, func(e journalEntry) bool {
+		if method != "" && e.Method != method {
+			return false
+		}
+		if actor != "" && e.Actor != actor {
+			return false
+		}
+		if status != "" {
+			code := strconv.Itoa(e.Status)
+			if len(status) == 3 && status[1:] == "xx" {
+				return code[0] == status[0]
+			}
+			return code == status
+		}
+		return true
+	})
+	c.IndentedJSON(http.StatusOK, entries)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestJournal tests the request journal middleware and the GET /admin/journal endpoint.
+// Verifies that mutating requests are recorded newest first with actor, body hash, and status,
+// read-only requests are skipped, the status filter works, and old entries are overwritten.
+func TestJournal(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.JournalSize = 2 })
+
+	for _, path := range []string{"/albums/first", "/albums/second"} {
+		req, _ := http.NewRequest("DELETE", path, nil)
+		req.Header.Set("If-Match", "*")
+		srv.router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	body := `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}`
+	srv.do("POST", "/albums", body, "X-Actor", "grader", requestIDHeader, "req-1")
+
+	w := srv.do("GET", "/admin/journal", "")
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var entries []journalEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Method != "POST" || entries[0].Actor != "grader" || entries[0].RequestID != "req-1" || entries[0].Status != 201 {
+		t.Errorf("Unexpected newest entry: %+v", entries[0])
+	}
+	if entries[0].BodyHash == "" {
+		t.Error("Body hash should be recorded")
+	}
+	if entries[1].Path != "/albums/second" {
+		t.Errorf("Expected '/albums/second', got '%s'", entries[1].Path)
+	}
+
+	// Test status class filter
+	w = srv.do("GET", "/admin/journal?status=4xx", "")
+	json.Unmarshal(w.Body.Bytes(), &entries)
+	if len(entries) != 1 || entries[0].Status != 404 {
+		t.Errorf("Expected one 404 entry, got %+v", entries)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jsonPatchContentType selects RFC 6902 JSON Patch semantics on PATCH /albums/:id.
+const jsonPatchContentType = "application/json-patch+json"
+
+// errPatchTestFailed is returned when a JSON Patch "test" operation does not match the album.
+var errPatchTestFailed = errors.New("JSON Patch test operation failed")
+
+// readOnlyAlbumFields are album fields a JSON Patch may not touch; the server maintains them.
+var readOnlyAlbumFields = readOnlyFieldNames(1)
+
+// patchOperation is one operation of an RFC 6902 JSON Patch document.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("pointer %q must start with '/'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// checkAlbumPointer returns an error message unless pointer names a field, or part of a field,
+// that clients may change.
+func checkAlbumPointer(pointer string) string {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return err.Error()
+	}
+	if len(tokens) == 0 {
+		return "JSON Patch cannot replace the whole album; use PUT"
+	}
+	if slices.Contains(readOnlyAlbumFields, tokens[0]) {
+		return fmt.Sprintf("%s cannot be changed", pointer)
+	}
+	return ""
+}
+
+// parseJSONPatch reads a JSON Patch document from the request body. Returns an error message if
+// it is not valid JSON, an operation is unknown or incomplete, or a path is not a changeable field.
+func parseJSONPatch(c *gin.Context) ([]patchOperation, string) {
+	var ops []patchOperation
+	if err := json.NewDecoder(c.Request.Body).Decode(&ops); err != nil {
+		return nil, "Invalid JSON Patch: " + err.Error()
+	}
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Sprintf("operation %d: %s requires a value", i, op.Op)
+			}
+		case "move", "copy":
+			if errMsg := checkAlbumPointer(op.From); errMsg != "" {
+				return nil, fmt.Sprintf("operation %d: %s", i, errMsg)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Sprintf("operation %d: unknown op %q", i, op.Op)
+		}
+		if errMsg := checkAlbumPointer(op.Path); errMsg != "" {
+			return nil, fmt.Sprintf("operation %d: %s", i, errMsg)
+		}
+	}
+	return ops, ""
+}
+
+// arrayIndex parses token as an index into a list of length n. end allows n itself, as when adding.
+func arrayIndex(token string, n int, end bool) (int, error) {
+	if end && token == "-" {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > n || (i == n && !end) || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+// patchGet returns the value at tokens in doc.
+func patchGet(doc any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]any:
+			child, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%q does not exist", token)
+			}
+			doc = child
+		case []any:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%q does not exist", token)
+		}
+	}
+	return doc, nil
+}
+
+// patchAdd returns doc with value added at tokens: set on an object, or inserted into a list.
+func patchAdd(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	token, rest := tokens[0], tokens[1:]
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(rest) == 0 {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%q does not exist", token)
+		}
+		updated, err := patchAdd(child, rest, value)
+		node[token] = updated
+		return node, err
+	case []any:
+		i, err := arrayIndex(token, len(node), len(rest) == 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			return slices.Insert(node, i, value), nil
+		}
+		node[i], err = patchAdd(node[i], rest, value)
+		return node, err
+	}
+	return nil, fmt.Errorf("%q does not exist", token)
+}
+
+// patchRemove returns doc with the value at tokens removed.
+func patchRemove(doc any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	token, rest := tokens[0], tokens[1:]
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%q does not exist", token)
+		}
+		if len(rest) == 0 {
+			delete(node, token)
+			return node, nil
+		}
+		updated, err := patchRemove(child, rest)
+		node[token] = updated
+		return node, err
+	case []any:
+		i, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			return slices.Delete(node, i, i+1), nil
+		}
+		node[i], err = patchRemove(node[i], rest)
+		return node, err
+	}
+	return nil, fmt.Errorf("%q does not exist", token)
+}
+
+// applyJSONPatch applies ops in order to doc, a decoded JSON value, and returns the result.
+// Returns errPatchTestFailed if a test operation does not match, or another error if an
+// operation cannot be applied.
+func applyJSONPatch(doc any, ops []patchOperation) (any, error) {
+	for i, op := range ops {
+		path, err := parseJSONPointer(op.Path)
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		if op.Value != nil {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, err
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			doc, err = patchAdd(doc, path, value)
+		case "remove":
+			doc, err = patchRemove(doc, path)
+		case "replace":
+			if _, err = patchGet(doc, path); err == nil {
+				if doc, err = patchRemove(doc, path); err == nil {
+					doc, err = patchAdd(doc, path, value)
+				}
+			}
+		case "move", "copy":
+			var from []string
+			if from, err = parseJSONPointer(op.From); err != nil {
+				break
+			}
+			if op.Op == "move" && len(path) > len(from) && slices.Equal(path[:len(from)], from) {
+				err = errors.New("cannot move a value into itself")
+				break
+			}
+			if value, err = patchGet(doc, from); err != nil {
+				break
+			}
+			if op.Op == "move" {
+				if doc, err = patchRemove(doc, from); err != nil {
+					break
+				}
+			} else {
+				// Copies must not share maps or lists with the original.
+				var copied bytes.Buffer
+				json.NewEncoder(&copied).Encode(value)
+				json.Unmarshal(copied.Bytes(), &value)
+			}
+			doc, err = patchAdd(doc, path, value)
+		case "test":
+			var current any
+			if current, err = patchGet(doc, path); err == nil && !reflect.DeepEqual(current, value) {
+				return nil, errPatchTestFailed
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+// patchAlbum applies the JSON Patch ops to a's JSON representation and validates the result as a
+// complete album (see validateAlbum). Returns a validationError if the patch cannot be applied,
+// fieldErrors if the result is invalid, or errPatchTestFailed if a test operation fails.
+func patchAlbum(a *Album, ops []patchOperation, genres []string) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc, err = applyJSONPatch(doc, ops); err != nil {
+		if errors.Is(err, errPatchTestFailed) {
+			return err
+		}
+		return validationError(err.Error())
+	}
+
+	if data, err = json.Marshal(doc); err != nil {
+		return err
+	}
+	var patched Album
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patched); err != nil {
+		return validationError("Patched album is invalid: " + err.Error())
+	}
+	if err := validateAlbum(&patched, genres); err != nil {
+		return err
+	}
+	*a = patched
+	return nil
+}
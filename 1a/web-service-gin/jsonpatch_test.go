@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestApplyJSONPatch tests the JSON Patch operations on plain JSON documents.
+func TestApplyJSONPatch(t *testing.T) {
+	for _, tc := range []struct {
+		doc, patch, want string
+	}{
+		{`{"a": 1}`, `[{"op": "add", "path": "/b", "value": [1, 2]}]`, `{"a":1,"b":[1,2]}`},
+		{`{"a": [1, 3]}`, `[{"op": "add", "path": "/a/1", "value": 2}]`, `{"a":[1,2,3]}`},
+		{`{"a": [1]}`, `[{"op": "add", "path": "/a/-", "value": 2}]`, `{"a":[1,2]}`},
+		{`{"a": 1, "b": 2}`, `[{"op": "remove", "path": "/a"}]`, `{"b":2}`},
+		{`{"a": [1, 2, 3]}`, `[{"op": "remove", "path": "/a/1"}]`, `{"a":[1,3]}`},
+		{`{"a": 1}`, `[{"op": "replace", "path": "/a", "value": null}]`, `{"a":null}`},
+		{`{"a": {"b": 1}}`, `[{"op": "move", "from": "/a/b", "path": "/c"}]`, `{"a":{},"c":1}`},
+		{`{"a": [1]}`, `[{"op": "copy", "from": "/a", "path": "/b"}, {"op": "add", "path": "/b/-", "value": 2}]`, `{"a":[1],"b":[1,2]}`},
+		{`{"a/b": 1, "m~n": 2}`, `[{"op": "remove", "path": "/a~1b"}, {"op": "test", "path": "/m~0n", "value": 2}]`, `{"m~n":2}`},
+	} {
+		var doc any
+		var ops []patchOperation
+		json.Unmarshal([]byte(tc.doc), &doc)
+		json.Unmarshal([]byte(tc.patch), &ops)
+		got, err := applyJSONPatch(doc, ops)
+		data, _ := json.Marshal(got)
+		if err != nil || string(data) != tc.want {
+			t.Errorf("%s: expected %s, got %s, %v", tc.patch, tc.want, data, err)
+		}
+	}
+
+	for _, patch := range []string{
+		`[{"op": "remove", "path": "/missing"}]`,
+		`[{"op": "replace", "path": "/missing", "value": 1}]`,
+		`[{"op": "add", "path": "/a/5", "value": 1}]`,
+		`[{"op": "add", "path": "/a/01", "value": 1}]`,
+		`[{"op": "move", "from": "/a", "path": "/a/0"}]`,
+		`[{"op": "test", "path": "/a", "value": [2]}]`,
+	} {
+		var doc any
+		var ops []patchOperation
+		json.Unmarshal([]byte(`{"a": [1]}`), &doc)
+		json.Unmarshal([]byte(patch), &ops)
+		if _, err := applyJSONPatch(doc, ops); err == nil {
+			t.Errorf("%s: expected an error", patch)
+		}
+	}
+}
+
+// TestPatchAlbumJSONPatch tests PATCH /albums/:id with an RFC 6902 JSON Patch body.
+// Verifies that fields can be replaced and cleared, that the result is validated, that
+// server-managed fields cannot be patched, and that a failed test operation returns HTTP 409.
+func TestPatchAlbumJSONPatch(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", `[
+		{"op": "test", "path": "/title", "value": "Blue Train"},
+		{"op": "replace", "path": "/price", "value": 29.99},
+		{"op": "add", "path": "/upc", "value": "074646593622"},
+		{"op": "add", "path": "/tags", "value": ["Jazz"]}
+	]`, "Content-Type", jsonPatchContentType, "If-Match", "*")
+	var album Album
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if w.Code != 200 || album.Price != 29.99 || album.UPC != "074646593622" || len(album.Tags) != 1 || album.Tags[0] != "jazz" {
+		t.Fatalf("Expected the patched album, got %d: %s", w.Code, w.Body)
+	}
+
+	w = srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", `[{"op": "remove", "path": "/upc"}, {"op": "remove", "path": "/tags/0"}]`, "Content-Type", jsonPatchContentType, "If-Match", "*")
+	var cleared Album
+	json.Unmarshal(w.Body.Bytes(), &cleared)
+	if w.Code != 200 || cleared.UPC != "" || cleared.Tags != nil {
+		t.Errorf("Expected the UPC and tags to be cleared, got %d: %s", w.Code, w.Body)
+	}
+
+	for _, tc := range []struct {
+		body string
+		want int
+	}{
+		{`[{"op": "remove", "path": "/title"}]`, 400},
+		{`[{"op": "replace", "path": "/price", "value": "cheap"}]`, 400},
+		{`[{"op": "add", "path": "/color", "value": "blue"}]`, 400},
+		{`[{"op": "replace", "path": "/id", "value": "other"}]`, 400},
+		{`[{"op": "frobnicate", "path": "/title"}]`, 400},
+		{`{"op": "remove", "path": "/upc"}`, 400},
+		{`[{"op": "test", "path": "/title", "value": "Jeru"}]`, 409},
+	} {
+		if w := srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", tc.body, "Content-Type", jsonPatchContentType, "If-Match", "*"); w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.body, tc.want, w.Code, w.Body)
+		}
+	}
+	if a, _ := srv.store.Get(t.Context(), "550e8400-e29b-41d4-a716-446655440001"); a.Title != "Blue Train" || a.Price != 29.99 {
+		t.Errorf("Expected rejected patches to leave the album unchanged, got %+v", a)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// updateAlbum applies mutate through the store and stamps the album updated if it succeeds.
+// Handlers and jobs use it instead of calling store.Update directly.
+func (srv *Server) updateAlbum(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return srv.store.Update(ctx, id, stamped(mutate))
+}
+
+// updateAlbumUnique is updateAlbum for changes that may retitle the album, returning a
+// duplicateAlbumError instead if it would get the title and artist of another album (see
+// updateUnique).
+func (srv *Server) updateAlbumUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return updateUnique(ctx, srv.store, id, stamped(mutate))
+}
+
+// stamped wraps an Update mutation to stamp the album updated if it succeeds.
+func stamped(mutate func(*Album) error) func(*Album) error {
+	return func(a *Album) error {
+		if err := mutate(a); err != nil {
+			return err
+		}
+		stampUpdated(a, time.Now().UTC())
+		return nil
+	}
+}
+
+// stampUpdated records that a changed at: it sets UpdatedAt and moves Version on. Every write
+// that changes a stored album stamps it.
+func stampUpdated(a *Album, at time.Time) {
+	a.UpdatedAt = at
+	a.Version++
+}
+
+// recordDeletion notes that an album was just deleted. Deletions leave no album behind to carry a
+// timestamp, so the collection's last-modified time includes the last one.
+func (srv *Server) recordDeletion() {
+	srv.lastDeletion.Store(time.Now().UnixNano())
+}
+
+// collectionModified returns when the collection last changed: the latest album update or deletion.
+func (srv *Server) collectionModified(all []Album) time.Time {
+	latest := time.Unix(0, srv.lastDeletion.Load())
+	for _, a := range all {
+		if a.UpdatedAt.After(latest) {
+			latest = a.UpdatedAt
+		}
+	}
+	return latest
+}
+
+// notModified sets the Last-Modified header to modified and checks it against If-Modified-Since.
+// If the resource has not changed since then, it responds with HTTP 304 and returns true.
+// HTTP dates have one-second resolution, so modified is compared truncated to the second.
+func notModified(c *gin.Context, modified time.Time) bool {
+	if modified.IsZero() || modified.Unix() <= 0 {
+		return false
+	}
+	c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	if err != nil || modified.Truncate(time.Second).After(since) {
+		return false
+	}
+	c.Status(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestConditionalGetLastModified tests If-Modified-Since handling on GET /albums/:id and GET /albums.
+// Verifies that Last-Modified is set, that unchanged resources return HTTP 304, and that updates
+// and deletions make the album and collection return HTTP 200 again.
+func TestConditionalGetLastModified(t *testing.T) {
+	hourAgo := time.Now().Add(-time.Hour).UTC()
+	seed := seedAlbums()
+	for i := range seed {
+		seed[i].UpdatedAt = hourAgo
+	}
+	srv := newTestServerWith(t, newMemoryStore(seed))
+
+	albumPath := "/albums/550e8400-e29b-41d4-a716-446655440002"
+
+	w := srv.do("GET", albumPath, "")
+	modified := w.Header().Get("Last-Modified")
+	if modified != hourAgo.Format(http.TimeFormat) {
+		t.Fatalf("Expected Last-Modified %s, got %s", hourAgo.Format(http.TimeFormat), modified)
+	}
+	if w := srv.do("GET", albumPath, "", "If-Modified-Since", modified); w.Code != 304 || w.Body.Len() != 0 {
+		t.Errorf("Expected empty 304, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+	collection := srv.do("GET", "/albums", "").Header().Get("Last-Modified")
+	if w := srv.do("GET", "/albums", "", "If-Modified-Since", collection); w.Code != 304 {
+		t.Errorf("Expected 304 for the collection, got %d", w.Code)
+	}
+
+	srv.do("PATCH", albumPath, `{"price": 12.99}`, "If-Match", "*")
+
+	if w := srv.do("GET", albumPath, "", "If-Modified-Since", modified); w.Code != 200 {
+		t.Errorf("Expected 200 after an update, got %d", w.Code)
+	}
+	if w := srv.do("GET", "/albums", "", "If-Modified-Since", collection); w.Code != 200 {
+		t.Errorf("Expected 200 for the collection after an update, got %d", w.Code)
+	}
+
+	// A deletion changes the collection even though no remaining album changed.
+	srv.store = newMemoryStore(seed)
+	srv.do("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440001", "", "If-Match", "*")
+	if w := srv.do("GET", "/albums", "", "If-Modified-Since", collection); w.Code != 200 {
+		t.Errorf("Expected 200 for the collection after a deletion, got %d", w.Code)
+	}
+
+	if w := srv.do("GET", albumPath, "", "If-Modified-Since", "not a date"); w.Code != 200 {
+		t.Errorf("Expected 200 for an invalid If-Modified-Since, got %d", w.Code)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// errCollectionFull is returned by a limitedStore when creating an album would exceed MAX_ALBUMS.
+	errCollectionFull = errors.New("the album collection is full")
+	// errTenantQuotaExceeded is returned by a limitedStore when creating an album would exceed
+	// MAX_ALBUMS_PER_TENANT for the tenant's store.
+	errTenantQuotaExceeded = errors.New("the tenant's album quota is exhausted")
+)
+
+// defaultTenantName labels the default store, shared by tenants without dedicated storage, in
+// capacity reports.
+const defaultTenantName = "(default)"
+
+// limitedStore is an AlbumStore that refuses to create albums beyond a maximum count, in total and
+// per backend store. Tenants with dedicated storage (see tenantRouter) each count against their
+// own store's limit; every other tenant shares the default store and its count.
+//
+// The limits are soft: counts are read from the stores on first use and then kept up to date from
+// the creates and deletes made through this server, so albums written by other servers sharing a
+// database are only noticed after a restart.
+type limitedStore struct {
+	AlbumStore
+	maxAlbums, maxPerTenant int
+
+	mu     sync.Mutex
+	loaded bool
+	// counts holds the number of albums in each backend store.
+	counts map[AlbumStore]int
+}
+
+// capacityUsage is one row of the /metrics/capacity report. MaxAlbums and Utilization are omitted
+// when the row has no limit.
+type capacityUsage struct {
+	Tenant      string   `json:"tenant,omitempty"`
+	Albums      int      `json:"albums"`
+	MaxAlbums   int      `json:"max_albums,omitempty"`
+	Utilization *float64 `json:"utilization,omitempty"`
+}
+
+// newLimitedStore wraps s with the album limits in cfg.
+// Returns nil if neither MAX_ALBUMS nor MAX_ALBUMS_PER_TENANT is set, which disables the limits.
+func newLimitedStore(s AlbumStore, cfg Config) *limitedStore {
+	if cfg.MaxAlbums <= 0 && cfg.MaxAlbumsPerTenant <= 0 {
+		return nil
+	}
+	return &limitedStore{AlbumStore: s, maxAlbums: cfg.MaxAlbums, maxPerTenant: cfg.MaxAlbumsPerTenant}
+}
+
+// backends returns every backend store behind l, keyed by the tenant it serves.
+func (l *limitedStore) backends() map[string]AlbumStore {
+	r, ok := l.AlbumStore.(*tenantRouter)
+	if !ok {
+		return map[string]AlbumStore{defaultTenantName: l.AlbumStore}
+	}
+	backends := map[string]AlbumStore{defaultTenantName: r.fallback}
+	for name, s := range r.tenants {
+		backends[name] = s
+	}
+	return backends
+}
+
+// backendFor returns the backend store serving the tenant in ctx.
+func (l *limitedStore) backendFor(ctx context.Context) AlbumStore {
+	if r, ok := l.AlbumStore.(*tenantRouter); ok {
+		return r.storeFor(ctx)
+	}
+	return l.AlbumStore
+}
+
+// load counts the albums in every backend store if that has not been done yet.
+// The caller must hold l.mu.
+func (l *limitedStore) load(ctx context.Context) error {
+	if l.loaded {
+		return nil
+	}
+	counts := make(map[AlbumStore]int)
+	for _, s := range l.backends() {
+		all, err := s.List(ctx)
+		if err != nil {
+			return err
+		}
+		counts[s] = len(all)
+	}
+	l.counts, l.loaded = counts, true
+	return nil
+}
+
+// admit returns errCollectionFull or errTenantQuotaExceeded if one more album in backend would
+// exceed a limit. Otherwise, if reserve is set, the album is counted before it is created.
+func (l *limitedStore) admit(ctx context.Context, backend AlbumStore, reserve bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(ctx); err != nil {
+		return err
+	}
+	total := 0
+	for _, n := range l.counts {
+		total += n
+	}
+	if l.maxAlbums > 0 && total >= l.maxAlbums {
+		return errCollectionFull
+	}
+	if l.maxPerTenant > 0 && l.counts[backend] >= l.maxPerTenant {
+		return errTenantQuotaExceeded
+	}
+	if reserve {
+		l.counts[backend]++
+	}
+	return nil
+}
+
+// release uncounts an album that was deleted from backend, or reserved but never created.
+func (l *limitedStore) release(backend AlbumStore) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[backend] > 0 {
+		l.counts[backend]--
+	}
+}
+
+// check returns the error creating an album for the tenant in ctx would fail with because of a
+// limit, or nil. Dry runs use it to predict the outcome of a create.
+func (l *limitedStore) check(ctx context.Context) error {
+	return l.admit(ctx, l.backendFor(ctx), false)
+}
+
+// Create stores a new album unless that would exceed a limit.
+// Returns errCollectionFull or errTenantQuotaExceeded if it would.
+func (l *limitedStore) Create(ctx context.Context, a Album) (Album, error) {
+	backend := l.backendFor(ctx)
+	if err := l.admit(ctx, backend, true); err != nil {
+		return Album{}, err
+	}
+	created, err := l.AlbumStore.Create(ctx, a)
+	if err != nil {
+		l.release(backend)
+	}
+	return created, err
+}
+
+// CreateUnique creates an album like Create unless one with the same title and artist exists,
+// atomically if the store supports that.
+func (l *limitedStore) CreateUnique(ctx context.Context, a Album) (Album, error) {
+	backend := l.backendFor(ctx)
+	if err := l.admit(ctx, backend, true); err != nil {
+		return Album{}, err
+	}
+	created, err := createUnique(ctx, l.AlbumStore, a)
+	if err != nil {
+		l.release(backend)
+	}
+	return created, err
+}
+
+// UpdateUnique updates an album unless it would get the title and artist of another album,
+// atomically if the store supports that.
+func (l *limitedStore) UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return updateUnique(ctx, l.AlbumStore, id, mutate)
+}
+
+// Delete removes the album with the given ID, freeing its place.
+func (l *limitedStore) Delete(ctx context.Context, id string) (Album, error) {
+	a, err := l.AlbumStore.Delete(ctx, id)
+	if err == nil {
+		l.release(l.backendFor(ctx))
+	}
+	return a, err
+}
+
+// UpdateWhere changes the albums selected by f, atomically if the store supports that.
+func (l *limitedStore) UpdateWhere(ctx context.Context, f albumFilter, mutate func(*Album) bool) ([]Album, error) {
+	return updateWhere(ctx, l.AlbumStore, f, mutate)
+}
+
+// DeleteWhere removes the albums selected by f, atomically if the store supports that, freeing
+// their places.
+func (l *limitedStore) DeleteWhere(ctx context.Context, f albumFilter) ([]Album, error) {
+	deleted, err := deleteWhere(ctx, l.AlbumStore, f)
+	backend := l.backendFor(ctx)
+	for range deleted {
+		l.release(backend)
+	}
+	return deleted, err
+}
+
+// Each calls fn with every album, streaming them from the store if it supports that.
+func (l *limitedStore) Each(ctx context.Context, fn func(Album) error) error {
+	return eachAlbum(ctx, l.AlbumStore, fn)
+}
+
+// Stats returns the statistics of every album, computed by the store if it supports that.
+func (l *limitedStore) Stats(ctx context.Context) (albumStats, error) {
+	return catalogStats(ctx, l.AlbumStore)
+}
+
+// Query returns the albums selected by f, filtering in the store if it supports that.
+func (l *limitedStore) Query(ctx context.Context, f albumFilter) ([]Album, error) {
+	return listAlbums(ctx, l.AlbumStore, f)
+}
+
+// GetByUPC returns the album with the given barcode, using the store's index if it has one.
+func (l *limitedStore) GetByUPC(ctx context.Context, code string) (Album, error) {
+	return findAlbumByUPC(ctx, l.AlbumStore, code)
+}
+
+// usage returns the album count of the whole collection and of each backend store, sorted by
+// tenant, with their utilization of the limits.
+func (l *limitedStore) usage(ctx context.Context) (capacityUsage, []capacityUsage, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(ctx); err != nil {
+		return capacityUsage{}, nil, err
+	}
+	total := capacityUsage{MaxAlbums: l.maxAlbums}
+	tenants := []capacityUsage{}
+	for name, s := range l.backends() {
+		row := capacityUsage{Tenant: name, Albums: l.counts[s], MaxAlbums: l.maxPerTenant}
+		row.Utilization = utilization(row.Albums, row.MaxAlbums)
+		tenants = append(tenants, row)
+		total.Albums += row.Albums
+	}
+	total.Utilization = utilization(total.Albums, total.MaxAlbums)
+	slices.SortFunc(tenants, func(a, b capacityUsage) int { return cmp.Compare(a.Tenant, b.Tenant) })
+	return total, tenants, nil
+}
+
+// utilization returns albums as a fraction of limit, or nil if there is no limit.
+func utilization(albums, limit int) *float64 {
+	if limit <= 0 {
+		return nil
+	}
+	u := float64(albums) / float64(limit)
+	return &u
+}
+
+// getCapacityMetrics handles GET /metrics/capacity requests.
+// Returns the number of albums stored, MAX_ALBUMS, and their ratio as "utilization", and the same
+// for each tenant store against MAX_ALBUMS_PER_TENANT, as JSON with HTTP 200 status.
+// Returns HTTP 404 if no album limit is configured.
+func (srv *Server) getCapacityMetrics(c *gin.Context) {
+	if srv.limits == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album limits are not enabled"})
+		return
+	}
+	total, tenants, err := srv.limits.usage(c.Request.Context())
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"albums":      total.Albums,
+		"max_albums":  total.MaxAlbums,
+		"utilization": total.Utilization,
+		"tenants":     tenants,
+	})
+}
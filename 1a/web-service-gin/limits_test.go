@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// TestAlbumLimits tests MAX_ALBUMS and MAX_ALBUMS_PER_TENANT.
+// Verifies that a tenant store at its limit gets HTTP 429 while other tenants can still create
+// albums, that a full collection gets HTTP 507 (also on dry runs), that deleting an album frees its
+// place, and that /metrics/capacity reports the utilization.
+func TestAlbumLimits(t *testing.T) {
+	r := &tenantRouter{
+		fallback: newMemoryStore(seedAlbums()),
+		tenants:  map[string]AlbumStore{"big": newMemoryStore(nil)},
+	}
+	srv := newTestServerWith(t, r, func(cfg *Config) {
+		cfg.MaxAlbums = 5
+		cfg.MaxAlbumsPerTenant = 3
+	})
+	body := `{"title": "Giant Steps", "artist": "John Coltrane", "price": 24.99}`
+
+	if w := srv.do("POST", "/albums", body); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for the full default store, got %d: %s", w.Code, w.Body)
+	}
+	for i := range 2 {
+		if w := srv.do("POST", "/albums?allow_duplicate=true", body, tenantHeader, "big"); w.Code != http.StatusCreated {
+			t.Fatalf("Create %d: expected 201, got %d: %s", i, w.Code, w.Body)
+		}
+	}
+	if w := srv.do("POST", "/albums?dry_run=true", body, tenantHeader, "big"); w.Code != http.StatusInsufficientStorage {
+		t.Errorf("Expected 507 for a dry run on the full collection, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("POST", "/albums", body, tenantHeader, "big"); w.Code != http.StatusInsufficientStorage {
+		t.Errorf("Expected 507 for the full collection, got %d: %s", w.Code, w.Body)
+	}
+
+	var metrics struct {
+		Albums      int             `json:"albums"`
+		Utilization float64         `json:"utilization"`
+		Tenants     []capacityUsage `json:"tenants"`
+	}
+	json.Unmarshal(srv.do("GET", "/metrics/capacity", body).Body.Bytes(), &metrics)
+	if metrics.Albums != 5 || metrics.Utilization != 1 || len(metrics.Tenants) != 2 ||
+		metrics.Tenants[0].Tenant != defaultTenantName || metrics.Tenants[1].Albums != 2 || *metrics.Tenants[1].Utilization != 2.0/3 {
+		t.Errorf("Unexpected capacity metrics: %+v", metrics)
+	}
+
+	if w := srv.do("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440001", body, "If-Match", "*"); w.Code != http.StatusOK {
+		t.Fatalf("Expected the delete to succeed, got %d", w.Code)
+	}
+	if w := srv.do("POST", "/albums?allow_duplicate=true", body, tenantHeader, "big"); w.Code != http.StatusInsufficientStorage {
+		t.Errorf("Expected a deleted album to keep its place until purged, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440001?permanent=true", body, "If-Match", "*"); w.Code != http.StatusOK {
+		t.Fatalf("Expected the purge to succeed, got %d", w.Code)
+	}
+	if w := srv.do("POST", "/albums?allow_duplicate=true", body, tenantHeader, "big"); w.Code != http.StatusCreated {
+		t.Errorf("Expected 201 after a purge, got %d: %s", w.Code, w.Body)
+	}
+}
+
+// TestCapacityMetricsDisabled tests that /metrics/capacity returns 404 without album limits.
+func TestCapacityMetricsDisabled(t *testing.T) {
+	srv := newTestServer(t)
+	w := srv.do("GET", "/metrics/capacity", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
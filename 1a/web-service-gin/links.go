@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// publicBaseURLKey is the gin context key holding PUBLIC_BASE_URL, when set.
+type publicBaseURLKey struct{}
+
+// link is one hypermedia link of a _links section: its URL and, for links that change data, the
+// method to use.
+type link struct {
+	Href   string `json:"href"`
+	Method string `json:"method,omitempty"`
+}
+
+// albumLinks is the _links section of an album: the album itself, its collection, and how to
+// update and delete it.
+type albumLinks struct {
+	Self       link `json:"self"`
+	Collection link `json:"collection"`
+	Update     link `json:"update"`
+	Delete     link `json:"delete"`
+}
+
+// linkedAlbum is an album as sent to clients, with its _links section.
+type linkedAlbum struct {
+	Album
+	Links albumLinks `json:"_links"`
+}
+
+// baseURLMiddleware makes links in responses use baseURL instead of the scheme and host of the request.
+func baseURLMiddleware(baseURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(publicBaseURLKey{}, baseURL)
+		c.Next()
+	}
+}
+
+// linkBase returns the URL links in the response to c start with: PUBLIC_BASE_URL or the request's
+// scheme and host, followed by the API version prefix of the request.
+func linkBase(c *gin.Context) string {
+	value, _ := c.Get(publicBaseURLKey{})
+	base, _ := value.(string)
+	if base == "" {
+		base = requestBaseURL(c)
+	}
+	return base + requestAPIPrefix(c)
+}
+
+// linksFor returns the _links section of the album with the given ID.
+func linksFor(c *gin.Context, id string) albumLinks {
+	collection := linkBase(c) + "/albums"
+	self := collection + "/" + id
+	return albumLinks{
+		Self:       link{Href: self},
+		Collection: link{Href: collection},
+		Update:     link{Href: self, Method: "PATCH"},
+		Delete:     link{Href: self, Method: "DELETE"},
+	}
+}
+
+// collectionLinks returns the _links section of a collection response: the request itself and,
+// if there is a next page, the request for it.
+func collectionLinks(c *gin.Context, next string) gin.H {
+	self := linkBase(c) + unversionedPath(c.Request.URL.RequestURI())
+	links := gin.H{"self": link{Href: self}}
+	if next != "" {
+		u := *c.Request.URL
+		query := u.Query()
+		query.Set("page_token", next)
+		u.RawQuery = query.Encode()
+		links["next"] = link{Href: linkBase(c) + unversionedPath(u.RequestURI())}
+	}
+	return links
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestAlbumLinks tests the _links sections of album and collection responses.
+// Verifies that links use the request's host and version prefix, that collection pages link to
+// the next page, and that PUBLIC_BASE_URL replaces the request's scheme and host.
+func TestAlbumLinks(t *testing.T) {
+	srv := newTestServer(t)
+
+	var album struct {
+		Links albumLinks `json:"_links"`
+	}
+	json.Unmarshal(srv.do("GET", "/v1/albums/550e8400-e29b-41d4-a716-446655440002", "", "Host", "albums.example:8080").Body.Bytes(), &album)
+	self := "http://albums.example:8080/v1/albums/550e8400-e29b-41d4-a716-446655440002"
+	want := albumLinks{
+		Self:       link{Href: self},
+		Collection: link{Href: "http://albums.example:8080/v1/albums"},
+		Update:     link{Href: self, Method: "PATCH"},
+		Delete:     link{Href: self, Method: "DELETE"},
+	}
+	if album.Links != want {
+		t.Errorf("Expected links %+v, got %+v", want, album.Links)
+	}
+
+	var page struct {
+		Albums []struct {
+			ID    string     `json:"id"`
+			Links albumLinks `json:"_links"`
+		} `json:"albums"`
+		Links map[string]link `json:"_links"`
+	}
+	json.Unmarshal(srv.do("GET", "/albums?page_size=2", "", "Host", "albums.example:8080").Body.Bytes(), &page)
+	if len(page.Albums) != 2 || page.Albums[1].Links.Self.Href != "http://albums.example:8080/albums/"+page.Albums[1].ID {
+		t.Errorf("Expected every album of the page to link to itself, got %+v", page.Albums)
+	}
+	if page.Links["self"].Href != "http://albums.example:8080/albums?page_size=2" || page.Links["next"].Href == "" {
+		t.Errorf("Expected self and next links for the page, got %+v", page.Links)
+	}
+
+	srv = newTestServer(t, func(cfg *Config) { cfg.PublicBaseURL = "https://api.example" })
+	json.Unmarshal(srv.do("GET", "/v1/albums/550e8400-e29b-41d4-a716-446655440002", "", "Host", "albums.example:8080").Body.Bytes(), &album)
+	if album.Links.Self.Href != "https://api.example/v1/albums/550e8400-e29b-41d4-a716-446655440002" {
+		t.Errorf("Expected links to use PUBLIC_BASE_URL, got %+v", album.Links)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// lockTokenHeader names the header carrying the token of the edit lock a request holds.
+const lockTokenHeader = "X-Lock-Token"
+
+// albumLock is an edit lock on one album, held by Owner until ExpiresAt unless renewed. Token is
+// only shown to the client that acquired the lock; anyone holding it may edit the album, renew the
+// lock, or release it.
+type albumLock struct {
+	AlbumID    string    `json:"album_id"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Owner      string    `json:"owner"`
+	Token      string    `json:"token,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// public returns l without its token, as shown to clients other than its holder.
+func (l albumLock) public() albumLock {
+	l.Token = ""
+	return l
+}
+
+// lockTable holds the edit locks on albums, keyed by tenant and album ID. Expired locks are
+// ignored and removed when next looked at, so no background sweep is needed.
+type lockTable struct {
+	now func() time.Time
+
+	mu    sync.Mutex
+	locks map[string]albumLock
+}
+
+// newLockTable creates a table with no locks.
+func newLockTable() *lockTable {
+	return &lockTable{now: time.Now, locks: map[string]albumLock{}}
+}
+
+// lockKey returns the key of the lock on album id for tenant.
+func lockKey(tenant, id string) string {
+	return tenant + "\x00" + id
+}
+
+// current returns the unexpired lock at key and true, or false, removing the lock if it expired.
+// The caller must hold t.mu.
+func (t *lockTable) current(key string, now time.Time) (albumLock, bool) {
+	l, ok := t.locks[key]
+	if ok && !now.Before(l.ExpiresAt) {
+		delete(t.locks, key)
+		return albumLock{}, false
+	}
+	return l, ok
+}
+
+// holds reports whether token is the token of l.
+func (l albumLock) holds(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(l.Token)) == 1
+}
+
+// acquire locks album id for tenant on behalf of owner for ttl, and returns the lock and true.
+// If the album is already locked, token renews the lock if it is the lock's token; otherwise the
+// lock is left alone and returned, without its token, with false.
+func (t *lockTable) acquire(tenant, id, owner, token string, ttl time.Duration) (albumLock, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now().UTC()
+	key := lockKey(tenant, id)
+	l, ok := t.current(key, now)
+	switch {
+	case ok && !l.holds(token):
+		return l.public(), false
+	case !ok:
+		l = albumLock{AlbumID: id, Tenant: tenant, Owner: owner, Token: uuid.New().String(), AcquiredAt: now}
+	}
+	l.ExpiresAt = now.Add(ttl)
+	t.locks[key] = l
+	return l, true
+}
+
+// get returns the unexpired lock on album id for tenant, without its token, and true, or false if
+// the album is not locked.
+func (t *lockTable) get(tenant, id string) (albumLock, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.current(lockKey(tenant, id), t.now())
+	return l.public(), ok
+}
+
+// check reports whether token may edit album id for tenant: true if the album is not locked or
+// token is its lock's token. Otherwise it returns the lock, without its token, and false.
+func (t *lockTable) check(tenant, id, token string) (albumLock, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.current(lockKey(tenant, id), t.now())
+	if !ok || l.holds(token) {
+		return albumLock{}, true
+	}
+	return l.public(), false
+}
+
+// release unlocks album id for tenant if token is its lock's token, or regardless if force is
+// set. It returns the lock and true if it was released, or the lock, without its token, and false
+// if token does not hold it; the lock is zero if the album was not locked.
+func (t *lockTable) release(tenant, id, token string, force bool) (albumLock, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := lockKey(tenant, id)
+	l, ok := t.current(key, t.now())
+	if !ok {
+		return albumLock{}, false
+	}
+	if !force && !l.holds(token) {
+		return l.public(), false
+	}
+	delete(t.locks, key)
+	return l, true
+}
+
+// list returns the unexpired locks, without their tokens, soonest to expire first.
+func (t *lockTable) list() []albumLock {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	locks := make([]albumLock, 0, len(t.locks))
+	for key := range t.locks {
+		if l, ok := t.current(key, now); ok {
+			locks = append(locks, l.public())
+		}
+	}
+	slices.SortFunc(locks, func(x, y albumLock) int { return x.ExpiresAt.Compare(y.ExpiresAt) })
+	return locks
+}
+
+// lockTTL returns the lock lifetime requested by ttl, LOCK_TTL if it is empty, or an error message
+// if it is not a positive duration of at most LOCK_MAX_TTL.
+func (srv *Server) lockTTL(ttl string) (time.Duration, string) {
+	if ttl == "" {
+		return srv.cfg.LockTTL, ""
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d <= 0 || d > srv.cfg.LockMaxTTL {
+		return 0, "ttl must be a positive duration of at most " + srv.cfg.LockMaxTTL.String() + ", e.g. 5m"
+	}
+	return d, ""
+}
+
+// respondLocked writes HTTP 423 with the lock preventing the request.
+func respondLocked(c *gin.Context, l albumLock) {
+	c.AbortWithStatusJSON(http.StatusLocked, gin.H{"error": "album is locked by " + l.Owner + " until " + l.ExpiresAt.Format(time.RFC3339), "lock": l})
+}
+
+// lockGuard is middleware for the routes that edit an album. It rejects the request with HTTP 423
+// if the album is locked and the request does not carry the lock's token in X-Lock-Token.
+func (srv *Server) lockGuard(c *gin.Context) {
+	if l, ok := srv.locks.check(tenantFrom(c.Request.Context()), c.Param("id"), c.GetHeader(lockTokenHeader)); !ok {
+		respondLocked(c, l)
+		return
+	}
+	c.Next()
+}
+
+// postAlbumLock handles POST /albums/:id/lock requests.
+// Locks the album for editing on behalf of the owner named in the optional JSON body, or else the
+// request's X-Actor, for the ttl in the body or ?ttl= (default LOCK_TTL, at most LOCK_MAX_TTL). While it is locked, edits
+// must carry the lock's token in X-Lock-Token. Sending the token again renews the lock. Returns
+// the lock with its token as JSON with HTTP 201 status, or HTTP 200 when renewing.
+// Returns HTTP 400 if the body or ttl is invalid, HTTP 404 if the album is not found, or HTTP 409
+// with the lock, without its token, if someone else holds it.
+func (srv *Server) postAlbumLock(c *gin.Context) {
+	var req struct {
+		Owner string `json:"owner"`
+		TTL   string `json:"ttl"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.TTL == "" {
+		req.TTL = c.Query("ttl")
+	}
+	ttl, msg := srv.lockTTL(req.TTL)
+	if msg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	if _, err := srv.store.Get(ctx, id); err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	owner := strings.TrimSpace(req.Owner)
+	if owner == "" {
+		owner = identityFrom(ctx).Actor
+	}
+
+	token := c.GetHeader(lockTokenHeader)
+	l, ok := srv.locks.acquire(tenantFrom(ctx), id, owner, token, ttl)
+	switch {
+	case !ok:
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "album is already locked by " + l.Owner, "lock": l})
+	case l.holds(token):
+		c.IndentedJSON(http.StatusOK, l)
+	default:
+		c.IndentedJSON(http.StatusCreated, l)
+	}
+}
+
+// getAlbumLock handles GET /albums/:id/lock requests.
+// Returns the album's lock, without its token, as JSON with HTTP 200 status, or HTTP 404 if the
+// album is not locked.
+func (srv *Server) getAlbumLock(c *gin.Context) {
+	l, ok := srv.locks.get(tenantFrom(c.Request.Context()), c.Param("id"))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album not locked"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, l)
+}
+
+// deleteAlbumLock handles DELETE /albums/:id/lock requests.
+// Unlocks the album if the request carries the lock's token in X-Lock-Token or, for requests
+// authenticated with an API key, if ?force=true is given. Returns HTTP 204 once unlocked.
+// Returns HTTP 400 if force is invalid, HTTP 403 if force is set without an API key, HTTP 404 if
+// the album is not locked, or HTTP 423 with the lock if the request does not hold it.
+func (srv *Server) deleteAlbumLock(c *gin.Context) {
+	force, err := strconv.ParseBool(c.DefaultQuery("force", "false"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "force must be true or false"})
+		return
+	}
+	ctx := c.Request.Context()
+	if force && !identityFrom(ctx).Authenticated {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "force unlocking requires an API key"})
+		return
+	}
+	l, ok := srv.locks.release(tenantFrom(ctx), c.Param("id"), c.GetHeader(lockTokenHeader), force)
+	switch {
+	case ok:
+		c.Status(http.StatusNoContent)
+	case l.AlbumID == "":
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album not locked"})
+	default:
+		respondLocked(c, l)
+	}
+}
+
+// getLocks handles GET /admin/locks requests.
+// Returns the albums' edit locks, without their tokens, soonest to expire first, as JSON with
+// HTTP 200 status.
+func (srv *Server) getLocks(c *gin.Context) {
+	locks := srv.locks.list()
+	c.IndentedJSON(http.StatusOK, gin.H{"count": len(locks), "locks": locks})
+}
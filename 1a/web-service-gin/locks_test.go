@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAlbumLocks tests locking albums for editing.
+// Verifies that a locked album can only be edited with the lock's token, that others cannot take
+// or release the lock, that the holder can renew and release it, that only requests with an API
+// key can force it open, and that it expires after its TTL.
+func TestAlbumLocks(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.APIKeys = []string{"secret"} })
+	now := time.Now()
+	srv.locks.now = func() time.Time { return now }
+	const album = "/albums/550e8400-e29b-41d4-a716-446655440001"
+
+	var lock albumLock
+	w := srv.do("POST", album+"/lock", `{"owner": "alice", "ttl": "10m"}`)
+	json.Unmarshal(w.Body.Bytes(), &lock)
+	if w.Code != 201 || lock.Token == "" || lock.Owner != "alice" || !lock.ExpiresAt.Equal(now.Add(10*time.Minute)) {
+		t.Fatalf("Expected a 10 minute lock for alice, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("POST", album+"/lock", "", actorHeader, "bob"); w.Code != 409 || strings.Contains(w.Body.String(), lock.Token) {
+		t.Errorf("Expected 409 without the token locking a locked album, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("PATCH", album, `{"price": 1}`, "If-Match", "*"); w.Code != 423 || !strings.Contains(w.Body.String(), "alice") {
+		t.Errorf("Expected 423 editing a locked album without the token, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("PATCH", album, `{"price": 1}`, lockTokenHeader, lock.Token, "If-Match", "*"); w.Code != 200 {
+		t.Errorf("Expected 200 editing with the token, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440002", `{"price": 1}`, "If-Match", "*"); w.Code != 200 {
+		t.Errorf("Expected other albums to stay editable, got %d", w.Code)
+	}
+
+	now = now.Add(5 * time.Minute)
+	var renewed albumLock
+	w = srv.do("POST", album+"/lock?ttl=20m", "", lockTokenHeader, lock.Token)
+	json.Unmarshal(w.Body.Bytes(), &renewed)
+	if w.Code != 200 || renewed.Token != lock.Token || !renewed.ExpiresAt.Equal(now.Add(20*time.Minute)) {
+		t.Errorf("Expected the holder to renew the lock, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("DELETE", album+"/lock", ""); w.Code != 423 {
+		t.Errorf("Expected 423 releasing the lock without its token, got %d", w.Code)
+	}
+	if w := srv.do("DELETE", album+"/lock?force=true", ""); w.Code != 403 {
+		t.Errorf("Expected 403 forcing the lock open without an API key, got %d", w.Code)
+	}
+	var locks struct{ Count int }
+	json.Unmarshal(srv.do("GET", "/admin/locks", "").Body.Bytes(), &locks)
+	if locks.Count != 1 {
+		t.Errorf("Expected 1 lock listed, got %d", locks.Count)
+	}
+	if w := srv.do("DELETE", album+"/lock?force=true", "", "Authorization", "Bearer secret"); w.Code != 204 {
+		t.Errorf("Expected 204 forcing the lock open with an API key, got %d", w.Code)
+	}
+	if w := srv.do("GET", album+"/lock", ""); w.Code != 404 {
+		t.Errorf("Expected 404 for an unlocked album, got %d", w.Code)
+	}
+
+	json.Unmarshal(srv.do("POST", album+"/lock", "", actorHeader, "bob").Body.Bytes(), &lock)
+	if lock.Owner != "bob" {
+		t.Errorf("Expected the lock owned by the actor, got %+v", lock)
+	}
+	if w := srv.do("DELETE", album+"/lock", "", lockTokenHeader, lock.Token); w.Code != 204 {
+		t.Errorf("Expected the holder to release the lock, got %d", w.Code)
+	}
+	srv.do("POST", album+"/lock", "")
+	now = now.Add(srv.cfg.LockTTL)
+	if w := srv.do("DELETE", album, "", "If-Match", "*"); w.Code != 200 {
+		t.Errorf("Expected an expired lock not to block edits, got %d: %s", w.Code, w.Body)
+	}
+
+	for path, want := range map[string]int{
+		album + "/lock?ttl=2h":                              400,
+		album + "/lock?ttl=-1m":                             400,
+		"/albums/550e8400-e29b-41d4-a716-446655440099/lock": 404,
+	} {
+		if w := srv.do("POST", path, ""); w.Code != want {
+			t.Errorf("POST %s: expected %d, got %d", path, want, w.Code)
+		}
+	}
+}
@@ -1,40 +1,216 @@
 // Package main implements a RESTful API server for managing a collection of albums.
-// The server uses the Gin web framework and stores data in memory.
+// The server uses the Gin web framework and stores data through an AlbumStore, in memory by default.
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-
-	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 const (
 	serverPort = "localhost:8080"
+	// shutdownTimeout bounds how long in-flight requests may take to finish on shutdown.
+	shutdownTimeout = 10 * time.Second
 )
 
-// main initializes the Gin router, registers all API routes, and starts the HTTP server.
+// main opens the configured album store, creates the server, and starts the HTTP server.
 // The server listens on localhost:8080 and provides RESTful endpoints for album management.
+// The --db-path flag stores albums in a local SQLite file, and --read-only rejects writes. Snapshots and
+// write-ahead logs in the legacy format are upgraded in place first; --migrate-dry-run only reports
+// what would change and exits. On SIGINT or SIGTERM the server stops
+// accepting connections, finishes in-flight requests, and saves a final snapshot if snapshots are enabled.
+// With MEMORY_WATCHDOG_LIMIT set, the memory store evicts cold albums to disk when the heap grows past it,
+// and with CACHE_WRITE_POLICY=write-back, cached updates are flushed to the store periodically and on shutdown.
+// With BACKUP_DIR set, backups are taken on a schedule and once more on shutdown. With SNAPSHOT_URL set,
+// GET /readyz answers HTTP 503 until the memory store has been loaded from the remote snapshot; the
+// warm-up server answering until then shares the port with the server, which takes it over.
 func main() {
-	router := gin.Default()
-
-	router.GET("/albums", getAlbums)
-	router.POST("/albums", postAlbums)
-	router.GET("/albums/:id", getAlbumByID)
-	router.DELETE("/albums/:id", deleteAlbumByID)
-	router.PATCH("/albums/:id", patchAlbumByID)
-	router.GET("/", healthCheck)
+	cfg := loadConfig()
+	flag.StringVar(&cfg.SQLitePath, "db-path", cfg.SQLitePath, "SQLite database file; selects the sqlite backend unless STORAGE is set")
+	flag.BoolVar(&cfg.ReadOnly, "read-only", cfg.ReadOnly, "reject writes, pointing clients to PRIMARY_URL")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "report how SNAPSHOT_PATH and WAL_PATH would be upgraded from the legacy format, then exit")
+	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "db-path" && os.Getenv("STORAGE") == "" {
+			cfg.Storage = "sqlite"
+		}
+	})
+	reports, err := migrateLegacyData(cfg, *migrateDryRun || cfg.ReadOnly)
+	if err != nil {
+		log.Fatalf("Failed to migrate legacy data: %v", err)
+	}
+	if *migrateDryRun {
+		data, _ := json.MarshalIndent(reports, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	for _, r := range reports {
+		if r.Applied {
+			log.Printf("Migrated %s %s from version %d to %d (%d of %d albums stamped with %s)",
+				r.Kind, r.Path, r.FromVersion, r.ToVersion, r.Stamped, r.Albums, r.StampedAt.Format(time.RFC3339))
+		}
+	}
+	listener, err := net.Listen("tcp", serverPort)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", serverPort, err)
+	}
+	port := newPortListener(listener)
+	// Orchestrators see the instance alive but not ready while the remote snapshot downloads.
+	var stopWarmup func()
+	if cfg.SnapshotURL != "" {
+		stopWarmup = serveWarmingUp(port.share())
+	}
+	store, err := newAlbumStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open album store: %v", err)
+	}
+	if cfg.TenantStorageConfig != "" {
+		tenants, err := loadTenantStorageConfig(cfg.TenantStorageConfig)
+		if err != nil {
+			log.Fatalf("Failed to load tenant storage config: %v", err)
+		}
+		if store, err = newTenantRouter(store, tenants, cfg); err != nil {
+			log.Fatalf("Failed to open tenant album stores: %v", err)
+		}
+	}
+	srv, err := newServer(store, cfg)
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var snapshots *memoryStore
+	if s, ok := store.(*memoryStore); ok && cfg.SnapshotPath != "" {
+		snapshots = s
+		go runSnapshots(ctx, snapshots, cfg.SnapshotPath, cfg.SnapshotInterval)
+	}
+	if s, ok := store.(*memoryStore); ok && cfg.MemoryWatchdogLimit > 0 {
+		if err := s.enableSpill(cfg.SpillPath); err != nil {
+			log.Fatalf("Failed to open spill file: %v", err)
+		}
+		go runMemoryWatchdog(ctx, s, uint64(cfg.MemoryWatchdogLimit), cfg.MemoryWatchdogInterval)
+	}
+	if srv.cache != nil && srv.cache.policy == writeBack {
+		go runCacheFlush(ctx, srv.cache, cfg.CacheFlushInterval)
+	}
+	if srv.backups != nil {
+		go srv.backups.run(ctx)
+	}
 
 	log.Println("Starting Album API server...")
 	log.Printf("Server listening on http://%s", serverPort)
-	log.Println("Available endpoints:")
+	if cfg.ReadOnly {
+		log.Printf("Read-only mode: writes are rejected and sent to %q", cfg.PrimaryURL)
+	}
+	log.Println("Available endpoints (album API also under /v1; unprefixed paths are deprecated):")
 	log.Println("  GET    /albums      - List all albums")
 	log.Println("  GET    /albums/:id  - Get album by ID")
+	log.Println("  GET    /albums/upc/:code - Get album by UPC/EAN")
+	log.Println("  GET    /albums/feed.atom - Atom feed of recently added albums")
+	log.Println("  GET    /albums/export?format=csv|ndjson - Download every album")
+	log.Println("  GET    /albums/compare?ids=a,b - Field-by-field diff of two albums")
+	log.Println("  GET    /albums/search?q=... - Search titles and artists")
+	log.Println("  GET    /albums/stats        - Album count, price range, and counts by artist")
+	log.Println("  GET    /albums/changes      - Stream album changes as server-sent events (diffs, or ?full=true)")
+	log.Println("  GET    /albums/changes/poll?since=n - Wait for album changes (long polling)")
+	log.Println("  GET    /albums/schema       - Album fields with the versions they were added and deprecated in")
 	log.Println("  POST   /albums      - Create new album")
+	log.Println("  POST   /albums/batch - Create many albums at once")
+	log.Println("  POST   /albums/import?format=m3u|xspf - Create albums from a playlist, or a multipart CSV/JSON file")
 	log.Println("  DELETE /albums/:id  - Delete album by ID")
+	log.Println("  DELETE /albums?artist=...&confirm=true - Delete every matching album")
 	log.Println("  PATCH  /albums/:id  - Update album by ID")
+	log.Println("  PUT    /albums/:id  - Replace album by ID")
+	log.Println("  GET    /albums/:id/full         - Album with all related data")
+	log.Println("  GET    /albums/:id/history      - Album revision history")
+	log.Println("  GET    /albums/:id/history/:rev - Album as of a revision")
+	log.Println("  POST   /albums/:id/link/spotify - Link album to Spotify")
+	log.Println("  POST   /albums/:id/archive      - Hide album from listings (also /unarchive)")
+	log.Println("  POST   /albums/:id/restore      - Undo a delete (purge with DELETE ?permanent=true)")
+	log.Println("  POST   /albums/:id/tags         - Tag album (filter with GET /albums?tag=)")
+	log.Println("  GET    /albums/:id/tracks       - Album tracks (POST to add, DELETE /tracks/:number to remove)")
+	log.Println("  GET    /albums/:id/cover        - Album cover image (PUT multipart to upload)")
+	log.Println("  POST   /albums/:id/purchase     - Buy copies of an album from stock")
+	log.Println("  POST   /albums/:id/lock         - Lock an album for editing (GET to inspect, DELETE to release)")
+	log.Println("  GET    /artists                 - Artists (POST to create; GET/PUT/DELETE /artists/:id)")
+	log.Println("  GET    /artists/:id/albums      - Albums credited to an artist")
+	log.Println("  GET    /tags                    - Tags with album counts")
+	log.Println("  POST   /batch                   - Run several requests in one call")
+	log.Println("  GET    /jobs/:id                - Status of a request run with ?async=true")
+	log.Println("  GET    /jobs/:id/result         - Response of a finished job")
+	log.Println("  POST   /saved-searches          - Save a search and get notified of new matches")
+	log.Println("  GET    /saved-searches/:id/events - Stream new matches (SSE)")
+	log.Println("  POST   /admin/spotify/backfill  - Link all unlinked albums")
+	log.Println("  GET    /metrics/summary         - Request counters per endpoint")
+	log.Println("  GET    /metrics/outbound        - Outbound client metrics")
+	log.Println("  GET    /metrics/queueing        - Queue wait vs. service time")
+	log.Println("  GET    /metrics/capacity        - Album count against MAX_ALBUMS")
+	log.Println("  GET    /admin/journal           - Recent mutating requests")
+	log.Println("  POST   /admin/integrity         - Check data and index consistency")
+	log.Println("  GET    /admin/runtime           - Runtime and GC settings")
+	log.Println("  PUT    /admin/runtime           - Adjust GC target and memory limit")
+	log.Println("  GET    /debug/allocs            - Top allocating routes")
+	log.Println("  GET    /admin/notifications     - Notification delivery counts")
+	log.Println("  GET    /admin/wal               - Write-ahead log status")
+	log.Println("  GET    /admin/subscribers       - Clients connected to event streams")
+	log.Println("  GET    /admin/locks             - Album edit locks")
+	log.Println("  GET    /admin/pricing-rules     - Pricing rules")
+	log.Println("  PUT    /admin/pricing-rules     - Replace the pricing rules")
+	log.Println("  GET    /readyz      - Readiness check")
 	log.Println("  GET    /            - Health check")
 
-	if err := router.Run(serverPort); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{
+		Handler:     srv.router,
+		ConnState:   srv.queueing.connState,
+		ConnContext: srv.queueing.connContext,
+	}
+	go func() {
+		if err := server.Serve(port.share()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+	// The server is accepting connections on the port already, so none is refused as the warm-up
+	// server stops.
+	if stopWarmup != nil {
+		stopWarmup()
+	}
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
+	port.Close()
+	if srv.cache != nil {
+		if err := srv.cache.flush(context.Background()); err != nil {
+			log.Printf("Failed to flush album cache: %v", err)
+		}
+	}
+	if snapshots != nil {
+		if err := saveSnapshot(cfg.SnapshotPath, snapshots); err != nil {
+			log.Printf("Failed to save snapshot: %v", err)
+		} else {
+			log.Printf("Saved snapshot to %s", cfg.SnapshotPath)
+		}
+	}
+	if srv.backups != nil {
+		if path, err := srv.backups.backup(context.Background(), time.Now()); err != nil {
+			log.Printf("Failed to save backup: %v", err)
+		} else if path != "" {
+			log.Printf("Saved backup %s", path)
+		}
 	}
 }
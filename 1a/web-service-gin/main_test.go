@@ -1,45 +1,62 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 )
 
-// setupRouter creates a test router with all routes.
-func setupRouter() *gin.Engine {
+// newTestServer creates a server over a fresh memory store holding the seed albums.
+// Each configure function adjusts the default settings before the server is created.
+func newTestServer(t *testing.T, configure ...func(*Config)) *Server {
+	t.Helper()
+	return newTestServerWith(t, newMemoryStore(seedAlbums()), configure...)
+}
+
+// newTestServerWith creates a server over store with the default settings adjusted by configure.
+func newTestServerWith(t *testing.T, store AlbumStore, configure ...func(*Config)) *Server {
+	t.Helper()
 	gin.SetMode(gin.TestMode)
-	router := gin.Default()
-	router.GET("/albums", getAlbums)
-	router.POST("/albums", postAlbums)
-	router.GET("/albums/:id", getAlbumByID)
-	router.DELETE("/albums/:id", deleteAlbumByID)
-	router.PATCH("/albums/:id", patchAlbumByID)
-	router.GET("/", healthCheck)
-	return router
+	cfg := loadConfig()
+	for _, f := range configure {
+		f(&cfg)
+	}
+	srv, err := newServer(store, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
 }
 
-// resetAlbums resets albums to initial state for testing.
-func resetAlbums() {
-	albums = []Album{
-		{ID: "550e8400-e29b-41d4-a716-446655440001", Title: "Blue Train", Artist: "John Coltrane", Price: 56.99},
-		{ID: "550e8400-e29b-41d4-a716-446655440002", Title: "Jeru", Artist: "Gerry Mulligan", Price: 17.99},
-		{ID: "550e8400-e29b-41d4-a716-446655440003", Title: "Sarah Vaughan and Clifford Brown", Artist: "Sarah Vaughan", Price: 39.99},
+// do sends a request to srv's router and returns the response. The body is sent as JSON, and
+// header holds further header names and values in pairs, which may replace the Content-Type or,
+// with "Host", set the request's host.
+func (srv *Server) do(method, path, body string, header ...string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(header); i += 2 {
+		if header[i] == "Host" {
+			req.Host = header[i+1]
+			continue
+		}
+		req.Header.Set(header[i], header[i+1])
 	}
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	return w
 }
 
 // TestHealthCheck tests the health check endpoint.
 // Verifies that GET / returns HTTP 200 status.
 func TestHealthCheck(t *testing.T) {
-	router := setupRouter()
-	req, _ := http.NewRequest("GET", "/", nil)
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
-
+	srv := newTestServer(t)
+	w := srv.do("GET", "/", "")
 	if w.Code != 200 {
 		t.Errorf("Expected 200, got %d", w.Code)
 	}
@@ -48,12 +65,8 @@ func TestHealthCheck(t *testing.T) {
 // TestGetAlbums tests the GET /albums endpoint.
 // Verifies that it returns HTTP 200 and at least 3 albums.
 func TestGetAlbums(t *testing.T) {
-	resetAlbums()
-	router := setupRouter()
-	req, _ := http.NewRequest("GET", "/albums", nil)
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
-
+	srv := newTestServer(t)
+	w := srv.do("GET", "/albums", "")
 	if w.Code != 200 {
 		t.Errorf("Expected 200, got %d", w.Code)
 	}
@@ -69,26 +82,71 @@ func TestGetAlbums(t *testing.T) {
 	}
 }
 
+// TestGetAlbumsFiltered tests filtering GET /albums by artist and price range.
+// Verifies that the filters combine, and that malformed or inverted price bounds return HTTP 400.
+func TestGetAlbumsFiltered(t *testing.T) {
+	srv := newTestServer(t)
+	for _, tc := range []struct {
+		query string
+		want  int
+		count int
+	}{
+		{"artist=coltrane", 200, 1},
+		{"min_price=10&max_price=40", 200, 2},
+		{"artist=a&max_price=20", 200, 1},
+		{"min_price=60", 200, 0},
+		{"min_price=cheap", 400, 0},
+		{"max_price=-1", 400, 0},
+		{"min_price=50&max_price=10", 400, 0},
+	} {
+		w := srv.do("GET", "/albums?"+tc.query, "")
+
+		var albums []Album
+		json.Unmarshal(w.Body.Bytes(), &albums)
+		if w.Code != tc.want || len(albums) != tc.count {
+			t.Errorf("%s: expected %d with %d albums, got %d: %s", tc.query, tc.want, tc.count, w.Code, w.Body)
+		}
+	}
+}
+
+// TestGetAlbumsByIDs tests looking up several albums with GET /albums?ids=.
+// Verifies that albums come back in the requested order, repeated IDs once, that unknown IDs are
+// reported, and that an empty list returns HTTP 400.
+func TestGetAlbumsByIDs(t *testing.T) {
+	srv := newTestServer(t)
+	w := srv.do("GET", "/albums?ids=550e8400-e29b-41d4-a716-446655440003,missing,550e8400-e29b-41d4-a716-446655440001,550e8400-e29b-41d4-a716-446655440003", "")
+
+	var resp struct {
+		Albums   []Album  `json:"albums"`
+		NotFound []string `json:"not_found"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || len(resp.Albums) != 2 || resp.Albums[0].Title != "Sarah Vaughan and Clifford Brown" || resp.Albums[1].Title != "Blue Train" {
+		t.Errorf("Expected the two albums in request order, got %d: %s", w.Code, w.Body)
+	}
+	if len(resp.NotFound) != 1 || resp.NotFound[0] != "missing" {
+		t.Errorf("Expected [missing] not found, got %v", resp.NotFound)
+	}
+
+	w = srv.do("GET", "/albums?ids=,", "")
+	if w.Code != 400 {
+		t.Errorf("Expected 400 without IDs, got %d", w.Code)
+	}
+}
+
 // TestGetAlbumByID tests the GET /albums/:id endpoint.
 // Verifies successful retrieval returns HTTP 200, and non-existent ID returns HTTP 404.
 func TestGetAlbumByID(t *testing.T) {
-	resetAlbums()
-	router := setupRouter()
+	srv := newTestServer(t)
 
 	// Test existing album
-	req, _ := http.NewRequest("GET", "/albums/550e8400-e29b-41d4-a716-446655440001", nil)
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
-
+	w := srv.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440001", "")
 	if w.Code != 200 {
 		t.Errorf("Expected 200, got %d", w.Code)
 	}
 
 	// Test non-existent album
-	req, _ = http.NewRequest("GET", "/albums/not-found", nil)
-	w = httptest.NewRecorder()
-	router.ServeHTTP(w, req)
-
+	w = srv.do("GET", "/albums/not-found", "")
 	if w.Code != 404 {
 		t.Errorf("Expected 404, got %d", w.Code)
 	}
@@ -98,16 +156,11 @@ func TestGetAlbumByID(t *testing.T) {
 // Verifies that valid input creates an album with auto-generated ID (HTTP 201),
 // and invalid input returns HTTP 400.
 func TestPostAlbums(t *testing.T) {
-	resetAlbums()
-	router := setupRouter()
+	srv := newTestServer(t)
 
 	// Test valid album creation
 	body := `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}`
-	req, _ := http.NewRequest("POST", "/albums", bytes.NewBufferString(body))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
-
+	w := srv.do("POST", "/albums", body)
 	if w.Code != 201 {
 		t.Errorf("Expected 201, got %d", w.Code)
 	}
@@ -127,42 +180,128 @@ func TestPostAlbums(t *testing.T) {
 
 	// Test invalid input
 	invalidBody := `{"title": "A"}`
-	req, _ = http.NewRequest("POST", "/albums", bytes.NewBufferString(invalidBody))
-	req.Header.Set("Content-Type", "application/json")
-	w = httptest.NewRecorder()
-	router.ServeHTTP(w, req)
-
+	w = srv.do("POST", "/albums", invalidBody)
 	if w.Code != 400 {
 		t.Errorf("Expected 400 for invalid input, got %d", w.Code)
 	}
 }
 
+// TestPostAlbumsDuplicate tests that POST /albums rejects an album with the title and artist of an
+// existing one. Verifies the 409 with the existing album's ID, case-insensitive matching, dry runs,
+// the ?allow_duplicate=true escape hatch, and that only one of several concurrent creates succeeds.
+func TestPostAlbumsDuplicate(t *testing.T) {
+	srv := newTestServer(t)
+
+	body := `{"title": "blue train", "artist": "JOHN COLTRANE", "price": 9.99}`
+	for _, path := range []string{"/albums", "/albums?dry_run=true"} {
+		w := srv.do("POST", path, body)
+		var resp struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != 409 || resp.ID != "550e8400-e29b-41d4-a716-446655440001" {
+			t.Errorf("%s: expected 409 naming Blue Train, got %d: %s", path, w.Code, w.Body)
+		}
+	}
+	if w := srv.do("POST", "/albums?allow_duplicate=true", body); w.Code != 201 {
+		t.Errorf("Expected 201 with allow_duplicate, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("POST", "/albums?allow_duplicate=maybe", body); w.Code != 400 {
+		t.Errorf("Expected 400 for an invalid allow_duplicate, got %d", w.Code)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	counts := map[int]int{}
+	for range 10 {
+		wg.Go(func() {
+			code := srv.do("POST", "/albums", `{"title": "Giant Steps", "artist": "John Coltrane", "price": 24.99}`).Code
+			mu.Lock()
+			counts[code]++
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	if counts[201] != 1 || counts[409] != 9 {
+		t.Errorf("Expected one 201 and nine 409s, got %v", counts)
+	}
+}
+
+// TestUpdateAlbumsDuplicate tests that PATCH and PUT reject an update giving an album the title and
+// artist of another. Verifies the 409 with the other album's ID for PATCH, JSON Patch, PUT, and dry
+// runs, that updates keeping an album's title and artist are not checked, and that only one of
+// several concurrent updates to the same title and artist succeeds.
+func TestUpdateAlbumsDuplicate(t *testing.T) {
+	srv := newTestServer(t)
+
+	jeru := "/albums/550e8400-e29b-41d4-a716-446655440002"
+	for _, tc := range []struct {
+		method, path, contentType, body string
+	}{
+		{"PATCH", jeru, "application/json", `{"title": "BLUE TRAIN", "artist": "john coltrane"}`},
+		{"PATCH", jeru + "?dry_run=true", "application/json", `{"title": "Blue Train", "artist": "John Coltrane"}`},
+		{"PATCH", jeru, jsonPatchContentType, `[{"op": "replace", "path": "/title", "value": "Blue Train"}, {"op": "replace", "path": "/artist", "value": "John Coltrane"}]`},
+		{"PUT", jeru, "application/json", `{"title": "Blue Train", "artist": "John Coltrane", "price": 17.99}`},
+		{"PUT", jeru + "?dry_run=true", "application/json", `{"title": "Blue Train", "artist": "John Coltrane", "price": 17.99}`},
+	} {
+		w := srv.do(tc.method, tc.path, tc.body, "Content-Type", tc.contentType, "If-Match", "*")
+		var resp struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != 409 || resp.ID != "550e8400-e29b-41d4-a716-446655440001" {
+			t.Errorf("%s %s %s: expected 409 naming Blue Train, got %d: %s", tc.method, tc.path, tc.body, w.Code, w.Body)
+		}
+	}
+
+	// An album that already shares its title and artist can still be changed otherwise.
+	w := srv.do("POST", "/albums?allow_duplicate=true", `{"title": "Blue Train", "artist": "John Coltrane", "price": 9.99}`)
+	var copied Album
+	json.Unmarshal(w.Body.Bytes(), &copied)
+	if w := srv.do("PATCH", "/albums/"+copied.ID, `{"price": 12.99}`, "If-Match", "*"); w.Code != 200 {
+		t.Errorf("Expected 200 updating the price of a duplicate, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("PATCH", jeru, `{"title": "JERU"}`, "If-Match", "*"); w.Code != 200 {
+		t.Errorf("Expected 200 changing the case of the title, got %d: %s", w.Code, w.Body)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	counts := map[int]int{}
+	for _, id := range []string{"550e8400-e29b-41d4-a716-446655440002", "550e8400-e29b-41d4-a716-446655440003", copied.ID} {
+		wg.Go(func() {
+			code := srv.do("PATCH", "/albums/"+id, `{"title": "Giant Steps", "artist": "John Coltrane"}`, "If-Match", "*").Code
+			mu.Lock()
+			counts[code]++
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	if counts[200] != 1 || counts[409] != 2 {
+		t.Errorf("Expected one 200 and two 409s, got %v", counts)
+	}
+}
+
 // TestDeleteAlbumByID tests the DELETE /albums/:id endpoint.
 // Verifies that deletion returns HTTP 200 and reduces album count,
 // and non-existent ID returns HTTP 404.
 func TestDeleteAlbumByID(t *testing.T) {
-	resetAlbums()
-	router := setupRouter()
-
-	initialCount := len(albums)
+	srv := newTestServer(t)
 
-	req, _ := http.NewRequest("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440001", nil)
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+	initial, _ := srv.store.List(context.Background())
 
+	w := srv.do("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440001", "", "If-Match", "*")
 	if w.Code != 200 {
 		t.Errorf("Expected 200, got %d", w.Code)
 	}
 
-	if len(albums) != initialCount-1 {
-		t.Errorf("Expected %d albums, got %d", initialCount-1, len(albums))
+	remaining, _ := srv.store.List(context.Background())
+	if len(remaining) != len(initial)-1 {
+		t.Errorf("Expected %d albums, got %d", len(initial)-1, len(remaining))
 	}
 
 	// Test deleting non-existent album
-	req, _ = http.NewRequest("DELETE", "/albums/not-found", nil)
-	w = httptest.NewRecorder()
-	router.ServeHTTP(w, req)
-
+	w = srv.do("DELETE", "/albums/not-found", "", "If-Match", "*")
 	if w.Code != 404 {
 		t.Errorf("Expected 404, got %d", w.Code)
 	}
@@ -172,16 +311,11 @@ func TestDeleteAlbumByID(t *testing.T) {
 // Verifies that partial updates work correctly (HTTP 200),
 // ID remains unchanged, and non-existent ID returns HTTP 404.
 func TestPatchAlbumByID(t *testing.T) {
-	resetAlbums()
-	router := setupRouter()
+	srv := newTestServer(t)
 
 	// Test updating title
 	body := `{"title": "Updated Title"}`
-	req, _ := http.NewRequest("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", bytes.NewBufferString(body))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
-
+	w := srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", body, "If-Match", "*")
 	if w.Code != 200 {
 		t.Errorf("Expected 200, got %d", w.Code)
 	}
@@ -200,11 +334,74 @@ func TestPatchAlbumByID(t *testing.T) {
 	}
 
 	// Test updating non-existent album
-	req, _ = http.NewRequest("PATCH", "/albums/not-found", bytes.NewBufferString(body))
-	req.Header.Set("Content-Type", "application/json")
-	w = httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+	w = srv.do("PATCH", "/albums/not-found", body, "If-Match", "*")
+	if w.Code != 404 {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
+
+// TestPutAlbumByID tests the PUT /albums/:id endpoint.
+// Verifies that the album is fully replaced while keeping its path ID, that omitted optional
+// fields are removed, and that missing fields return HTTP 400 and unknown albums HTTP 404.
+func TestPutAlbumByID(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", `{"tags": ["jazz"]}`, "If-Match", "*")
+	w := srv.do("PUT", "/albums/550e8400-e29b-41d4-a716-446655440001", `{"id": "other", "title": "Giant Steps", "artist": "John Coltrane", "price": 24.99}`, "If-Match", "*")
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var album Album
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if album.ID != "550e8400-e29b-41d4-a716-446655440001" || album.Title != "Giant Steps" || album.Price != 24.99 {
+		t.Errorf("Expected the replaced album under the path ID, got %+v", album)
+	}
+	if album.Tags != nil {
+		t.Errorf("Expected omitted tags to be removed, got %v", album.Tags)
+	}
+
+	if w = srv.do("PUT", "/albums/550e8400-e29b-41d4-a716-446655440001", `{"title": "Giant Steps", "price": 24.99}`, "If-Match", "*"); w.Code != 400 {
+		t.Errorf("Expected 400 without an artist, got %d", w.Code)
+	}
+	if w = srv.do("PUT", "/albums/not-found", `{"title": "Giant Steps", "artist": "John Coltrane", "price": 24.99}`, "If-Match", "*"); w.Code != 404 {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
+
+// TestAlbumUPC tests creating albums with a UPC and the GET /albums/upc/:code endpoint.
+// Verifies that a valid UPC is stored and found by both its UPC-A and EAN-13 forms (HTTP 200),
+// an invalid check digit returns HTTP 400, and a duplicate UPC returns HTTP 409.
+func TestAlbumUPC(t *testing.T) {
+	srv := newTestServer(t)
+
+	body := `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99, "upc": "074646593622"}`
+	w := srv.do("POST", "/albums", body)
+	if w.Code != 201 {
+		t.Fatalf("Expected 201, got %d", w.Code)
+	}
+
+	for _, code := range []string{"074646593622", "0074646593622"} {
+		w = srv.do("GET", "/albums/upc/"+code, "")
+		if w.Code != 200 {
+			t.Errorf("Expected 200 for %s, got %d", code, w.Code)
+		}
+	}
+
+	// Test invalid check digit
+	invalidBody := `{"title": "Giant Steps", "artist": "John Coltrane", "price": 19.99, "upc": "074646593621"}`
+	w = srv.do("POST", "/albums", invalidBody)
+	if w.Code != 400 {
+		t.Errorf("Expected 400 for invalid UPC, got %d", w.Code)
+	}
+
+	// Test duplicate UPC on a different album, so only the UPC conflicts
+	w = srv.do("POST", "/albums", `{"title": "Sketches of Spain", "artist": "Miles Davis", "price": 39.99, "upc": "074646593622"}`)
+	if w.Code != 409 || !strings.Contains(w.Body.String(), "An album with this UPC already exists") {
+		t.Errorf("Expected 409 with the UPC conflict error for duplicate UPC, got %d: %s", w.Code, w.Body)
+	}
 
+	// Test unknown UPC
+	w = srv.do("GET", "/albums/upc/4006381333931", "")
 	if w.Code != 404 {
 		t.Errorf("Expected 404, got %d", w.Code)
 	}
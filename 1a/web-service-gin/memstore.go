@@ -0,0 +1,630 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memoryStore keeps albums in memory. It is the default store; data is lost on restart.
+// Albums are held in a map keyed by ID for constant-time lookups; every method takes mu, so the
+// store is safe for concurrent handlers.
+//
+// Listings are served from listing, an immutable copy of every album in order that is built on
+// the first listing after a change and swapped out atomically, so large listings neither sort the
+// map nor hold mu while they copy.
+type memoryStore struct {
+	mu sync.RWMutex
+	// listing is every album in insertion order as of the last change, or nil if it has not been
+	// built since. It is never built while albums can be spilled to disk, to keep them out of memory.
+	listing atomic.Pointer[[]Album]
+	// albums maps album IDs to their albums.
+	albums map[string]memoryEntry
+	// nextSeq is the sequence number given to the next created album.
+	nextSeq uint64
+	// changes counts creates, updates, and deletes of albums and artists, so snapshots can tell
+	// whether anything changed.
+	changes uint64
+	// wal, if set, records every change before it is applied (see openWALStore).
+	wal *albumWAL
+	// upcIndex maps normalized barcodes to album IDs so albums can be looked up by UPC.
+	// Barcodes are unique: no two albums may share the same normalized UPC.
+	upcIndex map[string]string
+	// names maps the title and artist of albums (see albumNameKey) to the IDs of the albums that
+	// have them, so CreateUnique and UpdateUnique find duplicates without reading every album.
+	names map[string][]string
+	// spill, if set, holds albums evicted from memory by the memory watchdog (see enableSpill).
+	spill *spillFile
+
+	// artistMu guards artists. Reading artists takes only artistMu, so an album update, which holds
+	// mu, can credit the album to an artist; changing them takes mu first, then artistMu.
+	artistMu sync.Mutex
+	// artists holds the artists albums are credited to (see artistStore).
+	artists *artistTable
+}
+
+// memoryEntry is a stored album and its creation sequence number, which orders List.
+// An album evicted to the spill file keeps only its ID and UPC in memory, and spill locates the rest.
+type memoryEntry struct {
+	Album
+	seq   uint64
+	spill *spillRef
+}
+
+// newMemoryStore creates a memory store holding a copy of seed.
+// Seed albums without an UpdatedAt time are stamped with the current time, and those without a
+// CreatedAt time with their UpdatedAt time.
+func newMemoryStore(seed []Album) *memoryStore {
+	s := &memoryStore{
+		albums:   make(map[string]memoryEntry, len(seed)),
+		upcIndex: map[string]string{},
+		names:    map[string][]string{},
+		artists:  newArtistTable(),
+	}
+	now := time.Now().UTC()
+	for _, a := range seed {
+		if a.UpdatedAt.IsZero() {
+			a.UpdatedAt = now
+		}
+		if a.CreatedAt.IsZero() {
+			a.CreatedAt = a.UpdatedAt
+		}
+		s.add(a)
+	}
+	return s
+}
+
+// List returns a copy of every album in insertion order.
+func (s *memoryStore) List(ctx context.Context) ([]Album, error) {
+	if listing := s.snapshot(); listing != nil {
+		return slices.Clone(listing), nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.orderedAlbums()
+}
+
+// snapshot returns the listing of every album as of the last change, building it if needed, or
+// nil if spilling is enabled. The result is shared and must not be modified.
+func (s *memoryStore) snapshot() []Album {
+	if listing := s.listing.Load(); listing != nil {
+		return *listing
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.spill != nil {
+		return nil
+	}
+	// Changes wait for the read lock, so the listing cannot be stored after a newer change has
+	// cleared it. Concurrent readers may each build the same listing.
+	all, err := s.orderedAlbums()
+	if err != nil {
+		return nil
+	}
+	s.listing.Store(&all)
+	return all
+}
+
+// changed records a change to the albums and drops the listing snapshot. The caller must hold
+// s.mu for writing.
+func (s *memoryStore) changed() {
+	s.changes++
+	s.listing.Store(nil)
+}
+
+// Each calls fn with every album in insertion order, from the listing snapshot or else copied
+// under the read lock, so fn may be slow, e.g. writing to a client, without holding up writers.
+func (s *memoryStore) Each(ctx context.Context, fn func(Album) error) error {
+	if listing := s.snapshot(); listing != nil {
+		for _, a := range listing {
+			if err := fn(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	s.mu.RLock()
+	entries := s.ordered()
+	s.mu.RUnlock()
+	for _, e := range entries {
+		a := e.Album
+		if e.spill != nil {
+			// Read the album as it is now: the spill file may have been compacted since.
+			s.mu.RLock()
+			current, ok := s.albums[e.ID]
+			var err error
+			if ok {
+				a, err = s.resolve(current)
+			}
+			s.mu.RUnlock()
+			if !ok {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query returns a copy of the albums selected by f in insertion order.
+func (s *memoryStore) Query(ctx context.Context, f albumFilter) ([]Album, error) {
+	if listing := s.snapshot(); listing != nil {
+		return filterAlbums(listing, f.matches), nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all, err := s.orderedAlbums()
+	if err != nil {
+		return nil, err
+	}
+	return filterAlbums(all, f.matches), nil
+}
+
+// Get returns the album with the given ID. An album evicted to the spill file is read back and
+// kept in memory again.
+func (s *memoryStore) Get(ctx context.Context, id string) (Album, error) {
+	s.mu.RLock()
+	e, ok := s.albums[id]
+	if !ok {
+		s.mu.RUnlock()
+		return Album{}, errAlbumNotFound
+	}
+	a, err := s.resolve(e)
+	s.mu.RUnlock()
+	if err != nil {
+		return Album{}, err
+	}
+	if s.spill != nil {
+		s.spill.touch(id)
+		if e.spill != nil {
+			s.mu.Lock()
+			s.reinstate(id, e.spill, a)
+			s.mu.Unlock()
+		}
+	}
+	return a, nil
+}
+
+// GetByUPC returns the album with the given barcode using the UPC index.
+func (s *memoryStore) GetByUPC(ctx context.Context, code string) (Album, error) {
+	s.mu.RLock()
+	id, ok := s.upcIndex[normalizeUPC(code)]
+	s.mu.RUnlock()
+	if !ok {
+		return Album{}, errAlbumNotFound
+	}
+	return s.Get(ctx, id)
+}
+
+// Create adds a to the collection.
+func (s *memoryStore) Create(ctx context.Context, a Album) (Album, error) {
+	return s.create(a, false)
+}
+
+// CreateUnique adds a to the collection unless an album with the same title and artist exists.
+func (s *memoryStore) CreateUnique(ctx context.Context, a Album) (Album, error) {
+	return s.create(a, true)
+}
+
+// create adds a to the collection, first checking for a duplicate of it if unique is set.
+func (s *memoryStore) create(a Album, unique bool) (_ Album, err error) {
+	defer s.awaitLog(&err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ids := s.names[albumNameKey(a.Title, a.Artist)]; unique && len(ids) > 0 {
+		return Album{}, duplicateAlbumError{ID: ids[0]}
+	}
+	if s.upcTaken(a.UPC, "") {
+		return Album{}, errUPCConflict
+	}
+	if err := s.logChange(walPut, a); err != nil {
+		return Album{}, err
+	}
+	s.add(a)
+	s.compactLog()
+	return a, nil
+}
+
+// Update applies mutate to a copy of the album and stores it if mutate succeeds.
+func (s *memoryStore) Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(id, mutate, false)
+}
+
+// UpdateUnique applies mutate to a copy of the album and stores it if mutate succeeds, unless the
+// copy has the title and artist of another album.
+func (s *memoryStore) UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(id, mutate, true)
+}
+
+// update applies mutate to a copy of the album and stores it, first checking the copy for a
+// duplicate if unique is set.
+func (s *memoryStore) update(id string, mutate func(*Album) error, unique bool) (_ Album, err error) {
+	defer s.awaitLog(&err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.albums[id]
+	if !ok {
+		return Album{}, errAlbumNotFound
+	}
+	current, err := s.resolve(e)
+	if err != nil {
+		return Album{}, err
+	}
+
+	updated := current
+	if err := mutate(&updated); err != nil {
+		return Album{}, err
+	}
+	updated.ID = id
+	// Albums created with ?allow_duplicate=true may share a title and artist already, so only
+	// renaming an album is checked.
+	if key := albumNameKey(updated.Title, updated.Artist); unique && key != albumNameKey(current.Title, current.Artist) {
+		if ids := s.names[key]; len(ids) > 0 {
+			return Album{}, duplicateAlbumError{ID: ids[0]}
+		}
+	}
+	if s.upcTaken(updated.UPC, id) {
+		return Album{}, errUPCConflict
+	}
+	if err := s.logChange(walPut, updated); err != nil {
+		return Album{}, err
+	}
+
+	s.unindexUPC(e.Album)
+	s.unindexName(current)
+	s.albums[id] = memoryEntry{Album: updated, seq: e.seq}
+	s.indexUPC(updated)
+	s.indexName(updated)
+	s.unspill(e)
+	s.changed()
+	s.compactLog()
+	return updated, nil
+}
+
+// Delete removes the album with the given ID.
+func (s *memoryStore) Delete(ctx context.Context, id string) (_ Album, err error) {
+	defer s.awaitLog(&err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.albums[id]
+	if !ok {
+		return Album{}, errAlbumNotFound
+	}
+	a, err := s.resolve(e)
+	if err != nil {
+		return Album{}, err
+	}
+	if err := s.logChange(walDelete, a); err != nil {
+		return Album{}, err
+	}
+	delete(s.albums, id)
+	s.unindexUPC(e.Album)
+	s.unindexName(a)
+	s.unspill(e)
+	s.changed()
+	s.compactLog()
+	return a, nil
+}
+
+// UpdateWhere applies mutate to a copy of every album selected by f and stores those it changed,
+// all under one hold of mu. A failed write to the write-ahead log stops it partway, keeping the
+// albums changed before then, as a crash would.
+func (s *memoryStore) UpdateWhere(ctx context.Context, f albumFilter, mutate func(*Album) bool) (_ []Album, err error) {
+	defer s.awaitLog(&err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := []Album{}
+	for _, e := range s.ordered() {
+		a, err := s.resolve(e)
+		if err != nil {
+			return changed, err
+		}
+		if !f.matches(a) || !mutate(&a) {
+			continue
+		}
+		a.ID = e.ID
+		if err := s.logChange(walPut, a); err != nil {
+			return changed, err
+		}
+		s.albums[a.ID] = memoryEntry{Album: a, seq: e.seq}
+		s.unspill(e)
+		s.changed()
+		changed = append(changed, a)
+	}
+	s.compactLog()
+	return changed, nil
+}
+
+// DeleteWhere removes every album selected by f under one hold of mu. A failed write to the
+// write-ahead log stops it partway, keeping the albums removed before then, as a crash would.
+func (s *memoryStore) DeleteWhere(ctx context.Context, f albumFilter) (_ []Album, err error) {
+	defer s.awaitLog(&err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := []Album{}
+	for _, e := range s.ordered() {
+		a, err := s.resolve(e)
+		if err != nil {
+			return deleted, err
+		}
+		if !f.matches(a) {
+			continue
+		}
+		if err := s.logChange(walDelete, a); err != nil {
+			return deleted, err
+		}
+		delete(s.albums, a.ID)
+		s.unindexUPC(e.Album)
+		s.unindexName(a)
+		s.unspill(e)
+		s.changed()
+		deleted = append(deleted, a)
+	}
+	s.compactLog()
+	return deleted, nil
+}
+
+// ListArtists returns every artist.
+func (s *memoryStore) ListArtists(ctx context.Context) ([]Artist, error) {
+	s.artistMu.Lock()
+	defer s.artistMu.Unlock()
+	return s.artists.all(), nil
+}
+
+// GetArtist returns the artist with the given ID.
+func (s *memoryStore) GetArtist(ctx context.Context, id string) (Artist, error) {
+	s.artistMu.Lock()
+	defer s.artistMu.Unlock()
+	return s.artists.get(id)
+}
+
+// ArtistNamed returns the artist with the given name, ignoring case.
+func (s *memoryStore) ArtistNamed(ctx context.Context, name string) (Artist, error) {
+	s.artistMu.Lock()
+	defer s.artistMu.Unlock()
+	return s.artists.named(name)
+}
+
+// CreateArtist stores a new artist unless an artist has its name or ID.
+func (s *memoryStore) CreateArtist(ctx context.Context, artist Artist) (err error) {
+	defer s.awaitLog(&err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.artistMu.Lock()
+	defer s.artistMu.Unlock()
+	if err := s.artists.checkName(artist.ID, artist.Name); err != nil {
+		return err
+	}
+	if _, err := s.artists.get(artist.ID); err == nil {
+		return artistExistsError{artist.ID}
+	}
+	if err := s.logRecords(artistRecord(walArtistPut, artist)); err != nil {
+		return err
+	}
+	s.artists.put(artist)
+	s.changes++
+	s.compactLog()
+	return nil
+}
+
+// RenameArtist renames the artist with the given ID and its albums under one hold of mu, logging
+// them to the write-ahead log in one write.
+func (s *memoryStore) RenameArtist(ctx context.Context, id, name string, rename func(*Album)) (_ Artist, _ []albumChange, err error) {
+	defer s.awaitLog(&err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.artistMu.Lock()
+	defer s.artistMu.Unlock()
+	artist, err := s.artists.get(id)
+	if err != nil {
+		return Artist{}, nil, err
+	}
+	if err := s.artists.checkName(id, name); err != nil {
+		return Artist{}, nil, err
+	}
+
+	artist = renamedArtist(artist, name, time.Now().UTC())
+	records := []walRecord{artistRecord(walArtistPut, artist)}
+	changes := []albumChange{}
+	for _, e := range s.ordered() {
+		a, err := s.resolve(e)
+		if err != nil {
+			return Artist{}, nil, err
+		}
+		if albumArtistID(a) != id {
+			continue
+		}
+		updated := a
+		rename(&updated)
+		updated.ID = a.ID
+		records = append(records, albumRecord(walPut, updated))
+		changes = append(changes, albumChange{Album: updated, Previous: a})
+	}
+	if err := s.logRecords(records...); err != nil {
+		return Artist{}, nil, err
+	}
+
+	s.artists.put(artist)
+	s.changes++
+	for _, change := range changes {
+		e := s.albums[change.ID]
+		s.unindexName(change.Previous)
+		s.albums[change.ID] = memoryEntry{Album: change.Album, seq: e.seq}
+		s.indexName(change.Album)
+		s.unspill(e)
+		s.changed()
+	}
+	s.compactLog()
+	return artist, changes, nil
+}
+
+// DeleteArtist removes the artist with the given ID unless an album is credited to it, under one
+// hold of mu.
+func (s *memoryStore) DeleteArtist(ctx context.Context, id string) (_ Artist, err error) {
+	defer s.awaitLog(&err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.artistMu.Lock()
+	defer s.artistMu.Unlock()
+	artist, err := s.artists.get(id)
+	if err != nil {
+		return Artist{}, err
+	}
+	for _, e := range s.albums {
+		a, err := s.resolve(e)
+		if err != nil {
+			return Artist{}, err
+		}
+		if albumArtistID(a) == id {
+			return Artist{}, errArtistHasAlbums
+		}
+	}
+	if err := s.logRecords(artistRecord(walArtistDelete, artist)); err != nil {
+		return Artist{}, err
+	}
+	s.artists.remove(id)
+	s.changes++
+	s.compactLog()
+	return artist, nil
+}
+
+// putArtists stores artists read from a snapshot. It must be called before the store is in use.
+func (s *memoryStore) putArtists(artists []Artist) {
+	for _, artist := range artists {
+		s.artists.put(artist)
+	}
+}
+
+// add stores a as the newest album and indexes its barcode. The caller must hold s.mu.
+func (s *memoryStore) add(a Album) {
+	s.albums[a.ID] = memoryEntry{Album: a, seq: s.nextSeq}
+	s.nextSeq++
+	s.indexUPC(a)
+	s.indexName(a)
+	s.changed()
+}
+
+// logChange appends a change to the write-ahead log, if there is one, before it is applied.
+// The caller must hold s.mu.
+func (s *memoryStore) logChange(op string, a Album) error {
+	return s.logRecords(albumRecord(op, a))
+}
+
+// logRecords appends records to the write-ahead log, if there is one, in one write, before the
+// changes they record are applied. The caller must hold s.mu.
+func (s *memoryStore) logRecords(records ...walRecord) error {
+	if s.wal == nil {
+		return nil
+	}
+	return s.wal.write(records...)
+}
+
+// awaitLog waits for the change just logged to reach the disk when the write-ahead log syncs by
+// group commit, setting *err if the sync fails. The change has already been applied by then, so
+// other requests may read it before it is durable. It must be called without s.mu held, so that
+// concurrent changes can join the same sync.
+func (s *memoryStore) awaitLog(err *error) {
+	if *err != nil || s.wal == nil || s.wal.group == nil {
+		return
+	}
+	*err = s.wal.group.do(struct{}{})
+}
+
+// compactLog compacts the write-ahead log once it has grown past its threshold. A failed
+// compaction is logged and leaves the existing log in use. The caller must hold s.mu.
+func (s *memoryStore) compactLog() {
+	if s.wal == nil || !s.wal.needsCompaction() {
+		return
+	}
+	albums, err := s.orderedAlbums()
+	if err == nil {
+		// Artists only change with s.mu held, so they can be read without s.artistMu.
+		err = s.wal.compact(albums, s.artists.all())
+	}
+	if err != nil {
+		log.Printf("compact write-ahead log %s: %v", s.wal.path, err)
+	}
+}
+
+// changeCount returns the number of changes made to the store so far, to albums or artists.
+func (s *memoryStore) changeCount() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changes
+}
+
+// ordered returns every entry in insertion order. The caller must hold s.mu.
+func (s *memoryStore) ordered() []memoryEntry {
+	entries := make([]memoryEntry, 0, len(s.albums))
+	for _, e := range s.albums {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b memoryEntry) int { return cmp.Compare(a.seq, b.seq) })
+	return entries
+}
+
+// orderedAlbums returns every album in insertion order, reading evicted albums from the spill
+// file. The caller must hold s.mu.
+func (s *memoryStore) orderedAlbums() ([]Album, error) {
+	entries := s.ordered()
+	all := make([]Album, len(entries))
+	for i, e := range entries {
+		a, err := s.resolve(e)
+		if err != nil {
+			return nil, err
+		}
+		all[i] = a
+	}
+	return all, nil
+}
+
+// indexUPC records the barcode of album a in the UPC index, if it has one. The caller must hold s.mu.
+func (s *memoryStore) indexUPC(a Album) {
+	if a.UPC != "" {
+		s.upcIndex[normalizeUPC(a.UPC)] = a.ID
+	}
+}
+
+// unindexUPC removes the barcode of album a from the UPC index, if it has one. The caller must hold s.mu.
+func (s *memoryStore) unindexUPC(a Album) {
+	if a.UPC != "" {
+		delete(s.upcIndex, normalizeUPC(a.UPC))
+	}
+}
+
+// indexName records album a under its title and artist in the name index. The caller must hold s.mu.
+func (s *memoryStore) indexName(a Album) {
+	key := albumNameKey(a.Title, a.Artist)
+	s.names[key] = append(s.names[key], a.ID)
+}
+
+// unindexName removes album a from the name index. a must be the whole album, not the entry of an
+// album evicted to the spill file. The caller must hold s.mu.
+func (s *memoryStore) unindexName(a Album) {
+	key := albumNameKey(a.Title, a.Artist)
+	ids := slices.DeleteFunc(s.names[key], func(id string) bool { return id == a.ID })
+	if len(ids) == 0 {
+		delete(s.names, key)
+		return
+	}
+	s.names[key] = ids
+}
+
+// upcTaken reports whether code is already assigned to an album other than exceptID.
+// An empty code is never taken. The caller must hold s.mu.
+func (s *memoryStore) upcTaken(code, exceptID string) bool {
+	if code == "" {
+		return false
+	}
+	id, ok := s.upcIndex[normalizeUPC(code)]
+	return ok && id != exceptID
+}
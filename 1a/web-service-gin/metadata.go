@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metadata limits.
+const (
+	maxMetadataKeys        = 20
+	maxMetadataKeyLength   = 40
+	maxMetadataValueLength = 200
+)
+
+// validMetadataKey reports whether key is 1 to maxMetadataKeyLength ASCII letters, digits,
+// underscores, hyphens, or dots.
+func validMetadataKey(key string) bool {
+	if key == "" || len(key) > maxMetadataKeyLength {
+		return false
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// mergeMetadata returns a copy of existing with the entries of update applied; an empty value
+// removes its key. Returns an error message if a key or value is invalid, or if the result would
+// have more than maxMetadataKeys keys. The result is nil if no keys remain.
+func mergeMetadata(existing, update map[string]string) (map[string]string, string) {
+	merged := maps.Clone(existing)
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	for key, value := range update {
+		if !validMetadataKey(key) {
+			return nil, fmt.Sprintf("Metadata keys must be 1 to %d letters, digits, '_', '-', or '.'", maxMetadataKeyLength)
+		}
+		if len(value) > maxMetadataValueLength {
+			return nil, fmt.Sprintf("Metadata values must be at most %d characters", maxMetadataValueLength)
+		}
+		if value == "" {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+	if len(merged) > maxMetadataKeys {
+		return nil, fmt.Sprintf("An album can have at most %d metadata keys", maxMetadataKeys)
+	}
+	if len(merged) == 0 {
+		return nil, ""
+	}
+	return merged, ""
+}
+
+// parseMetadataFilter returns a filter for the metadata[key]=value query parameters: albums must
+// have every given key, and its value must equal the given value unless that is empty.
+// Returns nil if no metadata parameter is given.
+func parseMetadataFilter(c *gin.Context) func(Album) bool {
+	want := c.QueryMap("metadata")
+	if len(want) == 0 {
+		return nil
+	}
+	return func(a Album) bool {
+		for key, value := range want {
+			got, ok := a.Metadata[key]
+			if !ok || (value != "" && got != value) {
+				return false
+			}
+		}
+		return true
+	}
+}
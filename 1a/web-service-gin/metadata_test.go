@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestAlbumMetadata tests setting, merging, and filtering on album metadata.
+// Verifies that POST stores metadata, PATCH merges keys and removes empty ones, and that
+// ?metadata[key]=value matches by value and ?metadata[key]= by presence.
+func TestAlbumMetadata(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := srv.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99,
+		"metadata": {"label": "Columbia", "catalog.no": "CL 1355"}}`)
+	var created Album
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != 201 || created.Metadata["label"] != "Columbia" {
+		t.Fatalf("Expected 201 with metadata, got %d: %s", w.Code, w.Body)
+	}
+	srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", `{"metadata": {"label": "Blue Note"}}`, "If-Match", "*")
+
+	w = srv.do("PATCH", "/albums/"+created.ID, `{"metadata": {"catalog.no": "", "mono": "true"}}`, "If-Match", "*")
+	var patched Album
+	json.Unmarshal(w.Body.Bytes(), &patched)
+	if fmt.Sprint(patched.Metadata) != "map[label:Columbia mono:true]" {
+		t.Errorf("Expected merged metadata, got %v", patched.Metadata)
+	}
+
+	var list []Album
+	json.Unmarshal(srv.do("GET", "/albums?metadata[label]=Blue%20Note", "").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Title != "Blue Train" {
+		t.Errorf("Expected only Blue Train on Blue Note, got %+v", list)
+	}
+	json.Unmarshal(srv.do("GET", "/albums?metadata[label]=", "").Body.Bytes(), &list)
+	if len(list) != 2 {
+		t.Errorf("Expected 2 albums with a label, got %d", len(list))
+	}
+	json.Unmarshal(srv.do("GET", "/albums?metadata[label]=&metadata[mono]=true", "").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].ID != created.ID {
+		t.Errorf("Expected only the mono album, got %+v", list)
+	}
+}
+
+// TestAlbumMetadataInvalid tests that invalid metadata is rejected with HTTP 400 and leaves the album unchanged.
+func TestAlbumMetadataInvalid(t *testing.T) {
+	srv := newTestServer(t)
+	many := make([]string, maxMetadataKeys+1)
+	for i := range many {
+		many[i] = fmt.Sprintf(`"k%d": "v"`, i)
+	}
+
+	for _, metadata := range []string{
+		`{"bad key": "v"}`,
+		`{"` + strings.Repeat("k", maxMetadataKeyLength+1) + `": "v"}`,
+		`{"k": "` + strings.Repeat("v", maxMetadataValueLength+1) + `"}`,
+		`{` + strings.Join(many, ",") + `}`,
+	} {
+		w := srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", `{"metadata": `+metadata+`}`, "If-Match", "*")
+		if w.Code != 400 {
+			t.Errorf("%.40s: expected 400, got %d", metadata, w.Code)
+		}
+	}
+	if a, _ := srv.store.Get(t.Context(), "550e8400-e29b-41d4-a716-446655440001"); a.Metadata != nil {
+		t.Errorf("Expected no metadata after rejected updates, got %v", a.Metadata)
+	}
+}
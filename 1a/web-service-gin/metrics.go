@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// endpointCounters counts outcomes for one route. A request succeeds if its status is below 400.
+type endpointCounters struct {
+	success atomic.Int64
+	failure atomic.Int64
+}
+
+// requestMetrics holds cumulative request counters for the whole server and per route.
+// All counters are updated atomically, so the middleware never blocks request handling.
+type requestMetrics struct {
+	success   atomic.Int64
+	failure   atomic.Int64
+	endpoints sync.Map // "METHOD /route/:param" -> *endpointCounters
+	// stale counts responses served from cached albums because the store failed.
+	stale atomic.Int64
+}
+
+// endpointSummary is one row of the /metrics/summary report.
+type endpointSummary struct {
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Successful int64  `json:"successful"`
+	Failed     int64  `json:"failed"`
+	Total      int64  `json:"total"`
+}
+
+// metricsMiddleware counts every request by route and outcome in m.
+// Requests that match no route are counted under the path "unmatched".
+func metricsMiddleware(m *requestMetrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		value, _ := m.endpoints.LoadOrStore(c.Request.Method+" "+path, &endpointCounters{})
+		counters := value.(*endpointCounters)
+
+		if c.Writer.Status() < 400 {
+			counters.success.Add(1)
+			m.success.Add(1)
+		} else {
+			counters.failure.Add(1)
+			m.failure.Add(1)
+		}
+	}
+}
+
+// summary returns the per-endpoint counters sorted by path and method.
+func (m *requestMetrics) summary() []endpointSummary {
+	rows := []endpointSummary{}
+	m.endpoints.Range(func(key, value any) bool {
+		method, path, _ := strings.Cut(key.(string), " ")
+		counters := value.(*endpointCounters)
+		success, failure := counters.success.Load(), counters.failure.Load()
+		rows = append(rows, endpointSummary{
+			Method:     method,
+			Path:       path,
+			Successful: success,
+			Failed:     failure,
+			Total:      success + failure,
+		})
+		return true
+	})
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Path != rows[j].Path {
+			return rows[i].Path < rows[j].Path
+		}
+		return rows[i].Method < rows[j].Method
+	})
+	return rows
+}
+
+// getMetricsSummary handles GET /metrics/summary requests.
+// Returns cumulative successful/failed request totals and per-endpoint counters with HTTP 200 status.
+// The response is JSON by default; ?format=csv returns one row per endpoint plus a TOTAL row,
+// matching the columns of the client-side report.
+func (srv *Server) getMetricsSummary(c *gin.Context) {
+	rows := srv.metrics.summary()
+	success, failure := srv.metrics.success.Load(), srv.metrics.failure.Load()
+
+	if c.Query("format") == "csv" {
+		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"method", "path", "successful", "failed", "total"})
+		for _, r := range rows {
+			w.Write([]string{r.Method, r.Path, itoa(r.Successful), itoa(r.Failed), itoa(r.Total)})
+		}
+		w.Write([]string{"TOTAL", "", itoa(success), itoa(failure), itoa(success + failure)})
+		w.Flush()
+		return
+	}
+
+	summary := gin.H{
+		"total_requests":      success + failure,
+		"successful_requests": success,
+		"failed_requests":     failure,
+		"stale_responses":     srv.metrics.stale.Load(),
+		"endpoints":           rows,
+	}
+	if srv.cache != nil {
+		summary["album_cache"] = srv.cache.stats()
+	}
+	c.IndentedJSON(http.StatusOK, summary)
+}
+
+// itoa formats a counter for CSV output.
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
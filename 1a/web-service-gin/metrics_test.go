@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestMetricsSummary tests the metrics middleware and the GET /metrics/summary endpoint.
+// Verifies that concurrent requests are counted per endpoint as successful or failed,
+// and that both the JSON and CSV formats report the totals.
+func TestMetricsSummary(t *testing.T) {
+	srv := newTestServer(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path := "/albums/550e8400-e29b-41d4-a716-446655440001"
+			if i%4 == 0 {
+				path = "/albums/not-found"
+			}
+			srv.do("GET", path, "")
+		}()
+	}
+	wg.Wait()
+
+	w := srv.do("GET", "/metrics/summary", "")
+
+	var summary struct {
+		Total     int64             `json:"total_requests"`
+		Succeeded int64             `json:"successful_requests"`
+		Failed    int64             `json:"failed_requests"`
+		Endpoints []endpointSummary `json:"endpoints"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 20 || summary.Succeeded != 15 || summary.Failed != 5 {
+		t.Errorf("Expected 20 total, 15 successful, 5 failed, got %+v", summary)
+	}
+	if len(summary.Endpoints) != 1 || summary.Endpoints[0].Path != "/albums/:id" {
+		t.Errorf("Expected a single /albums/:id endpoint, got %+v", summary.Endpoints)
+	}
+
+	w = srv.do("GET", "/metrics/summary?format=csv", "")
+	if !strings.Contains(w.Body.String(), "GET,/albums/:id,15,5,20") {
+		t.Errorf("CSV missing endpoint row: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotVersion is the format version written to snapshots. Snapshots without one are in the
+// legacy format: either version 0 or, from before snapshots had a header, a bare JSON array of
+// albums with only id, title, artist, and price, as in the original hardcoded seed.
+const snapshotVersion = 1
+
+// migrationReport describes the upgrade of one persisted file from the legacy format: the file's
+// format version before and after, its album count, and how many albums were given the timestamps
+// they lacked. Applied is false for a dry run or when the file was already up to date.
+type migrationReport struct {
+	Path        string    `json:"path"`
+	Kind        string    `json:"kind"`
+	FromVersion int       `json:"from_version"`
+	ToVersion   int       `json:"to_version"`
+	Albums      int       `json:"albums"`
+	Stamped     int       `json:"stamped"`
+	StampedAt   time.Time `json:"stamped_at,omitzero"`
+	Applied     bool      `json:"applied"`
+}
+
+// needed reports whether the file was in the legacy format.
+func (r migrationReport) needed() bool {
+	return r.FromVersion != r.ToVersion || r.Stamped > 0
+}
+
+// migrateLegacyData upgrades the snapshot at cfg.SnapshotPath and the write-ahead log at
+// cfg.WALPath, if they exist, from the legacy format in place. With dryRun nothing is written;
+// the reports only describe what would change.
+func migrateLegacyData(cfg Config, dryRun bool) ([]migrationReport, error) {
+	var reports []migrationReport
+	if cfg.SnapshotPath != "" {
+		r, err := migrateSnapshot(cfg.SnapshotPath, dryRun)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return reports, fmt.Errorf("migrate %s: %w", cfg.SnapshotPath, err)
+		}
+		if err == nil {
+			reports = append(reports, r)
+		}
+	}
+	if cfg.WALPath != "" {
+		r, err := migrateWAL(cfg.WALPath, dryRun)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return reports, fmt.Errorf("migrate %s: %w", cfg.WALPath, err)
+		}
+		if err == nil {
+			reports = append(reports, r)
+		}
+	}
+	return reports, nil
+}
+
+// stampLegacyAlbum gives a the timestamps it lacks: at for UpdatedAt, and its UpdatedAt time, the
+// earliest known, for CreatedAt. Reports whether it set either.
+func stampLegacyAlbum(a *Album, at time.Time) bool {
+	stamped := false
+	if a.UpdatedAt.IsZero() {
+		a.UpdatedAt, stamped = at, true
+	}
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt, stamped = a.UpdatedAt, true
+	}
+	return stamped
+}
+
+// stampLegacyAlbums stamps every album in albums with stampLegacyAlbum and returns how many it
+// stamped.
+func stampLegacyAlbums(albums []Album, at time.Time) int {
+	n := 0
+	for i := range albums {
+		if stampLegacyAlbum(&albums[i], at) {
+			n++
+		}
+	}
+	return n
+}
+
+// decodeSnapshot parses a snapshot in the current or the legacy format. A bare array of albums
+// is returned as a snapshot with version 0.
+func decodeSnapshot(data []byte) (albumSnapshot, error) {
+	var snap albumSnapshot
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err := json.Unmarshal(trimmed, &snap.Albums)
+		return snap, err
+	}
+	err := json.Unmarshal(data, &snap)
+	return snap, err
+}
+
+// migrateSnapshot upgrades the snapshot at path to snapshotVersion, stamping albums without an
+// UpdatedAt time with the time the snapshot was saved (or, for a bare array, last modified), and
+// albums without a CreatedAt time with their UpdatedAt time.
+// Returns an error satisfying errors.Is(err, os.ErrNotExist) if there is no snapshot.
+func migrateSnapshot(path string, dryRun bool) (migrationReport, error) {
+	report := migrationReport{Path: path, Kind: "snapshot", ToVersion: snapshotVersion}
+	info, err := os.Stat(path)
+	if err != nil {
+		return report, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+	snap, err := decodeSnapshot(data)
+	if err != nil {
+		return report, fmt.Errorf("parse: %w", err)
+	}
+	report.FromVersion = snap.Version
+	report.Albums = len(snap.Albums)
+	if snap.SavedAt.IsZero() {
+		snap.SavedAt = info.ModTime().UTC()
+	}
+	report.StampedAt = snap.SavedAt
+	report.Stamped = stampLegacyAlbums(snap.Albums, snap.SavedAt)
+	if !report.needed() || dryRun {
+		return report, nil
+	}
+	if err := writeSnapshot(path, snap); err != nil {
+		return report, err
+	}
+	report.Applied = true
+	return report, nil
+}
+
+// migrateWAL stamps albums without timestamps in the put records of the write-ahead log at path as
+// stampLegacyAlbum does, with the log's last modification time, rewriting the log through a temporary file. The
+// log itself has no format version. Returns an error satisfying errors.Is(err, os.ErrNotExist)
+// if there is no log.
+func migrateWAL(path string, dryRun bool) (migrationReport, error) {
+	report := migrationReport{Path: path, Kind: "wal"}
+	file, err := os.Open(path)
+	if err != nil {
+		return report, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return report, err
+	}
+	records, _, err := readWAL(file)
+	if err != nil {
+		return report, err
+	}
+	at := info.ModTime().UTC()
+	for _, rec := range records {
+		if rec.Op == walPut && rec.Album != nil {
+			report.Albums++
+			if stampLegacyAlbum(rec.Album, at) {
+				report.Stamped++
+			}
+		}
+	}
+	if report.Stamped > 0 {
+		report.StampedAt = at
+	}
+	if !report.needed() || dryRun {
+		return report, nil
+	}
+
+	var buf bytes.Buffer
+	for _, rec := range records {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return report, err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return report, err
+	}
+	report.Applied = true
+	return report, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path, syncs it, and renames it into
+// place, so a crash mid-write never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
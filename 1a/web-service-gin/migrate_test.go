@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// legacySeed is a snapshot in the legacy format: the original hardcoded seed as a bare JSON array.
+const legacySeed = `[
+  {"id": "550e8400-e29b-41d4-a716-446655440001", "title": "Blue Train", "artist": "John Coltrane", "price": 56.99},
+  {"id": "550e8400-e29b-41d4-a716-446655440002", "title": "Jeru", "artist": "Gerry Mulligan", "price": 17.99}
+]`
+
+// TestMigrateLegacySnapshot tests upgrading a legacy snapshot.
+// Verifies that a dry run reports the upgrade without touching the file, that the upgrade stamps
+// every album's creation and update times with the file's modification time and writes the
+// current version, and that running it again finds nothing to do.
+func TestMigrateLegacySnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "albums.json")
+	os.WriteFile(path, []byte(legacySeed), 0o600)
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(path, modified, modified)
+	cfg := Config{SnapshotPath: path, WALPath: filepath.Join(t.TempDir(), "missing.wal")}
+
+	reports, err := migrateLegacyData(cfg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := migrationReport{Path: path, Kind: "snapshot", ToVersion: snapshotVersion, Albums: 2, Stamped: 2, StampedAt: modified}
+	if len(reports) != 1 || reports[0] != want {
+		t.Errorf("Expected dry run report %+v, got %+v", want, reports)
+	}
+	if data, _ := os.ReadFile(path); string(data) != legacySeed {
+		t.Error("Expected the dry run to leave the snapshot unchanged")
+	}
+
+	reports, err = migrateLegacyData(cfg, false)
+	if err != nil || len(reports) != 1 || !reports[0].Applied {
+		t.Fatalf("Expected the snapshot to be migrated, got %+v, %v", reports, err)
+	}
+	var snap albumSnapshot
+	data, _ := os.ReadFile(path)
+	json.Unmarshal(data, &snap)
+	if snap.Version != snapshotVersion || len(snap.Albums) != 2 || !snap.Albums[1].UpdatedAt.Equal(modified) || !snap.Albums[1].CreatedAt.Equal(modified) {
+		t.Errorf("Expected an upgraded snapshot, got %s", data)
+	}
+
+	if reports, _ := migrateLegacyData(cfg, false); reports[0].needed() || reports[0].Applied {
+		t.Errorf("Expected nothing to migrate the second time, got %+v", reports[0])
+	}
+	s, err := openSnapshotStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := s.Get(context.Background(), "550e8400-e29b-41d4-a716-446655440002"); !a.UpdatedAt.Equal(modified) {
+		t.Errorf("Expected the stamped time to be loaded, got %v", a.UpdatedAt)
+	}
+}
+
+// TestMigrateLegacyWAL tests that put records without a timestamp are stamped in place, and that
+// the log still replays afterwards.
+func TestMigrateLegacyWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "albums.wal")
+	os.WriteFile(path, []byte(`{"seq":1,"op":"put","id":"a","album":{"id":"a","title":"Jeru","artist":"Gerry Mulligan","price":17.99}}
+{"seq":2,"op":"delete","id":"a"}
+{"seq":3,"op":"put","id":"b","album":{"id":"b","title":"Blue Train","artist":"John Coltrane","price":56.99,"created_at":"2024-06-01T00:00:00Z","updated_at":"2025-01-01T00:00:00Z"}}
+`), 0o600)
+
+	r, err := migrateWAL(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Albums != 2 || r.Stamped != 1 || !r.Applied {
+		t.Errorf("Expected 1 of 2 albums stamped, got %+v", r)
+	}
+	restored := openTestWALStore(t, path, 0)
+	if a, _ := restored.Get(context.Background(), "b"); !a.UpdatedAt.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected an existing timestamp to be kept, got %v", a.UpdatedAt)
+	}
+}
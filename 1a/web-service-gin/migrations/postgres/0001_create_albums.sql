@@ -0,0 +1,14 @@
+-- Albums are stored as a JSON document so new Album fields need no migration.
+-- Fields used for lookups and constraints are promoted to columns.
+CREATE TABLE albums (
+    id      TEXT PRIMARY KEY,
+    seq     BIGSERIAL NOT NULL,
+    title   TEXT NOT NULL,
+    artist  TEXT NOT NULL,
+    price   DOUBLE PRECISION NOT NULL,
+    upc_key TEXT CONSTRAINT albums_upc_key_unique UNIQUE,
+    doc     JSONB NOT NULL
+);
+
+-- List returns albums in insertion order.
+CREATE INDEX albums_seq_idx ON albums (seq);
@@ -0,0 +1,7 @@
+-- Artists are stored as a JSON document like albums, with the lowercased name promoted to a
+-- column so that no two artists share a name.
+CREATE TABLE artists (
+    id       TEXT PRIMARY KEY,
+    name_key TEXT NOT NULL CONSTRAINT artists_name_key_unique UNIQUE,
+    doc      JSONB NOT NULL
+);
@@ -0,0 +1,11 @@
+-- Albums are stored as a JSON document so new Album fields need no migration.
+-- Fields used for lookups and constraints are promoted to columns.
+CREATE TABLE albums (
+    seq     INTEGER PRIMARY KEY AUTOINCREMENT,
+    id      TEXT NOT NULL UNIQUE,
+    title   TEXT NOT NULL,
+    artist  TEXT NOT NULL,
+    price   REAL NOT NULL,
+    upc_key TEXT UNIQUE,
+    doc     TEXT NOT NULL
+);
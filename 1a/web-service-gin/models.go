@@ -1,18 +1,61 @@
 package main
 
-// Album represents a record album with ID, title, artist, and price.
-// The ID is generated by the server and ignored if provided by the client.
+import "time"
+
+// Album represents a record album. The validate tags hold the rules for client-supplied fields
+// (see validateAlbum and albumRules); the other fields are managed by the server.
 type Album struct {
-	ID     string  `json:"id"`
-	Title  string  `json:"title"`
-	Artist string  `json:"artist"`
-	Price  float64 `json:"price"`
+	// ID is generated by the server and ignored if provided by the client.
+	ID    string `json:"id"`
+	Title string `json:"title" validate:"required,title_length"`
+	// Artist is the name of the artist the album is credited to (see ArtistID).
+	Artist string `json:"artist" validate:"required,min=2,max=100"`
+	// Price is in Currency.
+	Price float64 `json:"price" validate:"required,gt=0,price_precision"`
+	// UPC is the album's optional UPC or EAN barcode.
+	UPC string `json:"upc,omitempty" validate:"omitempty,upc"`
+	// Tags are free-form labels, stored trimmed and lowercased.
+	Tags []string `json:"tags,omitempty" validate:"omitempty,tags"`
+	// Metadata holds attributes set by integrators as string key-value pairs.
+	Metadata map[string]string `json:"metadata,omitempty" validate:"omitempty,metadata"`
+	// Genre is one of the configured GENRES.
+	Genre string `json:"genre,omitempty" validate:"omitempty,genre"`
+	// Year is the release year.
+	Year int `json:"year,omitempty" validate:"omitempty,year"`
+	// Quantity is the number of copies in stock, taken by POST /albums/:id/purchase; nil if stock
+	// is not tracked.
+	Quantity *int `json:"quantity,omitempty" validate:"omitempty,quantity"`
+	// Currency is the ISO 4217 code of the currency Price is in; empty means USD.
+	Currency string `json:"currency,omitempty" validate:"omitempty,currency"`
+	// Tracks are managed through the /albums/:id/tracks endpoints, ordered by number, and
+	// TrackCount is the number of them.
+	Tracks     []Track `json:"tracks,omitempty"`
+	TrackCount int     `json:"track_count,omitempty"`
+	// ArtistID references the Artist the album is credited to (see linkArtist).
+	ArtistID string `json:"artist_id,omitempty"`
+	// ImageURL is where the cover uploaded with PUT /albums/:id/cover is served.
+	ImageURL string `json:"image_url,omitempty"`
+	// SpotifyID and SpotifyURL are set by the Spotify link endpoints.
+	SpotifyID  string `json:"spotify_id,omitempty"`
+	SpotifyURL string `json:"spotify_url,omitempty"`
+	// CreatedAt is when the album was created, and UpdatedAt when it was created or last changed.
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+	// ArchivedAt is when the album was archived, zero while it is active.
+	ArchivedAt time.Time `json:"archived_at,omitzero"`
+	// DeletedAt is when the album was deleted, zero unless it is awaiting restore (see
+	// softDeleteStore).
+	DeletedAt time.Time `json:"deleted_at,omitzero"`
+	// Version is 1 when the album is created, and one more with every change (see stampUpdated).
+	// It is the album's ETag, which PUT, PATCH, and DELETE require as If-Match by default.
+	Version int64 `json:"version,omitempty"`
 }
 
-// albums stores the collection of albums in memory.
-// In production, this would be stored in a database.
-var albums = []Album{
-	{ID: "550e8400-e29b-41d4-a716-446655440001", Title: "Blue Train", Artist: "John Coltrane", Price: 56.99},
-	{ID: "550e8400-e29b-41d4-a716-446655440002", Title: "Jeru", Artist: "Gerry Mulligan", Price: 17.99},
-	{ID: "550e8400-e29b-41d4-a716-446655440003", Title: "Sarah Vaughan and Clifford Brown", Artist: "Sarah Vaughan", Price: 39.99},
+// seedAlbums returns the sample albums the memory store starts with.
+func seedAlbums() []Album {
+	return []Album{
+		{ID: "550e8400-e29b-41d4-a716-446655440001", Title: "Blue Train", Artist: "John Coltrane", Price: 56.99},
+		{ID: "550e8400-e29b-41d4-a716-446655440002", Title: "Jeru", Artist: "Gerry Mulligan", Price: 17.99},
+		{ID: "550e8400-e29b-41d4-a716-446655440003", Title: "Sarah Vaughan and Clifford Brown", Artist: "Sarah Vaughan", Price: 39.99},
+	}
 }
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// mongoMaxAttempts is how many times an update is retried when another writer changes the album first.
+const mongoMaxAttempts = 5
+
+// mongoNameIndex is the name of the unique index on the name keys of albums holding their title
+// and artist (see mongoStore).
+const mongoNameIndex = "album_name_holder"
+
+// errMongoConflict is returned when an album keeps changing underneath an update.
+var errMongoConflict = errors.New("album was modified concurrently; try again")
+
+// mongoStore keeps albums in a MongoDB collection, one document per album keyed by its ID.
+// Album fields are stored under their JSON names. Documents also hold the normalized UPC
+// (with a unique index), a version counter that updates are conditioned on, and the creation
+// time used to order listings. Artists are kept in the artists collection, with a unique index
+// on their lowercased name; renaming and deleting an artist run in a transaction with its
+// albums, which MongoDB only supports on a replica set.
+// Each document also stores its title and artist as a name key (see albumNameKey). Albums created
+// with ?allow_duplicate=true share it, so it cannot be unique; instead the first album with a name
+// key holds it (name_holder), under a unique index on the name keys of holders. CreateUnique and
+// UpdateUnique fail if any album has the name key, and otherwise write the album as its holder,
+// so of concurrent writes of the same title and artist the index lets only one succeed.
+type mongoStore struct {
+	albums  *mongo.Collection
+	artists *mongo.Collection
+}
+
+// mongoAlbum is the stored form of an album.
+type mongoAlbum struct {
+	Key        string `bson:"_id"`
+	Album      `bson:",inline"`
+	UPCKey     string    `bson:"upc_key,omitempty"`
+	NameKey    string    `bson:"name_key,omitempty"`
+	NameHolder bool      `bson:"name_holder,omitempty"`
+	Version    int64     `bson:"version"`
+	CreatedAt  time.Time `bson:"created_at"`
+}
+
+// mongoArtist is the stored form of an artist, with its name key (see artistKey).
+type mongoArtist struct {
+	Key     string `bson:"_id"`
+	Artist  `bson:",inline"`
+	NameKey string `bson:"name_key"`
+}
+
+// newMongoStore connects to cfg.MongoURI and ensures the collection's indexes exist.
+func newMongoStore(cfg Config) (AlbumStore, error) {
+	client, err := mongo.Connect(options.Client().
+		ApplyURI(cfg.MongoURI).
+		SetBSONOptions(&options.BSONOptions{UseJSONStructTags: true}))
+	if err != nil {
+		return nil, fmt.Errorf("connect to mongodb: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("connect to mongodb: %w", err)
+	}
+
+	albums := client.Database(cfg.MongoDatabase).Collection("albums")
+	_, err = albums.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "artist", Value: 1}}},
+		{Keys: bson.D{{Key: "title", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "upc_key", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{{Key: "upc_key", Value: bson.D{{Key: "$exists", Value: true}}}}),
+		},
+		{Keys: bson.D{{Key: "name_key", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "name_key", Value: 1}, {Key: "name_holder", Value: 1}},
+			Options: options.Index().
+				SetName(mongoNameIndex).
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{{Key: "name_holder", Value: true}}),
+		},
+	})
+	if err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("create mongodb indexes: %w", err)
+	}
+	s := &mongoStore{albums: albums}
+	if err := s.indexAlbumNames(ctx); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("index album names: %w", err)
+	}
+	artists := client.Database(cfg.MongoDatabase).Collection("artists")
+	_, err = artists.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name_key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("create mongodb indexes: %w", err)
+	}
+	s.artists = artists
+	return s, nil
+}
+
+// indexAlbumNames gives the albums stored before name keys existed theirs, each as the holder
+// unless another album already holds it.
+func (s *mongoStore) indexAlbumNames(ctx context.Context) error {
+	cursor, err := s.albums.Find(ctx, bson.D{{Key: "name_key", Value: bson.D{{Key: "$exists", Value: false}}}})
+	if err != nil {
+		return err
+	}
+	var docs []mongoAlbum
+	if err := cursor.All(ctx, &docs); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		filter := bson.D{{Key: "_id", Value: doc.Key}, {Key: "name_key", Value: bson.D{{Key: "$exists", Value: false}}}}
+		key := albumNameKey(doc.Title, doc.Artist)
+		_, err := s.albums.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "name_key", Value: key}, {Key: "name_holder", Value: true}}}})
+		if duplicateKeyOn(err, mongoNameIndex) {
+			_, err = s.albums.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "name_key", Value: key}}}})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mongoError translates a duplicate key error on the UPC index into errUPCConflict.
+func mongoError(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return errUPCConflict
+	}
+	return err
+}
+
+// duplicateKeyOn reports whether err is a duplicate key error on the index named index.
+func duplicateKeyOn(err error, index string) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "index: "+index+" ")
+}
+
+// duplicateOf returns a duplicateAlbumError naming an album other than id with the name key key,
+// or nil if there is none.
+func (s *mongoStore) duplicateOf(ctx context.Context, key, id string) error {
+	doc, err := s.findOne(ctx, bson.D{{Key: "name_key", Value: key}, {Key: "_id", Value: bson.D{{Key: "$ne", Value: id}}}})
+	if errors.Is(err, errAlbumNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return duplicateAlbumError{ID: doc.ID}
+}
+
+// mongoUPCKey returns the normalized UPC stored in the unique upc_key field, or "" if there is none.
+func mongoUPCKey(a Album) string {
+	if a.UPC == "" {
+		return ""
+	}
+	return normalizeUPC(a.UPC)
+}
+
+// findOne decodes the single document matching filter. Returns errAlbumNotFound if there is none.
+func (s *mongoStore) findOne(ctx context.Context, filter any) (mongoAlbum, error) {
+	var doc mongoAlbum
+	err := s.albums.FindOne(ctx, filter).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return doc, errAlbumNotFound
+	}
+	return doc, err
+}
+
+// List returns every album in creation order.
+func (s *mongoStore) List(ctx context.Context) ([]Album, error) {
+	return s.find(ctx, bson.D{})
+}
+
+// Each calls fn with every album in creation order, decoding them from the cursor as it goes.
+func (s *mongoStore) Each(ctx context.Context, fn func(Album) error) error {
+	cursor, err := s.albums.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc mongoAlbum
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(doc.Album); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// Query returns the albums selected by f in creation order, filtering in MongoDB.
+func (s *mongoStore) Query(ctx context.Context, f albumFilter) ([]Album, error) {
+	filter := bson.D{}
+	if f.Artist != "" {
+		filter = append(filter, bson.E{Key: "artist", Value: bson.D{
+			{Key: "$regex", Value: regexp.QuoteMeta(f.Artist)},
+			{Key: "$options", Value: "i"},
+		}})
+	}
+	price := bson.D{}
+	if f.MinPrice != nil {
+		price = append(price, bson.E{Key: "$gte", Value: *f.MinPrice})
+	}
+	if f.MaxPrice != nil {
+		price = append(price, bson.E{Key: "$lte", Value: *f.MaxPrice})
+	}
+	if len(price) > 0 {
+		filter = append(filter, bson.E{Key: "price", Value: price})
+	}
+	return s.find(ctx, filter)
+}
+
+// find returns the albums matching filter in creation order.
+func (s *mongoStore) find(ctx context.Context, filter bson.D) ([]Album, error) {
+	cursor, err := s.albums.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []mongoAlbum
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	all := make([]Album, len(docs))
+	for i, doc := range docs {
+		all[i] = doc.Album
+	}
+	return all, nil
+}
+
+// Get returns the album with the given ID.
+func (s *mongoStore) Get(ctx context.Context, id string) (Album, error) {
+	doc, err := s.findOne(ctx, bson.D{{Key: "_id", Value: id}})
+	return doc.Album, err
+}
+
+// GetByUPC returns the album with the given barcode using the unique upc_key index.
+func (s *mongoStore) GetByUPC(ctx context.Context, code string) (Album, error) {
+	doc, err := s.findOne(ctx, bson.D{{Key: "upc_key", Value: normalizeUPC(code)}})
+	return doc.Album, err
+}
+
+// Create inserts a new album document, as the holder of its name key unless another album holds it.
+func (s *mongoStore) Create(ctx context.Context, a Album) (Album, error) {
+	return s.create(ctx, a, false)
+}
+
+// CreateUnique inserts a new album document as the holder of its name key, unless an album has it.
+func (s *mongoStore) CreateUnique(ctx context.Context, a Album) (Album, error) {
+	return s.create(ctx, a, true)
+}
+
+// create inserts a new album document, failing if an album has its name key if unique is set.
+func (s *mongoStore) create(ctx context.Context, a Album, unique bool) (Album, error) {
+	doc := mongoAlbum{Key: a.ID, Album: a, UPCKey: mongoUPCKey(a), NameKey: albumNameKey(a.Title, a.Artist), NameHolder: true, Version: 1, CreatedAt: time.Now().UTC()}
+	for attempt := 0; attempt < mongoMaxAttempts; attempt++ {
+		if unique {
+			if err := s.duplicateOf(ctx, doc.NameKey, a.ID); err != nil {
+				return Album{}, err
+			}
+		}
+		_, err := s.albums.InsertOne(ctx, doc)
+		if duplicateKeyOn(err, mongoNameIndex) {
+			// Another album holds the name key: a unique create finds it on the next attempt, and
+			// an allowed duplicate is stored without holding it.
+			doc.NameHolder = unique
+			continue
+		}
+		if err != nil {
+			return Album{}, mongoError(err)
+		}
+		return a, nil
+	}
+	return Album{}, errMongoConflict
+}
+
+// Update reads the album, applies mutate, and replaces the document on the condition that its
+// version has not changed, retrying if another writer got there first. If mutate changes the
+// album's name key, the album holds the new one unless another album does.
+func (s *mongoStore) Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, false)
+}
+
+// UpdateUnique updates the album like Update, unless mutate changes its name key to one an album
+// has.
+func (s *mongoStore) UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, true)
+}
+
+// update applies mutate to the album, failing if an album has its new name key if unique is set.
+func (s *mongoStore) update(ctx context.Context, id string, mutate func(*Album) error, unique bool) (Album, error) {
+	for attempt := 0; attempt < mongoMaxAttempts; attempt++ {
+		current, err := s.findOne(ctx, bson.D{{Key: "_id", Value: id}})
+		if err != nil {
+			return Album{}, err
+		}
+		updated := current
+		if err := mutate(&updated.Album); err != nil {
+			return Album{}, err
+		}
+		updated.ID = id
+		updated.UPCKey = mongoUPCKey(updated.Album)
+		updated.Version = current.Version + 1
+		if key := albumNameKey(updated.Title, updated.Artist); key != current.NameKey {
+			if unique {
+				if err := s.duplicateOf(ctx, key, id); err != nil {
+					return Album{}, err
+				}
+			}
+			updated.NameKey, updated.NameHolder = key, true
+		}
+
+		filter := bson.D{{Key: "_id", Value: id}, {Key: "version", Value: current.Version}}
+		result, err := s.albums.ReplaceOne(ctx, filter, updated)
+		if duplicateKeyOn(err, mongoNameIndex) {
+			if unique {
+				continue
+			}
+			updated.NameHolder = false
+			result, err = s.albums.ReplaceOne(ctx, filter, updated)
+		}
+		if err != nil {
+			return Album{}, mongoError(err)
+		}
+		if result.MatchedCount == 1 {
+			return updated.Album, nil
+		}
+	}
+	return Album{}, errMongoConflict
+}
+
+// Delete removes the album document and returns the album.
+func (s *mongoStore) Delete(ctx context.Context, id string) (Album, error) {
+	var doc mongoAlbum
+	err := s.albums.FindOneAndDelete(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Album{}, errAlbumNotFound
+	}
+	return doc.Album, err
+}
+
+// findArtist decodes the single artist matching filter. Returns errArtistNotFound if there is none.
+func (s *mongoStore) findArtist(ctx context.Context, filter any) (Artist, error) {
+	var doc mongoArtist
+	err := s.artists.FindOne(ctx, filter).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Artist{}, errArtistNotFound
+	}
+	return doc.Artist, err
+}
+
+// ListArtists returns every artist.
+func (s *mongoStore) ListArtists(ctx context.Context) ([]Artist, error) {
+	cursor, err := s.artists.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	var docs []mongoArtist
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	artists := make([]Artist, len(docs))
+	for i, doc := range docs {
+		artists[i] = doc.Artist
+	}
+	return artists, nil
+}
+
+// GetArtist returns the artist with the given ID.
+func (s *mongoStore) GetArtist(ctx context.Context, id string) (Artist, error) {
+	return s.findArtist(ctx, bson.D{{Key: "_id", Value: id}})
+}
+
+// ArtistNamed returns the artist with the given name, ignoring case, using the name_key index.
+func (s *mongoStore) ArtistNamed(ctx context.Context, name string) (Artist, error) {
+	return s.findArtist(ctx, bson.D{{Key: "name_key", Value: artistKey(name)}})
+}
+
+// CreateArtist inserts a new artist document, relying on the unique _id and name_key indexes to
+// reject one whose ID or name is taken.
+func (s *mongoStore) CreateArtist(ctx context.Context, artist Artist) error {
+	_, err := s.artists.InsertOne(ctx, mongoArtist{Key: artist.ID, Artist: artist, NameKey: artistKey(artist.Name)})
+	return s.artistError(ctx, artist, err)
+}
+
+// artistError translates a duplicate key error from writing artist into an artistExistsError
+// naming the artist with its name, or else artist itself.
+func (s *mongoStore) artistError(ctx context.Context, artist Artist, err error) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	if other, err := s.ArtistNamed(ctx, artist.Name); err == nil && other.ID != artist.ID {
+		return artistExistsError{other.ID}
+	}
+	return artistExistsError{artist.ID}
+}
+
+// creditedAlbums returns the stored albums credited to the artist with the given ID.
+func (s *mongoStore) creditedAlbums(ctx context.Context, id string) ([]mongoAlbum, error) {
+	cursor, err := s.albums.Find(ctx, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "artist_id", Value: id}},
+		bson.D{{Key: "artist_id", Value: bson.D{{Key: "$in", Value: bson.A{nil, ""}}}}},
+	}}}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []mongoAlbum
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	credited := docs[:0]
+	for _, doc := range docs {
+		if albumArtistID(doc.Album) == id {
+			credited = append(credited, doc)
+		}
+	}
+	return credited, nil
+}
+
+// inTransaction runs fn in a transaction, which the driver retries on transient errors such as
+// write conflicts.
+func (s *mongoStore) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := s.albums.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+// RenameArtist replaces the artist document and its albums' documents in one transaction, each
+// album on the condition that its version has not changed since it was read.
+func (s *mongoStore) RenameArtist(ctx context.Context, id, name string, rename func(*Album)) (Artist, []albumChange, error) {
+	var (
+		artist  Artist
+		changes []albumChange
+	)
+	err := s.inTransaction(ctx, func(ctx context.Context) error {
+		current, err := s.GetArtist(ctx, id)
+		if err != nil {
+			return err
+		}
+		artist = renamedArtist(current, name, time.Now().UTC())
+		if _, err := s.artists.ReplaceOne(ctx, bson.D{{Key: "_id", Value: id}},
+			mongoArtist{Key: id, Artist: artist, NameKey: artistKey(artist.Name)}); err != nil {
+			return s.artistError(ctx, artist, err)
+		}
+
+		docs, err := s.creditedAlbums(ctx, id)
+		if err != nil {
+			return err
+		}
+		changes = make([]albumChange, 0, len(docs))
+		for _, current := range docs {
+			updated := current
+			rename(&updated.Album)
+			updated.ID = current.ID
+			updated.Version = current.Version + 1
+			// Renamed albums give up holding their name key, as two holders of the new one would
+			// abort the transaction; a unique write still finds them by it.
+			if key := albumNameKey(updated.Title, updated.Artist); key != current.NameKey {
+				updated.NameKey, updated.NameHolder = key, false
+			}
+			result, err := s.albums.ReplaceOne(ctx,
+				bson.D{{Key: "_id", Value: current.ID}, {Key: "version", Value: current.Version}}, updated)
+			if err != nil {
+				return mongoError(err)
+			}
+			if result.MatchedCount != 1 {
+				return errMongoConflict
+			}
+			changes = append(changes, albumChange{Album: updated.Album, Previous: current.Album})
+		}
+		return nil
+	})
+	if err != nil {
+		return Artist{}, nil, err
+	}
+	return artist, changes, nil
+}
+
+// DeleteArtist checks that no album is credited to the artist and deletes its document in one
+// transaction.
+func (s *mongoStore) DeleteArtist(ctx context.Context, id string) (Artist, error) {
+	var artist Artist
+	err := s.inTransaction(ctx, func(ctx context.Context) error {
+		var doc mongoArtist
+		err := s.artists.FindOneAndDelete(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&doc)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return errArtistNotFound
+		}
+		if err != nil {
+			return err
+		}
+		artist = doc.Artist
+		docs, err := s.creditedAlbums(ctx, id)
+		if err == nil && len(docs) > 0 {
+			err = errArtistHasAlbums
+		}
+		return err
+	})
+	if err != nil {
+		return Artist{}, err
+	}
+	return artist, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// TestMongoDocumentEncoding tests the MongoDB document encoding.
+// Verifies that album fields are stored under their JSON names next to _id, upc_key, and name_key,
+// and that the document decodes back to the same album.
+func TestMongoDocumentEncoding(t *testing.T) {
+	in := mongoAlbum{
+		Key:        "a",
+		Album:      Album{ID: "a", Title: "Kind of Blue", Artist: "Miles Davis", Price: 49.99, UPC: "074646593622"},
+		UPCKey:     "0074646593622",
+		NameKey:    albumNameKey("Kind of Blue", "Miles Davis"),
+		NameHolder: true,
+		Version:    2,
+		CreatedAt:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	var buf bytes.Buffer
+	enc := bson.NewEncoder(bson.NewDocumentWriter(&buf))
+	enc.UseJSONStructTags()
+	if err := enc.Encode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	var fields bson.M
+	if err := bson.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"_id", "title", "artist", "price", "upc", "upc_key", "name_key", "name_holder", "version", "created_at"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("Expected field %q, got %v", name, fields)
+		}
+	}
+
+	dec := bson.NewDecoder(bson.NewDocumentReader(bytes.NewReader(buf.Bytes())))
+	dec.UseJSONStructTags()
+	var out mongoAlbum
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Expected %+v, got %+v", in, out)
+	}
+}
+
+// TestMongoStore tests the MongoDB AlbumStore against a real server, using a temporary database.
+// It is skipped unless MONGODB_TEST_URI is set (e.g. mongodb://localhost:27017), which must be a
+// replica set, as artists are renamed and deleted in transactions.
+func TestMongoStore(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+
+	cfg := loadConfig()
+	cfg.MongoURI = uri
+	cfg.MongoDatabase = fmt.Sprintf("albums_test_%d", time.Now().UnixNano())
+	s, err := newMongoStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.(*mongoStore).albums.Database().Drop(context.Background())
+
+	testAlbumStore(t, s)
+	testUniqueAlbumNames(t, s)
+	testArtistStore(t, s)
+}
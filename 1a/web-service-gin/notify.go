@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notificationConfig is the notification settings file named by NOTIFICATIONS_CONFIG.
+//
+// Example:
+//
+//	{
+//	  "sinks": {
+//	    "team-slack": {"type": "slack", "webhook_url": "https://hooks.slack.com/services/..."},
+//	    "ops-email": {"type": "smtp", "addr": "smtp.example.com:587", "from": "albums@example.com",
+//	                  "to": ["ops@example.com"], "username": "albums", "password": "secret"}
+//	  },
+//	  "rules": [
+//	    {"name": "cheap-albums", "event": "price_below", "threshold": 10, "sinks": ["team-slack"]},
+//	    {"name": "deletions", "event": "album_deleted", "sinks": ["ops-email"], "max_per_minute": 5,
+//	     "subject": "Removed: {{.Album.Title}}"}
+//	  ]
+//	}
+type notificationConfig struct {
+	Sinks map[string]sinkConfig `json:"sinks"`
+	Rules []notificationRule    `json:"rules"`
+}
+
+// sinkConfig configures one notification destination. Which fields apply depends on Type.
+type sinkConfig struct {
+	Type string `json:"type"`
+
+	// SMTP settings. Username and Password are optional; when set, PLAIN auth is used.
+	Addr     string   `json:"addr"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+
+	// Slack incoming webhook settings.
+	WebhookURL string `json:"webhook_url"`
+}
+
+// notificationRule sends a notification to Sinks whenever an album event matches Event.
+// Subject and Body are text/template strings rendered with a notificationData; each event
+// type has a default. MaxPerMinute limits how many notifications the rule sends (0 means unlimited).
+type notificationRule struct {
+	Name         string   `json:"name"`
+	Event        string   `json:"event"`
+	Threshold    float64  `json:"threshold"`
+	Sinks        []string `json:"sinks"`
+	Subject      string   `json:"subject"`
+	Body         string   `json:"body"`
+	MaxPerMinute int      `json:"max_per_minute"`
+}
+
+// notificationData is the value templates are rendered with.
+type notificationData struct {
+	Rule      string
+	Event     string
+	Album     Album
+	Previous  *Album
+	Threshold float64
+	At        time.Time
+}
+
+// notificationEvent describes a rule event type: which album events match it and its default templates.
+type notificationEvent struct {
+	matches func(rule notificationRule, evt albumEvent) bool
+	subject string
+	body    string
+}
+
+// notificationEvents are the event types a rule may subscribe to.
+var notificationEvents = map[string]notificationEvent{
+	// price_below fires when an update moves the price from at or above Threshold to below it.
+	"price_below": {
+		matches: func(rule notificationRule, evt albumEvent) bool {
+			return evt.Type == eventAlbumUpdated && evt.Previous != nil &&
+				evt.Previous.Price >= rule.Threshold && evt.Album.Price < rule.Threshold
+		},
+		subject: `Price drop: {{.Album.Title}} by {{.Album.Artist}}`,
+		body:    `{{.Album.Title}} by {{.Album.Artist}} dropped from ${{printf "%.2f" .Previous.Price}} to ${{printf "%.2f" .Album.Price}}, below ${{printf "%.2f" .Threshold}}.`,
+	},
+	"album_deleted": {
+		matches: func(rule notificationRule, evt albumEvent) bool {
+			return evt.Type == eventAlbumDeleted
+		},
+		subject: `Album deleted: {{.Album.Title}}`,
+		body:    `{{.Album.Title}} by {{.Album.Artist}} ({{.Album.ID}}) was deleted.`,
+	},
+}
+
+// notificationSink delivers a rendered notification to one destination.
+type notificationSink interface {
+	send(ctx context.Context, subject, body string) error
+}
+
+// sinkTypes creates sinks by their configured type.
+var sinkTypes = map[string]func(sc sinkConfig, cfg Config, outbound *outboundRegistry) (notificationSink, error){
+	"smtp":  newSMTPSink,
+	"slack": newSlackSink,
+}
+
+// smtpSink sends notifications as plain-text email.
+type smtpSink struct {
+	addr string
+	from string
+	to   []string
+	auth smtp.Auth
+}
+
+// newSMTPSink creates an SMTP sink, checking that the server and addresses are set.
+func newSMTPSink(sc sinkConfig, cfg Config, outbound *outboundRegistry) (notificationSink, error) {
+	if sc.Addr == "" || sc.From == "" || len(sc.To) == 0 {
+		return nil, fmt.Errorf("smtp sink requires addr, from, and to")
+	}
+	sink := &smtpSink{addr: sc.Addr, from: sc.From, to: sc.To}
+	if sc.Username != "" {
+		host, _, _ := strings.Cut(sc.Addr, ":")
+		sink.auth = smtp.PlainAuth("", sc.Username, sc.Password, host)
+	}
+	return sink, nil
+}
+
+// send delivers the message with net/smtp, which does not support cancellation; ctx is ignored.
+func (s *smtpSink) send(ctx context.Context, subject, body string) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		s.from, strings.Join(s.to, ", "), subject, body)
+	return smtp.SendMail(s.addr, s.auth, s.from, s.to, []byte(msg))
+}
+
+// slackSink posts notifications to a Slack incoming webhook.
+type slackSink struct {
+	webhookURL string
+	client     *outboundClient
+}
+
+// newSlackSink creates a Slack sink that posts through an outbound client registered in outbound.
+func newSlackSink(sc sinkConfig, cfg Config, outbound *outboundRegistry) (notificationSink, error) {
+	if sc.WebhookURL == "" {
+		return nil, fmt.Errorf("slack sink requires webhook_url")
+	}
+	return &slackSink{webhookURL: sc.WebhookURL, client: outbound.newClient("slack", cfg)}, nil
+}
+
+// send posts the subject in bold followed by the body.
+func (s *slackSink) send(ctx context.Context, subject, body string) error {
+	payload, err := json.Marshal(map[string]string{"text": "*" + subject + "*\n" + body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// rateLimiter is a token bucket allowing up to perMinute events per minute, with bursts of the same size.
+type rateLimiter struct {
+	mu        sync.Mutex
+	perMinute float64
+	tokens    float64
+	last      time.Time
+	now       func() time.Time
+}
+
+// newRateLimiter creates a limiter with a full bucket.
+// Returns nil, which allows everything, if perMinute is not positive.
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{perMinute: float64(perMinute), tokens: float64(perMinute), last: time.Now(), now: time.Now}
+}
+
+// allow takes a token from the bucket, reporting false if none is available.
+func (l *rateLimiter) allow() bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.tokens = min(l.perMinute, l.tokens+now.Sub(l.last).Minutes()*l.perMinute)
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// activeRule is a validated rule with its compiled templates, resolved sinks, and delivery counters.
+type activeRule struct {
+	notificationRule
+	event   notificationEvent
+	subject *template.Template
+	body    *template.Template
+	sinks   []notificationSink
+	limiter *rateLimiter
+
+	sent        atomic.Int64
+	failed      atomic.Int64
+	rateLimited atomic.Int64
+}
+
+// notification is a rendered message waiting to be delivered.
+type notification struct {
+	rule    *activeRule
+	subject string
+	body    string
+}
+
+// notificationQueueSize bounds the notifications waiting for delivery. Notifications arriving
+// while the queue is full are dropped and counted as failed.
+const notificationQueueSize = 256
+
+// notificationSendTimeout bounds a single delivery attempt to one sink.
+const notificationSendTimeout = 30 * time.Second
+
+// notifier evaluates album events against the configured rules and delivers matching
+// notifications in the background so handlers never wait on email or webhooks.
+type notifier struct {
+	rules []*activeRule
+	queue chan notification
+}
+
+// loadNotificationConfig reads a notification settings file.
+func loadNotificationConfig(path string) (notificationConfig, error) {
+	var nc notificationConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nc, err
+	}
+	if err := json.Unmarshal(data, &nc); err != nil {
+		return nc, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nc, nil
+}
+
+// newNotifier validates nc, creates its sinks, and starts the delivery goroutine.
+// Outbound clients used by the sinks are registered in outbound.
+func newNotifier(nc notificationConfig, cfg Config, outbound *outboundRegistry) (*notifier, error) {
+	sinks := map[string]notificationSink{}
+	for name, sc := range nc.Sinks {
+		factory, ok := sinkTypes[sc.Type]
+		if !ok {
+			return nil, fmt.Errorf("sink %q: unknown type %q", name, sc.Type)
+		}
+		sink, err := factory(sc, cfg, outbound)
+		if err != nil {
+			return nil, fmt.Errorf("sink %q: %w", name, err)
+		}
+		sinks[name] = sink
+	}
+
+	n := &notifier{queue: make(chan notification, notificationQueueSize)}
+	for i, rule := range nc.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		event, ok := notificationEvents[rule.Event]
+		if !ok {
+			return nil, fmt.Errorf("rule %q: unknown event %q", rule.Name, rule.Event)
+		}
+		if rule.Event == "price_below" && rule.Threshold <= 0 {
+			return nil, fmt.Errorf("rule %q: price_below requires a positive threshold", rule.Name)
+		}
+		if len(rule.Sinks) == 0 {
+			return nil, fmt.Errorf("rule %q: no sinks", rule.Name)
+		}
+
+		active := &activeRule{notificationRule: rule, event: event, limiter: newRateLimiter(rule.MaxPerMinute)}
+		for _, name := range rule.Sinks {
+			sink, ok := sinks[name]
+			if !ok {
+				return nil, fmt.Errorf("rule %q: unknown sink %q", rule.Name, name)
+			}
+			active.sinks = append(active.sinks, sink)
+		}
+
+		var err error
+		if active.subject, err = parseNotificationTemplate(rule.Subject, event.subject); err != nil {
+			return nil, fmt.Errorf("rule %q subject: %w", rule.Name, err)
+		}
+		if active.body, err = parseNotificationTemplate(rule.Body, event.body); err != nil {
+			return nil, fmt.Errorf("rule %q body: %w", rule.Name, err)
+		}
+		n.rules = append(n.rules, active)
+	}
+
+	go n.deliver()
+	return n, nil
+}
+
+// parseNotificationTemplate parses text, or fallback if text is empty.
+func parseNotificationTemplate(text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	return template.New("").Option("missingkey=error").Parse(text)
+}
+
+// handle is the album event subscriber. It renders a notification for every matching rule
+// that is within its rate limit and queues it for delivery.
+func (n *notifier) handle(evt albumEvent) {
+	for _, rule := range n.rules {
+		if !rule.event.matches(rule.notificationRule, evt) {
+			continue
+		}
+		if !rule.limiter.allow() {
+			rule.rateLimited.Add(1)
+			continue
+		}
+
+		data := notificationData{
+			Rule:      rule.Name,
+			Event:     rule.Event,
+			Album:     evt.Album,
+			Previous:  evt.Previous,
+			Threshold: rule.Threshold,
+			At:        evt.At,
+		}
+		var subject, body strings.Builder
+		if err := rule.subject.Execute(&subject, data); err != nil {
+			log.Printf("notification rule %s: render subject: %v", rule.Name, err)
+			rule.failed.Add(1)
+			continue
+		}
+		if err := rule.body.Execute(&body, data); err != nil {
+			log.Printf("notification rule %s: render body: %v", rule.Name, err)
+			rule.failed.Add(1)
+			continue
+		}
+
+		select {
+		case n.queue <- notification{rule: rule, subject: subject.String(), body: body.String()}:
+		default:
+			log.Printf("notification rule %s: queue full, dropping notification", rule.Name)
+			rule.failed.Add(1)
+		}
+	}
+}
+
+// deliver sends queued notifications to each of their rule's sinks.
+func (n *notifier) deliver() {
+	for msg := range n.queue {
+		for _, sink := range msg.rule.sinks {
+			ctx, cancel := context.WithTimeout(context.Background(), notificationSendTimeout)
+			err := sink.send(ctx, msg.subject, msg.body)
+			cancel()
+			if err != nil {
+				log.Printf("notification rule %s: %v", msg.rule.Name, err)
+				msg.rule.failed.Add(1)
+				continue
+			}
+			msg.rule.sent.Add(1)
+		}
+	}
+}
+
+// getNotifications handles GET /admin/notifications requests.
+// Returns each notification rule with its sent, failed, and rate-limited counts as JSON with HTTP 200 status.
+// Returns 404 Not Found if notifications are not configured.
+func (srv *Server) getNotifications(c *gin.Context) {
+	if srv.notifications == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Notifications are disabled; set NOTIFICATIONS_CONFIG to enable them"})
+		return
+	}
+
+	rules := make([]gin.H, 0, len(srv.notifications.rules))
+	for _, rule := range srv.notifications.rules {
+		rules = append(rules, gin.H{
+			"name":         rule.Name,
+			"event":        rule.Event,
+			"sinks":        rule.Sinks,
+			"sent":         rule.sent.Load(),
+			"failed":       rule.failed.Load(),
+			"rate_limited": rule.rateLimited.Load(),
+		})
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"rules": rules})
+}
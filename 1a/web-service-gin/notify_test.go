@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestNotifications tests price-drop and deletion notifications delivered to a Slack webhook.
+// Verifies that matching events are rendered with the default and custom templates, that
+// non-matching updates are ignored, and that the rule rate limit suppresses extra notifications.
+func TestNotifications(t *testing.T) {
+	srv := newTestServer(t)
+	var mu sync.Mutex
+	var messages []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		messages = append(messages, body.Text)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	n, err := newNotifier(notificationConfig{
+		Sinks: map[string]sinkConfig{"slack": {Type: "slack", WebhookURL: webhook.URL}},
+		Rules: []notificationRule{
+			{Name: "cheap", Event: "price_below", Threshold: 20, Sinks: []string{"slack"}},
+			{Name: "deleted", Event: "album_deleted", Sinks: []string{"slack"}, MaxPerMinute: 1,
+				Subject: "Gone: {{.Album.Title}}"},
+		},
+	}, loadConfig(), srv.outbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.notifications = n
+	srv.subscribers = append(srv.subscribers, n.handle)
+
+	send := func(method, path, body string) {
+		srv.do(method, path, body, "If-Match", "*")
+	}
+
+	send("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", `{"price": 15.99}`)
+	send("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", `{"price": 12.99}`)
+	send("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440002", "")
+	send("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440003", "")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		got := len(messages)
+		mu.Unlock()
+		if got >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 notifications, got %d: %q", len(messages), messages)
+	}
+	if !strings.Contains(messages[0], "Price drop: Blue Train") || !strings.Contains(messages[0], "$56.99 to $15.99") {
+		t.Errorf("Unexpected price drop notification: %q", messages[0])
+	}
+	if !strings.HasPrefix(messages[1], "*Gone: Jeru*") {
+		t.Errorf("Unexpected deletion notification: %q", messages[1])
+	}
+
+	w := srv.do("GET", "/admin/notifications", "")
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	var stats struct {
+		Rules []struct {
+			Name        string `json:"name"`
+			Sent        int    `json:"sent"`
+			RateLimited int    `json:"rate_limited"`
+		} `json:"rules"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if len(stats.Rules) != 2 || stats.Rules[1].RateLimited != 1 {
+		t.Errorf("Expected the deletion rule to rate limit 1 notification, got %+v", stats.Rules)
+	}
+}
+
+// TestNotifierConfigValidation tests newNotifier with invalid configurations.
+// Verifies that unknown events and sinks, missing thresholds, and bad templates are rejected.
+func TestNotifierConfigValidation(t *testing.T) {
+	sinks := map[string]sinkConfig{"slack": {Type: "slack", WebhookURL: "http://example.com"}}
+	tests := []struct {
+		name string
+		nc   notificationConfig
+	}{
+		{"unknown event", notificationConfig{Sinks: sinks, Rules: []notificationRule{{Event: "price_up", Sinks: []string{"slack"}}}}},
+		{"unknown sink", notificationConfig{Sinks: sinks, Rules: []notificationRule{{Event: "album_deleted", Sinks: []string{"email"}}}}},
+		{"missing threshold", notificationConfig{Sinks: sinks, Rules: []notificationRule{{Event: "price_below", Sinks: []string{"slack"}}}}},
+		{"bad template", notificationConfig{Sinks: sinks, Rules: []notificationRule{{Event: "album_deleted", Sinks: []string{"slack"}, Body: "{{.Album"}}}},
+		{"unknown sink type", notificationConfig{Sinks: map[string]sinkConfig{"x": {Type: "pager"}}}},
+		{"incomplete smtp", notificationConfig{Sinks: map[string]sinkConfig{"mail": {Type: "smtp", Addr: "localhost:25"}}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := newNotifier(tt.nc, loadConfig(), nil); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errCircuitOpen is returned by outboundClient.Do while the circuit breaker is open.
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// outboundClient is the shared HTTP client for calls to third-party services such as
+// enrichment providers and webhooks. It applies a per-request timeout, retries transient
+// failures with exponential backoff and full jitter, counts outcomes, and stops calling
+// a provider that keeps failing via a circuit breaker.
+type outboundClient struct {
+	name       string
+	client     *http.Client
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	breaker    *circuitBreaker
+
+	requests atomic.Int64
+	retries  atomic.Int64
+	failures atomic.Int64
+	rejected atomic.Int64
+}
+
+// newOutboundClient creates an outbound client named after the service it calls.
+func newOutboundClient(name string, cfg Config) *outboundClient {
+	return &outboundClient{
+		name:       name,
+		client:     &http.Client{Timeout: cfg.OutboundTimeout},
+		maxRetries: cfg.OutboundMaxRetries,
+		baseDelay:  100 * time.Millisecond,
+		maxDelay:   5 * time.Second,
+		breaker:    newCircuitBreaker(cfg.OutboundBreakerThreshold, cfg.OutboundBreakerCooldown),
+	}
+}
+
+// outboundRegistry holds a server's outbound clients so their counters appear at /metrics/outbound.
+type outboundRegistry struct {
+	mu      sync.Mutex
+	clients []*outboundClient
+}
+
+// newClient creates an outbound client and registers it. A nil registry creates an unregistered client.
+func (r *outboundRegistry) newClient(name string, cfg Config) *outboundClient {
+	o := newOutboundClient(name, cfg)
+	if r != nil {
+		r.mu.Lock()
+		r.clients = append(r.clients, o)
+		r.mu.Unlock()
+	}
+	return o
+}
+
+// stats returns the counters of every registered client.
+func (r *outboundRegistry) stats() []map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make([]map[string]any, 0, len(r.clients))
+	for _, o := range r.clients {
+		stats = append(stats, o.stats())
+	}
+	return stats
+}
+
+// Do sends req, retrying network errors, HTTP 429, and HTTP 5xx responses up to maxRetries times.
+// Requests with a body are only retried if the body can be replayed (req.GetBody is set).
+// Returns errCircuitOpen without sending anything while the provider is considered down. Every call
+// let through records its outcome with the breaker, however it ends, so a half-open breaker's trial
+// call always closes or reopens it.
+func (o *outboundClient) Do(req *http.Request) (*http.Response, error) {
+	if !o.breaker.allow() {
+		o.rejected.Add(1)
+		return nil, fmt.Errorf("%s: %w", o.name, errCircuitOpen)
+	}
+
+	for attempt := 0; ; attempt++ {
+		o.requests.Add(1)
+		resp, err := o.client.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			o.breaker.record(resp.StatusCode < 500)
+			return resp, nil
+		}
+
+		canRetry := attempt < o.maxRetries && (req.Body == nil || req.GetBody != nil) && req.Context().Err() == nil
+		if !canRetry {
+			o.failures.Add(1)
+			o.breaker.record(false)
+			return resp, err
+		}
+
+		delay := o.backoff(attempt)
+		if resp != nil {
+			if after := retryAfter(resp); after > 0 {
+				delay = min(after, o.maxDelay)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				o.failures.Add(1)
+				o.breaker.record(false)
+				return nil, err
+			}
+		}
+
+		o.retries.Add(1)
+		if err := sleepContext(req.Context(), delay); err != nil {
+			o.failures.Add(1)
+			o.breaker.record(false)
+			return nil, err
+		}
+	}
+}
+
+// backoff returns the delay before retry number attempt, using exponential backoff with full jitter.
+func (o *outboundClient) backoff(attempt int) time.Duration {
+	ceiling := min(o.baseDelay<<attempt, o.maxDelay)
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling)
+}
+
+// stats returns a JSON-friendly snapshot of the client's counters and breaker state.
+func (o *outboundClient) stats() map[string]any {
+	return map[string]any{
+		"name":     o.name,
+		"requests": o.requests.Load(),
+		"retries":  o.retries.Load(),
+		"failures": o.failures.Load(),
+		"rejected": o.rejected.Load(),
+		"circuit":  o.breaker.state(),
+	}
+}
+
+// retryableStatus reports whether an HTTP status indicates a transient failure worth retrying.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusBadGateway ||
+		code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// retryAfter parses a Retry-After header given in seconds. Returns 0 if absent or not in seconds.
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// circuitBreaker opens after threshold consecutive failures and rejects calls for cooldown.
+// Once the cooldown elapses, a single trial call is let through (half-open); its outcome
+// either closes the breaker or opens it for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// newCircuitBreaker creates a closed breaker. A threshold of 0 disables it.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may proceed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record updates the breaker with the outcome of a call.
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// state returns "closed", "open", or "half-open".
+func (b *circuitBreaker) state() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.threshold <= 0 || b.failures < b.threshold:
+		return "closed"
+	case b.trial || time.Since(b.openedAt) >= b.cooldown:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
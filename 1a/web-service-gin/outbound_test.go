@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testOutboundConfig returns a Config with fast outbound settings for tests.
+func testOutboundConfig() Config {
+	return Config{
+		OutboundTimeout:          time.Second,
+		OutboundMaxRetries:       2,
+		OutboundBreakerThreshold: 2,
+		OutboundBreakerCooldown:  time.Minute,
+	}
+}
+
+// TestOutboundClientRetries tests that transient failures are retried.
+// Verifies that two 503 responses followed by a 200 produce a successful response after two retries.
+func TestOutboundClientRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := newOutboundClient("test", testOutboundConfig())
+	client.baseDelay = time.Millisecond
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+	if client.retries.Load() != 2 {
+		t.Errorf("Expected 2 retries, got %d", client.retries.Load())
+	}
+}
+
+// TestOutboundClientCircuitBreaker tests that repeated failures open the circuit.
+// Verifies that after the failure threshold is reached, calls are rejected without reaching the server.
+func TestOutboundClientCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := newOutboundClient("test", testOutboundConfig())
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("Expected errCircuitOpen, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 calls to reach the server, got %d", calls.Load())
+	}
+	if client.breaker.state() != "open" {
+		t.Errorf("Expected 'open', got '%s'", client.breaker.state())
+	}
+}
+
+// TestOutboundClientHalfOpenTrialCancelled tests that a half-open trial call ends the trial however
+// it ends. Verifies that when the trial fails and its context is cancelled during the backoff, the
+// breaker reopens rather than rejecting every call for good, and lets another trial through after
+// the next cooldown.
+func TestOutboundClientHalfOpenTrialCancelled(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newOutboundClient("test", testOutboundConfig())
+	client.baseDelay = time.Hour
+	client.maxDelay = time.Hour
+	client.breaker.failures = client.breaker.threshold
+	client.breaker.openedAt = time.Now().Add(-2 * time.Minute)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	go func() {
+		for calls.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if _, err := client.Do(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the trial to end with context.Canceled, got %v", err)
+	}
+	if client.breaker.trial || client.breaker.state() != "open" {
+		t.Errorf("Expected the failed trial to reopen the breaker, got %q (trial %v)", client.breaker.state(), client.breaker.trial)
+	}
+	if client.failures.Load() != 1 {
+		t.Errorf("Expected the trial to count as a failure, got %d", client.failures.Load())
+	}
+
+	client.breaker.openedAt = time.Now().Add(-2 * time.Minute)
+	if !client.breaker.allow() {
+		t.Error("Expected another trial to be let through after the cooldown")
+	}
+}
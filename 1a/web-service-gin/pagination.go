@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// totalCountHeader carries the number of items in a paged collection, across all pages.
+const totalCountHeader = "X-Total-Count"
+
+// parsePage reads the limit and offset query parameters. limit defaults to defaultLimit, and
+// explicit is true when either parameter is set. Returns an error message if either is not a
+// valid integer, limit is not between 1 and maxLimit, or offset is negative.
+func parsePage(c *gin.Context, defaultLimit, maxLimit int) (offset, limit int, explicit bool, errMsg string) {
+	limitParam, hasLimit := c.GetQuery("limit")
+	offsetParam, hasOffset := c.GetQuery("offset")
+	limit = min(defaultLimit, maxLimit)
+
+	if hasLimit {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil || n <= 0 || n > maxLimit {
+			return 0, 0, true, fmt.Sprintf("limit must be an integer between 1 and %d", maxLimit)
+		}
+		limit = n
+	}
+	if hasOffset {
+		n, err := strconv.Atoi(offsetParam)
+		if err != nil || n < 0 {
+			return 0, 0, true, "offset must be a non-negative integer"
+		}
+		offset = n
+	}
+	return offset, limit, hasLimit || hasOffset, ""
+}
+
+// pageOf returns the items of all within the page at offset of at most limit items.
+// A limit of 0 means no limit.
+func pageOf[T any](all []T, offset, limit int) []T {
+	if offset >= len(all) {
+		return []T{}
+	}
+	end := len(all)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return all[offset:end]
+}
+
+// setPageLinks sets an RFC 8288 Link header with first, prev, next, and last relations for the
+// page at offset of at most limit items out of total. Each link is the request URL with only
+// offset and limit changed, so filters and other parameters carry over. prev and next are left
+// out on the first and last pages.
+func setPageLinks(c *gin.Context, offset, limit, total int) {
+	if limit <= 0 {
+		return
+	}
+
+	link := func(rel string, offset int) string {
+		query := c.Request.URL.Query()
+		query.Set("offset", strconv.Itoa(offset))
+		query.Set("limit", strconv.Itoa(limit))
+		u := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+	}
+
+	last := 0
+	if total > 0 {
+		last = (total - 1) / limit * limit
+	}
+
+	links := []string{link("first", 0)}
+	if offset > 0 {
+		links = append(links, link("prev", max(offset-limit, 0)))
+	}
+	if offset+limit < total {
+		links = append(links, link("next", offset+limit))
+	}
+	links = append(links, link("last", last))
+	c.Header("Link", strings.Join(links, ", "))
+}
+
+// pageToken is the position encoded in an opaque page_token: the ID of the last album returned
+// and how many albums had been returned, plus the query the listing was made with.
+type pageToken struct {
+	After  string `json:"a"`
+	Offset int    `json:"o"`
+	Query  string `json:"q"`
+}
+
+// encode returns the token as URL-safe base64 JSON.
+func (t pageToken) encode() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// listingQuery returns the request's query parameters other than paging ones and fields, which do
+// not change which albums are listed, in a canonical form. A page token is only valid for the
+// listing with the same query.
+func listingQuery(c *gin.Context) string {
+	query := c.Request.URL.Query()
+	for _, name := range []string{"page_token", "page_size", "limit", "offset", "fields"} {
+		query.Del(name)
+	}
+	return query.Encode()
+}
+
+// parseCursor reads the page_token and page_size query parameters. cursor is false when neither
+// is set. page_size defaults to defaultSize. Returns an error message if the token is malformed or
+// belongs to a different query, page_size is not between 1 and maxSize, or limit or offset is
+// also given.
+func parseCursor(c *gin.Context, defaultSize, maxSize int) (token pageToken, size int, cursor bool, errMsg string) {
+	tokenParam, hasToken := c.GetQuery("page_token")
+	sizeParam, hasSize := c.GetQuery("page_size")
+	if !hasToken && !hasSize {
+		return pageToken{}, 0, false, ""
+	}
+	if _, ok := c.GetQuery("limit"); ok {
+		return pageToken{}, 0, true, "use either limit and offset or page_token and page_size"
+	}
+	if _, ok := c.GetQuery("offset"); ok {
+		return pageToken{}, 0, true, "use either limit and offset or page_token and page_size"
+	}
+
+	size = min(defaultSize, maxSize)
+	if hasSize {
+		n, err := strconv.Atoi(sizeParam)
+		if err != nil || n <= 0 || n > maxSize {
+			return pageToken{}, 0, true, fmt.Sprintf("page_size must be an integer between 1 and %d", maxSize)
+		}
+		size = n
+	}
+	token.Query = listingQuery(c)
+	if tokenParam != "" {
+		data, err := base64.RawURLEncoding.DecodeString(tokenParam)
+		var decoded pageToken
+		if err != nil || json.Unmarshal(data, &decoded) != nil || decoded.Offset < 0 {
+			return pageToken{}, 0, true, "page_token is invalid"
+		}
+		if decoded.Query != token.Query {
+			return pageToken{}, 0, true, "page_token was issued for a different query"
+		}
+		token = decoded
+	}
+	return token, size, true, ""
+}
+
+// cursorPage returns the page of at most size albums following token in all, and the token for
+// the page after it, or "" if this is the last page. The page resumes after the album the token
+// names, so albums added or deleted meanwhile do not shift it. If that album was itself deleted,
+// the page starts where it stood.
+func cursorPage(all []Album, token pageToken, size int) (page []Album, next string) {
+	start := min(max(token.Offset-1, 0), len(all))
+	if token.After != "" {
+		if i := slices.IndexFunc(all, func(a Album) bool { return a.ID == token.After }); i >= 0 {
+			start = i + 1
+		}
+	}
+	page = pageOf(all, start, size)
+	if start+len(page) >= len(all) || len(page) == 0 {
+		return page, ""
+	}
+	return page, pageToken{
+		After:  page[len(page)-1].ID,
+		Offset: start + len(page),
+		Query:  token.Query,
+	}.encode()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestAlbumPageLinks tests GET /albums with limit and offset.
+// Verifies that only the requested page is returned, that the Link header carries first, prev,
+// next, and last relations (omitting prev and next at the ends) while keeping other query
+// parameters, and that invalid values return HTTP 400.
+func TestAlbumPageLinks(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := srv.do("GET", "/albums?limit=1&offset=1&sort=title", "")
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	var page []Album
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if len(page) != 1 || page[0].Title != "Jeru" {
+		t.Errorf("Expected only Jeru, got %+v", page)
+	}
+	expected := `</albums?limit=1&offset=0&sort=title>; rel="first", ` +
+		`</albums?limit=1&offset=0&sort=title>; rel="prev", ` +
+		`</albums?limit=1&offset=2&sort=title>; rel="next", ` +
+		`</albums?limit=1&offset=2&sort=title>; rel="last"`
+	if link := w.Header().Get("Link"); link != expected {
+		t.Errorf("Expected Link %s, got %s", expected, link)
+	}
+
+	link := srv.do("GET", "/albums?limit=2", "").Header().Get("Link")
+	if strings.Contains(link, `rel="prev"`) || !strings.Contains(link, `offset=2>; rel="next"`) {
+		t.Errorf("Expected next but no prev on the first page, got %s", link)
+	}
+	link = srv.do("GET", "/albums?limit=2&offset=2", "").Header().Get("Link")
+	if strings.Contains(link, `rel="next"`) || !strings.Contains(link, `offset=0>; rel="prev"`) {
+		t.Errorf("Expected prev but no next on the last page, got %s", link)
+	}
+
+	if w := srv.do("GET", "/albums", ""); w.Header().Get("Link") != "" {
+		t.Errorf("Expected no Link header without paging, got %s", w.Header().Get("Link"))
+	}
+
+	for _, query := range []string{"limit=0", "limit=abc", "offset=-1"} {
+		if w := srv.do("GET", "/albums?"+query, ""); w.Code != 400 {
+			t.Errorf("Expected 400 for %s, got %d", query, w.Code)
+		}
+	}
+}
+
+// TestAlbumPageDefaults tests the default and maximum page sizes and the total count.
+// Verifies that GET /albums without limit returns the default page size with a Link header,
+// that X-Total-Count counts the albums matching the filters, and that a limit above the
+// maximum returns HTTP 400.
+func TestAlbumPageDefaults(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.PageLimitDefault = 2
+		cfg.PageLimitMax = 2
+	})
+
+	w := srv.do("GET", "/albums", "")
+	var page []Album
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if len(page) != 2 {
+		t.Errorf("Expected the default page of 2 albums, got %d", len(page))
+	}
+	if total := w.Header().Get("X-Total-Count"); total != "3" {
+		t.Errorf("Expected X-Total-Count 3, got %q", total)
+	}
+	if link := w.Header().Get("Link"); !strings.Contains(link, `</albums?limit=2&offset=2>; rel="next"`) {
+		t.Errorf("Expected a next link to the second page, got %s", link)
+	}
+
+	if total := srv.do("GET", "/albums?state=archived", "").Header().Get("X-Total-Count"); total != "0" {
+		t.Errorf("Expected X-Total-Count 0 for archived albums, got %q", total)
+	}
+	if w := srv.do("GET", "/albums?limit=3", ""); w.Code != 400 {
+		t.Errorf("Expected 400 for a limit above the maximum, got %d", w.Code)
+	}
+}
+
+// TestAlbumCursorPaging tests GET /albums with page_size and page_token.
+// Verifies that following next_page_token visits every album once while albums are deleted and
+// added during the iteration, and that malformed, mismatched, or mixed paging parameters return
+// HTTP 400.
+func TestAlbumCursorPaging(t *testing.T) {
+	srv := newTestServer(t)
+
+	var titles []string
+	path := "/albums?state=all&page_size=1"
+	for i := 0; path != ""; i++ {
+		w := srv.do("GET", path, "")
+		if w.Code != 200 {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+		}
+		var page struct {
+			Albums        []Album `json:"albums"`
+			NextPageToken string  `json:"next_page_token"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &page)
+		for _, a := range page.Albums {
+			titles = append(titles, a.Title)
+		}
+		if i == 0 {
+			// Deleting the album just returned and adding one must not shift the iteration.
+			srv.store.Delete(t.Context(), page.Albums[0].ID)
+			srv.store.Create(t.Context(), Album{ID: "new", Title: "Kind of Blue", Artist: "Miles Davis", Price: 49.99})
+		}
+		path = ""
+		if page.NextPageToken != "" {
+			path = "/albums?state=all&page_size=1&page_token=" + page.NextPageToken
+		}
+	}
+	want := "Blue Train,Jeru,Sarah Vaughan and Clifford Brown,Kind of Blue"
+	if got := strings.Join(titles, ","); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	w := srv.do("GET", "/albums?page_size=2", "")
+	var first struct {
+		NextPageToken string `json:"next_page_token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &first)
+	for _, query := range []string{
+		"page_size=0",
+		"page_token=not-base64!",
+		"page_size=1&limit=1",
+		"state=all&page_token=" + first.NextPageToken,
+	} {
+		if w := srv.do("GET", "/albums?"+query, ""); w.Code != 400 {
+			t.Errorf("Expected 400 for %s, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresMigrations are applied in file name order when the Postgres store opens.
+//
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// postgresMigrationLock is the advisory lock key held while migrating, so that several
+// servers starting at once don't apply the same migration twice.
+const postgresMigrationLock = 6650_1002
+
+// postgresStore keeps albums in PostgreSQL. Each album is stored as a JSON document,
+// with the title, artist, price, and normalized UPC copied into columns for querying.
+// Artists are kept in the artists table (see sqlArtists).
+type postgresStore struct {
+	sqlArtists
+	db *sql.DB
+	// group batches creates and deletes into shared transactions; nil if group commit is disabled.
+	group *groupCommitter[sqlWrite]
+}
+
+// newPostgresStore connects to cfg.DatabaseURL, configures the connection pool, and applies
+// any pending migrations.
+func newPostgresStore(cfg Config) (AlbumStore, error) {
+	if cfg.DatabaseURL == "" {
+		return nil, errors.New("DATABASE_URL is required for postgres storage")
+	}
+	db, err := sql.Open("pgx", cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to postgres: %w", err)
+	}
+	if err := migratePostgres(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate postgres: %w", err)
+	}
+	artists := sqlArtists{
+		db:          db,
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+		forUpdate:   ` FOR UPDATE`,
+		credited:    `(doc->>'artist_id' = $1 OR COALESCE(doc->>'artist_id', '') = '')`,
+		unique: func(err error) bool {
+			var pgErr *pgconn.PgError
+			return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.TableName == "artists"
+		},
+	}
+	return &postgresStore{sqlArtists: artists, db: db, group: newSQLGroupCommitter(db, cfg)}, nil
+}
+
+// migratePostgres applies every embedded migration not yet recorded in schema_migrations,
+// each in its own transaction.
+func migratePostgres(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, postgresMigrationLock); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, postgresMigrationLock)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var applied bool
+		if err := conn.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, name).Scan(&applied); err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		script, err := postgresMigrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, name); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upcKey returns the value stored in the unique upc_key column: the normalized UPC, or NULL if there is none.
+func upcKey(a Album) sql.NullString {
+	if a.UPC == "" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: normalizeUPC(a.UPC), Valid: true}
+}
+
+// postgresError translates a unique violation on upc_key into errUPCConflict.
+func postgresError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "albums_upc_key_unique" {
+		return errUPCConflict
+	}
+	return err
+}
+
+// scanAlbum decodes the JSON document in row into an Album.
+func scanAlbum(row interface{ Scan(...any) error }) (Album, error) {
+	var doc []byte
+	if err := row.Scan(&doc); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Album{}, errAlbumNotFound
+		}
+		return Album{}, err
+	}
+	var a Album
+	err := json.Unmarshal(doc, &a)
+	return a, err
+}
+
+// sqlQuerier runs queries that return rows: a *sql.DB, or a *sql.Tx to query in a transaction.
+type sqlQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// queryAlbums runs query, which must select the doc column, and decodes every row.
+func queryAlbums(ctx context.Context, db sqlQuerier, query string, args ...any) ([]Album, error) {
+	all := []Album{}
+	err := eachRow(ctx, db, func(a Album) error {
+		all = append(all, a)
+		return nil
+	}, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// eachRow runs query, which must select the doc column, and calls fn with each row as it is
+// decoded, stopping at the first error.
+func eachRow(ctx context.Context, db sqlQuerier, fn func(Album) error, query string, args ...any) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAlbum(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// sqlStats computes the statistics of the albums table with aggregate queries on the price and
+// artist columns. notDeleted is the dialect's condition selecting rows whose document has no
+// deleted_at time.
+func sqlStats(ctx context.Context, db *sql.DB, notDeleted string) (albumStats, error) {
+	var stats albumStats
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(AVG(price), 0), COALESCE(MIN(price), 0), COALESCE(MAX(price), 0) FROM albums WHERE `+notDeleted).
+		Scan(&stats.Count, &stats.AvgPrice, &stats.MinPrice, &stats.MaxPrice)
+	if err != nil {
+		return albumStats{}, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT artist, COUNT(*) FROM albums WHERE `+notDeleted+` GROUP BY artist`)
+	if err != nil {
+		return albumStats{}, err
+	}
+	defer rows.Close()
+	stats.ByArtist = map[string]int{}
+	for rows.Next() {
+		var artist string
+		var n int
+		if err := rows.Scan(&artist, &n); err != nil {
+			return albumStats{}, err
+		}
+		stats.ByArtist[artist] = n
+	}
+	return stats, rows.Err()
+}
+
+// sqlFilter returns the WHERE clause (empty if f selects every album) and arguments selecting the
+// albums of f by the artist and price columns. placeholder returns the parameter marker for the
+// nth argument, counting from 1.
+func sqlFilter(f albumFilter, placeholder func(n int) string) (string, []any) {
+	var conds []string
+	var args []any
+	if f.Artist != "" {
+		args = append(args, likePattern(f.Artist))
+		conds = append(conds, `LOWER(artist) LIKE `+placeholder(len(args))+` ESCAPE '\'`)
+	}
+	if f.MinPrice != nil {
+		args = append(args, *f.MinPrice)
+		conds = append(conds, `price >= `+placeholder(len(args)))
+	}
+	if f.MaxPrice != nil {
+		args = append(args, *f.MaxPrice)
+		conds = append(conds, `price <= `+placeholder(len(args)))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// likePattern returns a lowercase LIKE pattern matching values that contain s, with s's own
+// wildcards escaped.
+func likePattern(s string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(s))
+	return "%" + escaped + "%"
+}
+
+// List returns every album in insertion order.
+func (s *postgresStore) List(ctx context.Context) ([]Album, error) {
+	return queryAlbums(ctx, s.db, `SELECT doc FROM albums ORDER BY seq`)
+}
+
+// Each calls fn with every album in insertion order, reading them from the database as it goes.
+func (s *postgresStore) Each(ctx context.Context, fn func(Album) error) error {
+	return eachRow(ctx, s.db, fn, `SELECT doc FROM albums ORDER BY seq`)
+}
+
+// Stats returns the catalog statistics, computed by the database with aggregate queries.
+func (s *postgresStore) Stats(ctx context.Context) (albumStats, error) {
+	return sqlStats(ctx, s.db, `doc->>'deleted_at' IS NULL`)
+}
+
+// Query returns the albums selected by f in insertion order, filtering on the artist and price columns.
+func (s *postgresStore) Query(ctx context.Context, f albumFilter) ([]Album, error) {
+	where, args := sqlFilter(f, func(n int) string { return fmt.Sprintf("$%d", n) })
+	return queryAlbums(ctx, s.db, `SELECT doc FROM albums`+where+` ORDER BY seq`, args...)
+}
+
+// Get returns the album with the given ID.
+func (s *postgresStore) Get(ctx context.Context, id string) (Album, error) {
+	return scanAlbum(s.db.QueryRowContext(ctx, `SELECT doc FROM albums WHERE id = $1`, id))
+}
+
+// GetByUPC returns the album with the given barcode using the unique upc_key index.
+func (s *postgresStore) GetByUPC(ctx context.Context, code string) (Album, error) {
+	return scanAlbum(s.db.QueryRowContext(ctx, `SELECT doc FROM albums WHERE upc_key = $1`, normalizeUPC(code)))
+}
+
+// Create inserts a new album, as part of a group commit if enabled.
+func (s *postgresStore) Create(ctx context.Context, a Album) (Album, error) {
+	doc, err := json.Marshal(a)
+	if err != nil {
+		return Album{}, err
+	}
+	err = writeSQL(ctx, s.db, s.group, func(ctx context.Context, q sqlExecutor) error {
+		return insertPostgresAlbum(ctx, q, a, doc)
+	})
+	if err != nil {
+		return Album{}, postgresError(err)
+	}
+	return a, nil
+}
+
+// CreateUnique inserts a new album unless one with the same title and artist exists. Creates of
+// the same title and artist take a transaction-scoped advisory lock on them, so they run one at a
+// time and the second finds the first.
+func (s *postgresStore) CreateUnique(ctx context.Context, a Album) (Album, error) {
+	doc, err := json.Marshal(a)
+	if err != nil {
+		return Album{}, err
+	}
+	err = writeSQLTx(ctx, s.db, s.group, func(ctx context.Context, q sqlExecutor) error {
+		if _, err := q.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext(LOWER($1)), hashtext(LOWER($2)))`, a.Title, a.Artist); err != nil {
+			return err
+		}
+		var id string
+		err := q.QueryRowContext(ctx,
+			`SELECT id FROM albums WHERE LOWER(title) = LOWER($1) AND LOWER(artist) = LOWER($2) ORDER BY seq LIMIT 1`,
+			a.Title, a.Artist).Scan(&id)
+		switch {
+		case err == nil:
+			return duplicateAlbumError{ID: id}
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+		return insertPostgresAlbum(ctx, q, a, doc)
+	})
+	if err != nil {
+		return Album{}, postgresError(err)
+	}
+	return a, nil
+}
+
+// insertPostgresAlbum inserts a with its JSON document doc.
+func insertPostgresAlbum(ctx context.Context, q sqlExecutor, a Album, doc []byte) error {
+	_, err := q.ExecContext(ctx,
+		`INSERT INTO albums (id, title, artist, price, upc_key, doc) VALUES ($1, $2, $3, $4, $5, $6)`,
+		a.ID, a.Title, a.Artist, a.Price, upcKey(a), doc)
+	return err
+}
+
+// Update locks the album row, applies mutate, and writes the result in one transaction.
+func (s *postgresStore) Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, false)
+}
+
+// UpdateUnique updates the album like Update unless the result has the title and artist of another
+// album. A retitled album takes the same advisory lock on its new title and artist as
+// CreateUnique, so neither a create nor another update can give an album them concurrently.
+func (s *postgresStore) UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, true)
+}
+
+// update locks the album row, applies mutate, and writes the result in one transaction, first
+// checking a retitled album for a duplicate if unique is set.
+func (s *postgresStore) update(ctx context.Context, id string, mutate func(*Album) error, unique bool) (Album, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Album{}, err
+	}
+	defer tx.Rollback()
+
+	a, err := scanAlbum(tx.QueryRowContext(ctx, `SELECT doc FROM albums WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return Album{}, err
+	}
+	key := albumNameKey(a.Title, a.Artist)
+	if err := mutate(&a); err != nil {
+		return Album{}, err
+	}
+	a.ID = id
+	if unique && albumNameKey(a.Title, a.Artist) != key {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext(LOWER($1)), hashtext(LOWER($2)))`, a.Title, a.Artist); err != nil {
+			return Album{}, err
+		}
+		var other string
+		err := tx.QueryRowContext(ctx,
+			`SELECT id FROM albums WHERE LOWER(title) = LOWER($1) AND LOWER(artist) = LOWER($2) AND id <> $3 ORDER BY seq LIMIT 1`,
+			a.Title, a.Artist, id).Scan(&other)
+		switch {
+		case err == nil:
+			return Album{}, duplicateAlbumError{ID: other}
+		case !errors.Is(err, sql.ErrNoRows):
+			return Album{}, err
+		}
+	}
+
+	doc, err := json.Marshal(a)
+	if err != nil {
+		return Album{}, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE albums SET title = $2, artist = $3, price = $4, upc_key = $5, doc = $6 WHERE id = $1`,
+		id, a.Title, a.Artist, a.Price, upcKey(a), doc); err != nil {
+		return Album{}, postgresError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Album{}, err
+	}
+	return a, nil
+}
+
+// UpdateWhere locks the rows selected by f, applies mutate to each album, and writes those it
+// changed in one transaction.
+func (s *postgresStore) UpdateWhere(ctx context.Context, f albumFilter, mutate func(*Album) bool) ([]Album, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	where, args := sqlFilter(f, func(n int) string { return fmt.Sprintf("$%d", n) })
+	matching, err := queryAlbums(ctx, tx, `SELECT doc FROM albums`+where+` ORDER BY seq FOR UPDATE`, args...)
+	if err != nil {
+		return nil, err
+	}
+	changed := []Album{}
+	for _, a := range matching {
+		id := a.ID
+		if !mutate(&a) {
+			continue
+		}
+		a.ID = id
+		doc, err := json.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE albums SET price = $2, doc = $3 WHERE id = $1`, id, a.Price, doc); err != nil {
+			return nil, postgresError(err)
+		}
+		changed = append(changed, a)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// DeleteWhere removes the rows selected by f in one statement and returns their albums.
+func (s *postgresStore) DeleteWhere(ctx context.Context, f albumFilter) ([]Album, error) {
+	where, args := sqlFilter(f, func(n int) string { return fmt.Sprintf("$%d", n) })
+	return queryAlbums(ctx, s.db, `DELETE FROM albums`+where+` RETURNING doc`, args...)
+}
+
+// Delete removes the album with the given ID and returns it, as part of a group commit if enabled.
+func (s *postgresStore) Delete(ctx context.Context, id string) (Album, error) {
+	var a Album
+	err := writeSQL(ctx, s.db, s.group, func(ctx context.Context, q sqlExecutor) error {
+		var err error
+		a, err = scanAlbum(q.QueryRowContext(ctx, `DELETE FROM albums WHERE id = $1 RETURNING doc`, id))
+		return err
+	})
+	return a, err
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestPostgresStore tests the Postgres AlbumStore against a real database, including migrations.
+// It is skipped unless POSTGRES_TEST_URL points at a database the test may clear.
+func TestPostgresStore(t *testing.T) {
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL not set")
+	}
+
+	cfg := loadConfig()
+	cfg.DatabaseURL = url
+	s, err := newPostgresStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := s.(*postgresStore).db
+	defer db.Close()
+	if _, err := db.Exec(`TRUNCATE albums, artists`); err != nil {
+		t.Fatal(err)
+	}
+
+	testAlbumStore(t, s)
+	testUniqueAlbumNames(t, s)
+	testArtistStore(t, s)
+
+	// Migrations that have already run are skipped when the store is opened again.
+	again, err := newPostgresStore(cfg)
+	if err != nil {
+		t.Fatalf("Expected reopening to skip applied migrations, got %v", err)
+	}
+	again.(*postgresStore).db.Close()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// versionMismatchError is returned when the If-Match of a write does not match the album's
+// version. Current is the version the album has.
+type versionMismatchError struct {
+	Current int64
+}
+
+func (e versionMismatchError) Error() string {
+	return fmt.Sprintf("album is at version %d", e.Current)
+}
+
+// albumETag returns the entity tag of a: its version, quoted, e.g. "3".
+func albumETag(a Album) string {
+	return `"` + strconv.FormatInt(a.Version, 10) + `"`
+}
+
+// versionCheck tests an album against the If-Match header of a write. A nil check lets any write
+// through.
+type versionCheck func(a Album) error
+
+// etagListMatches reports whether header, an If-Match or If-None-Match value, names etag: it is
+// "*" or a comma-separated list of entity tags including etag. With weak comparison, as for
+// If-None-Match, a W/ prefix is ignored; with strong comparison, as for If-Match, weak tags never
+// match.
+func etagListMatches(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for tag := range strings.SplitSeq(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// validETagList reports whether header is "*" or a comma-separated list of quoted entity tags,
+// each optionally weak (W/"3").
+func validETagList(header string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for tag := range strings.SplitSeq(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseIfMatch returns the check the If-Match header of c asks for: the album's ETag must be one
+// of the listed entity tags, compared strongly, or the header must be "*". Returns nil if there is
+// no If-Match header, or an error message if it is malformed.
+func parseIfMatch(c *gin.Context) (versionCheck, string) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return nil, ""
+	}
+	if !validETagList(header) {
+		return nil, `If-Match must be "*" or a list of quoted entity tags, e.g. "3"`
+	}
+	return func(a Album) error {
+		if !etagListMatches(header, albumETag(a), false) {
+			return versionMismatchError{Current: a.Version}
+		}
+		return nil
+	}, ""
+}
+
+// versionCheckFor returns the check for the write in c (see parseIfMatch). It responds with
+// HTTP 400 if If-Match is malformed, or HTTP 428 if it is missing and required (see Config.RequireIfMatch), and
+// returns false.
+func (srv *Server) versionCheckFor(c *gin.Context) (versionCheck, bool) {
+	check, errMsg := parseIfMatch(c)
+	switch {
+	case errMsg != "":
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return nil, false
+	case check == nil && srv.cfg.RequireIfMatch:
+		c.IndentedJSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match is required: send the album's ETag, from GET /albums/:id, to change it"})
+		return nil, false
+	}
+	return check, true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestIfMatch tests optimistic concurrency control with album versions.
+// Verifies that albums carry their version as their ETag, that writes with an outdated If-Match get
+// HTTP 412 with the current version, that of concurrent writes based on the same version only one
+// succeeds, that GET honors If-None-Match, and that If-Match is mandatory unless REQUIRE_IF_MATCH
+// is false.
+func TestIfMatch(t *testing.T) {
+	srv := newTestServer(t)
+	const album = "/albums/550e8400-e29b-41d4-a716-446655440002"
+
+	etag := srv.do("GET", album, "").Header().Get("ETag")
+	w := srv.do("PATCH", album, `{"price": 19.99}`, "If-Match", etag)
+	var a Album
+	json.Unmarshal(w.Body.Bytes(), &a)
+	if w.Code != 200 || a.Version != 1 || w.Header().Get("ETag") != `"1"` {
+		t.Fatalf("Expected the update to move the album to version 1, got %d %v: %s", w.Code, w.Header(), w.Body)
+	}
+	w = srv.do("PUT", album, `{"title": "Jeru", "artist": "Gerry Mulligan", "price": 9.99}`, "If-Match", etag)
+	if w.Code != 412 || w.Header().Get("ETag") != `"1"` || !strings.Contains(w.Body.String(), `"version": 1`) {
+		t.Errorf("Expected 412 with the current version for an outdated If-Match, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("PATCH", album, `{"price": 29.99}`, "If-Match", `W/"1"`); w.Code != 412 {
+		t.Errorf("Expected a weak ETag not to match If-Match, got %d", w.Code)
+	}
+	if w := srv.do("PATCH", album, `{"price": 29.99}`, "If-Match", `"0", "1"`); w.Code != 200 {
+		t.Errorf("Expected a list including the current ETag to match, got %d", w.Code)
+	}
+	if w := srv.do("PATCH", album, `{"price": 29.99}`, "If-Match", "1"); w.Code != 400 {
+		t.Errorf("Expected 400 for an unquoted ETag, got %d", w.Code)
+	}
+
+	var updated atomic.Int64
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if srv.do("PATCH", album, `{"price": 39.99}`, "If-Match", `"2"`).Code == 200 {
+				updated.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	if updated.Load() != 1 {
+		t.Errorf("Expected exactly one of the concurrent updates to succeed, got %d", updated.Load())
+	}
+
+	w = srv.do("GET", album, "", "If-None-Match", `W/"3"`)
+	if w.Code != 304 {
+		t.Errorf("Expected 304 for a matching If-None-Match, got %d", w.Code)
+	}
+
+	if w := srv.do("DELETE", album, "", "If-Match", `"2"`); w.Code != 412 {
+		t.Errorf("Expected 412 deleting with an outdated If-Match, got %d", w.Code)
+	}
+	if w := srv.do("DELETE", album, "", "If-Match", `"3"`); w.Code != 200 {
+		t.Errorf("Expected 200 deleting with the current If-Match, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("DELETE", album+"?permanent=true", "", "If-Match", `"3"`); w.Code != 412 {
+		t.Errorf("Expected 412 permanently deleting with an outdated If-Match, got %d", w.Code)
+	}
+
+	fresh := newTestServer(t)
+	if w := fresh.do("PATCH", album, `{"price": 19.99}`); w.Code != 428 {
+		t.Errorf("Expected 428 without If-Match, got %d", w.Code)
+	}
+	if w := fresh.do("DELETE", album, ""); w.Code != 428 {
+		t.Errorf("Expected 428 deleting without If-Match, got %d", w.Code)
+	}
+	if w := fresh.do("DELETE", album, "", "If-Match", "*"); w.Code != 200 {
+		t.Errorf("Expected If-Match: * to match any album, got %d", w.Code)
+	}
+	lenient := newTestServer(t, func(cfg *Config) { cfg.RequireIfMatch = false })
+	if w := lenient.do("PATCH", album, `{"price": 19.99}`); w.Code != 200 {
+		t.Errorf("Expected an update without If-Match to succeed when it is optional, got %d", w.Code)
+	}
+	var created Album
+	json.Unmarshal(fresh.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 9.99}`).Body.Bytes(), &created)
+	if created.Version != 1 {
+		t.Errorf("Expected a new album at version 1, got %d", created.Version)
+	}
+}
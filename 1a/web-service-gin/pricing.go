@@ -0,0 +1,721 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// warnPriceAdjusted is the code of the warning reporting that a pricing rule changed an album's
+// price.
+const warnPriceAdjusted = "price_adjusted"
+
+// pricingRules are the price policies set by PRICING_RULES, evaluated in order whenever an album is
+// created or changed (see apply).
+//
+// Rules are separated by semicolons. Each has an optional condition and an action that either sets
+// the price or rejects the album:
+//
+//	if genre == "Jazz" and price < metadata.cost * 1.3 then price = ceil(metadata.cost * 1.3) - 0.01;
+//	if genre == "Classical" and price < 5 then reject "Classical albums cost at least 5"
+//
+// Expressions can use the album's price, title, artist, genre, currency, year, and quantity,
+// metadata.<key> values, numbers, "strings", true and false, + - * /, == != < <= > >=, and, or, not,
+// parentheses, and the functions min, max, ceil, floor, and round(x[, places]). Strings compare
+// ignoring case, and metadata values that are numbers can be used as numbers. A rule using a value
+// the album does not have, such as an unset year or missing metadata key, does not apply.
+type pricingRules []pricingRule
+
+// pricingRule is one rule of PRICING_RULES.
+type pricingRule struct {
+	// Source is the rule as configured.
+	Source string
+	// cond is the rule's condition, or nil if it always applies.
+	cond *pricingExpr
+	// price computes the new price, or is nil if the rule rejects the album with reject instead.
+	price  *pricingExpr
+	reject string
+	// fields are the album fields the rule reads; on updates, the rule only applies if one of them
+	// changed.
+	fields []string
+}
+
+// pricingType is the static type of a pricing expression. Metadata values are typeAny: they are
+// strings that may hold numbers, checked when the rule is evaluated.
+type pricingType int
+
+const (
+	typeNumber pricingType = iota
+	typeString
+	typeBool
+	typeAny
+)
+
+// String returns the name of t used in error messages.
+func (t pricingType) String() string {
+	return [...]string{"number", "string", "boolean", "any"}[t]
+}
+
+// pricingExpr is a compiled pricing expression. eval returns a float64, string, or bool of the
+// expression's type, or nil if the album lacks a value the expression needs.
+type pricingExpr struct {
+	typ  pricingType
+	eval func(a Album) any
+}
+
+// pricingFields are the album fields pricing expressions can use, by name.
+var pricingFields = map[string]struct {
+	typ   pricingType
+	value func(a Album) any
+}{
+	"price":    {typeNumber, func(a Album) any { return a.Price }},
+	"title":    {typeString, func(a Album) any { return a.Title }},
+	"artist":   {typeString, func(a Album) any { return a.Artist }},
+	"genre":    {typeString, func(a Album) any { return a.Genre }},
+	"currency": {typeString, func(a Album) any { return albumCurrency(a) }},
+	"year": {typeNumber, func(a Album) any {
+		if a.Year == 0 {
+			return nil
+		}
+		return float64(a.Year)
+	}},
+	"quantity": {typeNumber, func(a Album) any {
+		if a.Quantity == nil {
+			return nil
+		}
+		return float64(*a.Quantity)
+	}},
+}
+
+// pricingFunctions are the functions pricing expressions can call, by name, with the fewest and
+// most arguments each takes (-1 for any number). Arguments are numbers.
+var pricingFunctions = map[string]struct {
+	minArgs, maxArgs int
+	call             func(args []float64) float64
+}{
+	"min":   {1, -1, func(args []float64) float64 { return slices.Min(args) }},
+	"max":   {1, -1, func(args []float64) float64 { return slices.Max(args) }},
+	"ceil":  {1, 1, func(args []float64) float64 { return math.Ceil(args[0]) }},
+	"floor": {1, 1, func(args []float64) float64 { return math.Floor(args[0]) }},
+	"round": {1, 2, func(args []float64) float64 {
+		scale := 1.0
+		if len(args) == 2 {
+			scale = math.Pow(10, math.Round(args[1]))
+		}
+		return math.Round(args[0]*scale) / scale
+	}},
+}
+
+// metadataPrefix prefixes the names of metadata values in pricing expressions, e.g. metadata.cost.
+const metadataPrefix = "metadata."
+
+// parsePricingRules parses a PRICING_RULES value (see pricingRules). Returns an error naming the
+// first malformed rule.
+func parsePricingRules(spec string) (pricingRules, error) {
+	tokens, err := lexPricing(spec)
+	if err != nil {
+		return nil, err
+	}
+	p := &pricingParser{tokens: tokens, src: spec}
+	var rules pricingRules
+	for p.peek().kind != tokEOF {
+		if p.accept(";") {
+			continue
+		}
+		rule, err := p.rule()
+		if err != nil {
+			return nil, fmt.Errorf("pricing rule %d: %w", len(rules)+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// apply evaluates the rules against a, the album being created, or changed from previous, adjusting
+// its price in place. Each rule sees the price set by the rules before it. On updates, a rule only
+// applies if the change touched a field it reads, so albums that predate a policy can still be
+// changed in other ways.
+// Returns a warning for every price a rule changed, or a validationError if a rule rejects the
+// album or sets an invalid price.
+func (rules pricingRules) apply(a *Album, previous *Album) ([]validationWarning, error) {
+	var warnings []validationWarning
+	for i, r := range rules {
+		if previous != nil && !r.changed(*a, *previous) {
+			continue
+		}
+		if r.cond != nil && r.cond.eval(*a) != true {
+			continue
+		}
+		if r.price == nil {
+			return nil, validationError(r.reject)
+		}
+		price, ok := pricingNumber(r.price.eval(*a))
+		if !ok || math.IsInf(price, 0) || math.IsNaN(price) {
+			continue
+		}
+		price = math.Round(price*100) / 100
+		if price == a.Price {
+			continue
+		}
+		if errMsg := validatePrice(price, true); errMsg != "" {
+			return nil, validationError(fmt.Sprintf("Pricing rule %d sets the price to %.2f: %s", i+1, price, errMsg))
+		}
+		warnings = append(warnings, validationWarning{
+			Code:    warnPriceAdjusted,
+			Field:   "price",
+			Message: fmt.Sprintf("Price adjusted from %.2f to %.2f by pricing rule %d", a.Price, price, i+1),
+		})
+		a.Price = price
+	}
+	return warnings, nil
+}
+
+// changed reports whether any field r reads differs between a and previous.
+func (r pricingRule) changed(a, previous Album) bool {
+	return slices.ContainsFunc(r.fields, func(name string) bool {
+		return pricingValue(name)(a) != pricingValue(name)(previous)
+	})
+}
+
+// pricingValue returns the function reading the field or metadata value name of an album.
+func pricingValue(name string) func(a Album) any {
+	if key, ok := strings.CutPrefix(name, metadataPrefix); ok {
+		return func(a Album) any {
+			if value, ok := a.Metadata[key]; ok {
+				return value
+			}
+			return nil
+		}
+	}
+	return pricingFields[name].value
+}
+
+// pricingNumber returns v as a number: a float64, or a string holding one, as metadata values
+// do. Returns false for anything else, including nil.
+func pricingNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Kinds of pricing tokens.
+const (
+	tokEOF = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+// pricingToken is a token of PRICING_RULES. text is the identifier or operator, or the decoded
+// string; num is the value of a number. pos is the token's byte offset, for error messages.
+type pricingToken struct {
+	kind int
+	text string
+	num  float64
+	pos  int
+}
+
+// pricingOps are the operators and punctuation of PRICING_RULES, two-character ones first.
+var pricingOps = []string{"==", "!=", "<=", ">=", "<", ">", "=", "+", "-", "*", "/", "(", ")", ",", ";"}
+
+// lexPricing splits src into tokens, ending with a tokEOF token.
+func lexPricing(src string) ([]pricingToken, error) {
+	var tokens []pricingToken
+	for i := 0; i < len(src); {
+		ch := rune(src[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch >= '0' && ch <= '9' || ch == '.':
+			end := i
+			for end < len(src) && (src[end] >= '0' && src[end] <= '9' || src[end] == '.') {
+				end++
+			}
+			num, err := strconv.ParseFloat(src[i:end], 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed number %q at offset %d", src[i:end], i)
+			}
+			tokens = append(tokens, pricingToken{kind: tokNumber, num: num, pos: i})
+			i = end
+		case ch == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			text, err := strconv.Unquote(src[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("malformed string at offset %d", i)
+			}
+			tokens = append(tokens, pricingToken{kind: tokString, text: text, pos: i})
+			i = end + 1
+		case ch == '_' || unicode.IsLetter(ch):
+			end := i
+			for end < len(src) && (src[end] == '_' || src[end] == '.' || unicode.IsLetter(rune(src[end])) || unicode.IsDigit(rune(src[end]))) {
+				end++
+			}
+			tokens = append(tokens, pricingToken{kind: tokIdent, text: src[i:end], pos: i})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range pricingOps {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at offset %d", ch, i)
+			}
+			tokens = append(tokens, pricingToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, pricingToken{kind: tokEOF, pos: len(src)}), nil
+}
+
+// pricingParser parses PRICING_RULES tokens into rules by recursive descent, checking the types of
+// expressions as it goes. fields collects the fields the current rule reads.
+type pricingParser struct {
+	tokens []pricingToken
+	src    string
+	fields []string
+}
+
+// peek returns the next token without consuming it.
+func (p *pricingParser) peek() pricingToken {
+	return p.tokens[0]
+}
+
+// next consumes and returns the next token.
+func (p *pricingParser) next() pricingToken {
+	t := p.tokens[0]
+	if t.kind != tokEOF {
+		p.tokens = p.tokens[1:]
+	}
+	return t
+}
+
+// accept consumes the next token and returns true if it is the operator or keyword text.
+func (p *pricingParser) accept(text string) bool {
+	if t := p.peek(); (t.kind == tokOp || t.kind == tokIdent) && t.text == text {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expect consumes the operator or keyword text, or returns an error if the next token is not it.
+func (p *pricingParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected(fmt.Sprintf("%q", text))
+	}
+	return nil
+}
+
+// unexpected returns an error saying the next token is not the wanted one.
+func (p *pricingParser) unexpected(wanted string) error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("expected %s at the end", wanted)
+	}
+	return fmt.Errorf("expected %s at offset %d", wanted, t.pos)
+}
+
+// rule parses "[if <condition> then] price = <number> | reject <string>", up to the next semicolon.
+func (p *pricingParser) rule() (pricingRule, error) {
+	start := p.peek().pos
+	p.fields = nil
+	var r pricingRule
+	if p.accept("if") {
+		cond, err := p.typed(typeBool)
+		if err != nil {
+			return r, err
+		}
+		if err := p.expect("then"); err != nil {
+			return r, err
+		}
+		r.cond = cond
+	}
+	switch {
+	case p.accept("reject"):
+		t := p.next()
+		if t.kind != tokString {
+			return r, fmt.Errorf("expected the rejection message, a string, at offset %d", t.pos)
+		}
+		r.reject = t.text
+	case p.accept("price"):
+		if err := p.expect("="); err != nil {
+			return r, err
+		}
+		price, err := p.typed(typeNumber)
+		if err != nil {
+			return r, err
+		}
+		r.price = price
+		p.read("price")
+	default:
+		return r, p.unexpected(`"price =" or "reject"`)
+	}
+	if t := p.peek(); t.kind != tokEOF && !p.accept(";") {
+		return r, p.unexpected(`";"`)
+	}
+	r.Source = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(p.src[start:p.peek().pos]), ";"))
+	r.fields = p.fields
+	return r, nil
+}
+
+// read records that the current rule reads the field name.
+func (p *pricingParser) read(name string) {
+	if !slices.Contains(p.fields, name) {
+		p.fields = append(p.fields, name)
+	}
+}
+
+// typed parses an expression that must be of type want, or of typeAny.
+func (p *pricingParser) typed(want pricingType) (*pricingExpr, error) {
+	pos := p.peek().pos
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if e.typ != want && (e.typ != typeAny || want == typeBool) {
+		return nil, fmt.Errorf("expected a %s at offset %d, got a %s", want, pos, e.typ)
+	}
+	return e, nil
+}
+
+// or parses "<and> {or <and>}".
+func (p *pricingParser) or() (*pricingExpr, error) {
+	return p.logical("or", p.and, func(x, y bool) bool { return x || y })
+}
+
+// and parses "<not> {and <not>}".
+func (p *pricingParser) and() (*pricingExpr, error) {
+	return p.logical("and", p.not, func(x, y bool) bool { return x && y })
+}
+
+// logical parses operands joined by the boolean operator keyword, combined with op.
+func (p *pricingParser) logical(keyword string, operand func() (*pricingExpr, error), op func(x, y bool) bool) (*pricingExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == keyword && p.peek().kind == tokIdent {
+		if left.typ != typeBool {
+			return nil, fmt.Errorf("%s needs booleans, got a %s", keyword, left.typ)
+		}
+		p.next()
+		pos := p.peek().pos
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if right.typ != typeBool {
+			return nil, fmt.Errorf("%s needs booleans, got a %s at offset %d", keyword, right.typ, pos)
+		}
+		l, r := left.eval, right.eval
+		left = &pricingExpr{typ: typeBool, eval: func(a Album) any { return op(l(a) == true, r(a) == true) }}
+	}
+	return left, nil
+}
+
+// not parses "not <not>" or a comparison.
+func (p *pricingParser) not() (*pricingExpr, error) {
+	if !p.accept("not") {
+		return p.comparison()
+	}
+	pos := p.peek().pos
+	operand, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	if operand.typ != typeBool {
+		return nil, fmt.Errorf("not needs a boolean, got a %s at offset %d", operand.typ, pos)
+	}
+	return &pricingExpr{typ: typeBool, eval: func(a Album) any { return operand.eval(a) != true }}, nil
+}
+
+// comparison parses "<sum> [<op> <sum>]" for the comparison operators. Numbers compare as numbers
+// and strings ignoring case; a comparison with a missing value is false.
+func (p *pricingParser) comparison() (*pricingExpr, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokOp || !slices.Contains([]string{"==", "!=", "<", "<=", ">", ">="}, t.text) {
+		return left, nil
+	}
+	p.next()
+	right, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	op := t.text
+	ordered := op != "==" && op != "!="
+	numeric := left.typ == typeNumber || right.typ == typeNumber
+	switch {
+	case ordered && (!isNumeric(left.typ) || !isNumeric(right.typ)):
+		return nil, fmt.Errorf("%s at offset %d needs numbers", op, t.pos)
+	case left.typ != right.typ && left.typ != typeAny && right.typ != typeAny:
+		return nil, fmt.Errorf("cannot compare a %s with a %s at offset %d", left.typ, right.typ, t.pos)
+	}
+	l, r := left.eval, right.eval
+	return &pricingExpr{typ: typeBool, eval: func(a Album) any {
+		lv, rv := l(a), r(a)
+		if lv == nil || rv == nil {
+			return false
+		}
+		var order int
+		x, xok := pricingNumber(lv)
+		y, yok := pricingNumber(rv)
+		switch {
+		case xok && yok:
+			order = cmp.Compare(x, y)
+		case numeric || ordered:
+			return false
+		default:
+			ls, lok := lv.(string)
+			rs, rok := rv.(string)
+			if !lok || !rok {
+				equal := lv == rv
+				return equal == (op == "==")
+			}
+			order = strings.Compare(strings.ToLower(ls), strings.ToLower(rs))
+		}
+		switch op {
+		case "==":
+			return order == 0
+		case "!=":
+			return order != 0
+		case "<":
+			return order < 0
+		case "<=":
+			return order <= 0
+		case ">":
+			return order > 0
+		}
+		return order >= 0
+	}}, nil
+}
+
+// isNumeric reports whether expressions of type t can be used as numbers.
+func isNumeric(t pricingType) bool {
+	return t == typeNumber || t == typeAny
+}
+
+// sum parses "<product> {(+|-) <product>}".
+func (p *pricingParser) sum() (*pricingExpr, error) {
+	return p.arithmetic([]string{"+", "-"}, p.product)
+}
+
+// product parses "<unary> {(*|/) <unary>}".
+func (p *pricingParser) product() (*pricingExpr, error) {
+	return p.arithmetic([]string{"*", "/"}, p.unary)
+}
+
+// arithmetic parses operands joined by the operators ops. Operands must be numbers; the result
+// is missing if an operand is, or on division by zero.
+func (p *pricingParser) arithmetic(ops []string, operand func() (*pricingExpr, error)) (*pricingExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokOp && slices.Contains(ops, t.text); t = p.peek() {
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if !isNumeric(left.typ) || !isNumeric(right.typ) {
+			return nil, fmt.Errorf("%s at offset %d needs numbers", t.text, t.pos)
+		}
+		l, r, op := left.eval, right.eval, t.text
+		left = &pricingExpr{typ: typeNumber, eval: func(a Album) any {
+			x, xok := pricingNumber(l(a))
+			y, yok := pricingNumber(r(a))
+			if !xok || !yok {
+				return nil
+			}
+			switch op {
+			case "+":
+				return x + y
+			case "-":
+				return x - y
+			case "*":
+				return x * y
+			}
+			if y == 0 {
+				return nil
+			}
+			return x / y
+		}}
+	}
+	return left, nil
+}
+
+// unary parses "-<unary>" or a primary expression.
+func (p *pricingParser) unary() (*pricingExpr, error) {
+	t := p.peek()
+	if !p.accept("-") {
+		return p.primary()
+	}
+	operand, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	if !isNumeric(operand.typ) {
+		return nil, fmt.Errorf("- at offset %d needs a number", t.pos)
+	}
+	return &pricingExpr{typ: typeNumber, eval: func(a Album) any {
+		if x, ok := pricingNumber(operand.eval(a)); ok {
+			return -x
+		}
+		return nil
+	}}, nil
+}
+
+// primary parses a literal, field, function call, or parenthesized expression.
+func (p *pricingParser) primary() (*pricingExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &pricingExpr{typ: typeNumber, eval: func(Album) any { return t.num }}, nil
+	case tokString:
+		return &pricingExpr{typ: typeString, eval: func(Album) any { return t.text }}, nil
+	case tokOp:
+		if t.text == "(" {
+			e, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		}
+	case tokIdent:
+		switch name := t.text; {
+		case name == "true" || name == "false":
+			value := name == "true"
+			return &pricingExpr{typ: typeBool, eval: func(Album) any { return value }}, nil
+		case strings.HasPrefix(name, metadataPrefix) && len(name) > len(metadataPrefix):
+			p.read(name)
+			return &pricingExpr{typ: typeAny, eval: pricingValue(name)}, nil
+		case p.peek().text == "(":
+			return p.call(t)
+		default:
+			field, ok := pricingFields[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown field %q at offset %d", name, t.pos)
+			}
+			p.read(name)
+			return &pricingExpr{typ: field.typ, eval: field.value}, nil
+		}
+	}
+	if t.kind == tokEOF {
+		return nil, fmt.Errorf("expected a value at the end")
+	}
+	return nil, fmt.Errorf("expected a value at offset %d", t.pos)
+}
+
+// call parses the arguments of a call to the function named by t, up to the closing parenthesis.
+func (p *pricingParser) call(t pricingToken) (*pricingExpr, error) {
+	fn, ok := pricingFunctions[t.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at offset %d", t.text, t.pos)
+	}
+	p.next()
+	var args []*pricingExpr
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.typed(typeNumber)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) < fn.minArgs || fn.maxArgs >= 0 && len(args) > fn.maxArgs {
+		return nil, fmt.Errorf("wrong number of arguments to %s at offset %d", t.text, t.pos)
+	}
+	return &pricingExpr{typ: typeNumber, eval: func(a Album) any {
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			v, ok := pricingNumber(arg.eval(a))
+			if !ok {
+				return nil
+			}
+			values[i] = v
+		}
+		return fn.call(values)
+	}}, nil
+}
+
+// pricingRulesBody is the body of PUT /admin/pricing-rules.
+type pricingRulesBody struct {
+	Rules string `json:"rules"`
+}
+
+// respondPricingRules sends rules as JSON with HTTP 200 status.
+func respondPricingRules(c *gin.Context, rules pricingRules) {
+	sources := make([]string, len(rules))
+	for i, r := range rules {
+		sources[i] = r.Source
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"count": len(rules), "rules": sources})
+}
+
+// getPricingRules handles GET /admin/pricing-rules requests.
+// Returns the pricing rules in effect, in the order they are evaluated, as JSON with HTTP 200
+// status.
+func (srv *Server) getPricingRules(c *gin.Context) {
+	respondPricingRules(c, *srv.pricing.Load())
+}
+
+// putPricingRules handles PUT /admin/pricing-rules requests.
+// Replaces the pricing rules with the rules in the body, written as for PRICING_RULES, until the
+// server restarts. An empty value removes them. Returns the new rules as JSON with HTTP 200 status,
+// or HTTP 400 if the body or a rule is malformed.
+func (srv *Server) putPricingRules(c *gin.Context) {
+	var body pricingRulesBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid JSON",
+			"details": err.Error(),
+		})
+		return
+	}
+	rules, err := parsePricingRules(body.Rules)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	srv.pricing.Store(&rules)
+	respondPricingRules(c, rules)
+}
+
+// applyPricing applies the current pricing rules to a, the album being created, or changed from
+// previous (see pricingRules.apply).
+func (srv *Server) applyPricing(a *Album, previous *Album) ([]validationWarning, error) {
+	return srv.pricing.Load().apply(a, previous)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestParsePricingRules tests parsing PRICING_RULES.
+// Verifies that well-formed rules parse with their source, that syntax and type errors are reported
+// with the rule they are in, and that malformed tokens are reported with their offset.
+func TestParsePricingRules(t *testing.T) {
+	rules, err := parsePricingRules(` if genre == "Jazz" and price < metadata.cost * 1.3 then price = ceil(metadata.cost * 1.3) - 0.01 ;
+		if not (year >= 1960) then reject "Too old; sorry";; price = max(price, 0.99)`)
+	if err != nil {
+		t.Fatalf("Expected the rules to parse, got %v", err)
+	}
+	if len(rules) != 3 || rules[1].Source != `if not (year >= 1960) then reject "Too old; sorry"` || rules[2].Source != "price = max(price, 0.99)" {
+		t.Errorf("Expected three rules with their source, got %+v", rules)
+	}
+
+	for _, spec := range []string{
+		`price = `,
+		`if price then price = 1`,
+		`if genre > 3 then price = 1`,
+		`if genre == 3 then price = 1`,
+		`price = title`,
+		`price = 1 price = 2`,
+		`if price < 3 reject "x"`,
+		`reject 3`,
+		`price = pow(2)`,
+		`price = ceil(1, 2)`,
+		`if label == "x" then price = 1`,
+	} {
+		if _, err := parsePricingRules("price = 1; " + spec); err == nil || !strings.HasPrefix(err.Error(), "pricing rule 2") {
+			t.Errorf("Expected an error in rule 2 for %q, got %v", spec, err)
+		}
+	}
+	for _, spec := range []string{`price = "unterminated`, `price = 1 # 2`, `price = 1..2`} {
+		if _, err := parsePricingRules(spec); err == nil || !strings.Contains(err.Error(), "at offset") {
+			t.Errorf("Expected an error with its offset for %q, got %v", spec, err)
+		}
+	}
+}
+
+// TestPricingRules tests applying the pricing rules to albums.
+// Verifies that rules adjust prices on create with a price_adjusted warning, reject albums, skip
+// albums lacking a value they use, apply on updates only when a field they read changes, and can be
+// replaced at runtime.
+func TestPricingRules(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.PricingRules = `if genre == "jazz" and price < metadata.cost * 1.5 then price = metadata.cost * 1.5;
+			if genre == "Classical" and price < 5 then reject "Classical albums cost at least 5"`
+	})
+	var created struct {
+		Album
+		Warnings []validationWarning
+	}
+
+	w := srv.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 9.99, "genre": "Jazz", "metadata": {"cost": "8.33"}}`)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != 201 || created.Price != 12.5 || len(created.Warnings) != 1 || created.Warnings[0].Code != warnPriceAdjusted {
+		t.Fatalf("Expected the price raised to 12.50 with a warning, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("POST", "/albums", `{"title": "Requiem", "artist": "Mozart", "price": 3, "genre": "Classical"}`); w.Code != 400 || !strings.Contains(w.Body.String(), "at least 5") {
+		t.Errorf("Expected 400 with the rule's message, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("POST", "/albums", `{"title": "Giant Steps", "artist": "John Coltrane", "price": 1.99, "genre": "Jazz"}`); w.Code != 201 || strings.Contains(w.Body.String(), "warnings") {
+		t.Errorf("Expected an album without a cost left alone, got %d: %s", w.Code, w.Body)
+	}
+
+	if w := srv.do("PATCH", "/albums/"+created.ID, `{"price": 10}`, "If-Match", "*"); !strings.Contains(w.Body.String(), `"price": 12.5`) {
+		t.Errorf("Expected a price change to be adjusted, got %d: %s", w.Code, w.Body)
+	}
+	srv.softDeletes.AlbumStore.Update(t.Context(), created.ID, func(a *Album) error {
+		a.Price = 1
+		return nil
+	})
+	if w := srv.do("PATCH", "/albums/"+created.ID, `{"year": 1959}`, "If-Match", "*"); w.Code != 200 || !strings.Contains(w.Body.String(), `"price": 1,`) {
+		t.Errorf("Expected an unrelated change to leave the price alone, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("PATCH", "/albums/"+created.ID, `{"metadata": {"cost": "10"}}`, "If-Match", "*"); !strings.Contains(w.Body.String(), `"price": 15`) {
+		t.Errorf("Expected a cost change to adjust the price, got %d: %s", w.Code, w.Body)
+	}
+
+	if w := srv.do("PUT", "/admin/pricing-rules", `{"rules": "price = "}`); w.Code != 400 {
+		t.Errorf("Expected 400 for malformed rules, got %d", w.Code)
+	}
+	if w := srv.do("PUT", "/admin/pricing-rules", `{"rules": "if artist == \"Mozart\" then price = round(price * 0.9, 1)"}`); w.Code != 200 || !strings.Contains(w.Body.String(), `"count": 1`) {
+		t.Errorf("Expected the rules replaced, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("POST", "/albums", `{"title": "Requiem", "artist": "Mozart", "price": 3, "genre": "Classical"}`); w.Code != 201 || !strings.Contains(w.Body.String(), `"price": 2.7`) {
+		t.Errorf("Expected the new rules applied, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("GET", "/admin/pricing-rules", ""); !strings.Contains(w.Body.String(), `round(price * 0.9, 1)`) {
+		t.Errorf("Expected the rules listed, got %s", w.Body)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	runtimemetrics "runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// histogramBuckets is the number of buckets in a latencyHistogram. Bucket i counts durations
+// below 10µs * 2^i, so the last bucket covers everything from about 10 minutes up.
+const histogramBuckets = 27
+
+// latencyHistogram is a lock-free histogram of durations with exponentially sized buckets.
+// Percentiles are approximated by the upper bound of the bucket they fall in.
+type latencyHistogram struct {
+	buckets [histogramBuckets]atomic.Int64
+	count   atomic.Int64
+	sumNS   atomic.Int64
+	maxNS   atomic.Int64
+}
+
+// observe records one duration.
+func (h *latencyHistogram) observe(d time.Duration) {
+	i := 0
+	for bound := 10 * time.Microsecond; d >= bound && i < histogramBuckets-1; bound *= 2 {
+		i++
+	}
+	h.buckets[i].Add(1)
+	h.count.Add(1)
+	h.sumNS.Add(int64(d))
+	for {
+		old := h.maxNS.Load()
+		if int64(d) <= old || h.maxNS.CompareAndSwap(old, int64(d)) {
+			break
+		}
+	}
+}
+
+// percentile returns the approximate p-th percentile in milliseconds.
+func (h *latencyHistogram) percentile(p float64) float64 {
+	total := h.count.Load()
+	if total == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(p / 100 * float64(total)))
+	var seen int64
+	for i := range h.buckets {
+		seen += h.buckets[i].Load()
+		if seen >= target {
+			return float64((10*time.Microsecond)<<i) / float64(time.Millisecond)
+		}
+	}
+	return float64(h.maxNS.Load()) / float64(time.Millisecond)
+}
+
+// summary returns count, mean, p50, p99, and max in milliseconds.
+func (h *latencyHistogram) summary() gin.H {
+	count := h.count.Load()
+	mean := 0.0
+	if count > 0 {
+		mean = float64(h.sumNS.Load()) / float64(count) / float64(time.Millisecond)
+	}
+	return gin.H{
+		"count":   count,
+		"mean_ms": mean,
+		"p50_ms":  h.percentile(50),
+		"p99_ms":  h.percentile(99),
+		"max_ms":  float64(h.maxNS.Load()) / float64(time.Millisecond),
+	}
+}
+
+// connKey is the context key under which ConnContext stores the request's connection.
+type connKey struct{}
+
+// queueingMetrics separates time a request spends waiting from time spent in its handler.
+// The HTTP server's ConnState hook records when each connection becomes active (the first bytes
+// of a request arrive); the middleware measures from there to the start of the handler chain,
+// which covers reading the request and waiting for the Go scheduler to run the connection's
+// goroutine. Handler execution is measured separately as service time. Time spent in the kernel
+// accept queue before Go accepts the connection is not observable from the process; the Go
+// scheduler's own run-queue latency is reported from runtime/metrics instead.
+type queueingMetrics struct {
+	activeAt sync.Map // net.Conn -> *atomic.Int64 (Unix nanoseconds)
+
+	accepted atomic.Int64
+	open     atomic.Int64
+
+	queueWait latencyHistogram
+	service   latencyHistogram
+}
+
+// connState is installed as http.Server.ConnState.
+func (q *queueingMetrics) connState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		q.accepted.Add(1)
+		q.open.Add(1)
+		q.activeAt.Store(conn, new(atomic.Int64))
+	case http.StateActive:
+		if v, ok := q.activeAt.Load(conn); ok {
+			v.(*atomic.Int64).Store(time.Now().UnixNano())
+		}
+	case http.StateClosed, http.StateHijacked:
+		q.open.Add(-1)
+		q.activeAt.Delete(conn)
+	}
+}
+
+// connContext is installed as http.Server.ConnContext so handlers can find their connection.
+func (q *queueingMetrics) connContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// middleware measures queue wait and service time. It should run before other middleware.
+func (q *queueingMetrics) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		if conn, ok := c.Request.Context().Value(connKey{}).(net.Conn); ok {
+			if v, ok := q.activeAt.Load(conn); ok {
+				if at := v.(*atomic.Int64).Load(); at > 0 {
+					q.queueWait.observe(start.Sub(time.Unix(0, at)))
+				}
+			}
+		}
+		c.Next()
+		q.service.observe(time.Since(start))
+	}
+}
+
+// schedulerLatency returns approximate p50 and p99 of the Go scheduler latency (time goroutines
+// spent runnable before running) since the process started, in milliseconds.
+func schedulerLatency() gin.H {
+	sample := []runtimemetrics.Sample{{Name: "/sched/latencies:seconds"}}
+	runtimemetrics.Read(sample)
+	if sample[0].Value.Kind() != runtimemetrics.KindFloat64Histogram {
+		return nil
+	}
+	hist := sample[0].Value.Float64Histogram()
+
+	var total uint64
+	for _, n := range hist.Counts {
+		total += n
+	}
+	quantile := func(p float64) float64 {
+		target := uint64(math.Ceil(p / 100 * float64(total)))
+		var seen uint64
+		for i, n := range hist.Counts {
+			seen += n
+			if seen >= target && n > 0 {
+				// Buckets[i+1] is the bucket's upper bound; the last one may be +Inf.
+				if upper := hist.Buckets[i+1]; !math.IsInf(upper, 1) {
+					return upper * 1000
+				}
+				return hist.Buckets[i] * 1000
+			}
+		}
+		return 0
+	}
+	return gin.H{"p50_ms": quantile(50), "p99_ms": quantile(99)}
+}
+
+// getQueueingMetrics handles GET /metrics/queueing requests.
+// Returns queue wait and handler service time distributions, connection counts, and Go
+// scheduler latency as JSON with HTTP 200 status.
+func (srv *Server) getQueueingMetrics(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"queue_wait":        srv.queueing.queueWait.summary(),
+		"service_time":      srv.queueing.service.summary(),
+		"scheduler_latency": schedulerLatency(),
+		"connections": gin.H{
+			"accepted": srv.queueing.accepted.Load(),
+			"open":     srv.queueing.open.Load(),
+		},
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestQueueingMetrics tests queue wait and service time measurement through a real HTTP server.
+// Verifies that each request is measured, handler time is attributed to service time,
+// and connections are counted.
+func TestQueueingMetrics(t *testing.T) {
+	srv := newTestServer(t)
+	srv.router.GET("/slow", func(c *gin.Context) {
+		time.Sleep(5 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+
+	server := httptest.NewUnstartedServer(srv.router)
+	server.Config.ConnState = srv.queueing.connState
+	server.Config.ConnContext = srv.queueing.connContext
+	server.Start()
+	defer server.Close()
+
+	for i := 0; i < 3; i++ {
+		resp, err := server.Client().Get(server.URL + "/slow")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := server.Client().Get(server.URL + "/metrics/queueing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		QueueWait   map[string]float64 `json:"queue_wait"`
+		ServiceTime map[string]float64 `json:"service_time"`
+		Connections map[string]int64   `json:"connections"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	// The metrics request itself is measured before its handler runs.
+	if body.QueueWait["count"] != 4 {
+		t.Errorf("Expected 4 queue wait samples, got %v", body.QueueWait["count"])
+	}
+	if body.ServiceTime["mean_ms"] < 5 {
+		t.Errorf("Expected mean service time of at least 5ms, got %v", body.ServiceTime["mean_ms"])
+	}
+	if body.Connections["accepted"] < 1 {
+		t.Errorf("Expected at least 1 accepted connection, got %v", body.Connections["accepted"])
+	}
+}
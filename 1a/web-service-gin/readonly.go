@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOnlyMiddleware rejects every request that could change data, i.e. any method other than
+// GET, HEAD, and OPTIONS, with HTTP 503 status and, if primary is set, the URL of the same
+// endpoint on the primary server, which takes writes. It lets read-only replicas sit behind the
+// read path of a load balancer without accepting writes that would be lost or diverge.
+func readOnlyMiddleware(primary string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		body := gin.H{"error": "This server is read-only; send writes to the primary"}
+		if primary != "" {
+			body["primary"] = primary + c.Request.URL.RequestURI()
+		}
+		c.IndentedJSON(http.StatusServiceUnavailable, body)
+		c.Abort()
+	}
+}
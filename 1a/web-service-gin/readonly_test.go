@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestReadOnlyMode tests a server started with READ_ONLY.
+// Verifies that reads still work and that writes are rejected with 503, point to the same endpoint
+// on the primary, and leave the store unchanged.
+func TestReadOnlyMode(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.ReadOnly = true
+		cfg.PrimaryURL = "http://primary:8080"
+	})
+
+	for _, path := range []string{"/", "/albums", "/albums/550e8400-e29b-41d4-a716-446655440001"} {
+		if w := srv.do("GET", path, ""); w.Code != 200 {
+			t.Errorf("GET %s: expected 200, got %d", path, w.Code)
+		}
+	}
+
+	w := srv.do("POST", "/albums?dry_run=false", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}`)
+	var resp struct {
+		Primary string `json:"primary"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 503 || resp.Primary != "http://primary:8080/albums?dry_run=false" {
+		t.Errorf("Expected 503 pointing to the primary, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440001", "", "If-Match", "*"); w.Code != 503 {
+		t.Errorf("Expected 503 for a delete, got %d", w.Code)
+	}
+	if all, _ := srv.store.List(t.Context()); len(all) != 3 {
+		t.Errorf("Expected the store to be unchanged, got %d albums", len(all))
+	}
+}
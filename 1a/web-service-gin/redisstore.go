@@ -0,0 +1,613 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisMaxAttempts is how many times a write is retried when a watched key changes before it commits.
+const redisMaxAttempts = 10
+
+// errRedisConflict is returned when an album keeps changing underneath a write.
+var errRedisConflict = errors.New("album was modified concurrently; try again")
+
+// redisStore keeps albums in Redis so several server instances can share them. Each album is a
+// hash at <prefix>:album:<id> with one field per JSON attribute, holding that attribute's JSON
+// value. <prefix>:ids is a sorted set of album IDs scored by creation time, used for listing,
+// <prefix>:upc:<normalized code> maps each barcode to its album, and <prefix>:album-name:<name
+// key> is the set of IDs of the albums with a title and artist (see albumNameKey). Each artist is
+// a JSON document at <prefix>:artist:<id>, listed in the set <prefix>:artists, and
+// <prefix>:artist-name:<name key> maps its name (see artistKey) to it. Writes use WATCH/MULTI
+// so concurrent instances never interleave partial updates.
+type redisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// newRedisStore connects to cfg.RedisURL and checks that the server responds.
+func newRedisStore(cfg Config) (AlbumStore, error) {
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	s := &redisStore{client: client, prefix: cfg.RedisKeyPrefix}
+	if err := s.indexAlbumNames(ctx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("index album names: %w", err)
+	}
+	return s, nil
+}
+
+// albumKey returns the key of the hash holding album id.
+func (s *redisStore) albumKey(id string) string {
+	return s.prefix + ":album:" + id
+}
+
+// idsKey returns the key of the sorted set of album IDs.
+func (s *redisStore) idsKey() string {
+	return s.prefix + ":ids"
+}
+
+// upcKey returns the key reserving a barcode.
+func (s *redisStore) upcKey(code string) string {
+	return s.prefix + ":upc:" + normalizeUPC(code)
+}
+
+// albumNamesKey returns the key of the set of IDs of the albums with a's title and artist.
+func (s *redisStore) albumNamesKey(a Album) string {
+	return s.prefix + ":album-name:" + albumNameKey(a.Title, a.Artist)
+}
+
+// artistDocKey returns the key of the JSON document of artist id.
+func (s *redisStore) artistDocKey(id string) string {
+	return s.prefix + ":artist:" + id
+}
+
+// artistNameKey returns the key reserving an artist name.
+func (s *redisStore) artistNameKey(name string) string {
+	return s.prefix + ":artist-name:" + artistKey(name)
+}
+
+// artistsKey returns the key of the set of artist IDs.
+func (s *redisStore) artistsKey() string {
+	return s.prefix + ":artists"
+}
+
+// redisFields encodes a as hash fields, one per JSON attribute.
+func redisFields(a Album) (map[string]any, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]any, len(attrs))
+	for name, value := range attrs {
+		fields[name] = string(value)
+	}
+	return fields, nil
+}
+
+// decodeRedisFields rebuilds an album from its hash fields.
+// Returns errAlbumNotFound if the hash is empty.
+func decodeRedisFields(fields map[string]string) (Album, error) {
+	if len(fields) == 0 {
+		return Album{}, errAlbumNotFound
+	}
+	attrs := make(map[string]json.RawMessage, len(fields))
+	for name, value := range fields {
+		attrs[name] = json.RawMessage(value)
+	}
+	data, err := json.Marshal(attrs)
+	if err != nil {
+		return Album{}, err
+	}
+	var a Album
+	err = json.Unmarshal(data, &a)
+	return a, err
+}
+
+// watch runs fn in a WATCH transaction on keys, retrying if a watched key changes before it commits.
+func (s *redisStore) watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	for attempt := 0; attempt < redisMaxAttempts; attempt++ {
+		err := s.client.Watch(ctx, fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return errRedisConflict
+}
+
+// List returns every album in creation order.
+func (s *redisStore) List(ctx context.Context) ([]Album, error) {
+	ids, err := s.client.ZRange(ctx, s.idsKey(), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.albumsByID(ctx, s.client, ids)
+}
+
+// albumsByID reads the albums with the given IDs through c, the client or a WATCH transaction,
+// skipping those that no longer exist.
+func (s *redisStore) albumsByID(ctx context.Context, c redis.Cmdable, ids []string) ([]Album, error) {
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	_, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, s.albumKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]Album, 0, len(ids))
+	for _, cmd := range cmds {
+		a, err := decodeRedisFields(cmd.Val())
+		if errors.Is(err, errAlbumNotFound) {
+			// Deleted between reading the IDs and the hashes.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, a)
+	}
+	return all, nil
+}
+
+// Get returns the album with the given ID.
+func (s *redisStore) Get(ctx context.Context, id string) (Album, error) {
+	fields, err := s.client.HGetAll(ctx, s.albumKey(id)).Result()
+	if err != nil {
+		return Album{}, err
+	}
+	return decodeRedisFields(fields)
+}
+
+// GetByUPC follows the barcode key to its album.
+func (s *redisStore) GetByUPC(ctx context.Context, code string) (Album, error) {
+	id, err := s.client.Get(ctx, s.upcKey(code)).Result()
+	if errors.Is(err, redis.Nil) {
+		return Album{}, errAlbumNotFound
+	}
+	if err != nil {
+		return Album{}, err
+	}
+	return s.Get(ctx, id)
+}
+
+// Create writes the album hash, adds its ID to the listing set and its name set, and reserves its
+// barcode atomically.
+func (s *redisStore) Create(ctx context.Context, a Album) (Album, error) {
+	return s.create(ctx, a, false)
+}
+
+// CreateUnique creates the album like Create, unless its name set already holds an album.
+func (s *redisStore) CreateUnique(ctx context.Context, a Album) (Album, error) {
+	return s.create(ctx, a, true)
+}
+
+// create writes the album, first checking its name set for a duplicate if unique is set.
+func (s *redisStore) create(ctx context.Context, a Album, unique bool) (Album, error) {
+	fields, err := redisFields(a)
+	if err != nil {
+		return Album{}, err
+	}
+	keys := []string{s.albumKey(a.ID), s.albumNamesKey(a)}
+	if a.UPC != "" {
+		keys = append(keys, s.upcKey(a.UPC))
+	}
+
+	err = s.watch(ctx, func(tx *redis.Tx) error {
+		if unique {
+			if err := s.checkDuplicate(ctx, tx, a); err != nil {
+				return err
+			}
+		}
+		if a.UPC != "" {
+			taken, err := tx.Exists(ctx, s.upcKey(a.UPC)).Result()
+			if err != nil {
+				return err
+			}
+			if taken > 0 {
+				return errUPCConflict
+			}
+		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, s.albumKey(a.ID), fields)
+			pipe.ZAdd(ctx, s.idsKey(), redis.Z{Score: float64(time.Now().UnixMicro()), Member: a.ID})
+			pipe.SAdd(ctx, s.albumNamesKey(a), a.ID)
+			if a.UPC != "" {
+				pipe.Set(ctx, s.upcKey(a.UPC), a.ID, 0)
+			}
+			return nil
+		})
+		return err
+	}, keys...)
+	if err != nil {
+		return Album{}, err
+	}
+	return a, nil
+}
+
+// Update reads the album, applies mutate, and replaces the hash, moving the barcode
+// reservation and name set entry if the UPC or name changed. The whole read-modify-write is
+// retried if the album, the new barcode key, or the new name set changes before it commits.
+func (s *redisStore) Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, false)
+}
+
+// UpdateUnique updates the album like Update, unless mutate gives it the title and artist of
+// another album.
+func (s *redisStore) UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, true)
+}
+
+// update applies mutate to the album, checking the new name set for a duplicate if unique is set
+// and the name changed.
+func (s *redisStore) update(ctx context.Context, id string, mutate func(*Album) error, unique bool) (Album, error) {
+	var updated Album
+	err := s.watch(ctx, func(tx *redis.Tx) error {
+		fields, err := tx.HGetAll(ctx, s.albumKey(id)).Result()
+		if err != nil {
+			return err
+		}
+		current, err := decodeRedisFields(fields)
+		if err != nil {
+			return err
+		}
+		updated = current
+		if err := mutate(&updated); err != nil {
+			return err
+		}
+		updated.ID = id
+
+		nameChanged := s.albumNamesKey(current) != s.albumNamesKey(updated)
+		if nameChanged && unique {
+			if err := tx.Watch(ctx, s.albumNamesKey(updated)).Err(); err != nil {
+				return err
+			}
+			if err := s.checkDuplicate(ctx, tx, updated); err != nil {
+				return err
+			}
+		}
+		upcChanged := current.UPC == "" || updated.UPC == "" || normalizeUPC(current.UPC) != normalizeUPC(updated.UPC)
+		if upcChanged && updated.UPC != "" {
+			newKey := s.upcKey(updated.UPC)
+			if err := tx.Watch(ctx, newKey).Err(); err != nil {
+				return err
+			}
+			owner, err := tx.Get(ctx, newKey).Result()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			if err == nil && owner != id {
+				return errUPCConflict
+			}
+		}
+
+		newFields, err := redisFields(updated)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			// Replace the whole hash so attributes that became empty are removed.
+			pipe.Del(ctx, s.albumKey(id))
+			pipe.HSet(ctx, s.albumKey(id), newFields)
+			if nameChanged {
+				pipe.SRem(ctx, s.albumNamesKey(current), id)
+				pipe.SAdd(ctx, s.albumNamesKey(updated), id)
+			}
+			if upcChanged {
+				if current.UPC != "" {
+					pipe.Del(ctx, s.upcKey(current.UPC))
+				}
+				if updated.UPC != "" {
+					pipe.Set(ctx, s.upcKey(updated.UPC), id, 0)
+				}
+			}
+			return nil
+		})
+		return err
+	}, s.albumKey(id))
+	if err != nil {
+		return Album{}, err
+	}
+	return updated, nil
+}
+
+// Delete removes the album hash, its listing and name set entries, and its barcode reservation
+// atomically.
+func (s *redisStore) Delete(ctx context.Context, id string) (Album, error) {
+	var deleted Album
+	err := s.watch(ctx, func(tx *redis.Tx) error {
+		fields, err := tx.HGetAll(ctx, s.albumKey(id)).Result()
+		if err != nil {
+			return err
+		}
+		if deleted, err = decodeRedisFields(fields); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, s.albumKey(id))
+			pipe.ZRem(ctx, s.idsKey(), id)
+			pipe.SRem(ctx, s.albumNamesKey(deleted), id)
+			if deleted.UPC != "" {
+				pipe.Del(ctx, s.upcKey(deleted.UPC))
+			}
+			return nil
+		})
+		return err
+	}, s.albumKey(id))
+	if err != nil {
+		return Album{}, err
+	}
+	return deleted, nil
+}
+
+// checkDuplicate returns a duplicateAlbumError if the name set of a, read in the WATCH
+// transaction tx, holds an album other than a.
+func (s *redisStore) checkDuplicate(ctx context.Context, tx *redis.Tx, a Album) error {
+	ids, err := tx.SMembers(ctx, s.albumNamesKey(a)).Result()
+	if err != nil {
+		return err
+	}
+	ids = slices.DeleteFunc(ids, func(id string) bool { return id == a.ID })
+	if len(ids) > 0 {
+		return duplicateAlbumError{ID: slices.Min(ids)}
+	}
+	return nil
+}
+
+// indexAlbumNames adds the albums stored before name sets existed to them, once, in one MULTI
+// retried if any album changes first. <prefix>:album-names-indexed records that it has run.
+func (s *redisStore) indexAlbumNames(ctx context.Context) error {
+	done := s.prefix + ":album-names-indexed"
+	return s.watch(ctx, func(tx *redis.Tx) error {
+		if indexed, err := tx.Exists(ctx, done).Result(); err != nil || indexed > 0 {
+			return err
+		}
+		albums, err := s.watchAlbums(ctx, tx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, a := range albums {
+				pipe.SAdd(ctx, s.albumNamesKey(a), a.ID)
+			}
+			pipe.Set(ctx, done, "1", 0)
+			return nil
+		})
+		return err
+	}, done, s.idsKey())
+}
+
+// ListArtists returns every artist in the artist set.
+func (s *redisStore) ListArtists(ctx context.Context) ([]Artist, error) {
+	ids, err := s.client.SMembers(ctx, s.artistsKey()).Result()
+	if err != nil || len(ids) == 0 {
+		return []Artist{}, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.artistDocKey(id)
+	}
+	docs, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	artists := make([]Artist, 0, len(docs))
+	for _, doc := range docs {
+		// Deleted between reading the IDs and the documents.
+		if doc, ok := doc.(string); ok {
+			var artist Artist
+			if err := json.Unmarshal([]byte(doc), &artist); err != nil {
+				return nil, err
+			}
+			artists = append(artists, artist)
+		}
+	}
+	return artists, nil
+}
+
+// GetArtist returns the artist with the given ID.
+func (s *redisStore) GetArtist(ctx context.Context, id string) (Artist, error) {
+	return s.readArtist(ctx, s.client, id)
+}
+
+// ArtistNamed follows the artist name key to its artist.
+func (s *redisStore) ArtistNamed(ctx context.Context, name string) (Artist, error) {
+	id, err := s.client.Get(ctx, s.artistNameKey(name)).Result()
+	if errors.Is(err, redis.Nil) {
+		return Artist{}, errArtistNotFound
+	}
+	if err != nil {
+		return Artist{}, err
+	}
+	return s.GetArtist(ctx, id)
+}
+
+// readArtist reads the artist with the given ID through c, the client or a WATCH transaction.
+func (s *redisStore) readArtist(ctx context.Context, c redis.Cmdable, id string) (Artist, error) {
+	doc, err := c.Get(ctx, s.artistDocKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Artist{}, errArtistNotFound
+	}
+	if err != nil {
+		return Artist{}, err
+	}
+	var artist Artist
+	err = json.Unmarshal(doc, &artist)
+	return artist, err
+}
+
+// CreateArtist writes the artist document, reserves its name, and adds it to the artist set
+// atomically, unless its name or ID is taken.
+func (s *redisStore) CreateArtist(ctx context.Context, artist Artist) error {
+	doc, err := json.Marshal(artist)
+	if err != nil {
+		return err
+	}
+	nameKey := s.artistNameKey(artist.Name)
+	return s.watch(ctx, func(tx *redis.Tx) error {
+		owner, err := tx.Get(ctx, nameKey).Result()
+		if err == nil {
+			return artistExistsError{owner}
+		}
+		if !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if taken, err := tx.Exists(ctx, s.artistDocKey(artist.ID)).Result(); err != nil || taken > 0 {
+			if err == nil {
+				err = artistExistsError{artist.ID}
+			}
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, s.artistDocKey(artist.ID), doc, 0)
+			pipe.Set(ctx, nameKey, artist.ID, 0)
+			pipe.SAdd(ctx, s.artistsKey(), artist.ID)
+			return nil
+		})
+		return err
+	}, s.artistDocKey(artist.ID), nameKey)
+}
+
+// creditedAlbums reads the albums credited to the artist with the given ID in the WATCH
+// transaction tx, watching every album, and the album listing, so the transaction fails if any
+// of them changes before it commits.
+func (s *redisStore) creditedAlbums(ctx context.Context, tx *redis.Tx, id string) ([]Album, error) {
+	albums, err := s.watchAlbums(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	return filterAlbums(albums, func(a Album) bool { return albumArtistID(a) == id }), nil
+}
+
+// watchAlbums reads every album in the WATCH transaction tx, watching each of them. The caller
+// watches the album listing.
+func (s *redisStore) watchAlbums(ctx context.Context, tx *redis.Tx) ([]Album, error) {
+	ids, err := tx.ZRange(ctx, s.idsKey(), 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, albumID := range ids {
+		keys[i] = s.albumKey(albumID)
+	}
+	if err := tx.Watch(ctx, keys...).Err(); err != nil {
+		return nil, err
+	}
+	return s.albumsByID(ctx, tx, ids)
+}
+
+// RenameArtist renames the artist, moves its name reservation, and replaces the hashes of its
+// albums and moves them to their new name sets in one MULTI, retried if the artist, the new name,
+// or any album changes first.
+func (s *redisStore) RenameArtist(ctx context.Context, id, name string, rename func(*Album)) (Artist, []albumChange, error) {
+	var (
+		artist  Artist
+		changes []albumChange
+	)
+	nameKey := s.artistNameKey(name)
+	err := s.watch(ctx, func(tx *redis.Tx) error {
+		current, err := s.readArtist(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		owner, err := tx.Get(ctx, nameKey).Result()
+		if err == nil && owner != id {
+			return artistExistsError{owner}
+		}
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		albums, err := s.creditedAlbums(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		artist = renamedArtist(current, name, time.Now().UTC())
+		doc, err := json.Marshal(artist)
+		if err != nil {
+			return err
+		}
+		changes = make([]albumChange, 0, len(albums))
+		fields := make([]map[string]any, 0, len(albums))
+		for _, a := range albums {
+			updated := a
+			rename(&updated)
+			updated.ID = a.ID
+			f, err := redisFields(updated)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, albumChange{Album: updated, Previous: a})
+			fields = append(fields, f)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, s.artistDocKey(id), doc, 0)
+			pipe.Del(ctx, s.artistNameKey(current.Name))
+			pipe.Set(ctx, nameKey, id, 0)
+			for i, change := range changes {
+				pipe.Del(ctx, s.albumKey(change.ID))
+				pipe.HSet(ctx, s.albumKey(change.ID), fields[i])
+				pipe.SRem(ctx, s.albumNamesKey(change.Previous), change.ID)
+				pipe.SAdd(ctx, s.albumNamesKey(change.Album), change.ID)
+			}
+			return nil
+		})
+		return err
+	}, s.artistDocKey(id), nameKey, s.idsKey())
+	if err != nil {
+		return Artist{}, nil, err
+	}
+	return artist, changes, nil
+}
+
+// DeleteArtist removes the artist, its name reservation, and its artist set entry in one MULTI,
+// retried if the artist or any album changes after they are checked.
+func (s *redisStore) DeleteArtist(ctx context.Context, id string) (Artist, error) {
+	var artist Artist
+	err := s.watch(ctx, func(tx *redis.Tx) error {
+		var err error
+		if artist, err = s.readArtist(ctx, tx, id); err != nil {
+			return err
+		}
+		albums, err := s.creditedAlbums(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if len(albums) > 0 {
+			return errArtistHasAlbums
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, s.artistDocKey(id))
+			pipe.Del(ctx, s.artistNameKey(artist.Name))
+			pipe.SRem(ctx, s.artistsKey(), id)
+			return nil
+		})
+		return err
+	}, s.artistDocKey(id), s.idsKey())
+	if err != nil {
+		return Artist{}, err
+	}
+	return artist, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// TestRedisStore tests the Redis AlbumStore against an in-process Redis server.
+// Verifies the AlbumStore contract, that a second store instance sees the same albums, and that
+// albums stored before album names were indexed are indexed when a store is opened.
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := loadConfig()
+	cfg.RedisURL = "redis://" + server.Addr()
+
+	s, err := newRedisStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAlbumStore(t, s)
+	testUniqueAlbumNames(t, s)
+	testArtistStore(t, s)
+
+	other, err := newRedisStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	created, err := s.Create(ctx, Album{ID: "shared", Title: "Blue Train", Artist: "John Coltrane", Price: 56.99})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, err := other.Get(ctx, "shared"); err != nil || !reflect.DeepEqual(a, created) {
+		t.Errorf("Expected the second instance to see %+v, got %+v, %v", created, a, err)
+	}
+
+	server.Del(cfg.RedisKeyPrefix + ":album-names-indexed")
+	server.Del(s.(*redisStore).albumNamesKey(created))
+	reopened, err := newRedisStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createUnique(ctx, reopened, Album{ID: "again", Title: "Blue Train", Artist: "John Coltrane", Price: 1}); !errors.As(err, new(duplicateAlbumError)) {
+		t.Errorf("Expected the unindexed album to be found as a duplicate, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// albumTransformer adjusts the JSON object of one outgoing album in place, e.g. removing or adding
+// fields. c is the request being answered.
+type albumTransformer func(c *gin.Context, album map[string]any)
+
+// albumTransformers are the transformers a route group's render pipeline can be built from, keyed
+// by the name used in RENDER_PIPELINES.
+var albumTransformers = map[string]albumTransformer{
+	"hide_price_unauthenticated": hidePriceUnauthenticated,
+	"price_display":              addPriceDisplay,
+}
+
+// renderPipeline is the ordered list of transformers applied to albums rendered by a route group.
+type renderPipeline []albumTransformer
+
+// renderPipelineKey is the gin context key holding the current route group's render pipeline.
+type renderPipelineKey struct{}
+
+// parseRenderPipelines parses a RENDER_PIPELINES value of the form
+// "/albums=hide_price_unauthenticated,price_display;/other=..." into pipelines keyed by route group
+// prefix. Returns an error naming the first unknown transformer or malformed entry.
+func parseRenderPipelines(spec string) (map[string]renderPipeline, error) {
+	pipelines := map[string]renderPipeline{}
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, names, ok := strings.Cut(entry, "=")
+		group = strings.TrimSpace(group)
+		if !ok || group == "" {
+			return nil, fmt.Errorf("render pipeline %q must look like /group=transformer,...", entry)
+		}
+		var p renderPipeline
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			t, ok := albumTransformers[name]
+			if !ok {
+				return nil, fmt.Errorf("render pipeline %s: unknown transformer %q", group, name)
+			}
+			p = append(p, t)
+		}
+		pipelines[group] = p
+	}
+	return pipelines, nil
+}
+
+// renderMiddleware makes handlers in a route group render albums through p.
+func renderMiddleware(p renderPipeline) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(p) > 0 {
+			c.Set(renderPipelineKey{}, p)
+		}
+		c.Next()
+	}
+}
+
+// transformAlbum returns a as it should be sent for this request: pipelineAlbum's result with
+// the album's _links section added, reduced to the fields selected with ?fields= if any.
+func transformAlbum(c *gin.Context, a Album) any {
+	a = convertPrice(c, absoluteImageURL(c, a))
+	links := linksFor(c, a.ID)
+	obj, ok := pipelineAlbum(c, a).(map[string]any)
+	if !ok {
+		if selectedFields(c) == nil {
+			return linkedAlbum{Album: a, Links: links}
+		}
+		var err error
+		if obj, err = albumObject(a); err != nil {
+			return linkedAlbum{Album: a, Links: links}
+		}
+	}
+	obj[linksField] = links
+	selectFields(c, obj)
+	return obj
+}
+
+// pipelineAlbum returns the data of a as it should be sent for this request, without links:
+// unchanged if the route group has no render pipeline, otherwise its JSON object after every
+// transformer has run.
+func pipelineAlbum(c *gin.Context, a Album) any {
+	a = convertPrice(c, absoluteImageURL(c, a))
+	p, _ := c.Get(renderPipelineKey{})
+	pipeline, _ := p.(renderPipeline)
+	if len(pipeline) == 0 {
+		return a
+	}
+
+	obj, err := albumObject(a)
+	if err != nil {
+		return a
+	}
+	for _, transform := range pipeline {
+		transform(c, obj)
+	}
+	return obj
+}
+
+// albumObject returns the JSON object of a.
+func albumObject(a Album) (map[string]any, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]any
+	err = json.Unmarshal(data, &obj)
+	return obj, err
+}
+
+// renderAlbum writes a through the route group's render pipeline as JSON with the given status,
+// together with the validation warnings of the request, if any (see setWarnings).
+func renderAlbum(c *gin.Context, status int, a Album) {
+	c.IndentedJSON(status, withWarnings(c, transformAlbum(c, a)))
+}
+
+// transformAlbums returns every album in list as transformAlbum would.
+func transformAlbums(c *gin.Context, list []Album) []any {
+	out := make([]any, len(list))
+	for i, a := range list {
+		out[i] = transformAlbum(c, a)
+	}
+	return out
+}
+
+// renderAlbums writes every album in list through the route group's render pipeline as a JSON
+// array with the given status.
+func renderAlbums(c *gin.Context, status int, list []Album) {
+	c.IndentedJSON(status, transformAlbums(c, list))
+}
+
+// authenticated reports whether the request carries one of the server's API keys (see identity).
+func authenticated(c *gin.Context) bool {
+	return identityFrom(c.Request.Context()).Authenticated
+}
+
+// hidePriceUnauthenticated removes the price from albums sent to requests without a valid API key.
+func hidePriceUnauthenticated(c *gin.Context, album map[string]any) {
+	if !authenticated(c) {
+		delete(album, "price")
+	}
+}
+
+// addPriceDisplay adds "price_display", the price formatted for display in its currency (e.g.
+// "$56.99", "€52.43", or "CHF 50.12"). Does nothing if an earlier transformer removed the price.
+func addPriceDisplay(c *gin.Context, album map[string]any) {
+	price, ok := album["price"].(float64)
+	if !ok {
+		return
+	}
+	currency, _ := album["currency"].(string)
+	currency = cmp.Or(currency, baseCurrency)
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency + " "
+	}
+	album["price_display"] = fmt.Sprintf("%s%.2f", symbol, math.Round(price*100)/100)
+}
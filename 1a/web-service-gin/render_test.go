@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// setupRenderServer returns a server whose /albums group renders through the given
+// RENDER_PIPELINES spec, accepting the API key "secret".
+func setupRenderServer(t *testing.T, spec string) *Server {
+	t.Helper()
+	return newTestServer(t, func(cfg *Config) {
+		cfg.RenderPipelines = spec
+		cfg.APIKeys = []string{"secret"}
+	})
+}
+
+// TestParseRenderPipelines tests parsing of RENDER_PIPELINES.
+// Verifies that pipelines are keyed by group, and that unknown transformers and malformed entries are rejected.
+func TestParseRenderPipelines(t *testing.T) {
+	pipelines, err := parseRenderPipelines(" /albums = hide_price_unauthenticated, price_display ; /other=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pipelines["/albums"]) != 2 || len(pipelines["/other"]) != 0 {
+		t.Errorf("Expected 2 transformers for /albums and none for /other, got %v", pipelines)
+	}
+
+	for _, spec := range []string{"/albums=nope", "hide_price_unauthenticated", "=price_display"} {
+		if _, err := parseRenderPipelines(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+// TestRenderPipelineHidesPrice tests the hide_price_unauthenticated transformer.
+// Verifies that prices are removed for anonymous and invalid keys and kept for a valid API key.
+func TestRenderPipelineHidesPrice(t *testing.T) {
+	srv := setupRenderServer(t, "/albums=hide_price_unauthenticated")
+
+	for _, tc := range []struct {
+		auth      string
+		wantPrice bool
+	}{
+		{"", false},
+		{"Bearer wrong", false},
+		{"secret", false},
+		{"Bearer secret", true},
+	} {
+		w := srv.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440001", "", "Authorization", tc.auth)
+
+		var album map[string]any
+		json.Unmarshal(w.Body.Bytes(), &album)
+		if _, ok := album["price"]; ok != tc.wantPrice {
+			t.Errorf("Authorization %q: expected price present=%v, got %v", tc.auth, tc.wantPrice, album)
+		}
+		if album["title"] != "Blue Train" {
+			t.Errorf("Expected the rest of the album, got %v", album)
+		}
+	}
+}
+
+// TestRenderPipelineComputedField tests that transformers run in order on listings and the full view.
+// Verifies that price_display is added, and is not added once an earlier transformer removed the price.
+func TestRenderPipelineComputedField(t *testing.T) {
+	srv := setupRenderServer(t, "/albums=price_display")
+
+	w := srv.do("GET", "/albums", "")
+	var list []map[string]any
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list) != 3 || list[0]["price_display"] != "$56.99" {
+		t.Errorf("Expected price_display on every album, got %v", list)
+	}
+
+	w = srv.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440002/full", "")
+	var full struct {
+		Album map[string]any `json:"album"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &full)
+	if full.Album["price_display"] != "$17.99" {
+		t.Errorf("Expected price_display in the full view, got %v", full.Album)
+	}
+
+	srv = setupRenderServer(t, "/albums=hide_price_unauthenticated,price_display")
+	w = srv.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440002", "")
+	var album map[string]any
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if _, ok := album["price_display"]; ok {
+		t.Errorf("Expected no price_display without a price, got %v", album)
+	}
+}
+
+// TestRenderWithoutPipeline tests that route groups without a pipeline render albums unchanged.
+func TestRenderWithoutPipeline(t *testing.T) {
+	srv := setupRenderServer(t, "")
+
+	w := srv.do("GET", "/albums/550e8400-e29b-41d4-a716-446655440003", "")
+
+	var album map[string]any
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if album["price"] != 39.99 || album["price_display"] != nil {
+		t.Errorf("Expected the album unchanged, got %v", album)
+	}
+}
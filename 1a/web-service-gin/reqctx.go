@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// The request scope is what cross-cutting features need to know about the request being served:
+// its ID, who it acts as, the tenant it acts for, and its deadline. Each value is carried by the
+// request's context.Context, so stores and anything else handed the context see it too, and is
+// only read and set through the typed functions below, never by a string key.
+
+// requestIDHeader names the header carrying a request's ID. A client may send one to correlate its
+// logs with the server's; otherwise one is generated. Either way it is echoed on the response.
+const requestIDHeader = "X-Request-ID"
+
+// actorHeader names the header identifying the person or system a request acts for.
+const actorHeader = "X-Actor"
+
+type (
+	// requestIDKey is the context key holding the request ID.
+	requestIDKey struct{}
+	// identityKey is the context key holding the identity of the request.
+	identityKey struct{}
+	// tenantKey is the context key holding the tenant ID.
+	tenantKey struct{}
+)
+
+// identity is who a request acts as: the actor it names, or else the client IP, and whether it
+// carries one of the server's API keys.
+type identity struct {
+	Actor         string
+	Authenticated bool
+}
+
+// withRequestID returns a copy of ctx carrying the request ID id.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFrom returns the request ID carried by ctx, or "" if there is none.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withIdentity returns a copy of ctx carrying id.
+func withIdentity(ctx context.Context, id identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// identityFrom returns the identity carried by ctx, or the zero identity, anonymous and
+// unauthenticated, if there is none.
+func identityFrom(ctx context.Context) identity {
+	id, _ := ctx.Value(identityKey{}).(identity)
+	return id
+}
+
+// withTenant returns a copy of ctx carrying tenant.
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantFrom returns the tenant carried by ctx, or "" if there is none.
+func tenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// withDeadline returns a copy of ctx that is cancelled at deadline, or earlier if ctx already has
+// an earlier deadline. The caller must call cancel once done, as with context.WithDeadline.
+func withDeadline(ctx context.Context, deadline time.Time) (_ context.Context, cancel context.CancelFunc) {
+	return context.WithDeadline(ctx, deadline)
+}
+
+// deadlineFrom returns the deadline of ctx and true, or false if it has none.
+func deadlineFrom(ctx context.Context) (time.Time, bool) {
+	return ctx.Deadline()
+}
+
+// requestScopeMiddleware fills in the request scope of every request: its ID, from the
+// X-Request-ID header or newly generated, its identity, from the X-Actor and Authorization headers
+// checked against apiKeys, and its tenant, from the X-Tenant-ID header, so the album store can
+// route the request to the tenant's backend.
+func requestScopeMiddleware(apiKeys []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" {
+			id = uuid.New().String()
+		}
+		c.Header(requestIDHeader, id)
+
+		who := identity{Actor: c.GetHeader(actorHeader), Authenticated: validAPIKey(c.GetHeader("Authorization"), apiKeys)}
+		if who.Actor == "" {
+			who.Actor = c.ClientIP()
+		}
+
+		ctx := withIdentity(withRequestID(c.Request.Context(), id), who)
+		if tenant := c.GetHeader(tenantHeader); tenant != "" {
+			ctx = withTenant(ctx, tenant)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// validAPIKey reports whether authorization is "Bearer <key>" with one of apiKeys.
+func validAPIKey(authorization string, apiKeys []string) bool {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	for _, key := range apiKeys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
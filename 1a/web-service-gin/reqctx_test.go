@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRequestScope tests that requestScopeMiddleware fills in the request scope.
+// Verifies that a request ID is echoed or generated, and that the identity and tenant come from
+// the X-Actor, Authorization, and X-Tenant-ID headers, with the client IP as the default actor.
+func TestRequestScope(t *testing.T) {
+	var got context.Context
+	router := gin.New()
+	router.Use(requestScopeMiddleware([]string{"secret"}))
+	router.GET("/", func(c *gin.Context) { got = c.Request.Context() })
+	serve := func(header map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/", nil)
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(nil)
+	if id := w.Header().Get(requestIDHeader); id == "" || requestIDFrom(got) != id {
+		t.Errorf("Expected a generated request ID, got header %q and context %q", id, requestIDFrom(got))
+	}
+	if who := identityFrom(got); who != (identity{Actor: "192.0.2.1"}) || tenantFrom(got) != "" {
+		t.Errorf("Expected an anonymous request from the client IP, got %+v, tenant %q", who, tenantFrom(got))
+	}
+
+	w = serve(map[string]string{
+		requestIDHeader: "req-1",
+		actorHeader:     "grader",
+		"Authorization": "Bearer secret",
+		tenantHeader:    "acme",
+	})
+	if w.Header().Get(requestIDHeader) != "req-1" || requestIDFrom(got) != "req-1" {
+		t.Errorf("Expected the client's request ID to be kept, got %q", w.Header().Get(requestIDHeader))
+	}
+	if who := identityFrom(got); who != (identity{Actor: "grader", Authenticated: true}) || tenantFrom(got) != "acme" {
+		t.Errorf("Expected grader authenticated for acme, got %+v, tenant %q", who, tenantFrom(got))
+	}
+
+	serve(map[string]string{"Authorization": "Bearer wrong"})
+	if identityFrom(got).Authenticated {
+		t.Error("Expected an unknown API key not to authenticate")
+	}
+}
+
+// TestDeadline tests that withDeadline keeps the earlier of two deadlines and deadlineFrom reads it.
+func TestDeadline(t *testing.T) {
+	if _, ok := deadlineFrom(context.Background()); ok {
+		t.Error("Expected no deadline on a background context")
+	}
+	soon := time.Now().Add(time.Minute)
+	ctx, cancel := withDeadline(context.Background(), soon)
+	defer cancel()
+	ctx, cancel = withDeadline(ctx, soon.Add(time.Hour))
+	defer cancel()
+	if deadline, ok := deadlineFrom(ctx); !ok || !deadline.Equal(soon) {
+		t.Errorf("Expected the earlier deadline %v, got %v, %v", soon, deadline, ok)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// searchFilter selects albums. Every field that is set must match; text comparisons ignore case.
+type searchFilter struct {
+	Artist        string   `json:"artist,omitempty"`
+	TitleContains string   `json:"title_contains,omitempty"`
+	MinPrice      *float64 `json:"min_price,omitempty"`
+	MaxPrice      *float64 `json:"max_price,omitempty"`
+}
+
+// validate returns an error message if the filter is empty or its price range is invalid.
+func (f searchFilter) validate() string {
+	if f.Artist == "" && f.TitleContains == "" && f.MinPrice == nil && f.MaxPrice == nil {
+		return "filter must set at least one of artist, title_contains, min_price, or max_price"
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		return "min_price must not be greater than max_price"
+	}
+	return ""
+}
+
+// matches reports whether album a satisfies the filter.
+func (f searchFilter) matches(a Album) bool {
+	if f.Artist != "" && !strings.EqualFold(f.Artist, a.Artist) {
+		return false
+	}
+	if f.TitleContains != "" && !strings.Contains(strings.ToLower(a.Title), strings.ToLower(f.TitleContains)) {
+		return false
+	}
+	if f.MinPrice != nil && a.Price < *f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != nil && a.Price > *f.MaxPrice {
+		return false
+	}
+	return true
+}
+
+// savedSearch is a filter registered by a client, notified whenever a newly created album matches.
+type savedSearch struct {
+	ID         string       `json:"id"`
+	Filter     searchFilter `json:"filter"`
+	WebhookURL string       `json:"webhook_url,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// savedSearchMatch is the payload sent to webhooks and SSE streams when an album matches.
+type savedSearchMatch struct {
+	SavedSearchID string `json:"saved_search_id"`
+	Event         string `json:"event"`
+	Album         Album  `json:"album"`
+}
+
+// savedSearchQueueSize bounds the webhook deliveries waiting to be sent; extra matches are dropped.
+const savedSearchQueueSize = 256
+
+// savedSearchStreamBuffer is how many matches an SSE client may fall behind before it is dropped.
+const savedSearchStreamBuffer = 16
+
+// savedSearchRegistry holds saved searches and delivers their matches. Searches with an artist
+// filter are indexed by lowercased artist, so each new album is only checked against searches
+// for its artist plus those without an artist filter.
+type savedSearchRegistry struct {
+	mu        sync.RWMutex
+	searches  map[string]*savedSearch
+	byArtist  map[string][]*savedSearch
+	anyArtist []*savedSearch
+	streams   map[string]map[chan savedSearchMatch]struct{}
+	// dropped counts the streams closed because their client fell too far behind.
+	dropped atomic.Int64
+
+	webhooks *outboundClient
+	queue    chan webhookDelivery
+}
+
+// webhookDelivery is a match waiting to be posted to a saved search's webhook.
+type webhookDelivery struct {
+	url   string
+	match savedSearchMatch
+}
+
+// newSavedSearchRegistry creates an empty registry and starts its webhook delivery goroutine.
+// The webhook client is registered in outbound.
+func newSavedSearchRegistry(cfg Config, outbound *outboundRegistry) *savedSearchRegistry {
+	r := &savedSearchRegistry{
+		searches: map[string]*savedSearch{},
+		byArtist: map[string][]*savedSearch{},
+		streams:  map[string]map[chan savedSearchMatch]struct{}{},
+		webhooks: outbound.newClient("saved-search-webhooks", cfg),
+		queue:    make(chan webhookDelivery, savedSearchQueueSize),
+	}
+	go r.deliver()
+	return r
+}
+
+// add registers s.
+func (r *savedSearchRegistry) add(s *savedSearch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.searches[s.ID] = s
+	if s.Filter.Artist == "" {
+		r.anyArtist = append(r.anyArtist, s)
+		return
+	}
+	key := strings.ToLower(s.Filter.Artist)
+	r.byArtist[key] = append(r.byArtist[key], s)
+}
+
+// remove unregisters the search with the given ID and closes its streams.
+// Returns false if there is no such search.
+func (r *savedSearchRegistry) remove(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.searches[id]
+	if !ok {
+		return false
+	}
+	delete(r.searches, id)
+	without := func(list []*savedSearch) []*savedSearch {
+		out := list[:0:0]
+		for _, other := range list {
+			if other.ID != id {
+				out = append(out, other)
+			}
+		}
+		return out
+	}
+	if s.Filter.Artist == "" {
+		r.anyArtist = without(r.anyArtist)
+	} else {
+		key := strings.ToLower(s.Filter.Artist)
+		if r.byArtist[key] = without(r.byArtist[key]); len(r.byArtist[key]) == 0 {
+			delete(r.byArtist, key)
+		}
+	}
+	for ch := range r.streams[id] {
+		close(ch)
+	}
+	delete(r.streams, id)
+	return true
+}
+
+// get returns the search with the given ID.
+func (r *savedSearchRegistry) get(id string) (*savedSearch, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.searches[id]
+	return s, ok
+}
+
+// list returns every saved search, oldest first.
+func (r *savedSearchRegistry) list() []*savedSearch {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := make([]*savedSearch, 0, len(r.searches))
+	for _, s := range r.searches {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].CreatedAt.Before(all[j].CreatedAt) })
+	return all
+}
+
+// subscribe opens a stream of matches for the search with the given ID.
+// Returns false if there is no such search. The channel is closed when the search is removed.
+func (r *savedSearchRegistry) subscribe(id string) (chan savedSearchMatch, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.searches[id]; !ok {
+		return nil, false
+	}
+	ch := make(chan savedSearchMatch, savedSearchStreamBuffer)
+	if r.streams[id] == nil {
+		r.streams[id] = map[chan savedSearchMatch]struct{}{}
+	}
+	r.streams[id][ch] = struct{}{}
+	return ch, true
+}
+
+// unsubscribe closes a stream opened by subscribe, unless the search removal or drop already
+// closed it.
+func (r *savedSearchRegistry) unsubscribe(id string, ch chan savedSearchMatch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.streams[id][ch]; ok {
+		delete(r.streams[id], ch)
+		close(ch)
+	}
+}
+
+// drop closes a stream opened by subscribe whose client has fallen too far behind, leaving the
+// search in place, and counts it. The stream's handler tells the client it was dropped.
+func (r *savedSearchRegistry) drop(id string, ch chan savedSearchMatch) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.streams[id][ch]; ok {
+		delete(r.streams[id], ch)
+		close(ch)
+		r.dropped.Add(1)
+	}
+}
+
+// handle is the album event subscriber. It checks newly created albums against the candidate
+// searches and hands matches to webhooks and open streams without blocking. Streams whose buffer
+// is full are closed (see drop), as the client has fallen too far behind.
+func (r *savedSearchRegistry) handle(evt albumEvent) {
+	if evt.Type != eventAlbumCreated {
+		return
+	}
+	type stream struct {
+		id string
+		ch chan savedSearchMatch
+	}
+	var behind []stream
+	defer func() {
+		for _, s := range behind {
+			r.drop(s.id, s.ch)
+		}
+	}()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, candidates := range [][]*savedSearch{r.byArtist[strings.ToLower(evt.Album.Artist)], r.anyArtist} {
+		for _, s := range candidates {
+			if !s.Filter.matches(evt.Album) {
+				continue
+			}
+			match := savedSearchMatch{SavedSearchID: s.ID, Event: evt.Type, Album: evt.Album}
+			if s.WebhookURL != "" {
+				select {
+				case r.queue <- webhookDelivery{url: s.WebhookURL, match: match}:
+				default:
+					log.Printf("saved search %s: webhook queue full, dropping match", s.ID)
+				}
+			}
+			for ch := range r.streams[s.ID] {
+				select {
+				case ch <- match:
+				default:
+					behind = append(behind, stream{s.ID, ch})
+				}
+			}
+		}
+	}
+}
+
+// deliver posts queued matches to their webhooks.
+func (r *savedSearchRegistry) deliver() {
+	for d := range r.queue {
+		if err := r.post(d); err != nil {
+			log.Printf("saved search %s: webhook: %v", d.match.SavedSearchID, err)
+		}
+	}
+}
+
+// post sends one match to its webhook.
+func (r *savedSearchRegistry) post(d webhookDelivery) error {
+	payload, err := json.Marshal(d.match)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notificationSendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.webhooks.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// postSavedSearch handles POST /saved-searches requests.
+// Registers a filter and an optional webhook URL, returning the saved search with HTTP 201 status.
+// Returns HTTP 400 if the JSON, filter, or webhook URL is invalid.
+func (srv *Server) postSavedSearch(c *gin.Context) {
+	var s savedSearch
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid JSON",
+			"details": err.Error(),
+		})
+		return
+	}
+	if errMsg := s.Filter.validate(); errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	if s.WebhookURL != "" {
+		u, err := url.Parse(s.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "webhook_url must be an absolute http or https URL"})
+			return
+		}
+	}
+
+	s.ID = uuid.New().String()
+	s.CreatedAt = time.Now().UTC()
+	srv.savedSearches.add(&s)
+	c.IndentedJSON(http.StatusCreated, s)
+}
+
+// getSavedSearches handles GET /saved-searches requests.
+// Returns every saved search as a JSON array with HTTP 200 status.
+func (srv *Server) getSavedSearches(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, srv.savedSearches.list())
+}
+
+// getSavedSearch handles GET /saved-searches/:id requests.
+// Returns the saved search as JSON with HTTP 200 status, or HTTP 404 if it does not exist.
+func (srv *Server) getSavedSearch(c *gin.Context) {
+	s, ok := srv.savedSearches.get(c.Param("id"))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "saved search not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, s)
+}
+
+// deleteSavedSearch handles DELETE /saved-searches/:id requests.
+// Removes the saved search and ends its event streams. Returns HTTP 204, or HTTP 404 if it does not exist.
+func (srv *Server) deleteSavedSearch(c *gin.Context) {
+	if !srv.savedSearches.remove(c.Param("id")) {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "saved search not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// streamSavedSearch handles GET /saved-searches/:id/events requests.
+// Streams a server-sent "match" event with the album for every newly created album that matches,
+// until the client disconnects or the saved search is deleted. A client that falls 16 matches
+// behind is sent a "dropped" event and disconnected, and should reconnect and catch up from GET
+// /albums. A heartbeat comment is sent every STREAM_HEARTBEAT_INTERVAL, and the client is listed
+// by GET /admin/subscribers while connected. Returns HTTP 404 if it does not exist.
+func (srv *Server) streamSavedSearch(c *gin.Context) {
+	id := c.Param("id")
+	ch, ok := srv.savedSearches.subscribe(id)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "saved search not found"})
+		return
+	}
+	defer srv.savedSearches.unsubscribe(id, ch)
+	client := srv.streams.connect(c, streamSavedSearch)
+	defer srv.streams.disconnect(client)
+	heartbeats, stop := srv.heartbeatTicker()
+	defer stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	// Send the headers right away so clients know the stream is open before the first match.
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case match, open := <-ch:
+			if !open {
+				if _, exists := srv.savedSearches.get(id); exists {
+					c.SSEvent("dropped", gin.H{"reason": "client fell too far behind"})
+				}
+				return false
+			}
+			c.SSEvent("match", match)
+			client.sentEvents(1)
+			return true
+		case <-heartbeats:
+			client.heartbeat(c, w)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSavedSearchWebhook tests POST /saved-searches with a webhook.
+// Verifies that invalid filters are rejected, and that only newly created albums matching
+// the filter are posted to the webhook.
+func TestSavedSearchWebhook(t *testing.T) {
+	matches := make(chan savedSearchMatch, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m savedSearchMatch
+		json.NewDecoder(r.Body).Decode(&m)
+		matches <- m
+	}))
+	defer webhook.Close()
+
+	srv := newTestServer(t)
+
+	for _, body := range []string{
+		`{"filter": {}}`,
+		`{"filter": {"min_price": 20, "max_price": 10}}`,
+		`{"filter": {"artist": "Miles Davis"}, "webhook_url": "ftp://example.com"}`,
+	} {
+		if w := srv.do("POST", "/saved-searches", body); w.Code != 400 {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	w := srv.do("POST", "/saved-searches", `{"filter": {"artist": "miles davis", "max_price": 30}, "webhook_url": "`+webhook.URL+`"}`)
+	if w.Code != 201 {
+		t.Fatalf("Expected 201, got %d", w.Code)
+	}
+	var search savedSearch
+	json.Unmarshal(w.Body.Bytes(), &search)
+
+	srv.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}`)
+	srv.do("POST", "/albums", `{"title": "Giant Steps", "artist": "John Coltrane", "price": 19.99}`)
+	srv.do("POST", "/albums", `{"title": "Sketches of Spain", "artist": "Miles Davis", "price": 24.99}`)
+
+	select {
+	case m := <-matches:
+		if m.SavedSearchID != search.ID || m.Album.Title != "Sketches of Spain" {
+			t.Errorf("Unexpected match: %+v", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a webhook delivery")
+	}
+	select {
+	case m := <-matches:
+		t.Errorf("Expected a single match, also got %+v", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestSavedSearchStream tests GET /saved-searches/:id/events.
+// Verifies that a matching album is streamed as a server-sent event, that the stream ends when
+// the saved search is deleted, and that unknown searches return HTTP 404.
+func TestSavedSearchStream(t *testing.T) {
+	srv := newTestServer(t)
+	server := httptest.NewServer(srv.router)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/saved-searches", "application/json",
+		strings.NewReader(`{"filter": {"title_contains": "blue"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var search savedSearch
+	json.NewDecoder(resp.Body).Decode(&search)
+	resp.Body.Close()
+
+	stream, err := http.Get(server.URL + "/saved-searches/" + search.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	if ct := stream.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	resp, _ = http.Post(server.URL+"/albums", "application/json",
+		strings.NewReader(`{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}`))
+	resp.Body.Close()
+
+	lines := bufio.NewScanner(stream.Body)
+	var event, data string
+	for lines.Scan() && (event == "" || data == "") {
+		if v, ok := strings.CutPrefix(lines.Text(), "event:"); ok {
+			event = v
+		}
+		if v, ok := strings.CutPrefix(lines.Text(), "data:"); ok {
+			data = v
+		}
+	}
+	if event != "match" || !strings.Contains(data, "Kind of Blue") {
+		t.Errorf("Expected a match event for Kind of Blue, got event %q data %q", event, data)
+	}
+
+	req, _ := http.NewRequest("DELETE", server.URL+"/saved-searches/"+search.ID, nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 204 {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+	for lines.Scan() {
+	}
+
+	resp, _ = http.Get(server.URL + "/saved-searches/unknown/events")
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("Expected 404, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// albumField describes one JSON field of Album: its JSON type, the API version that added it,
+// whether the server maintains it, and, once it is phased out, the API version that deprecated it
+// (it is still served), the version that removed it, and the field that replaces it.
+type albumField struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Since      int    `json:"since"`
+	ReadOnly   bool   `json:"read_only,omitempty"`
+	Deprecated int    `json:"deprecated,omitempty"`
+	Removed    int    `json:"removed,omitempty"`
+	ReplacedBy string `json:"replaced_by,omitempty"`
+}
+
+// albumSchema is the registry of Album fields, in the order of the struct. Serializers that list
+// fields, such as the CSV export and JSON Patch, read it rather than naming fields themselves, so
+// adding or deprecating a field here is all it takes to keep them and the published schema (GET
+// /albums/schema) consistent. Fields are never deleted from it, only marked removed.
+var albumSchema = []albumField{
+	{Name: "id", Type: "string", Since: 1, ReadOnly: true},
+	{Name: "title", Type: "string", Since: 1},
+	{Name: "artist", Type: "string", Since: 1},
+	{Name: "price", Type: "number", Since: 1},
+	{Name: "upc", Type: "string", Since: 1},
+	{Name: "tags", Type: "array", Since: 1},
+	{Name: "metadata", Type: "object", Since: 1},
+	{Name: "genre", Type: "string", Since: 1},
+	{Name: "year", Type: "number", Since: 1},
+	{Name: "quantity", Type: "number", Since: 1},
+	{Name: "currency", Type: "string", Since: 1},
+	{Name: "tracks", Type: "array", Since: 1, ReadOnly: true},
+	{Name: "track_count", Type: "number", Since: 1, ReadOnly: true},
+	{Name: "artist_id", Type: "string", Since: 1},
+	{Name: "image_url", Type: "string", Since: 1, ReadOnly: true},
+	{Name: "spotify_id", Type: "string", Since: 1, ReadOnly: true},
+	{Name: "spotify_url", Type: "string", Since: 1, ReadOnly: true},
+	{Name: "created_at", Type: "string", Since: 1, ReadOnly: true},
+	{Name: "updated_at", Type: "string", Since: 1, ReadOnly: true},
+	{Name: "archived_at", Type: "string", Since: 1, ReadOnly: true},
+	{Name: "deleted_at", Type: "string", Since: 1, ReadOnly: true},
+	{Name: "version", Type: "number", Since: 1, ReadOnly: true},
+}
+
+// inVersion reports whether f is part of the given API version.
+func (f albumField) inVersion(version int) bool {
+	return f.Since <= version && (f.Removed == 0 || version < f.Removed)
+}
+
+// albumFieldNames returns the names of the fields in the given API version, deprecated ones included.
+func albumFieldNames(version int) []string {
+	var names []string
+	for _, f := range albumSchema {
+		if f.inVersion(version) {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// readOnlyFieldNames returns the names of the server-maintained fields in the given API version.
+func readOnlyFieldNames(version int) []string {
+	var names []string
+	for _, f := range albumSchema {
+		if f.ReadOnly && f.inVersion(version) {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// albumSchemaHandler returns a handler for GET /albums/schema requests in the given API version.
+// Returns the version and its album fields, with when each was added and deprecated, as JSON with
+// HTTP 200 status.
+func albumSchemaHandler(version int) gin.HandlerFunc {
+	var fields []albumField
+	for _, f := range albumSchema {
+		if f.inVersion(version) {
+			fields = append(fields, f)
+		}
+	}
+	return func(c *gin.Context) {
+		c.IndentedJSON(http.StatusOK, gin.H{"version": version, "fields": fields})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestAlbumSchemaMatchesModel tests that the field registry lists every JSON field of Album, in
+// order, so a field added to the struct without a registry entry is caught.
+func TestAlbumSchemaMatchesModel(t *testing.T) {
+	var tags []string
+	typ := reflect.TypeFor[Album]()
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		tags = append(tags, name)
+	}
+	var registered []string
+	for _, f := range albumSchema {
+		if f.Removed == 0 {
+			registered = append(registered, f.Name)
+		}
+	}
+	if !slices.Equal(tags, registered) {
+		t.Errorf("Expected the registry to list %v, got %v", tags, registered)
+	}
+}
+
+// TestAlbumFieldVersions tests that fields are included in the versions between their addition
+// and removal, and that deprecated fields are still served.
+func TestAlbumFieldVersions(t *testing.T) {
+	f := albumField{Name: "old", Since: 1, Deprecated: 2, Removed: 3}
+	for version, want := range map[int]bool{1: true, 2: true, 3: false} {
+		if f.inVersion(version) != want {
+			t.Errorf("version %d: expected inVersion %v", version, want)
+		}
+	}
+	if added := (albumField{Since: 2}); added.inVersion(1) {
+		t.Error("Expected a field added in version 2 not to be in version 1")
+	}
+}
+
+// TestGetAlbumSchema tests GET /albums/schema.
+func TestGetAlbumSchema(t *testing.T) {
+	srv := newTestServer(t)
+	w := srv.do("GET", "/v1/albums/schema", "")
+
+	var resp struct {
+		Version int          `json:"version"`
+		Fields  []albumField `json:"fields"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || resp.Version != 1 || len(resp.Fields) != len(albumSchema) {
+		t.Fatalf("Expected the version 1 schema, got %d: %s", w.Code, w.Body)
+	}
+	if id := resp.Fields[0]; id.Name != "id" || !id.ReadOnly {
+		t.Errorf("Expected id to be read-only, got %+v", id)
+	}
+}
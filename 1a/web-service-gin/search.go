@@ -0,0 +1,193 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchIndex is an inverted index from the words of album titles and artists to albums, kept
+// per tenant. A tenant's index is built from the store on its first search and then kept up to
+// date from album events, so it reflects changes made through this server.
+type searchIndex struct {
+	mu      sync.RWMutex
+	tenants map[string]*albumIndex
+}
+
+// albumIndex is the search index of one tenant's albums.
+type albumIndex struct {
+	albums map[string]Album
+	// words maps each word to the IDs of the albums whose title or artist contains it.
+	words map[string]map[string]struct{}
+}
+
+// newSearchIndex creates an empty search index.
+func newSearchIndex() *searchIndex {
+	return &searchIndex{tenants: make(map[string]*albumIndex)}
+}
+
+// searchWords splits s into lowercase words of letters and digits, without duplicates.
+func searchWords(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	slices.Sort(words)
+	return slices.Compact(words)
+}
+
+// add indexes a, replacing any earlier version of it.
+func (ai *albumIndex) add(a Album) {
+	ai.remove(a.ID)
+	ai.albums[a.ID] = a
+	for _, word := range searchWords(a.Title + " " + a.Artist) {
+		ids, ok := ai.words[word]
+		if !ok {
+			ids = make(map[string]struct{})
+			ai.words[word] = ids
+		}
+		ids[a.ID] = struct{}{}
+	}
+}
+
+// remove drops the album with the given ID from the index, if it is there.
+func (ai *albumIndex) remove(id string) {
+	old, ok := ai.albums[id]
+	if !ok {
+		return
+	}
+	delete(ai.albums, id)
+	for _, word := range searchWords(old.Title + " " + old.Artist) {
+		delete(ai.words[word], id)
+		if len(ai.words[word]) == 0 {
+			delete(ai.words, word)
+		}
+	}
+}
+
+// lookup returns the albums whose title or artist contains every word in words. Albums with
+// more of the words in their title come first, then albums are ordered by title.
+func (ai *albumIndex) lookup(words []string) []Album {
+	slices.SortFunc(words, func(a, b string) int { return cmp.Compare(len(ai.words[a]), len(ai.words[b])) })
+	found := []Album{}
+	for id := range ai.words[words[0]] {
+		matches := true
+		for _, word := range words[1:] {
+			if _, ok := ai.words[word][id]; !ok {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found = append(found, ai.albums[id])
+		}
+	}
+
+	inTitle := func(a Album) int {
+		titleWords := searchWords(a.Title)
+		n := 0
+		for _, word := range words {
+			if _, ok := slices.BinarySearch(titleWords, word); ok {
+				n++
+			}
+		}
+		return n
+	}
+	slices.SortFunc(found, func(a, b Album) int {
+		return cmp.Or(
+			cmp.Compare(inTitle(b), inTitle(a)),
+			cmp.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+	return found
+}
+
+// search returns the albums of the tenant in ctx that match every word in words, building the
+// tenant's index from s first if this is its first search.
+func (idx *searchIndex) search(ctx context.Context, s AlbumStore, words []string) ([]Album, error) {
+	tenant := tenantFrom(ctx)
+	idx.mu.RLock()
+	ai, ok := idx.tenants[tenant]
+	if ok {
+		defer idx.mu.RUnlock()
+		return ai.lookup(words), nil
+	}
+	idx.mu.RUnlock()
+
+	// Album events wait while the index is built, so none is lost between List and
+	// installing the index; applying one the listing already included is harmless.
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if ai, ok = idx.tenants[tenant]; !ok {
+		all, err := s.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ai = &albumIndex{albums: make(map[string]Album, len(all)), words: make(map[string]map[string]struct{})}
+		for _, a := range all {
+			ai.add(a)
+		}
+		idx.tenants[tenant] = ai
+	}
+	return ai.lookup(words), nil
+}
+
+// handle applies an album event to the index of its tenant. Tenants that have not searched yet
+// have no index to update.
+func (idx *searchIndex) handle(evt albumEvent) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	ai, ok := idx.tenants[evt.Tenant]
+	if !ok {
+		return
+	}
+	if evt.Type == eventAlbumDeleted {
+		ai.remove(evt.Album.ID)
+		return
+	}
+	ai.add(evt.Album)
+}
+
+// searchAlbums handles GET /albums/search?q=... requests.
+// Returns the active albums whose title or artist contains every word of q, ignoring case and
+// punctuation, as a JSON array with HTTP 200 status; ?state= selects archived albums as for
+// GET /albums. Albums matching more words in their title come first, then albums are ordered by
+// title. Results are paged with limit and offset like GET /albums, with the number of matches in
+// the X-Total-Count header.
+// Returns HTTP 400 if q has no words, or limit, offset, or state is invalid.
+func (srv *Server) searchAlbums(c *gin.Context) {
+	words := searchWords(c.Query("q"))
+	if len(words) == 0 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "q must contain at least one word"})
+		return
+	}
+	offset, limit, explicit, errMsg := parsePage(c, srv.cfg.PageLimitDefault, srv.cfg.PageLimitMax)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	match, errMsg := parseState(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	found, err := srv.search.search(c.Request.Context(), srv.store, words)
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	found = filterAlbums(found, match)
+	c.Header(totalCountHeader, strconv.Itoa(len(found)))
+	if explicit || len(found) > limit {
+		setPageLinks(c, offset, limit, len(found))
+	}
+	renderAlbums(c, http.StatusOK, pageOf(found, offset, limit))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestSearchAlbums tests GET /albums/search.
+// Verifies case-insensitive word matching on title and artist, that every word must match, and
+// that creates, updates, and deletes made after the index was built are reflected.
+func TestSearchAlbums(t *testing.T) {
+	srv := newTestServer(t)
+	search := func(q string) string {
+		w := srv.do("GET", "/albums/search?q="+q, "")
+		if w.Code != 200 {
+			t.Fatalf("Expected 200 for %q, got %d: %s", q, w.Code, w.Body)
+		}
+		var found []Album
+		json.Unmarshal(w.Body.Bytes(), &found)
+		var titles []string
+		for _, a := range found {
+			titles = append(titles, a.Title)
+		}
+		return strings.Join(titles, ",")
+	}
+
+	for q, want := range map[string]string{
+		"BLUE":           "Blue Train",
+		"coltrane+train": "Blue Train",
+		"coltrane+jeru":  "",
+		"vaughan":        "Sarah Vaughan and Clifford Brown",
+		"brown!":         "Sarah Vaughan and Clifford Brown",
+	} {
+		if got := search(q); got != want {
+			t.Errorf("%s: expected %q, got %q", q, want, got)
+		}
+	}
+
+	w := srv.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}`)
+	var created Album
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if got := search("blue"); got != "Blue Train,Kind of Blue" {
+		t.Errorf("Expected the new album to be found, got %q", got)
+	}
+	srv.do("PATCH", "/albums/"+created.ID, `{"title": "Milestones"}`, "If-Match", "*")
+	if got := search("blue"); got != "Blue Train" {
+		t.Errorf("Expected the old title to be unindexed, got %q", got)
+	}
+	if got := search("milestones+davis"); got != "Milestones" {
+		t.Errorf("Expected the new title to be indexed, got %q", got)
+	}
+	srv.do("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440001", "", "If-Match", "*")
+	if got := search("blue"); got != "" {
+		t.Errorf("Expected the deleted album to be unindexed, got %q", got)
+	}
+
+	if w := srv.do("GET", "/albums/search?q=+!", ""); w.Code != 400 {
+		t.Errorf("Expected 400 for a query without words, got %d", w.Code)
+	}
+}
+
+// TestSearchWords tests splitting text into search words.
+func TestSearchWords(t *testing.T) {
+	got := searchWords("Sarah Vaughan & Clifford Brown, sarah's")
+	want := "brown,clifford,s,sarah,vaughan"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Expected %s, got %v", want, got)
+	}
+}
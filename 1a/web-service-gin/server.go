@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Server is one instance of the album API: its album store, the integrations and instrumentation
+// built around it, and the router serving its endpoints. Servers share no mutable state, so
+// several can run side by side, e.g. one per test.
+type Server struct {
+	cfg    Config
+	store  AlbumStore
+	router *gin.Engine
+	// backend is the store the server was created over, which GET /readyz checks.
+	backend AlbumStore
+
+	// spotify is nil when no client credentials are configured.
+	spotify       *spotifyClient
+	backfill      *spotifyBackfill
+	savedSearches *savedSearchRegistry
+	search        *searchIndex
+	artists       *artistRegistry
+	// covers is nil when cover storage is disabled.
+	covers coverStore
+	locks  *lockTable
+	// rates is nil when currency conversion is not configured.
+	rates rateProvider
+	// pricing holds the pricing rules, replaced by PUT /admin/pricing-rules.
+	pricing atomic.Pointer[pricingRules]
+	// notifications is nil when notifications are not configured.
+	notifications *notifier
+	// subscribers are called, in order, for every album event (see publishAlbumEvent).
+	subscribers []func(albumEvent)
+	// changes is nil when the change feed is disabled.
+	changes *changeFeed
+	// history is nil when the album history is disabled.
+	history *albumHistory
+	// backups is nil when backups are disabled.
+	backups *backupScheduler
+	// streams tracks the clients connected to the event streams.
+	streams *subscriberTracker
+
+	outbound *outboundRegistry
+	metrics  *requestMetrics
+	queueing *queueingMetrics
+	// journal, allocs, and dedup are nil when journaling, allocation sampling, and request
+	// deduplication are disabled.
+	journal *requestJournal
+	allocs  *allocSampler
+	dedup   *dedupCache
+	// limits is nil when no album limit is configured; otherwise the server's store wraps it.
+	limits *limitedStore
+	// cache is nil unless CACHE_WRITE_POLICY is set; otherwise it wraps the backend store, through
+	// the limits if they are enabled.
+	cache *cachedStore
+	// staleReads is nil unless stale reads are enabled; otherwise it wraps the backend store,
+	// through the limits and cache if they are enabled.
+	staleReads *staleReadStore
+	// softDeletes is the server's store: it wraps the backend store, through the limits, cache, and
+	// stale reads if they are enabled, and hides deleted albums.
+	softDeletes *softDeleteStore
+	jobs        *jobRunner
+
+	// lastDeletion is when this server last deleted an album (see recordDeletion).
+	lastDeletion atomic.Int64
+}
+
+// NewServer creates a server for store configured by cfg and returns its router.
+// It panics if cfg is invalid; use newServer to handle the error instead.
+func NewServer(store AlbumStore, cfg Config) *gin.Engine {
+	srv, err := newServer(store, cfg)
+	if err != nil {
+		panic(err)
+	}
+	return srv.router
+}
+
+// newServer creates a server for store configured by cfg and registers all API routes.
+// Returns an error if the notifications config, CACHE_WRITE_POLICY, COVER_STORAGE, CURRENCY_RATES,
+// PRICING_RULES, or RENDER_PIPELINES is invalid.
+func newServer(store AlbumStore, cfg Config) (*Server, error) {
+	srv := &Server{
+		cfg:      cfg,
+		store:    store,
+		backend:  store,
+		backfill: &spotifyBackfill{},
+		search:   newSearchIndex(),
+		outbound: &outboundRegistry{},
+		metrics:  &requestMetrics{},
+		queueing: &queueingMetrics{},
+		journal:  newRequestJournal(cfg.JournalSize),
+		allocs:   newAllocSampler(cfg.AllocSampleEvery),
+		dedup:    newDedupCache(cfg.DedupWindow),
+		changes:  newChangeFeed(cfg.ChangeFeedSize),
+		history:  newAlbumHistory(cfg.HistorySize),
+		streams:  newSubscriberTracker(),
+		locks:    newLockTable(),
+		limits:   newLimitedStore(store, cfg),
+		jobs:     newJobRunner(cfg),
+	}
+	if srv.limits != nil {
+		srv.store = srv.limits
+	}
+	cache, err := newCachedStore(srv.store, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CACHE_WRITE_POLICY: %w", err)
+	}
+	if cache != nil {
+		srv.cache = cache
+		srv.store = cache
+	}
+	if srv.staleReads = newStaleReadStore(srv.store, cfg); srv.staleReads != nil {
+		srv.store = srv.staleReads
+	}
+	srv.softDeletes = &softDeleteStore{AlbumStore: srv.store}
+	srv.store = srv.softDeletes
+	srv.backups = newBackupScheduler(cfg, srv.softDeletes.AlbumStore, srv.changes)
+	srv.artists = newArtistRegistry(srv.softDeletes.AlbumStore, store)
+	if srv.covers, err = newCoverStore(cfg); err != nil {
+		return nil, fmt.Errorf("invalid COVER_STORAGE: %w", err)
+	}
+	if srv.rates, err = newRateProvider(cfg, srv.outbound); err != nil {
+		return nil, fmt.Errorf("invalid CURRENCY_RATES: %w", err)
+	}
+	pricing, err := parsePricingRules(cfg.PricingRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PRICING_RULES: %w", err)
+	}
+	srv.pricing.Store(&pricing)
+	srv.spotify = newSpotifyClient(cfg, srv.outbound)
+	srv.savedSearches = newSavedSearchRegistry(cfg, srv.outbound)
+	srv.subscribers = append(srv.subscribers, srv.savedSearches.handle, srv.search.handle)
+	if srv.changes != nil {
+		srv.subscribers = append(srv.subscribers, srv.changes.handle)
+	}
+	if srv.history != nil {
+		srv.subscribers = append(srv.subscribers, srv.history.handle)
+	}
+	if cfg.NotificationsConfig != "" {
+		nc, err := loadNotificationConfig(cfg.NotificationsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("load notifications config: %w", err)
+		}
+		if srv.notifications, err = newNotifier(nc, cfg, srv.outbound); err != nil {
+			return nil, fmt.Errorf("invalid notifications config: %w", err)
+		}
+		srv.subscribers = append(srv.subscribers, srv.notifications.handle)
+	}
+
+	pipelines, err := parseRenderPipelines(cfg.RenderPipelines)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RENDER_PIPELINES: %w", err)
+	}
+	srv.routes(pipelines)
+	return srv, nil
+}
+
+// routes creates the server's router, installs its middleware, and registers every endpoint: the
+// versioned API (see v1Routes) and the unversioned admin, metrics, and health endpoints.
+// Albums are rendered through pipelines["/albums"]. Every GET endpoint also answers HEAD, and
+// OPTIONS and methods an endpoint does not support are answered by methodNotAllowed.
+func (srv *Server) routes(pipelines map[string]renderPipeline) {
+	router := gin.New()
+	router.Use(srv.queueing.middleware(), gin.Logger(), gin.Recovery())
+	router.Use(requestScopeMiddleware(srv.cfg.APIKeys))
+	router.Use(metricsMiddleware(srv.metrics))
+	if srv.staleReads != nil {
+		router.Use(staleReadMiddleware(srv.metrics))
+	}
+	if srv.cfg.ReadOnly {
+		router.Use(readOnlyMiddleware(srv.cfg.PrimaryURL))
+	}
+	if srv.cfg.PublicBaseURL != "" {
+		router.Use(baseURLMiddleware(srv.cfg.PublicBaseURL))
+	}
+	if srv.dedup != nil {
+		router.Use(dedupMiddleware(srv.dedup))
+	}
+	if srv.journal != nil {
+		router.Use(journalMiddleware(srv.journal))
+	}
+	if srv.allocs != nil {
+		router.Use(allocMiddleware(srv.allocs))
+	}
+	router.HandleMethodNotAllowed = true
+	router.NoMethod(methodNotAllowed)
+
+	// Each version of the API registers its routes on its own group. Version 1 is also served
+	// without a prefix, as a deprecated alias.
+	srv.v1Routes(router.Group("/v1"), pipelines)
+	srv.v1Routes(router.Group("", deprecatedAlias), pipelines)
+
+	router.POST("/admin/spotify/backfill", srv.startSpotifyBackfill)
+	get(router, "/admin/spotify/backfill", srv.getSpotifyBackfill)
+	get(router, "/metrics/summary", srv.getMetricsSummary)
+	get(router, "/metrics/outbound", srv.getOutboundMetrics)
+	get(router, "/metrics/queueing", srv.getQueueingMetrics)
+	get(router, "/metrics/capacity", srv.getCapacityMetrics)
+	get(router, "/admin/journal", srv.getJournal)
+	router.POST("/admin/integrity", srv.runIntegrityCheck)
+	get(router, "/admin/runtime", getRuntime)
+	router.PUT("/admin/runtime", putRuntime)
+	get(router, "/debug/allocs", srv.getAllocs)
+	get(router, "/admin/notifications", srv.getNotifications)
+	get(router, "/admin/wal", srv.getWAL)
+	get(router, "/admin/subscribers", srv.getSubscribers)
+	get(router, "/admin/locks", srv.getLocks)
+	get(router, "/admin/pricing-rules", srv.getPricingRules)
+	router.PUT("/admin/pricing-rules", srv.putPricingRules)
+	get(router, "/readyz", srv.readinessCheck)
+	get(router, "/", srv.healthCheck)
+	srv.router = router
+}
+
+// methodNotAllowed handles requests for a known path with a method it has no route for. Gin sets
+// the Allow header to the path's methods first; OPTIONS is added to it, as every path supports it.
+// Returns HTTP 204 for OPTIONS, and otherwise an error with HTTP 405 status.
+func methodNotAllowed(c *gin.Context) {
+	c.Header("Allow", c.Writer.Header().Get("Allow")+", "+http.MethodOptions)
+	if c.Request.Method == http.MethodOptions {
+		c.Status(http.StatusNoContent)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.IndentedJSON(http.StatusMethodNotAllowed, gin.H{"error": "Method " + c.Request.Method + " is not allowed for " + c.Request.URL.Path})
+}
+
+// memoryStore returns the server's backend store if it is the memory store, looking through
+// soft deletes, stale reads, the cache, and the album limits if they are enabled.
+func (srv *Server) memoryStore() (*memoryStore, bool) {
+	backend := srv.softDeletes.AlbumStore
+	if srv.staleReads != nil {
+		backend = srv.staleReads.AlbumStore
+	}
+	if srv.cache != nil {
+		backend = srv.cache.AlbumStore
+	}
+	if srv.limits != nil {
+		backend = srv.limits.AlbumStore
+	}
+	s, ok := backend.(*memoryStore)
+	return s, ok
+}
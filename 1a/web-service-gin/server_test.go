@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestServersAreIndependent tests that servers created by NewServer share no state.
+// Verifies that an album created through one server is not visible through another, and that
+// request metrics are counted per server.
+func TestServersAreIndependent(t *testing.T) {
+	first := NewServer(newMemoryStore(seedAlbums()), loadConfig())
+	second := NewServer(newMemoryStore(seedAlbums()), loadConfig())
+
+	req, _ := http.NewRequest("POST", "/albums", bytes.NewBufferString(`{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	first.ServeHTTP(w, req)
+	if w.Code != 201 {
+		t.Fatalf("Expected 201, got %d", w.Code)
+	}
+
+	for name, router := range map[string]http.Handler{"first": first, "second": second} {
+		req, _ := http.NewRequest("GET", "/albums", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var albums []Album
+		json.Unmarshal(w.Body.Bytes(), &albums)
+		want := 3
+		if name == "first" {
+			want = 4
+		}
+		if len(albums) != want {
+			t.Errorf("%s server: expected %d albums, got %d", name, want, len(albums))
+		}
+	}
+
+	req, _ = http.NewRequest("GET", "/metrics/summary", nil)
+	w = httptest.NewRecorder()
+	second.ServeHTTP(w, req)
+	var summary struct {
+		Total int64 `json:"total_requests"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	if summary.Total != 1 {
+		t.Errorf("Expected the second server to have counted 1 request, got %d", summary.Total)
+	}
+}
+
+// TestNewServerInvalidConfig tests that newServer rejects an invalid render pipeline.
+func TestNewServerInvalidConfig(t *testing.T) {
+	cfg := loadConfig()
+	cfg.RenderPipelines = "/albums=nope"
+	if _, err := newServer(newMemoryStore(nil), cfg); err == nil {
+		t.Error("Expected an error for an unknown transformer")
+	}
+}
+
+// TestMethodHandling tests HEAD, OPTIONS, and unsupported methods on known paths.
+// Verifies that HEAD is answered like GET, that OPTIONS and 405 responses list the path's methods
+// in the Allow header, and that unknown paths still return 404.
+func TestMethodHandling(t *testing.T) {
+	srv := newTestServer(t)
+
+	if w := srv.do("HEAD", "/albums/550e8400-e29b-41d4-a716-446655440001", ""); w.Code != 200 || w.Header().Get("Content-Type") == "" {
+		t.Errorf("Expected HEAD to be answered like GET, got %d %v", w.Code, w.Header())
+	}
+	if w := srv.do("HEAD", "/albums/missing", ""); w.Code != 404 {
+		t.Errorf("Expected 404 for HEAD of a missing album, got %d", w.Code)
+	}
+
+	w := srv.do("OPTIONS", "/albums/550e8400-e29b-41d4-a716-446655440001", "")
+	if w.Code != 204 || w.Header().Get("Allow") != "GET, HEAD, DELETE, PATCH, PUT, OPTIONS" {
+		t.Errorf("Expected 204 listing the album's methods, got %d %q", w.Code, w.Header().Get("Allow"))
+	}
+	w = srv.do("POST", "/tags", "")
+	if w.Code != 405 || w.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Errorf("Expected 405 with Allow: GET, HEAD, OPTIONS, got %d %q", w.Code, w.Header().Get("Allow"))
+	}
+	if w := srv.do("DELETE", "/no-such-path", ""); w.Code != 404 {
+		t.Errorf("Expected 404 for an unknown path, got %d", w.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// albumSnapshot is the JSON document written by saveSnapshot. Version is the format version (see
+// snapshotVersion). Artists is omitted by snapshots saved before artists were stored; their
+// artists are loaded from the albums (see artistRegistry.book).
+type albumSnapshot struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"saved_at"`
+	Albums  []Album   `json:"albums"`
+	Artists []Artist  `json:"artists,omitempty"`
+}
+
+// loadSnapshot reads the snapshot saved at path. Returns an error satisfying errors.Is(err, os.ErrNotExist)
+// if there is no snapshot yet. Snapshots in the legacy format are read too (see migrateSnapshot).
+func loadSnapshot(path string) (albumSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return albumSnapshot{}, err
+	}
+	snap, err := decodeSnapshot(data)
+	if err != nil {
+		return albumSnapshot{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return snap, nil
+}
+
+// saveSnapshot writes every album and artist in s to path (see writeSnapshot).
+func saveSnapshot(path string, s *memoryStore) error {
+	albums, err := s.List(context.Background())
+	if err != nil {
+		return err
+	}
+	artists, err := s.ListArtists(context.Background())
+	if err != nil {
+		return err
+	}
+	return writeSnapshot(path, albumSnapshot{SavedAt: time.Now().UTC(), Albums: albums, Artists: artists})
+}
+
+// writeSnapshot writes snap to path in the current format version. The snapshot is written to
+// a temporary file and renamed into place, so a crash mid-write never leaves a truncated snapshot behind.
+func writeSnapshot(path string, snap albumSnapshot) error {
+	snap.Version = snapshotVersion
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// openSnapshotStore creates a memory store from the snapshot at path, or from the seed albums if
+// there is no snapshot yet.
+func openSnapshotStore(path string) (*memoryStore, error) {
+	snap, err := loadSnapshot(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return newMemoryStore(seedAlbums()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d albums from snapshot %s", len(snap.Albums), path)
+	return newSnapshotMemoryStore(snap), nil
+}
+
+// newSnapshotMemoryStore creates a memory store holding the albums and artists of snap.
+func newSnapshotMemoryStore(snap albumSnapshot) *memoryStore {
+	s := newMemoryStore(snap.Albums)
+	s.putArtists(snap.Artists)
+	return s
+}
+
+// runSnapshots saves s to path every interval until ctx is done, skipping intervals in which
+// nothing changed. Failures are logged and retried at the next interval.
+func runSnapshots(ctx context.Context, s *memoryStore, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	saved := s.changeCount()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changes := s.changeCount()
+		if changes == saved {
+			continue
+		}
+		if err := saveSnapshot(path, s); err != nil {
+			log.Printf("snapshot %s: %v", path, err)
+			continue
+		}
+		saved = changes
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSnapshotRoundTrip tests saving the memory store to a snapshot and loading it again.
+// Verifies that a missing snapshot starts from the seed albums and that created albums survive a restart.
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "albums.json")
+
+	s, err := openSnapshotStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := s.List(ctx); len(all) != 3 {
+		t.Fatalf("Expected the 3 seed albums without a snapshot, got %d", len(all))
+	}
+	s.Create(ctx, Album{ID: "a", Title: "Kind of Blue", Artist: "Miles Davis", Price: 49.99, UPC: "074646593622"})
+	s.Delete(ctx, "550e8400-e29b-41d4-a716-446655440002")
+	if err := saveSnapshot(path, s); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := openSnapshotStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, _ := restored.List(ctx)
+	if len(all) != 3 || all[2].ID != "a" {
+		t.Errorf("Expected the saved albums in order, got %+v", all)
+	}
+	if a, err := restored.GetByUPC(ctx, "0074646593622"); err != nil || a.ID != "a" {
+		t.Errorf("Expected the UPC index to be rebuilt, got %+v, %v", a, err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the snapshot file, got %v", entries)
+	}
+}
+
+// TestSnapshotInvalidFile tests that a corrupt snapshot is reported instead of silently starting empty.
+func TestSnapshotInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "albums.json")
+	os.WriteFile(path, []byte("{not json"), 0o600)
+	if _, err := openSnapshotStore(path); err == nil {
+		t.Error("Expected an error for a corrupt snapshot")
+	}
+}
+
+// TestRunSnapshots tests periodic snapshots.
+// Verifies that nothing is written until the store changes, and that changes are saved at the next interval.
+func TestRunSnapshots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "albums.json")
+	s := newMemoryStore(seedAlbums())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go runSnapshots(ctx, s, path, 10*time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected no snapshot before any change, got %v", err)
+	}
+
+	s.Create(context.Background(), Album{ID: "a", Title: "Kind of Blue", Artist: "Miles Davis", Price: 49.99})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if snap, err := loadSnapshot(path); err == nil && len(snap.Albums) == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a snapshot with 4 albums")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
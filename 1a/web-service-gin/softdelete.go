@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// softDeleteStore is an AlbumStore where deleting an album only marks it deleted, with its
+// DeletedAt time, so it can be restored. Deleted albums are hidden from every read and cannot be
+// updated; the wrapped store still holds them and is used to list, restore, or purge them. They
+// keep their UPC and still count for duplicate detection and album limits until purged, so
+// restoring one never conflicts.
+type softDeleteStore struct {
+	AlbumStore
+}
+
+// visible returns a, or errAlbumNotFound if it is deleted.
+func visible(a Album, err error) (Album, error) {
+	if err == nil && !a.DeletedAt.IsZero() {
+		return Album{}, errAlbumNotFound
+	}
+	return a, err
+}
+
+// withoutDeleted returns the albums in all that are not deleted.
+func withoutDeleted(all []Album, err error) ([]Album, error) {
+	if err != nil {
+		return nil, err
+	}
+	return filterAlbums(all, func(a Album) bool { return a.DeletedAt.IsZero() }), nil
+}
+
+// List returns every album that is not deleted.
+func (s *softDeleteStore) List(ctx context.Context) ([]Album, error) {
+	return withoutDeleted(s.AlbumStore.List(ctx))
+}
+
+// Get returns the album with the given ID, or errAlbumNotFound if it is deleted.
+func (s *softDeleteStore) Get(ctx context.Context, id string) (Album, error) {
+	return visible(s.AlbumStore.Get(ctx, id))
+}
+
+// GetByUPC returns the album with the given barcode, or errAlbumNotFound if it is deleted.
+func (s *softDeleteStore) GetByUPC(ctx context.Context, code string) (Album, error) {
+	return visible(findAlbumByUPC(ctx, s.AlbumStore, code))
+}
+
+// Update applies mutate to the album with the given ID. Returns errAlbumNotFound if it is deleted.
+func (s *softDeleteStore) Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.AlbumStore.Update(ctx, id, notDeleted(mutate))
+}
+
+// UpdateUnique applies mutate to the album with the given ID unless it would get the title and
+// artist of another album, deleted or not. Returns errAlbumNotFound if it is deleted.
+func (s *softDeleteStore) UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return updateUnique(ctx, s.AlbumStore, id, notDeleted(mutate))
+}
+
+// notDeleted wraps an Update mutation to fail with errAlbumNotFound on a deleted album.
+func notDeleted(mutate func(*Album) error) func(*Album) error {
+	return func(a *Album) error {
+		if !a.DeletedAt.IsZero() {
+			return errAlbumNotFound
+		}
+		return mutate(a)
+	}
+}
+
+// Delete marks the album with the given ID deleted and returns it.
+// Returns errAlbumNotFound if it does not exist or is already deleted.
+func (s *softDeleteStore) Delete(ctx context.Context, id string) (Album, error) {
+	return s.deleteChecked(ctx, id, nil)
+}
+
+// deleteChecked marks the album with the given ID deleted, as Delete does, if check accepts it
+// (see parseIfMatch); the check and the delete are one atomic store update. A nil check accepts
+// any album.
+func (s *softDeleteStore) deleteChecked(ctx context.Context, id string, check versionCheck) (Album, error) {
+	return s.Update(ctx, id, func(a *Album) error {
+		if check != nil {
+			if err := check(*a); err != nil {
+				return err
+			}
+		}
+		a.DeletedAt = time.Now().UTC()
+		stampUpdated(a, a.DeletedAt)
+		return nil
+	})
+}
+
+// UpdateWhere applies mutate to the albums selected by f that are not deleted, atomically if the
+// store supports that.
+func (s *softDeleteStore) UpdateWhere(ctx context.Context, f albumFilter, mutate func(*Album) bool) ([]Album, error) {
+	return updateWhere(ctx, s.AlbumStore, f, func(a *Album) bool {
+		return a.DeletedAt.IsZero() && mutate(a)
+	})
+}
+
+// DeleteWhere marks the albums selected by f that are not deleted yet deleted, atomically if the
+// store supports that, and returns them.
+func (s *softDeleteStore) DeleteWhere(ctx context.Context, f albumFilter) ([]Album, error) {
+	now := time.Now().UTC()
+	return s.UpdateWhere(ctx, f, func(a *Album) bool {
+		a.DeletedAt = now
+		stampUpdated(a, now)
+		return true
+	})
+}
+
+// CreateUnique creates an album unless one with the same title and artist exists, deleted or not.
+func (s *softDeleteStore) CreateUnique(ctx context.Context, a Album) (Album, error) {
+	return createUnique(ctx, s.AlbumStore, a)
+}
+
+// Each calls fn with every album that is not deleted.
+func (s *softDeleteStore) Each(ctx context.Context, fn func(Album) error) error {
+	return eachAlbum(ctx, s.AlbumStore, func(a Album) error {
+		if !a.DeletedAt.IsZero() {
+			return nil
+		}
+		return fn(a)
+	})
+}
+
+// Stats returns the statistics of the albums that are not deleted, computed by the store if it
+// supports that.
+func (s *softDeleteStore) Stats(ctx context.Context) (albumStats, error) {
+	return catalogStats(ctx, s.AlbumStore)
+}
+
+// Query returns the albums selected by f that are not deleted, filtering in the store if it
+// supports that.
+func (s *softDeleteStore) Query(ctx context.Context, f albumFilter) ([]Album, error) {
+	return withoutDeleted(listAlbums(ctx, s.AlbumStore, f))
+}
+
+// restore clears the deleted mark of the album with the given ID and returns it and the deleted
+// album it was. Returns errAlbumNotFound if it does not exist or is not deleted.
+func (s *softDeleteStore) restore(ctx context.Context, id string) (restored, previous Album, err error) {
+	restored, err = s.AlbumStore.Update(ctx, id, func(a *Album) error {
+		if a.DeletedAt.IsZero() {
+			return errAlbumNotFound
+		}
+		previous = *a
+		a.DeletedAt = time.Time{}
+		stampUpdated(a, time.Now().UTC())
+		return nil
+	})
+	return restored, previous, err
+}
+
+// readStore returns the store a read request is served from: the server's store, or with
+// ?include_deleted=true the store behind it, which still has the deleted albums.
+// Returns an error message if include_deleted is not a boolean.
+func (srv *Server) readStore(c *gin.Context) (AlbumStore, string) {
+	include, err := strconv.ParseBool(c.DefaultQuery("include_deleted", "false"))
+	if err != nil {
+		return nil, "include_deleted must be true or false"
+	}
+	if include {
+		return srv.softDeletes.AlbumStore, ""
+	}
+	return srv.store, ""
+}
+
+// restoreAlbum handles POST /albums/:id/restore requests.
+// Restores a deleted album, returning it to listings with its data as it was when deleted.
+// Returns the album as JSON with HTTP 200 status, or HTTP 404 if no deleted album has the ID.
+func (srv *Server) restoreAlbum(c *gin.Context) {
+	restored, previous, err := srv.softDeletes.restore(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	srv.publishAlbumEvent(c.Request.Context(), eventAlbumUpdated, restored, &previous)
+	renderAlbum(c, http.StatusOK, restored)
+}
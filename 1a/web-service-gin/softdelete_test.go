@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSoftDelete tests deleting, listing, restoring, and purging albums.
+// Verifies that a deleted album is hidden from reads and updates but listed with
+// ?include_deleted=true, that restoring it brings it back unchanged, and that ?permanent=true
+// removes it for good.
+func TestSoftDelete(t *testing.T) {
+	srv := newTestServer(t)
+	count := func(path string) int {
+		var albums []Album
+		json.Unmarshal(srv.do("GET", path, "").Body.Bytes(), &albums)
+		return len(albums)
+	}
+	const id = "550e8400-e29b-41d4-a716-446655440002"
+
+	w := srv.do("DELETE", "/albums/"+id, "", "If-Match", "*")
+	var deleted Album
+	json.Unmarshal(w.Body.Bytes(), &deleted)
+	if w.Code != 200 || deleted.DeletedAt.IsZero() {
+		t.Fatalf("Expected the deleted album with deleted_at, got %d: %s", w.Code, w.Body)
+	}
+	for _, path := range []string{"/albums/" + id, "/albums/" + id + "/full"} {
+		if w := srv.do("GET", path, ""); w.Code != 404 {
+			t.Errorf("GET %s: expected 404 for a deleted album, got %d", path, w.Code)
+		}
+	}
+	if w := srv.do("POST", "/albums/"+id+"/archive", ""); w.Code != 404 {
+		t.Errorf("Expected 404 updating a deleted album, got %d", w.Code)
+	}
+	if w := srv.do("DELETE", "/albums/"+id, "", "If-Match", "*"); w.Code != 404 {
+		t.Errorf("Expected 404 deleting a deleted album again, got %d", w.Code)
+	}
+	if n, all := count("/albums?state=all"), count("/albums?include_deleted=true"); n != 2 || all != 3 {
+		t.Errorf("Expected 2 albums listed and 3 with include_deleted, got %d and %d", n, all)
+	}
+	if w := srv.do("GET", "/albums/"+id+"?include_deleted=true", ""); w.Code != 200 {
+		t.Errorf("Expected the deleted album with include_deleted, got %d", w.Code)
+	}
+	var stats albumStats
+	json.Unmarshal(srv.do("GET", "/albums/stats", "").Body.Bytes(), &stats)
+	if stats.Count != 2 || stats.ByArtist["Gerry Mulligan"] != 0 {
+		t.Errorf("Expected stats without the deleted album, got %+v", stats)
+	}
+
+	w = srv.do("POST", "/albums/"+id+"/restore", "")
+	var restored Album
+	json.Unmarshal(w.Body.Bytes(), &restored)
+	if w.Code != 200 || restored.Title != "Jeru" || !restored.DeletedAt.IsZero() || count("/albums") != 3 {
+		t.Errorf("Expected the album to be restored, got %d: %s", w.Code, w.Body)
+	}
+	if w := srv.do("POST", "/albums/"+id+"/restore", ""); w.Code != 404 {
+		t.Errorf("Expected 404 restoring an album that is not deleted, got %d", w.Code)
+	}
+
+	srv.do("DELETE", "/albums/"+id, "", "If-Match", "*")
+	if w := srv.do("DELETE", "/albums/"+id+"?permanent=true", "", "If-Match", "*"); w.Code != 200 {
+		t.Errorf("Expected a deleted album to be purged, got %d", w.Code)
+	}
+	if count("/albums?include_deleted=true") != 2 || srv.do("POST", "/albums/"+id+"/restore", "").Code != 404 {
+		t.Error("Expected a purged album to be gone for good")
+	}
+	if w := srv.do("GET", "/albums?include_deleted=maybe", ""); w.Code != 400 {
+		t.Errorf("Expected 400 for an invalid include_deleted, got %d", w.Code)
+	}
+	if w := srv.do("DELETE", "/albums/550e8400-e29b-41d4-a716-446655440001?permanent=maybe", "", "If-Match", "*"); w.Code != 400 {
+		t.Errorf("Expected 400 for an invalid permanent, got %d", w.Code)
+	}
+}
+
+// TestBulkDelete tests deleting every album matching a filter with DELETE /albums.
+// Verifies that confirm=true and a filter are required, that a dry run only counts the albums,
+// and that the matching albums are deleted, restorable, and purged with ?permanent=true.
+func TestBulkDelete(t *testing.T) {
+	srv := newTestServer(t)
+	deleted := func(w *httptest.ResponseRecorder) int {
+		var body struct{ Deleted int }
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return body.Deleted
+	}
+
+	for _, path := range []string{
+		"/albums?max_price=40",
+		"/albums?max_price=40&confirm=false",
+		"/albums?confirm=true",
+		"/albums?max_price=cheap&confirm=true",
+		"/albums?max_price=40&confirm=true&permanent=maybe",
+	} {
+		if w := srv.do("DELETE", path, ""); w.Code != 400 {
+			t.Errorf("DELETE %s: expected 400, got %d", path, w.Code)
+		}
+	}
+	if w := srv.do("DELETE", "/albums?max_price=40&confirm=true&dry_run=true", ""); w.Code != 200 || deleted(w) != 2 {
+		t.Errorf("Expected a dry run to count 2 albums, got %d: %s", w.Code, w.Body)
+	}
+	var albums []Album
+	json.Unmarshal(srv.do("GET", "/albums", "").Body.Bytes(), &albums)
+	if len(albums) != 3 {
+		t.Fatalf("Expected the dry run to delete nothing, got %d albums", len(albums))
+	}
+
+	if w := srv.do("DELETE", "/v1/albums?max_price=40&confirm=true", ""); w.Code != 200 || deleted(w) != 2 {
+		t.Fatalf("Expected 2 albums deleted, got %d: %s", w.Code, w.Body)
+	}
+	json.Unmarshal(srv.do("GET", "/albums", "").Body.Bytes(), &albums)
+	if len(albums) != 1 || albums[0].Artist != "John Coltrane" {
+		t.Errorf("Expected only the album over 40 to remain, got %+v", albums)
+	}
+	if w := srv.do("DELETE", "/albums?max_price=40&confirm=true", ""); deleted(w) != 0 {
+		t.Errorf("Expected deleted albums not to be deleted again, got %s", w.Body)
+	}
+	if w := srv.do("POST", "/albums/550e8400-e29b-41d4-a716-446655440002/restore", ""); w.Code != 200 {
+		t.Errorf("Expected a bulk-deleted album to be restorable, got %d", w.Code)
+	}
+
+	if w := srv.do("DELETE", "/albums?artist=vaughan&confirm=true&permanent=true", ""); deleted(w) != 1 {
+		t.Errorf("Expected the deleted album to be purged, got %s", w.Body)
+	}
+	if w := srv.do("POST", "/albums/550e8400-e29b-41d4-a716-446655440003/restore", ""); w.Code != 404 {
+		t.Errorf("Expected a purged album to be gone for good, got %d", w.Code)
+	}
+}
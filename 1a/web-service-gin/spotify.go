@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errSpotifyNoMatch is returned when a Spotify search yields no album.
+var errSpotifyNoMatch = errors.New("no matching Spotify album")
+
+// spotifyMatch is the subset of a Spotify album search result stored on an Album.
+type spotifyMatch struct {
+	ID  string
+	URL string
+}
+
+// spotifyClient searches the Spotify Web API using the OAuth client credentials flow.
+// Access tokens are cached and refreshed shortly before they expire, and search results
+// are cached with stale-while-revalidate semantics.
+type spotifyClient struct {
+	clientID     string
+	clientSecret string
+	tokenURL     string
+	apiURL       string
+	httpClient   *outboundClient
+	searches     *swrCache[spotifyMatch]
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// newSpotifyClient creates a Spotify client from cfg, registering its HTTP client in outbound.
+// Returns nil if the client credentials are not configured.
+func newSpotifyClient(cfg Config, outbound *outboundRegistry) *spotifyClient {
+	if cfg.SpotifyClientID == "" || cfg.SpotifyClientSecret == "" {
+		return nil
+	}
+	return &spotifyClient{
+		clientID:     cfg.SpotifyClientID,
+		clientSecret: cfg.SpotifyClientSecret,
+		tokenURL:     cfg.SpotifyTokenURL,
+		apiURL:       strings.TrimRight(cfg.SpotifyAPIURL, "/"),
+		httpClient:   outbound.newClient("spotify", cfg),
+		searches:     newSWRCache[spotifyMatch](cfg.EnrichmentFreshFor, cfg.EnrichmentStaleFor, cfg.EnrichmentCacheSize),
+	}
+}
+
+// accessToken returns a valid access token, requesting a new one when the cached token is missing or expiring.
+func (s *spotifyClient) accessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expiresAt) {
+		return s.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(s.clientID, s.clientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("spotify token request failed: %s", resp.Status)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	s.token = body.AccessToken
+	// Refresh a minute early so in-flight requests never carry an expired token.
+	s.expiresAt = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
+
+// searchAlbum looks up the best Spotify match for the given title and artist, using cached results when available.
+// Returns errSpotifyNoMatch if the search returns no albums.
+func (s *spotifyClient) searchAlbum(ctx context.Context, title, artist string) (spotifyMatch, error) {
+	key := strings.ToLower(title + "\x00" + artist)
+	match, err := s.searches.get(ctx, key, func(ctx context.Context) (spotifyMatch, error) {
+		match, err := s.search(ctx, title, artist)
+		if errors.Is(err, errSpotifyNoMatch) {
+			// Cache misses as an empty match so unmatched albums don't hit the API every time.
+			return spotifyMatch{}, nil
+		}
+		return match, err
+	})
+	if err != nil {
+		return spotifyMatch{}, err
+	}
+	if match.ID == "" {
+		return spotifyMatch{}, errSpotifyNoMatch
+	}
+	return match, nil
+}
+
+// search queries the Spotify search API for the given title and artist.
+// Returns errSpotifyNoMatch if the search returns no albums.
+func (s *spotifyClient) search(ctx context.Context, title, artist string) (spotifyMatch, error) {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return spotifyMatch{}, err
+	}
+
+	query := url.Values{
+		"q":     {fmt.Sprintf("album:%s artist:%s", title, artist)},
+		"type":  {"album"},
+		"limit": {"1"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.apiURL+"/v1/search?"+query.Encode(), nil)
+	if err != nil {
+		return spotifyMatch{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return spotifyMatch{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return spotifyMatch{}, fmt.Errorf("spotify search failed: %s", resp.Status)
+	}
+
+	var body struct {
+		Albums struct {
+			Items []struct {
+				ID           string `json:"id"`
+				ExternalURLs struct {
+					Spotify string `json:"spotify"`
+				} `json:"external_urls"`
+			} `json:"items"`
+		} `json:"albums"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return spotifyMatch{}, err
+	}
+	if len(body.Albums.Items) == 0 {
+		return spotifyMatch{}, errSpotifyNoMatch
+	}
+
+	item := body.Albums.Items[0]
+	return spotifyMatch{ID: item.ID, URL: item.ExternalURLs.Spotify}, nil
+}
+
+// spotifyBackfill tracks the progress of the batch job that links albums missing a Spotify ID.
+type spotifyBackfill struct {
+	mu         sync.Mutex
+	running    bool
+	linked     int
+	unmatched  int
+	failed     int
+	startedAt  time.Time
+	finishedAt time.Time
+}
+
+// backfillInterval is the pause between Spotify searches during a backfill, to stay under the API rate limit.
+var backfillInterval = 100 * time.Millisecond
+
+// start launches the backfill of srv's albums in a new goroutine.
+// Returns false if a backfill is already running.
+func (b *spotifyBackfill) start(srv *Server) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.running {
+		return false
+	}
+	b.running = true
+	b.linked, b.unmatched, b.failed = 0, 0, 0
+	b.startedAt = time.Now()
+	b.finishedAt = time.Time{}
+	go b.run(srv)
+	return true
+}
+
+// run links every album that has no Spotify ID yet, recording the outcome of each search.
+func (b *spotifyBackfill) run(srv *Server) {
+	all, err := srv.store.List(context.Background())
+	if err != nil {
+		b.mu.Lock()
+		b.failed++
+		b.running = false
+		b.finishedAt = time.Now()
+		b.mu.Unlock()
+		return
+	}
+
+	var pending []Album
+	for _, a := range all {
+		if a.SpotifyID == "" {
+			pending = append(pending, a)
+		}
+	}
+
+	for i, a := range pending {
+		if i > 0 {
+			time.Sleep(backfillInterval)
+		}
+		match, err := srv.spotify.searchAlbum(context.Background(), a.Title, a.Artist)
+		if err == nil {
+			var linked Album
+			linked, err = srv.updateAlbum(context.Background(), a.ID, func(a *Album) error {
+				a.SpotifyID = match.ID
+				a.SpotifyURL = match.URL
+				return nil
+			})
+			if err == nil {
+				srv.publishAlbumEvent(context.Background(), eventAlbumUpdated, linked, &a)
+			}
+		}
+
+		b.mu.Lock()
+		switch {
+		case errors.Is(err, errSpotifyNoMatch):
+			b.unmatched++
+		case errors.Is(err, errAlbumNotFound):
+			// Deleted while the backfill was running; nothing to link.
+		case err != nil:
+			b.failed++
+		default:
+			b.linked++
+		}
+		b.mu.Unlock()
+	}
+
+	b.mu.Lock()
+	b.running = false
+	b.finishedAt = time.Now()
+	b.mu.Unlock()
+}
+
+// status returns a JSON-friendly snapshot of the backfill progress.
+func (b *spotifyBackfill) status() map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := map[string]any{
+		"running":   b.running,
+		"linked":    b.linked,
+		"unmatched": b.unmatched,
+		"failed":    b.failed,
+	}
+	if !b.startedAt.IsZero() {
+		status["started_at"] = b.startedAt.Format(time.RFC3339)
+	}
+	if !b.finishedAt.IsZero() {
+		status["finished_at"] = b.finishedAt.Format(time.RFC3339)
+	}
+	return status
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newMockSpotify starts a fake Spotify token and search API.
+// Searches for the album "Blue Train" return a match; all other searches return no items.
+func newMockSpotify(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "token", "expires_in": 3600})
+	})
+	mux.HandleFunc("/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		items := []map[string]any{}
+		if r.URL.Query().Get("q") == "album:Blue Train artist:John Coltrane" {
+			items = append(items, map[string]any{
+				"id":            "spotify-blue-train",
+				"external_urls": map[string]string{"spotify": "https://open.spotify.com/album/spotify-blue-train"},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"albums": map[string]any{"items": items}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// useMockSpotify points srv's Spotify client at a mock server.
+func useMockSpotify(t *testing.T, srv *Server) {
+	server := newMockSpotify(t)
+	srv.spotify = newSpotifyClient(Config{
+		SpotifyClientID:     "client",
+		SpotifyClientSecret: "secret",
+		SpotifyTokenURL:     server.URL + "/api/token",
+		SpotifyAPIURL:       server.URL,
+		OutboundTimeout:     time.Second,
+	}, srv.outbound)
+}
+
+// TestLinkSpotify tests the POST /albums/:id/link/spotify endpoint.
+// Verifies that a matched album stores the Spotify ID and URL (HTTP 200),
+// an unmatched album returns HTTP 404, and an unconfigured client returns HTTP 503.
+func TestLinkSpotify(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := srv.do("POST", "/albums/550e8400-e29b-41d4-a716-446655440001/link/spotify", "")
+	if w.Code != 503 {
+		t.Errorf("Expected 503 without credentials, got %d", w.Code)
+	}
+
+	useMockSpotify(t, srv)
+
+	w = srv.do("POST", "/albums/550e8400-e29b-41d4-a716-446655440001/link/spotify", "")
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var album Album
+	if err := json.Unmarshal(w.Body.Bytes(), &album); err != nil {
+		t.Fatal(err)
+	}
+	if album.SpotifyID != "spotify-blue-train" {
+		t.Errorf("Expected 'spotify-blue-train', got '%s'", album.SpotifyID)
+	}
+	if album.SpotifyURL == "" {
+		t.Error("Spotify URL should be set")
+	}
+
+	// Test album without a Spotify match
+	w = srv.do("POST", "/albums/550e8400-e29b-41d4-a716-446655440002/link/spotify", "")
+	if w.Code != 404 {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
+
+// TestSpotifyBackfill tests the POST /admin/spotify/backfill endpoint.
+// Verifies that the job starts (HTTP 202), links matching albums, and counts unmatched ones.
+func TestSpotifyBackfill(t *testing.T) {
+	srv := newTestServer(t)
+	useMockSpotify(t, srv)
+	backfillInterval = 0
+
+	w := srv.do("POST", "/admin/spotify/backfill", "")
+	if w.Code != 202 {
+		t.Fatalf("Expected 202, got %d", w.Code)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.backfill.status()["running"] == true && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := srv.backfill.status()
+	if status["linked"] != 1 {
+		t.Errorf("Expected 1 linked album, got %v", status["linked"])
+	}
+	if status["unmatched"] != 2 {
+		t.Errorf("Expected 2 unmatched albums, got %v", status["unmatched"])
+	}
+	linked, _ := srv.store.Get(context.Background(), "550e8400-e29b-41d4-a716-446655440001")
+	if linked.SpotifyID != "spotify-blue-train" {
+		t.Errorf("Expected 'spotify-blue-train', got '%s'", linked.SpotifyID)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// sqlArtists keeps artists in the artists table of a SQL store, next to its albums, each as a
+// JSON document with its lowercased name (see artistKey) copied into the unique name_key column.
+// postgresStore and sqliteStore embed it, configured for their dialect.
+type sqlArtists struct {
+	db *sql.DB
+	// placeholder returns the parameter marker for the nth argument, counting from 1.
+	placeholder func(n int) string
+	// forUpdate ends queries reading rows that the transaction goes on to change or relies on: FOR
+	// UPDATE on Postgres, and nothing on SQLite, whose write transactions lock the whole database.
+	forUpdate string
+	// credited is the condition selecting the albums that may be credited to the artist whose ID is
+	// the first argument: those with that artist_id, or with none (see albumArtistID).
+	credited string
+	// unique reports whether err violates a unique constraint of the artists table.
+	unique func(err error) bool
+}
+
+// scanArtist decodes the JSON document in row into an Artist.
+func scanArtist(row interface{ Scan(...any) error }) (Artist, error) {
+	var doc []byte
+	if err := row.Scan(&doc); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Artist{}, errArtistNotFound
+		}
+		return Artist{}, err
+	}
+	var artist Artist
+	err := json.Unmarshal(doc, &artist)
+	return artist, err
+}
+
+// ListArtists returns every artist.
+func (s sqlArtists) ListArtists(ctx context.Context) ([]Artist, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT doc FROM artists`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	artists := []Artist{}
+	for rows.Next() {
+		artist, err := scanArtist(rows)
+		if err != nil {
+			return nil, err
+		}
+		artists = append(artists, artist)
+	}
+	return artists, rows.Err()
+}
+
+// GetArtist returns the artist with the given ID.
+func (s sqlArtists) GetArtist(ctx context.Context, id string) (Artist, error) {
+	return scanArtist(s.db.QueryRowContext(ctx, `SELECT doc FROM artists WHERE id = `+s.placeholder(1), id))
+}
+
+// ArtistNamed returns the artist with the given name, ignoring case, using the name_key column.
+func (s sqlArtists) ArtistNamed(ctx context.Context, name string) (Artist, error) {
+	return scanArtist(s.db.QueryRowContext(ctx, `SELECT doc FROM artists WHERE name_key = `+s.placeholder(1), artistKey(name)))
+}
+
+// CreateArtist inserts a new artist, relying on the table's unique constraints to reject one whose
+// name or ID is taken.
+func (s sqlArtists) CreateArtist(ctx context.Context, artist Artist) error {
+	doc, err := json.Marshal(artist)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO artists (id, name_key, doc) VALUES (`+s.placeholder(1)+`, `+s.placeholder(2)+`, `+s.placeholder(3)+`)`,
+		artist.ID, artistKey(artist.Name), string(doc))
+	return s.existsError(ctx, artist, err)
+}
+
+// existsError translates err, from writing artist, into an artistExistsError naming the artist
+// with its name, or else artist itself, if it violates a unique constraint.
+func (s sqlArtists) existsError(ctx context.Context, artist Artist, err error) error {
+	if err == nil || !s.unique(err) {
+		return err
+	}
+	if other, err := s.ArtistNamed(ctx, artist.Name); err == nil && other.ID != artist.ID {
+		return artistExistsError{other.ID}
+	}
+	return artistExistsError{artist.ID}
+}
+
+// RenameArtist locks the artist's row and its albums' rows, then renames them in one transaction.
+func (s sqlArtists) RenameArtist(ctx context.Context, id, name string, rename func(*Album)) (Artist, []albumChange, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Artist{}, nil, err
+	}
+	defer tx.Rollback()
+
+	artist, err := scanArtist(tx.QueryRowContext(ctx, `SELECT doc FROM artists WHERE id = `+s.placeholder(1)+s.forUpdate, id))
+	if err != nil {
+		return Artist{}, nil, err
+	}
+	artist = renamedArtist(artist, name, time.Now().UTC())
+	doc, err := json.Marshal(artist)
+	if err != nil {
+		return Artist{}, nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE artists SET name_key = `+s.placeholder(1)+`, doc = `+s.placeholder(2)+` WHERE id = `+s.placeholder(3),
+		artistKey(artist.Name), string(doc), id); err != nil {
+		return Artist{}, nil, s.existsError(ctx, artist, err)
+	}
+
+	albums, err := queryAlbums(ctx, tx, `SELECT doc FROM albums WHERE `+s.credited+` ORDER BY seq`+s.forUpdate, id)
+	if err != nil {
+		return Artist{}, nil, err
+	}
+	changes := []albumChange{}
+	for _, a := range albums {
+		if albumArtistID(a) != id {
+			continue
+		}
+		updated := a
+		rename(&updated)
+		updated.ID = a.ID
+		doc, err := json.Marshal(updated)
+		if err != nil {
+			return Artist{}, nil, err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE albums SET artist = `+s.placeholder(1)+`, doc = `+s.placeholder(2)+` WHERE id = `+s.placeholder(3),
+			updated.Artist, string(doc), updated.ID); err != nil {
+			return Artist{}, nil, err
+		}
+		changes = append(changes, albumChange{Album: updated, Previous: a})
+	}
+	if err := tx.Commit(); err != nil {
+		return Artist{}, nil, err
+	}
+	return artist, changes, nil
+}
+
+// DeleteArtist locks the artist's row and its albums' rows, checks that there are no albums, and
+// deletes the artist in one transaction.
+func (s sqlArtists) DeleteArtist(ctx context.Context, id string) (Artist, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Artist{}, err
+	}
+	defer tx.Rollback()
+
+	artist, err := scanArtist(tx.QueryRowContext(ctx, `SELECT doc FROM artists WHERE id = `+s.placeholder(1)+s.forUpdate, id))
+	if err != nil {
+		return Artist{}, err
+	}
+	albums, err := queryAlbums(ctx, tx, `SELECT doc FROM albums WHERE `+s.credited+s.forUpdate, id)
+	if err != nil {
+		return Artist{}, err
+	}
+	for _, a := range albums {
+		if albumArtistID(a) == id {
+			return Artist{}, errArtistHasAlbums
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM artists WHERE id = `+s.placeholder(1), id); err != nil {
+		return Artist{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Artist{}, err
+	}
+	return artist, nil
+}
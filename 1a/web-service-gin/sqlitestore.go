@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"sort"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteMigrations are applied in file name order when the SQLite store opens.
+//
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// sqliteStore keeps albums in a local SQLite database file. Like postgresStore, each album is
+// stored as a JSON document with the title, artist, price, and normalized UPC copied into columns,
+// and artists are kept in the artists table (see sqlArtists).
+type sqliteStore struct {
+	sqlArtists
+	db *sql.DB
+	// group batches creates and deletes into shared transactions; nil if group commit is disabled.
+	group *groupCommitter[sqlWrite]
+}
+
+// newSQLiteStore opens (creating if needed) the database file at cfg.SQLitePath and creates or
+// upgrades its schema. The database uses write-ahead logging, and write transactions take the
+// write lock when they begin so concurrent updates wait for each other instead of failing.
+func newSQLiteStore(cfg Config) (AlbumStore, error) {
+	if cfg.SQLitePath == "" {
+		return nil, errors.New("a database path is required for sqlite storage")
+	}
+	dsn := "file:" + (&url.URL{Path: cfg.SQLitePath}).EscapedPath() +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if err := migrateSQLite(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate sqlite %s: %w", cfg.SQLitePath, err)
+	}
+	artists := sqlArtists{
+		db:          db,
+		placeholder: func(int) string { return "?" },
+		credited:    `(json_extract(doc, '$.artist_id') = ? OR COALESCE(json_extract(doc, '$.artist_id'), '') = '')`,
+		unique: func(err error) bool {
+			var sqliteErr *sqlite.Error
+			return errors.As(err, &sqliteErr) && strings.Contains(sqliteErr.Error(), "artists.") &&
+				(sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+		},
+	}
+	return &sqliteStore{sqlArtists: artists, db: db, group: newSQLGroupCommitter(db, cfg)}, nil
+}
+
+// migrateSQLite applies every embedded migration not yet recorded in schema_migrations,
+// each in its own transaction.
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(sqliteMigrations, "migrations/sqlite/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		script, err := sqliteMigrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		// Checked inside the transaction, which holds the write lock, so two servers opening the
+		// same file never apply a migration twice.
+		var applied bool
+		if err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?)`, name).Scan(&applied); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if applied {
+			tx.Rollback()
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, name); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteError translates a unique violation on upc_key into errUPCConflict.
+func sqliteError(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE &&
+		strings.Contains(sqliteErr.Error(), "albums.upc_key") {
+		return errUPCConflict
+	}
+	return err
+}
+
+// List returns every album in insertion order.
+func (s *sqliteStore) List(ctx context.Context) ([]Album, error) {
+	return queryAlbums(ctx, s.db, `SELECT doc FROM albums ORDER BY seq`)
+}
+
+// Each calls fn with every album in insertion order, reading them from the database as it goes.
+func (s *sqliteStore) Each(ctx context.Context, fn func(Album) error) error {
+	return eachRow(ctx, s.db, fn, `SELECT doc FROM albums ORDER BY seq`)
+}
+
+// Stats returns the catalog statistics, computed by the database with aggregate queries.
+func (s *sqliteStore) Stats(ctx context.Context) (albumStats, error) {
+	return sqlStats(ctx, s.db, `json_extract(doc, '$.deleted_at') IS NULL`)
+}
+
+// Query returns the albums selected by f in insertion order, filtering on the artist and price columns.
+func (s *sqliteStore) Query(ctx context.Context, f albumFilter) ([]Album, error) {
+	where, args := sqlFilter(f, func(int) string { return "?" })
+	return queryAlbums(ctx, s.db, `SELECT doc FROM albums`+where+` ORDER BY seq`, args...)
+}
+
+// Get returns the album with the given ID.
+func (s *sqliteStore) Get(ctx context.Context, id string) (Album, error) {
+	return scanAlbum(s.db.QueryRowContext(ctx, `SELECT doc FROM albums WHERE id = ?`, id))
+}
+
+// GetByUPC returns the album with the given barcode using the unique upc_key index.
+func (s *sqliteStore) GetByUPC(ctx context.Context, code string) (Album, error) {
+	return scanAlbum(s.db.QueryRowContext(ctx, `SELECT doc FROM albums WHERE upc_key = ?`, normalizeUPC(code)))
+}
+
+// Create inserts a new album, as part of a group commit if enabled.
+func (s *sqliteStore) Create(ctx context.Context, a Album) (Album, error) {
+	doc, err := json.Marshal(a)
+	if err != nil {
+		return Album{}, err
+	}
+	err = writeSQL(ctx, s.db, s.group, func(ctx context.Context, q sqlExecutor) error {
+		return insertSQLiteAlbum(ctx, q, a, doc)
+	})
+	if err != nil {
+		return Album{}, sqliteError(err)
+	}
+	return a, nil
+}
+
+// CreateUnique inserts a new album unless one with the same title and artist exists. The check
+// and insert share a write transaction, which holds the database's write lock from its start, so
+// concurrent creates cannot both pass the check.
+func (s *sqliteStore) CreateUnique(ctx context.Context, a Album) (Album, error) {
+	doc, err := json.Marshal(a)
+	if err != nil {
+		return Album{}, err
+	}
+	err = writeSQLTx(ctx, s.db, s.group, func(ctx context.Context, q sqlExecutor) error {
+		var id string
+		err := q.QueryRowContext(ctx,
+			`SELECT id FROM albums WHERE LOWER(title) = LOWER(?) AND LOWER(artist) = LOWER(?) ORDER BY seq LIMIT 1`,
+			a.Title, a.Artist).Scan(&id)
+		switch {
+		case err == nil:
+			return duplicateAlbumError{ID: id}
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+		return insertSQLiteAlbum(ctx, q, a, doc)
+	})
+	if err != nil {
+		return Album{}, sqliteError(err)
+	}
+	return a, nil
+}
+
+// insertSQLiteAlbum inserts a with its JSON document doc.
+func insertSQLiteAlbum(ctx context.Context, q sqlExecutor, a Album, doc []byte) error {
+	_, err := q.ExecContext(ctx,
+		`INSERT INTO albums (id, title, artist, price, upc_key, doc) VALUES (?, ?, ?, ?, ?, ?)`,
+		a.ID, a.Title, a.Artist, a.Price, upcKey(a), string(doc))
+	return err
+}
+
+// Update reads the album, applies mutate, and writes the result in one write transaction.
+func (s *sqliteStore) Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, false)
+}
+
+// UpdateUnique updates the album like Update unless the result has the title and artist of another
+// album. The check and write share the write transaction, so concurrent updates cannot both pass it.
+func (s *sqliteStore) UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return s.update(ctx, id, mutate, true)
+}
+
+// update reads the album, applies mutate, and writes the result in one write transaction, first
+// checking a retitled album for a duplicate if unique is set.
+func (s *sqliteStore) update(ctx context.Context, id string, mutate func(*Album) error, unique bool) (Album, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Album{}, err
+	}
+	defer tx.Rollback()
+
+	a, err := scanAlbum(tx.QueryRowContext(ctx, `SELECT doc FROM albums WHERE id = ?`, id))
+	if err != nil {
+		return Album{}, err
+	}
+	key := albumNameKey(a.Title, a.Artist)
+	if err := mutate(&a); err != nil {
+		return Album{}, err
+	}
+	a.ID = id
+	if unique && albumNameKey(a.Title, a.Artist) != key {
+		var other string
+		err := tx.QueryRowContext(ctx,
+			`SELECT id FROM albums WHERE LOWER(title) = LOWER(?) AND LOWER(artist) = LOWER(?) AND id <> ? ORDER BY seq LIMIT 1`,
+			a.Title, a.Artist, id).Scan(&other)
+		switch {
+		case err == nil:
+			return Album{}, duplicateAlbumError{ID: other}
+		case !errors.Is(err, sql.ErrNoRows):
+			return Album{}, err
+		}
+	}
+
+	doc, err := json.Marshal(a)
+	if err != nil {
+		return Album{}, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE albums SET title = ?, artist = ?, price = ?, upc_key = ?, doc = ? WHERE id = ?`,
+		a.Title, a.Artist, a.Price, upcKey(a), string(doc), id); err != nil {
+		return Album{}, sqliteError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Album{}, err
+	}
+	return a, nil
+}
+
+// UpdateWhere reads the albums selected by f, applies mutate to each, and writes those it changed
+// in one write transaction.
+func (s *sqliteStore) UpdateWhere(ctx context.Context, f albumFilter, mutate func(*Album) bool) ([]Album, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	where, args := sqlFilter(f, func(int) string { return "?" })
+	matching, err := queryAlbums(ctx, tx, `SELECT doc FROM albums`+where+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	changed := []Album{}
+	for _, a := range matching {
+		id := a.ID
+		if !mutate(&a) {
+			continue
+		}
+		a.ID = id
+		doc, err := json.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE albums SET price = ?, doc = ? WHERE id = ?`, a.Price, string(doc), id); err != nil {
+			return nil, sqliteError(err)
+		}
+		changed = append(changed, a)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// DeleteWhere removes the rows selected by f in one statement and returns their albums.
+func (s *sqliteStore) DeleteWhere(ctx context.Context, f albumFilter) ([]Album, error) {
+	where, args := sqlFilter(f, func(int) string { return "?" })
+	return queryAlbums(ctx, s.db, `DELETE FROM albums`+where+` RETURNING doc`, args...)
+}
+
+// Delete removes the album with the given ID and returns it, as part of a group commit if enabled.
+func (s *sqliteStore) Delete(ctx context.Context, id string) (Album, error) {
+	var a Album
+	err := writeSQL(ctx, s.db, s.group, func(ctx context.Context, q sqlExecutor) error {
+		var err error
+		a, err = scanAlbum(q.QueryRowContext(ctx, `DELETE FROM albums WHERE id = ? RETURNING doc`, id))
+		return err
+	})
+	return a, err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestSQLiteStore tests the SQLite AlbumStore against a new database file in a temporary directory.
+func TestSQLiteStore(t *testing.T) {
+	cfg := loadConfig()
+	cfg.SQLitePath = filepath.Join(t.TempDir(), "albums.db")
+	s, err := newSQLiteStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.(*sqliteStore).db.Close()
+
+	testAlbumStore(t, s)
+	testUniqueAlbumNames(t, s)
+	testArtistStore(t, s)
+}
+
+// TestSQLiteStorePersists tests that albums survive reopening the database file.
+// Verifies that the schema is created on first run and not re-applied on the second.
+func TestSQLiteStorePersists(t *testing.T) {
+	ctx := context.Background()
+	cfg := loadConfig()
+	cfg.SQLitePath = filepath.Join(t.TempDir(), "albums.db")
+
+	first, err := newSQLiteStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Create(ctx, Album{ID: "a", Title: "Kind of Blue", Artist: "Miles Davis", Price: 49.99}); err != nil {
+		t.Fatal(err)
+	}
+	first.(*sqliteStore).db.Close()
+
+	second, err := newSQLiteStore(cfg)
+	if err != nil {
+		t.Fatalf("Expected reopening to skip applied migrations, got %v", err)
+	}
+	defer second.(*sqliteStore).db.Close()
+	a, err := second.Get(ctx, "a")
+	if err != nil || a.Title != "Kind of Blue" {
+		t.Errorf("Expected the album after reopening, got %+v, %v", a, err)
+	}
+}
+
+// TestSQLiteStoreConcurrentUpdates tests that concurrent updates wait for each other instead of
+// failing or losing writes.
+func TestSQLiteStoreConcurrentUpdates(t *testing.T) {
+	ctx := context.Background()
+	cfg := loadConfig()
+	cfg.SQLitePath = filepath.Join(t.TempDir(), "albums.db")
+	s, err := newSQLiteStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.(*sqliteStore).db.Close()
+	if _, err := s.Create(ctx, Album{ID: "a", Title: "Kind of Blue", Artist: "Miles Davis", Price: 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Update(ctx, "a", func(a *Album) error { a.Price++; return nil }); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if a, _ := s.Get(ctx, "a"); a.Price != 20 {
+		t.Errorf("Expected price 20 after 20 increments, got %v", a.Price)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staleWarning is the Warning header sent with a response served from cached albums because the
+// store failed (RFC 9111 warn-code 110).
+const staleWarning = `110 - "Response is Stale"`
+
+// staleNotifierKey is the context key holding the function that marks the response to a read
+// request stale (see staleReadMiddleware).
+type staleNotifierKey struct{}
+
+// staleReadStore is an AlbumStore that keeps the last albums it read from the store, per tenant,
+// so that a read request can be answered from them, marked stale, when the store fails or takes
+// longer than timeout, instead of failing the request during a brief outage. Albums last read
+// more than maxAge ago are not used. Only requests marked by staleReadMiddleware are answered
+// from the cache; other reads and every write fail as usual.
+type staleReadStore struct {
+	AlbumStore
+	maxAge, timeout time.Duration
+	now             func() time.Time
+
+	mu sync.Mutex
+	// lists holds each tenant's last full listing, and albums the last copy of each album read
+	// or written, keyed by tenant and ID.
+	lists  map[string]staleEntry[[]Album]
+	albums map[string]staleEntry[Album]
+}
+
+// staleEntry is a cached value and when it was read.
+type staleEntry[V any] struct {
+	value  V
+	readAt time.Time
+}
+
+// newStaleReadStore wraps s to answer reads from cached albums when it fails, as configured by
+// cfg. Returns nil if STALE_READ_MAX_AGE is not set, which disables stale reads.
+func newStaleReadStore(s AlbumStore, cfg Config) *staleReadStore {
+	if cfg.StaleReadMaxAge <= 0 {
+		return nil
+	}
+	return &staleReadStore{
+		AlbumStore: s,
+		maxAge:     cfg.StaleReadMaxAge,
+		timeout:    cfg.StaleReadTimeout,
+		now:        time.Now,
+		lists:      map[string]staleEntry[[]Album]{},
+		albums:     map[string]staleEntry[Album]{},
+	}
+}
+
+// staleReadMiddleware lets GET and HEAD requests be answered from cached albums if the store fails
+// (see staleReadStore). Such responses carry a Warning header and are counted in m.
+func staleReadMiddleware(m *requestMetrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		var once sync.Once
+		markStale := func() {
+			// Sections of a response may be read concurrently.
+			once.Do(func() {
+				c.Header("Warning", staleWarning)
+				m.stale.Add(1)
+			})
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), staleNotifierKey{}, markStale))
+		c.Next()
+	}
+}
+
+// readStale returns the result of read, which is given a context that times out after timeout if
+// it is not 0. If read fails for a request that accepts stale responses, because of the store and
+// not because the album does not exist or the client went away, the result of cached is returned
+// instead, if it has one, and the response is marked stale.
+func readStale[V any](ctx context.Context, timeout time.Duration, read func(context.Context) (V, error), cached func() (V, bool)) (V, error) {
+	readCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		readCtx, cancel = withDeadline(ctx, time.Now().Add(timeout))
+		defer cancel()
+	}
+	value, err := read(readCtx)
+	if err == nil || errors.Is(err, errAlbumNotFound) || ctx.Err() != nil {
+		return value, err
+	}
+	markStale, ok := ctx.Value(staleNotifierKey{}).(func())
+	if !ok {
+		return value, err
+	}
+	if cachedValue, ok := cached(); ok {
+		markStale()
+		return cachedValue, nil
+	}
+	return value, err
+}
+
+// albumKey returns the cache key of the album with the given ID for the tenant in ctx.
+func albumKey(ctx context.Context, id string) string {
+	return tenantFrom(ctx) + "\x00" + id
+}
+
+// remember caches a as read now.
+func (s *staleReadStore) remember(ctx context.Context, a Album) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.albums[albumKey(ctx, a.ID)] = staleEntry[Album]{a, s.now()}
+}
+
+// forget drops the cached album with the given ID.
+func (s *staleReadStore) forget(ctx context.Context, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.albums, albumKey(ctx, id))
+}
+
+// fresh reports whether a value read at readAt is recent enough to be served. The caller must
+// hold s.mu.
+func (s *staleReadStore) fresh(readAt time.Time) bool {
+	return !readAt.IsZero() && s.now().Sub(readAt) <= s.maxAge
+}
+
+// cachedList returns the tenant's last listing, if it is recent enough.
+func (s *staleReadStore) cachedList(ctx context.Context) ([]Album, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.lists[tenantFrom(ctx)]
+	return entry.value, s.fresh(entry.readAt)
+}
+
+// cachedAlbum returns the most recently read copy of the tenant's album that match selects, from
+// the albums read one at a time or the tenant's last listing, if it is recent enough. The album is
+// looked up by id, or, if that is "", by scanning every cached album.
+func (s *staleReadStore) cachedAlbum(ctx context.Context, id string, match func(Album) bool) (Album, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var best staleEntry[Album]
+	if id != "" {
+		if entry, ok := s.albums[albumKey(ctx, id)]; ok && match(entry.value) {
+			best = entry
+		}
+	} else {
+		for key, entry := range s.albums {
+			if key == albumKey(ctx, entry.value.ID) && match(entry.value) && entry.readAt.After(best.readAt) {
+				best = entry
+			}
+		}
+	}
+	if list := s.lists[tenantFrom(ctx)]; list.readAt.After(best.readAt) {
+		for _, a := range list.value {
+			if match(a) {
+				best = staleEntry[Album]{a, list.readAt}
+				break
+			}
+		}
+	}
+	return best.value, s.fresh(best.readAt)
+}
+
+// List returns every album, caching them, or the cached albums if the store fails.
+func (s *staleReadStore) List(ctx context.Context) ([]Album, error) {
+	return readStale(ctx, s.timeout, func(ctx context.Context) ([]Album, error) {
+		all, err := s.AlbumStore.List(ctx)
+		if err == nil {
+			s.mu.Lock()
+			s.lists[tenantFrom(ctx)] = staleEntry[[]Album]{all, s.now()}
+			s.mu.Unlock()
+		}
+		return all, err
+	}, func() ([]Album, bool) {
+		return s.cachedList(ctx)
+	})
+}
+
+// Query returns the albums selected by f, filtering in the store if it supports that, or the
+// cached albums f selects if the store fails.
+func (s *staleReadStore) Query(ctx context.Context, f albumFilter) ([]Album, error) {
+	return readStale(ctx, s.timeout, func(ctx context.Context) ([]Album, error) {
+		return listAlbums(ctx, s.AlbumStore, f)
+	}, func() ([]Album, bool) {
+		all, ok := s.cachedList(ctx)
+		return filterAlbums(all, f.matches), ok
+	})
+}
+
+// Each calls fn with every album, streaming them from the store if it supports that. If the store
+// fails before the first album, fn is called with the cached albums instead. Streams can take as
+// long as the client needs to read them, so they are not bounded by the read timeout.
+func (s *staleReadStore) Each(ctx context.Context, fn func(Album) error) error {
+	streamed := false
+	cached, err := readStale(ctx, 0, func(ctx context.Context) ([]Album, error) {
+		return nil, eachAlbum(ctx, s.AlbumStore, func(a Album) error {
+			streamed = true
+			return fn(a)
+		})
+	}, func() ([]Album, bool) {
+		if streamed {
+			return nil, false
+		}
+		return s.cachedList(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	for _, a := range cached {
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the album with the given ID, caching it, or its cached copy if the store fails.
+func (s *staleReadStore) Get(ctx context.Context, id string) (Album, error) {
+	return readStale(ctx, s.timeout, func(ctx context.Context) (Album, error) {
+		a, err := s.AlbumStore.Get(ctx, id)
+		if err == nil {
+			s.remember(ctx, a)
+		}
+		return a, err
+	}, func() (Album, bool) {
+		return s.cachedAlbum(ctx, id, func(a Album) bool { return a.ID == id })
+	})
+}
+
+// GetByUPC returns the album with the given barcode, using the store's index if it has one, or
+// the cached album with it if the store fails.
+func (s *staleReadStore) GetByUPC(ctx context.Context, code string) (Album, error) {
+	return readStale(ctx, s.timeout, func(ctx context.Context) (Album, error) {
+		a, err := findAlbumByUPC(ctx, s.AlbumStore, code)
+		if err == nil {
+			s.remember(ctx, a)
+		}
+		return a, err
+	}, func() (Album, bool) {
+		want := normalizeUPC(code)
+		return s.cachedAlbum(ctx, "", func(a Album) bool { return a.UPC != "" && normalizeUPC(a.UPC) == want })
+	})
+}
+
+// Stats returns the statistics of every album, computed by the store if it supports that. They
+// are not cached.
+func (s *staleReadStore) Stats(ctx context.Context) (albumStats, error) {
+	return catalogStats(ctx, s.AlbumStore)
+}
+
+// Create stores a new album, caching it.
+func (s *staleReadStore) Create(ctx context.Context, a Album) (Album, error) {
+	created, err := s.AlbumStore.Create(ctx, a)
+	if err == nil {
+		s.remember(ctx, created)
+	}
+	return created, err
+}
+
+// CreateUnique creates an album unless one with the same title and artist exists, atomically if
+// the store supports that, caching it.
+func (s *staleReadStore) CreateUnique(ctx context.Context, a Album) (Album, error) {
+	created, err := createUnique(ctx, s.AlbumStore, a)
+	if err == nil {
+		s.remember(ctx, created)
+	}
+	return created, err
+}
+
+// Update applies mutate to the album with the given ID, caching the result.
+func (s *staleReadStore) Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	updated, err := s.AlbumStore.Update(ctx, id, mutate)
+	if err == nil {
+		s.remember(ctx, updated)
+	}
+	return updated, err
+}
+
+// UpdateUnique updates an album unless it would get the title and artist of another album,
+// atomically if the store supports that, caching the result.
+func (s *staleReadStore) UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	updated, err := updateUnique(ctx, s.AlbumStore, id, mutate)
+	if err == nil {
+		s.remember(ctx, updated)
+	}
+	return updated, err
+}
+
+// Delete removes the album with the given ID, dropping its cached copy.
+func (s *staleReadStore) Delete(ctx context.Context, id string) (Album, error) {
+	a, err := s.AlbumStore.Delete(ctx, id)
+	if err == nil {
+		s.forget(ctx, id)
+	}
+	return a, err
+}
+
+// UpdateWhere changes the albums selected by f, atomically if the store supports that, caching
+// the results.
+func (s *staleReadStore) UpdateWhere(ctx context.Context, f albumFilter, mutate func(*Album) bool) ([]Album, error) {
+	changed, err := updateWhere(ctx, s.AlbumStore, f, mutate)
+	for _, a := range changed {
+		s.remember(ctx, a)
+	}
+	return changed, err
+}
+
+// DeleteWhere removes the albums selected by f, atomically if the store supports that, dropping
+// their cached copies.
+func (s *staleReadStore) DeleteWhere(ctx context.Context, f albumFilter) ([]Album, error) {
+	deleted, err := deleteWhere(ctx, s.AlbumStore, f)
+	for _, a := range deleted {
+		s.forget(ctx, a.ID)
+	}
+	return deleted, err
+}
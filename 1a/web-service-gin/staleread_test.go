@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// outageStore is a memory store whose reads fail while down is set, or block until they time out
+// while slow is set.
+type outageStore struct {
+	*memoryStore
+	down, slow atomic.Bool
+}
+
+// fail returns the error a read fails with during an outage, or nil.
+func (s *outageStore) fail(ctx context.Context) error {
+	if s.slow.Load() {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if s.down.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (s *outageStore) List(ctx context.Context) ([]Album, error) {
+	if err := s.fail(ctx); err != nil {
+		return nil, err
+	}
+	return s.memoryStore.List(ctx)
+}
+
+func (s *outageStore) Query(ctx context.Context, f albumFilter) ([]Album, error) {
+	if err := s.fail(ctx); err != nil {
+		return nil, err
+	}
+	return s.memoryStore.Query(ctx, f)
+}
+
+func (s *outageStore) Get(ctx context.Context, id string) (Album, error) {
+	if err := s.fail(ctx); err != nil {
+		return Album{}, err
+	}
+	return s.memoryStore.Get(ctx, id)
+}
+
+// TestStaleReads tests answering GET requests from cached albums while the store is failing.
+// Verifies that listings, filtered listings, and albums read before the outage are served with a
+// Warning header and counted, that albums never read and albums read too long ago still fail, and
+// that a read taking longer than STALE_READ_TIMEOUT is answered from the cache.
+func TestStaleReads(t *testing.T) {
+	store := &outageStore{memoryStore: newMemoryStore(seedAlbums())}
+	srv := newTestServerWith(t, store, func(cfg *Config) {
+		cfg.StaleReadMaxAge = time.Minute
+		cfg.StaleReadTimeout = 50 * time.Millisecond
+	})
+	const id = "550e8400-e29b-41d4-a716-446655440002"
+
+	if w := srv.do("GET", "/albums", ""); w.Code != 200 || w.Header().Get("Warning") != "" {
+		t.Fatalf("Expected a fresh listing, got %d with Warning %q", w.Code, w.Header().Get("Warning"))
+	}
+	srv.do("GET", "/albums/"+id, "")
+
+	store.down.Store(true)
+	for _, tc := range []struct {
+		path   string
+		albums int
+	}{
+		{"/albums", 3},
+		{"/albums?artist=mulligan", 1},
+	} {
+		w := srv.do("GET", tc.path, "")
+		var albums []Album
+		json.Unmarshal(w.Body.Bytes(), &albums)
+		if w.Code != 200 || w.Header().Get("Warning") != staleWarning || len(albums) != tc.albums {
+			t.Errorf("%s: expected %d stale albums, got %d with Warning %q: %s", tc.path, tc.albums, w.Code, w.Header().Get("Warning"), w.Body)
+		}
+	}
+	if w := srv.do("GET", "/albums/"+id, ""); w.Code != 200 || w.Header().Get("Warning") != staleWarning {
+		t.Errorf("Expected the stale album, got %d with Warning %q", w.Code, w.Header().Get("Warning"))
+	}
+	if w := srv.do("GET", "/albums/missing", ""); w.Code != 500 {
+		t.Errorf("Expected 500 for an album that was never read, got %d", w.Code)
+	}
+
+	var summary struct {
+		StaleResponses int `json:"stale_responses"`
+	}
+	json.Unmarshal(srv.do("GET", "/metrics/summary", "").Body.Bytes(), &summary)
+	if summary.StaleResponses != 3 {
+		t.Errorf("Expected 3 stale responses, got %d", summary.StaleResponses)
+	}
+
+	store.down.Store(false)
+	store.slow.Store(true)
+	if w := srv.do("GET", "/albums/"+id, ""); w.Code != 200 || w.Header().Get("Warning") != staleWarning {
+		t.Errorf("Expected a slow read to be answered from the cache, got %d with Warning %q", w.Code, w.Header().Get("Warning"))
+	}
+
+	srv.staleReads.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if w := srv.do("GET", "/albums", ""); w.Code != 500 {
+		t.Errorf("Expected 500 once the cached albums are too old, got %d", w.Code)
+	}
+}
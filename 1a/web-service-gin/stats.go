@@ -0,0 +1,32 @@
+package main
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// albumStats summarizes the catalog: the number of albums, their average, lowest, and highest
+// price (all 0 when there are none), and the number of albums by each artist.
+type albumStats struct {
+	Count    int            `json:"count"`
+	AvgPrice float64        `json:"avg_price"`
+	MinPrice float64        `json:"min_price"`
+	MaxPrice float64        `json:"max_price"`
+	ByArtist map[string]int `json:"by_artist"`
+}
+
+// getAlbumStats handles GET /albums/stats requests.
+// Returns the number of albums, archived ones included, their average (rounded to cents), lowest,
+// and highest price, and the album count of each artist as JSON with HTTP 200 status. SQL stores
+// compute them with aggregate queries; other stores from their albums.
+func (srv *Server) getAlbumStats(c *gin.Context) {
+	stats, err := catalogStats(c.Request.Context(), srv.store)
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	stats.AvgPrice = math.Round(stats.AvgPrice*100) / 100
+	c.IndentedJSON(http.StatusOK, stats)
+}
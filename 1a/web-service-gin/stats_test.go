@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestGetAlbumStats tests GET /albums/stats against the seed albums and an empty store.
+// Verifies the count, the average price rounded to cents, the price range, and the counts by artist.
+func TestGetAlbumStats(t *testing.T) {
+	get := func(srv *Server) albumStats {
+		w := srv.do("GET", "/albums/stats", "")
+		if w.Code != 200 {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var stats albumStats
+		json.Unmarshal(w.Body.Bytes(), &stats)
+		return stats
+	}
+
+	stats := get(newTestServer(t))
+	if stats.Count != 3 || stats.AvgPrice != 38.32 || stats.MinPrice != 17.99 || stats.MaxPrice != 56.99 {
+		t.Errorf("Expected 3 albums averaging 38.32 from 17.99 to 56.99, got %+v", stats)
+	}
+	if len(stats.ByArtist) != 3 || stats.ByArtist["John Coltrane"] != 1 {
+		t.Errorf("Expected one album by each of 3 artists, got %v", stats.ByArtist)
+	}
+
+	stats = get(newTestServerWith(t, newMemoryStore(nil)))
+	if stats.Count != 0 || stats.AvgPrice != 0 || stats.ByArtist == nil {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+}
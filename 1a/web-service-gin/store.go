@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	// errAlbumNotFound is returned by an AlbumStore when no album has the requested ID or UPC.
+	errAlbumNotFound = errors.New("album not found")
+	// errUPCConflict is returned by an AlbumStore when a create or update would give two albums the same UPC.
+	errUPCConflict = errors.New("an album with this UPC already exists")
+)
+
+// duplicateAlbumError is returned by createUnique and updateUnique when an album with the same
+// title and artist already exists. ID is that album's ID.
+type duplicateAlbumError struct {
+	ID string
+}
+
+func (e duplicateAlbumError) Error() string {
+	return "an album with this title and artist already exists: " + e.ID
+}
+
+// AlbumStore persists albums. Implementations must be safe for concurrent use.
+type AlbumStore interface {
+	// List returns every album.
+	List(ctx context.Context) ([]Album, error)
+	// Get returns the album with the given ID, or errAlbumNotFound.
+	Get(ctx context.Context, id string) (Album, error)
+	// Create stores a new album. The caller assigns its ID.
+	// Returns errUPCConflict if another album already has its UPC.
+	Create(ctx context.Context, a Album) (Album, error)
+	// Update applies mutate to the album with the given ID and stores the result atomically.
+	// If mutate returns an error, nothing is stored and that error is returned. Backends that
+	// retry on concurrent writes may call mutate more than once, each time on a fresh copy.
+	// Returns errAlbumNotFound if the album does not exist, or errUPCConflict if the
+	// updated UPC belongs to another album.
+	Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error)
+	// Delete removes the album with the given ID and returns it, or errAlbumNotFound.
+	Delete(ctx context.Context, id string) (Album, error)
+}
+
+// upcFinder is implemented by stores that can look albums up by barcode without a full scan.
+type upcFinder interface {
+	// GetByUPC returns the album whose normalized UPC matches code, or errAlbumNotFound.
+	GetByUPC(ctx context.Context, code string) (Album, error)
+}
+
+// albumFilter selects albums by artist and price. The zero value selects every album.
+type albumFilter struct {
+	// Artist keeps albums whose artist contains it, ignoring case.
+	Artist string
+	// MinPrice and MaxPrice, if set, are inclusive bounds on the price.
+	MinPrice, MaxPrice *float64
+}
+
+// isZero reports whether f selects every album.
+func (f albumFilter) isZero() bool {
+	return f.Artist == "" && f.MinPrice == nil && f.MaxPrice == nil
+}
+
+// matches reports whether f selects a.
+func (f albumFilter) matches(a Album) bool {
+	if f.Artist != "" && !strings.Contains(strings.ToLower(a.Artist), strings.ToLower(f.Artist)) {
+		return false
+	}
+	if f.MinPrice != nil && a.Price < *f.MinPrice {
+		return false
+	}
+	return f.MaxPrice == nil || a.Price <= *f.MaxPrice
+}
+
+// albumQuerier is implemented by stores that can filter albums in the backend instead of
+// returning every album to be filtered here.
+type albumQuerier interface {
+	// Query returns the albums selected by f, in the same order as List.
+	Query(ctx context.Context, f albumFilter) ([]Album, error)
+}
+
+// albumStreamer is implemented by stores that can hand out albums one at a time instead of
+// loading the whole collection at once.
+type albumStreamer interface {
+	// Each calls fn with every album, in the same order as List, and stops at the first error fn
+	// returns, which Each then returns.
+	Each(ctx context.Context, fn func(Album) error) error
+}
+
+// storageBackends creates album stores by the name given in the STORAGE setting.
+var storageBackends = map[string]func(cfg Config) (AlbumStore, error){
+	"memory":   newMemoryBackend,
+	"postgres": newPostgresStore,
+	"dynamodb": newDynamoStore,
+	"redis":    newRedisStore,
+	"mongodb":  newMongoStore,
+	"sqlite":   newSQLiteStore,
+}
+
+// newMemoryBackend creates the memory store, loading it from cfg.WALPath or cfg.SnapshotPath if
+// the write-ahead log or snapshots are enabled. With cfg.SnapshotURL set, it is loaded from the
+// remote snapshot instead when there is no snapshot at cfg.SnapshotPath.
+func newMemoryBackend(cfg Config) (AlbumStore, error) {
+	if cfg.WALPath != "" && cfg.SnapshotPath != "" {
+		return nil, errors.New("WAL_PATH and SNAPSHOT_PATH cannot be used together")
+	}
+	if cfg.WALPath != "" && cfg.SnapshotURL != "" {
+		return nil, errors.New("WAL_PATH and SNAPSHOT_URL cannot be used together")
+	}
+	if cfg.WALPath != "" {
+		return openWALStore(cfg)
+	}
+	if cfg.SnapshotPath != "" {
+		if _, err := os.Stat(cfg.SnapshotPath); err == nil || cfg.SnapshotURL == "" {
+			return openSnapshotStore(cfg.SnapshotPath)
+		}
+	}
+	if cfg.SnapshotURL != "" {
+		return openRemoteSnapshotStore(cfg)
+	}
+	return newMemoryStore(seedAlbums()), nil
+}
+
+// newAlbumStore creates the store selected by cfg.Storage.
+func newAlbumStore(cfg Config) (AlbumStore, error) {
+	factory, ok := storageBackends[cfg.Storage]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage)
+	}
+	return factory(cfg)
+}
+
+// findAlbumByUPC returns the album with the given barcode, using the store's index if it has one.
+// Returns errAlbumNotFound if no album has it.
+func findAlbumByUPC(ctx context.Context, s AlbumStore, code string) (Album, error) {
+	if finder, ok := s.(upcFinder); ok {
+		return finder.GetByUPC(ctx, code)
+	}
+	all, err := s.List(ctx)
+	if err != nil {
+		return Album{}, err
+	}
+	want := normalizeUPC(code)
+	for _, a := range all {
+		if a.UPC != "" && normalizeUPC(a.UPC) == want {
+			return a, nil
+		}
+	}
+	return Album{}, errAlbumNotFound
+}
+
+// listAlbums returns the albums selected by f, using the store's query support if it has one.
+func listAlbums(ctx context.Context, s AlbumStore, f albumFilter) ([]Album, error) {
+	if querier, ok := s.(albumQuerier); ok && !f.isZero() {
+		return querier.Query(ctx, f)
+	}
+	all, err := s.List(ctx)
+	if err != nil || f.isZero() {
+		return all, err
+	}
+	return filterAlbums(all, f.matches), nil
+}
+
+// uniqueCreator is implemented by stores that can check for a duplicate album and create a new one
+// atomically, so that concurrent creates of the same album cannot both succeed.
+type uniqueCreator interface {
+	// CreateUnique stores a new album like Create, unless an album with the same title and artist
+	// (see albumNameKey) exists, in which case it returns a duplicateAlbumError.
+	CreateUnique(ctx context.Context, a Album) (Album, error)
+}
+
+// albumNameKey identifies an album for duplicate detection: its title and artist, ignoring case.
+func albumNameKey(title, artist string) string {
+	return strings.ToLower(title) + "\x00" + strings.ToLower(artist)
+}
+
+// createUnique stores a in s unless an album with the same title and artist exists, returning a
+// duplicateAlbumError then. Every backend, and every store wrapping one, implements uniqueCreator
+// to make the check atomic with the create; other stores, such as test doubles, are checked by
+// reading every album first.
+func createUnique(ctx context.Context, s AlbumStore, a Album) (Album, error) {
+	if creator, ok := s.(uniqueCreator); ok {
+		return creator.CreateUnique(ctx, a)
+	}
+	if err := checkDuplicate(ctx, s, a); err != nil {
+		return Album{}, err
+	}
+	return s.Create(ctx, a)
+}
+
+// checkDuplicate returns a duplicateAlbumError if an album other than a has a's title and artist,
+// reading every album in s.
+func checkDuplicate(ctx context.Context, s AlbumStore, a Album) error {
+	key := albumNameKey(a.Title, a.Artist)
+	var duplicate error
+	err := eachAlbum(ctx, s, func(other Album) error {
+		if other.ID != a.ID && albumNameKey(other.Title, other.Artist) == key {
+			duplicate = duplicateAlbumError{ID: other.ID}
+			return duplicate
+		}
+		return nil
+	})
+	if duplicate != nil {
+		return duplicate
+	}
+	return err
+}
+
+// uniqueUpdater is implemented by stores that can check an updated album for a duplicate and store
+// it atomically, so that concurrent updates cannot give two albums the same title and artist.
+type uniqueUpdater interface {
+	// UpdateUnique applies mutate to the album with the given ID like Update, unless mutate
+	// changes its title or artist (see albumNameKey) to those of another album, in which case it
+	// returns a duplicateAlbumError and stores nothing.
+	UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error)
+}
+
+// updateUnique applies mutate to the album with the given ID in s, returning a duplicateAlbumError
+// instead if mutate changes its title or artist to those of another album. Like createUnique, it
+// relies on the store's uniqueUpdater to make the check atomic, and otherwise reads every album in
+// s before the album is written.
+func updateUnique(ctx context.Context, s AlbumStore, id string, mutate func(*Album) error) (Album, error) {
+	if updater, ok := s.(uniqueUpdater); ok {
+		return updater.UpdateUnique(ctx, id, mutate)
+	}
+	return s.Update(ctx, id, func(a *Album) error {
+		key := albumNameKey(a.Title, a.Artist)
+		if err := mutate(a); err != nil {
+			return err
+		}
+		if albumNameKey(a.Title, a.Artist) == key {
+			return nil
+		}
+		return checkDuplicate(ctx, s, *a)
+	})
+}
+
+// bulkChanger is implemented by stores that can change or remove every album selected by a filter
+// in one atomic operation, so that readers see either all of the albums changed or none of them.
+type bulkChanger interface {
+	// UpdateWhere applies mutate to every album selected by f, in the same order as List, and
+	// stores the albums it changed. mutate reports whether it changed the album, and may change
+	// any field except the ID, title, artist, and UPC. Returns the changed albums.
+	UpdateWhere(ctx context.Context, f albumFilter, mutate func(*Album) bool) ([]Album, error)
+	// DeleteWhere removes every album selected by f and returns them.
+	DeleteWhere(ctx context.Context, f albumFilter) ([]Album, error)
+}
+
+// errSkipAlbum is returned from an Update mutation by updateWhere to leave an album unchanged.
+var errSkipAlbum = errors.New("album left unchanged")
+
+// updateWhere applies mutate to every album in s selected by f, as bulkChanger.UpdateWhere does,
+// and returns the changed albums. The albums change atomically on stores that implement
+// bulkChanger; on others they are updated one at a time, and a failure leaves the earlier ones
+// changed.
+func updateWhere(ctx context.Context, s AlbumStore, f albumFilter, mutate func(*Album) bool) ([]Album, error) {
+	if changer, ok := s.(bulkChanger); ok {
+		return changer.UpdateWhere(ctx, f, mutate)
+	}
+	matching, err := listAlbums(ctx, s, f)
+	if err != nil {
+		return nil, err
+	}
+	changed := []Album{}
+	for _, a := range matching {
+		updated, err := s.Update(ctx, a.ID, func(a *Album) error {
+			if !f.matches(*a) || !mutate(a) {
+				return errSkipAlbum
+			}
+			return nil
+		})
+		switch {
+		case errors.Is(err, errSkipAlbum), errors.Is(err, errAlbumNotFound):
+			continue
+		case err != nil:
+			return changed, err
+		}
+		changed = append(changed, updated)
+	}
+	return changed, nil
+}
+
+// deleteWhere removes every album in s selected by f and returns them. The albums are removed
+// atomically on stores that implement bulkChanger; on others they are removed one at a time, and a
+// failure leaves the earlier ones removed.
+func deleteWhere(ctx context.Context, s AlbumStore, f albumFilter) ([]Album, error) {
+	if changer, ok := s.(bulkChanger); ok {
+		return changer.DeleteWhere(ctx, f)
+	}
+	matching, err := listAlbums(ctx, s, f)
+	if err != nil {
+		return nil, err
+	}
+	deleted := []Album{}
+	for _, a := range matching {
+		removed, err := s.Delete(ctx, a.ID)
+		switch {
+		case errors.Is(err, errAlbumNotFound):
+			continue
+		case err != nil:
+			return deleted, err
+		}
+		deleted = append(deleted, removed)
+	}
+	return deleted, nil
+}
+
+// albumStatser is implemented by stores that can compute catalog statistics in the backend, e.g.
+// with aggregate queries, instead of returning every album to be counted here.
+type albumStatser interface {
+	// Stats returns the statistics of every album that is not deleted (see softDeleteStore).
+	Stats(ctx context.Context) (albumStats, error)
+}
+
+// catalogStats returns the statistics of every album in s that is not deleted, computed by the
+// store if it supports that and otherwise from its albums one at a time.
+func catalogStats(ctx context.Context, s AlbumStore) (albumStats, error) {
+	if statser, ok := s.(albumStatser); ok {
+		return statser.Stats(ctx)
+	}
+	stats := albumStats{ByArtist: map[string]int{}}
+	total := 0.0
+	err := eachAlbum(ctx, s, func(a Album) error {
+		if !a.DeletedAt.IsZero() {
+			return nil
+		}
+		if stats.Count == 0 || a.Price < stats.MinPrice {
+			stats.MinPrice = a.Price
+		}
+		stats.MaxPrice = max(stats.MaxPrice, a.Price)
+		stats.Count++
+		total += a.Price
+		stats.ByArtist[a.Artist]++
+		return nil
+	})
+	if err != nil {
+		return albumStats{}, err
+	}
+	if stats.Count > 0 {
+		stats.AvgPrice = total / float64(stats.Count)
+	}
+	return stats, nil
+}
+
+// eachAlbum calls fn with every album in s, streaming them from the store if it supports that.
+// Stops at the first error fn returns and returns it.
+func eachAlbum(ctx context.Context, s AlbumStore, fn func(Album) error) error {
+	if streamer, ok := s.(albumStreamer); ok {
+		return streamer.Each(ctx, fn)
+	}
+	all, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, a := range all {
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
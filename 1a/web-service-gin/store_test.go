@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMemoryStore tests the memory AlbumStore implementation.
+func TestMemoryStore(t *testing.T) {
+	s := newMemoryStore(nil)
+	testAlbumStore(t, s)
+	testUniqueAlbumNames(t, s)
+	testArtistStore(t, newMemoryStore(nil))
+}
+
+// TestMemoryStoreListOrder tests that List returns albums in insertion order after deletes and updates.
+func TestMemoryStoreListOrder(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryStore(nil)
+	for _, id := range []string{"c", "a", "d", "b"} {
+		s.Create(ctx, Album{ID: id, Title: "Album " + id, Artist: "Artist", Price: 1})
+	}
+	s.Delete(ctx, "d")
+	s.Update(ctx, "c", func(a *Album) error { a.Price = 2; return nil })
+
+	all, _ := s.List(ctx)
+	var ids []string
+	for _, a := range all {
+		ids = append(ids, a.ID)
+	}
+	if got := strings.Join(ids, ","); got != "c,a,b" {
+		t.Errorf("Expected c,a,b, got %s", got)
+	}
+}
+
+// TestMemoryStoreListingSnapshot tests listings served from the copy-on-write snapshot.
+// Verifies that callers cannot change the snapshot through a returned listing, that every change
+// is visible to the next listing, and that listings taken during a stream of creates each see a
+// consistent prefix of them. Run with -race to check for data races.
+func TestMemoryStoreListingSnapshot(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryStore(nil)
+	s.Create(ctx, Album{ID: "0", Title: "First", Artist: "Artist", Price: 1})
+
+	all, _ := s.List(ctx)
+	all[0].Title = "Changed by caller"
+	if all, _ := s.List(ctx); all[0].Title != "First" {
+		t.Errorf("Expected the snapshot to be unaffected by callers, got %q", all[0].Title)
+	}
+	s.Update(ctx, "0", func(a *Album) error { a.Title = "Updated"; return nil })
+	if all, _ := s.List(ctx); all[0].Title != "Updated" {
+		t.Errorf("Expected the update in the next listing, got %q", all[0].Title)
+	}
+
+	const creates = 200
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= creates; i++ {
+			s.Create(ctx, Album{ID: fmt.Sprint(i), Title: "Album", Artist: "Artist", Price: 1})
+		}
+	}()
+	for listed := 0; listed <= creates; {
+		all, _ := s.List(ctx)
+		for i, a := range all {
+			if a.ID != fmt.Sprint(i) {
+				t.Fatalf("Expected a prefix of the creates, got %s at %d", a.ID, i)
+			}
+		}
+		if len(all) < listed {
+			t.Fatalf("Listing shrank from %d to %d albums", listed, len(all))
+		}
+		listed = len(all)
+	}
+	<-done
+}
+
+// TestMemoryStoreConcurrentRequests tests the memory store under parallel creates, updates,
+// deletes, and reads through the HTTP handlers. Run with -race to check for data races.
+// Verifies that every created album that was not deleted is present afterwards.
+func TestMemoryStoreConcurrentRequests(t *testing.T) {
+	srv := newTestServer(t)
+
+	const workers, perWorker = 8, 25
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWorker {
+				resp := srv.do("POST", "/albums", fmt.Sprintf(`{"title": "Album %d-%d", "artist": "Worker %d", "price": 9.99}`, w, i, w))
+				if resp.Code != http.StatusCreated {
+					t.Errorf("Expected 201, got %d", resp.Code)
+					return
+				}
+				var created Album
+				json.Unmarshal(resp.Body.Bytes(), &created)
+				srv.do("PATCH", "/albums/"+created.ID, `{"price": 19.99}`, "If-Match", "*")
+				srv.do("GET", "/albums", "")
+				if i%5 == 0 {
+					srv.do("DELETE", "/albums/"+created.ID, "", "If-Match", "*")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	all, _ := srv.store.List(context.Background())
+	if want := 3 + workers*perWorker*4/5; len(all) != want {
+		t.Errorf("Expected %d albums, got %d", want, len(all))
+	}
+}
+
+// testAlbumStore checks the AlbumStore contract against an empty store s.
+// Verifies create, get, update, delete, UPC lookup in both barcode forms, UPC conflicts,
+// filtering by artist and price, catalog statistics, duplicate detection by title and artist on create and update, and that a failed mutation leaves the album unchanged.
+func testAlbumStore(t *testing.T, s AlbumStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := s.Create(ctx, Album{ID: "a", Title: "Kind of Blue", Artist: "Miles Davis", Price: 49.99, UPC: "074646593622"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(ctx, Album{ID: "b", Title: "Duplicate", Artist: "Someone", Price: 9.99, UPC: "0074646593622"}); !errors.Is(err, errUPCConflict) {
+		t.Errorf("Expected errUPCConflict, got %v", err)
+	}
+	if _, err := s.Create(ctx, Album{ID: "b", Title: "Jeru", Artist: "Gerry Mulligan", Price: 17.99}); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := findAlbumByUPC(ctx, s, "0074646593622"); err != nil || a.ID != "a" {
+		t.Errorf("Expected album a by EAN-13, got %+v, %v", a, err)
+	}
+
+	_, err := s.Update(ctx, "a", func(a *Album) error {
+		a.Title = "Changed"
+		return validationError("invalid")
+	})
+	if err == nil {
+		t.Error("Expected the mutation error to be returned")
+	}
+	if a, _ := s.Get(ctx, "a"); a.Title != "Kind of Blue" {
+		t.Errorf("Expected a failed update to leave the title unchanged, got '%s'", a.Title)
+	}
+
+	if _, err := s.Update(ctx, "b", func(a *Album) error { a.UPC = "074646593622"; return nil }); !errors.Is(err, errUPCConflict) {
+		t.Errorf("Expected errUPCConflict, got %v", err)
+	}
+	updated, err := s.Update(ctx, "a", func(a *Album) error { a.UPC = "4006381333931"; return nil })
+	if err != nil || updated.UPC != "4006381333931" {
+		t.Fatalf("Expected UPC update to succeed, got %+v, %v", updated, err)
+	}
+	if _, err := findAlbumByUPC(ctx, s, "074646593622"); !errors.Is(err, errAlbumNotFound) {
+		t.Errorf("Expected the old UPC to be unindexed, got %v", err)
+	}
+
+	lo, hi := 17.99, 20.0
+	for _, tc := range []struct {
+		filter albumFilter
+		want   string
+	}{
+		{albumFilter{Artist: "miles"}, "a"},
+		{albumFilter{Artist: "%"}, ""},
+		{albumFilter{MinPrice: &lo}, "a,b"},
+		{albumFilter{MaxPrice: &hi}, "b"},
+		{albumFilter{Artist: "Davis", MaxPrice: &hi}, ""},
+	} {
+		all, err := listAlbums(ctx, s, tc.filter)
+		var ids []string
+		for _, a := range all {
+			ids = append(ids, a.ID)
+		}
+		if got := strings.Join(ids, ","); err != nil || got != tc.want {
+			t.Errorf("Expected albums %q for %+v, got %q, %v", tc.want, tc.filter, got, err)
+		}
+	}
+
+	var streamed []string
+	stop := errors.New("stop")
+	err = eachAlbum(ctx, s, func(a Album) error {
+		streamed = append(streamed, a.ID)
+		return stop
+	})
+	if !errors.Is(err, stop) || strings.Join(streamed, ",") != "a" {
+		t.Errorf("Expected streaming to stop after album a with fn's error, got %v, %v", streamed, err)
+	}
+
+	stats, err := catalogStats(ctx, s)
+	if err != nil || stats.Count != 2 || stats.MinPrice != 17.99 || stats.MaxPrice != 49.99 ||
+		math.Abs(stats.AvgPrice-33.99) > 1e-9 || stats.ByArtist["Miles Davis"] != 1 || stats.ByArtist["Gerry Mulligan"] != 1 {
+		t.Errorf("Expected stats of albums a and b, got %+v, %v", stats, err)
+	}
+	markDeleted := func(deleted bool) {
+		t.Helper()
+		if _, err := s.Update(ctx, "b", func(a *Album) error {
+			a.DeletedAt = time.Time{}
+			if deleted {
+				a.DeletedAt = time.Now().UTC()
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	markDeleted(true)
+	if stats, err := catalogStats(ctx, s); err != nil || stats.Count != 1 || stats.ByArtist["Gerry Mulligan"] != 0 {
+		t.Errorf("Expected stats without the soft-deleted album b, got %+v, %v", stats, err)
+	}
+	markDeleted(false)
+
+	var duplicate duplicateAlbumError
+	if _, err := createUnique(ctx, s, Album{ID: "c", Title: "JERU", Artist: "gerry mulligan", Price: 1}); !errors.As(err, &duplicate) || duplicate.ID != "b" {
+		t.Errorf("Expected a duplicate of album b, got %v", err)
+	}
+	if _, err := s.Get(ctx, "c"); !errors.Is(err, errAlbumNotFound) {
+		t.Errorf("Expected the duplicate not to be created, got %v", err)
+	}
+	if _, err := updateUnique(ctx, s, "a", func(a *Album) error {
+		a.Title, a.Artist = "jeru", "GERRY MULLIGAN"
+		return nil
+	}); !errors.As(err, &duplicate) || duplicate.ID != "b" {
+		t.Errorf("Expected an update to a duplicate of album b to fail, got %v", err)
+	}
+	if a, err := s.Get(ctx, "a"); err != nil || a.Title != "Kind of Blue" {
+		t.Errorf("Expected the failed update to leave album a unchanged, got %+v, %v", a, err)
+	}
+	if b, err := updateUnique(ctx, s, "b", func(a *Album) error {
+		a.Title = "JERU"
+		return nil
+	}); err != nil || b.Title != "JERU" {
+		t.Errorf("Expected album b to be retitled to its own title, got %+v, %v", b, err)
+	}
+
+	if _, err := s.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createUnique(ctx, s, Album{ID: "c", Title: "Kind of Blue", Artist: "Miles Davis", Price: 1}); err != nil {
+		t.Errorf("Expected the deleted album's title and artist to be free, got %v", err)
+	}
+	if _, err := s.Delete(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "a"); !errors.Is(err, errAlbumNotFound) {
+		t.Errorf("Expected errAlbumNotFound after delete, got %v", err)
+	}
+	if all, _ := s.List(ctx); len(all) != 1 {
+		t.Errorf("Expected 1 album, got %d", len(all))
+	}
+
+	if _, err := s.Create(ctx, Album{ID: "d", Title: "Mingus Ah Um", Artist: "Charles Mingus", Price: 29.99}); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := updateWhere(ctx, s, albumFilter{Artist: "mingus"}, func(a *Album) bool {
+		a.Price = 19.99
+		return true
+	})
+	if err != nil || len(changed) != 1 || changed[0].ID != "d" {
+		t.Errorf("Expected album d to be changed, got %+v, %v", changed, err)
+	}
+	if a, _ := s.Get(ctx, "d"); a.Price != 19.99 {
+		t.Errorf("Expected the bulk update to be stored, got price %v", a.Price)
+	}
+	deleted, err := deleteWhere(ctx, s, albumFilter{MaxPrice: &hi})
+	if err != nil || len(deleted) != 2 {
+		t.Errorf("Expected albums b and d to be deleted, got %+v, %v", deleted, err)
+	}
+	if all, _ := s.List(ctx); len(all) != 0 {
+		t.Errorf("Expected no albums after the bulk delete, got %d", len(all))
+	}
+}
+
+// testUniqueAlbumNames checks duplicate detection by title and artist against an empty store s,
+// and leaves it empty. Verifies that an allowed duplicate keeps its title and artist taken after
+// the album it duplicates is deleted, that renaming an album frees its old title and artist, and
+// that of concurrent creates or renames to the same title and artist only one succeeds.
+func testUniqueAlbumNames(t *testing.T, s AlbumStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, id := range []string{"first", "copy"} {
+		if _, err := s.Create(ctx, Album{ID: id, Title: "Blue Train", Artist: "John Coltrane", Price: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Delete(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	var duplicate duplicateAlbumError
+	if _, err := createUnique(ctx, s, Album{ID: "new", Title: "BLUE TRAIN", Artist: "john coltrane", Price: 1}); !errors.As(err, &duplicate) || duplicate.ID != "copy" {
+		t.Errorf("Expected a duplicate of the remaining copy, got %v", err)
+	}
+	if _, err := updateUnique(ctx, s, "copy", func(a *Album) error {
+		a.Title = "Giant Steps"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createUnique(ctx, s, Album{ID: "new", Title: "Blue Train", Artist: "John Coltrane", Price: 1}); err != nil {
+		t.Errorf("Expected the renamed album's old title and artist to be free, got %v", err)
+	}
+
+	const racers = 8
+	var created, renamed atomic.Int32
+	var wg sync.WaitGroup
+	for i := range racers {
+		wg.Go(func() {
+			_, err := createUnique(ctx, s, Album{ID: fmt.Sprintf("race-%d", i), Title: "Ascension", Artist: "John Coltrane", Price: 1})
+			if err == nil {
+				created.Add(1)
+			} else if !errors.As(err, new(duplicateAlbumError)) {
+				t.Errorf("Expected a duplicateAlbumError, got %v", err)
+			}
+		})
+	}
+	wg.Wait()
+	for i := range racers {
+		if _, err := s.Create(ctx, Album{ID: fmt.Sprintf("rename-%d", i), Title: fmt.Sprintf("Take %d", i), Artist: "Miles Davis", Price: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range racers {
+		wg.Go(func() {
+			_, err := updateUnique(ctx, s, fmt.Sprintf("rename-%d", i), func(a *Album) error {
+				a.Title = "So What"
+				return nil
+			})
+			if err == nil {
+				renamed.Add(1)
+			} else if !errors.As(err, new(duplicateAlbumError)) {
+				t.Errorf("Expected a duplicateAlbumError, got %v", err)
+			}
+		})
+	}
+	wg.Wait()
+	if created.Load() != 1 || renamed.Load() != 1 {
+		t.Errorf("Expected exactly one concurrent create and one rename to succeed, got %d and %d", created.Load(), renamed.Load())
+	}
+
+	all, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range all {
+		if _, err := s.Delete(ctx, a.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testArtistStore checks the artistStore contract against s, which must implement it.
+// Verifies that artist names are unique ignoring case, lookups by ID and by name, that renaming an
+// artist renames the albums credited to it, by artist_id or by name, deleted ones included, and no
+// others, and that an artist with albums cannot be deleted.
+func testArtistStore(t *testing.T, s AlbumStore) {
+	t.Helper()
+	ctx := context.Background()
+	artists, ok := s.(artistStore)
+	if !ok {
+		t.Fatalf("Expected %T to store artists", s)
+	}
+
+	ornette := Artist{ID: artistIDFor("Ornette Coleman"), Name: "Ornette Coleman"}
+	dolphy := Artist{ID: "dolphy", Name: "Eric Dolphy"}
+	for _, artist := range []Artist{ornette, dolphy} {
+		if err := artists.CreateArtist(ctx, artist); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var exists artistExistsError
+	if err := artists.CreateArtist(ctx, Artist{ID: "other", Name: " ORNETTE COLEMAN"}); !errors.As(err, &exists) || exists.ID != ornette.ID {
+		t.Errorf("Expected a taken name to be rejected with its artist's ID, got %v", err)
+	}
+	if err := artists.CreateArtist(ctx, Artist{ID: ornette.ID, Name: "Someone Else"}); !errors.As(err, &exists) || exists.ID != ornette.ID {
+		t.Errorf("Expected a taken ID to be rejected, got %v", err)
+	}
+	if artist, err := artists.ArtistNamed(ctx, "ornette coleman"); err != nil || artist.ID != ornette.ID {
+		t.Errorf("Expected the artist by name ignoring case, got %+v, %v", artist, err)
+	}
+	if _, err := artists.GetArtist(ctx, "missing"); !errors.Is(err, errArtistNotFound) {
+		t.Errorf("Expected errArtistNotFound, got %v", err)
+	}
+
+	for _, a := range []Album{
+		{ID: "free-jazz", Title: "Free Jazz", Artist: "Ornette Coleman", ArtistID: ornette.ID, Price: 9.99},
+		// Credited by name, as albums stored before artists existed are.
+		{ID: "shape", Title: "The Shape of Jazz to Come", Artist: "Ornette Coleman", Price: 9.99, DeletedAt: time.Now().UTC()},
+		{ID: "out-to-lunch", Title: "Out to Lunch!", Artist: "Eric Dolphy", ArtistID: dolphy.ID, Price: 9.99},
+	} {
+		if _, err := s.Create(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rename := func(name string) func(*Album) {
+		return func(a *Album) { a.ArtistID, a.Artist = ornette.ID, name }
+	}
+	if _, _, err := artists.RenameArtist(ctx, ornette.ID, "eric dolphy", rename("eric dolphy")); !errors.As(err, &exists) || exists.ID != dolphy.ID {
+		t.Errorf("Expected a rename to a taken name to be rejected, got %v", err)
+	}
+	if _, _, err := artists.RenameArtist(ctx, "missing", "Anyone", rename("Anyone")); !errors.Is(err, errArtistNotFound) {
+		t.Errorf("Expected errArtistNotFound, got %v", err)
+	}
+	renamed, changes, err := artists.RenameArtist(ctx, ornette.ID, "Randolph Denard Ornette Coleman", rename("Randolph Denard Ornette Coleman"))
+	var ids []string
+	for _, change := range changes {
+		if change.Previous.Artist != "Ornette Coleman" {
+			t.Errorf("Expected the album as it was before the rename, got %+v", change.Previous)
+		}
+		ids = append(ids, change.ID)
+	}
+	slices.Sort(ids)
+	if err != nil || renamed.Name != "Randolph Denard Ornette Coleman" || strings.Join(ids, ",") != "free-jazz,shape" {
+		t.Errorf("Expected the artist and both its albums to be renamed, got %+v, %v, %v", renamed, ids, err)
+	}
+	for _, id := range []string{"free-jazz", "shape"} {
+		if a, _ := s.Get(ctx, id); a.Artist != "Randolph Denard Ornette Coleman" || a.ArtistID != ornette.ID {
+			t.Errorf("Expected album %s to be renamed, got %+v", id, a)
+		}
+	}
+	if a, _ := s.Get(ctx, "out-to-lunch"); a.Artist != "Eric Dolphy" {
+		t.Errorf("Expected another artist's album to be left alone, got %+v", a)
+	}
+	if _, err := artists.ArtistNamed(ctx, "Ornette Coleman"); !errors.Is(err, errArtistNotFound) {
+		t.Errorf("Expected the old name to be free, got %v", err)
+	}
+
+	if _, err := artists.DeleteArtist(ctx, ornette.ID); !errors.Is(err, errArtistHasAlbums) {
+		t.Errorf("Expected errArtistHasAlbums, got %v", err)
+	}
+	for _, id := range []string{"free-jazz", "shape"} {
+		if _, err := s.Delete(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if deleted, err := artists.DeleteArtist(ctx, ornette.ID); err != nil || deleted.ID != ornette.ID {
+		t.Errorf("Expected the artist without albums to be deleted, got %+v, %v", deleted, err)
+	}
+	if all, err := artists.ListArtists(ctx); err != nil || len(all) != 1 || all[0] != dolphy {
+		t.Errorf("Expected only %+v to remain, got %+v, %v", dolphy, all, err)
+	}
+}
+
+// TestNewAlbumStore tests selecting a storage backend by name.
+// Verifies that the memory backend is available and unknown backends are rejected.
+func TestNewAlbumStore(t *testing.T) {
+	if _, err := newAlbumStore(Config{Storage: "memory"}); err != nil {
+		t.Errorf("Expected memory store, got %v", err)
+	}
+	if _, err := newAlbumStore(Config{Storage: "floppy"}); err == nil {
+		t.Error("Expected an error for an unknown backend")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Event streams clients can be connected to, as listed by GET /admin/subscribers.
+const (
+	streamChanges     = "changes"
+	streamSavedSearch = "saved-search"
+)
+
+// streamClient is a client connected to an event stream (GET /albums/changes or
+// /saved-searches/:id/events).
+type streamClient struct {
+	id          string
+	stream      string
+	path        string
+	tenant      string
+	remoteAddr  string
+	connectedAt time.Time
+
+	// lastActive is when the client was last sent an event or heartbeat, in Unix nanoseconds.
+	lastActive atomic.Int64
+	sent       atomic.Int64
+	heartbeats atomic.Int64
+	resyncs    atomic.Int64
+	// position is the number of the last change feed event the client was sent.
+	position atomic.Int64
+}
+
+// streamClientStatus is a streamClient as listed by GET /admin/subscribers. Lag, the number of
+// change feed events the client has yet to be sent, is only set for the change feed.
+type streamClientStatus struct {
+	ID           string    `json:"id"`
+	Stream       string    `json:"stream"`
+	Path         string    `json:"path"`
+	Tenant       string    `json:"tenant,omitempty"`
+	RemoteAddr   string    `json:"remote_addr"`
+	ConnectedAt  time.Time `json:"connected_at"`
+	LastActiveAt time.Time `json:"last_active_at"`
+	EventsSent   int64     `json:"events_sent"`
+	Heartbeats   int64     `json:"heartbeats"`
+	Resyncs      int64     `json:"resyncs"`
+	Lag          *int64    `json:"lag,omitempty"`
+}
+
+// subscriberTracker keeps track of the clients connected to the server's event streams, and of
+// the change feed clients told to resync (see changesSince).
+type subscriberTracker struct {
+	mu      sync.Mutex
+	clients map[string]*streamClient
+
+	resyncs atomic.Int64
+}
+
+// newSubscriberTracker creates a tracker with no clients.
+func newSubscriberTracker() *subscriberTracker {
+	return &subscriberTracker{clients: map[string]*streamClient{}}
+}
+
+// connect registers the client of request c to stream. The caller must call disconnect once the
+// stream ends.
+func (t *subscriberTracker) connect(c *gin.Context, stream string) *streamClient {
+	now := time.Now().UTC()
+	sc := &streamClient{
+		id:          uuid.New().String(),
+		stream:      stream,
+		path:        c.Request.URL.Path,
+		tenant:      tenantFrom(c.Request.Context()),
+		remoteAddr:  c.ClientIP(),
+		connectedAt: now,
+	}
+	sc.lastActive.Store(now.UnixNano())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clients[sc.id] = sc
+	return sc
+}
+
+// disconnect unregisters sc.
+func (t *subscriberTracker) disconnect(sc *streamClient) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.clients, sc.id)
+}
+
+// sentEvents records that sc was sent n events.
+func (sc *streamClient) sentEvents(n int) {
+	sc.sent.Add(int64(n))
+	sc.lastActive.Store(time.Now().UnixNano())
+}
+
+// heartbeat writes an SSE comment to w, which clients ignore but which keeps proxies from closing
+// an idle stream and shows the client is still reading, and flushes it.
+func (sc *streamClient) heartbeat(c *gin.Context, w io.Writer) {
+	io.WriteString(w, ": heartbeat\n\n")
+	c.Writer.Flush()
+	sc.heartbeats.Add(1)
+	sc.lastActive.Store(time.Now().UnixNano())
+}
+
+// status returns sc as listed by GET /admin/subscribers; last is the number of the last change
+// feed event recorded.
+func (sc *streamClient) status(last int64) streamClientStatus {
+	st := streamClientStatus{
+		ID:           sc.id,
+		Stream:       sc.stream,
+		Path:         sc.path,
+		Tenant:       sc.tenant,
+		RemoteAddr:   sc.remoteAddr,
+		ConnectedAt:  sc.connectedAt,
+		LastActiveAt: time.Unix(0, sc.lastActive.Load()).UTC(),
+		EventsSent:   sc.sent.Load(),
+		Heartbeats:   sc.heartbeats.Load(),
+		Resyncs:      sc.resyncs.Load(),
+	}
+	if sc.stream == streamChanges {
+		lag := max(last-sc.position.Load(), 0)
+		st.Lag = &lag
+	}
+	return st
+}
+
+// list returns the connected clients, longest connected first.
+func (t *subscriberTracker) list(last int64) []streamClientStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clients := make([]streamClientStatus, 0, len(t.clients))
+	for _, sc := range t.clients {
+		clients = append(clients, sc.status(last))
+	}
+	slices.SortFunc(clients, func(x, y streamClientStatus) int { return x.ConnectedAt.Compare(y.ConnectedAt) })
+	return clients
+}
+
+// heartbeatTicker returns a channel delivering a tick every STREAM_HEARTBEAT_INTERVAL for a
+// stream to send heartbeats on, and a function to stop it. The channel is nil, and never
+// delivers, if heartbeats are disabled.
+func (srv *Server) heartbeatTicker() (<-chan time.Time, func()) {
+	if srv.cfg.StreamHeartbeatInterval <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(srv.cfg.StreamHeartbeatInterval)
+	return ticker.C, ticker.Stop
+}
+
+// getSubscribers handles GET /admin/subscribers requests.
+// Returns the clients connected to the event streams, with when they were last sent an event or
+// heartbeat, how many events they were sent, and, for the change feed, how many events they are
+// behind, together with the number of clients dropped and resynced for falling too far behind
+// since the server started, as JSON with HTTP 200 status.
+func (srv *Server) getSubscribers(c *gin.Context) {
+	var last int64
+	if srv.changes != nil {
+		last = srv.changes.last()
+	}
+	clients := srv.streams.list(last)
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"count":       len(clients),
+		"subscribers": clients,
+		"dropped":     srv.savedSearches.dropped.Load(),
+		"resyncs":     srv.streams.resyncs.Load(),
+	})
+}
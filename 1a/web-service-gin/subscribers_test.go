@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSubscribers tests tracking the clients of the event streams.
+// Verifies that a connected change feed client is listed by GET /admin/subscribers with its lag
+// and is sent heartbeats, and that it is unlisted once it disconnects.
+func TestSubscribers(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.StreamHeartbeatInterval = 10 * time.Millisecond })
+	server := httptest.NewServer(srv.router)
+	defer server.Close()
+	type subscribers struct {
+		Count       int
+		Subscribers []streamClientStatus
+	}
+	list := func() subscribers {
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/subscribers", nil))
+		var resp subscribers
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/albums/changes", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() && lines.Text() != ": heartbeat" {
+	}
+
+	got := list()
+	if got.Count != 1 {
+		t.Fatalf("Expected 1 subscriber, got %+v", got)
+	}
+	if sc := got.Subscribers[0]; sc.Stream != streamChanges || sc.Path != "/albums/changes" || sc.Heartbeats == 0 || sc.Lag == nil || *sc.Lag != 0 {
+		t.Errorf("Expected a change feed client sent heartbeats, got %+v", sc)
+	}
+
+	cancel()
+	for deadline := time.Now().Add(time.Second); list().Count != 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the client to be unlisted after disconnecting")
+		}
+	}
+}
+
+// TestSubscriberLag tests resyncing change feed clients that fall more than STREAM_MAX_LAG events
+// behind, and dropping saved search streams whose buffer fills up.
+func TestSubscriberLag(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.StreamMaxLag = 1 })
+	for _, price := range []string{"1", "2"} {
+		srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440002", `{"price": `+price+`}`, "If-Match", "*")
+	}
+	if w := srv.do("GET", "/albums/changes/poll?since=0", ""); !strings.Contains(w.Body.String(), `"reset": true`) {
+		t.Errorf("Expected a client 2 events behind to be told to resync, got %s", w.Body)
+	}
+	if w := srv.do("GET", "/albums/changes/poll?since=1", ""); strings.Contains(w.Body.String(), "reset") {
+		t.Errorf("Expected a client 1 event behind to catch up, got %s", w.Body)
+	}
+
+	r := srv.savedSearches
+	s := &savedSearch{ID: "s1", Filter: searchFilter{Artist: "Miles Davis"}}
+	r.add(s)
+	ch, _ := r.subscribe(s.ID)
+	for range savedSearchStreamBuffer + 1 {
+		r.handle(albumEvent{Type: eventAlbumCreated, Album: Album{Title: "Kind of Blue", Artist: "Miles Davis"}})
+	}
+	for range savedSearchStreamBuffer {
+		<-ch
+	}
+	if _, open := <-ch; open || r.dropped.Load() != 1 {
+		t.Errorf("Expected the stream to be dropped once its buffer filled, got %d dropped", r.dropped.Load())
+	}
+	if _, ok := r.get(s.ID); !ok {
+		t.Error("Expected the saved search to remain after dropping its stream")
+	}
+	r.unsubscribe(s.ID, ch)
+}
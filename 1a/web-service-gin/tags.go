@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tag limits.
+const (
+	maxTagsPerAlbum = 20
+	maxTagLength    = 50
+)
+
+// tagCount is one row of GET /tags.
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// normalizeTag returns tag trimmed and lowercased, the form in which tags are stored and matched.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// mergeTags returns existing with every tag in add normalized and appended, skipping tags the
+// album already has. Returns an error message if a tag is empty or too long, or if the result
+// would exceed maxTagsPerAlbum.
+func mergeTags(existing, add []string) ([]string, string) {
+	merged := slices.Clone(existing)
+	for _, raw := range add {
+		tag := normalizeTag(raw)
+		if tag == "" {
+			return nil, "Tags must not be empty"
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Sprintf("Tags must be at most %d characters", maxTagLength)
+		}
+		if !slices.Contains(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+	if len(merged) > maxTagsPerAlbum {
+		return nil, fmt.Sprintf("An album can have at most %d tags", maxTagsPerAlbum)
+	}
+	return merged, ""
+}
+
+// parseTagFilter returns a filter matching albums that have every tag given in the repeatable tag
+// query parameter. Returns nil if no tag is given.
+func parseTagFilter(c *gin.Context) func(Album) bool {
+	var want []string
+	for _, raw := range c.QueryArray("tag") {
+		if tag := normalizeTag(raw); tag != "" {
+			want = append(want, tag)
+		}
+	}
+	if len(want) == 0 {
+		return nil
+	}
+	return func(a Album) bool {
+		for _, tag := range want {
+			if !slices.Contains(a.Tags, tag) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// postAlbumTags handles POST /albums/:id/tags requests.
+// Adds the tags in the JSON body ({"tags": [...]}) to the album. Tags are trimmed and lowercased,
+// and tags the album already has are ignored. Returns the updated album as JSON with HTTP 200 status.
+// Returns HTTP 400 if a tag is invalid or the album would have more than 20 tags, or HTTP 404 if
+// the album is not found.
+func (srv *Server) postAlbumTags(c *gin.Context) {
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid JSON",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(body.Tags) == 0 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "tags must list at least one tag"})
+		return
+	}
+
+	var previous Album
+	updated, err := srv.updateAlbum(c.Request.Context(), c.Param("id"), func(a *Album) error {
+		previous = *a
+		tags, errMsg := mergeTags(a.Tags, body.Tags)
+		if errMsg != "" {
+			return validationError(errMsg)
+		}
+		a.Tags = tags
+		return nil
+	})
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	srv.publishAlbumEvent(c.Request.Context(), eventAlbumUpdated, updated, &previous)
+	renderAlbum(c, http.StatusOK, updated)
+}
+
+// getTags handles GET /tags requests.
+// Returns every tag in use with the number of albums that have it, most used first, as JSON with
+// HTTP 200 status. Only active albums are counted unless ?state= selects others.
+// Returns HTTP 400 if state is invalid.
+func (srv *Server) getTags(c *gin.Context) {
+	match, errMsg := parseState(c)
+	if errMsg != "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	all, err := srv.store.List(c.Request.Context())
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	counts := map[string]int{}
+	for _, a := range filterAlbums(all, match) {
+		for _, tag := range a.Tags {
+			counts[tag]++
+		}
+	}
+	rows := make([]tagCount, 0, len(counts))
+	for tag, n := range counts {
+		rows = append(rows, tagCount{Tag: tag, Count: n})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Count != rows[j].Count {
+			return rows[i].Count > rows[j].Count
+		}
+		return rows[i].Tag < rows[j].Tag
+	})
+	c.IndentedJSON(http.StatusOK, rows)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestAlbumTags tests tagging albums, filtering by tag, and GET /tags.
+// Verifies that tags are normalized and deduplicated, that ?tag= keeps only albums with every
+// given tag, and that tag counts are ordered by use.
+func TestAlbumTags(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := srv.do("POST", "/albums/550e8400-e29b-41d4-a716-446655440001/tags", `{"tags": [" Jazz ", "hard bop", "JAZZ"]}`)
+	var tagged Album
+	json.Unmarshal(w.Body.Bytes(), &tagged)
+	if w.Code != 200 || strings.Join(tagged.Tags, ",") != "jazz,hard bop" {
+		t.Fatalf("Expected 200 with tags [jazz hard bop], got %d: %s", w.Code, w.Body)
+	}
+	srv.do("POST", "/albums/550e8400-e29b-41d4-a716-446655440002/tags", `{"tags": ["jazz", "cool"]}`)
+
+	var list []Album
+	json.Unmarshal(srv.do("GET", "/albums?tag=Jazz", "").Body.Bytes(), &list)
+	if len(list) != 2 {
+		t.Errorf("Expected 2 albums tagged jazz, got %d", len(list))
+	}
+	json.Unmarshal(srv.do("GET", "/albums?tag=jazz&tag=cool", "").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Title != "Jeru" {
+		t.Errorf("Expected only Jeru to have both tags, got %+v", list)
+	}
+
+	var counts []tagCount
+	json.Unmarshal(srv.do("GET", "/tags", "").Body.Bytes(), &counts)
+	want := []tagCount{{"jazz", 2}, {"cool", 1}, {"hard bop", 1}}
+	if fmt.Sprint(counts) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, counts)
+	}
+
+	// PATCH replaces the tags.
+	w = srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440002", `{"tags": ["West Coast"]}`, "If-Match", "*")
+	json.Unmarshal(w.Body.Bytes(), &tagged)
+	if strings.Join(tagged.Tags, ",") != "west coast" {
+		t.Errorf("Expected PATCH to replace the tags, got %v", tagged.Tags)
+	}
+}
+
+// TestAlbumTagsInvalid tests that invalid tags are rejected with HTTP 400 and unknown albums with HTTP 404.
+func TestAlbumTagsInvalid(t *testing.T) {
+	srv := newTestServer(t)
+	many := make([]string, maxTagsPerAlbum+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("%q", fmt.Sprintf("tag%d", i))
+	}
+
+	for _, tc := range []struct {
+		path, body string
+		want       int
+	}{
+		{"/albums/550e8400-e29b-41d4-a716-446655440001/tags", `{"tags": []}`, 400},
+		{"/albums/550e8400-e29b-41d4-a716-446655440001/tags", `{"tags": ["  "]}`, 400},
+		{"/albums/550e8400-e29b-41d4-a716-446655440001/tags", `{"tags": ["` + strings.Repeat("x", maxTagLength+1) + `"]}`, 400},
+		{"/albums/550e8400-e29b-41d4-a716-446655440001/tags", `{"tags": [` + strings.Join(many, ",") + `]}`, 400},
+		{"/albums/missing/tags", `{"tags": ["jazz"]}`, 404},
+	} {
+		w := srv.do("POST", tc.path, tc.body)
+		if w.Code != tc.want {
+			t.Errorf("%s %.40s: expected %d, got %d", tc.path, tc.body, tc.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// tenantHeader names the request header identifying the tenant a request acts for.
+const tenantHeader = "X-Tenant-ID"
+
+// tenantStorageConfig selects a dedicated backend for one tenant. Storage names a storageBackends
+// entry; the other fields override the server's settings for that backend and may be left empty.
+type tenantStorageConfig struct {
+	Storage        string `json:"storage"`
+	DatabaseURL    string `json:"database_url,omitempty"`
+	SQLitePath     string `json:"sqlite_path,omitempty"`
+	DynamoTable    string `json:"dynamodb_table,omitempty"`
+	RedisURL       string `json:"redis_url,omitempty"`
+	RedisKeyPrefix string `json:"redis_key_prefix,omitempty"`
+	MongoURI       string `json:"mongodb_uri,omitempty"`
+	MongoDatabase  string `json:"mongodb_database,omitempty"`
+}
+
+// apply returns cfg with the tenant's backend settings applied.
+func (tc tenantStorageConfig) apply(cfg Config) Config {
+	cfg.Storage = tc.Storage
+	for dst, src := range map[*string]string{
+		&cfg.DatabaseURL:    tc.DatabaseURL,
+		&cfg.SQLitePath:     tc.SQLitePath,
+		&cfg.DynamoTable:    tc.DynamoTable,
+		&cfg.RedisURL:       tc.RedisURL,
+		&cfg.RedisKeyPrefix: tc.RedisKeyPrefix,
+		&cfg.MongoURI:       tc.MongoURI,
+		&cfg.MongoDatabase:  tc.MongoDatabase,
+	} {
+		if src != "" {
+			*dst = src
+		}
+	}
+	return cfg
+}
+
+// loadTenantStorageConfig reads the JSON file at path, which maps tenant IDs to their backends.
+func loadTenantStorageConfig(path string) (map[string]tenantStorageConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants map[string]tenantStorageConfig
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return tenants, nil
+}
+
+// tenantRouter is an AlbumStore that sends each call to the backend of the tenant in its context.
+// Tenants without a dedicated backend, and requests without a tenant, use the default store.
+type tenantRouter struct {
+	fallback AlbumStore
+	tenants  map[string]AlbumStore
+}
+
+// newTenantRouter opens a dedicated store for every tenant in tenants, in front of fallback.
+func newTenantRouter(fallback AlbumStore, tenants map[string]tenantStorageConfig, cfg Config) (*tenantRouter, error) {
+	r := &tenantRouter{fallback: fallback, tenants: make(map[string]AlbumStore, len(tenants))}
+	names := make([]string, 0, len(tenants))
+	for name := range tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s, err := newAlbumStore(tenants[name].apply(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", name, err)
+		}
+		r.tenants[name] = s
+	}
+	return r, nil
+}
+
+// storeFor returns the store serving the tenant in ctx.
+func (r *tenantRouter) storeFor(ctx context.Context) AlbumStore {
+	if s, ok := r.tenants[tenantFrom(ctx)]; ok {
+		return s
+	}
+	return r.fallback
+}
+
+// List returns every album of the tenant.
+func (r *tenantRouter) List(ctx context.Context) ([]Album, error) {
+	return r.storeFor(ctx).List(ctx)
+}
+
+// Each calls fn with every album of the tenant, streaming them if its store supports that.
+func (r *tenantRouter) Each(ctx context.Context, fn func(Album) error) error {
+	return eachAlbum(ctx, r.storeFor(ctx), fn)
+}
+
+// Stats returns the statistics of the tenant's albums, computed by its store if it supports that.
+func (r *tenantRouter) Stats(ctx context.Context) (albumStats, error) {
+	return catalogStats(ctx, r.storeFor(ctx))
+}
+
+// Query returns the tenant's albums selected by f, filtering in its store if it supports that.
+func (r *tenantRouter) Query(ctx context.Context, f albumFilter) ([]Album, error) {
+	return listAlbums(ctx, r.storeFor(ctx), f)
+}
+
+// Get returns the tenant's album with the given ID.
+func (r *tenantRouter) Get(ctx context.Context, id string) (Album, error) {
+	return r.storeFor(ctx).Get(ctx, id)
+}
+
+// GetByUPC returns the tenant's album with the given barcode, using its store's index if it has one.
+func (r *tenantRouter) GetByUPC(ctx context.Context, code string) (Album, error) {
+	return findAlbumByUPC(ctx, r.storeFor(ctx), code)
+}
+
+// Create stores a new album in the tenant's store.
+func (r *tenantRouter) Create(ctx context.Context, a Album) (Album, error) {
+	return r.storeFor(ctx).Create(ctx, a)
+}
+
+// CreateUnique creates an album for the tenant unless the tenant already has one with the same
+// title and artist, atomically if its store supports that.
+func (r *tenantRouter) CreateUnique(ctx context.Context, a Album) (Album, error) {
+	return createUnique(ctx, r.storeFor(ctx), a)
+}
+
+// Update updates the tenant's album with the given ID.
+func (r *tenantRouter) Update(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return r.storeFor(ctx).Update(ctx, id, mutate)
+}
+
+// UpdateUnique updates the tenant's album with the given ID unless it would get the title and
+// artist of another of the tenant's albums, atomically if its store supports that.
+func (r *tenantRouter) UpdateUnique(ctx context.Context, id string, mutate func(*Album) error) (Album, error) {
+	return updateUnique(ctx, r.storeFor(ctx), id, mutate)
+}
+
+// Delete removes the tenant's album with the given ID.
+func (r *tenantRouter) Delete(ctx context.Context, id string) (Album, error) {
+	return r.storeFor(ctx).Delete(ctx, id)
+}
+
+// UpdateWhere changes the tenant's albums selected by f, atomically if its store supports that.
+func (r *tenantRouter) UpdateWhere(ctx context.Context, f albumFilter, mutate func(*Album) bool) ([]Album, error) {
+	return updateWhere(ctx, r.storeFor(ctx), f, mutate)
+}
+
+// DeleteWhere removes the tenant's albums selected by f, atomically if its store supports that.
+func (r *tenantRouter) DeleteWhere(ctx context.Context, f albumFilter) ([]Album, error) {
+	return deleteWhere(ctx, r.storeFor(ctx), f)
+}
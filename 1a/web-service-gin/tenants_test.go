@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestTenantRouting tests routing tenants to dedicated storage backends.
+// Verifies that a configured tenant reads and writes its own store, while other tenants and
+// requests without X-Tenant-ID share the default store.
+func TestTenantRouting(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tenants.json")
+	os.WriteFile(path, []byte(`{"big": {"storage": "sqlite", "sqlite_path": "`+filepath.Join(dir, "big.db")+`"}}`), 0o600)
+	tenants, err := loadTenantStorageConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newTenantRouter(newMemoryStore(seedAlbums()), tenants, loadConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.tenants["big"].(*sqliteStore).db.Close()
+	srv := newTestServerWith(t, r)
+
+	w := srv.do("POST", "/albums", `{"title": "Giant Steps", "artist": "John Coltrane", "price": 24.99}`, tenantHeader, "big")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var created Album
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	for _, tc := range []struct {
+		tenant string
+		want   int
+	}{{"big", 1}, {"small", 3}, {"", 3}} {
+		var list []Album
+		json.Unmarshal(srv.do("GET", "/albums", "", tenantHeader, tc.tenant).Body.Bytes(), &list)
+		if len(list) != tc.want {
+			t.Errorf("Tenant %q: expected %d albums, got %d", tc.tenant, tc.want, len(list))
+		}
+	}
+	if w := srv.do("GET", "/albums/"+created.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the tenant's album to be hidden from the default store, got %d", w.Code)
+	}
+}
+
+// TestTenantRouterUnknownBackend tests that a tenant naming an unknown backend fails at startup.
+func TestTenantRouterUnknownBackend(t *testing.T) {
+	_, err := newTenantRouter(newMemoryStore(nil), map[string]tenantStorageConfig{"big": {Storage: "nope"}}, loadConfig())
+	if err == nil {
+		t.Error("Expected an error for an unknown backend")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// albumTimeBounds are the query parameters GET /albums filters album timestamps with: each keeps
+// albums whose timestamp is strictly after or before the given RFC 3339 time.
+var albumTimeBounds = []struct {
+	name  string
+	after bool
+	field func(Album) time.Time
+}{
+	{"created_after", true, func(a Album) time.Time { return a.CreatedAt }},
+	{"created_before", false, func(a Album) time.Time { return a.CreatedAt }},
+	{"updated_after", true, func(a Album) time.Time { return a.UpdatedAt }},
+	{"updated_before", false, func(a Album) time.Time { return a.UpdatedAt }},
+}
+
+// parseTimeFilter returns a filter for the created_after, created_before, updated_after, and
+// updated_before query parameters, or nil if none is given. Albums without the timestamp, which
+// predate it, never match a bound on it. Returns an error message if a time is not RFC 3339.
+func parseTimeFilter(c *gin.Context) (func(Album) bool, string) {
+	var checks []func(Album) bool
+	for _, bound := range albumTimeBounds {
+		raw := c.Query(bound.name)
+		if raw == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, bound.name + " must be an RFC 3339 time, e.g. 2024-01-02T15:04:05Z"
+		}
+		checks = append(checks, func(a Album) bool {
+			t := bound.field(a)
+			if t.IsZero() {
+				return false
+			}
+			if bound.after {
+				return t.After(at)
+			}
+			return t.Before(at)
+		})
+	}
+	if len(checks) == 0 {
+		return nil, ""
+	}
+	return func(a Album) bool {
+		for _, check := range checks {
+			if !check(a) {
+				return false
+			}
+		}
+		return true
+	}, ""
+}
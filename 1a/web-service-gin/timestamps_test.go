@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAlbumTimestamps tests the created_at and updated_at fields of albums.
+// Verifies that creating an album sets both, that updating it only moves updated_at, and that
+// GET /albums sorts and filters by them, rejecting times that are not RFC 3339.
+func TestAlbumTimestamps(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	srv := newTestServerWith(t, newMemoryStore([]Album{
+		{ID: "a", Title: "Old", Artist: "A", Price: 1, CreatedAt: day(1), UpdatedAt: day(9)},
+		{ID: "b", Title: "Middle", Artist: "B", Price: 1, CreatedAt: day(3), UpdatedAt: day(4)},
+		{ID: "c", Title: "New", Artist: "C", Price: 1, CreatedAt: day(5), UpdatedAt: day(6)},
+	}))
+
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{"sort=created_at&order=desc", "c,b,a"},
+		{"sort=updated_at", "b,c,a"},
+		{"created_after=2024-01-02T00:00:00Z", "b,c"},
+		{"created_after=2024-01-02T00:00:00Z&updated_before=2024-01-05T00:00:00Z", "b"},
+		{"updated_after=2024-01-06T00:00:00Z", "a"},
+	} {
+		var albums []Album
+		json.Unmarshal(srv.do("GET", "/albums?"+tc.query, "").Body.Bytes(), &albums)
+		var ids []string
+		for _, a := range albums {
+			ids = append(ids, a.ID)
+		}
+		if got := strings.Join(ids, ","); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.query, tc.want, got)
+		}
+	}
+	if w := srv.do("GET", "/albums?created_after=yesterday", ""); w.Code != 400 {
+		t.Errorf("Expected 400 for a time that is not RFC 3339, got %d", w.Code)
+	}
+
+	var created Album
+	json.Unmarshal(srv.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 49.99, "created_at": "2000-01-01T00:00:00Z"}`).Body.Bytes(), &created)
+	if created.CreatedAt.IsZero() || !created.CreatedAt.Equal(created.UpdatedAt) || created.CreatedAt.Year() == 2000 {
+		t.Fatalf("Expected created_at and updated_at to be set by the server, got %+v", created)
+	}
+	var updated Album
+	json.Unmarshal(srv.do("PATCH", "/albums/"+created.ID, `{"price": 39.99}`, "If-Match", "*").Body.Bytes(), &updated)
+	if !updated.CreatedAt.Equal(created.CreatedAt) || !updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("Expected only updated_at to change, got %+v", updated)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Track limits. Durations are in seconds.
+const (
+	maxTracksPerAlbum = 200
+	maxTrackTitle     = 200
+	maxTrackDuration  = 24 * 60 * 60
+)
+
+var (
+	// errTrackNotFound is returned when an album has no track with the requested number.
+	errTrackNotFound = errors.New("track not found")
+	// errTrackExists is returned when adding a track with the number of one the album already has.
+	errTrackExists = errors.New("the album already has a track with this number")
+)
+
+// Track is one track of an album: its position on the album, title, and duration in seconds.
+type Track struct {
+	Number   int    `json:"number"`
+	Title    string `json:"title"`
+	Duration int    `json:"duration"`
+}
+
+// validateTrack returns an error message if t is not a valid track. The number must be set.
+func validateTrack(t Track) string {
+	if t.Number < 1 || t.Number > maxTracksPerAlbum {
+		return fmt.Sprintf("Track number must be between 1 and %d", maxTracksPerAlbum)
+	}
+	if t.Title == "" || len(t.Title) > maxTrackTitle {
+		return fmt.Sprintf("Track title must be between 1 and %d characters", maxTrackTitle)
+	}
+	if t.Duration < 1 || t.Duration > maxTrackDuration {
+		return fmt.Sprintf("Track duration must be between 1 and %d seconds", maxTrackDuration)
+	}
+	return ""
+}
+
+// setTracks replaces the tracks of a with tracks, sorted by number, and updates its track count.
+func setTracks(a *Album, tracks []Track) {
+	slices.SortFunc(tracks, func(x, y Track) int { return x.Number - y.Number })
+	if len(tracks) == 0 {
+		tracks = nil
+	}
+	a.Tracks, a.TrackCount = tracks, len(tracks)
+}
+
+// getAlbumTracks handles GET /albums/:id/tracks requests.
+// Returns the album's tracks, ordered by number, as a JSON array with HTTP 200 status.
+// Returns HTTP 404 if the album is not found.
+func (srv *Server) getAlbumTracks(c *gin.Context) {
+	a, err := srv.store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+	tracks := a.Tracks
+	if tracks == nil {
+		tracks = []Track{}
+	}
+	c.IndentedJSON(http.StatusOK, tracks)
+}
+
+// postAlbumTrack handles POST /albums/:id/tracks requests.
+// Adds the track in the JSON body ({"number": 1, "title": "...", "duration": 431}) to the album;
+// without a number, it becomes the album's last track. Returns the track as JSON with HTTP 201
+// status. Returns HTTP 400 if the track is invalid or the album already has 200 tracks, HTTP 404 if
+// the album is not found, or HTTP 409 if the album already has a track with the number.
+func (srv *Server) postAlbumTrack(c *gin.Context) {
+	var track Track
+	if err := c.ShouldBindJSON(&track); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid JSON",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var previous Album
+	updated, err := srv.updateAlbum(c.Request.Context(), c.Param("id"), func(a *Album) error {
+		previous = *a
+		if len(a.Tracks) >= maxTracksPerAlbum {
+			return validationError(fmt.Sprintf("An album can have at most %d tracks", maxTracksPerAlbum))
+		}
+		if track.Number == 0 {
+			track.Number = 1
+			if n := len(a.Tracks); n > 0 {
+				track.Number = a.Tracks[n-1].Number + 1
+			}
+		}
+		if errMsg := validateTrack(track); errMsg != "" {
+			return validationError(errMsg)
+		}
+		if slices.ContainsFunc(a.Tracks, func(t Track) bool { return t.Number == track.Number }) {
+			return errTrackExists
+		}
+		setTracks(a, append(slices.Clone(a.Tracks), track))
+		return nil
+	})
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	srv.publishAlbumEvent(c.Request.Context(), eventAlbumUpdated, updated, &previous)
+	c.IndentedJSON(http.StatusCreated, track)
+}
+
+// deleteAlbumTrack handles DELETE /albums/:id/tracks/:number requests.
+// Removes the track with the given number from the album and returns it as JSON with HTTP 200
+// status; the other tracks keep their numbers. Returns HTTP 400 if number is not a number, or
+// HTTP 404 if the album or the track is not found.
+func (srv *Server) deleteAlbumTrack(c *gin.Context) {
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Track number must be a number"})
+		return
+	}
+
+	var previous Album
+	var removed Track
+	updated, err := srv.updateAlbum(c.Request.Context(), c.Param("id"), func(a *Album) error {
+		previous = *a
+		i := slices.IndexFunc(a.Tracks, func(t Track) bool { return t.Number == number })
+		if i < 0 {
+			return errTrackNotFound
+		}
+		removed = a.Tracks[i]
+		setTracks(a, slices.Delete(slices.Clone(a.Tracks), i, i+1))
+		return nil
+	})
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	srv.publishAlbumEvent(c.Request.Context(), eventAlbumUpdated, updated, &previous)
+	c.IndentedJSON(http.StatusOK, removed)
+}
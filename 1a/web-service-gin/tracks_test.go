@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestAlbumTracks tests adding, listing, and removing album tracks.
+// Verifies that tracks are validated, numbered after the last track when no number is given, kept
+// in order, counted in album responses, and that duplicate numbers and unknown tracks are rejected.
+func TestAlbumTracks(t *testing.T) {
+	srv := newTestServer(t)
+	const album = "/albums/550e8400-e29b-41d4-a716-446655440001"
+
+	for _, body := range []string{
+		`{"number": 2, "title": "Moment's Notice", "duration": 550}`,
+		`{"number": 1, "title": "Blue Train", "duration": 643}`,
+		`{"title": "Locomotion", "duration": 434}`,
+	} {
+		if w := srv.do("POST", album+"/tracks", body); w.Code != 201 {
+			t.Fatalf("Expected 201 adding %s, got %d: %s", body, w.Code, w.Body)
+		}
+	}
+	var tracks []Track
+	json.Unmarshal(srv.do("GET", album+"/tracks", "").Body.Bytes(), &tracks)
+	if len(tracks) != 3 || tracks[0].Title != "Blue Train" || tracks[2].Number != 3 || tracks[2].Title != "Locomotion" {
+		t.Errorf("Expected three tracks in order, got %+v", tracks)
+	}
+	var a Album
+	json.Unmarshal(srv.do("GET", album, "").Body.Bytes(), &a)
+	if a.TrackCount != 3 || len(a.Tracks) != 3 {
+		t.Errorf("Expected the album to count 3 tracks, got %d", a.TrackCount)
+	}
+
+	for body, want := range map[string]int{
+		`{"number": 1, "title": "Again", "duration": 100}`: 409,
+		`{"number": 0, "title": "", "duration": 100}`:      400,
+		`{"number": 4, "title": "Silence", "duration": 0}`: 400,
+		`{"number": 201, "title": "Late", "duration": 1}`:  400,
+		`{"number": -1, "title": "Early", "duration": 1}`:  400,
+	} {
+		if w := srv.do("POST", album+"/tracks", body); w.Code != want {
+			t.Errorf("POST %s: expected %d, got %d", body, want, w.Code)
+		}
+	}
+	if w := srv.do("POST", "/albums/missing/tracks", `{"title": "Lost", "duration": 1}`); w.Code != 404 {
+		t.Errorf("Expected 404 for an unknown album, got %d", w.Code)
+	}
+
+	w := srv.do("DELETE", album+"/tracks/2", "")
+	var removed Track
+	json.Unmarshal(w.Body.Bytes(), &removed)
+	if w.Code != 200 || removed.Title != "Moment's Notice" {
+		t.Errorf("Expected track 2 to be removed, got %d: %s", w.Code, w.Body)
+	}
+	for path, want := range map[string]int{album + "/tracks/2": 404, album + "/tracks/two": 400} {
+		if w := srv.do("DELETE", path, ""); w.Code != want {
+			t.Errorf("DELETE %s: expected %d, got %d", path, want, w.Code)
+		}
+	}
+	json.Unmarshal(srv.do("GET", album+"/tracks", "").Body.Bytes(), &tracks)
+	if len(tracks) != 2 || tracks[1].Number != 3 {
+		t.Errorf("Expected the other tracks to keep their numbers, got %+v", tracks)
+	}
+
+	w = srv.do("PUT", album, `{"title": "Blue Train", "artist": "John Coltrane", "price": 56.99, "tracks": []}`, "If-Match", "*")
+	json.Unmarshal(w.Body.Bytes(), &a)
+	if w.Code != 200 || a.TrackCount != 2 {
+		t.Errorf("Expected PUT to keep the tracks, got %d: %s", w.Code, w.Body)
+	}
+	w = srv.do("POST", "/albums", `{"title": "Giant Steps", "artist": "John Coltrane", "price": 19.99, "tracks": [{"number": 1, "title": "Giant Steps", "duration": 283}]}`)
+	var created Album
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != 201 || created.TrackCount != 0 || created.Tracks != nil {
+		t.Errorf("Expected tracks in a POST body to be ignored, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runtimeSettings is the body accepted by PUT /admin/runtime. Omitted fields are left unchanged.
+type runtimeSettings struct {
+	GCPercent        *int   `json:"gc_percent"`
+	MemoryLimitBytes *int64 `json:"memory_limit_bytes"`
+}
+
+// gcPercent returns the current GC target percentage without changing it.
+func gcPercent() int {
+	// SetGCPercent is the only way to read the value, so set it and immediately restore it.
+	current := debug.SetGCPercent(100)
+	debug.SetGCPercent(current)
+	return current
+}
+
+// runtimeStatus returns the current scheduler, GC, and memory settings along with heap usage.
+func runtimeStatus() gin.H {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	limit := debug.SetMemoryLimit(-1)
+	status := gin.H{
+		"gomaxprocs":         runtime.GOMAXPROCS(0),
+		"num_cpu":            runtime.NumCPU(),
+		"num_goroutine":      runtime.NumGoroutine(),
+		"gc_percent":         gcPercent(),
+		"memory_limit_bytes": nil,
+		"heap_alloc_bytes":   mem.HeapAlloc,
+		"heap_sys_bytes":     mem.HeapSys,
+		"num_gc":             mem.NumGC,
+	}
+	if limit != math.MaxInt64 {
+		status["memory_limit_bytes"] = limit
+	}
+	return status
+}
+
+// getRuntime handles GET /admin/runtime requests.
+// Returns the current runtime settings as JSON with HTTP 200 status.
+func getRuntime(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, runtimeStatus())
+}
+
+// putRuntime handles PUT /admin/runtime requests.
+// Adjusts the GC target percentage (-1 disables the collector) and the soft memory limit
+// (0 removes it), then returns the new settings as JSON with HTTP 200 status.
+// Returns 400 Bad Request if the body is invalid or a value is out of range.
+func putRuntime(c *gin.Context) {
+	var settings runtimeSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid JSON",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if settings.GCPercent != nil && *settings.GCPercent < -1 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "gc_percent must be -1 or greater"})
+		return
+	}
+	if settings.MemoryLimitBytes != nil && *settings.MemoryLimitBytes < 0 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "memory_limit_bytes must not be negative"})
+		return
+	}
+
+	if settings.GCPercent != nil {
+		debug.SetGCPercent(*settings.GCPercent)
+	}
+	if settings.MemoryLimitBytes != nil {
+		limit := *settings.MemoryLimitBytes
+		if limit == 0 {
+			limit = math.MaxInt64
+		}
+		debug.SetMemoryLimit(limit)
+	}
+
+	c.IndentedJSON(http.StatusOK, runtimeStatus())
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"runtime/debug"
+	"testing"
+)
+
+// TestRuntimeTuning tests the GET and PUT /admin/runtime endpoints.
+// Verifies that the GC target and soft memory limit can be changed and cleared,
+// and that out-of-range values are rejected.
+func TestRuntimeTuning(t *testing.T) {
+	defer debug.SetGCPercent(debug.SetGCPercent(100))
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(-1))
+
+	srv := newTestServer(t)
+
+	put := func(body string) (int, map[string]any) {
+		w := srv.do("PUT", "/admin/runtime", body)
+		var status map[string]any
+		json.Unmarshal(w.Body.Bytes(), &status)
+		return w.Code, status
+	}
+
+	code, status := put(`{"gc_percent": 250, "memory_limit_bytes": 536870912}`)
+	if code != 200 {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if status["gc_percent"] != float64(250) {
+		t.Errorf("Expected gc_percent 250, got %v", status["gc_percent"])
+	}
+	if status["memory_limit_bytes"] != float64(536870912) {
+		t.Errorf("Expected memory_limit_bytes 536870912, got %v", status["memory_limit_bytes"])
+	}
+
+	code, status = put(`{"memory_limit_bytes": 0}`)
+	if code != 200 {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if status["memory_limit_bytes"] != nil {
+		t.Errorf("Expected memory limit to be cleared, got %v", status["memory_limit_bytes"])
+	}
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		t.Errorf("Expected no runtime memory limit, got %d", limit)
+	}
+	if status["gc_percent"] != float64(250) {
+		t.Errorf("Expected gc_percent to stay 250, got %v", status["gc_percent"])
+	}
+
+	for _, body := range []string{`{"gc_percent": -5}`, `{"memory_limit_bytes": -1}`, `not json`} {
+		if code, _ := put(body); code != 400 {
+			t.Errorf("Expected 400 for %s, got %d", body, code)
+		}
+	}
+
+	w := srv.do("GET", "/admin/runtime", "")
+	if w.Code != 200 {
+		t.Errorf("Expected 200, got %d", w.Code)
+	}
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if status["gomaxprocs"].(float64) < 1 {
+		t.Errorf("Expected gomaxprocs of at least 1, got %v", status["gomaxprocs"])
+	}
+}
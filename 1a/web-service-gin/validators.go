@@ -1,40 +1,288 @@
 package main
 
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// fieldError is one invalid field of an album: its JSON name, the validation rule it breaks (the
+// validate tag of its Album field), and a message for the client.
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// fieldErrors lists every invalid field of an album, in the order of Album's fields. Handlers
+// respond with HTTP 400 and the whole list (see respondStoreError), so a client can fix every field
+// at once rather than one per request.
+type fieldErrors []fieldError
+
+// Error returns the messages of e joined by semicolons.
+func (e fieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// genresKey is the context key of the genre allowlist the genre rule checks against.
+type genresKey struct{}
+
+// albumRules are the custom rules of Album's validate tags, by tag. Each returns the error message
+// for the field value v, or "" if it is valid; ctx carries the genre allowlist.
+var albumRules = map[string]func(ctx context.Context, v reflect.Value) string{
+	"title_length": func(_ context.Context, v reflect.Value) string {
+		// Titles are measured in characters, so accented and non-Latin titles get the same room.
+		if n := utf8.RuneCountInString(v.String()); n < 2 || n > 100 {
+			return "Title must be between 2 and 100 characters"
+		}
+		return ""
+	},
+	"price_precision": func(_ context.Context, v reflect.Value) string {
+		if cents := v.Float() * 100; math.Abs(cents-math.Round(cents)) > 1e-6 {
+			return "Price must have at most 2 decimal places"
+		}
+		return ""
+	},
+	"currency": func(_ context.Context, v reflect.Value) string {
+		return validateCurrency(v.String())
+	},
+	"upc": func(_ context.Context, v reflect.Value) string {
+		return validateUPC(v.String())
+	},
+	"genre": func(ctx context.Context, v reflect.Value) string {
+		genres, _ := ctx.Value(genresKey{}).([]string)
+		return validateGenre(v.String(), genres)
+	},
+	"year": func(_ context.Context, v reflect.Value) string {
+		return validateYear(int(v.Int()))
+	},
+	"quantity": func(_ context.Context, v reflect.Value) string {
+		return validateQuantity(int(v.Int()))
+	},
+	"tags": func(_ context.Context, v reflect.Value) string {
+		_, errMsg := mergeTags(nil, v.Interface().([]string))
+		return errMsg
+	},
+	"metadata": func(_ context.Context, v reflect.Value) string {
+		_, errMsg := mergeMetadata(nil, v.Interface().(map[string]string))
+		return errMsg
+	},
+}
+
+// albumValidator validates albums against the validate tags of Album, with albumRules registered.
+// Field errors are named by the fields' JSON names.
+var albumValidator = newAlbumValidator()
+
+// newAlbumValidator creates albumValidator.
+func newAlbumValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		return name
+	})
+	for tag, rule := range albumRules {
+		v.RegisterValidationCtx(tag, func(ctx context.Context, fl validator.FieldLevel) bool {
+			return rule(ctx, fl.Field()) == ""
+		})
+	}
+	return v
+}
+
+// fieldErrorsFrom converts the error of albumValidator into fieldErrors, with messages for the
+// field named field, or for the field of each error if field is "". Any other error, which only a
+// programming error such as validating a nil album causes, is returned as is, and nil if err is nil.
+func fieldErrorsFrom(ctx context.Context, field string, err error) error {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	errs := make(fieldErrors, len(invalid))
+	for i, fe := range invalid {
+		errs[i] = fieldError{Field: cmp.Or(field, fe.Field()), Rule: fe.Tag(), Message: fieldMessage(ctx, cmp.Or(field, fe.Field()), fe)}
+	}
+	return errs
+}
+
+// fieldMessage returns the message for fe, an error of the field named field.
+func fieldMessage(ctx context.Context, field string, fe validator.FieldError) string {
+	if rule, ok := albumRules[fe.Tag()]; ok {
+		return rule(ctx, reflect.Indirect(reflect.ValueOf(fe.Value())))
+	}
+	label := strings.ToUpper(field[:1]) + field[1:]
+	switch fe.Tag() {
+	case "required":
+		return label + " is required"
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", label, fe.Param())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", label, fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", label, fe.Param())
+	}
+	return label + " is invalid"
+}
+
+// validateAlbum checks the client-supplied fields of a complete album, as sent to POST /albums or
+// PUT /albums/:id, against the validate tags of Album: title, artist, and price are required, and
+// currency, UPC, genre (one of genres), year, quantity, tags, and metadata are optional. If every
+// field is valid, the currency, genre, tags, and metadata are normalized in place.
+// Returns fieldErrors listing every invalid field, or nil if there is none.
+func validateAlbum(a *Album, genres []string) error {
+	ctx := context.WithValue(context.Background(), genresKey{}, genres)
+	if err := fieldErrorsFrom(ctx, "", albumValidator.StructCtx(ctx, a)); err != nil {
+		return err
+	}
+	normalizeAlbum(a, genres)
+	return nil
+}
+
+// validateAlbumUpdate checks the fields set in update, as sent to PATCH /albums/:id, against the
+// validate tags of Album; the fields left unset are not required. If every field is valid, the
+// currency, genre, and tags set are normalized in place.
+// Returns fieldErrors listing every invalid field, or nil if there is none.
+func validateAlbumUpdate(update *Album, genres []string) error {
+	v := reflect.ValueOf(update).Elem()
+	var set []string
+	for _, f := range reflect.VisibleFields(v.Type()) {
+		if f.Tag.Get("validate") != "" && !v.FieldByIndex(f.Index).IsZero() {
+			set = append(set, f.Name)
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	ctx := context.WithValue(context.Background(), genresKey{}, genres)
+	if err := fieldErrorsFrom(ctx, "", albumValidator.StructPartialCtx(ctx, update, set...)); err != nil {
+		return err
+	}
+	// The metadata is merged with the album's by the update, which normalizes it.
+	metadata := update.Metadata
+	normalizeAlbum(update, genres)
+	update.Metadata = metadata
+	return nil
+}
+
+// normalizeAlbum stores the set currency, genre, tags, and metadata of a valid album in the form in
+// which they are matched: an uppercase currency, the genre as spelled in genres, and the tags and
+// metadata as merged (see mergeTags and mergeMetadata).
+func normalizeAlbum(a *Album, genres []string) {
+	a.Currency = strings.ToUpper(a.Currency)
+	if a.Genre != "" {
+		a.Genre, _ = lookupGenre(a.Genre, genres)
+	}
+	if a.Tags != nil {
+		a.Tags, _ = mergeTags(nil, a.Tags)
+	}
+	a.Metadata, _ = mergeMetadata(nil, a.Metadata)
+}
+
+// validateField validates value against the validate tag of the Album field name, as for a
+// complete album if required, or else only if value is set.
+// Returns the error message for the first rule it breaks, or "" if it is valid.
+func validateField(name string, value any, required bool) string {
+	field, _ := reflect.TypeFor[Album]().FieldByName(name)
+	rules := field.Tag.Get("validate")
+	if !required {
+		rules = "omitempty," + strings.TrimPrefix(rules, "required,")
+	}
+	jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	err := fieldErrorsFrom(context.Background(), jsonName, albumValidator.Var(value, rules))
+	var errs fieldErrors
+	if errors.As(err, &errs) {
+		return errs[0].Message
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
 // validateTitle validates the title field and returns an error message if validation fails.
 // If required is true, the title must be non-empty. The title must be between 2 and 100 characters.
 // Returns an empty string if validation passes, otherwise returns an error message.
 func validateTitle(title string, required bool) string {
-	if required && title == "" {
-		return "Title is required"
-	}
-	if title != "" && (len(title) < 2 || len(title) > 100) {
-		return "Title must be between 2 and 100 characters"
-	}
-	return ""
+	return validateField("Title", title, required)
 }
 
 // validateArtist validates the artist field and returns an error message if validation fails.
 // If required is true, the artist must be non-empty. The artist must be between 2 and 100 characters.
 // Returns an empty string if validation passes, otherwise returns an error message.
 func validateArtist(artist string, required bool) string {
-	if required && artist == "" {
-		return "Artist is required"
+	return validateField("Artist", artist, required)
+}
+
+// validatePrice validates the price field and returns an error message if validation fails.
+// If required is true, the price must be set. A set price must be greater than 0 and have at most
+// 2 decimal places.
+// Returns an empty string if validation passes, otherwise returns an error message.
+func validatePrice(price float64, required bool) string {
+	return validateField("Price", price, required)
+}
+
+// validateUPC validates an optional barcode and returns an error message if validation fails.
+// Accepts UPC-A (12 digits), EAN-13 (13 digits), and EAN-8 (8 digits) codes with a valid GS1 check digit.
+// Returns an empty string if validation passes, otherwise returns an error message.
+func validateUPC(code string) string {
+	if len(code) != 8 && len(code) != 12 && len(code) != 13 {
+		return "UPC must be 8, 12, or 13 digits"
 	}
-	if artist != "" && (len(artist) < 2 || len(artist) > 100) {
-		return "Artist must be between 2 and 100 characters"
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		c := code[i]
+		if c < '0' || c > '9' {
+			return "UPC must contain only digits"
+		}
+		digit := int(c - '0')
+		// Weights alternate 1, 3, 1, ... from the right, starting with the check digit.
+		if (len(code)-1-i)%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	if sum%10 != 0 {
+		return "UPC check digit is invalid"
 	}
 	return ""
 }
 
-// validatePrice validates the price field and returns an error message if validation fails.
-// If required is true, the price must be greater than 0. Price cannot be negative.
+// normalizeUPC returns the canonical form of a valid barcode used for lookups.
+// UPC-A codes are widened to EAN-13 by prefixing a zero, so both forms find the same album.
+func normalizeUPC(code string) string {
+	if len(code) == 12 {
+		return "0" + code
+	}
+	return code
+}
+
+// minAlbumYear is the earliest release year an album may have.
+const minAlbumYear = 1900
+
+// validateGenre validates an optional genre against the allowlist genres, ignoring case.
 // Returns an empty string if validation passes, otherwise returns an error message.
-func validatePrice(price float64, required bool) string {
-	if required && price <= 0 {
-		return "Price is required and must be greater than 0"
+func validateGenre(genre string, genres []string) string {
+	if _, ok := lookupGenre(genre, genres); !ok {
+		return "Genre must be one of: " + strings.Join(genres, ", ")
 	}
-	if price < 0 {
-		return "Price must be greater than or equal to 0"
+	return ""
+}
+
+// validateYear validates an optional release year, which must be between 1900 and the current year.
+// Returns an empty string if validation passes, otherwise returns an error message.
+func validateYear(year int) string {
+	if now := time.Now().Year(); year < minAlbumYear || year > now {
+		return fmt.Sprintf("Year must be between %d and %d", minAlbumYear, now)
 	}
 	return ""
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAlbumValidation tests validating albums against the validate tags of Album.
+// Verifies that every invalid field is reported in one HTTP 400 response, that prices may have at
+// most two decimal places, that titles are measured in characters, that PATCH only checks the
+// fields it sets, and that batch creation reports every invalid field of an album.
+func TestAlbumValidation(t *testing.T) {
+	srv := newTestServer(t)
+	decode := func(w *httptest.ResponseRecorder) (string, fieldErrors) {
+		var resp struct {
+			Error  string      `json:"error"`
+			Errors fieldErrors `json:"errors"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Error, resp.Errors
+	}
+
+	w := srv.do("POST", "/albums", `{"title": "X", "price": 9.999, "upc": "123", "genre": "Polka", "year": 1850, "quantity": -1, "currency": "EURO"}`)
+	errMsg, errs := decode(w)
+	var got []string
+	for _, fe := range errs {
+		got = append(got, fe.Field+":"+fe.Rule)
+	}
+	want := "title:title_length artist:required price:price_precision upc:upc genre:genre year:year quantity:quantity currency:currency"
+	if w.Code != http.StatusBadRequest || strings.Join(got, " ") != want {
+		t.Fatalf("Expected 400 with errors %s, got %d: %s", want, w.Code, w.Body)
+	}
+	if errs[0].Message != "Title must be between 2 and 100 characters" || errs[1].Message != "Artist is required" ||
+		errs[2].Message != "Price must have at most 2 decimal places" || errs[3].Message != "UPC must be 8, 12, or 13 digits" {
+		t.Errorf("Expected the fields' messages, got %+v", errs)
+	}
+	if errMsg != errs.Error() || !strings.HasPrefix(errMsg, "Title must be between 2 and 100 characters; Artist is required; ") {
+		t.Errorf("Expected error to join the messages, got %q", errMsg)
+	}
+
+	for _, tc := range []struct {
+		body string
+		code int
+	}{
+		{`{"title": "Kind of Blue", "artist": "Miles Davis", "price": 9.99}`, http.StatusCreated},
+		{`{"title": "Kind of Blue", "artist": "Miles Davis", "price": 10.1}`, http.StatusCreated},
+		{`{"title": "Kind of Blue", "artist": "Miles Davis", "price": 0.001}`, http.StatusBadRequest},
+		{`{"title": "Kind of Blue", "artist": "Miles Davis", "price": -5}`, http.StatusBadRequest},
+		// Two characters, but four bytes.
+		{`{"title": "風景", "artist": "Miles Davis", "price": 9.99}`, http.StatusCreated},
+		{`{"title": "é", "artist": "Miles Davis", "price": 9.99}`, http.StatusBadRequest},
+		{fmt.Sprintf(`{"title": %q, "artist": "Miles Davis", "price": 9.99}`, strings.Repeat("é", 101)), http.StatusBadRequest},
+	} {
+		if w := srv.do("POST", "/albums?allow_duplicate=true", tc.body); w.Code != tc.code {
+			t.Errorf("POST %s: expected %d, got %d: %s", tc.body, tc.code, w.Code, w.Body)
+		}
+	}
+
+	// PATCH checks only the fields it sets, but all of them.
+	w = srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", `{"price": 1.234, "year": 3000}`, "If-Match", "*")
+	if _, errs := decode(w); w.Code != http.StatusBadRequest || len(errs) != 2 || errs[0].Field != "price" || errs[1].Field != "year" {
+		t.Errorf("Expected 400 with price and year errors, got %d: %s", w.Code, w.Body)
+	}
+	w = srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440001", `{"price": 12.5, "currency": "eur", "genre": "jazz"}`, "If-Match", "*")
+	var patched Album
+	json.Unmarshal(w.Body.Bytes(), &patched)
+	if w.Code != http.StatusOK || patched.Price != 12.5 || patched.Currency != "EUR" || patched.Genre != "Jazz" || patched.Title != "Blue Train" {
+		t.Errorf("Expected the set fields to be normalized and updated, got %d: %s", w.Code, w.Body)
+	}
+
+	w = srv.do("POST", "/albums/batch", `[{"title": "Giant Steps", "artist": "", "price": 0}]`)
+	if !strings.Contains(w.Body.String(), "Artist is required; Price is required") {
+		t.Errorf("Expected batch creation to report every invalid field, got %d: %s", w.Code, w.Body)
+	}
+}
+
+// TestValidateAlbumInternalError tests that validating something the validator cannot, such as a
+// nil album, is reported as an error other than fieldErrors, and so as HTTP 500, instead of
+// panicking.
+func TestValidateAlbumInternalError(t *testing.T) {
+	err := validateAlbum(nil, nil)
+	var fields fieldErrors
+	if err == nil || errors.As(err, &fields) {
+		t.Fatalf("Expected an error other than fieldErrors, got %v", err)
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	respondStoreError(c, err)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// v1Routes registers version 1 of the API on api: albums, artists, tags, batches, jobs, and saved
+// searches. Albums, including an artist's, are rendered through pipelines["/albums"], with the
+// fields of version 1 selectable with ?fields= (see fieldsMiddleware) and prices shown in the
+// currency chosen with ?currency= (see currencyMiddleware). A later version with
+// breaking changes gets a function of its own registering on its own group, reusing these
+// handlers where nothing changed.
+func (srv *Server) v1Routes(api *gin.RouterGroup, pipelines map[string]renderPipeline) {
+	albums := api.Group("/albums", renderMiddleware(pipelines["/albums"]), fieldsMiddleware(1), srv.currencyMiddleware)
+	get(albums, "", srv.getAlbums)
+	albums.POST("", srv.postAlbums)
+	albums.DELETE("", srv.deleteAlbums)
+	albums.POST("/batch", srv.asyncMiddleware, srv.postAlbumsBatch)
+	albums.POST("/import", srv.asyncMiddleware, srv.importAlbums)
+	get(albums, "/feed.atom", srv.getAlbumFeed)
+	get(albums, "/export", srv.asyncMiddleware, srv.exportAlbums)
+	get(albums, "/compare", srv.compareAlbums)
+	get(albums, "/search", srv.searchAlbums)
+	get(albums, "/stats", srv.getAlbumStats)
+	get(albums, "/schema", albumSchemaHandler(1))
+	albums.GET("/changes", srv.streamChanges)
+	albums.GET("/changes/poll", srv.pollChanges)
+	get(albums, "/:id", srv.getAlbumByID)
+	get(albums, "/upc/:code", srv.getAlbumByUPC)
+	albums.DELETE("/:id", srv.lockGuard, srv.deleteAlbumByID)
+	albums.PATCH("/:id", srv.lockGuard, srv.patchAlbumByID)
+	albums.PUT("/:id", srv.lockGuard, srv.putAlbumByID)
+	get(albums, "/:id/full", srv.getAlbumFull)
+	get(albums, "/:id/history", srv.getAlbumHistory)
+	get(albums, "/:id/history/:revision", srv.getAlbumRevision)
+	albums.POST("/:id/link/spotify", srv.lockGuard, srv.linkSpotify)
+	albums.POST("/:id/archive", srv.lockGuard, srv.archiveAlbum)
+	albums.POST("/:id/unarchive", srv.lockGuard, srv.unarchiveAlbum)
+	albums.POST("/:id/restore", srv.lockGuard, srv.restoreAlbum)
+	albums.POST("/:id/tags", srv.lockGuard, srv.postAlbumTags)
+	albums.POST("/:id/purchase", srv.purchaseAlbum)
+	get(albums, "/:id/tracks", srv.getAlbumTracks)
+	albums.POST("/:id/tracks", srv.lockGuard, srv.postAlbumTrack)
+	albums.DELETE("/:id/tracks/:number", srv.lockGuard, srv.deleteAlbumTrack)
+	get(albums, "/:id/cover", srv.getAlbumCover)
+	albums.PUT("/:id/cover", srv.lockGuard, srv.putAlbumCover)
+	albums.POST("/:id/lock", srv.postAlbumLock)
+	get(albums, "/:id/lock", srv.getAlbumLock)
+	albums.DELETE("/:id/lock", srv.deleteAlbumLock)
+	get(api, "/artists", srv.getArtists)
+	api.POST("/artists", srv.postArtist)
+	get(api, "/artists/:id", srv.getArtist)
+	api.PUT("/artists/:id", srv.renameArtist)
+	api.PATCH("/artists/:id", srv.renameArtist)
+	api.DELETE("/artists/:id", srv.deleteArtist)
+	get(api, "/artists/:id/albums", renderMiddleware(pipelines["/albums"]), fieldsMiddleware(1), srv.currencyMiddleware, srv.getArtistAlbums)
+	get(api, "/tags", srv.getTags)
+	api.POST("/batch", srv.asyncMiddleware, srv.postBatch)
+	get(api, "/jobs/:id", srv.getJob)
+	get(api, "/jobs/:id/result", srv.getJobResult)
+	api.POST("/saved-searches", srv.postSavedSearch)
+	get(api, "/saved-searches", srv.getSavedSearches)
+	get(api, "/saved-searches/:id", srv.getSavedSearch)
+	api.DELETE("/saved-searches/:id", srv.deleteSavedSearch)
+	get(api, "/saved-searches/:id/events", srv.streamSavedSearch)
+}
+
+// get registers a GET route and the matching HEAD route, whose body net/http discards.
+func get(g gin.IRoutes, path string, handlers ...gin.HandlerFunc) {
+	g.GET(path, handlers...)
+	g.HEAD(path, handlers...)
+}
+
+// deprecatedAlias marks responses of routes served without a version prefix as deprecated with a
+// Deprecation header. No successor Link is added, as the Link header is used for pagination.
+func deprecatedAlias(c *gin.Context) {
+	c.Header("Deprecation", "true")
+	c.Next()
+}
+
+// apiPrefix returns the version prefix of path, e.g. "/v1" for "/v1/albums", or "" if it has none.
+func apiPrefix(path string) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if len(segment) < 2 || segment[0] != 'v' || strings.Trim(segment[1:], "0123456789") != "" {
+		return ""
+	}
+	return "/" + segment
+}
+
+// unversionedPath returns path without its version prefix, e.g. "/albums" for "/v1/albums".
+func unversionedPath(path string) string {
+	return strings.TrimPrefix(path, apiPrefix(path))
+}
+
+// requestAPIPrefix returns the version prefix of the route c was served by, so that URLs in its
+// response stay within the same version of the API.
+func requestAPIPrefix(c *gin.Context) string {
+	if c.FullPath() != "" {
+		return apiPrefix(c.FullPath())
+	}
+	return apiPrefix(c.Request.URL.Path)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestAPIVersions tests the /v1 routes and their deprecated unversioned alias.
+// Verifies that both serve the same albums, that only the alias is marked deprecated, and that
+// unversioned endpoints such as the health check are not.
+func TestAPIVersions(t *testing.T) {
+	srv := newTestServer(t)
+
+	v1, alias := srv.do("GET", "/v1/albums", ""), srv.do("GET", "/albums", "")
+	var v1Albums, aliasAlbums []Album
+	json.Unmarshal(v1.Body.Bytes(), &v1Albums)
+	json.Unmarshal(alias.Body.Bytes(), &aliasAlbums)
+	if v1.Code != 200 || !reflect.DeepEqual(v1Albums, aliasAlbums) || len(v1Albums) != 3 {
+		t.Errorf("Expected /v1/albums to match /albums, got %d: %s", v1.Code, v1.Body)
+	}
+	if v1.Header().Get("Deprecation") != "" || alias.Header().Get("Deprecation") != "true" {
+		t.Errorf("Expected only the alias to be deprecated, got %q and %q", v1.Header().Get("Deprecation"), alias.Header().Get("Deprecation"))
+	}
+	if w := srv.do("GET", "/v1/albums/550e8400-e29b-41d4-a716-446655440002", ""); w.Code != 200 {
+		t.Errorf("Expected 200 for an album under /v1, got %d", w.Code)
+	}
+	if w := srv.do("GET", "/", ""); w.Header().Get("Deprecation") != "" {
+		t.Error("Expected the health check not to be deprecated")
+	}
+	if w := srv.do("GET", "/v2/albums", ""); w.Code != 404 {
+		t.Errorf("Expected 404 for an unknown version, got %d", w.Code)
+	}
+}
+
+// TestAPIVersionURLs tests that URLs in responses stay within the version of the request.
+// Verifies that an async export under /v1 points to its job under /v1, and that batch operations
+// on /v1 paths are recognized.
+func TestAPIVersionURLs(t *testing.T) {
+	srv := newTestServer(t)
+	w := srv.do("GET", "/v1/albums/export?format=ndjson&async=true", "")
+	if w.Code != 202 || w.Header().Get("Location")[:9] != "/v1/jobs/" {
+		t.Errorf("Expected a job under /v1, got %d with Location %q", w.Code, w.Header().Get("Location"))
+	}
+
+	body := `{"atomic": true, "operations": [{"method": "DELETE", "path": "/v1/albums/550e8400-e29b-41d4-a716-446655440001"}, {"method": "POST", "path": "/v1/batch"}]}`
+	w = srv.do("POST", "/v1/batch", body)
+	if w.Code != 400 || !bytes.Contains(w.Body.Bytes(), []byte("operation 1: batches cannot be nested")) {
+		t.Errorf("Expected a nested /v1 batch to be rejected, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Write-ahead log operations.
+const (
+	walPut          = "put"
+	walDelete       = "delete"
+	walArtistPut    = "artist_put"
+	walArtistDelete = "artist_delete"
+)
+
+// walRecord is one line of the write-ahead log: an album written by a create or update, the ID of
+// a deleted album, an artist written, or the ID of a deleted artist.
+type walRecord struct {
+	Seq    uint64  `json:"seq"`
+	Op     string  `json:"op"`
+	ID     string  `json:"id"`
+	Album  *Album  `json:"album,omitempty"`
+	Artist *Artist `json:"artist,omitempty"`
+}
+
+// albumRecord returns the record of op, walPut or walDelete, on album a.
+func albumRecord(op string, a Album) walRecord {
+	rec := walRecord{Op: op, ID: a.ID}
+	if op == walPut {
+		rec.Album = &a
+	}
+	return rec
+}
+
+// artistRecord returns the record of op, walArtistPut or walArtistDelete, on artist.
+func artistRecord(op string, artist Artist) walRecord {
+	rec := walRecord{Op: op, ID: artist.ID}
+	if op == walArtistPut {
+		rec.Artist = &artist
+	}
+	return rec
+}
+
+// albumWAL is an append-only log of memory store changes, one JSON record per line. Every change
+// is appended (and, with sync, flushed to disk) before the store applies it, so replaying the log
+// rebuilds the store after a restart or crash. Compaction replaces the log with one put per artist and album.
+// It is only used with the memory store's lock held.
+type albumWAL struct {
+	path string
+	file *os.File
+	sync bool
+
+	// seq is the sequence number of the last record written, and size the length of the log in bytes.
+	seq  uint64
+	size int64
+	// records is the number of records in the log; compactAfter is the count that triggers compaction.
+	records      int
+	compactAfter int
+	lastCompact  time.Time
+	// group, if set, syncs the log for batches of changes instead of in append (see awaitLog).
+	group *groupCommitter[struct{}]
+}
+
+// openWAL opens the log at path, creating it if needed, and returns the records it holds.
+// A partially written last record, left by a crash mid-append, is discarded.
+func openWAL(path string, sync bool, compactAfter int) (*albumWAL, []walRecord, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, end, err := readWAL(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if err := file.Truncate(end); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	w := &albumWAL{path: path, file: file, sync: sync, size: end, records: len(records), compactAfter: compactAfter}
+	if len(records) > 0 {
+		w.seq = records[len(records)-1].Seq
+	}
+	return w, records, nil
+}
+
+// readWAL decodes the records in r and returns the offset just past the last complete record.
+// Only the final line may be incomplete or malformed; anything earlier is reported as corruption.
+func readWAL(r io.Reader) ([]walRecord, int64, error) {
+	var (
+		records []walRecord
+		end     int64
+	)
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A record without its newline was cut off mid-write.
+			return records, end, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		var rec walRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+				return records, end, nil
+			}
+			return nil, 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, rec)
+		end += int64(len(data))
+	}
+}
+
+// write appends records to the log in one write, numbering them, and, if sync is enabled without
+// group commit, waits for them to reach the disk. If that fails, none of them is kept.
+func (w *albumWAL) write(records ...walRecord) error {
+	var buf bytes.Buffer
+	seq := w.seq
+	for _, rec := range records {
+		seq++
+		rec.Seq = seq
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		w.rollback()
+		return fmt.Errorf("write-ahead log: %w", err)
+	}
+	if w.sync && w.group == nil {
+		if err := w.file.Sync(); err != nil {
+			w.rollback()
+			return fmt.Errorf("write-ahead log: %w", err)
+		}
+	}
+	w.seq = seq
+	w.size += int64(buf.Len())
+	w.records += len(records)
+	return nil
+}
+
+// rollback discards whatever part of a failed append reached the file, so the next record
+// does not follow a torn one.
+func (w *albumWAL) rollback() {
+	if err := w.file.Truncate(w.size); err == nil {
+		w.file.Seek(w.size, io.SeekStart)
+	}
+}
+
+// compact replaces the log with one put record per artist in artists and per album in albums.
+// The new log is written to a temporary file and renamed into place, so a crash during compaction
+// leaves the old log intact.
+func (w *albumWAL) compact(albums []Album, artists []Artist) error {
+	records := make([]walRecord, 0, len(artists)+len(albums))
+	for _, artist := range artists {
+		records = append(records, artistRecord(walArtistPut, artist))
+	}
+	for _, a := range albums {
+		records = append(records, albumRecord(walPut, a))
+	}
+	var buf bytes.Buffer
+	seq := w.seq
+	for _, rec := range records {
+		seq++
+		rec.Seq = seq
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	w.file.Close()
+	w.file = tmp
+	w.seq = seq
+	w.size = int64(buf.Len())
+	w.records = len(records)
+	w.lastCompact = time.Now().UTC()
+	return nil
+}
+
+// needsCompaction reports whether the log has grown past its compaction threshold.
+func (w *albumWAL) needsCompaction() bool {
+	return w.compactAfter > 0 && w.records >= w.compactAfter
+}
+
+// openWALStore rebuilds a memory store by replaying the log at cfg.WALPath, or starts from the seed
+// albums if the log is empty, then compacts the log and attaches it so every later change is logged.
+// With cfg.WALSync and group commit enabled, concurrent changes share one sync.
+func openWALStore(cfg Config) (*memoryStore, error) {
+	wal, records, err := openWAL(cfg.WALPath, cfg.WALSync, cfg.WALCompactAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	var s *memoryStore
+	if len(records) == 0 {
+		s = newMemoryStore(seedAlbums())
+	} else {
+		s = newMemoryStore(nil)
+		for _, rec := range records {
+			switch {
+			case rec.Op == walPut && rec.Album != nil:
+				if e, ok := s.albums[rec.ID]; ok {
+					s.unindexUPC(e.Album)
+					s.unindexName(e.Album)
+					s.albums[rec.ID] = memoryEntry{Album: *rec.Album, seq: e.seq}
+					s.indexUPC(*rec.Album)
+					s.indexName(*rec.Album)
+				} else {
+					s.add(*rec.Album)
+				}
+			case rec.Op == walDelete:
+				if e, ok := s.albums[rec.ID]; ok {
+					delete(s.albums, rec.ID)
+					s.unindexUPC(e.Album)
+					s.unindexName(e.Album)
+				}
+			case rec.Op == walArtistPut && rec.Artist != nil:
+				s.artists.put(*rec.Artist)
+			case rec.Op == walArtistDelete:
+				s.artists.remove(rec.ID)
+			default:
+				wal.file.Close()
+				return nil, fmt.Errorf("replay %s: record %d has unknown op %q", cfg.WALPath, rec.Seq, rec.Op)
+			}
+		}
+		log.Printf("Replayed %d write-ahead log records from %s (%d albums)", len(records), cfg.WALPath, len(s.albums))
+	}
+
+	albums, _ := s.List(context.Background())
+	artists, _ := s.ListArtists(context.Background())
+	if err := wal.compact(albums, artists); err != nil {
+		wal.file.Close()
+		return nil, fmt.Errorf("compact %s: %w", cfg.WALPath, err)
+	}
+	s.wal = wal
+	if cfg.WALSync {
+		wal.group = newGroupCommitter(cfg, func(changes []struct{}) []error {
+			s.mu.RLock()
+			err := wal.file.Sync()
+			s.mu.RUnlock()
+			if err != nil {
+				err = fmt.Errorf("write-ahead log: %w", err)
+			}
+			errs := make([]error, len(changes))
+			for i := range errs {
+				errs[i] = err
+			}
+			return errs
+		})
+	}
+	return s, nil
+}
+
+// getWAL handles GET /admin/wal requests.
+// Returns the write-ahead log's path, record count, last sequence number, size, last compaction
+// time, and group commit counts if enabled as JSON with HTTP 200 status. Returns HTTP 404 if the write-ahead log is not enabled.
+func (srv *Server) getWAL(c *gin.Context) {
+	s, ok := srv.memoryStore()
+	if !ok || s.wal == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "write-ahead log is not enabled"})
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status := gin.H{
+		"path":          s.wal.path,
+		"records":       s.wal.records,
+		"seq":           s.wal.seq,
+		"bytes":         s.wal.size,
+		"compact_after": s.wal.compactAfter,
+		"sync":          s.wal.sync,
+		"last_compact":  s.wal.lastCompact.Format(time.RFC3339),
+	}
+	if s.wal.group != nil {
+		status["group_commit"] = s.wal.group.stats()
+	}
+	c.IndentedJSON(http.StatusOK, status)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openTestWALStore opens a write-ahead logged memory store at path, failing the test on error.
+func openTestWALStore(t *testing.T, path string, compactAfter int) *memoryStore {
+	t.Helper()
+	cfg := loadConfig()
+	cfg.WALPath = path
+	cfg.WALSync = true
+	cfg.WALCompactAfter = compactAfter
+	s, err := openWALStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.wal.file.Close() })
+	return s
+}
+
+// TestWALReplay tests that changes logged by one store are replayed by the next.
+// Verifies that a new log starts from the seed albums, and that creates, updates, deletes, order,
+// and the UPC index survive a restart.
+func TestWALReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "albums.wal")
+
+	s := openTestWALStore(t, path, 0)
+	if all, _ := s.List(ctx); len(all) != 3 {
+		t.Fatalf("Expected the 3 seed albums, got %d", len(all))
+	}
+	s.Create(ctx, Album{ID: "a", Title: "Kind of Blue", Artist: "Miles Davis", Price: 49.99, UPC: "074646593622"})
+	s.Update(ctx, "550e8400-e29b-41d4-a716-446655440001", func(a *Album) error { a.Price = 1; return nil })
+	s.Delete(ctx, "550e8400-e29b-41d4-a716-446655440002")
+	s.wal.file.Close()
+
+	restored := openTestWALStore(t, path, 0)
+	all, _ := restored.List(ctx)
+	var ids []string
+	for _, a := range all {
+		ids = append(ids, a.ID)
+	}
+	if got := strings.Join(ids, ","); got != "550e8400-e29b-41d4-a716-446655440001,550e8400-e29b-41d4-a716-446655440003,a" {
+		t.Errorf("Expected the logged albums in order, got %s", got)
+	}
+	if all[0].Price != 1 {
+		t.Errorf("Expected the update to be replayed, got %+v", all[0])
+	}
+	if a, err := restored.GetByUPC(ctx, "0074646593622"); err != nil || a.ID != "a" {
+		t.Errorf("Expected the UPC index to be rebuilt, got %+v, %v", a, err)
+	}
+}
+
+// TestWALTornRecord tests recovery from a crash in the middle of an append.
+// Verifies that a partial last record is discarded and the log stays appendable, and that
+// corruption before the last record is reported.
+func TestWALTornRecord(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "albums.wal")
+	s := openTestWALStore(t, path, 0)
+	s.Create(ctx, Album{ID: "a", Title: "Kind of Blue", Artist: "Miles Davis", Price: 49.99})
+	s.wal.file.Close()
+
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"seq":99,"op":"put","id":"b","album":{"id":"b","ti`)
+	f.Close()
+
+	restored := openTestWALStore(t, path, 0)
+	if all, _ := restored.List(ctx); len(all) != 4 {
+		t.Errorf("Expected 4 albums without the torn record, got %d", len(all))
+	}
+	restored.Create(ctx, Album{ID: "c", Title: "Jeru", Artist: "Gerry Mulligan", Price: 17.99})
+	restored.wal.file.Close()
+	if again := openTestWALStore(t, path, 0); len(again.albums) != 5 {
+		t.Errorf("Expected 5 albums after appending past the torn record, got %d", len(again.albums))
+	}
+
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, append([]byte("garbage\n"), data...), 0o644)
+	cfg := loadConfig()
+	cfg.WALPath = path
+	if _, err := openWALStore(cfg); err == nil {
+		t.Error("Expected an error for a corrupt record before the end of the log")
+	}
+}
+
+// TestWALCompaction tests that the log is compacted once it reaches its threshold.
+// Verifies that the compacted log holds one record per album and replays to the same state.
+func TestWALCompaction(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "albums.wal")
+	s := openTestWALStore(t, path, 10)
+
+	for i := range 25 {
+		s.Update(ctx, "550e8400-e29b-41d4-a716-446655440001", func(a *Album) error { a.Price = float64(i + 1); return nil })
+	}
+	if s.wal.records >= 10 {
+		t.Errorf("Expected the log to be compacted below 10 records, got %d", s.wal.records)
+	}
+	s.wal.file.Close()
+
+	restored := openTestWALStore(t, path, 10)
+	if a, _ := restored.Get(ctx, "550e8400-e29b-41d4-a716-446655440001"); a.Price != 25 {
+		t.Errorf("Expected price 25 after replaying the compacted log, got %v", a.Price)
+	}
+	if restored.wal.records != 3 {
+		t.Errorf("Expected 3 records after compaction on startup, got %d", restored.wal.records)
+	}
+}
+
+// TestWALWriteFailure tests that a change is rejected when it cannot be logged.
+func TestWALWriteFailure(t *testing.T) {
+	ctx := context.Background()
+	s := openTestWALStore(t, filepath.Join(t.TempDir(), "albums.wal"), 0)
+	s.wal.file.Close()
+
+	if _, err := s.Create(ctx, Album{ID: "a", Title: "Kind of Blue", Artist: "Miles Davis", Price: 49.99}); err == nil {
+		t.Error("Expected an error when the log cannot be written")
+	}
+	if _, err := s.Get(ctx, "a"); err == nil {
+		t.Error("Expected the unlogged album not to be stored")
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gin-gonic/gin"
+)
+
+// gcsEndpoint is the S3-compatible XML API of Google Cloud Storage, which gs:// snapshot URLs are
+// downloaded through with HMAC keys.
+const gcsEndpoint = "https://storage.googleapis.com"
+
+const (
+	// readinessTimeout bounds how long GET /readyz waits for the backend store.
+	readinessTimeout = 2 * time.Second
+	// readinessProbeID is the album ID GET /readyz reads from the backend store. No album has it,
+	// so a store that is up answers errAlbumNotFound.
+	readinessProbeID = "readyz-probe"
+)
+
+// errNoRemoteSnapshot is returned by fetchRemoteSnapshot when there is no snapshot under the
+// SNAPSHOT_URL prefix yet.
+var errNoRemoteSnapshot = errors.New("no snapshot found")
+
+// snapshotLocation is where SNAPSHOT_URL points: an object, or, if key is empty or ends with a
+// slash, the latest snapshot under that prefix, in bucket at endpoint ("" for AWS).
+type snapshotLocation struct {
+	scheme   string
+	bucket   string
+	key      string
+	endpoint string
+	region   string
+}
+
+// parseSnapshotURL parses SNAPSHOT_URL, s3://bucket/key or gs://bucket/key, with endpoint, the
+// S3-compatible service to use instead of the URL's default, if set.
+func parseSnapshotURL(raw, endpoint string) (snapshotLocation, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return snapshotLocation{}, fmt.Errorf("SNAPSHOT_URL must be s3://bucket/key or gs://bucket/key, got %q", raw)
+	}
+	loc := snapshotLocation{scheme: u.Scheme, bucket: u.Host, key: strings.TrimPrefix(u.Path, "/"), endpoint: endpoint}
+	switch u.Scheme {
+	case "s3":
+	case "gs":
+		if loc.endpoint == "" {
+			loc.endpoint = gcsEndpoint
+		}
+		loc.region = "auto"
+	default:
+		return snapshotLocation{}, fmt.Errorf("SNAPSHOT_URL must be s3://bucket/key or gs://bucket/key, got %q", raw)
+	}
+	return loc, nil
+}
+
+// url returns the URL of the object key in loc's bucket.
+func (loc snapshotLocation) url(key string) string {
+	return loc.scheme + "://" + loc.bucket + "/" + key
+}
+
+// latest reports whether loc names a prefix to take the latest snapshot from rather than an object.
+func (loc snapshotLocation) latest() bool {
+	return loc.key == "" || strings.HasSuffix(loc.key, "/")
+}
+
+// newSnapshotClient creates the S3 client for loc. Credentials and, for s3:// URLs, the region
+// come from the AWS SDK defaults; a custom endpoint is addressed path-style.
+func newSnapshotClient(ctx context.Context, loc snapshotLocation) (*s3.Client, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if loc.region != "" {
+		opts = append(opts, awsconfig.WithRegion(loc.region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if loc.endpoint != "" {
+			o.BaseEndpoint = aws.String(loc.endpoint)
+			o.UsePathStyle = true
+		}
+	}), nil
+}
+
+// fetchRemoteSnapshot downloads the snapshot SNAPSHOT_URL points to, in any format SNAPSHOT_PATH
+// reads, and returns it and the s3:// or gs:// URL of the object downloaded. For a prefix,
+// that is the .json object under it modified last, skipping incremental backups, so full backups
+// can be uploaded there too; errNoRemoteSnapshot is returned if there is none.
+func fetchRemoteSnapshot(ctx context.Context, cfg Config) (albumSnapshot, string, error) {
+	loc, err := parseSnapshotURL(cfg.SnapshotURL, cfg.SnapshotURLEndpoint)
+	if err != nil {
+		return albumSnapshot{}, "", err
+	}
+	client, err := newSnapshotClient(ctx, loc)
+	if err != nil {
+		return albumSnapshot{}, "", err
+	}
+	key := loc.key
+	if loc.latest() {
+		if key, err = latestSnapshotKey(ctx, client, loc); err != nil {
+			return albumSnapshot{}, "", err
+		}
+	}
+	source := loc.url(key)
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(loc.bucket), Key: aws.String(key)})
+	if err != nil {
+		return albumSnapshot{}, source, fmt.Errorf("download %s: %w", source, err)
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return albumSnapshot{}, source, fmt.Errorf("download %s: %w", source, err)
+	}
+	snap, err := decodeSnapshot(data)
+	if err != nil {
+		return albumSnapshot{}, source, fmt.Errorf("parse %s: %w", source, err)
+	}
+	return snap, source, nil
+}
+
+// latestSnapshotKey returns the key of the .json object under loc's prefix modified last, other
+// than incremental backups (incr-*.json), or errNoRemoteSnapshot if there is none.
+func latestSnapshotKey(ctx context.Context, client *s3.Client, loc snapshotLocation) (string, error) {
+	var latest *s3types.Object
+	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(loc.bucket), Prefix: aws.String(loc.key)})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("list %s: %w", loc.url(loc.key), err)
+		}
+		for _, obj := range page.Contents {
+			name := path.Base(aws.ToString(obj.Key))
+			if !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, "incr-") {
+				continue
+			}
+			if latest == nil || aws.ToTime(obj.LastModified).After(aws.ToTime(latest.LastModified)) {
+				latest = &obj
+			}
+		}
+	}
+	if latest == nil {
+		return "", fmt.Errorf("%w under %s", errNoRemoteSnapshot, loc.url(loc.key))
+	}
+	return aws.ToString(latest.Key), nil
+}
+
+// openRemoteSnapshotStore creates a memory store from the snapshot SNAPSHOT_URL points to, or from
+// the seed albums if it names a prefix with no snapshot under it yet. The download is abandoned
+// after WARMUP_TIMEOUT.
+func openRemoteSnapshotStore(cfg Config) (*memoryStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.WarmupTimeout)
+	defer cancel()
+	snap, source, err := fetchRemoteSnapshot(ctx, cfg)
+	if errors.Is(err, errNoRemoteSnapshot) {
+		log.Printf("Starting with the seed albums: %v", err)
+		return newMemoryStore(seedAlbums()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d albums from remote snapshot %s", len(snap.Albums), source)
+	return newSnapshotMemoryStore(snap), nil
+}
+
+// warmupHandler answers requests while the server is starting: GET / with HTTP 200, so liveness
+// checks pass, and everything else, /readyz included, with HTTP 503, so no traffic is sent to
+// the instance until its store is loaded.
+func warmupHandler() http.Handler {
+	respond := func(w http.ResponseWriter, status int) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "5")
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"status": "starting"})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusServiceUnavailable)
+	})
+	return mux
+}
+
+// serveWarmingUp serves warmupHandler on ln until the returned function is called. ln should be
+// shared with the server (see portListener), which should be serving before the warm-up stops,
+// so that no connection is refused in between.
+func serveWarmingUp(ln net.Listener) (stop func()) {
+	server := &http.Server{Handler: warmupHandler()}
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("warm-up listener: %v", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+	}
+}
+
+// accepted is a connection, or the error, that a portListener accepted.
+type accepted struct {
+	conn net.Conn
+	err  error
+}
+
+// portListener accepts the connections on the server's port for the servers that take turns
+// serving it, the warm-up server and then the server itself. Each accepts through a listener of
+// its own (see share), and closing that one stops the server accepting without closing the port,
+// so no connection is refused while the port changes hands.
+type portListener struct {
+	net.Listener
+	conns  chan accepted
+	closed chan struct{}
+	once   sync.Once
+}
+
+// newPortListener starts accepting connections on ln until the returned listener is closed.
+func newPortListener(ln net.Listener) *portListener {
+	p := &portListener{Listener: ln, conns: make(chan accepted), closed: make(chan struct{})}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			select {
+			case p.conns <- accepted{conn, err}:
+			case <-p.closed:
+				if conn != nil {
+					conn.Close()
+				}
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// share returns a listener accepting the port's connections until it is closed. Connections go
+// to whichever open shared listener accepts first.
+func (p *portListener) share() net.Listener {
+	return &sharedListener{port: p, closed: make(chan struct{})}
+}
+
+// Close stops accepting connections on the port and closes it.
+func (p *portListener) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return p.Listener.Close()
+}
+
+// sharedListener is a listener for one of the servers taking turns on a portListener's port.
+type sharedListener struct {
+	port   *portListener
+	closed chan struct{}
+	once   sync.Once
+}
+
+// Accept waits for the next connection on the port, or for the listener or port to be closed.
+func (l *sharedListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.closed:
+		return nil, net.ErrClosed
+	default:
+	}
+	select {
+	case a := <-l.port.conns:
+		return a.conn, a.err
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-l.port.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the listener accepting connections, leaving the port open.
+func (l *sharedListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+// Addr returns the port's address.
+func (l *sharedListener) Addr() net.Addr {
+	return l.port.Addr()
+}
+
+// readinessCheck handles GET /readyz requests.
+// Returns HTTP 200 if the backend store answers a read within readinessTimeout, or HTTP 503 with
+// the error if it does not, so that no traffic is sent to an instance whose store is down. With
+// SNAPSHOT_URL set, the warm-up server answers HTTP 503 instead until the remote snapshot has been
+// loaded (see serveWarmingUp).
+func (srv *Server) readinessCheck(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+	if _, err := srv.backend.Get(ctx, readinessProbeID); err != nil && !errors.Is(err, errAlbumNotFound) {
+		c.Header("Retry-After", "5")
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"status": "ready"})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 serves objects, by key, from the bucket "albums" of an S3-compatible service, answering
+// ListObjectsV2 and GetObject requests as S3 does, path-style.
+func fakeS3(t *testing.T, objects map[string]string, modified map[string]time.Time) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, isObject := strings.CutPrefix(r.URL.Path, "/albums/")
+		if r.URL.Path == "/albums" || r.URL.Path == "/albums/" {
+			prefix := r.URL.Query().Get("prefix")
+			var contents strings.Builder
+			for k, body := range objects {
+				if strings.HasPrefix(k, prefix) {
+					fmt.Fprintf(&contents, "<Contents><Key>%s</Key><LastModified>%s</LastModified><Size>%d</Size></Contents>",
+						k, modified[k].UTC().Format("2006-01-02T15:04:05.000Z"), len(body))
+				}
+			}
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>albums</Name><Prefix>%s</Prefix><IsTruncated>false</IsTruncated>%s</ListBucketResult>`,
+				prefix, contents.String())
+			return
+		}
+		if body, ok := objects[key]; isObject && ok {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, body)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	return server
+}
+
+// TestRemoteSnapshotWarmup tests loading the memory store from SNAPSHOT_URL at startup.
+// Verifies that a prefix loads the snapshot modified last, skipping incremental backups, that an
+// object is loaded by its key, that an empty prefix starts with the seed albums while a missing
+// object fails, that a local snapshot takes precedence, and that /readyz is only healthy once the
+// server is serving.
+func TestRemoteSnapshotWarmup(t *testing.T) {
+	snapshot := func(titles ...string) string {
+		var albums []Album
+		for i, title := range titles {
+			albums = append(albums, Album{ID: fmt.Sprintf("a%d", i), Title: title, Artist: "Someone", Price: 9.99})
+		}
+		data, _ := json.Marshal(albumSnapshot{Version: snapshotVersion, Albums: albums})
+		return string(data)
+	}
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	service := fakeS3(t, map[string]string{
+		"snapshots/old.json":                     snapshot("Old"),
+		"snapshots/full-20240102T000000.json":    snapshot("Latest", "Backup"),
+		"snapshots/incr-20240102T000000-01.json": `{"version": 1, "changes": []}`,
+		"snapshots/notes.txt":                    "not a snapshot",
+	}, map[string]time.Time{
+		"snapshots/old.json":                     day,
+		"snapshots/full-20240102T000000.json":    day.AddDate(0, 0, 1),
+		"snapshots/incr-20240102T000000-01.json": day.AddDate(0, 0, 2),
+		"snapshots/notes.txt":                    day.AddDate(0, 0, 3),
+	})
+	titles := func(url string, configure func(*Config)) ([]string, error) {
+		cfg := Config{Storage: "memory", SnapshotURL: url, SnapshotURLEndpoint: service.URL, WarmupTimeout: 10 * time.Second}
+		if configure != nil {
+			configure(&cfg)
+		}
+		store, err := newAlbumStore(cfg)
+		if err != nil {
+			return nil, err
+		}
+		albums, _ := store.List(t.Context())
+		var got []string
+		for _, a := range albums {
+			got = append(got, a.Title)
+		}
+		return got, nil
+	}
+
+	for _, tc := range []struct {
+		url  string
+		want string
+	}{
+		{"s3://albums/snapshots/", "Latest,Backup"},
+		{"s3://albums/snapshots/old.json", "Old"},
+		{"s3://albums/empty/", "Blue Train,Jeru,Sarah Vaughan and Clifford Brown"},
+	} {
+		got, err := titles(tc.url, nil)
+		if err != nil || strings.Join(got, ",") != tc.want {
+			t.Errorf("%s: expected %s, got %v (%v)", tc.url, tc.want, got, err)
+		}
+	}
+	if _, err := titles("s3://albums/snapshots/missing.json", nil); err == nil {
+		t.Error("Expected a missing snapshot object to fail")
+	}
+	if _, err := titles("http://albums/snapshots/", nil); err == nil {
+		t.Error("Expected an unsupported SNAPSHOT_URL scheme to fail")
+	}
+
+	local := filepath.Join(t.TempDir(), "albums.json")
+	os.WriteFile(local, []byte(snapshot("Local")), 0o644)
+	got, err := titles("s3://albums/snapshots/", func(cfg *Config) { cfg.SnapshotPath = local })
+	if err != nil || strings.Join(got, ",") != "Local" {
+		t.Errorf("Expected the local snapshot to take precedence, got %v (%v)", got, err)
+	}
+	got, err = titles("s3://albums/snapshots/", func(cfg *Config) { cfg.SnapshotPath = filepath.Join(t.TempDir(), "new.json") })
+	if err != nil || strings.Join(got, ",") != "Latest,Backup" {
+		t.Errorf("Expected the remote snapshot without a local one, got %v (%v)", got, err)
+	}
+
+	// While warming up, the instance is alive but not ready; once serving, it is ready.
+	warmup := warmupHandler()
+	for path, code := range map[string]int{"/": http.StatusOK, "/readyz": http.StatusServiceUnavailable, "/albums": http.StatusServiceUnavailable} {
+		w := httptest.NewRecorder()
+		warmup.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != code {
+			t.Errorf("GET %s while warming up: expected %d, got %d", path, code, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	newTestServer(t).router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected /readyz to be healthy once serving, got %d", w.Code)
+	}
+}
+
+// TestWarmupHandover tests handing the port over from the warm-up server to the server.
+// Verifies that requests get the warm-up server's 503 before the handover and the server's
+// response after it, and that no connection is refused while the port changes hands.
+func TestWarmupHandover(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := newPortListener(ln)
+	defer port.Close()
+	stopWarmup := serveWarmingUp(port.share())
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func() (int, error) {
+		resp, err := client.Get("http://" + ln.Addr().String() + "/readyz")
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	if code, err := get(); err != nil || code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 while warming up, got %d (%v)", code, err)
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for range 4 {
+		wg.Go(func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := get(); err != nil {
+					t.Errorf("Request failed during the handover: %v", err)
+					return
+				}
+			}
+		})
+	}
+	server := &http.Server{Handler: newTestServer(t).router}
+	go server.Serve(port.share())
+	defer server.Close()
+	stopWarmup()
+	close(done)
+	wg.Wait()
+
+	if code, err := get(); err != nil || code != http.StatusOK {
+		t.Errorf("Expected 200 once serving, got %d (%v)", code, err)
+	}
+}
+
+// TestReadinessCheck tests that GET /readyz reports whether the backend store is available.
+// Verifies HTTP 503 with the error while the store fails, and HTTP 200 once it recovers.
+func TestReadinessCheck(t *testing.T) {
+	store := &outageStore{memoryStore: newMemoryStore(seedAlbums())}
+	srv := newTestServerWith(t, store)
+
+	store.down.Store(true)
+	w := srv.do("GET", "/readyz", "")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "connection refused") {
+		t.Errorf("Expected 503 with the store's error, got %d: %s", w.Code, w.Body)
+	}
+	store.down.Store(false)
+	if w := srv.do("GET", "/readyz", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 once the store recovers, got %d: %s", w.Code, w.Body)
+	}
+}
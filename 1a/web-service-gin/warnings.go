@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Codes of the validation warnings.
+const (
+	warnPriceHigh    = "price_high"
+	warnTitleAllCaps = "title_all_caps"
+)
+
+// minAllCapsLetters is the fewest letters a title must have to be flagged as all caps, so
+// acronyms such as "XTC" are not.
+const minAllCapsLetters = 4
+
+// validationWarning is something unusual about an album that does not make it invalid, reported
+// in the warnings of the response to the request that wrote it. Warnings whose code is listed in
+// VALIDATION_STRICT are errors instead (see checkWarnings).
+type validationWarning struct {
+	Code    string `json:"code"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// warningsKey is the gin context key holding the warnings for the album in the response.
+type warningsKey struct{}
+
+// albumWarnings returns the validation warnings for a: a price above VALIDATION_WARN_PRICE_ABOVE,
+// and a title written all in capitals.
+func (srv *Server) albumWarnings(a Album) []validationWarning {
+	var warnings []validationWarning
+	if limit := srv.cfg.WarnPriceAbove; limit > 0 && a.Price > limit {
+		warnings = append(warnings, validationWarning{
+			Code:    warnPriceHigh,
+			Field:   "price",
+			Message: fmt.Sprintf("Price is unusually high (above %g)", limit),
+		})
+	}
+	if allCaps(a.Title) {
+		warnings = append(warnings, validationWarning{
+			Code:    warnTitleAllCaps,
+			Field:   "title",
+			Message: "Title is all capitals",
+		})
+	}
+	return warnings
+}
+
+// allCaps reports whether s has at least minAllCapsLetters letters and no lowercase ones.
+func allCaps(s string) bool {
+	letters := 0
+	for _, r := range s {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	return letters >= minAllCapsLetters
+}
+
+// strictWarning reports whether warnings with code are errors, as listed in VALIDATION_STRICT
+// ("all" makes every warning one).
+func (srv *Server) strictWarning(code string) bool {
+	return slices.Contains(srv.cfg.ValidationStrict, "all") || slices.Contains(srv.cfg.ValidationStrict, code)
+}
+
+// checkWarnings returns the warnings for a that previous, the album before the change, did not
+// already have; previous is nil for a new album. Returns a validationError instead if any of them
+// is an error under VALIDATION_STRICT, so warnings on an existing album never block unrelated
+// changes.
+func (srv *Server) checkWarnings(a Album, previous *Album) ([]validationWarning, error) {
+	warnings := srv.albumWarnings(a)
+	if previous != nil {
+		had := srv.albumWarnings(*previous)
+		warnings = slices.DeleteFunc(warnings, func(w validationWarning) bool {
+			return slices.ContainsFunc(had, func(h validationWarning) bool { return h.Code == w.Code })
+		})
+	}
+	var errs []string
+	for _, w := range warnings {
+		if srv.strictWarning(w.Code) {
+			errs = append(errs, w.Message)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, validationError(strings.Join(errs, "; "))
+	}
+	return warnings, nil
+}
+
+// setWarnings makes warnings part of the album rendered in the response to c (see renderAlbum).
+func setWarnings(c *gin.Context, warnings []validationWarning) {
+	if len(warnings) > 0 {
+		c.Set(warningsKey{}, warnings)
+	}
+}
+
+// warnedAlbum is an album with links sent with the warnings of the request that wrote it.
+type warnedAlbum struct {
+	linkedAlbum
+	Warnings []validationWarning `json:"warnings"`
+}
+
+// withWarnings returns album, as returned by transformAlbum, with the warnings set for the response
+// to c, if any.
+func withWarnings(c *gin.Context, album any) any {
+	value, ok := c.Get(warningsKey{})
+	if !ok {
+		return album
+	}
+	warnings := value.([]validationWarning)
+	switch a := album.(type) {
+	case map[string]any:
+		a["warnings"] = warnings
+	case linkedAlbum:
+		return warnedAlbum{linkedAlbum: a, Warnings: warnings}
+	}
+	return album
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestValidationWarnings tests reporting unusual album values as warnings.
+// Verifies that creating or updating an album with a high price or an all-caps title succeeds with
+// warnings, that updates only report the warnings they introduce, and that VALIDATION_STRICT turns
+// the listed warnings into errors.
+func TestValidationWarnings(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.WarnPriceAbove = 100 })
+	codes := func(w *httptest.ResponseRecorder) []string {
+		var resp struct{ Warnings []validationWarning }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		var codes []string
+		for _, warning := range resp.Warnings {
+			codes = append(codes, warning.Code)
+		}
+		return codes
+	}
+
+	w := srv.do("POST", "/albums", `{"title": "KIND OF BLUE", "artist": "Miles Davis", "price": 499}`)
+	if got := codes(w); w.Code != 201 || len(got) != 2 || got[0] != warnPriceHigh || got[1] != warnTitleAllCaps {
+		t.Errorf("Expected the album created with both warnings, got %d: %s", w.Code, w.Body)
+	}
+	var created Album
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	if w := srv.do("PATCH", "/albums/"+created.ID, `{"price": 599}`, "If-Match", "*"); w.Code != 200 || len(codes(w)) != 0 {
+		t.Errorf("Expected no warnings for an update introducing none, got %d: %s", w.Code, w.Body)
+	}
+	if got := codes(srv.do("PATCH", "/albums/550e8400-e29b-41d4-a716-446655440002", `{"title": "JERU"}`, "If-Match", "*")); len(got) != 1 || got[0] != warnTitleAllCaps {
+		t.Errorf("Expected the all-caps title warned about, got %v", got)
+	}
+	if w := srv.do("GET", "/albums/"+created.ID, ""); strings.Contains(w.Body.String(), "warnings") {
+		t.Errorf("Expected reads without warnings, got %s", w.Body)
+	}
+	w = srv.do("POST", "/albums/batch", `[{"title": "GIANT STEPS", "artist": "John Coltrane", "price": 9.99}]`)
+	if w.Code != 201 || !strings.Contains(w.Body.String(), warnTitleAllCaps) {
+		t.Errorf("Expected the batch result to carry the warning, got %d: %s", w.Code, w.Body)
+	}
+
+	strict := newTestServer(t, func(cfg *Config) {
+		cfg.WarnPriceAbove = 100
+		cfg.ValidationStrict = []string{warnPriceHigh}
+	})
+	if w := strict.do("POST", "/albums", `{"title": "Kind of Blue", "artist": "Miles Davis", "price": 499}`); w.Code != 400 || !strings.Contains(w.Body.String(), "unusually high") {
+		t.Errorf("Expected 400 for a strict warning, got %d: %s", w.Code, w.Body)
+	}
+	if w := strict.do("PUT", "/albums/550e8400-e29b-41d4-a716-446655440002", `{"title": "Jeru", "artist": "Gerry Mulligan", "price": 499}`, "If-Match", "*"); w.Code != 400 {
+		t.Errorf("Expected 400 updating to a strict warning, got %d", w.Code)
+	}
+	if w := strict.do("POST", "/albums", `{"title": "A LOVE SUPREME", "artist": "John Coltrane", "price": 9.99}`); w.Code != 201 || len(codes(w)) != 1 {
+		t.Errorf("Expected warnings not listed in VALIDATION_STRICT to stay warnings, got %d: %s", w.Code, w.Body)
+	}
+}